@@ -1,11 +1,13 @@
 package analyzeimages
 
 import (
+	"context"
 	"os/exec"
 	"bytes"
 	"errors"
 	"log"
 	"fmt"
+	"html"
 	"os"
 	"encoding/json"
 	"strings"
@@ -15,6 +17,7 @@ import (
 	"github.com/MXi4oyu/DockerXScan/featurens"
 	"github.com/MXi4oyu/DockerXScan/database"
 	"github.com/MXi4oyu/DockerXScan/api/v1"
+	"github.com/MXi4oyu/DockerXScan/result"
 	"net/http"
 	"io/ioutil"
 	_"github.com/kr/text"
@@ -37,11 +40,96 @@ const (
 	httpPort            = 9279
 )
 
+// onlyFixed controls whether vulnerabilities without a fixed version are left
+// out of reports, reported in default.
+var onlyFixed = false
+
+// SetOnlyFixed sets whether vulnerabilities without a fixed version are left
+// out of reports. They are still counted in the summary.
+func SetOnlyFixed(only bool) {
+	onlyFixed = only
+}
+
+// minimumAge is how long ago vulnerabilities must have been published to be
+// reported, all being reported in default.
+var minimumAge time.Duration
+
+// SetMinimumAge sets how long ago vulnerabilities must have been published to
+// be reported, so that the recently disclosed ones are given a grace period.
+// Vulnerabilities whose publication date is unknown are always reported.
+func SetMinimumAge(age time.Duration) {
+	minimumAge = age
+}
+
+// minimumConfidence is the confidence vulnerabilities must have to be
+// reported, all being reported in default.
+var minimumConfidence = database.LowConfidence
+
+// SetMinimumConfidence sets the confidence vulnerabilities must have to be
+// reported, HighConfidence leaving out those whose affected versions are only
+// approximated. The low confidence ones that are reported are marked as
+// such, to be reviewed.
+func SetMinimumConfidence(confidence database.Confidence) {
+	minimumConfidence = confidence
+}
+
+// featureKind is the kind of the features whose vulnerabilities are reported,
+// all being reported in default.
+var featureKind database.FeatureKind
+
+// SetFeatureKind sets the kind of the features whose vulnerabilities are
+// reported, such as database.OSFeature to only report those of the packages of
+// the distribution. An empty kind reports all of them.
+func SetFeatureKind(kind database.FeatureKind) {
+	featureKind = kind
+}
+
+// unknownSeverity is the severity applied to the vulnerabilities of unknown
+// severity when they are gated by the minimum severity, Unknown in default.
+var unknownSeverity = database.UnknownSeverity
+
+// SetUnknownSeverity sets the severity applied to the vulnerabilities of
+// unknown severity when they are gated by the minimum severity, so that they
+// don't slip past a High gate. Reports still show them as Unknown.
+func SetUnknownSeverity(severity database.Severity) {
+	unknownSeverity = severity
+}
+
+// EffectiveSeverity returns the severity with which a vulnerability is gated.
+func EffectiveSeverity(severity database.Severity) database.Severity {
+	if severity == database.UnknownSeverity {
+		return unknownSeverity
+	}
+	return severity
+}
+
+// maxLayers is the number of layers an image may have to be analyzed, zero
+// meaning unbounded, which is the default.
+var maxLayers = 0
+
+// SetMaxLayers sets the number of layers an image may have to be analyzed, so
+// that an image made of thousands of layers is refused before they are
+// analyzed. Zero means unbounded.
+func SetMaxLayers(max int) {
+	maxLayers = max
+}
+
+// checkLayerCount returns an error when an image has more layers than allowed.
+func checkLayerCount(count int) error {
+	if maxLayers > 0 && count > maxLayers {
+		return fmt.Errorf("The image has %d layers, more than the maximum of %d", count, maxLayers)
+	}
+	return nil
+}
+
 
 type vulnerabilityInfo struct {
 	vulnerability v1.Vulnerability
 	feature       v1.Feature
 	severity      database.Severity
+
+	// sources are the findings merged into the vulnerability.
+	sources []result.Source
 }
 
 
@@ -97,7 +185,17 @@ type Results struct{
 }
 
 
-func AnalyzeLocalImage(imageName string, minSeverity database.Severity, endpoint, myAddress, tmpPath string)error   {
+// AnalyzeLocalImage saves a local image and submits its layers to the server
+// at endpoint, printing the report of its top layer. progress, if not nil, is
+// called with each step of the analysis.
+//
+// Each image is analyzed by a process of its own, so the concurrent scans of
+// the same image are not coalesced here but by the server, layer by layer, as
+// their submissions of the same layer, digest and parent wait for the one
+// processing it.
+func AnalyzeLocalImage(imageName string, minSeverity database.Severity, endpoint, myAddress, tmpPath string, progress ProgressFunc)error   {
+	ctx, cancel := scanContext()
+	defer cancel()
 
 	//先将镜像保存到本地临时文件
 	log.Printf("Saving %s to local disk (this may take some time)", imageName)
@@ -105,6 +203,8 @@ func AnalyzeLocalImage(imageName string, minSeverity database.Severity, endpoint
 	if err != nil {
 		return fmt.Errorf("Could not save image: %s", err)
 	}
+	progress.emit(ScanEvent{Kind: EventImageSaved, Image: imageName})
+	misconfigurations := imageMisconfigurations(tmpPath)
 
 	//读取镜像历史
 	log.Println("Retrieving image history")
@@ -113,31 +213,34 @@ func AnalyzeLocalImage(imageName string, minSeverity database.Severity, endpoint
 	if err != nil {
 		layerIDs, err = historyFromCommand(imageName)
 	}
-	if err != nil || len(layerIDs) == 0 {
+	if err != nil {
 		return fmt.Errorf("Could not get image's history: %s", err)
 	}
+	if err := checkLayerCount(len(layerIDs)); err != nil {
+		return err
+	}
+	progress.emit(ScanEvent{Kind: EventManifestFetched, Image: imageName, Total: len(layerIDs)})
+	progress.layersSaved(imageName, layerIDs)
 
+	// An image built FROM scratch without adding any file has no layer, and
+	// thus no vulnerability.
+	if len(layerIDs) == 0 {
+		err = printReport(imageName, v1.Layer{}, imageFacts{}, minSeverity, endpoint)
+		printMisconfigurations(misconfigurations)
+		return err
+	}
 
-	// Setup a simple HTTP server if Clair is not local.
-	if !strings.Contains(endpoint, "127.0.0.1") && !strings.Contains(endpoint, "localhost") {
-		allowedHost := strings.TrimPrefix(endpoint, "http://")
-		portIndex := strings.Index(allowedHost, ":")
-		if portIndex >= 0 {
-			allowedHost = allowedHost[:portIndex]
-		}
-
-		log.Printf("Setting up HTTP server (allowing: %s)\n", allowedHost)
 
-		ch := make(chan error)
-		go listenHTTP(tmpPath, allowedHost, ch)
-		select {
-		case err := <-ch:
-			return fmt.Errorf("An error occured when starting HTTP server: %s", err)
-		case <-time.After(100 * time.Millisecond):
-			break
-		}
+	digests, err := layerDigests(tmpPath, layerIDs)
+	if err != nil {
+		return fmt.Errorf("Could not compute the digests of the layers: %s", err)
+	}
+	facts := imageFacts{history: layerHistory(tmpPath, layerIDs), baseLayers: imageBaseLayers(tmpPath, layerIDs), libc: imageLibc(tmpPath, layerIDs)}
+	secrets := imageSecrets(tmpPath, layerIDs)
 
-		tmpPath = "http://" + myAddress + ":" + strconv.Itoa(httpPort)
+	tmpPath, err = serveLayers(tmpPath, endpoint, myAddress)
+	if err != nil {
+		return err
 	}
 
 
@@ -145,70 +248,221 @@ func AnalyzeLocalImage(imageName string, minSeverity database.Severity, endpoint
 	//分析每一层镜像
 	log.Printf("Analyzing %d layers... \n", len(layerIDs))
 	for i := 0; i < len(layerIDs); i++ {
+		if ctx.Err() != nil {
+			facts.skipped = skipLayers(progress, imageName, layerIDs, i)
+			break
+		}
 		log.Printf("Analyzing %s\n", layerIDs[i])
+		progress.emit(ScanEvent{Kind: EventLayerSubmitted, Image: imageName, Layer: layerIDs[i], Index: i + 1, Total: len(layerIDs)})
 
 		if i > 0 {
-			err = analyzeLayer(tmpPath+"/"+layerIDs[i]+"/layer.tar", layerIDs[i], layerIDs[i-1])
+			err = analyzeLayerContext(ctx, tmpPath+"/"+layerIDs[i]+"/layer.tar", digests[i], layerIDs[i], layerIDs[i-1])
 		} else {
-			err = analyzeLayer(tmpPath+"/"+layerIDs[i]+"/layer.tar", layerIDs[i], "")
+			err = analyzeLayerContext(ctx, tmpPath+"/"+layerIDs[i]+"/layer.tar", digests[i], layerIDs[i], "")
+		}
+		if err != nil && ctx.Err() != nil {
+			facts.skipped = skipLayers(progress, imageName, layerIDs, i)
+			break
 		}
 		if err != nil {
 			return fmt.Errorf("Could not analyze layer: %s", err)
 		}
+		progress.emit(ScanEvent{Kind: EventLayerAnalyzed, Image: imageName, Layer: layerIDs[i], Index: i + 1, Total: len(layerIDs)})
 	}
 
+	// The features of a layer include those of its parents, so the report of
+	// the last layer analyzed is that of the part of the image analyzed.
+	analyzed := len(layerIDs) - len(facts.skipped)
+	if analyzed == 0 {
+		return fmt.Errorf("Could not analyze the image: the scan timed out after %s before any layer was analyzed", scanTimeout)
+	}
+
+	err = reportLayer(progress, imageName, layerIDs[analyzed-1], facts, minSeverity, endpoint)
+	printMisconfigurations(misconfigurations)
+	printSecrets(secrets)
+	return err
+}
+
+// imageFacts is what is known of an image apart from the features of its top
+// layer: the history attributing the vulnerabilities to the build
+// instructions, which may be nil, the layers skipped above the top layer
+// analyzed, and the libc.
+type imageFacts struct {
+	history    result.History
+	baseLayers result.BaseLayers
+	skipped    []string
+	libc       featurens.Libc
+}
+
+// apply returns a copy of a result of the image completed with the facts.
+func (f imageFacts) apply(r result.ImageResult) result.ImageResult {
+	r = r.WithHistory(f.history).WithBaseLayers(f.baseLayers).WithSkippedLayers(f.skipped)
+	r.Libc = string(f.libc)
+	return r
+}
+
+// reportLayer retrieves the vulnerabilities of the top layer of an image and
+// prints the report, completed with the facts of the image.
+func reportLayer(progress ProgressFunc, imageName, layerID string, facts imageFacts, minSeverity database.Severity, endpoint string) error {
+
 	//获取漏洞信息
 
 	log.Println("Retrieving image's vulnerabilities")
-	layer, err := getLayer(endpoint, layerIDs[len(layerIDs)-1])
+	progress.emit(ScanEvent{Kind: EventResolvingVulnerabilities, Image: imageName, Layer: layerID})
+	layer, err := getLayer(endpoint, layerID)
 	if err != nil {
 		fmt.Errorf("Could not get layer information: %s", err)
 	}
 
+	return printReport(imageName, layer, facts, minSeverity, endpoint)
+}
+
+// printReport prints the report of the vulnerabilities of the features of the
+// top layer of an image, asking the API at endpoint what the policy needs. The
+// facts tell which build instruction introduced them and which layers above
+// it were not analyzed. The result, changed by the registered
+// result.Processors, is also written to the output file, if any.
+func printReport(imageName string, layer v1.Layer, facts imageFacts, minSeverity database.Severity, endpoint string) (reportErr error) {
+	var err error
+
+	report := facts.apply(result.FromLayer(imageName, layer))
+	var htmlBlocks bytes.Buffer
+	defer func() {
+		if err := writeOutput(report, htmlBlocks.String()); err != nil {
+			if reportErr != nil {
+				log.Print(err)
+			} else {
+				reportErr = err
+			}
+		}
+	}()
+
 	//打印报告
 
-	fmt.Printf("DockerXScan report for image %s (%s)\n", imageName, time.Now().UTC())
+	fmt.Printf("DockerXScan report for image %s (%s)\n", redact(imageName), time.Now().UTC())
+	printSkippedLayers(facts.skipped)
+	if facts.libc != "" {
+		fmt.Printf("Detected libc: %s\n", facts.libc)
+	}
+
+	if len(layer.Features) == 0 && result.DetectedNamespace(layer) == result.ScratchNamespace {
+		fmt.Printf("Detected namespace: %s\n", result.ScratchNamespace)
+		fmt.Printf("%s No operating system nor features have been detected in the image, which has no known vulnerabilities\n", color.GreenString("Success!"))
+		htmlBlocks.WriteString("<h2>No operating system nor features have been detected in the image</h2>")
+
+		return nil
+	}
 
 	if len(layer.Features) == 0 {
 		fmt.Printf("%s No features have been detected in the image. This usually means that the image isn't supported by Clair.\n", color.YellowString("NOTE:"))
+		htmlBlocks.WriteString("<h2>No features have been detected in the image</h2>")
 
 		return nil
 	}
 
 	isSafe := true
 	hasVisibleVulnerabilities := false
+	unfixed := 0
+	recent := 0
+	inherited := 0
+	lowConfidence := 0
+
+	var vex result.VEXDocuments
+	if useVEX {
+		vex = fetchVEX(imageName)
+	}
+	suppressions := fetchSuppressions(endpoint)
+	report, _ = report.ApplyVEX(vex)
+	report, _ = report.AcceptRisks(suppressions)
+	if err := result.Process(context.Background(), &report); err != nil {
+		log.Printf("Could not process the result of %s: %s", redact(imageName), err)
+	}
+	sendFindings(report)
+	var suppressed, accepted []string
 
 	var vulnerabilities = make([]vulnerabilityInfo, 0)
 	for _, feature := range layer.Features {
+		if featureKind != "" && feature.Kind != string(featureKind) {
+			continue
+		}
 		if len(feature.Vulnerabilities) > 0 {
 			for _, vulnerability := range feature.Vulnerabilities {
 				severity := database.Severity(vulnerability.Severity)
+
+				if s := vex.Suppression(vulnerability.Name, feature.Name); s != nil {
+					suppressed = append(suppressed, fmt.Sprintf("%s in %s is not affected according to %s (%s)", vulnerability.Name, feature.Name, s.Document, s.Justification))
+					continue
+				}
+				if s, ok := suppressions.Find(vulnerability.NamespaceName, feature.Name, vulnerability.Name); ok {
+					accepted = append(accepted, describeAcceptedRisk(vulnerability.Name, feature.Name, s))
+					continue
+				}
 				isSafe = false
 
-				if minSeverity.Compare(severity) > 0 {
+				if minSeverity.Compare(EffectiveSeverity(severity)) > 0 {
+					continue
+				}
+
+				if onlyFixed && vulnerability.FixedBy == "" {
+					unfixed++
+					continue
+				}
+
+				if database.Confidence(vulnerability.Confidence).Compare(minimumConfidence) < 0 {
+					lowConfidence++
+					continue
+				}
+
+				if published, err := time.Parse(time.RFC3339, vulnerability.PublishedDate); minimumAge > 0 && err == nil && time.Since(published) < minimumAge {
+					recent++
+					continue
+				}
+
+				if _, ok := facts.baseLayers[feature.AddedBy]; ok && excludeInherited {
+					inherited++
 					continue
 				}
 
 				hasVisibleVulnerabilities = true
-				vulnerabilities = append(vulnerabilities, vulnerabilityInfo{vulnerability, feature, severity})
+				vulnerabilities = append(vulnerabilities, vulnerabilityInfo{vulnerability: vulnerability, feature: feature, severity: severity})
 			}
 		}
 	}
 
+	// The vulnerabilities are first put in the canonical order, so that the
+	// report of the same image is always the same whatever order its features
+	// were returned in.
+	canonical := func(v1, v2 vulnerabilityInfo) bool {
+		return result.CompareVulnerabilities(v1.result(), v2.result()) < 0
+	}
+	By(canonical).Sort(vulnerabilities)
+
+	shown, merged := vulnerabilities, 0
+	if mergeDuplicates {
+		vulnerabilities, merged = mergeVulnerabilities(vulnerabilities)
+	}
+
 	// Sort vulnerabilitiy by severity.
 	priority := func(v1, v2 vulnerabilityInfo) bool {
-		return v1.severity.Compare(v2.severity) >= 0
+		if c := v1.severity.Compare(v2.severity); c != 0 {
+			return c > 0
+		}
+		return canonical(v1, v2)
 	}
 
 	By(priority).Sort(vulnerabilities)
         //fmt.Println(vulnerabilities)
-        var vname,vdescription,vpackage,vfixby,vlink,vlayer string
+        var vname,vdescription,vpackage,vlocation,vfixby,vlink,vsource,vlayer string
         //创建扫描结果文件
         uimage,_:=url.Parse("https://"+imageName)
         srpwdfile:="/code/DockerXface/docker_registry_face/static/results/"+uimage.Path+".html"
 
 		//如果存在则删除
         os.Remove(srpwdfile)
+	appendHTML := func(content string) {
+		AppendToFile(srpwdfile, content)
+		htmlBlocks.WriteString(content)
+	}
 
         //更新扫描进度
         msession,_:=mgo.Dial("localhost:27017")
@@ -238,65 +492,179 @@ func AnalyzeLocalImage(imageName string, minSeverity database.Severity, endpoint
 		//fmt.Printf("%s (%s)\n", vulnerability.Name, coloredSeverity(severity))
                 vname="<div class=\"vname\">"+vulnerability.Name+"&nbsp;&nbsp;"+coloredSeverity(severity)+"</div>" 
                 fmt.Println(vname)
-                AppendToFile(srpwdfile,vname)
+                appendHTML(vname)
 
 		if vulnerability.Description != "" {
 			//fmt.Printf("%s\n\n", text.Indent(text.Wrap(vulnerability.Description, 80), "\t"))
                         vdescription="<div class=\"vdescription\">"+vulnerability.Description+"</div>"
                         fmt.Println(vdescription)
-                        AppendToFile(srpwdfile,vdescription)
+                        appendHTML(vdescription)
 		}
 
 		//fmt.Printf("\tPackage:       %s @ %s\n", feature.Name, feature.Version)
                 vpackage="<div class=\"vpackage\">"+"Package:"+"&nbsp;&nbsp;"+feature.Name+"@"+feature.Version+"</div>"
+		if feature.Root != "" {
+			// The package belongs to a system nested in the image.
+			vpackage = "<div class=\"vpackage\">" + "Package:" + "&nbsp;&nbsp;" + feature.Name + "@" + feature.Version + "&nbsp;in&nbsp;/" + redact(feature.Root) + "</div>"
+		}
                 fmt.Println(vpackage)
+		if feature.Location != "" {
+			// The file to change in the Dockerfile to remediate it.
+			vlocation = "<div class=\"vlocation\">" + "Location:" + "&nbsp;&nbsp;/" + redact(feature.Location) + "</div>"
+			fmt.Println(vlocation)
+			appendHTML(vlocation)
+		}
 		if vulnerability.FixedBy != "" {
 			//fmt.Printf("\tFixed version: %s\n", vulnerability.FixedBy)
                         vfixby="<div class=\"vfixby\">"+"Fixed version:"+"&nbsp;&nbsp;"+vulnerability.FixedBy+"</div>"
                         fmt.Println(vfixby)
-                        AppendToFile(srpwdfile,vfixby)
+                        appendHTML(vfixby)
+		}
+
+		if vulnerability.KnownExploited || vulnerability.EPSSScore > 0 {
+			// How likely the vulnerability is to be exploited, to prioritize it.
+			exploitation := fmt.Sprintf("EPSS %.1f%%", vulnerability.EPSSScore*100)
+			if vulnerability.KnownExploited {
+				exploitation = color.RedString("known exploited") + ", " + exploitation
+			}
+			vexploit := "<div class=\"vexploit\">" + "Exploitation:" + "&nbsp;&nbsp;" + exploitation + "</div>"
+			fmt.Println(vexploit)
+			appendHTML(vexploit)
+		}
+
+		if database.Confidence(vulnerability.Confidence) == database.LowConfidence {
+			// The affected versions are approximated, the match is to be
+			// reviewed.
+			vconfidence := "<div class=\"vconfidence\">" + "Confidence:" + "&nbsp;&nbsp;" + color.YellowString("low") + ", the affected versions are approximated</div>"
+			fmt.Println(vconfidence)
+			appendHTML(vconfidence)
 		}
 
 		if vulnerability.Link != "" {
 			//fmt.Printf("\tLink:          %s\n", vulnerability.Link)
                         vlink="<div class=\"vlink\">"+"Link:"+"&nbsp;&nbsp;"+vulnerability.Link+"</div>"
                         fmt.Println(vlink)
-                        AppendToFile(srpwdfile,vlink)
+                        appendHTML(vlink)
+		}
+
+		for _, source := range vulnerabilityInfo.sources {
+			vsource = "<div class=\"vsource\">" + "Source:" + "&nbsp;&nbsp;" + source.NamespaceName + "&nbsp;" + source.FeatureName + "@" + source.FeatureVersion + "</div>"
+			fmt.Println(vsource)
+			appendHTML(vsource)
 		}
 
 		//fmt.Printf("\tLayer:         %s\n", feature.AddedBy)
                 vlayer="<div class=\"vlayer\">"+"&nbsp;&nbsp;"+feature.AddedBy+"</div>"
                 fmt.Println(vlayer)
+                appendHTML(vlayer)
+		if instruction, ok := facts.history[feature.AddedBy]; ok {
+			// The build instruction to change to remediate it.
+			vintroduced := "<div class=\"vintroduced\">" + "Introduced by:" + "&nbsp;&nbsp;" + html.EscapeString(redact(instruction)) + "</div>"
+			fmt.Println(vintroduced)
+			appendHTML(vintroduced)
+		}
+		if base, ok := facts.baseLayers[feature.AddedBy]; ok {
+			// Tracked by the maintainers of the base image instead.
+			vinherited := "<div class=\"vinherited\">" + "Inherited from approved base:" + "&nbsp;&nbsp;" + html.EscapeString(redact(base)) + "</div>"
+			fmt.Println(vinherited)
+			appendHTML(vinherited)
+		}
 		fmt.Println("")
-                AppendToFile(srpwdfile,vlayer)
-                AppendToFile(srpwdfile,"<hr style=\"FILTER: alpha(opacity=100,finishopacity=0,style=2)\" width=\"80%\" color=#987cb9 SIZE=10>")
+                appendHTML("<hr style=\"FILTER: alpha(opacity=100,finishopacity=0,style=2)\" width=\"80%\" color=#987cb9 SIZE=10>")
  
 	}
 
         cs.Update(bson.M{"tag_url":"https://"+imageName},bson.M{"$set":bson.M{"speed":100}})
+	if unfixed > 0 {
+		fmt.Printf("%s %d vulnerabilities without an available fix are not shown\n", color.YellowString("NOTE:"), unfixed)
+	}
+	if recent > 0 {
+		fmt.Printf("%s %d vulnerabilities published less than %s ago are not shown\n", color.YellowString("NOTE:"), recent, minimumAge)
+	}
+	if lowConfidence > 0 {
+		fmt.Printf("%s %d vulnerabilities whose affected versions are approximated are not shown\n", color.YellowString("NOTE:"), lowConfidence)
+	}
+	if inherited > 0 {
+		fmt.Printf("%s %d vulnerabilities inherited from approved base images are not shown\n", color.YellowString("NOTE:"), inherited)
+	}
+	if merged > 0 {
+		fmt.Printf("%s %d duplicate findings of the same vulnerabilities have been merged\n", color.YellowString("NOTE:"), merged)
+	}
+	for _, s := range suppressed {
+		fmt.Printf("%s %s\n", color.YellowString("NOTE:"), s)
+	}
+	if len(accepted) > 0 {
+		appendHTML("<h2>Accepted risks</h2>")
+	}
+	for _, a := range accepted {
+		fmt.Printf("%s %s\n", color.YellowString("ACCEPTED RISK:"), a)
+		appendHTML("<div class=\"vaccepted\">"+html.EscapeString(a)+"</div>")
+	}
+	printRemediation(remediation(imageName, layer, shown))
+	printSummary(shownResult(imageName, layer, shown).Summarize(summarySize))
+
+	var policyErr error
+	if reportPolicy != nil {
+		evaluated := report
+		if excludeInherited {
+			evaluated, _ = report.NotInherited()
+		}
+		policyErr = EvaluatePolicy(evaluated, endpoint)
+	}
+
 	if isSafe {
  
                 cs.Update(bson.M{"tag_url":"https://"+imageName},bson.M{"$set":bson.M{"speed":100}})
-                AppendToFile(srpwdfile,"<h2>No vulnerabilities were detected in your image</h2>")
+                appendHTML("<h2>No vulnerabilities were detected in your image</h2>")
 		fmt.Printf("%s No vulnerabilities were detected in your image\n", color.GreenString("Success!"))
 	} else if !hasVisibleVulnerabilities {
                 cs.Update(bson.M{"tag_url":"https://"+imageName},bson.M{"$set":bson.M{"speed":100}})
-                AppendToFile(srpwdfile,"<h2>No vulnerabilities matching the minimum severity level were detected in your image</h2>")
+                appendHTML("<h2>No vulnerabilities matching the minimum severity level were detected in your image</h2>")
 		fmt.Printf("%s No vulnerabilities matching the minimum severity level were detected in your image\n", color.YellowString("NOTE:"))
 	} else {
                 cs.Update(bson.M{"tag_url":"https://"+imageName},bson.M{"$set":bson.M{"speed":100}})
                 fstr:="A total of "+string(len(vulnerabilities))+"vulnerabilities have been detected in your image"
-                AppendToFile(srpwdfile,"<h2>"+fstr+"</h2>")
+                appendHTML("<h2>"+fstr+"</h2>")
+		if reportPolicy != nil {
+			fmt.Printf("%s A total of %d vulnerabilities have been detected in your image\n", color.YellowString("NOTE:"), len(vulnerabilities))
+			return policyErr
+		}
 		return fmt.Errorf("A total of %d vulnerabilities have been detected in your image", len(vulnerabilities))
 
 	}
  
         cs.Update(bson.M{"tag_url":"https://"+imageName},bson.M{"$set":bson.M{"speed":100}})
-	return nil
+	return policyErr
 
 }
 
 
+// serveLayers sets up a simple HTTP server serving path if Clair is not
+// local, and returns the location of path from the point of view of Clair.
+func serveLayers(path, endpoint, myAddress string) (string, error) {
+	if strings.Contains(endpoint, "127.0.0.1") || strings.Contains(endpoint, "localhost") {
+		return path, nil
+	}
+
+	allowedHost := strings.TrimPrefix(endpoint, "http://")
+	portIndex := strings.Index(allowedHost, ":")
+	if portIndex >= 0 {
+		allowedHost = allowedHost[:portIndex]
+	}
+
+	log.Printf("Setting up HTTP server (allowing: %s)\n", allowedHost)
+
+	ch := make(chan error)
+	go listenHTTP(path, allowedHost, ch)
+	select {
+	case err := <-ch:
+		return "", fmt.Errorf("An error occured when starting HTTP server: %s", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	return "http://" + myAddress + ":" + strconv.Itoa(httpPort), nil
+}
+
 func listenHTTP(path, allowedHost string, ch chan error) {
 	restrictedFileServer := func(path, allowedHost string) http.Handler {
 		fc := func(w http.ResponseWriter, r *http.Request) {
@@ -351,6 +719,10 @@ func DetectImageContent(imageFormat, name, path string,parent string) (tarutil.F
 	//var filelists [] string =[]string{"var/lib/dpkg/status","lib/apk/db/installed","var/lib/rpm/Packages"}
 
 	files,err:=tarutil.ExtractFiles(f,totalRequiredFiles)
+	if err==tarutil.ErrTruncatedArchive{
+		log.Printf("Warning: layer %s is truncated, analyzing the files read before its end", name)
+		err=nil
+	}
 	if err!=nil{
 		fmt.Println("tar file error::",err.Error())
 	}
@@ -389,43 +761,28 @@ func DetectNamespace(files tarutil.FilesMap, parent *database.Layer)  (namespace
 }
 
 //分析每一层镜像
-func analyzeLayer(path, layerName, parentLayerName string) error {
+func analyzeLayer(path, digest, layerName, parentLayerName string) error {
+	return analyzeLayerContext(context.Background(), path, digest, layerName, parentLayerName)
+}
+
+// analyzeLayerContext is like analyzeLayer, but abandons the submission of
+// the layer once the context is done.
+func analyzeLayerContext(ctx context.Context, path, digest, layerName, parentLayerName string) error {
 
 	//方案二：通过API进行解包
 
 	//将layer.tar发送到服务端
 
-	payload := v1.LayerEnvelope{
-		Layer: &v1.Layer{
-			Name:       layerName,
-			Path:       path,
-			ParentName: parentLayerName,
-			Format:     "docker",
-		},
-	}
-
-	jsonPayload, err := json.Marshal(payload)
-	if err != nil {
-		return err
-	}
-
-	request, err := http.NewRequest("POST", endpoint+postLayerURI, bytes.NewBuffer(jsonPayload))
-	if err != nil {
-		return err
-	}
-	request.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{}
-	response, err := client.Do(request)
+	err := submitLayer(ctx, v1.Layer{
+		Name:       layerName,
+		Path:       path,
+		Digest:     digest,
+		ParentName: parentLayerName,
+		Format:     "docker",
+	})
 	if err != nil {
 		return err
 	}
-	defer response.Body.Close()
-
-	if response.StatusCode != 201 {
-		body, _ := ioutil.ReadAll(response.Body)
-		return fmt.Errorf("Got response %d with message %s", response.StatusCode, string(body))
-	}
 
 	//发送layer.tar结束
 
@@ -464,6 +821,36 @@ func analyzeLayer(path, layerName, parentLayerName string) error {
 	return err
 }
 
+// submitLayer submits a layer to the API to be analyzed, abandoning the
+// submission once the context is done.
+func submitLayer(ctx context.Context, layer v1.Layer) error {
+	jsonPayload, err := json.Marshal(v1.LayerEnvelope{Layer: &layer})
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequest("POST", endpoint+postLayerURI, bytes.NewBuffer(jsonPayload))
+	if err != nil {
+		return err
+	}
+	request = request.WithContext(ctx)
+	request.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != 201 {
+		body, _ := ioutil.ReadAll(response.Body)
+		return fmt.Errorf("Got response %d with message %s", response.StatusCode, string(body))
+	}
+
+	return nil
+}
+
 func historyFromCommand(imageName string) ([]string, error) {
 	var stderr bytes.Buffer
 	cmd := exec.Command("docker", "history", "-q", "--no-trunc", imageName)
@@ -510,7 +897,7 @@ func historyFromManifest(path string) ([]string, error) {
 	if err = json.NewDecoder(mf).Decode(&manifest); err != nil {
 		return nil, err
 	} else if len(manifest) != 1 {
-		return nil, err
+		return nil, errors.New("manifest.json does not describe exactly one image")
 	}
 	var layers []string
 	for _, layer := range manifest[0].Layers {
@@ -0,0 +1,30 @@
+package analyzeimages
+
+import (
+	"github.com/MXi4oyu/DockerXScan/result"
+)
+
+// trustedBases are the base images whose vulnerabilities are tagged as
+// inherited from them, none in default, and excludeInherited whether those are
+// left out of the report and of the policy.
+var (
+	trustedBases     result.TrustedBases
+	excludeInherited bool
+)
+
+// SetTrustedBases sets the trusted base images, whose vulnerabilities are
+// tracked separately: those of the features added by their layers are tagged
+// as inherited from them and, with exclude, are neither shown nor decided by
+// the policy, so that the analysis only fails on those the image introduced.
+func SetTrustedBases(bs result.TrustedBases, exclude bool) {
+	trustedBases, excludeInherited = bs, exclude
+}
+
+// imageBaseLayers returns the layers of the image saved in path that belong
+// to a trusted base image, or nil if none does or its diff IDs can't be read.
+func imageBaseLayers(path string, layerIDs []string) result.BaseLayers {
+	if len(trustedBases) == 0 {
+		return nil
+	}
+	return trustedBases.BaseLayers(layerIDs, diffIDs(path))
+}
@@ -0,0 +1,61 @@
+package analyzeimages
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/MXi4oyu/DockerXScan/result"
+	"github.com/fatih/color"
+)
+
+// imageMisconfigurations returns the misconfigurations of the configuration
+// of an image saved in path. Failures are logged and only make none be
+// returned, as they do not prevent the analysis of the layers.
+func imageMisconfigurations(path string) []result.Misconfiguration {
+	mf, err := os.Open(filepath.Join(path, "manifest.json"))
+	if err != nil {
+		log.Printf("Could not read the image manifest, skipping its configuration: %s", err)
+		return nil
+	}
+	defer mf.Close()
+
+	var manifest []struct {
+		Config string
+	}
+	if err := json.NewDecoder(mf).Decode(&manifest); err != nil || len(manifest) != 1 || manifest[0].Config == "" {
+		log.Println("Could not find the image configuration, skipping it")
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(path, manifest[0].Config))
+	if err != nil {
+		log.Printf("Could not read the image configuration: %s", err)
+		return nil
+	}
+
+	config, err := result.ParseImageConfig(data)
+	if err != nil {
+		log.Printf("Could not parse the image configuration: %s", err)
+		return nil
+	}
+
+	return config.Misconfigurations()
+}
+
+func printMisconfigurations(misconfigurations []result.Misconfiguration) {
+	if len(misconfigurations) == 0 {
+		return
+	}
+
+	fmt.Printf("%d misconfigurations have been detected in your image\n", len(misconfigurations))
+	for _, m := range misconfigurations {
+		fmt.Printf("%s %s (%s)\n", color.YellowString("MISCONFIGURATION:"), m.Title, coloredSeverity(m.Severity))
+		if m.Description != "" {
+			fmt.Printf("\t%s\n", m.Description)
+		}
+	}
+}
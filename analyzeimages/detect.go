@@ -0,0 +1,87 @@
+package analyzeimages
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/MXi4oyu/DockerXScan/database"
+	"github.com/MXi4oyu/DockerXScan/featurefmt"
+)
+
+// LayerDetection is what the detectors found in a layer of an image.
+type LayerDetection struct {
+	Layer     string
+	Namespace *database.Namespace
+	Features  []database.FeatureVersion
+
+	// CreatedBy is the build instruction that created the layer, if the
+	// history of the image tells.
+	CreatedBy string
+}
+
+// DetectLocalImage runs the detectors over every layer of a local image and
+// returns what they found, without submitting anything to the API, which is
+// useful to understand why an image has no vulnerabilities.
+//
+// As during an analysis, a layer whose namespace or features can't be detected
+// inherits those of its parent. An image built FROM scratch without adding any
+// file has no layer, in which case no detection is returned.
+func DetectLocalImage(imageName, tmpPath string, progress ProgressFunc) ([]LayerDetection, error) {
+	log.Printf("Saving %s to local disk (this may take some time)", imageName)
+	if err := save(imageName, tmpPath); err != nil {
+		return nil, fmt.Errorf("Could not save image: %s", err)
+	}
+	progress.emit(ScanEvent{Kind: EventImageSaved, Image: imageName})
+
+	log.Println("Retrieving image history")
+	layerIDs, err := historyFromManifest(tmpPath)
+	if err != nil {
+		layerIDs, err = historyFromCommand(imageName)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Could not get image's history: %s", err)
+	}
+	if err := checkLayerCount(len(layerIDs)); err != nil {
+		return nil, err
+	}
+	progress.emit(ScanEvent{Kind: EventManifestFetched, Image: imageName, Total: len(layerIDs)})
+	progress.layersSaved(imageName, layerIDs)
+
+	history := layerHistory(tmpPath, layerIDs)
+
+	var detections []LayerDetection
+	var parent *database.Layer
+	for i, layerID := range layerIDs {
+		files, err := DetectImageContent("docker", layerID, tmpPath+"/"+layerID+"/layer.tar", "")
+		if err != nil {
+			return nil, fmt.Errorf("Could not extract layer %s: %s", layerID, err)
+		}
+
+		namespace, err := DetectNamespace(files, parent)
+		if err != nil {
+			return nil, fmt.Errorf("Could not detect the namespace of layer %s: %s", layerID, err)
+		}
+
+		features, err := featurefmt.ListFeatures(files)
+		if err != nil {
+			return nil, fmt.Errorf("Could not list the features of layer %s: %s", layerID, err)
+		}
+		if len(features) == 0 && parent != nil {
+			features = parent.Features
+		}
+
+		// Associate the features with the namespace of the layer, as the worker
+		// does for the features that don't have one.
+		for j := range features {
+			if features[j].Feature.Namespace.Name == "" && namespace != nil {
+				features[j].Feature.Namespace = *namespace
+			}
+		}
+
+		detections = append(detections, LayerDetection{Layer: layerID, Namespace: namespace, Features: features, CreatedBy: history[layerID]})
+		parent = &database.Layer{Name: layerID, Namespace: namespace, Features: features}
+		progress.emit(ScanEvent{Kind: EventLayerAnalyzed, Image: imageName, Layer: layerID, Index: i + 1, Total: len(layerIDs)})
+	}
+
+	return detections, nil
+}
@@ -0,0 +1,98 @@
+package analyzeimages
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// layerDigests returns the digests, "sha256:<hex>", of the layers of an image
+// saved in path, against which the server verifies them.
+//
+// They are the diff IDs declared by the configuration of the image, which
+// are the digests of the uncompressed layer.tar files. When the configuration
+// can't be read or does not list every layer, the saved files are hashed
+// instead, which only detects a layer modified while it is served.
+func layerDigests(path string, layerIDs []string) ([]string, error) {
+	if digests := diffIDs(path); len(digests) == len(layerIDs) {
+		return digests, nil
+	}
+
+	digests := make([]string, 0, len(layerIDs))
+	for _, layerID := range layerIDs {
+		digest, err := fileDigest(filepath.Join(path, layerID, "layer.tar"))
+		if err != nil {
+			return nil, err
+		}
+		digests = append(digests, digest)
+	}
+
+	return digests, nil
+}
+
+// diffIDs returns the diff IDs of the configuration of the image saved in
+// path, or nil if they can't be read.
+func diffIDs(path string) []string {
+	data, err := readImageConfig(path)
+	if err != nil {
+		return nil
+	}
+
+	return configDiffIDs(data)
+}
+
+// configDiffIDs returns the diff IDs of the configuration of an image, or nil
+// if it can't be parsed.
+func configDiffIDs(data []byte) []string {
+	var config struct {
+		RootFS struct {
+			DiffIDs []string `json:"diff_ids"`
+		} `json:"rootfs"`
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil
+	}
+
+	return config.RootFS.DiffIDs
+}
+
+// readImageConfig returns the configuration blob of the image saved in path,
+// as referenced by its manifest.json.
+func readImageConfig(path string) ([]byte, error) {
+	data, err := ioutil.ReadFile(filepath.Join(path, "manifest.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest []struct {
+		Config string
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, err
+	}
+	if len(manifest) != 1 || manifest[0].Config == "" {
+		return nil, errors.New("manifest.json does not reference the configuration of exactly one image")
+	}
+
+	return ioutil.ReadFile(filepath.Join(path, manifest[0].Config))
+}
+
+func fileDigest(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,116 @@
+package analyzeimages
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+
+	"github.com/MXi4oyu/DockerXScan/api/v1"
+	"github.com/MXi4oyu/DockerXScan/database"
+	"github.com/MXi4oyu/DockerXScan/result"
+)
+
+const postFeatureVersionURI = "/v1/featureversion"
+
+// AnalyzeEphemeral analyzes a local image without storing anything in the
+// database of DockerXScan, which is useful for throwaway images built in CI.
+//
+// The layers are analyzed locally, and only the features of the top layer are
+// submitted to find the vulnerabilities affecting them.
+func AnalyzeEphemeral(imageName string, minSeverity database.Severity, endpoint, tmpPath string, progress ProgressFunc) error {
+	detections, err := DetectLocalImage(imageName, tmpPath, progress)
+	if err != nil {
+		return err
+	}
+	misconfigurations := imageMisconfigurations(tmpPath)
+	if len(detections) == 0 {
+		err = printReport(imageName, v1.Layer{}, imageFacts{}, minSeverity, endpoint)
+		printMisconfigurations(misconfigurations)
+		return err
+	}
+
+	// A feature was added by the first of the layers since which it has been
+	// present.
+	var layerIDs []string
+	for _, detection := range detections {
+		layerIDs = append(layerIDs, detection.Layer)
+	}
+	secrets := imageSecrets(tmpPath, layerIDs)
+
+	top := detections[len(detections)-1]
+	addedBy := make(map[string]string)
+	history := make(result.History)
+	for _, detection := range detections {
+		if detection.CreatedBy != "" {
+			history[detection.Layer] = detection.CreatedBy
+		}
+		present := make(map[string]struct{})
+		for _, fv := range detection.Features {
+			key := fv.Feature.Namespace.Name + ":" + fv.Feature.Name + "#" + fv.Version
+			present[key] = struct{}{}
+			if _, ok := addedBy[key]; !ok {
+				addedBy[key] = detection.Layer
+			}
+		}
+		for key := range addedBy {
+			if _, ok := present[key]; !ok {
+				delete(addedBy, key)
+			}
+		}
+	}
+
+	var features []v1.Feature
+	for _, fv := range top.Features {
+		feature := v1.FeatureFromDatabaseModel(fv)
+		feature.AddedBy = addedBy[fv.Feature.Namespace.Name+":"+fv.Feature.Name+"#"+fv.Version]
+		features = append(features, feature)
+	}
+
+	log.Println("Retrieving image's vulnerabilities")
+	progress.emit(ScanEvent{Kind: EventResolvingVulnerabilities, Image: imageName, Layer: top.Layer})
+	features, err = postFeatures(endpoint, features)
+	if err != nil {
+		return fmt.Errorf("Could not get the vulnerabilities of the features: %s", err)
+	}
+
+	err = printReport(imageName, v1.Layer{Name: top.Layer, Features: features}, imageFacts{history: history, baseLayers: imageBaseLayers(tmpPath, layerIDs), libc: imageLibc(tmpPath, layerIDs)}, minSeverity, endpoint)
+	printMisconfigurations(misconfigurations)
+	printSecrets(secrets)
+	return err
+}
+
+// postFeatures submits features and returns them with the vulnerabilities
+// affecting them.
+func postFeatures(endpoint string, features []v1.Feature) ([]v1.Feature, error) {
+	jsonPayload, err := json.Marshal(v1.FeatureEnvelope{Features: &features})
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := http.Post(endpoint+postFeatureVersionURI, "application/json", bytes.NewBuffer(jsonPayload))
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != 200 {
+		body, _ := ioutil.ReadAll(response.Body)
+		return nil, fmt.Errorf("Got response %d with message %s", response.StatusCode, string(body))
+	}
+
+	var apiResponse v1.FeatureEnvelope
+	if err = json.NewDecoder(response.Body).Decode(&apiResponse); err != nil {
+		return nil, err
+	} else if apiResponse.Error != nil {
+		return nil, errors.New(apiResponse.Error.Message)
+	}
+	if apiResponse.Features == nil {
+		return nil, nil
+	}
+
+	return *apiResponse.Features, nil
+}
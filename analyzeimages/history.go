@@ -0,0 +1,98 @@
+package analyzeimages
+
+import (
+	"encoding/json"
+	"log"
+	"strings"
+
+	"github.com/MXi4oyu/DockerXScan/result"
+)
+
+// The prefixes with which the legacy builder records the instructions in the
+// history of an image: the shell running a RUN, and the no-op shell command
+// standing for the other instructions.
+const (
+	shellPrefix = "/bin/sh -c "
+	nopPrefix   = shellPrefix + "#(nop) "
+)
+
+// historyEntry is an entry of the history of the configuration of an image.
+type historyEntry struct {
+	CreatedBy  string `json:"created_by"`
+	EmptyLayer bool   `json:"empty_layer"`
+}
+
+// layerHistory returns the build instructions that created the layers of the
+// image saved in path, or nil if its history can't be read.
+//
+// The history also holds the instructions that did not create a layer, such
+// as ENV or CMD, flagged as empty layers, which are skipped to align the
+// others with the layers in order.
+func layerHistory(path string, layerIDs []string) result.History {
+	data, err := readImageConfig(path)
+	if err != nil {
+		return nil
+	}
+
+	return configHistory(data, layerIDs)
+}
+
+// configHistory is like layerHistory, with the configuration of the image.
+func configHistory(data []byte, layerIDs []string) result.History {
+	var config struct {
+		History []historyEntry `json:"history"`
+	}
+	if err := json.Unmarshal(data, &config); err != nil || len(config.History) == 0 {
+		return nil
+	}
+
+	var instructions []string
+	for _, entry := range config.History {
+		if !entry.EmptyLayer {
+			instructions = append(instructions, instruction(entry.CreatedBy))
+		}
+	}
+	if len(instructions) != len(layerIDs) {
+		log.Printf("Warning: the history of the image describes %d layers instead of %d, not attributing them to build instructions", len(instructions), len(layerIDs))
+		return nil
+	}
+
+	history := make(result.History, len(layerIDs))
+	for i, layerID := range layerIDs {
+		if instructions[i] != "" {
+			history[layerID] = instructions[i]
+		}
+	}
+
+	return history
+}
+
+// instruction returns the Dockerfile instruction recorded by a created_by
+// entry of the history, which both the legacy builder and BuildKit record as
+// the shell command they ran.
+func instruction(createdBy string) string {
+	// BuildKit: "RUN /bin/sh -c apt-get update # buildkit", whose shell form
+	// is then the one of the legacy builder.
+	createdBy = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(createdBy), "# buildkit"))
+	if strings.HasPrefix(createdBy, "RUN ") {
+		if run := strings.TrimPrefix(createdBy, "RUN "); !strings.HasPrefix(run, shellPrefix) && !strings.HasPrefix(run, "|") {
+			return createdBy
+		}
+		createdBy = strings.TrimPrefix(createdBy, "RUN ")
+	}
+
+	switch {
+	case strings.HasPrefix(createdBy, nopPrefix):
+		// "/bin/sh -c #(nop) COPY file:8b8864b3e02a33a579dc216fd51b28a6047bc8eeaa03045b258980fe0cf7fcb3 in /".
+		return strings.TrimSpace(strings.TrimPrefix(createdBy, nopPrefix))
+	case strings.HasPrefix(createdBy, shellPrefix):
+		return "RUN " + strings.TrimPrefix(createdBy, shellPrefix)
+	case strings.HasPrefix(createdBy, "|"):
+		// A RUN given build arguments: "|1 VERSION=1.2 /bin/sh -c make".
+		if i := strings.Index(createdBy, shellPrefix); i >= 0 {
+			return "RUN " + createdBy[i+len(shellPrefix):]
+		}
+	}
+
+	return createdBy
+}
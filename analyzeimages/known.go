@@ -0,0 +1,147 @@
+package analyzeimages
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+
+	"github.com/MXi4oyu/DockerXScan/api/v1"
+	"github.com/MXi4oyu/DockerXScan/database"
+	"github.com/MXi4oyu/DockerXScan/registry"
+	"github.com/MXi4oyu/DockerXScan/result"
+)
+
+const getLayersByDigestURI = "/v1/layers?"
+
+// ErrUnknownLayers is returned by AnalyzeKnownImage when some of the layers
+// of the image have not been analyzed before, in which case the image has to
+// be analyzed in full.
+var ErrUnknownLayers = errors.New("the layers of the image have not all been analyzed before")
+
+// AnalyzeKnownImage prints the report of an image whose layers have all been
+// analyzed before, without pulling any of them: only its manifest and its
+// configuration are fetched from its registry, and its layers are found in
+// the database of DockerXScan by their digest.
+//
+// A layer is only known if it has been analyzed on top of the same parent,
+// as its features include those of its parents.
+func AnalyzeKnownImage(imageName string, minSeverity database.Severity, endpoint string, progress ProgressFunc) error {
+	host, repository := registry.SplitReference(imageName)
+	client := registry.NewClient(host, repository)
+
+	manifest, err := client.ImageManifest(registry.Reference(imageName))
+	if err != nil {
+		return fmt.Errorf("Could not get the manifest of the image: %s", err)
+	}
+	progress.emit(ScanEvent{Kind: EventManifestFetched, Image: imageName, Total: len(manifest.Layers)})
+
+	config, err := client.Blob(manifest.Config.Digest)
+	if err != nil {
+		return fmt.Errorf("Could not get the configuration of the image: %s", err)
+	}
+	if sum := sha256.Sum256(config); "sha256:"+hex.EncodeToString(sum[:]) != manifest.Config.Digest {
+		return fmt.Errorf("Could not get the configuration of the image: it does not match its digest %s", manifest.Config.Digest)
+	}
+
+	diffIDs := configDiffIDs(config)
+	if len(diffIDs) == 0 || len(diffIDs) != len(manifest.Layers) {
+		return fmt.Errorf("Could not get the layers of the image: its configuration describes %d layers instead of %d", len(diffIDs), len(manifest.Layers))
+	}
+	if err := checkLayerCount(len(diffIDs)); err != nil {
+		return err
+	}
+
+	// A layer may have been submitted with the digest of its archive, or with
+	// the digest of the blob of the registry.
+	digests := make([][]string, len(diffIDs))
+	for i, diffID := range diffIDs {
+		digests[i] = []string{diffID, manifest.Layers[i].Digest}
+	}
+	layerIDs, err := findKnownLayers(endpoint, digests)
+	if err != nil {
+		return err
+	}
+	log.Printf("All %d layers of %s are known, skipping their analysis", len(layerIDs), imageName)
+
+	var misconfigurations []result.Misconfiguration
+	if c, err := result.ParseImageConfig(config); err == nil {
+		misconfigurations = c.Misconfigurations()
+	} else {
+		log.Printf("Could not parse the image configuration: %s", err)
+	}
+
+	err = reportLayer(progress, imageName, layerIDs[len(layerIDs)-1], imageFacts{history: configHistory(config, layerIDs), baseLayers: trustedBases.BaseLayers(layerIDs, diffIDs)}, minSeverity, endpoint)
+	printMisconfigurations(misconfigurations)
+	return err
+}
+
+// findKnownLayers returns the names of the stored layers of an image, given
+// the digests that each of its layers may have been stored with, in order.
+// It fails with ErrUnknownLayers if a layer is not stored on top of the
+// previous one.
+func findKnownLayers(endpoint string, digests [][]string) ([]string, error) {
+	query := url.Values{}
+	for _, layerDigests := range digests {
+		for _, digest := range layerDigests {
+			query.Add("digest", digest)
+		}
+	}
+
+	response, err := http.Get(endpoint + getLayersByDigestURI + query.Encode())
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != 200 {
+		body, _ := ioutil.ReadAll(response.Body)
+		return nil, fmt.Errorf("Got response %d with message %s", response.StatusCode, string(body))
+	}
+
+	var apiResponse v1.LayerEnvelope
+	if err = json.NewDecoder(response.Body).Decode(&apiResponse); err != nil {
+		return nil, err
+	} else if apiResponse.Error != nil {
+		return nil, errors.New(apiResponse.Error.Message)
+	}
+
+	byDigest := make(map[string][]v1.Layer)
+	if apiResponse.Layers != nil {
+		for _, layer := range *apiResponse.Layers {
+			byDigest[layer.Digest] = append(byDigest[layer.Digest], layer)
+		}
+	}
+
+	var names []string
+	for _, layerDigests := range digests {
+		parent := ""
+		if len(names) > 0 {
+			parent = names[len(names)-1]
+		}
+
+		name := ""
+		for _, digest := range layerDigests {
+			for _, layer := range byDigest[digest] {
+				if layer.ParentName == parent {
+					name = layer.Name
+					break
+				}
+			}
+			if name != "" {
+				break
+			}
+		}
+		if name == "" {
+			return nil, ErrUnknownLayers
+		}
+		names = append(names, name)
+	}
+
+	return names, nil
+}
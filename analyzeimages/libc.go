@@ -0,0 +1,36 @@
+package analyzeimages
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/MXi4oyu/DockerXScan/featurens"
+	"github.com/MXi4oyu/DockerXScan/tarutil"
+)
+
+// imageLibc returns the libc of an image saved in path, as found in the files
+// of all of its layers. Failures are logged and only make the layer be
+// skipped, as they do not prevent the analysis.
+func imageLibc(path string, layerIDs []string) featurens.Libc {
+	files := make(tarutil.FilesMap)
+	for _, layerID := range layerIDs {
+		f, err := os.Open(filepath.Join(path, layerID, "layer.tar"))
+		if err != nil {
+			log.Printf("Could not open layer %s, skipping it to detect the libc: %s", layerID, err)
+			continue
+		}
+
+		found, err := tarutil.ExtractFiles(f, featurens.LibcFilenames())
+		f.Close()
+		if err != nil && err != tarutil.ErrTruncatedArchive {
+			log.Printf("Could not extract layer %s to detect the libc: %s", layerID, err)
+			continue
+		}
+		for filename, content := range found {
+			files[filename] = content
+		}
+	}
+
+	return featurens.DetectLibc(files)
+}
@@ -0,0 +1,71 @@
+package analyzeimages
+
+import (
+	"github.com/MXi4oyu/DockerXScan/database"
+	"github.com/MXi4oyu/DockerXScan/result"
+)
+
+// mergeDuplicates controls whether the vulnerabilities sharing a name are
+// reported once, each finding being reported in default.
+var mergeDuplicates = false
+
+// SetMergeDuplicates sets whether the vulnerabilities sharing a name, such as
+// a CVE found in the packages of two distributions, are reported once, as
+// result.ImageResult.MergeDuplicates merges them.
+func SetMergeDuplicates(merge bool) {
+	mergeDuplicates = merge
+}
+
+// mergeVulnerabilities merges the vulnerabilities shown that share a name, as
+// result.ImageResult.MergeDuplicates does, and returns the number of those
+// merged away.
+func mergeVulnerabilities(vulnerabilities []vulnerabilityInfo) ([]vulnerabilityInfo, int) {
+	merged := make([]vulnerabilityInfo, 0, len(vulnerabilities))
+	positions := make(map[string]int)
+	for _, v := range vulnerabilities {
+		i, ok := positions[v.vulnerability.Name]
+		if !ok {
+			positions[v.vulnerability.Name] = len(merged)
+			merged = append(merged, v)
+			continue
+		}
+
+		m := &merged[i]
+		sources := append(m.findings(), v.result().Source())
+		severity := m.severity
+		if severity.Compare(v.severity) < 0 {
+			severity = v.severity
+		}
+		if result.Preferred(v.result(), m.result()) {
+			*m = v
+		}
+		m.sources = sources
+		m.severity = severity
+	}
+
+	return merged, len(vulnerabilities) - len(merged)
+}
+
+// result returns the vulnerability as it is found in the results.
+func (v vulnerabilityInfo) result() result.Vulnerability {
+	return result.Vulnerability{
+		Name:           v.vulnerability.Name,
+		NamespaceName:  v.vulnerability.NamespaceName,
+		Severity:       v.severity,
+		FixedBy:        v.vulnerability.FixedBy,
+		FeatureName:    v.feature.Name,
+		FeatureVersion: v.feature.Version,
+		VersionFormat:  v.feature.VersionFormat,
+		FeatureKind:    v.feature.Kind,
+		KnownExploited: v.vulnerability.KnownExploited,
+		EPSSScore:      v.vulnerability.EPSSScore,
+		Confidence:     database.Confidence(v.vulnerability.Confidence),
+	}
+}
+
+func (v vulnerabilityInfo) findings() []result.Source {
+	if len(v.sources) == 0 {
+		return []result.Source{v.result().Source()}
+	}
+	return v.sources
+}
@@ -0,0 +1,294 @@
+package analyzeimages
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+
+	"github.com/MXi4oyu/DockerXScan/api/v1"
+	"github.com/MXi4oyu/DockerXScan/database"
+	"github.com/MXi4oyu/DockerXScan/result"
+)
+
+const (
+	ociIndexMediaType           = "application/vnd.oci.image.index.v1+json"
+	dockerManifestListMediaType = "application/vnd.docker.distribution.manifest.list.v2+json"
+
+	// ociRefNameAnnotation is the annotation of the descriptors of index.json
+	// naming the image they describe, such as "latest".
+	ociRefNameAnnotation = "org.opencontainers.image.ref.name"
+)
+
+// ociDigestRegexp matches the digests of the blobs that can be read, which
+// are then safe to use as a path.
+var ociDigestRegexp = regexp.MustCompile(`^sha256:[a-f0-9]{64}$`)
+
+// ociDescriptor is a descriptor of an OCI image layout, referencing a blob.
+type ociDescriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	Platform    *Platform         `json:"platform,omitempty"`
+}
+
+// ociIndex is an image index, such as the index.json of an OCI image layout.
+type ociIndex struct {
+	Manifests []ociDescriptor `json:"manifests"`
+}
+
+// ociManifest is an image manifest of an OCI image layout.
+type ociManifest struct {
+	Config ociDescriptor   `json:"config"`
+	Layers []ociDescriptor `json:"layers"`
+}
+
+// AnalyzeOCILayout analyzes an image of an OCI image layout, the directory
+// holding an index.json and a blobs directory such as buildah and skopeo
+// write. The target is the path to the layout, followed by the tag
+// (":latest") or the digest ("@sha256:...") of the image when the layout
+// holds several. An index referencing the images of several platforms is
+// resolved to the image of the platform DockerXScan runs on.
+//
+// The layers are the blobs of the layout, submitted as they are stored, and
+// named after their chain ID so that those shared by images are only
+// analyzed once.
+func AnalyzeOCILayout(target string, minSeverity database.Severity, endpoint, myAddress string, progress ProgressFunc) error {
+	ctx, cancel := scanContext()
+	defer cancel()
+
+	layout, ref := splitOCILayout(target)
+	manifest, config, err := readOCIImage(layout, ref)
+	if err != nil {
+		return fmt.Errorf("Could not read the image of the OCI layout %s: %s", target, err)
+	}
+	progress.emit(ScanEvent{Kind: EventManifestFetched, Image: target, Total: len(manifest.Layers)})
+	if err := checkLayerCount(len(manifest.Layers)); err != nil {
+		return err
+	}
+
+	var misconfigurations []result.Misconfiguration
+	if c, err := result.ParseImageConfig(config); err == nil {
+		misconfigurations = c.Misconfigurations()
+	} else {
+		log.Printf("Could not parse the image configuration: %s", err)
+	}
+
+	if len(manifest.Layers) == 0 {
+		err = printReport(target, v1.Layer{}, imageFacts{}, minSeverity, endpoint)
+		printMisconfigurations(misconfigurations)
+		return err
+	}
+
+	layerIDs := ociChainIDs(manifest.Layers, configDiffIDs(config))
+	facts := imageFacts{history: configHistory(config, layerIDs), baseLayers: trustedBases.BaseLayers(layerIDs, configDiffIDs(config))}
+
+	// The blobs are read by the server from the absolute path of the layout
+	// when it is local.
+	if layout, err = filepath.Abs(layout); err != nil {
+		return err
+	}
+	servedPath, err := serveLayers(layout, endpoint, myAddress)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Analyzing %d layers... \n", len(layerIDs))
+	for i, layer := range manifest.Layers {
+		if ctx.Err() != nil {
+			facts.skipped = skipLayers(progress, target, layerIDs, i)
+			break
+		}
+		log.Printf("Analyzing %s\n", layerIDs[i])
+		progress.emit(ScanEvent{Kind: EventLayerSubmitted, Image: target, Layer: layerIDs[i], Index: i + 1, Total: len(layerIDs)})
+
+		parent := ""
+		if i > 0 {
+			parent = layerIDs[i-1]
+		}
+		err = submitLayer(ctx, v1.Layer{
+			Name:       layerIDs[i],
+			Path:       servedPath + "/" + ociBlobPath(layer.Digest),
+			Digest:     layer.Digest,
+			ParentName: parent,
+			Format:     "docker",
+			MediaType:  layer.MediaType,
+		})
+		if err != nil && ctx.Err() != nil {
+			facts.skipped = skipLayers(progress, target, layerIDs, i)
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("Could not analyze layer: %s", err)
+		}
+		progress.emit(ScanEvent{Kind: EventLayerAnalyzed, Image: target, Layer: layerIDs[i], Index: i + 1, Total: len(layerIDs)})
+	}
+
+	analyzed := len(layerIDs) - len(facts.skipped)
+	if analyzed == 0 {
+		return fmt.Errorf("Could not analyze the image: the scan timed out after %s before any layer was analyzed", scanTimeout)
+	}
+
+	err = reportLayer(progress, target, layerIDs[analyzed-1], facts, minSeverity, endpoint)
+	printMisconfigurations(misconfigurations)
+	return err
+}
+
+// splitOCILayout splits the target of AnalyzeOCILayout into the path to the
+// layout and the tag or digest of the image, if any.
+func splitOCILayout(target string) (layout, ref string) {
+	if i := strings.LastIndex(target, "@"); i >= 0 && strings.HasPrefix(target[i+1:], "sha256:") {
+		return target[:i], target[i+1:]
+	}
+	if i := strings.LastIndex(target, ":"); i >= 0 && !strings.Contains(target[i+1:], "/") {
+		return target[:i], target[i+1:]
+	}
+	return target, ""
+}
+
+// readOCIImage returns the manifest and the configuration of the image of an
+// OCI image layout with a tag or digest, which may be empty when the layout
+// holds a single image.
+func readOCIImage(layout, ref string) (ociManifest, []byte, error) {
+	var manifest ociManifest
+
+	data, err := ioutil.ReadFile(filepath.Join(layout, "index.json"))
+	if err != nil {
+		return manifest, nil, err
+	}
+	var index ociIndex
+	if err := json.Unmarshal(data, &index); err != nil {
+		return manifest, nil, fmt.Errorf("invalid index.json: %s", err)
+	}
+
+	descriptor, err := selectOCIManifest(index.Manifests, ref)
+	if err != nil {
+		return manifest, nil, err
+	}
+
+	// Follow the nested indexes down to the manifest of the platform.
+	for depth := 0; isOCIIndex(descriptor.MediaType); depth++ {
+		if depth >= 4 {
+			return manifest, nil, errors.New("too many nested indexes")
+		}
+		if data, err = readOCIBlob(layout, descriptor.Digest); err != nil {
+			return manifest, nil, err
+		}
+		var nested ociIndex
+		if err := json.Unmarshal(data, &nested); err != nil {
+			return manifest, nil, fmt.Errorf("invalid index %s: %s", descriptor.Digest, err)
+		}
+		if descriptor, err = selectOCIPlatform(nested.Manifests); err != nil {
+			return manifest, nil, err
+		}
+	}
+
+	if data, err = readOCIBlob(layout, descriptor.Digest); err != nil {
+		return manifest, nil, err
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return manifest, nil, fmt.Errorf("invalid manifest %s: %s", descriptor.Digest, err)
+	}
+
+	config, err := readOCIBlob(layout, manifest.Config.Digest)
+	if err != nil {
+		return manifest, nil, err
+	}
+
+	return manifest, config, nil
+}
+
+// selectOCIManifest returns the descriptor of index.json with a tag or
+// digest, or its only descriptor when ref is empty.
+func selectOCIManifest(descriptors []ociDescriptor, ref string) (ociDescriptor, error) {
+	if ref == "" {
+		if len(descriptors) == 1 {
+			return descriptors[0], nil
+		}
+
+		var refs []string
+		for _, d := range descriptors {
+			if name := d.Annotations[ociRefNameAnnotation]; name != "" {
+				refs = append(refs, name)
+			} else {
+				refs = append(refs, d.Digest)
+			}
+		}
+		if len(refs) == 0 {
+			return ociDescriptor{}, errors.New("the layout holds no image")
+		}
+		return ociDescriptor{}, fmt.Errorf("the layout holds %d images, select one by tag or digest: %s", len(refs), strings.Join(refs, ", "))
+	}
+
+	for _, d := range descriptors {
+		if d.Digest == ref || d.Annotations[ociRefNameAnnotation] == ref {
+			return d, nil
+		}
+	}
+	return ociDescriptor{}, fmt.Errorf("the layout holds no image %s", ref)
+}
+
+// selectOCIPlatform returns the descriptor of the manifest of an index for
+// the platform DockerXScan runs on, or its only one.
+func selectOCIPlatform(descriptors []ociDescriptor) (ociDescriptor, error) {
+	if len(descriptors) == 1 {
+		return descriptors[0], nil
+	}
+	for _, d := range descriptors {
+		if d.Platform != nil && d.Platform.OS == runtime.GOOS && d.Platform.Architecture == runtime.GOARCH {
+			return d, nil
+		}
+	}
+	return ociDescriptor{}, fmt.Errorf("the index holds no image for %s/%s", runtime.GOOS, runtime.GOARCH)
+}
+
+func isOCIIndex(mediaType string) bool {
+	return mediaType == ociIndexMediaType || mediaType == dockerManifestListMediaType
+}
+
+// ociBlobPath returns the path of a blob relative to the root of its layout.
+func ociBlobPath(digest string) string {
+	return "blobs/" + strings.Replace(digest, ":", "/", 1)
+}
+
+// readOCIBlob reads a blob of a layout, and verifies it against its digest.
+func readOCIBlob(layout, digest string) ([]byte, error) {
+	if !ociDigestRegexp.MatchString(digest) {
+		return nil, fmt.Errorf("unsupported digest %q", digest)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(layout, filepath.FromSlash(ociBlobPath(digest))))
+	if err != nil {
+		return nil, err
+	}
+	if sum := sha256.Sum256(data); "sha256:"+hex.EncodeToString(sum[:]) != digest {
+		return nil, fmt.Errorf("blob %s does not match its digest", digest)
+	}
+	return data, nil
+}
+
+// ociChainIDs returns the chain IDs of the layers of an image, which identify
+// each layer along with its parents. They are computed from the diff IDs of
+// the configuration, or from the digests of the blobs when it doesn't list
+// every layer.
+func ociChainIDs(layers []ociDescriptor, diffIDs []string) []string {
+	if len(diffIDs) != len(layers) {
+		diffIDs = make([]string, len(layers))
+		for i, layer := range layers {
+			diffIDs[i] = layer.Digest
+		}
+	}
+
+	chainIDs := result.ChainIDs(diffIDs)
+	for i, chainID := range chainIDs {
+		chainIDs[i] = strings.TrimPrefix(chainID, "sha256:")
+	}
+	return chainIDs
+}
@@ -0,0 +1,103 @@
+package analyzeimages
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/MXi4oyu/DockerXScan/result"
+)
+
+// The formats in which the report can be written to a file.
+const (
+	// OutputJSON is the JSON form of the result, described by the schema of
+	// the result package.
+	OutputJSON = "json"
+
+	// OutputHTML is the HTML report, made of the same blocks as the one
+	// written for the web interface.
+	OutputHTML = "html"
+)
+
+// outputPath is the file to which the report is written, none in default,
+// and outputFormat its format.
+var (
+	outputPath   string
+	outputFormat string
+)
+
+// SetOutput makes the report of an image also be written to a file, in one of
+// the Output formats. The file and its parent directories are created as
+// needed, and it is only replaced once the report is complete, so that no
+// truncated report is ever read from it. An empty path writes no file.
+func SetOutput(path, format string) error {
+	switch format {
+	case OutputJSON, OutputHTML:
+	default:
+		return fmt.Errorf("unknown output format %q", format)
+	}
+
+	outputPath, outputFormat = path, format
+	return nil
+}
+
+// writeOutput writes the report of an image to the output file, if any: the
+// result itself in JSON, or else the blocks of the HTML report.
+func writeOutput(r result.ImageResult, htmlBlocks string) error {
+	if outputPath == "" {
+		return nil
+	}
+
+	var data []byte
+	switch outputFormat {
+	case OutputHTML:
+		title := html.EscapeString("DockerXScan report for image " + redact(r.Image))
+		data = []byte("<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>" + title + "</title>\n</head>\n<body>\n<h1>" + title + "</h1>\n" + htmlBlocks + "\n</body>\n</html>\n")
+	default:
+		var err error
+		if data, err = json.MarshalIndent(r.Redact(redactions), "", "  "); err != nil {
+			return err
+		}
+	}
+
+	if err := writeFileAtomic(outputPath, data); err != nil {
+		return fmt.Errorf("Could not write the report to %s: %s", outputPath, err)
+	}
+	return nil
+}
+
+// writeFileAtomic writes data to a temporary file next to path, then renames
+// it to path, so that path holds either its previous content or data, even if
+// the process crashes meanwhile.
+func writeFileAtomic(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(dir, "."+filepath.Base(path)+".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(f.Name(), 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), path)
+}
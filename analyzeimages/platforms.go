@@ -0,0 +1,207 @@
+package analyzeimages
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/MXi4oyu/DockerXScan/api/v1"
+	"github.com/MXi4oyu/DockerXScan/database"
+)
+
+// Platform is a platform an image of a manifest list is built for.
+type Platform struct {
+	OS           string `json:"os"`
+	Architecture string `json:"architecture"`
+	Variant      string `json:"variant,omitempty"`
+}
+
+// String returns the platform in the os/architecture[/variant] form used by
+// docker.
+func (p Platform) String() string {
+	s := p.OS + "/" + p.Architecture
+	if p.Variant != "" {
+		s += "/" + p.Variant
+	}
+	return s
+}
+
+type platformManifest struct {
+	Digest   string   `json:"digest"`
+	Platform Platform `json:"platform"`
+}
+
+// AnalyzeAllPlatforms analyzes the image of every platform of a manifest
+// list, printing the report of each as AnalyzeLocalImage does, and returns
+// the errors of their reports indexed by platform, nil for the images without
+// vulnerabilities nor failing the policy.
+//
+// The layers shared by several platforms are only analyzed once. The scan
+// timeout applies to the analysis of all the platforms: those left once it is
+// reached are reported from their layers analyzed until then, or else fail.
+func AnalyzeAllPlatforms(imageName string, minSeverity database.Severity, endpoint, myAddress, tmpPath string, progress ProgressFunc) (map[string]error, error) {
+	ctx, cancel := scanContext()
+	defer cancel()
+
+	manifests, err := listPlatforms(imageName)
+	if err != nil {
+		return nil, fmt.Errorf("Could not list the platforms of %s: %s", imageName, err)
+	}
+	progress.emit(ScanEvent{Kind: EventManifestFetched, Image: imageName, Total: len(manifests)})
+
+	servedPath, err := serveLayers(tmpPath, endpoint, myAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	reports := make(map[string]error, len(manifests))
+	analyzed := make(map[string]struct{})
+	for i, m := range manifests {
+		platform := m.Platform.String()
+		ref := repository(imageName) + "@" + m.Digest
+		dir := strconv.Itoa(i)
+		path := filepath.Join(tmpPath, dir)
+
+		if ctx.Err() != nil {
+			reports[platform] = fmt.Errorf("Could not analyze the image: the scan timed out after %s before any layer was analyzed", scanTimeout)
+			continue
+		}
+
+		log.Printf("Saving %s (%s) to local disk (this may take some time)", imageName, platform)
+		if err := os.MkdirAll(path, 0700); err != nil {
+			return nil, err
+		}
+		if err := pull(ref, platform); err != nil {
+			return nil, fmt.Errorf("Could not pull %s: %s", platform, err)
+		}
+		if err := save(ref, path); err != nil {
+			return nil, fmt.Errorf("Could not save %s: %s", platform, err)
+		}
+		progress.emit(ScanEvent{Kind: EventImageSaved, Image: ref})
+
+		layerIDs, err := historyFromManifest(path)
+		if err != nil {
+			layerIDs, err = historyFromCommand(ref)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Could not get the history of %s: %s", platform, err)
+		}
+		if err := checkLayerCount(len(layerIDs)); err != nil {
+			return nil, fmt.Errorf("Could not analyze %s: %s", platform, err)
+		}
+		progress.layersSaved(ref, layerIDs)
+
+		fmt.Printf("%s:\n", platform)
+		if len(layerIDs) == 0 {
+			reports[platform] = printReport(ref, v1.Layer{}, imageFacts{}, minSeverity, endpoint)
+			printMisconfigurations(imageMisconfigurations(path))
+			continue
+		}
+
+		digests, err := layerDigests(path, layerIDs)
+		if err != nil {
+			return nil, fmt.Errorf("Could not compute the digests of the layers of %s: %s", platform, err)
+		}
+		facts := imageFacts{history: layerHistory(path, layerIDs), baseLayers: imageBaseLayers(path, layerIDs), libc: imageLibc(path, layerIDs)}
+
+		for j, layerID := range layerIDs {
+			if _, done := analyzed[layerID]; done {
+				continue
+			}
+			if ctx.Err() != nil {
+				facts.skipped = skipLayers(progress, ref, layerIDs, j)
+				break
+			}
+
+			var parent string
+			if j > 0 {
+				parent = layerIDs[j-1]
+			}
+
+			log.Printf("Analyzing %s (%s)\n", layerID, platform)
+			progress.emit(ScanEvent{Kind: EventLayerSubmitted, Image: ref, Layer: layerID, Index: j + 1, Total: len(layerIDs)})
+			err := analyzeLayerContext(ctx, servedPath+"/"+dir+"/"+layerID+"/layer.tar", digests[j], layerID, parent)
+			if err != nil && ctx.Err() != nil {
+				facts.skipped = skipLayers(progress, ref, layerIDs, j)
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("Could not analyze layer: %s", err)
+			}
+			progress.emit(ScanEvent{Kind: EventLayerAnalyzed, Image: ref, Layer: layerID, Index: j + 1, Total: len(layerIDs)})
+
+			analyzed[layerID] = struct{}{}
+		}
+
+		top := len(layerIDs) - len(facts.skipped)
+		if top == 0 {
+			reports[platform] = fmt.Errorf("Could not analyze the image: the scan timed out after %s before any layer was analyzed", scanTimeout)
+			continue
+		}
+		reports[platform] = reportLayer(progress, ref, layerIDs[top-1], facts, minSeverity, endpoint)
+		printMisconfigurations(imageMisconfigurations(path))
+		printSecrets(imageSecrets(path, layerIDs))
+	}
+
+	return reports, nil
+}
+
+// listPlatforms returns the image manifests of a manifest list, ignoring the
+// entries that are not images, such as attestations.
+func listPlatforms(imageName string) ([]platformManifest, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command("docker", "manifest", "inspect", imageName)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, errors.New(strings.TrimSpace(stderr.String()))
+	}
+
+	var list struct {
+		Manifests []platformManifest `json:"manifests"`
+	}
+	if err := json.Unmarshal(out, &list); err != nil {
+		return nil, err
+	}
+	if len(list.Manifests) == 0 {
+		return nil, errors.New("not a manifest list")
+	}
+
+	var manifests []platformManifest
+	for _, m := range list.Manifests {
+		if m.Platform.OS == "" || m.Platform.OS == "unknown" {
+			continue
+		}
+		manifests = append(manifests, m)
+	}
+
+	return manifests, nil
+}
+
+// repository returns the name of an image without its tag or digest.
+func repository(imageName string) string {
+	if i := strings.Index(imageName, "@"); i >= 0 {
+		imageName = imageName[:i]
+	}
+	if i := strings.LastIndex(imageName, ":"); i > strings.LastIndex(imageName, "/") {
+		imageName = imageName[:i]
+	}
+	return imageName
+}
+
+func pull(ref, platform string) error {
+	var stderr bytes.Buffer
+	cmd := exec.Command("docker", "pull", "--platform", platform, ref)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return errors.New(strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package analyzeimages
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/MXi4oyu/DockerXScan/api/v1"
+	"github.com/MXi4oyu/DockerXScan/result"
+	"github.com/fatih/color"
+)
+
+const supportedNamespacesURI = "/v1/supported"
+
+// reportPolicy decides whether the images pass, instead of them failing as
+// soon as a vulnerability is shown. None is used in default.
+var reportPolicy *result.Policy
+
+// SetPolicy sets the policy deciding whether the images pass, warn or fail.
+// Once set, an analysis only fails when the verdict of the policy is fail.
+func SetPolicy(p *result.Policy) {
+	reportPolicy = p
+}
+
+// EvaluatePolicy prints the verdict of the policy set by SetPolicy on a
+// result, and returns an error when it is fail. The last updates of the feeds
+// decided by the staleness rules of the policy are asked to the API.
+func EvaluatePolicy(r result.ImageResult, endpoint string) error {
+	var feeds result.FeedUpdates
+	if len(reportPolicy.Staleness) > 0 {
+		var err error
+		if feeds, err = getFeedUpdates(endpoint); err != nil {
+			log.Printf("Could not get the last updates of the feeds, they are considered stale: %s", err)
+		}
+	}
+
+	verdict := reportPolicy.Evaluate(r, feeds, time.Now())
+
+	for _, reason := range verdict.Reasons {
+		fmt.Printf("%s %s\n", color.YellowString("POLICY:"), reason)
+	}
+
+	switch verdict.Action {
+	case result.PolicyFail:
+		fmt.Printf("%s The image fails the policy\n", color.RedString("POLICY:"))
+		return fmt.Errorf("The image fails the policy with %d reasons", len(verdict.Reasons))
+	case result.PolicyWarn:
+		fmt.Printf("%s The image passes the policy with warnings\n", color.YellowString("POLICY:"))
+	default:
+		fmt.Printf("%s The image passes the policy\n", color.GreenString("POLICY:"))
+	}
+
+	return nil
+}
+
+// getFeedUpdates returns the last updates of the feeds of the supported
+// namespaces of the API.
+func getFeedUpdates(endpoint string) (result.FeedUpdates, error) {
+	response, err := http.Get(endpoint + supportedNamespacesURI)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != 200 {
+		body, _ := ioutil.ReadAll(response.Body)
+		return nil, fmt.Errorf("Got response %d with message %s", response.StatusCode, string(body))
+	}
+
+	var apiResponse v1.SupportedNamespaceEnvelope
+	if err = json.NewDecoder(response.Body).Decode(&apiResponse); err != nil {
+		return nil, err
+	} else if apiResponse.Error != nil {
+		return nil, errors.New(apiResponse.Error.Message)
+	} else if apiResponse.SupportedNamespaces == nil {
+		return nil, errors.New("no supported namespaces in the response")
+	}
+
+	feeds := make(result.FeedUpdates)
+	for _, namespace := range *apiResponse.SupportedNamespaces {
+		if !namespace.UpdaterEnabled {
+			continue
+		}
+		var lastUpdate time.Time
+		if namespace.LastUpdate != "" {
+			if lastUpdate, err = time.Parse(time.RFC3339, namespace.LastUpdate); err != nil {
+				return nil, fmt.Errorf("invalid last update of %s: %s", namespace.Name, err)
+			}
+		}
+		feeds[namespace.Name] = lastUpdate
+	}
+
+	return feeds, nil
+}
@@ -0,0 +1,55 @@
+package analyzeimages
+
+// ScanEventKind identifies a step of the analysis of an image.
+type ScanEventKind string
+
+const (
+	// EventImageSaved is emitted once the layers of the image are available
+	// locally.
+	EventImageSaved ScanEventKind = "image saved"
+	// EventManifestFetched is emitted once the list of layers of the image is
+	// known.
+	EventManifestFetched ScanEventKind = "manifest fetched"
+	// EventLayerSaved is emitted for each layer of an image saved locally,
+	// once the list of layers is known.
+	EventLayerSaved ScanEventKind = "layer saved"
+	// EventLayerSubmitted is emitted when a layer is sent to be downloaded
+	// and analyzed by the API.
+	EventLayerSubmitted ScanEventKind = "layer submitted"
+	// EventLayerAnalyzed is emitted once the features of a layer have been
+	// inserted.
+	EventLayerAnalyzed ScanEventKind = "layer analyzed"
+	// EventResolvingVulnerabilities is emitted when the vulnerabilities of the
+	// image are requested.
+	EventResolvingVulnerabilities ScanEventKind = "resolving vulnerabilities"
+)
+
+// ScanEvent describes the progress of the analysis of an image.
+type ScanEvent struct {
+	Kind  ScanEventKind
+	Image string
+
+	// Layer, Index and Total are only set for layer events, Index starting
+	// at 1. Total is also set with EventManifestFetched.
+	Layer string
+	Index int
+	Total int
+}
+
+// ProgressFunc is called with each ScanEvent of an analysis. A nil
+// ProgressFunc disables progress reporting.
+type ProgressFunc func(ScanEvent)
+
+func (progress ProgressFunc) emit(event ScanEvent) {
+	if progress != nil {
+		progress(event)
+	}
+}
+
+// layersSaved emits EventLayerSaved for each of the layers of an image saved
+// locally.
+func (progress ProgressFunc) layersSaved(imageName string, layerIDs []string) {
+	for i, layerID := range layerIDs {
+		progress.emit(ScanEvent{Kind: EventLayerSaved, Image: imageName, Layer: layerID, Index: i + 1, Total: len(layerIDs)})
+	}
+}
@@ -0,0 +1,22 @@
+package analyzeimages
+
+import (
+	"github.com/MXi4oyu/DockerXScan/result"
+)
+
+// redactions are applied to the image references and the file paths of the
+// reports and of the findings shipped to the sink, none in default.
+var redactions result.Redactions
+
+// SetRedactions sets the redactions applied to the image references and the
+// file paths of the reports, the HTML report and the findings shipped to the
+// sink, so that they can be shared without revealing internal registry
+// hostnames. The images are still pulled and saved by their actual names.
+func SetRedactions(rs result.Redactions) {
+	redactions = rs
+}
+
+// redact applies the redactions to an image reference or a file path.
+func redact(s string) string {
+	return redactions.Apply(s)
+}
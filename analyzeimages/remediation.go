@@ -0,0 +1,46 @@
+package analyzeimages
+
+import (
+	"fmt"
+
+	"github.com/MXi4oyu/DockerXScan/api/v1"
+	"github.com/MXi4oyu/DockerXScan/result"
+	"github.com/fatih/color"
+)
+
+// remediation returns the upgrades fixing the vulnerabilities shown in the
+// report of the top layer of an image.
+func remediation(imageName string, layer v1.Layer, shown []vulnerabilityInfo) []result.Upgrade {
+	return shownResult(imageName, layer, shown).Upgrades()
+}
+
+// shownResult returns the result of the top layer of an image holding only
+// the vulnerabilities shown in its report.
+func shownResult(imageName string, layer v1.Layer, shown []vulnerabilityInfo) result.ImageResult {
+	keys := make(map[result.Key]struct{}, len(shown))
+	for _, v := range shown {
+		keys[result.Key{Vulnerability: v.vulnerability.Name, Feature: v.feature.Name}] = struct{}{}
+	}
+
+	r := result.FromLayer(imageName, layer)
+	var kept []result.Vulnerability
+	for _, v := range r.Vulnerabilities {
+		if _, ok := keys[v.Key()]; ok {
+			kept = append(kept, v)
+		}
+	}
+	r.Vulnerabilities = kept
+
+	return r
+}
+
+func printRemediation(upgrades []result.Upgrade) {
+	if len(upgrades) == 0 {
+		return
+	}
+
+	fmt.Printf("%s Upgrading %d packages fixes the vulnerabilities having a fix:\n", color.GreenString("REMEDIATION:"), len(upgrades))
+	for _, u := range upgrades {
+		fmt.Printf("\t%s %s -> %s (%d vulnerabilities)\n", u.FeatureName, u.CurrentVersion, u.FixedVersion, len(u.Vulnerabilities))
+	}
+}
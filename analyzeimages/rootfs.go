@@ -0,0 +1,215 @@
+package analyzeimages
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/MXi4oyu/DockerXScan/database"
+	"github.com/MXi4oyu/DockerXScan/featurefmt"
+	"github.com/MXi4oyu/DockerXScan/featurens"
+	"github.com/MXi4oyu/DockerXScan/tarutil"
+)
+
+// maxSymlinkDepth bounds the resolution of symbolic links inside a rootfs.
+const maxSymlinkDepth = 16
+
+// AnalyzeRootfs analyzes the live filesystem of a running container, given
+// either its ID or the path to its mounted rootfs. The whole rootfs is
+// analyzed as a single layer.
+func AnalyzeRootfs(target string, minSeverity database.Severity, endpoint, myAddress, tmpPath string, progress ProgressFunc) error {
+	rootfs, err := resolveRootfs(target)
+	if err != nil {
+		return fmt.Errorf("Could not find the rootfs of %s: %s", target, err)
+	}
+
+	// Archive the files needed by the detectors as a single layer.
+	log.Printf("Archiving %s (this may take some time)", rootfs)
+	layer, err := archiveRootfs(rootfs, append(featurefmt.RequiredFilenames(), featurens.RequiredFilenames()...))
+	if err != nil {
+		return fmt.Errorf("Could not archive rootfs: %s", err)
+	}
+
+	// Name the layer after its content, so that an unchanged rootfs is not
+	// analyzed twice.
+	sum := sha256.Sum256(layer)
+	layerID := "rootfs-" + hex.EncodeToString(sum[:])
+
+	if err := os.MkdirAll(filepath.Join(tmpPath, layerID), 0700); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(tmpPath, layerID, "layer.tar"), layer, 0600); err != nil {
+		return err
+	}
+	progress.emit(ScanEvent{Kind: EventImageSaved, Image: target})
+	progress.emit(ScanEvent{Kind: EventManifestFetched, Image: target, Total: 1})
+	libc := imageLibc(tmpPath, []string{layerID})
+
+	tmpPath, err = serveLayers(tmpPath, endpoint, myAddress)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Analyzing %s\n", layerID)
+	progress.emit(ScanEvent{Kind: EventLayerSubmitted, Image: target, Layer: layerID, Index: 1, Total: 1})
+	if err := analyzeLayer(tmpPath+"/"+layerID+"/layer.tar", "sha256:"+hex.EncodeToString(sum[:]), layerID, ""); err != nil {
+		return fmt.Errorf("Could not analyze layer: %s", err)
+	}
+	progress.emit(ScanEvent{Kind: EventLayerAnalyzed, Image: target, Layer: layerID, Index: 1, Total: 1})
+
+	log.Println("Retrieving rootfs's vulnerabilities")
+	return reportLayer(progress, target, layerID, imageFacts{libc: libc}, minSeverity, endpoint)
+}
+
+// resolveRootfs returns target if it is a directory, otherwise the merged
+// directory of the container it identifies.
+func resolveRootfs(target string) (string, error) {
+	if info, err := os.Stat(target); err == nil && info.IsDir() {
+		return target, nil
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.Command("docker", "inspect", "--type", "container", "--format", "{{.GraphDriver.Data.MergedDir}}", target)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", errors.New(strings.TrimSpace(stderr.String()))
+	}
+
+	rootfs := strings.TrimSpace(string(out))
+	if rootfs == "" || rootfs == "<no value>" {
+		return "", errors.New("the storage driver of the container does not expose a merged directory")
+	}
+
+	return rootfs, nil
+}
+
+// archiveRootfs builds an uncompressed tarball of the files of rootfs whose
+// path starts with one of the given prefixes. Symbolic links are resolved
+// inside rootfs and archived as regular files.
+func archiveRootfs(rootfs string, prefixes []string) ([]byte, error) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+
+	added := make(map[string]struct{})
+	for _, prefix := range prefixes {
+		// The nested roots are only discovered in the layers of images, as
+		// it would take walking the whole filesystem.
+		if strings.HasPrefix(prefix, tarutil.NestedPrefix) {
+			continue
+		}
+
+		// A prefix is either a file, or a directory whose whole content is
+		// needed.
+		root := filepath.Join(rootfs, filepath.FromSlash(prefix))
+		err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) {
+					return nil
+				}
+				return err
+			}
+			if info.IsDir() {
+				return nil
+			}
+
+			name, err := filepath.Rel(rootfs, path)
+			if err != nil {
+				return err
+			}
+			name = filepath.ToSlash(name)
+			if _, ok := added[name]; ok {
+				return nil
+			}
+
+			content, err := readRootfsFile(rootfs, name)
+			if err != nil {
+				// A dangling link or an unreadable file is skipped rather than
+				// failing the whole analysis.
+				log.Printf("Skipping %s: %s", name, err)
+				return nil
+			}
+
+			hdr := &tar.Header{
+				Name:     name,
+				Mode:     0644,
+				Size:     int64(len(content)),
+				ModTime:  info.ModTime(),
+				Typeflag: tar.TypeReg,
+			}
+			if err := tw.WriteHeader(hdr); err != nil {
+				return err
+			}
+			if _, err := tw.Write(content); err != nil {
+				return err
+			}
+			added[name] = struct{}{}
+
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// readRootfsFile reads the file at the slash-separated path name relative to
+// rootfs, resolving symbolic links as if rootfs were the root directory.
+func readRootfsFile(rootfs, name string) ([]byte, error) {
+	for i := 0; i < maxSymlinkDepth; i++ {
+		path := filepath.Join(rootfs, filepath.FromSlash(name))
+
+		info, err := os.Lstat(path)
+		if err != nil {
+			return nil, err
+		}
+
+		if info.Mode()&os.ModeSymlink == 0 {
+			if !info.Mode().IsRegular() {
+				return nil, errors.New("not a regular file")
+			}
+			if info.Size() > tarutil.MaxExtractableFileSize {
+				return nil, tarutil.ErrExtractedFileTooBig
+			}
+
+			f, err := os.Open(path)
+			if err != nil {
+				return nil, err
+			}
+			defer f.Close()
+
+			return ioutil.ReadAll(f)
+		}
+
+		target, err := os.Readlink(path)
+		if err != nil {
+			return nil, err
+		}
+		target = filepath.ToSlash(target)
+
+		// Absolute links are relative to rootfs, relative links to the link's
+		// directory. Cleaning an absolute path never escapes the root.
+		if !strings.HasPrefix(target, "/") {
+			target = filepath.ToSlash(filepath.Dir(filepath.FromSlash(name))) + "/" + target
+			target = "/" + target
+		}
+		name = strings.TrimPrefix(filepath.ToSlash(filepath.Clean(filepath.FromSlash(target))), "/")
+	}
+
+	return nil, errors.New("too many levels of symbolic links")
+}
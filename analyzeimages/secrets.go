@@ -0,0 +1,67 @@
+package analyzeimages
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/MXi4oyu/DockerXScan/result"
+	"github.com/MXi4oyu/DockerXScan/secretscan"
+	"github.com/MXi4oyu/DockerXScan/tarutil"
+	"github.com/fatih/color"
+)
+
+// scanSecrets controls whether the files of the layers are scanned for
+// credentials, disabled in default.
+var scanSecrets = false
+
+// SetScanSecrets sets whether the files of the layers of the images are
+// scanned for credentials, such as AWS keys and private keys, which are
+// reported apart from the vulnerabilities.
+func SetScanSecrets(scan bool) {
+	scanSecrets = scan
+}
+
+// imageSecrets returns the secrets found in the layers of an image saved in
+// path, if they are to be scanned. Failures are logged and only make the
+// secrets of the layer be skipped, as they do not prevent the analysis.
+func imageSecrets(path string, layerIDs []string) []result.Secret {
+	if !scanSecrets {
+		return nil
+	}
+
+	log.Printf("Scanning %d layers for secrets", len(layerIDs))
+	var secrets []result.Secret
+	for _, layerID := range layerIDs {
+		f, err := os.Open(filepath.Join(path, layerID, "layer.tar"))
+		if err != nil {
+			log.Printf("Could not open layer %s, skipping its secrets: %s", layerID, err)
+			continue
+		}
+
+		found, err := secretscan.ScanLayer(f, layerID)
+		f.Close()
+		if err == tarutil.ErrTruncatedArchive {
+			log.Printf("Warning: layer %s is truncated, reporting the secrets of the files read before its end", layerID)
+		} else if err != nil {
+			log.Printf("Could not scan layer %s for secrets: %s", layerID, err)
+		}
+		secrets = append(secrets, found...)
+	}
+
+	return secrets
+}
+
+func printSecrets(secrets []result.Secret) {
+	if len(secrets) == 0 {
+		return
+	}
+
+	fmt.Printf("%d secrets have been detected in the layers of your image\n", len(secrets))
+	for _, s := range secrets {
+		fmt.Printf("%s %s in /%s:%d (%s)\n", color.RedString("SECRET:"), s.Title, redact(s.Path), s.Line, coloredSeverity(s.Severity))
+		fmt.Printf("\t%s\n", s.Match)
+		fmt.Printf("\tLayer: %s\n", s.Layer)
+	}
+}
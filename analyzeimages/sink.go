@@ -0,0 +1,35 @@
+package analyzeimages
+
+import (
+	"log"
+
+	"github.com/MXi4oyu/DockerXScan/registry"
+	"github.com/MXi4oyu/DockerXScan/result"
+	"github.com/MXi4oyu/DockerXScan/sink"
+)
+
+// findingsSink is where the findings of the analyses are shipped, none in
+// default.
+var findingsSink sink.Sink
+
+// SetSink sets where the findings of the analyses are shipped, as a record
+// per vulnerability that is not suppressed, whichever the minimum severity of
+// the report.
+func SetSink(s sink.Sink) {
+	findingsSink = s
+}
+
+// sendFindings ships the findings of an image to the sink, redacted once the
+// digest of the image has been found. Failures are logged, as the report is
+// still printed.
+func sendFindings(r result.ImageResult) {
+	if findingsSink == nil {
+		return
+	}
+
+	host, repository := registry.SplitReference(r.Image)
+	digest := imageDigest(r.Image, host, repository)
+	if err := findingsSink.Write(sink.Records(r.Redact(redactions), digest)); err != nil {
+		log.Printf("Could not send the findings of %s: %s", redact(r.Image), err)
+	}
+}
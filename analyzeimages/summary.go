@@ -0,0 +1,31 @@
+package analyzeimages
+
+import (
+	"fmt"
+
+	"github.com/MXi4oyu/DockerXScan/result"
+	"github.com/fatih/color"
+)
+
+// summarySize is the number of packages ranked by the summary printed after
+// the report, zero disabling it, which is the default.
+var summarySize = 0
+
+// SetSummarySize sets the number of the most affected packages printed as a
+// table after the report, so that the upgrades to make first stand out. Zero
+// disables the summary.
+func SetSummarySize(n int) {
+	summarySize = n
+}
+
+func printSummary(summary result.Summary) {
+	if summarySize <= 0 || len(summary.TopPackages) == 0 {
+		return
+	}
+
+	fmt.Printf("%s %d vulnerabilities shown, %d of them fixable. The most affected packages are:\n", color.GreenString("SUMMARY:"), summary.Vulnerabilities, summary.Fixable)
+	fmt.Printf("\t%-32s %-24s %-10s %6s %8s  %s\n", "PACKAGE", "VERSION", "SEVERITY", "VULNS", "FIXABLE", "FIXED IN")
+	for _, p := range summary.TopPackages {
+		fmt.Printf("\t%-32s %-24s %-10s %6d %8d  %s\n", p.FeatureName, p.FeatureVersion, p.MaxSeverity, p.Vulnerabilities, p.Fixable, p.FixedVersion)
+	}
+}
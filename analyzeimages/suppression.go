@@ -0,0 +1,62 @@
+package analyzeimages
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/MXi4oyu/DockerXScan/api/v1"
+	"github.com/MXi4oyu/DockerXScan/result"
+)
+
+const suppressionsURI = "/v1/suppressions"
+
+// fetchSuppressions returns the suppressions of the API that are active now.
+// Failures are logged and make no risk be accepted, every vulnerability being
+// reported then.
+func fetchSuppressions(endpoint string) result.Suppressions {
+	suppressions, err := getSuppressions(endpoint)
+	if err != nil {
+		log.Printf("Could not get the suppressions, no risk is accepted: %s", err)
+		return nil
+	}
+	return result.NewSuppressions(suppressions, time.Now())
+}
+
+func getSuppressions(endpoint string) ([]v1.Suppression, error) {
+	response, err := http.Get(endpoint + suppressionsURI)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != 200 {
+		body, _ := ioutil.ReadAll(response.Body)
+		return nil, fmt.Errorf("Got response %d with message %s", response.StatusCode, string(body))
+	}
+
+	var apiResponse v1.SuppressionEnvelope
+	if err = json.NewDecoder(response.Body).Decode(&apiResponse); err != nil {
+		return nil, err
+	} else if apiResponse.Error != nil {
+		return nil, errors.New(apiResponse.Error.Message)
+	} else if apiResponse.Suppressions == nil {
+		return nil, errors.New("no suppressions in the response")
+	}
+
+	return *apiResponse.Suppressions, nil
+}
+
+// describeAcceptedRisk returns the line of the report documenting why and by
+// whom the risk of a vulnerability has been accepted.
+func describeAcceptedRisk(vulnerability, feature string, s v1.Suppression) string {
+	description := fmt.Sprintf("%s in %s is accepted by %s: %s", vulnerability, feature, s.Author, s.Justification)
+	if s.Expires != "" {
+		description += fmt.Sprintf(" (until %s)", s.Expires)
+	}
+	return description
+}
@@ -0,0 +1,58 @@
+package analyzeimages
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+// EventLayerSkipped is emitted for each layer left unanalyzed once the scan
+// timeout is reached.
+const EventLayerSkipped ScanEventKind = "layer skipped"
+
+// scanTimeout is how long the analysis of an image may take before the
+// layers left are skipped, without limit in default.
+var scanTimeout time.Duration
+
+// SetScanTimeout sets how long the analysis of an image may take. Once it is
+// reached, the layer being analyzed is abandoned and the report is that of
+// the layers analyzed so far, marked as partial with the layers skipped. A
+// timeout of zero means no limit.
+func SetScanTimeout(timeout time.Duration) {
+	scanTimeout = timeout
+}
+
+// scanContext returns the context of the analysis of an image, which is done
+// once the scan timeout is reached.
+func scanContext() (context.Context, context.CancelFunc) {
+	if scanTimeout <= 0 {
+		return context.WithCancel(context.Background())
+	}
+	return context.WithTimeout(context.Background(), scanTimeout)
+}
+
+// skipLayers emits EventLayerSkipped for the layers left unanalyzed, the
+// first of which is at index start of the layers of the image, and returns
+// them.
+func skipLayers(progress ProgressFunc, imageName string, layerIDs []string, start int) []string {
+	skipped := layerIDs[start:]
+	for i, layerID := range skipped {
+		progress.emit(ScanEvent{Kind: EventLayerSkipped, Image: imageName, Layer: layerID, Index: start + i + 1, Total: len(layerIDs)})
+	}
+	return skipped
+}
+
+// printSkippedLayers warns that the report is partial, as the layers given
+// were not analyzed before the scan timeout.
+func printSkippedLayers(skipped []string) {
+	if len(skipped) == 0 {
+		return
+	}
+
+	fmt.Printf("%s The scan timed out after %s, this report is partial: %d layers were not analyzed\n", color.YellowString("WARNING:"), scanTimeout, len(skipped))
+	for _, layerID := range skipped {
+		fmt.Printf("Skipped layer: %s\n", layerID)
+	}
+}
@@ -0,0 +1,104 @@
+package analyzeimages
+
+import (
+	"bytes"
+	"log"
+	"os/exec"
+	"strings"
+
+	"github.com/MXi4oyu/DockerXScan/registry"
+	"github.com/MXi4oyu/DockerXScan/result"
+)
+
+// vexArtifactType is the artifact type of the OpenVEX documents attached to
+// images.
+const vexArtifactType = "application/vnd.openvex+json"
+
+// useVEX controls whether the VEX documents attached to images are fetched
+// to suppress the vulnerabilities they declare not affected, disabled in
+// default.
+var useVEX = false
+
+// SetUseVEX sets whether the VEX documents attached to images, through the
+// OCI referrers API of their registry, suppress the vulnerabilities they
+// declare not affected.
+func SetUseVEX(use bool) {
+	useVEX = use
+}
+
+// fetchVEX returns the VEX documents attached to an image, given by name or
+// by digest, in the order the registry lists them. Failures are logged and
+// only make fewer documents be returned, as VEX is advisory.
+func fetchVEX(imageName string) result.VEXDocuments {
+	host, repository := registry.SplitReference(imageName)
+
+	digest := imageDigest(imageName, host, repository)
+	if digest == "" {
+		log.Printf("Could not find the digest of %s, skipping VEX", imageName)
+		return nil
+	}
+
+	client := registry.NewClient(host, repository)
+	referrers, err := client.Referrers(digest, vexArtifactType)
+	if err != nil {
+		log.Printf("Could not list the VEX documents of %s: %s", imageName, err)
+		return nil
+	}
+
+	var docs result.VEXDocuments
+	for _, referrer := range referrers {
+		manifest, err := client.Manifest(referrer.Digest)
+		if err != nil {
+			log.Printf("Could not fetch VEX document %s: %s", referrer.Digest, err)
+			continue
+		}
+
+		for _, layer := range manifest.Layers {
+			blob, err := client.Blob(layer.Digest)
+			if err != nil {
+				log.Printf("Could not fetch VEX document %s: %s", layer.Digest, err)
+				continue
+			}
+
+			doc, err := result.ParseVEX(blob)
+			if err != nil {
+				log.Printf("Skipping VEX document %s: %s", layer.Digest, err)
+				continue
+			}
+			if doc.ID == "" {
+				doc.ID = referrer.Digest
+			}
+			docs = append(docs, doc)
+		}
+	}
+
+	return docs
+}
+
+// imageDigest returns the manifest digest of an image, found in its name or
+// in the repository digests of the local image.
+func imageDigest(imageName, host, repository string) string {
+	if i := strings.Index(imageName, "@"); i >= 0 {
+		return imageName[i+1:]
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.Command("docker", "inspect", "--type", "image", "--format", "{{range .RepoDigests}}{{println .}}{{end}}", imageName)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return ""
+	}
+
+	for _, repoDigest := range strings.Fields(string(out)) {
+		i := strings.Index(repoDigest, "@")
+		if i < 0 {
+			continue
+		}
+		if h, r := registry.SplitReference(repoDigest[:i]); h == host && r == repository {
+			return repoDigest[i+1:]
+		}
+	}
+
+	return ""
+}
@@ -26,6 +26,10 @@ type Config struct {
 	Timeout                   time.Duration
 	PaginationKey             string
 	CertFile, KeyFile, CAFile string
+
+	// ReadinessFeeds are the URLs of the feed endpoints (e.g. mirrors) that
+	// the readiness endpoint of the health API sends a HEAD request to.
+	ReadinessFeeds []string
 }
 
 var(
@@ -87,7 +91,7 @@ func RunHealth(cfg *Config, store database.Datastore, st *stopper.Stopper) {
 		NoSignalHandling: true,             // We want to use our own Stopper
 		Server: &http.Server{
 			Addr:    ":" + strconv.Itoa(cfg.HealthPort),
-			Handler: http.TimeoutHandler(newHealthHandler(store), cfg.Timeout, timeoutResponse),
+			Handler: http.TimeoutHandler(newHealthHandler(cfg, store), cfg.Timeout, timeoutResponse),
 		},
 	}
 
@@ -0,0 +1,151 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/MXi4oyu/DockerXScan/database"
+	"github.com/MXi4oyu/DockerXScan/updater"
+)
+
+// readinessFeedTimeout bounds the HEAD request sent to each feed endpoint.
+const readinessFeedTimeout = 5 * time.Second
+
+var (
+	readinessChecksM sync.RWMutex
+	readinessChecks  = make(map[string]ReadinessCheck)
+
+	readinessClient = &http.Client{Timeout: readinessFeedTimeout}
+)
+
+// ReadinessCheck reports whether a dependency (e.g. a read replica) is ready,
+// returning nil if it is.
+type ReadinessCheck func() error
+
+// ComponentStatus is the status of a dependency in a readiness response.
+type ComponentStatus struct {
+	Ready bool   `json:"ready"`
+	Error string `json:"error,omitempty"`
+}
+
+// ReadinessResponse is the body of a response of the readiness endpoint.
+type ReadinessResponse struct {
+	Ready      bool                       `json:"ready"`
+	Components map[string]ComponentStatus `json:"components"`
+
+	// Updaters is the number of updaters fetching their feeds at the moment.
+	Updaters UpdaterConcurrency `json:"updaters"`
+}
+
+// UpdaterConcurrency is the number of updaters fetching their feeds and
+// waiting to, and the maximum number allowed at once, zero meaning no limit.
+type UpdaterConcurrency struct {
+	Running int `json:"running"`
+	Queued  int `json:"queued"`
+	Limit   int `json:"limit"`
+}
+
+// RegisterReadinessCheck adds a dependency to the ones checked by the
+// readiness endpoint, besides the datastore and the feed endpoints.
+//
+// If called twice with the same name, the name is blank, or if the provided
+// ReadinessCheck is nil, this function panics.
+func RegisterReadinessCheck(name string, check ReadinessCheck) {
+	if name == "" {
+		panic("api: could not register a ReadinessCheck with an empty name")
+	}
+
+	if check == nil {
+		panic("api: could not register a nil ReadinessCheck")
+	}
+
+	readinessChecksM.Lock()
+	defer readinessChecksM.Unlock()
+
+	if _, dup := readinessChecks[name]; dup {
+		panic("api: RegisterReadinessCheck called twice for " + name)
+	}
+
+	readinessChecks[name] = check
+}
+
+// readinessHandler runs every check concurrently and responds with the status
+// of each component, and 503 if any is not ready.
+func readinessHandler(store database.Datastore, feeds []string) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		checks := map[string]ReadinessCheck{
+			"database": func() error {
+				if !store.Ping() {
+					return errors.New("could not ping the datastore")
+				}
+				return nil
+			},
+		}
+		for _, feed := range feeds {
+			checks["feed "+feed] = feedReadinessCheck(feed)
+		}
+		readinessChecksM.RLock()
+		for name, check := range readinessChecks {
+			checks[name] = check
+		}
+		readinessChecksM.RUnlock()
+
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		resp := ReadinessResponse{Ready: true, Components: make(map[string]ComponentStatus, len(checks))}
+		for name, check := range checks {
+			wg.Add(1)
+			go func(name string, check ReadinessCheck) {
+				defer wg.Done()
+
+				status := ComponentStatus{Ready: true}
+				if err := check(); err != nil {
+					status = ComponentStatus{Error: err.Error()}
+				}
+
+				mu.Lock()
+				resp.Components[name] = status
+				resp.Ready = resp.Ready && status.Ready
+				mu.Unlock()
+			}(name, check)
+		}
+		wg.Wait()
+
+		concurrency := updater.CurrentConcurrency()
+		resp.Updaters = UpdaterConcurrency{Running: concurrency.Running, Queued: concurrency.Queued, Limit: concurrency.Limit}
+
+		header := w.Header()
+		header.Set("Server", "clair")
+		header.Set("Content-Type", "application/json;charset=utf-8")
+
+		status := http.StatusOK
+		if !resp.Ready {
+			status = http.StatusServiceUnavailable
+		}
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// feedReadinessCheck returns a ReadinessCheck that sends a HEAD request to a
+// feed endpoint, which is ready if it doesn't answer with a server error.
+func feedReadinessCheck(url string) ReadinessCheck {
+	return func() error {
+		resp, err := readinessClient.Head(url)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode >= http.StatusInternalServerError {
+			return fmt.Errorf("got response %d", resp.StatusCode)
+		}
+		return nil
+	}
+}
@@ -43,9 +43,10 @@ func (rtr router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	http.NotFound(w, r)
 }
 
-func newHealthHandler(store database.Datastore) http.Handler {
+func newHealthHandler(cfg *Config, store database.Datastore) http.Handler {
 	router := httprouter.New()
 	router.GET("/health", healthHandler(store))
+	router.GET("/readiness", readinessHandler(store, cfg.ReadinessFeeds))
 	return router
 }
 
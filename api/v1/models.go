@@ -20,16 +20,23 @@ type Layer struct {
 	Name             string            `json:"Name,omitempty"`
 	NamespaceName    string            `json:"NamespaceName,omitempty"`
 	Path             string            `json:"Path,omitempty"`
+	Digest           string            `json:"Digest,omitempty"`
 	Headers          map[string]string `json:"Headers,omitempty"`
 	ParentName       string            `json:"ParentName,omitempty"`
 	Format           string            `json:"Format,omitempty"`
+	MediaType        string            `json:"MediaType,omitempty"`
 	IndexedByVersion int               `json:"IndexedByVersion,omitempty"`
 	Features         []Feature         `json:"Features,omitempty"`
+
+	// UnfixedVulnerabilities is the number of vulnerabilities left out of
+	// Features because no fixed version is available.
+	UnfixedVulnerabilities int `json:"UnfixedVulnerabilities,omitempty"`
 }
 
 func LayerFromDatabaseModel(dbLayer database.Layer, withFeatures, withVulnerabilities bool) Layer {
 	layer := Layer{
 		Name:             dbLayer.Name,
+		Digest:           dbLayer.Digest,
 		IndexedByVersion: dbLayer.EngineVersion,
 	}
 
@@ -48,7 +55,10 @@ func LayerFromDatabaseModel(dbLayer database.Layer, withFeatures, withVulnerabil
 				NamespaceName: dbFeatureVersion.Feature.Namespace.Name,
 				VersionFormat: dbFeatureVersion.Feature.Namespace.VersionFormat,
 				Version:       dbFeatureVersion.Version,
+				SourceName:    dbFeatureVersion.SourceName,
 				AddedBy:       dbFeatureVersion.AddedBy.Name,
+				Root:          dbFeatureVersion.Root,
+				Location:      dbFeatureVersion.Location,
 			}
 
 			for _, dbVuln := range dbFeatureVersion.AffectedBy {
@@ -59,11 +69,16 @@ func LayerFromDatabaseModel(dbLayer database.Layer, withFeatures, withVulnerabil
 					Link:          dbVuln.Link,
 					Severity:      string(dbVuln.Severity),
 					Metadata:      dbVuln.Metadata,
+					Withdrawn:     dbVuln.Withdrawn,
+					Confidence:    string(dbVuln.Confidence),
 				}
 
 				if dbVuln.FixedBy != versionfmt.MaxVersion {
 					vuln.FixedBy = dbVuln.FixedBy
 				}
+				if !dbVuln.PublishedDate.IsZero() {
+					vuln.PublishedDate = dbVuln.PublishedDate.UTC().Format(time.RFC3339)
+				}
 				feature.Vulnerabilities = append(feature.Vulnerabilities, vuln)
 			}
 			layer.Features = append(layer.Features, feature)
@@ -73,20 +88,71 @@ func LayerFromDatabaseModel(dbLayer database.Layer, withFeatures, withVulnerabil
 	return layer
 }
 
+// RemoveUnfixedVulnerabilities removes from the features of the layer the
+// vulnerabilities that have no fixed version, and counts them in
+// UnfixedVulnerabilities.
+func (l *Layer) RemoveUnfixedVulnerabilities() {
+	for i := range l.Features {
+		var fixed []Vulnerability
+		for _, vuln := range l.Features[i].Vulnerabilities {
+			if vuln.FixedBy == "" {
+				l.UnfixedVulnerabilities++
+				continue
+			}
+			fixed = append(fixed, vuln)
+		}
+		l.Features[i].Vulnerabilities = fixed
+	}
+}
+
 type Namespace struct {
 	Name          string `json:"Name,omitempty"`
 	VersionFormat string `json:"VersionFormat,omitempty"`
+	Disabled      bool   `json:"Disabled,omitempty"`
+	DataVersion   int    `json:"DataVersion,omitempty"`
+	Kind          string `json:"Kind,omitempty"`
+}
+
+// SupportedNamespace tells whether the layers of an OS flavor can be scanned
+// by the server: whether their namespace is detected, their packages listed
+// and their vulnerabilities fetched.
+type SupportedNamespace struct {
+	Name            string   `json:"Name"`
+	Supported       bool     `json:"Supported"`
+	Detectors       []string `json:"Detectors,omitempty"`
+	DetectorEnabled bool     `json:"DetectorEnabled"`
+	Lister          string   `json:"Lister,omitempty"`
+	ListerEnabled   bool     `json:"ListerEnabled"`
+	Updater         string   `json:"Updater,omitempty"`
+	UpdaterEnabled  bool     `json:"UpdaterEnabled"`
+	LastUpdate      string   `json:"LastUpdate,omitempty"`
 }
 
 type Vulnerability struct {
-	Name          string                 `json:"Name,omitempty"`
-	NamespaceName string                 `json:"NamespaceName,omitempty"`
-	Description   string                 `json:"Description,omitempty"`
-	Link          string                 `json:"Link,omitempty"`
-	Severity      string                 `json:"Severity,omitempty"`
-	Metadata      map[string]interface{} `json:"Metadata,omitempty"`
-	FixedBy       string                 `json:"FixedBy,omitempty"`
-	FixedIn       []Feature              `json:"FixedIn,omitempty"`
+	Name           string                 `json:"Name,omitempty"`
+	NamespaceName  string                 `json:"NamespaceName,omitempty"`
+	Description    string                 `json:"Description,omitempty"`
+	Link           string                 `json:"Link,omitempty"`
+	Severity       string                 `json:"Severity,omitempty"`
+	Metadata       map[string]interface{} `json:"Metadata,omitempty"`
+	Withdrawn      bool                   `json:"Withdrawn,omitempty"`
+	FixedBy        string                 `json:"FixedBy,omitempty"`
+	FixedIn        []Feature              `json:"FixedIn,omitempty"`
+	Affected       []AffectedFeature      `json:"Affected,omitempty"`
+	UpdatedAt      string                 `json:"UpdatedAt,omitempty"`
+	PublishedDate  string                 `json:"PublishedDate,omitempty"`
+	DiscoveredDate string                 `json:"DiscoveredDate,omitempty"`
+	DeletedAt      string                 `json:"DeletedAt,omitempty"`
+
+	// KnownExploited and EPSSScore tell how likely the vulnerability is to be
+	// exploited, as found in its metadata.
+	KnownExploited bool    `json:"KnownExploited,omitempty"`
+	EPSSScore      float64 `json:"EPSSScore,omitempty"`
+
+	// Confidence is "Low" when the affected versions of the vulnerability are
+	// only approximated, in which case its matches are to be reviewed, and
+	// "High" otherwise.
+	Confidence string `json:"Confidence,omitempty"`
 }
 
 func (v Vulnerability) DatabaseModel() (database.Vulnerability, error) {
@@ -95,6 +161,14 @@ func (v Vulnerability) DatabaseModel() (database.Vulnerability, error) {
 		return database.Vulnerability{}, err
 	}
 
+	var confidence database.Confidence
+	if v.Confidence != "" {
+		confidence, err = database.NewConfidence(v.Confidence)
+		if err != nil {
+			return database.Vulnerability{}, err
+		}
+	}
+
 	var dbFeatures []database.FeatureVersion
 	for _, feature := range v.FixedIn {
 		dbFeature, err := feature.DatabaseModel()
@@ -105,17 +179,82 @@ func (v Vulnerability) DatabaseModel() (database.Vulnerability, error) {
 		dbFeatures = append(dbFeatures, dbFeature)
 	}
 
+	// The DiscoveredDate is decided by the database.
+	var publishedDate time.Time
+	if v.PublishedDate != "" {
+		publishedDate, err = time.Parse(time.RFC3339, v.PublishedDate)
+		if err != nil {
+			return database.Vulnerability{}, err
+		}
+	}
+
 	return database.Vulnerability{
-		Name:        v.Name,
-		Namespace:   database.Namespace{Name: v.NamespaceName},
-		Description: v.Description,
-		Link:        v.Link,
-		Severity:    severity,
-		Metadata:    v.Metadata,
-		FixedIn:     dbFeatures,
+		Name:          v.Name,
+		Namespace:     database.Namespace{Name: v.NamespaceName},
+		Description:   v.Description,
+		Link:          v.Link,
+		Severity:      severity,
+		Metadata:      v.Metadata,
+		Withdrawn:     v.Withdrawn,
+		Confidence:    confidence,
+		PublishedDate: publishedDate,
+		FixedIn:       dbFeatures,
+	}, nil
+}
+
+// Suppression accepts the risk of a vulnerability affecting a feature of a
+// namespace. Created and Expires are formatted as RFC 3339, Expires being
+// empty for a suppression that never expires.
+type Suppression struct {
+	NamespaceName     string `json:"NamespaceName"`
+	FeatureName       string `json:"FeatureName"`
+	VulnerabilityName string `json:"VulnerabilityName"`
+	Justification     string `json:"Justification"`
+	Author            string `json:"Author"`
+	Created           string `json:"Created,omitempty"`
+	Expires           string `json:"Expires,omitempty"`
+	Expired           bool   `json:"Expired,omitempty"`
+}
+
+func (s Suppression) DatabaseModel() (database.Suppression, error) {
+	var expires time.Time
+	if s.Expires != "" {
+		var err error
+		if expires, err = time.Parse(time.RFC3339, s.Expires); err != nil {
+			return database.Suppression{}, err
+		}
+	}
+
+	// The Created time is decided by the database.
+	return database.Suppression{
+		NamespaceName:     s.NamespaceName,
+		FeatureName:       s.FeatureName,
+		VulnerabilityName: s.VulnerabilityName,
+		Justification:     s.Justification,
+		Author:            s.Author,
+		Expires:           expires,
 	}, nil
 }
 
+func SuppressionFromDatabaseModel(dbSuppression database.Suppression, now time.Time) Suppression {
+	suppression := Suppression{
+		NamespaceName:     dbSuppression.NamespaceName,
+		FeatureName:       dbSuppression.FeatureName,
+		VulnerabilityName: dbSuppression.VulnerabilityName,
+		Justification:     dbSuppression.Justification,
+		Author:            dbSuppression.Author,
+		Expired:           !dbSuppression.Active(now),
+	}
+	if !dbSuppression.Created.IsZero() {
+		suppression.Created = dbSuppression.Created.UTC().Format(time.RFC3339)
+	}
+	if !dbSuppression.Expires.IsZero() {
+		suppression.Expires = dbSuppression.Expires.UTC().Format(time.RFC3339)
+	}
+
+	return suppression
+}
+
 func VulnerabilityFromDatabaseModel(dbVuln database.Vulnerability, withFixedIn bool) Vulnerability {
 	vuln := Vulnerability{
 		Name:          dbVuln.Name,
@@ -124,6 +263,24 @@ func VulnerabilityFromDatabaseModel(dbVuln database.Vulnerability, withFixedIn b
 		Link:          dbVuln.Link,
 		Severity:      string(dbVuln.Severity),
 		Metadata:      dbVuln.Metadata,
+		Withdrawn:     dbVuln.Withdrawn,
+		Confidence:    string(dbVuln.Confidence),
+	}
+
+	exploitation := dbVuln.Exploitation()
+	vuln.KnownExploited, vuln.EPSSScore = exploitation.KnownExploited, exploitation.EPSSScore
+
+	if !dbVuln.UpdatedAt.IsZero() {
+		vuln.UpdatedAt = dbVuln.UpdatedAt.UTC().Format(time.RFC3339)
+	}
+	if !dbVuln.PublishedDate.IsZero() {
+		vuln.PublishedDate = dbVuln.PublishedDate.UTC().Format(time.RFC3339)
+	}
+	if !dbVuln.DiscoveredDate.IsZero() {
+		vuln.DiscoveredDate = dbVuln.DiscoveredDate.UTC().Format(time.RFC3339)
+	}
+	if !dbVuln.DeletedAt.IsZero() {
+		vuln.DeletedAt = dbVuln.DeletedAt.UTC().Format(time.RFC3339)
 	}
 
 	if withFixedIn {
@@ -132,16 +289,35 @@ func VulnerabilityFromDatabaseModel(dbVuln database.Vulnerability, withFixedIn b
 		}
 	}
 
+	for _, dbAffected := range dbVuln.Affected {
+		affected := AffectedFeature{Feature: FeatureFromDatabaseModel(dbAffected.FeatureVersion)}
+		if dbAffected.FixedBy != versionfmt.MaxVersion {
+			affected.FixedBy = dbAffected.FixedBy
+		}
+		vuln.Affected = append(vuln.Affected, affected)
+	}
+
 	return vuln
 }
 
+// AffectedFeature is a stored feature version affected by a vulnerability,
+// along with the version fixing it, if any.
+type AffectedFeature struct {
+	Feature
+	FixedBy string `json:"FixedBy,omitempty"`
+}
+
 type Feature struct {
 	Name            string          `json:"Name,omitempty"`
 	NamespaceName   string          `json:"NamespaceName,omitempty"`
 	VersionFormat   string          `json:"VersionFormat,omitempty"`
 	Version         string          `json:"Version,omitempty"`
+	SourceName      string          `json:"SourceName,omitempty"`
+	Kind            string          `json:"Kind,omitempty"`
 	Vulnerabilities []Vulnerability `json:"Vulnerabilities,omitempty"`
 	AddedBy         string          `json:"AddedBy,omitempty"`
+	Root            string          `json:"Root,omitempty"`
+	Location        string          `json:"Location,omitempty"`
 }
 
 func FeatureFromDatabaseModel(dbFeatureVersion database.FeatureVersion) Feature {
@@ -155,7 +331,11 @@ func FeatureFromDatabaseModel(dbFeatureVersion database.FeatureVersion) Feature
 		NamespaceName: dbFeatureVersion.Feature.Namespace.Name,
 		VersionFormat: dbFeatureVersion.Feature.Namespace.VersionFormat,
 		Version:       version,
+		SourceName:    dbFeatureVersion.SourceName,
+		Kind:          string(dbFeatureVersion.Feature.Kind),
 		AddedBy:       dbFeatureVersion.AddedBy.Name,
+		Root:          dbFeatureVersion.Root,
+		Location:      dbFeatureVersion.Location,
 	}
 }
 
@@ -178,8 +358,11 @@ func (f Feature) DatabaseModel() (fv database.FeatureVersion, err error) {
 				Name:          f.NamespaceName,
 				VersionFormat: f.VersionFormat,
 			},
+			Kind: database.FeatureKind(f.Kind),
 		},
-		Version: version,
+		Version:  version,
+		Root:     f.Root,
+		Location: f.Location,
 	}
 
 	return
@@ -279,15 +462,31 @@ func VulnerabilityWithLayersFromDatabaseModel(dbVuln database.Vulnerability) Vul
 }
 
 type LayerEnvelope struct {
-	Layer *Layer `json:"Layer,omitempty"`
-	Error *Error `json:"Error,omitempty"`
+	Layer  *Layer   `json:"Layer,omitempty"`
+	Layers *[]Layer `json:"Layers,omitempty"`
+	Error  *Error   `json:"Error,omitempty"`
+}
+
+// LayerDiffEnvelope holds the features that a layer adds and removes relative
+// to the layer named ParentName.
+type LayerDiffEnvelope struct {
+	ParentName string     `json:"ParentName,omitempty"`
+	Added      *[]Feature `json:"Added,omitempty"`
+	Removed    *[]Feature `json:"Removed,omitempty"`
+	Error      *Error     `json:"Error,omitempty"`
 }
 
 type NamespaceEnvelope struct {
+	Namespace  *Namespace   `json:"Namespace,omitempty"`
 	Namespaces *[]Namespace `json:"Namespaces,omitempty"`
 	Error      *Error       `json:"Error,omitempty"`
 }
 
+type SupportedNamespaceEnvelope struct {
+	SupportedNamespaces *[]SupportedNamespace `json:"SupportedNamespaces,omitempty"`
+	Error               *Error                `json:"Error,omitempty"`
+}
+
 type VulnerabilityEnvelope struct {
 	Vulnerability   *Vulnerability   `json:"Vulnerability,omitempty"`
 	Vulnerabilities *[]Vulnerability `json:"Vulnerabilities,omitempty"`
@@ -295,6 +494,12 @@ type VulnerabilityEnvelope struct {
 	Error           *Error           `json:"Error,omitempty"`
 }
 
+type SuppressionEnvelope struct {
+	Suppression  *Suppression   `json:"Suppression,omitempty"`
+	Suppressions *[]Suppression `json:"Suppressions,omitempty"`
+	Error        *Error         `json:"Error,omitempty"`
+}
+
 type NotificationEnvelope struct {
 	Notification *Notification `json:"Notification,omitempty"`
 	Error        *Error        `json:"Error,omitempty"`
@@ -303,6 +508,7 @@ type NotificationEnvelope struct {
 type FeatureEnvelope struct {
 	Feature  *Feature   `json:"Feature,omitempty"`
 	Features *[]Feature `json:"Features,omitempty"`
+	NextPage string     `json:"NextPage,omitempty"`
 	Error    *Error     `json:"Error,omitempty"`
 }
 
@@ -55,12 +55,17 @@ func NewRouter(store database.Datastore, paginationKey string) *httprouter.Route
 
 	// Layers
 	router.POST("/layers", httpHandler(postLayer, ctx))
+	router.GET("/layers", httpHandler(getLayers, ctx))
 	router.GET("/layers/:layerName", httpHandler(getLayer, ctx))
+	router.GET("/layers/:layerName/diff", httpHandler(getLayerDiff, ctx))
 	router.DELETE("/layers/:layerName", httpHandler(deleteLayer, ctx))
 
 	// Namespaces
 	router.GET("/namespaces", httpHandler(getNamespaces, ctx))
+	router.GET("/namespaces/:namespaceName", httpHandler(getNamespace, ctx))
 	router.POST("/namespaces",httpHandler(postNamespaces,ctx))
+	router.PUT("/namespaces/:namespaceName", httpHandler(putNamespace, ctx))
+	router.GET("/supported", httpHandler(getSupportedNamespaces, ctx))
 
 	// Vulnerabilities
 	router.GET("/namespaces/:namespaceName/vulnerabilities", httpHandler(getVulnerabilities, ctx))
@@ -69,11 +74,20 @@ func NewRouter(store database.Datastore, paginationKey string) *httprouter.Route
 	router.PUT("/namespaces/:namespaceName/vulnerabilities/:vulnerabilityName", httpHandler(putVulnerability, ctx))
 	router.DELETE("/namespaces/:namespaceName/vulnerabilities/:vulnerabilityName", httpHandler(deleteVulnerability, ctx))
 
+	// Features
+	router.GET("/namespaces/:namespaceName/features", httpHandler(getFeatures, ctx))
+	router.GET("/namespaces/:namespaceName/features/:featureName/vulnerabilities", httpHandler(getFeatureVulnerabilities, ctx))
+
 	// Fixes
 	router.GET("/namespaces/:namespaceName/vulnerabilities/:vulnerabilityName/fixes", httpHandler(getFixes, ctx))
 	router.PUT("/namespaces/:namespaceName/vulnerabilities/:vulnerabilityName/fixes/:fixName", httpHandler(putFix, ctx))
 	router.DELETE("/namespaces/:namespaceName/vulnerabilities/:vulnerabilityName/fixes/:fixName", httpHandler(deleteFix, ctx))
 
+	// Suppressions
+	router.GET("/suppressions", httpHandler(getSuppressions, ctx))
+	router.PUT("/namespaces/:namespaceName/features/:featureName/suppressions/:vulnerabilityName", httpHandler(putSuppression, ctx))
+	router.DELETE("/namespaces/:namespaceName/features/:featureName/suppressions/:vulnerabilityName", httpHandler(deleteSuppression, ctx))
+
 	// Notifications
 	router.GET("/notifications/:notificationName", httpHandler(getNotification, ctx))
 	router.DELETE("/notifications/:notificationName", httpHandler(deleteNotification, ctx))
@@ -3,17 +3,22 @@ package v1
 import (
 	"compress/gzip"
 	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/julienschmidt/httprouter"
 	"github.com/prometheus/client_golang/prometheus"
 	log "github.com/sirupsen/logrus"
 	"github.com/MXi4oyu/DockerXScan/database"
 	"github.com/MXi4oyu/DockerXScan/common/commonerr"
+	"github.com/MXi4oyu/DockerXScan/imagefmt"
 	"github.com/MXi4oyu/DockerXScan/tarutil"
+	"github.com/MXi4oyu/DockerXScan/updater"
+	"github.com/MXi4oyu/DockerXScan/versionfmt"
 	"github.com/MXi4oyu/DockerXScan/worker"
 )
 
@@ -21,9 +26,14 @@ const (
 	// These are the route identifiers for prometheus.
 	postLayerRoute           = "v1/postLayer"
 	getLayerRoute            = "v1/getLayer"
+	getLayersRoute           = "v1/getLayers"
+	getLayerDiffRoute        = "v1/getLayerDiff"
 	deleteLayerRoute         = "v1/deleteLayer"
 	getNamespacesRoute       = "v1/getNamespaces"
+	getNamespaceRoute        = "v1/getNamespace"
 	postNamespacesRoute	   ="v1/postNamespaces"
+	putNamespaceRoute        = "v1/putNamespace"
+	getSupportedNamespacesRoute = "v1/getSupportedNamespaces"
 	getVulnerabilitiesRoute  = "v1/getVulnerabilities"
 	postVulnerabilityRoute   = "v1/postVulnerability"
 	getVulnerabilityRoute    = "v1/getVulnerability"
@@ -32,10 +42,15 @@ const (
 	getFixesRoute            = "v1/getFixes"
 	putFixRoute              = "v1/putFix"
 	deleteFixRoute           = "v1/deleteFix"
+	getSuppressionsRoute     = "v1/getSuppressions"
+	putSuppressionRoute      = "v1/putSuppression"
+	deleteSuppressionRoute   = "v1/deleteSuppression"
 	getNotificationRoute     = "v1/getNotification"
 	deleteNotificationRoute  = "v1/deleteNotification"
 	getMetricsRoute          = "v1/getMetrics"
 	postFeatureVersionRoute       = "v1/postFeatureVersion"
+	getFeaturesRoute               = "v1/getFeatures"
+	getFeatureVulnerabilitiesRoute = "v1/getFeatureVulnerabilities"
 
 	// maxBodySize restricts client request bodies to 1MiB.
 	maxBodySize int64 = 1048576
@@ -48,6 +63,27 @@ const (
 	statusUnprocessableEntity = 422
 )
 
+// errorStatus returns the HTTP status code corresponding to an error returned
+// by the datastore or the worker.
+func errorStatus(err error) int {
+	if err == commonerr.ErrNotFound {
+		return http.StatusNotFound
+	}
+	if err == worker.ErrTooBusy {
+		return http.StatusServiceUnavailable
+	}
+	if _, badreq := err.(*commonerr.ErrBadRequest); badreq {
+		return http.StatusBadRequest
+	}
+	if errors.Is(err, database.ErrTimeout) {
+		return http.StatusGatewayTimeout
+	}
+	if errors.Is(err, database.ErrBackendException) {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
 func decodeJSON(r *http.Request, v interface{}) error {
 	defer r.Body.Close()
 	return json.NewDecoder(io.LimitReader(r.Body, maxBodySize)).Decode(v)
@@ -96,26 +132,46 @@ func postLayer(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx
 		return postLayerRoute, http.StatusBadRequest
 	}
 
-	err = worker.ProcessLayer(ctx.Store, request.Layer.Format, request.Layer.Name, request.Layer.ParentName, request.Layer.Path, request.Layer.Headers)
+	// A client retrying a submission after a timeout sends the same key, so
+	// that it gets the result of the first one.
+	err = worker.ProcessLayerWithKey(ctx.Store, r.Header.Get("Idempotency-Key"), request.Layer.Format, request.Layer.MediaType, request.Layer.Name, request.Layer.ParentName, request.Layer.Path, request.Layer.Digest, request.Layer.Headers)
 	if err != nil {
 		if err == tarutil.ErrCouldNotExtract ||
 			err == tarutil.ErrExtractedFileTooBig ||
+			err == tarutil.ErrUnknownFormat ||
+			err == imagefmt.ErrDigestMismatch ||
+			err == imagefmt.ErrMissingDigest ||
 			err == worker.ErrUnsupported {
 			writeResponse(w, r, statusUnprocessableEntity, LayerEnvelope{Error: &Error{err.Error()}})
 			return postLayerRoute, statusUnprocessableEntity
 		}
 
+		if err == database.ErrParentMismatch {
+			writeResponse(w, r, http.StatusConflict, LayerEnvelope{Error: &Error{err.Error()}})
+			return postLayerRoute, http.StatusConflict
+		}
+
 		if _, badreq := err.(*commonerr.ErrBadRequest); badreq {
 			writeResponse(w, r, http.StatusBadRequest, LayerEnvelope{Error: &Error{err.Error()}})
 			return postLayerRoute, http.StatusBadRequest
 		}
 
-		writeResponse(w, r, http.StatusInternalServerError, LayerEnvelope{Error: &Error{err.Error()}})
-		return postLayerRoute, http.StatusInternalServerError
+		status := errorStatus(err)
+		writeResponse(w, r, status, LayerEnvelope{Error: &Error{err.Error()}})
+		return postLayerRoute, status
+	}
+
+	// The name of a layer taken on top of another parent, it is stored under
+	// its chain name, by which the client finds it and submits its children.
+	name, err := worker.StoredLayerName(ctx.Store, request.Layer.Name, request.Layer.ParentName)
+	if err != nil {
+		status := errorStatus(err)
+		writeResponse(w, r, status, LayerEnvelope{Error: &Error{err.Error()}})
+		return postLayerRoute, status
 	}
 
 	writeResponse(w, r, http.StatusCreated, LayerEnvelope{Layer: &Layer{
-		Name:             request.Layer.Name,
+		Name:             name,
 		ParentName:       request.Layer.ParentName,
 		Path:             request.Layer.Path,
 		Headers:          request.Layer.Headers,
@@ -128,30 +184,129 @@ func postLayer(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx
 func getLayer(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *context) (string, int) {
 	_, withFeatures := r.URL.Query()["features"]
 	_, withVulnerabilities := r.URL.Query()["vulnerabilities"]
+	_, withWithdrawn := r.URL.Query()["withdrawn"]
+	_, onlyFixed := r.URL.Query()["onlyFixed"]
 
-	dbLayer, err := ctx.Store.FindLayer(p.ByName("layerName"), withFeatures, withVulnerabilities)
+	opts := database.FindLayerOpts{
+		WithFeatures:        withFeatures,
+		WithVulnerabilities: withVulnerabilities,
+		IncludeWithdrawn:    withWithdrawn,
+		NamespaceFilter:     r.URL.Query()["namespace"],
+	}
+	if minimumSeverity := r.URL.Query().Get("minimumSeverity"); minimumSeverity != "" {
+		severity, err := database.NewSeverity(minimumSeverity)
+		if err != nil {
+			writeResponse(w, r, http.StatusBadRequest, LayerEnvelope{Error: &Error{"invalid minimumSeverity"}})
+			return getLayerRoute, http.StatusBadRequest
+		}
+		opts.SeverityAtLeast = severity
+	}
+	if minimumConfidence := r.URL.Query().Get("minimumConfidence"); minimumConfidence != "" {
+		confidence, err := database.NewConfidence(minimumConfidence)
+		if err != nil {
+			writeResponse(w, r, http.StatusBadRequest, LayerEnvelope{Error: &Error{"invalid minimumConfidence"}})
+			return getLayerRoute, http.StatusBadRequest
+		}
+		opts.ConfidenceAtLeast = confidence
+	}
+
+	dbLayer, err := ctx.Store.FindLayerWithOpts(p.ByName("layerName"), opts)
 	if err == commonerr.ErrNotFound {
 		writeResponse(w, r, http.StatusNotFound, LayerEnvelope{Error: &Error{err.Error()}})
 		return getLayerRoute, http.StatusNotFound
 	} else if err != nil {
-		writeResponse(w, r, http.StatusInternalServerError, LayerEnvelope{Error: &Error{err.Error()}})
-		return getLayerRoute, http.StatusInternalServerError
+		status := errorStatus(err)
+		writeResponse(w, r, status, LayerEnvelope{Error: &Error{err.Error()}})
+		return getLayerRoute, status
 	}
 
 	layer := LayerFromDatabaseModel(dbLayer, withFeatures, withVulnerabilities)
+	if onlyFixed {
+		layer.RemoveUnfixedVulnerabilities()
+	}
 
 	writeResponse(w, r, http.StatusOK, LayerEnvelope{Layer: &layer})
 	return getLayerRoute, http.StatusOK
 }
 
+// getLayerDiff returns the features that a layer adds and removes relative to
+// another layer, given with the parent parameter, which is the parent of the
+// layer when it is absent. An empty parent is the empty layer.
+func getLayerDiff(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *context) (string, int) {
+	layerName := p.ByName("layerName")
+
+	parent, ok := r.URL.Query()["parent"]
+	parentName := ""
+	if ok {
+		parentName = parent[0]
+	} else {
+		dbLayer, err := ctx.Store.FindLayer(layerName, false, false)
+		if err != nil {
+			status := errorStatus(err)
+			writeResponse(w, r, status, LayerDiffEnvelope{Error: &Error{err.Error()}})
+			return getLayerDiffRoute, status
+		}
+		if dbLayer.Parent != nil {
+			parentName = dbLayer.Parent.Name
+		}
+	}
+
+	dbAdded, dbRemoved, err := ctx.Store.DiffLayerFeatures(layerName, parentName)
+	if err != nil {
+		status := errorStatus(err)
+		writeResponse(w, r, status, LayerDiffEnvelope{Error: &Error{err.Error()}})
+		return getLayerDiffRoute, status
+	}
+
+	added := make([]Feature, 0, len(dbAdded))
+	for _, dbFeatureVersion := range dbAdded {
+		added = append(added, FeatureFromDatabaseModel(dbFeatureVersion))
+	}
+	removed := make([]Feature, 0, len(dbRemoved))
+	for _, dbFeatureVersion := range dbRemoved {
+		removed = append(removed, FeatureFromDatabaseModel(dbFeatureVersion))
+	}
+
+	writeResponse(w, r, http.StatusOK, LayerDiffEnvelope{ParentName: parentName, Added: &added, Removed: &removed})
+	return getLayerDiffRoute, http.StatusOK
+}
+
+// getLayers returns the layers having one of the digests given with the
+// digest parameter, such as the diff IDs of an image, along with their
+// parent, so that a client finds the layers of an image it knows by its
+// manifest without submitting them.
+func getLayers(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *context) (string, int) {
+	digests := r.URL.Query()["digest"]
+	if len(digests) == 0 {
+		writeResponse(w, r, http.StatusBadRequest, LayerEnvelope{Error: &Error{"failed to provide a digest"}})
+		return getLayersRoute, http.StatusBadRequest
+	}
+
+	dbLayers, err := ctx.Store.FindLayers(digests)
+	if err != nil {
+		status := errorStatus(err)
+		writeResponse(w, r, status, LayerEnvelope{Error: &Error{err.Error()}})
+		return getLayersRoute, status
+	}
+
+	layers := make([]Layer, 0, len(dbLayers))
+	for _, dbLayer := range dbLayers {
+		layers = append(layers, LayerFromDatabaseModel(dbLayer, false, false))
+	}
+
+	writeResponse(w, r, http.StatusOK, LayerEnvelope{Layers: &layers})
+	return getLayersRoute, http.StatusOK
+}
+
 func deleteLayer(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *context) (string, int) {
 	err := ctx.Store.DeleteLayer(p.ByName("layerName"))
 	if err == commonerr.ErrNotFound {
 		writeResponse(w, r, http.StatusNotFound, LayerEnvelope{Error: &Error{err.Error()}})
 		return deleteLayerRoute, http.StatusNotFound
 	} else if err != nil {
-		writeResponse(w, r, http.StatusInternalServerError, LayerEnvelope{Error: &Error{err.Error()}})
-		return deleteLayerRoute, http.StatusInternalServerError
+		status := errorStatus(err)
+		writeResponse(w, r, status, LayerEnvelope{Error: &Error{err.Error()}})
+		return deleteLayerRoute, status
 	}
 
 	w.WriteHeader(http.StatusOK)
@@ -159,16 +314,31 @@ func deleteLayer(w http.ResponseWriter, r *http.Request, p httprouter.Params, ct
 }
 
 func getNamespaces(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *context) (string, int) {
+	// The namespaces can be restricted to a kind, to present the
+	// distributions apart from the language ecosystems.
+	kind := database.NamespaceKind(r.URL.Query().Get("kind"))
+	if kind != "" && !kind.Valid() {
+		writeResponse(w, r, http.StatusBadRequest, NamespaceEnvelope{Error: &Error{"invalid namespace kind " + string(kind)}})
+		return getNamespacesRoute, http.StatusBadRequest
+	}
+
 	dbNamespaces, err := ctx.Store.ListNamespaces()
 	if err != nil {
-		writeResponse(w, r, http.StatusInternalServerError, NamespaceEnvelope{Error: &Error{err.Error()}})
-		return getNamespacesRoute, http.StatusInternalServerError
+		status := errorStatus(err)
+		writeResponse(w, r, status, NamespaceEnvelope{Error: &Error{err.Error()}})
+		return getNamespacesRoute, status
 	}
 	var namespaces []Namespace
 	for _, dbNamespace := range dbNamespaces {
+		if kind != "" && dbNamespace.Kind != kind {
+			continue
+		}
 		namespaces = append(namespaces, Namespace{
 			Name:          dbNamespace.Name,
 			VersionFormat: dbNamespace.VersionFormat,
+			Disabled:      dbNamespace.Disabled,
+			DataVersion:   dbNamespace.DataVersion,
+			Kind:          string(dbNamespace.Kind),
 		})
 	}
 
@@ -176,6 +346,27 @@ func getNamespaces(w http.ResponseWriter, r *http.Request, p httprouter.Params,
 	return getNamespacesRoute, http.StatusOK
 }
 
+func getNamespace(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *context) (string, int) {
+	dbNamespace, err := ctx.Store.FindNamespace(p.ByName("namespaceName"))
+	if err == commonerr.ErrNotFound {
+		writeResponse(w, r, http.StatusNotFound, NamespaceEnvelope{Error: &Error{err.Error()}})
+		return getNamespaceRoute, http.StatusNotFound
+	} else if err != nil {
+		status := errorStatus(err)
+		writeResponse(w, r, status, NamespaceEnvelope{Error: &Error{err.Error()}})
+		return getNamespaceRoute, status
+	}
+
+	writeResponse(w, r, http.StatusOK, NamespaceEnvelope{Namespace: &Namespace{
+		Name:          dbNamespace.Name,
+		VersionFormat: dbNamespace.VersionFormat,
+		Disabled:      dbNamespace.Disabled,
+		DataVersion:   dbNamespace.DataVersion,
+		Kind:          string(dbNamespace.Kind),
+	}})
+	return getNamespaceRoute, http.StatusOK
+}
+
 //插入namespace
 func postNamespaces(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *context) (string, int) {
 
@@ -186,13 +377,72 @@ func postNamespaces(w http.ResponseWriter, r *http.Request, p httprouter.Params,
 		return postNamespacesRoute,http.StatusBadRequest
 	}
 
-	ns:=database.Namespace{Name:request.Name,VersionFormat:request.VersionFormat}
+	ns:=database.Namespace{Name:request.Name,VersionFormat:request.VersionFormat,Kind:database.NamespaceKind(request.Kind)}
+	if ns.Kind != "" && !ns.Kind.Valid() {
+		writeResponse(w, r, http.StatusBadRequest, NamespaceEnvelope{Error: &Error{"invalid namespace kind " + request.Kind}})
+		return postNamespacesRoute, http.StatusBadRequest
+	}
 
 	ctx.Store.InsertNamespace(ns)
 
 	return postNamespacesRoute,http.StatusOK
 }
 
+func putNamespace(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *context) (string, int) {
+	request := Namespace{}
+	err := decodeJSON(r, &request)
+	if err != nil {
+		writeResponse(w, r, http.StatusBadRequest, NamespaceEnvelope{Error: &Error{err.Error()}})
+		return putNamespaceRoute, http.StatusBadRequest
+	}
+
+	err = ctx.Store.SetNamespaceEnabled(p.ByName("namespaceName"), !request.Disabled)
+	if err == commonerr.ErrNotFound {
+		writeResponse(w, r, http.StatusNotFound, NamespaceEnvelope{Error: &Error{err.Error()}})
+		return putNamespaceRoute, http.StatusNotFound
+	} else if err != nil {
+		status := errorStatus(err)
+		writeResponse(w, r, status, NamespaceEnvelope{Error: &Error{err.Error()}})
+		return putNamespaceRoute, status
+	}
+
+	w.WriteHeader(http.StatusOK)
+	return putNamespaceRoute, http.StatusOK
+}
+
+// getSupportedNamespaces returns the OS flavors whose detector, lister and
+// updater are compiled in and enabled, so that a client knows whether an image
+// can be scanned before pushing its layers.
+func getSupportedNamespaces(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *context) (string, int) {
+	supports, err := updater.SupportedNamespaces(ctx.Store)
+	if err != nil {
+		status := errorStatus(err)
+		writeResponse(w, r, status, SupportedNamespaceEnvelope{Error: &Error{err.Error()}})
+		return getSupportedNamespacesRoute, status
+	}
+
+	namespaces := make([]SupportedNamespace, 0, len(supports))
+	for _, s := range supports {
+		namespace := SupportedNamespace{
+			Name:            s.Name,
+			Supported:       s.Supported(),
+			Detectors:       s.Detectors,
+			DetectorEnabled: s.DetectorEnabled,
+			Lister:          s.Lister,
+			ListerEnabled:   s.ListerEnabled,
+			Updater:         s.Updater,
+			UpdaterEnabled:  s.UpdaterEnabled,
+		}
+		if !s.LastUpdate.IsZero() {
+			namespace.LastUpdate = s.LastUpdate.Format(time.RFC3339)
+		}
+		namespaces = append(namespaces, namespace)
+	}
+
+	writeResponse(w, r, http.StatusOK, SupportedNamespaceEnvelope{SupportedNamespaces: &namespaces})
+	return getSupportedNamespacesRoute, http.StatusOK
+}
+
 func getVulnerabilities(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *context) (string, int) {
 	query := r.URL.Query()
 
@@ -226,13 +476,25 @@ func getVulnerabilities(w http.ResponseWriter, r *http.Request, p httprouter.Par
 		return getNotificationRoute, http.StatusBadRequest
 	}
 
-	dbVulns, nextPage, err := ctx.Store.ListVulnerabilities(namespace, limit, page)
+	var dbVulns []database.Vulnerability
+	var nextPage int
+	if sinceStr := query.Get("since"); sinceStr != "" {
+		since, parseErr := time.Parse(time.RFC3339, sinceStr)
+		if parseErr != nil {
+			writeResponse(w, r, http.StatusBadRequest, VulnerabilityEnvelope{Error: &Error{"invalid since format: " + parseErr.Error()}})
+			return getVulnerabilitiesRoute, http.StatusBadRequest
+		}
+		dbVulns, nextPage, err = ctx.Store.ListVulnerabilitiesSince(namespace, since, limit, page)
+	} else {
+		dbVulns, nextPage, err = ctx.Store.ListVulnerabilities(namespace, limit, page)
+	}
 	if err == commonerr.ErrNotFound {
 		writeResponse(w, r, http.StatusNotFound, VulnerabilityEnvelope{Error: &Error{err.Error()}})
 		return getVulnerabilityRoute, http.StatusNotFound
 	} else if err != nil {
-		writeResponse(w, r, http.StatusInternalServerError, VulnerabilityEnvelope{Error: &Error{err.Error()}})
-		return getVulnerabilitiesRoute, http.StatusInternalServerError
+		status := errorStatus(err)
+		writeResponse(w, r, status, VulnerabilityEnvelope{Error: &Error{err.Error()}})
+		return getVulnerabilitiesRoute, status
 	}
 
 	var vulns []Vulnerability
@@ -255,6 +517,93 @@ func getVulnerabilities(w http.ResponseWriter, r *http.Request, p httprouter.Par
 	return getVulnerabilitiesRoute, http.StatusOK
 }
 
+// getFeatures lists the distinct feature versions of a namespace added by the
+// stored layers, for the inventory of the analyzed images.
+func getFeatures(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *context) (string, int) {
+	query := r.URL.Query()
+
+	limitStrs, limitExists := query["limit"]
+	if !limitExists {
+		writeResponse(w, r, http.StatusBadRequest, FeatureEnvelope{Error: &Error{"must provide limit query parameter"}})
+		return getFeaturesRoute, http.StatusBadRequest
+	}
+	limit, err := strconv.Atoi(limitStrs[0])
+	if err != nil {
+		writeResponse(w, r, http.StatusBadRequest, FeatureEnvelope{Error: &Error{"invalid limit format: " + err.Error()}})
+		return getFeaturesRoute, http.StatusBadRequest
+	} else if limit < 0 {
+		writeResponse(w, r, http.StatusBadRequest, FeatureEnvelope{Error: &Error{"limit value should not be less than zero"}})
+		return getFeaturesRoute, http.StatusBadRequest
+	}
+
+	page := 0
+	pageStrs, pageExists := query["page"]
+	if pageExists {
+		err = tokenUnmarshal(pageStrs[0], ctx.PaginationKey, &page)
+		if err != nil {
+			writeResponse(w, r, http.StatusBadRequest, FeatureEnvelope{Error: &Error{"invalid page format: " + err.Error()}})
+			return getFeaturesRoute, http.StatusBadRequest
+		}
+	}
+
+	dbFeatureVersions, nextPage, err := ctx.Store.ListFeatures(p.ByName("namespaceName"), limit, page)
+	if err == commonerr.ErrNotFound {
+		writeResponse(w, r, http.StatusNotFound, FeatureEnvelope{Error: &Error{err.Error()}})
+		return getFeaturesRoute, http.StatusNotFound
+	} else if err != nil {
+		status := errorStatus(err)
+		writeResponse(w, r, status, FeatureEnvelope{Error: &Error{err.Error()}})
+		return getFeaturesRoute, status
+	}
+
+	features := []Feature{}
+	for _, dbFeatureVersion := range dbFeatureVersions {
+		features = append(features, FeatureFromDatabaseModel(dbFeatureVersion))
+	}
+
+	var nextPageStr string
+	if nextPage != -1 {
+		nextPageBytes, err := tokenMarshal(nextPage, ctx.PaginationKey)
+		if err != nil {
+			writeResponse(w, r, http.StatusBadRequest, FeatureEnvelope{Error: &Error{"failed to marshal token: " + err.Error()}})
+			return getFeaturesRoute, http.StatusBadRequest
+		}
+		nextPageStr = string(nextPageBytes)
+	}
+
+	writeResponse(w, r, http.StatusOK, FeatureEnvelope{Features: &features, NextPage: nextPageStr})
+	return getFeaturesRoute, http.StatusOK
+}
+
+// getFeatureVulnerabilities returns the vulnerabilities affecting the version
+// of a feature given by the version query parameter.
+func getFeatureVulnerabilities(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *context) (string, int) {
+	version := r.URL.Query().Get("version")
+	if version == "" {
+		writeResponse(w, r, http.StatusBadRequest, VulnerabilityEnvelope{Error: &Error{"must provide version query parameter"}})
+		return getFeatureVulnerabilitiesRoute, http.StatusBadRequest
+	}
+
+	dbVulns, err := ctx.Store.FindVulnerabilitiesForFeature(p.ByName("namespaceName"), p.ByName("featureName"), version)
+	if err != nil {
+		status := errorStatus(err)
+		writeResponse(w, r, status, VulnerabilityEnvelope{Error: &Error{err.Error()}})
+		return getFeatureVulnerabilitiesRoute, status
+	}
+
+	vulns := make([]Vulnerability, 0, len(dbVulns))
+	for _, dbVuln := range dbVulns {
+		vuln := VulnerabilityFromDatabaseModel(dbVuln, false)
+		if dbVuln.FixedBy != versionfmt.MaxVersion {
+			vuln.FixedBy = dbVuln.FixedBy
+		}
+		vulns = append(vulns, vuln)
+	}
+
+	writeResponse(w, r, http.StatusOK, VulnerabilityEnvelope{Vulnerabilities: &vulns})
+	return getFeatureVulnerabilitiesRoute, http.StatusOK
+}
+
 func postVulnerability(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *context) (string, int) {
 	request := VulnerabilityEnvelope{}
 	err := decodeJSON(r, &request)
@@ -281,8 +630,9 @@ func postVulnerability(w http.ResponseWriter, r *http.Request, p httprouter.Para
 			writeResponse(w, r, http.StatusBadRequest, VulnerabilityEnvelope{Error: &Error{err.Error()}})
 			return postVulnerabilityRoute, http.StatusBadRequest
 		default:
-			writeResponse(w, r, http.StatusInternalServerError, VulnerabilityEnvelope{Error: &Error{err.Error()}})
-			return postVulnerabilityRoute, http.StatusInternalServerError
+			status := errorStatus(err)
+			writeResponse(w, r, status, VulnerabilityEnvelope{Error: &Error{err.Error()}})
+			return postVulnerabilityRoute, status
 		}
 	}
 
@@ -293,13 +643,27 @@ func postVulnerability(w http.ResponseWriter, r *http.Request, p httprouter.Para
 func getVulnerability(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *context) (string, int) {
 	_, withFixedIn := r.URL.Query()["fixedIn"]
 
-	dbVuln, err := ctx.Store.FindVulnerability(p.ByName("namespaceName"), p.ByName("vulnerabilityName"))
+	// With affected, the fixes and the feature versions they affect are
+	// returned as well, for a detail view to be a single request.
+	find := ctx.Store.FindVulnerability
+	if _, withAffected := r.URL.Query()["affected"]; withAffected {
+		find = ctx.Store.FindVulnerabilityWithAffected
+		withFixedIn = true
+	}
+	// With deleted, a vulnerability that has been deleted but not purged yet
+	// is returned as it was last, for its history to be looked up.
+	if _, withDeleted := r.URL.Query()["deleted"]; withDeleted {
+		find = ctx.Store.FindVulnerabilityWithDeleted
+	}
+
+	dbVuln, err := find(p.ByName("namespaceName"), p.ByName("vulnerabilityName"))
 	if err == commonerr.ErrNotFound {
 		writeResponse(w, r, http.StatusNotFound, VulnerabilityEnvelope{Error: &Error{err.Error()}})
 		return getVulnerabilityRoute, http.StatusNotFound
 	} else if err != nil {
-		writeResponse(w, r, http.StatusInternalServerError, VulnerabilityEnvelope{Error: &Error{err.Error()}})
-		return getVulnerabilityRoute, http.StatusInternalServerError
+		status := errorStatus(err)
+		writeResponse(w, r, status, VulnerabilityEnvelope{Error: &Error{err.Error()}})
+		return getVulnerabilityRoute, status
 	}
 
 	vuln := VulnerabilityFromDatabaseModel(dbVuln, withFixedIn)
@@ -342,8 +706,9 @@ func putVulnerability(w http.ResponseWriter, r *http.Request, p httprouter.Param
 			writeResponse(w, r, http.StatusBadRequest, VulnerabilityEnvelope{Error: &Error{err.Error()}})
 			return putVulnerabilityRoute, http.StatusBadRequest
 		default:
-			writeResponse(w, r, http.StatusInternalServerError, VulnerabilityEnvelope{Error: &Error{err.Error()}})
-			return putVulnerabilityRoute, http.StatusInternalServerError
+			status := errorStatus(err)
+			writeResponse(w, r, status, VulnerabilityEnvelope{Error: &Error{err.Error()}})
+			return putVulnerabilityRoute, status
 		}
 	}
 
@@ -357,8 +722,9 @@ func deleteVulnerability(w http.ResponseWriter, r *http.Request, p httprouter.Pa
 		writeResponse(w, r, http.StatusNotFound, VulnerabilityEnvelope{Error: &Error{err.Error()}})
 		return deleteVulnerabilityRoute, http.StatusNotFound
 	} else if err != nil {
-		writeResponse(w, r, http.StatusInternalServerError, VulnerabilityEnvelope{Error: &Error{err.Error()}})
-		return deleteVulnerabilityRoute, http.StatusInternalServerError
+		status := errorStatus(err)
+		writeResponse(w, r, status, VulnerabilityEnvelope{Error: &Error{err.Error()}})
+		return deleteVulnerabilityRoute, status
 	}
 
 	w.WriteHeader(http.StatusOK)
@@ -371,8 +737,9 @@ func getFixes(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *
 		writeResponse(w, r, http.StatusNotFound, FeatureEnvelope{Error: &Error{err.Error()}})
 		return getFixesRoute, http.StatusNotFound
 	} else if err != nil {
-		writeResponse(w, r, http.StatusInternalServerError, FeatureEnvelope{Error: &Error{err.Error()}})
-		return getFixesRoute, http.StatusInternalServerError
+		status := errorStatus(err)
+		writeResponse(w, r, status, FeatureEnvelope{Error: &Error{err.Error()}})
+		return getFixesRoute, status
 	}
 
 	vuln := VulnerabilityFromDatabaseModel(dbVuln, true)
@@ -415,8 +782,9 @@ func putFix(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *co
 				writeResponse(w, r, http.StatusNotFound, FeatureEnvelope{Error: &Error{err.Error()}})
 				return putFixRoute, http.StatusNotFound
 			}
-			writeResponse(w, r, http.StatusInternalServerError, FeatureEnvelope{Error: &Error{err.Error()}})
-			return putFixRoute, http.StatusInternalServerError
+			status := errorStatus(err)
+			writeResponse(w, r, status, FeatureEnvelope{Error: &Error{err.Error()}})
+			return putFixRoute, status
 		}
 	}
 
@@ -430,14 +798,91 @@ func deleteFix(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx
 		writeResponse(w, r, http.StatusNotFound, FeatureEnvelope{Error: &Error{err.Error()}})
 		return deleteFixRoute, http.StatusNotFound
 	} else if err != nil {
-		writeResponse(w, r, http.StatusInternalServerError, FeatureEnvelope{Error: &Error{err.Error()}})
-		return deleteFixRoute, http.StatusInternalServerError
+		status := errorStatus(err)
+		writeResponse(w, r, status, FeatureEnvelope{Error: &Error{err.Error()}})
+		return deleteFixRoute, status
 	}
 
 	w.WriteHeader(http.StatusOK)
 	return deleteFixRoute, http.StatusOK
 }
 
+// getSuppressions returns the suppressions of a namespace, or of every
+// namespace, including the expired ones so that the accepted risks can be
+// audited.
+func getSuppressions(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *context) (string, int) {
+	dbSuppressions, err := ctx.Store.ListSuppressions(r.URL.Query().Get("namespace"))
+	if err != nil {
+		status := errorStatus(err)
+		writeResponse(w, r, status, SuppressionEnvelope{Error: &Error{err.Error()}})
+		return getSuppressionsRoute, status
+	}
+
+	now := time.Now()
+	suppressions := make([]Suppression, 0, len(dbSuppressions))
+	for _, dbSuppression := range dbSuppressions {
+		suppressions = append(suppressions, SuppressionFromDatabaseModel(dbSuppression, now))
+	}
+
+	writeResponse(w, r, http.StatusOK, SuppressionEnvelope{Suppressions: &suppressions})
+	return getSuppressionsRoute, http.StatusOK
+}
+
+func putSuppression(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *context) (string, int) {
+	request := SuppressionEnvelope{}
+	err := decodeJSON(r, &request)
+	if err != nil {
+		writeResponse(w, r, http.StatusBadRequest, SuppressionEnvelope{Error: &Error{err.Error()}})
+		return putSuppressionRoute, http.StatusBadRequest
+	}
+
+	if request.Suppression == nil {
+		writeResponse(w, r, http.StatusBadRequest, SuppressionEnvelope{Error: &Error{"failed to provide suppression"}})
+		return putSuppressionRoute, http.StatusBadRequest
+	}
+
+	// The suppression is identified by the URL, which the JSON may omit.
+	request.Suppression.NamespaceName = p.ByName("namespaceName")
+	request.Suppression.FeatureName = p.ByName("featureName")
+	request.Suppression.VulnerabilityName = p.ByName("vulnerabilityName")
+
+	dbSuppression, err := request.Suppression.DatabaseModel()
+	if err != nil {
+		writeResponse(w, r, http.StatusBadRequest, SuppressionEnvelope{Error: &Error{err.Error()}})
+		return putSuppressionRoute, http.StatusBadRequest
+	}
+
+	err = ctx.Store.SetSuppression(dbSuppression)
+	if err != nil {
+		if _, badreq := err.(*commonerr.ErrBadRequest); badreq {
+			writeResponse(w, r, http.StatusBadRequest, SuppressionEnvelope{Error: &Error{err.Error()}})
+			return putSuppressionRoute, http.StatusBadRequest
+		}
+		status := errorStatus(err)
+		writeResponse(w, r, status, SuppressionEnvelope{Error: &Error{err.Error()}})
+		return putSuppressionRoute, status
+	}
+
+	suppression := SuppressionFromDatabaseModel(dbSuppression, time.Now())
+	writeResponse(w, r, http.StatusOK, SuppressionEnvelope{Suppression: &suppression})
+	return putSuppressionRoute, http.StatusOK
+}
+
+func deleteSuppression(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *context) (string, int) {
+	err := ctx.Store.DeleteSuppression(p.ByName("namespaceName"), p.ByName("featureName"), p.ByName("vulnerabilityName"))
+	if err == commonerr.ErrNotFound {
+		writeResponse(w, r, http.StatusNotFound, SuppressionEnvelope{Error: &Error{err.Error()}})
+		return deleteSuppressionRoute, http.StatusNotFound
+	} else if err != nil {
+		status := errorStatus(err)
+		writeResponse(w, r, status, SuppressionEnvelope{Error: &Error{err.Error()}})
+		return deleteSuppressionRoute, status
+	}
+
+	w.WriteHeader(http.StatusOK)
+	return deleteSuppressionRoute, http.StatusOK
+}
+
 func getNotification(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *context) (string, int) {
 	query := r.URL.Query()
 
@@ -476,8 +921,9 @@ func getNotification(w http.ResponseWriter, r *http.Request, p httprouter.Params
 		writeResponse(w, r, http.StatusNotFound, NotificationEnvelope{Error: &Error{err.Error()}})
 		return deleteNotificationRoute, http.StatusNotFound
 	} else if err != nil {
-		writeResponse(w, r, http.StatusInternalServerError, NotificationEnvelope{Error: &Error{err.Error()}})
-		return getNotificationRoute, http.StatusInternalServerError
+		status := errorStatus(err)
+		writeResponse(w, r, status, NotificationEnvelope{Error: &Error{err.Error()}})
+		return getNotificationRoute, status
 	}
 
 	notification := NotificationFromDatabaseModel(dbNotification, limit, pageToken, nextPage, ctx.PaginationKey)
@@ -492,8 +938,9 @@ func deleteNotification(w http.ResponseWriter, r *http.Request, p httprouter.Par
 		writeResponse(w, r, http.StatusNotFound, NotificationEnvelope{Error: &Error{err.Error()}})
 		return deleteNotificationRoute, http.StatusNotFound
 	} else if err != nil {
-		writeResponse(w, r, http.StatusInternalServerError, NotificationEnvelope{Error: &Error{err.Error()}})
-		return deleteNotificationRoute, http.StatusInternalServerError
+		status := errorStatus(err)
+		writeResponse(w, r, status, NotificationEnvelope{Error: &Error{err.Error()}})
+		return deleteNotificationRoute, status
 	}
 
 	w.WriteHeader(http.StatusOK)
@@ -505,11 +952,48 @@ func getMetrics(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx
 	return getMetricsRoute, 0
 }
 
-func postFeatureVersion(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *context)(string,int)  {
-
+// postFeatureVersion returns the vulnerabilities affecting the features that
+// a client detected itself, without storing anything, so that an image can be
+// scanned without persisting its layers.
+func postFeatureVersion(w http.ResponseWriter, r *http.Request, p httprouter.Params, ctx *context) (string, int) {
 	//方案一：本地解包时使用的接口
-	//预留
+	request := FeatureEnvelope{}
+	err := decodeJSON(r, &request)
+	if err != nil {
+		writeResponse(w, r, http.StatusBadRequest, FeatureEnvelope{Error: &Error{err.Error()}})
+		return postFeatureVersionRoute, http.StatusBadRequest
+	}
+
+	if request.Features == nil {
+		writeResponse(w, r, http.StatusBadRequest, FeatureEnvelope{Error: &Error{"failed to provide features"}})
+		return postFeatureVersionRoute, http.StatusBadRequest
+	}
+
+	var dbFeatureVersions []database.FeatureVersion
+	for _, feature := range *request.Features {
+		dbFeatureVersion, err := feature.DatabaseModel()
+		if err != nil {
+			writeResponse(w, r, http.StatusBadRequest, FeatureEnvelope{Error: &Error{err.Error()}})
+			return postFeatureVersionRoute, http.StatusBadRequest
+		}
+		dbFeatureVersion.SourceName = feature.SourceName
+		dbFeatureVersion.AddedBy = database.Layer{Name: feature.AddedBy}
 
-	return postFeatureVersionRoute,0
+		dbFeatureVersions = append(dbFeatureVersions, dbFeatureVersion)
+	}
+
+	dbFeatureVersions, err = ctx.Store.FindAffectingVulnerabilities(dbFeatureVersions)
+	if err != nil {
+		status := errorStatus(err)
+		writeResponse(w, r, status, FeatureEnvelope{Error: &Error{err.Error()}})
+		return postFeatureVersionRoute, status
+	}
+
+	features := LayerFromDatabaseModel(database.Layer{Features: dbFeatureVersions}, true, true).Features
+	if features == nil {
+		features = []Feature{}
+	}
 
+	writeResponse(w, r, http.StatusOK, FeatureEnvelope{Features: &features})
+	return postFeatureVersionRoute, http.StatusOK
 }
\ No newline at end of file
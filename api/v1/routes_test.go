@@ -0,0 +1,130 @@
+package v1
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/MXi4oyu/DockerXScan/common/commonerr"
+	"github.com/MXi4oyu/DockerXScan/database"
+	"github.com/MXi4oyu/DockerXScan/worker"
+)
+
+func TestErrorStatus(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"not found", commonerr.ErrNotFound, http.StatusNotFound},
+		{"too busy", worker.ErrTooBusy, http.StatusServiceUnavailable},
+		{"bad request", commonerr.NewBadRequestError("invalid layer"), http.StatusBadRequest},
+		{"timeout", &database.BackendError{Op: "searchLayer", Err: database.ErrTimeout}, http.StatusGatewayTimeout},
+		{"backend failure", &database.BackendError{Op: "searchLayer", Err: errors.New("connection refused")}, http.StatusServiceUnavailable},
+		{"backend exception", database.ErrBackendException, http.StatusServiceUnavailable},
+		{"other", errors.New("something else"), http.StatusInternalServerError},
+	}
+
+	for _, test := range tests {
+		if got := errorStatus(test.err); got != test.want {
+			t.Errorf("%s: errorStatus(%v) = %d, want %d", test.name, test.err, got, test.want)
+		}
+	}
+}
+
+// layerStore finds a layer affected by a low confidence vulnerability,
+// recording the options it was found with.
+type layerStore struct {
+	database.Datastore
+	opts database.FindLayerOpts
+}
+
+func (s *layerStore) FindLayerWithOpts(name string, opts database.FindLayerOpts) (database.Layer, error) {
+	s.opts = opts
+	return database.Layer{
+		Name: name,
+		Features: []database.FeatureVersion{{
+			Feature: database.Feature{Name: "crate", Namespace: database.Namespace{Name: "cargo", VersionFormat: "semver"}},
+			Version: "1.0.0",
+			AffectedBy: []database.Vulnerability{
+				{Name: "RUSTSEC-2021-0001", Severity: database.HighSeverity, Confidence: database.LowConfidence, FixedBy: "2.1.0"},
+			},
+		}},
+	}, nil
+}
+
+func TestGetLayerConfidence(t *testing.T) {
+	tests := []struct {
+		query      string
+		status     int
+		confidence database.Confidence
+	}{
+		{"?features&vulnerabilities", http.StatusOK, ""},
+		{"?features&vulnerabilities&minimumConfidence=high", http.StatusOK, database.HighConfidence},
+		{"?features&vulnerabilities&minimumConfidence=Low", http.StatusOK, database.LowConfidence},
+		{"?features&vulnerabilities&minimumConfidence=certain", http.StatusBadRequest, ""},
+	}
+
+	for _, test := range tests {
+		store := &layerStore{}
+		w := httptest.NewRecorder()
+		NewRouter(store, "").ServeHTTP(w, httptest.NewRequest("GET", "/layers/layer"+test.query, nil))
+		if w.Code != test.status {
+			t.Errorf("GET %s returned %d, want %d", test.query, w.Code, test.status)
+			continue
+		}
+		if store.opts.ConfidenceAtLeast != test.confidence {
+			t.Errorf("GET %s found the layer with the minimum confidence %q, want %q", test.query, store.opts.ConfidenceAtLeast, test.confidence)
+		}
+		if w.Code != http.StatusOK {
+			continue
+		}
+
+		// The confidence of the vulnerabilities is reported along with them.
+		var envelope LayerEnvelope
+		if err := json.Unmarshal(w.Body.Bytes(), &envelope); err != nil {
+			t.Fatalf("GET %s returned an invalid layer: %s", test.query, err)
+		}
+		if len(envelope.Layer.Features) != 1 || len(envelope.Layer.Features[0].Vulnerabilities) != 1 {
+			t.Fatalf("GET %s returned %+v, want a feature with a vulnerability", test.query, envelope.Layer)
+		}
+		if c := envelope.Layer.Features[0].Vulnerabilities[0].Confidence; c != "Low" {
+			t.Errorf("GET %s returned a vulnerability of the confidence %q, want Low", test.query, c)
+		}
+	}
+}
+
+func TestPostLayerOtherParent(t *testing.T) {
+	// The layer is stored on top of parent-a, and on top of parent-b under its
+	// chain name.
+	store := &database.MockDatastore{}
+	store.FctFindLayer = func(name string, withFeatures, withVulnerabilities bool) (database.Layer, error) {
+		parent := "parent-a"
+		if name != "layer" {
+			parent = "parent-b"
+		}
+		return database.Layer{Name: name, EngineVersion: worker.Version, Parent: &database.Layer{Name: parent}}, nil
+	}
+	chainName, err := worker.StoredLayerName(store, "layer", "parent-b")
+	if err != nil || chainName == "layer" {
+		t.Fatalf("StoredLayerName() of the layer on top of another parent = %q, %v", chainName, err)
+	}
+
+	// The client is told the name the layer is stored under.
+	for parent, want := range map[string]string{"parent-a": "layer", "parent-b": chainName} {
+		body := `{"Layer": {"Name": "layer", "ParentName": "` + parent + `", "Path": "http://127.0.0.1:0/layer", "Format": "Docker"}}`
+		w := httptest.NewRecorder()
+		NewRouter(store, "").ServeHTTP(w, httptest.NewRequest("POST", "/layers", strings.NewReader(body)))
+		var resp LayerEnvelope
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil || w.Code != http.StatusCreated || resp.Layer == nil {
+			t.Errorf("POST /layers on top of %s returned %d, %v", parent, w.Code, err)
+			continue
+		}
+		if resp.Layer.Name != want || resp.Layer.ParentName != parent {
+			t.Errorf("POST /layers on top of %s returned the layer %q on top of %q, want %q", parent, resp.Layer.Name, resp.Layer.ParentName, want)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+// Package httputil implements the HTTP helpers used by the vulnerability
+// fetchers to download their feeds.
+package httputil
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/MXi4oyu/DockerXScan/common/commonerr"
+)
+
+const (
+	// DefaultFeedTimeout is the maximum duration of a single feed download,
+	// including reading the response body.
+	DefaultFeedTimeout = 10 * time.Minute
+
+	// DefaultFeedMaxSize is the maximum number of bytes a single feed download
+	// may return.
+	DefaultFeedMaxSize int64 = 512 * 1024 * 1024 // 512 MiB
+)
+
+var (
+	// ErrFeedTimeout occurs when a feed server did not send the whole response
+	// within the configured timeout.
+	ErrFeedTimeout = errors.New("httputil: feed download timed out")
+
+	// ErrFeedTooBig occurs when a feed exceeds the configured maximum size.
+	ErrFeedTooBig = errors.New("httputil: feed download exceeded the maximum allowed size")
+
+	// ErrNotModified occurs when a conditional download finds that the feed
+	// did not change since the previous download.
+	ErrNotModified = errors.New("httputil: feed not modified")
+
+	feedTimeout = DefaultFeedTimeout
+	feedMaxSize = DefaultFeedMaxSize
+)
+
+// SetFeedLimits sets the timeout and the maximum size applied to every feed
+// download. Zero values keep the defaults.
+func SetFeedLimits(timeout time.Duration, maxSize int64) {
+	feedTimeout = DefaultFeedTimeout
+	if timeout > 0 {
+		feedTimeout = timeout
+	}
+
+	feedMaxSize = DefaultFeedMaxSize
+	if maxSize > 0 {
+		feedMaxSize = maxSize
+	}
+}
+
+// GetFeed issues a GET to the specified URL while enforcing the configured
+// timeout and maximum size.
+//
+// The whole body is read before GetFeed returns, so that a stalled or
+// oversized download is reported here instead of while the caller is parsing
+// the feed. The returned response's Body is backed by memory and does not
+// need to be closed.
+//
+// ErrFeedTimeout and ErrFeedTooBig are returned when a limit is hit, and
+// commonerr.ErrCouldNotDownload for any other failure.
+func GetFeed(feedURL string) (*http.Response, error) {
+	r, _, err := GetConditionalFeed(feedURL, FeedValidators{})
+	return r, err
+}
+
+// FeedValidators are the cache validators returned by a feed server, used to
+// only download the feed again once it changed.
+type FeedValidators struct {
+	ETag         string
+	LastModified string
+}
+
+// GetConditionalFeed is like GetFeed, but sends the validators of a previous
+// download as If-None-Match and If-Modified-Since headers. It returns
+// ErrNotModified when the server answers that the feed did not change, and
+// the validators of the new response otherwise.
+func GetConditionalFeed(feedURL string, previous FeedValidators) (*http.Response, FeedValidators, error) {
+	var validators FeedValidators
+
+	req, err := http.NewRequest("GET", feedURL, nil)
+	if err != nil {
+		return nil, validators, downloadError(feedURL, err)
+	}
+	if previous.ETag != "" {
+		req.Header.Set("If-None-Match", previous.ETag)
+	}
+	if previous.LastModified != "" {
+		req.Header.Set("If-Modified-Since", previous.LastModified)
+	}
+
+	client := &http.Client{Timeout: feedTimeout}
+	r, err := client.Do(req)
+	if err != nil {
+		return nil, validators, downloadError(feedURL, err)
+	}
+	defer r.Body.Close()
+
+	if r.StatusCode == http.StatusNotModified {
+		log.WithField("url", feedURL).Debug("feed not modified")
+		return nil, previous, ErrNotModified
+	}
+
+	validators.ETag = r.Header.Get("ETag")
+	validators.LastModified = r.Header.Get("Last-Modified")
+
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, feedMaxSize+1))
+	if err != nil {
+		return nil, validators, downloadError(feedURL, err)
+	}
+	if int64(len(body)) > feedMaxSize {
+		log.WithFields(log.Fields{"url": feedURL, "max size": feedMaxSize}).Error("feed download exceeded the maximum allowed size")
+		return nil, validators, ErrFeedTooBig
+	}
+
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return r, validators, nil
+}
+
+func downloadError(feedURL string, err error) error {
+	if isTimeout(err) {
+		log.WithError(err).WithFields(log.Fields{"url": feedURL, "timeout": feedTimeout}).Error("feed download timed out")
+		return ErrFeedTimeout
+	}
+
+	log.WithError(err).WithField("url", feedURL).Error("could not download feed")
+	return commonerr.ErrCouldNotDownload
+}
+
+func isTimeout(err error) bool {
+	if urlErr, ok := err.(*url.Error); ok {
+		err = urlErr.Err
+	}
+	netErr, ok := err.(net.Error)
+	return ok && netErr.Timeout()
+}
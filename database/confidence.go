@@ -0,0 +1,83 @@
+package database
+
+import (
+	"database/sql/driver"
+	"errors"
+	"strings"
+)
+
+// ErrFailedToParseConfidence is the error returned when a confidence could
+// not be parsed from a string.
+var ErrFailedToParseConfidence = errors.New("failed to parse Confidence from input")
+
+// Confidence is how reliably the affected versions of a vulnerability are
+// known, and thus how likely its matches are to be right.
+type Confidence string
+
+const (
+	// LowConfidence is the confidence of the vulnerabilities whose affected
+	// versions are only approximated, such as an advisory whose patched
+	// ranges can't all be expressed by a fixed version, or some of whose
+	// versions could not be parsed, and of the matches of the versions that
+	// could not be compared to the fixed one. They are to be reviewed.
+	LowConfidence Confidence = "Low"
+
+	// HighConfidence is the confidence of the vulnerabilities whose affected
+	// versions are exactly those before their fixed version. A
+	// vulnerability without a confidence has a high one.
+	HighConfidence Confidence = "High"
+)
+
+// Confidences lists all known confidences, ordered from lowest to highest.
+var Confidences = []Confidence{
+	LowConfidence,
+	HighConfidence,
+}
+
+// NewConfidence attempts to parse a string into a standard Confidence value.
+func NewConfidence(s string) (Confidence, error) {
+	for _, c := range Confidences {
+		if strings.EqualFold(s, string(c)) {
+			return c, nil
+		}
+	}
+
+	return HighConfidence, ErrFailedToParseConfidence
+}
+
+// Compare determines the order of two confidences, returning 0 if they are
+// equal, a negative number if the receiver is lower and a positive one if it
+// is higher. An empty confidence is a high one.
+func (c Confidence) Compare(c2 Confidence) int {
+	return c.index() - c2.index()
+}
+
+func (c Confidence) index() int {
+	for i, cc := range Confidences {
+		if c == cc {
+			return i
+		}
+	}
+	return len(Confidences) - 1
+}
+
+// Scan implements the database/sql.Scanner interface.
+func (c *Confidence) Scan(value interface{}) error {
+	val, ok := value.([]byte)
+	if !ok {
+		return errors.New("could not scan a Confidence from a non-string input")
+	}
+
+	var err error
+	*c, err = NewConfidence(string(val))
+	return err
+}
+
+// Value implements the database/sql/driver.Valuer interface, storing an empty
+// confidence as a high one.
+func (c Confidence) Value() (driver.Value, error) {
+	if c == "" {
+		return string(HighConfidence), nil
+	}
+	return string(c), nil
+}
@@ -0,0 +1,48 @@
+package database
+
+// InconsistencyKind identifies the cause of an Inconsistency.
+type InconsistencyKind string
+
+const (
+	// DuplicateNamespace is reported when several namespaces share a name.
+	DuplicateNamespace InconsistencyKind = "duplicate namespace"
+
+	// DuplicateFeatureVersion is reported when several feature versions share
+	// a feature and a version.
+	DuplicateFeatureVersion InconsistencyKind = "duplicate feature version"
+
+	// DuplicateVulnerability is reported when several non-deleted
+	// vulnerabilities share a namespace and a name.
+	DuplicateVulnerability InconsistencyKind = "duplicate vulnerability"
+
+	// OrphanedFeatureVersion is reported when a feature version is not part of
+	// any layer.
+	OrphanedFeatureVersion InconsistencyKind = "orphaned feature version"
+
+	// ForeignFeatureFix is reported when a vulnerability is fixed in a feature
+	// that does not belong to the vulnerability's namespace.
+	ForeignFeatureFix InconsistencyKind = "fix in a feature of another namespace"
+
+	// DanglingFix is reported when a feature version is linked to a
+	// vulnerability through a fix that belongs to another vulnerability or to
+	// another feature.
+	DanglingFix InconsistencyKind = "dangling fix"
+)
+
+// Inconsistency describes entities of the datastore that break one of its
+// invariants.
+type Inconsistency struct {
+	Kind InconsistencyKind
+
+	// Description identifies the offending entity (e.g. a namespace name).
+	Description string
+
+	// IDs are the IDs of the rows involved.
+	IDs []int
+}
+
+// Repairable returns whether RepairConsistency removes the rows involved in
+// the Inconsistency.
+func (i Inconsistency) Repairable() bool {
+	return i.Kind == OrphanedFeatureVersion || i.Kind == DanglingFix
+}
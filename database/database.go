@@ -4,6 +4,8 @@ import (
 	"errors"
 	"fmt"
 	"time"
+
+	"github.com/MXi4oyu/DockerXScan/common/commonerr"
 )
 
 var (
@@ -15,8 +17,51 @@ var (
 	// fails (i.e. when an entity which is supposed to be unique is detected
 	// twice)
 	ErrInconsistent = errors.New("database: inconsistent database")
+
+	// ErrTimeout is an error that occurs when the database backend cancelled
+	// a query because it ran for too long. It is wrapped in a BackendError.
+	ErrTimeout = errors.New("database: the query timed out")
+
+	// ErrParentMismatch is returned when a layer is inserted on top of another
+	// parent than the one it is stored with. As the features of a layer
+	// include those of its parents, the same content on top of different
+	// parents makes different layers, which must be stored under different
+	// names, such as their chain ID.
+	ErrParentMismatch = commonerr.NewBadRequestError("database: the layer is already stored on top of another parent, it must be named after its parents")
 )
 
+// VulnerabilitiesSinceOverlap is how long before the start of its previous
+// sync a client of ListVulnerabilitiesSince lists the vulnerabilities again. It
+// is longer than the transactions writing vulnerabilities are expected to last.
+const VulnerabilitiesSinceOverlap = 10 * time.Minute
+
+// BackendError is returned when the database backend failed to serve a
+// request. It matches ErrBackendException with errors.Is, and its message does
+// not include the underlying error so that no backend detail leaks to clients.
+type BackendError struct {
+	// Op describes the operation that failed.
+	Op string
+
+	Err error
+}
+
+func (e *BackendError) Error() string {
+	if e.Err == ErrTimeout {
+		return ErrTimeout.Error()
+	}
+	return ErrBackendException.Error()
+}
+
+// Is reports whether target is ErrBackendException.
+func (e *BackendError) Is(target error) bool {
+	return target == ErrBackendException
+}
+
+// Unwrap returns the underlying error.
+func (e *BackendError) Unwrap() error {
+	return e.Err
+}
+
 // RegistrableComponentConfig is a configuration block that can be used to
 // determine which registrable component should be initialized and pass custom
 // configuration to it.
@@ -25,12 +70,19 @@ type RegistrableComponentConfig struct {
 	Options map[string]interface{}
 }
 
-var drivers = make(map[string]Driver)
+var (
+	drivers    = make(map[string]Driver)
+	validators = make(map[string]Validator)
+)
 
 // Driver is a function that opens a Datastore specified by its database driver type and specific
 // configuration.
 type Driver func(RegistrableComponentConfig) (Datastore, error)
 
+// Validator is a function that returns the problems of the configuration of a
+// database driver, such as a missing option, without connecting to anything.
+type Validator func(RegistrableComponentConfig) []error
+
 // Register makes a Constructor available by the provided name.
 //
 // If this function is called twice with the same name or if the Constructor is
@@ -54,6 +106,63 @@ func Open(cfg RegistrableComponentConfig) (Datastore, error) {
 	return driver(cfg)
 }
 
+// RegisterValidator makes a Validator available for the Driver registered by
+// the provided name.
+//
+// If this function is called twice with the same name or if the Validator is
+// nil, it panics.
+func RegisterValidator(name string, validator Validator) {
+	if validator == nil {
+		panic("database: could not register nil Validator")
+	}
+	if _, dup := validators[name]; dup {
+		panic("database: could not register duplicate Validator: " + name)
+	}
+	validators[name] = validator
+}
+
+// ValidateConfig returns the problems of a configuration that Open would only
+// report when called: an unknown Driver, or the problems found by the
+// Validator of the Driver, if it has one.
+func ValidateConfig(cfg RegistrableComponentConfig) []error {
+	if _, ok := drivers[cfg.Type]; !ok {
+		return []error{fmt.Errorf("database: unknown Driver %q (forgotten configuration or import?)", cfg.Type)}
+	}
+	if validator, ok := validators[cfg.Type]; ok {
+		return validator(cfg)
+	}
+	return nil
+}
+
+// FindLayerOpts are the options of Datastore.FindLayerWithOpts, telling what
+// to load along with a layer and what to leave out of it.
+type FindLayerOpts struct {
+	// WithFeatures loads the features of the layer and of its parents.
+	WithFeatures bool
+
+	// WithVulnerabilities loads the features along with the vulnerabilities
+	// affecting them.
+	WithVulnerabilities bool
+
+	// IncludeWithdrawn also reports the vulnerabilities that have been
+	// withdrawn.
+	IncludeWithdrawn bool
+
+	// SeverityAtLeast, when set, leaves out vulnerabilities less severe. They
+	// are filtered by the datastore, and thus never loaded.
+	SeverityAtLeast Severity
+
+	// ConfidenceAtLeast, when set, leaves out vulnerabilities of a lower
+	// confidence, such as HighConfidence leaving out those whose affected
+	// versions are only approximated. Like SeverityAtLeast, it is applied by
+	// the datastore.
+	ConfidenceAtLeast Confidence
+
+	// NamespaceFilter, when not empty, leaves out the features of the other
+	// namespaces.
+	NamespaceFilter []string
+}
+
 // Datastore represents the required operations on a persistent data store for
 // a Clair deployment.
 type Datastore interface {
@@ -65,12 +174,46 @@ type Datastore interface {
 	//查询namespace
 	ListNamespaces() ([]Namespace, error)
 
+	// FindNamespace returns the namespace with the given name, or
+	// commonerr.ErrNotFound if there is none.
+	FindNamespace(name string) (Namespace, error)
+
+	// SetNamespaceEnabled enables or disables a namespace. The vulnerabilities
+	// of a disabled namespace are skipped by FindLayer and ListVulnerabilities.
+	SetNamespaceEnabled(name string, enabled bool) error
+
 	//插入layer
 	InsertLayer(Layer) error
 
 	//查询layer
 	FindLayer(name string, withFeatures, withVulnerabilities bool) (Layer, error)
 
+	// FindLayerWithWithdrawn is like FindLayer, but also reports the
+	// vulnerabilities that have been withdrawn.
+	FindLayerWithWithdrawn(name string, withFeatures, withVulnerabilities bool) (Layer, error)
+
+	// FindLayerWithOpts finds a layer and loads what the options ask for.
+	// FindLayer and FindLayerWithWithdrawn delegate to it.
+	FindLayerWithOpts(name string, opts FindLayerOpts) (Layer, error)
+
+	// FindLayers returns the layers whose digest is one of the given digests,
+	// with the name of their parent but without their features, so that the
+	// layers of an image known by its manifest are found without their names.
+	FindLayers(digests []string) ([]Layer, error)
+
+	// ListLayersAffectedBy returns the names of the layers holding a feature
+	// version affected by the vulnerability of a namespace, including the
+	// layers that inherit it from their parents, sorted by name. It returns
+	// commonerr.ErrNotFound if the vulnerability does not exist.
+	ListLayersAffectedBy(namespaceName, name string) ([]string, error)
+
+	// DiffLayerFeatures returns the feature versions of the child layer that
+	// the parent layer doesn't have, and those of the parent layer that the
+	// child layer doesn't have. The parent may be any stored layer, and an
+	// empty one is the empty layer. It returns commonerr.ErrNotFound if either
+	// layer does not exist.
+	DiffLayerFeatures(child, parent string) (added, removed []FeatureVersion, err error)
+
 	//删除layer
 	DeleteLayer(name string) error
 
@@ -80,15 +223,71 @@ type Datastore interface {
 	//插入特征版本
 	InsertFeatureVersion(fv FeatureVersion) (id int, err error)
 
+	// InsertFeatureVersions finds or creates the given FeatureVersions and
+	// their Features in batch. The returned IDs are in the order of the input.
+	InsertFeatureVersions(fvs []FeatureVersion) ([]int, error)
+
+	// ListFeatures lists the distinct FeatureVersions added by the stored
+	// layers, of a namespace or of every namespace if namespaceName is empty,
+	// by pages of limit FeatureVersions starting at page. It returns the page
+	// to list next, -1 if there is none.
+	ListFeatures(namespaceName string, limit int, page int) ([]FeatureVersion, int, error)
+
+	// FindAffectingVulnerabilities returns a copy of the given FeatureVersions
+	// with the vulnerabilities affecting them, without storing anything, so
+	// that an image can be scanned without persisting its layers.
+	FindAffectingVulnerabilities(fvs []FeatureVersion) ([]FeatureVersion, error)
+
+	// FindVulnerabilitiesForFeatures returns the vulnerabilities affecting each
+	// of the given FeatureVersions, identified by the name and version
+	// format of their namespace, their name, source name and version, in the
+	// order of the input. They are matched in a single query. Their FixedBy is
+	// the version fixing them.
+	FindVulnerabilitiesForFeatures(fvs []FeatureVersion) ([][]Vulnerability, error)
+
+	// FindVulnerabilitiesForFeature returns the vulnerabilities affecting a
+	// version of a feature of a namespace, compared with the version format of
+	// the namespace. Their FixedBy is the version fixing them.
+	FindVulnerabilitiesForFeature(namespace, feature, version string) ([]Vulnerability, error)
+
 	//列出漏洞
 	ListVulnerabilities(namespaceName string, limit int, page int) ([]Vulnerability, int, error)
 
+	// ListVulnerabilitiesSince is like ListVulnerabilities, but only lists the
+	// vulnerabilities inserted or modified after since, along with those
+	// deleted after since, with their DeletedAt time set. As a modified
+	// vulnerability is deleted and inserted again, its former version is
+	// listed deleted.
+	//
+	// The times are those of the start of the transactions writing the
+	// vulnerabilities, which commit later: a vulnerability written by an
+	// update running at since is only listed once the update is done, though
+	// with an earlier time. A client syncing periodically must thus list the
+	// vulnerabilities since the start of its previous sync less
+	// VulnerabilitiesSinceOverlap, reading some of them again.
+	ListVulnerabilitiesSince(namespaceName string, since time.Time, limit int, page int) ([]Vulnerability, int, error)
+
+	// IterateVulnerabilities calls fn with every vulnerability of a namespace,
+	// in the order of ListVulnerabilities, paging through them internally. It
+	// stops at the first error returned by fn, and returns it.
+	IterateVulnerabilities(namespaceName string, fn func(Vulnerability) error) error
+
 	//插入漏洞
 	InsertVulnerabilities(vulnerabilities []Vulnerability, createNotification bool) error
 
 	//查找漏洞
 	FindVulnerability(namespaceName, name string) (Vulnerability, error)
 
+	// FindVulnerabilityWithAffected retrieves a Vulnerability as
+	// FindVulnerability does, along with the stored feature versions it
+	// affects, all read from the same snapshot of the database.
+	FindVulnerabilityWithAffected(namespaceName, name string) (Vulnerability, error)
+
+	// FindVulnerabilityWithDeleted retrieves a Vulnerability as
+	// FindVulnerability does or, once it has been deleted, the last version of
+	// it that is still stored, with its DeletedAt time set.
+	FindVulnerabilityWithDeleted(namespaceName, name string) (Vulnerability, error)
+
 	//插入漏洞修复
 	InsertVulnerabilityFixes(vulnerabilityNamespace, vulnerabilityName string, fixes []FeatureVersion) error
 
@@ -98,23 +297,114 @@ type Datastore interface {
 	//删除漏洞修复
 	DeleteVulnerabilityFix(vulnerabilityNamespace, vulnerabilityName, featureName string) error
 
+	// FindUnreferencedVulnerabilities lists the vulnerabilities of a namespace,
+	// or of every namespace if namespaceName is empty, that affect none of the
+	// features of the stored layers. It does not modify data.
+	FindUnreferencedVulnerabilities(namespaceName string) ([]Vulnerability, error)
+
+	// PruneUnreferencedVulnerabilities deletes the vulnerabilities that
+	// FindUnreferencedVulnerabilities lists and returns how many were deleted.
+	// Those may still affect images analyzed later, until they are inserted
+	// again by their source.
+	PruneUnreferencedVulnerabilities(namespaceName string) (int, error)
+
+	// PurgeDeletedVulnerabilities removes for good the vulnerabilities deleted
+	// before a time, either by DeleteVulnerability or by being replaced by an
+	// update, and returns how many were removed. Those still referenced by a
+	// pending notification are kept until it is deleted.
+	PurgeDeletedVulnerabilities(before time.Time) (int, error)
+
 	InsertKeyValue(key, value string) error
 
 	GetKeyValue(key string) (string, error)
 
+	// SetKeyValueNS stores (or updates) the value of a key scoped to a
+	// component, which can't collide with the keys of other components.
+	SetKeyValueNS(component, key, value string) error
+
+	// GetKeyValueNS reads the value of a key scoped to a component and
+	// returns an empty string if the key doesn't exist.
+	GetKeyValueNS(component, key string) (string, error)
+
+	// SetSuppression creates or replaces the suppression of a vulnerability
+	// affecting a feature of a namespace. Its Created time is set to now.
+	SetSuppression(suppression Suppression) error
+
+	// ListSuppressions lists the suppressions of a namespace, or of every
+	// namespace if namespaceName is empty, including the expired ones so that
+	// the accepted risks can be audited.
+	ListSuppressions(namespaceName string) ([]Suppression, error)
+
+	// DeleteSuppression deletes the suppression of a vulnerability affecting
+	// a feature of a namespace, or returns commonerr.ErrNotFound.
+	DeleteSuppression(namespaceName, featureName, vulnerabilityName string) error
+
+	// RecordScan records the summary of a scan of the image of a digest by
+	// one of its tags, now. Scanning the same digest by the same tag again
+	// replaces its summary, while a tag moved to another digest is recorded
+	// apart, so that the history of a tag is kept.
+	RecordScan(digest, tag string, summary ScanSummary) error
+
+	// ListScanHistory lists the recorded scans of the images of a
+	// repository, such as "quay.io/coreos/clair", the most recent first and
+	// at most limit of them, or all of them if limit is zero.
+	ListScanHistory(repository string, limit int) ([]ScanRecord, error)
+
 	Lock(name string, owner string, duration time.Duration, renew bool) (bool, time.Time)
 
 	Unlock(name, owner string)
 
 	FindLock(name string) (string, time.Time, error)
 
-	GetAvailableNotification(renotifyInterval time.Duration) (VulnerabilityNotification, error)
+	// GetAvailableNotification returns a notification ready to be sent, that
+	// has not been sent within renotifyInterval and was created more than
+	// gracePeriod ago.
+	GetAvailableNotification(renotifyInterval, gracePeriod time.Duration) (VulnerabilityNotification, error)
+
+	// GetAvailableNotificationWithSeverity is like GetAvailableNotification,
+	// but only returns a notification whose old or new vulnerability is at
+	// least of minSeverity. The other notifications are left available.
+	GetAvailableNotificationWithSeverity(renotifyInterval, gracePeriod time.Duration, minSeverity Severity) (VulnerabilityNotification, error)
+
+	// ClaimNotifications atomically leases up to limit of the notifications
+	// that have not been sent yet to an owner for a duration, picked among
+	// the oldest, and returns them without their vulnerabilities. The claimed
+	// notifications are locked by their name, as Lock does, so that no other
+	// owner claims them until the lease is released by Unlock or expires.
+	// Those claimed by another owner at the same time are left out, so that
+	// the batch may be short, or even empty while some remain available.
+	ClaimNotifications(owner string, limit int, lease time.Duration) ([]VulnerabilityNotification, error)
 
 	GetNotification(name string, limit int, page VulnerabilityNotificationPageNumber) (VulnerabilityNotification, VulnerabilityNotificationPageNumber, error)
 
 	SetNotificationNotified(name string) error
 
+	// SetNotificationsNotified marks the named notifications as notified in a
+	// single query, for the consumers acknowledging them by batches.
+	SetNotificationsNotified(names []string) error
+
 	DeleteNotification(name string) error
 
+	// DeleteNotifications deletes the named notifications in a single query.
+	// It returns commonerr.ErrNotFound only if none of them exists.
+	DeleteNotifications(names []string) error
+
 	Ping() bool
+
+	// CheckConsistency reports the entities that break the invariants of the
+	// datastore, which usually cause ErrInconsistent. It does not modify data.
+	CheckConsistency() ([]Inconsistency, error)
+
+	// RepairConsistency removes the orphaned feature versions and the dangling
+	// fixes, and returns the number of removed rows.
+	RepairConsistency() (int, error)
+
+	// TableStats returns the size of the tables holding the analyses and the
+	// vulnerabilities, sorted by name.
+	TableStats() ([]TableStats, error)
+
+	// Vacuum reclaims the space of the dead rows of the tables of TableStats
+	// and refreshes their statistics. With full, the tables are compacted,
+	// which locks each of them exclusively while it is rewritten.
+	Vacuum(full bool) error
 }
\ No newline at end of file
@@ -0,0 +1,44 @@
+package database
+
+import "encoding/json"
+
+// ExploitMetadataKey is the key of the metadata of the vulnerabilities under
+// which their Exploitation is stored.
+const ExploitMetadataKey = "Exploit"
+
+// Exploitation tells how likely a vulnerability is to be exploited, such as
+// the CISA catalog of the Known Exploited Vulnerabilities and the Exploit
+// Prediction Scoring System of FIRST tell.
+type Exploitation struct {
+	// KnownExploited is set when the vulnerability is known to be exploited
+	// in the wild.
+	KnownExploited bool
+
+	// EPSSScore is the probability, between 0 and 1, that the vulnerability
+	// is exploited in the next 30 days, zero when unknown.
+	EPSSScore float64
+}
+
+// Exploitation returns the Exploitation of the vulnerability found in its
+// metadata, the zero one when it has none.
+func (v Vulnerability) Exploitation() Exploitation {
+	return ExploitationFromMetadata(v.Metadata)
+}
+
+// ExploitationFromMetadata returns the Exploitation found in the metadata of
+// a vulnerability, either as added by its Appender or as read back from the
+// database.
+func ExploitationFromMetadata(metadata map[string]interface{}) Exploitation {
+	var e Exploitation
+	switch m := metadata[ExploitMetadataKey].(type) {
+	case nil:
+	case Exploitation:
+		e = m
+	default:
+		data, err := json.Marshal(m)
+		if err == nil {
+			json.Unmarshal(data, &e)
+		}
+	}
+	return e
+}
@@ -0,0 +1,21 @@
+package database
+
+import (
+	"strings"
+
+	"github.com/MXi4oyu/DockerXScan/common/commonerr"
+)
+
+// ErrInvalidComponent is returned when a namespaced key is requested for an
+// empty component or one containing the separator.
+var ErrInvalidComponent = commonerr.NewBadRequestError("database: a key component must be non-empty and must not contain ':'")
+
+// NamespacedKey returns the key under which the key of a component is stored,
+// so that the keys of different components never collide.
+func NamespacedKey(component, key string) (string, error) {
+	if component == "" || strings.Contains(component, ":") {
+		return "", ErrInvalidComponent
+	}
+
+	return component + ":" + key, nil
+}
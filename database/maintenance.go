@@ -0,0 +1,24 @@
+package database
+
+// TableStats describes the size of a table of the datastore, as estimated by
+// the statistics of the database.
+type TableStats struct {
+	Name string
+
+	// Size is the size of the table on disk in bytes, including its indexes.
+	Size int64
+
+	// LiveRows and DeadRows are the estimated numbers of rows that are
+	// visible and of those deleted or updated but not yet reclaimed.
+	LiveRows int64
+	DeadRows int64
+}
+
+// Bloat returns the estimated fraction of the rows of the table that are dead,
+// between 0 and 1.
+func (s TableStats) Bloat() float64 {
+	if s.LiveRows+s.DeadRows <= 0 {
+		return 0
+	}
+	return float64(s.DeadRows) / float64(s.LiveRows+s.DeadRows)
+}
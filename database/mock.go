@@ -19,27 +19,73 @@ import "time"
 // MockDatastore implements Datastore and enables overriding each available method.
 // The default behavior of each method is to simply panic.
 type MockDatastore struct {
-	FctListNamespaces           func() ([]Namespace, error)
-	FctInsertLayer              func(Layer) error
-	FctFindLayer                func(name string, withFeatures, withVulnerabilities bool) (Layer, error)
-	FctDeleteLayer              func(name string) error
-	FctListVulnerabilities      func(namespaceName string, limit int, page int) ([]Vulnerability, int, error)
-	FctInsertVulnerabilities    func(vulnerabilities []Vulnerability, createNotification bool) error
-	FctFindVulnerability        func(namespaceName, name string) (Vulnerability, error)
-	FctDeleteVulnerability      func(namespaceName, name string) error
-	FctInsertVulnerabilityFixes func(vulnerabilityNamespace, vulnerabilityName string, fixes []FeatureVersion) error
-	FctDeleteVulnerabilityFix   func(vulnerabilityNamespace, vulnerabilityName, featureName string) error
-	FctGetAvailableNotification func(renotifyInterval time.Duration) (VulnerabilityNotification, error)
-	FctGetNotification          func(name string, limit int, page VulnerabilityNotificationPageNumber) (VulnerabilityNotification, VulnerabilityNotificationPageNumber, error)
-	FctSetNotificationNotified  func(name string) error
-	FctDeleteNotification       func(name string) error
-	FctInsertKeyValue           func(key, value string) error
-	FctGetKeyValue              func(key string) (string, error)
-	FctLock                     func(name string, owner string, duration time.Duration, renew bool) (bool, time.Time)
-	FctUnlock                   func(name, owner string)
-	FctFindLock                 func(name string) (string, time.Time, error)
-	FctPing                     func() bool
-	FctClose                    func()
+	FctInsertNamespace                      func(namespace Namespace) (int, error)
+	FctListNamespaces                       func() ([]Namespace, error)
+	FctFindNamespace                        func(name string) (Namespace, error)
+	FctSetNamespaceEnabled                  func(name string, enabled bool) error
+	FctInsertLayer                          func(Layer) error
+	FctFindLayer                            func(name string, withFeatures, withVulnerabilities bool) (Layer, error)
+	FctFindLayerWithWithdrawn               func(name string, withFeatures, withVulnerabilities bool) (Layer, error)
+	FctFindLayerWithOpts                    func(name string, opts FindLayerOpts) (Layer, error)
+	FctFindLayers                           func(digests []string) ([]Layer, error)
+	FctListLayersAffectedBy                 func(namespaceName, name string) ([]string, error)
+	FctDiffLayerFeatures                    func(child, parent string) (added, removed []FeatureVersion, err error)
+	FctDeleteLayer                          func(name string) error
+	FctInsertFeature                        func(feature Feature) (int, error)
+	FctInsertFeatureVersion                 func(fv FeatureVersion) (int, error)
+	FctInsertFeatureVersions                func(fvs []FeatureVersion) ([]int, error)
+	FctListFeatures                         func(namespaceName string, limit int, page int) ([]FeatureVersion, int, error)
+	FctFindAffectingVulnerabilities         func(fvs []FeatureVersion) ([]FeatureVersion, error)
+	FctFindVulnerabilitiesForFeatures       func(fvs []FeatureVersion) ([][]Vulnerability, error)
+	FctFindVulnerabilitiesForFeature        func(namespace, feature, version string) ([]Vulnerability, error)
+	FctListVulnerabilities                  func(namespaceName string, limit int, page int) ([]Vulnerability, int, error)
+	FctListVulnerabilitiesSince             func(namespaceName string, since time.Time, limit int, page int) ([]Vulnerability, int, error)
+	FctIterateVulnerabilities               func(namespaceName string, fn func(Vulnerability) error) error
+	FctInsertVulnerabilities                func(vulnerabilities []Vulnerability, createNotification bool) error
+	FctFindVulnerability                    func(namespaceName, name string) (Vulnerability, error)
+	FctDeleteVulnerability                  func(namespaceName, name string) error
+	FctFindVulnerabilityWithAffected        func(namespaceName, name string) (Vulnerability, error)
+	FctFindVulnerabilityWithDeleted         func(namespaceName, name string) (Vulnerability, error)
+	FctInsertVulnerabilityFixes             func(vulnerabilityNamespace, vulnerabilityName string, fixes []FeatureVersion) error
+	FctDeleteVulnerabilityFix               func(vulnerabilityNamespace, vulnerabilityName, featureName string) error
+	FctFindUnreferencedVulnerabilities      func(namespaceName string) ([]Vulnerability, error)
+	FctPruneUnreferencedVulnerabilities     func(namespaceName string) (int, error)
+	FctPurgeDeletedVulnerabilities          func(before time.Time) (int, error)
+	FctGetAvailableNotification             func(renotifyInterval, gracePeriod time.Duration) (VulnerabilityNotification, error)
+	FctClaimNotifications                   func(owner string, limit int, lease time.Duration) ([]VulnerabilityNotification, error)
+	FctGetAvailableNotificationWithSeverity func(renotifyInterval, gracePeriod time.Duration, minSeverity Severity) (VulnerabilityNotification, error)
+	FctGetNotification                      func(name string, limit int, page VulnerabilityNotificationPageNumber) (VulnerabilityNotification, VulnerabilityNotificationPageNumber, error)
+	FctSetNotificationNotified              func(name string) error
+	FctDeleteNotification                   func(name string) error
+	FctSetNotificationsNotified             func(names []string) error
+	FctDeleteNotifications                  func(names []string) error
+	FctInsertKeyValue                       func(key, value string) error
+	FctGetKeyValue                          func(key string) (string, error)
+	FctSetKeyValueNS                        func(component, key, value string) error
+	FctGetKeyValueNS                        func(component, key string) (string, error)
+	FctSetSuppression                       func(suppression Suppression) error
+	FctListSuppressions                     func(namespaceName string) ([]Suppression, error)
+	FctDeleteSuppression                    func(namespaceName, featureName, vulnerabilityName string) error
+	FctRecordScan                           func(digest, tag string, summary ScanSummary) error
+	FctListScanHistory                      func(repository string, limit int) ([]ScanRecord, error)
+	FctLock                                 func(name string, owner string, duration time.Duration, renew bool) (bool, time.Time)
+	FctUnlock                               func(name, owner string)
+	FctFindLock                             func(name string) (string, time.Time, error)
+	FctPing                                 func() bool
+	FctCheckConsistency                     func() ([]Inconsistency, error)
+	FctRepairConsistency                    func() (int, error)
+	FctTableStats                           func() ([]TableStats, error)
+	FctVacuum                               func(full bool) error
+	FctClose                                func()
+}
+
+var _ Datastore = &MockDatastore{}
+
+func (mds *MockDatastore) InsertNamespace(namespace Namespace) (int, error) {
+	if mds.FctInsertNamespace != nil {
+		return mds.FctInsertNamespace(namespace)
+	}
+	panic("required mock function not implemented")
 }
 
 func (mds *MockDatastore) ListNamespaces() ([]Namespace, error) {
@@ -49,6 +95,20 @@ func (mds *MockDatastore) ListNamespaces() ([]Namespace, error) {
 	panic("required mock function not implemented")
 }
 
+func (mds *MockDatastore) FindNamespace(name string) (Namespace, error) {
+	if mds.FctFindNamespace != nil {
+		return mds.FctFindNamespace(name)
+	}
+	panic("required mock function not implemented")
+}
+
+func (mds *MockDatastore) SetNamespaceEnabled(name string, enabled bool) error {
+	if mds.FctSetNamespaceEnabled != nil {
+		return mds.FctSetNamespaceEnabled(name, enabled)
+	}
+	panic("required mock function not implemented")
+}
+
 func (mds *MockDatastore) InsertLayer(layer Layer) error {
 	if mds.FctInsertLayer != nil {
 		return mds.FctInsertLayer(layer)
@@ -63,6 +123,41 @@ func (mds *MockDatastore) FindLayer(name string, withFeatures, withVulnerabiliti
 	panic("required mock function not implemented")
 }
 
+func (mds *MockDatastore) FindLayerWithWithdrawn(name string, withFeatures, withVulnerabilities bool) (Layer, error) {
+	if mds.FctFindLayerWithWithdrawn != nil {
+		return mds.FctFindLayerWithWithdrawn(name, withFeatures, withVulnerabilities)
+	}
+	panic("required mock function not implemented")
+}
+
+func (mds *MockDatastore) FindLayerWithOpts(name string, opts FindLayerOpts) (Layer, error) {
+	if mds.FctFindLayerWithOpts != nil {
+		return mds.FctFindLayerWithOpts(name, opts)
+	}
+	panic("required mock function not implemented")
+}
+
+func (mds *MockDatastore) FindLayers(digests []string) ([]Layer, error) {
+	if mds.FctFindLayers != nil {
+		return mds.FctFindLayers(digests)
+	}
+	panic("required mock function not implemented")
+}
+
+func (mds *MockDatastore) ListLayersAffectedBy(namespaceName, name string) ([]string, error) {
+	if mds.FctListLayersAffectedBy != nil {
+		return mds.FctListLayersAffectedBy(namespaceName, name)
+	}
+	panic("required mock function not implemented")
+}
+
+func (mds *MockDatastore) DiffLayerFeatures(child, parent string) (added, removed []FeatureVersion, err error) {
+	if mds.FctDiffLayerFeatures != nil {
+		return mds.FctDiffLayerFeatures(child, parent)
+	}
+	panic("required mock function not implemented")
+}
+
 func (mds *MockDatastore) DeleteLayer(name string) error {
 	if mds.FctDeleteLayer != nil {
 		return mds.FctDeleteLayer(name)
@@ -70,6 +165,55 @@ func (mds *MockDatastore) DeleteLayer(name string) error {
 	panic("required mock function not implemented")
 }
 
+func (mds *MockDatastore) InsertFeature(feature Feature) (int, error) {
+	if mds.FctInsertFeature != nil {
+		return mds.FctInsertFeature(feature)
+	}
+	panic("required mock function not implemented")
+}
+
+func (mds *MockDatastore) InsertFeatureVersion(fv FeatureVersion) (int, error) {
+	if mds.FctInsertFeatureVersion != nil {
+		return mds.FctInsertFeatureVersion(fv)
+	}
+	panic("required mock function not implemented")
+}
+
+func (mds *MockDatastore) InsertFeatureVersions(fvs []FeatureVersion) ([]int, error) {
+	if mds.FctInsertFeatureVersions != nil {
+		return mds.FctInsertFeatureVersions(fvs)
+	}
+	panic("required mock function not implemented")
+}
+
+func (mds *MockDatastore) ListFeatures(namespaceName string, limit int, page int) ([]FeatureVersion, int, error) {
+	if mds.FctListFeatures != nil {
+		return mds.FctListFeatures(namespaceName, limit, page)
+	}
+	panic("required mock function not implemented")
+}
+
+func (mds *MockDatastore) FindAffectingVulnerabilities(fvs []FeatureVersion) ([]FeatureVersion, error) {
+	if mds.FctFindAffectingVulnerabilities != nil {
+		return mds.FctFindAffectingVulnerabilities(fvs)
+	}
+	panic("required mock function not implemented")
+}
+
+func (mds *MockDatastore) FindVulnerabilitiesForFeatures(fvs []FeatureVersion) ([][]Vulnerability, error) {
+	if mds.FctFindVulnerabilitiesForFeatures != nil {
+		return mds.FctFindVulnerabilitiesForFeatures(fvs)
+	}
+	panic("required mock function not implemented")
+}
+
+func (mds *MockDatastore) FindVulnerabilitiesForFeature(namespace, feature, version string) ([]Vulnerability, error) {
+	if mds.FctFindVulnerabilitiesForFeature != nil {
+		return mds.FctFindVulnerabilitiesForFeature(namespace, feature, version)
+	}
+	panic("required mock function not implemented")
+}
+
 func (mds *MockDatastore) ListVulnerabilities(namespaceName string, limit int, page int) ([]Vulnerability, int, error) {
 	if mds.FctListVulnerabilities != nil {
 		return mds.FctListVulnerabilities(namespaceName, limit, page)
@@ -77,6 +221,20 @@ func (mds *MockDatastore) ListVulnerabilities(namespaceName string, limit int, p
 	panic("required mock function not implemented")
 }
 
+func (mds *MockDatastore) IterateVulnerabilities(namespaceName string, fn func(Vulnerability) error) error {
+	if mds.FctIterateVulnerabilities != nil {
+		return mds.FctIterateVulnerabilities(namespaceName, fn)
+	}
+	panic("required mock function not implemented")
+}
+
+func (mds *MockDatastore) ListVulnerabilitiesSince(namespaceName string, since time.Time, limit int, page int) ([]Vulnerability, int, error) {
+	if mds.FctListVulnerabilitiesSince != nil {
+		return mds.FctListVulnerabilitiesSince(namespaceName, since, limit, page)
+	}
+	panic("required mock function not implemented")
+}
+
 func (mds *MockDatastore) InsertVulnerabilities(vulnerabilities []Vulnerability, createNotification bool) error {
 	if mds.FctInsertVulnerabilities != nil {
 		return mds.FctInsertVulnerabilities(vulnerabilities, createNotification)
@@ -91,6 +249,20 @@ func (mds *MockDatastore) FindVulnerability(namespaceName, name string) (Vulnera
 	panic("required mock function not implemented")
 }
 
+func (mds *MockDatastore) FindVulnerabilityWithAffected(namespaceName, name string) (Vulnerability, error) {
+	if mds.FctFindVulnerabilityWithAffected != nil {
+		return mds.FctFindVulnerabilityWithAffected(namespaceName, name)
+	}
+	panic("required mock function not implemented")
+}
+
+func (mds *MockDatastore) FindVulnerabilityWithDeleted(namespaceName, name string) (Vulnerability, error) {
+	if mds.FctFindVulnerabilityWithDeleted != nil {
+		return mds.FctFindVulnerabilityWithDeleted(namespaceName, name)
+	}
+	panic("required mock function not implemented")
+}
+
 func (mds *MockDatastore) DeleteVulnerability(namespaceName, name string) error {
 	if mds.FctDeleteVulnerability != nil {
 		return mds.FctDeleteVulnerability(namespaceName, name)
@@ -112,9 +284,44 @@ func (mds *MockDatastore) DeleteVulnerabilityFix(vulnerabilityNamespace, vulnera
 	panic("required mock function not implemented")
 }
 
-func (mds *MockDatastore) GetAvailableNotification(renotifyInterval time.Duration) (VulnerabilityNotification, error) {
+func (mds *MockDatastore) FindUnreferencedVulnerabilities(namespaceName string) ([]Vulnerability, error) {
+	if mds.FctFindUnreferencedVulnerabilities != nil {
+		return mds.FctFindUnreferencedVulnerabilities(namespaceName)
+	}
+	panic("required mock function not implemented")
+}
+
+func (mds *MockDatastore) PruneUnreferencedVulnerabilities(namespaceName string) (int, error) {
+	if mds.FctPruneUnreferencedVulnerabilities != nil {
+		return mds.FctPruneUnreferencedVulnerabilities(namespaceName)
+	}
+	panic("required mock function not implemented")
+}
+
+func (mds *MockDatastore) PurgeDeletedVulnerabilities(before time.Time) (int, error) {
+	if mds.FctPurgeDeletedVulnerabilities != nil {
+		return mds.FctPurgeDeletedVulnerabilities(before)
+	}
+	panic("required mock function not implemented")
+}
+
+func (mds *MockDatastore) GetAvailableNotification(renotifyInterval, gracePeriod time.Duration) (VulnerabilityNotification, error) {
 	if mds.FctGetAvailableNotification != nil {
-		return mds.FctGetAvailableNotification(renotifyInterval)
+		return mds.FctGetAvailableNotification(renotifyInterval, gracePeriod)
+	}
+	panic("required mock function not implemented")
+}
+
+func (mds *MockDatastore) GetAvailableNotificationWithSeverity(renotifyInterval, gracePeriod time.Duration, minSeverity Severity) (VulnerabilityNotification, error) {
+	if mds.FctGetAvailableNotificationWithSeverity != nil {
+		return mds.FctGetAvailableNotificationWithSeverity(renotifyInterval, gracePeriod, minSeverity)
+	}
+	panic("required mock function not implemented")
+}
+
+func (mds *MockDatastore) ClaimNotifications(owner string, limit int, lease time.Duration) ([]VulnerabilityNotification, error) {
+	if mds.FctClaimNotifications != nil {
+		return mds.FctClaimNotifications(owner, limit, lease)
 	}
 	panic("required mock function not implemented")
 }
@@ -139,6 +346,20 @@ func (mds *MockDatastore) DeleteNotification(name string) error {
 	}
 	panic("required mock function not implemented")
 }
+
+func (mds *MockDatastore) SetNotificationsNotified(names []string) error {
+	if mds.FctSetNotificationsNotified != nil {
+		return mds.FctSetNotificationsNotified(names)
+	}
+	panic("required mock function not implemented")
+}
+
+func (mds *MockDatastore) DeleteNotifications(names []string) error {
+	if mds.FctDeleteNotifications != nil {
+		return mds.FctDeleteNotifications(names)
+	}
+	panic("required mock function not implemented")
+}
 func (mds *MockDatastore) InsertKeyValue(key, value string) error {
 	if mds.FctInsertKeyValue != nil {
 		return mds.FctInsertKeyValue(key, value)
@@ -153,6 +374,20 @@ func (mds *MockDatastore) GetKeyValue(key string) (string, error) {
 	panic("required mock function not implemented")
 }
 
+func (mds *MockDatastore) SetKeyValueNS(component, key, value string) error {
+	if mds.FctSetKeyValueNS != nil {
+		return mds.FctSetKeyValueNS(component, key, value)
+	}
+	panic("required mock function not implemented")
+}
+
+func (mds *MockDatastore) GetKeyValueNS(component, key string) (string, error) {
+	if mds.FctGetKeyValueNS != nil {
+		return mds.FctGetKeyValueNS(component, key)
+	}
+	panic("required mock function not implemented")
+}
+
 func (mds *MockDatastore) Lock(name string, owner string, duration time.Duration, renew bool) (bool, time.Time) {
 	if mds.FctLock != nil {
 		return mds.FctLock(name, owner, duration, renew)
@@ -189,3 +424,66 @@ func (mds *MockDatastore) Close() {
 	}
 	panic("required mock function not implemented")
 }
+
+func (mds *MockDatastore) SetSuppression(suppression Suppression) error {
+	if mds.FctSetSuppression != nil {
+		return mds.FctSetSuppression(suppression)
+	}
+	panic("required mock function not implemented")
+}
+
+func (mds *MockDatastore) ListSuppressions(namespaceName string) ([]Suppression, error) {
+	if mds.FctListSuppressions != nil {
+		return mds.FctListSuppressions(namespaceName)
+	}
+	panic("required mock function not implemented")
+}
+
+func (mds *MockDatastore) DeleteSuppression(namespaceName, featureName, vulnerabilityName string) error {
+	if mds.FctDeleteSuppression != nil {
+		return mds.FctDeleteSuppression(namespaceName, featureName, vulnerabilityName)
+	}
+	panic("required mock function not implemented")
+}
+
+func (mds *MockDatastore) RecordScan(digest, tag string, summary ScanSummary) error {
+	if mds.FctRecordScan != nil {
+		return mds.FctRecordScan(digest, tag, summary)
+	}
+	panic("required mock function not implemented")
+}
+
+func (mds *MockDatastore) ListScanHistory(repository string, limit int) ([]ScanRecord, error) {
+	if mds.FctListScanHistory != nil {
+		return mds.FctListScanHistory(repository, limit)
+	}
+	panic("required mock function not implemented")
+}
+
+func (mds *MockDatastore) CheckConsistency() ([]Inconsistency, error) {
+	if mds.FctCheckConsistency != nil {
+		return mds.FctCheckConsistency()
+	}
+	panic("required mock function not implemented")
+}
+
+func (mds *MockDatastore) RepairConsistency() (int, error) {
+	if mds.FctRepairConsistency != nil {
+		return mds.FctRepairConsistency()
+	}
+	panic("required mock function not implemented")
+}
+
+func (mds *MockDatastore) TableStats() ([]TableStats, error) {
+	if mds.FctTableStats != nil {
+		return mds.FctTableStats()
+	}
+	panic("required mock function not implemented")
+}
+
+func (mds *MockDatastore) Vacuum(full bool) error {
+	if mds.FctVacuum != nil {
+		return mds.FctVacuum(full)
+	}
+	panic("required mock function not implemented")
+}
@@ -19,6 +19,10 @@ type Layer struct {
 	Parent        *Layer
 	Namespace     *Namespace
 	Features      []FeatureVersion
+
+	// Digest is the verified digest of the content of the layer, if it was
+	// submitted with one.
+	Digest string
 }
 
 type Namespace struct {
@@ -26,13 +30,71 @@ type Namespace struct {
 
 	Name          string
 	VersionFormat string
+
+	// Disabled namespaces are kept, but their vulnerabilities are not
+	// reported.
+	Disabled bool
+
+	// DataVersion is incremented whenever a vulnerability of the namespace
+	// is inserted, updated or deleted.
+	DataVersion int
+
+	// Kind is stored when the namespace is inserted, a namespace without a
+	// kind being inserted as a DistroNamespace.
+	Kind NamespaceKind
+}
+
+// NamespaceKind is the kind of ecosystem a Namespace holds the packages of.
+type NamespaceKind string
+
+const (
+	// DistroNamespace is a release of an OS distribution, such as "debian:10".
+	DistroNamespace NamespaceKind = "distro"
+
+	// LanguageNamespace is the package registry of a language, such as
+	// "cargo".
+	LanguageNamespace NamespaceKind = "language"
+
+	// RuntimeNamespace is a runtime that applications are deployed on, such
+	// as a JVM or an application server.
+	RuntimeNamespace NamespaceKind = "runtime"
+)
+
+// Valid returns whether the kind is one of the kinds of namespaces.
+func (k NamespaceKind) Valid() bool {
+	switch k {
+	case DistroNamespace, LanguageNamespace, RuntimeNamespace:
+		return true
+	}
+	return false
 }
 
+// FeatureKind is the kind of component a Feature is, which tells the
+// ecosystem it comes from.
+type FeatureKind string
+
+const (
+	// OSFeature is a package of the distribution of an image.
+	OSFeature FeatureKind = "os"
+
+	// ApplicationFeature is a dependency installed by the package manager of
+	// a language or an environment, such as conda.
+	ApplicationFeature FeatureKind = "application"
+
+	// BinaryFeature is a component found in a binary rather than in a
+	// package database.
+	BinaryFeature FeatureKind = "binary"
+)
+
 type Feature struct {
 	Model
 
 	Name      string
 	Namespace Namespace
+
+	// Kind is set by the lister that detected the Feature. It is empty for
+	// the features only known from the vulnerabilities fixed in them.
+	Kind FeatureKind
 }
 
 type FeatureVersion struct {
@@ -42,8 +104,22 @@ type FeatureVersion struct {
 	Version    string
 	AffectedBy []Vulnerability
 
+	// SourceName is the name of the source package the feature was built
+	// from, when it differs from the name of the feature itself.
+	SourceName string
+
 	// For output purposes. Only make sense when the feature version is in the context of an image.
 	AddedBy Layer
+
+	// Root is the directory of the layer holding the system in which the
+	// feature version has been found, such as "opt/rootfs", when it is not
+	// the root of the image. Like AddedBy, it is stored by layer.
+	Root string
+
+	// Location is the path of the file in which the feature version has been
+	// found, from the root of the image, such as "var/lib/dpkg/status" or the
+	// path of a binary embedding a crate. Like AddedBy, it is stored by layer.
+	Location string
 }
 
 type Vulnerability struct {
@@ -58,14 +134,53 @@ type Vulnerability struct {
 
 	Metadata MetadataMap
 
+	// Withdrawn is set when the vulnerability has been rejected or disputed
+	// upstream. Withdrawn vulnerabilities are kept, but are not reported by
+	// FindLayer.
+	Withdrawn bool
+
+	// Confidence is how reliably the affected versions of the vulnerability
+	// are known, set to LowConfidence by the updaters that can only
+	// approximate them.
+	Confidence Confidence
+
+	// PublishedDate is when the vulnerability was disclosed, according to the
+	// feed it comes from, or else its DiscoveredDate.
+	PublishedDate time.Time
+
+	// DiscoveredDate is when the vulnerability was first inserted.
+	DiscoveredDate time.Time
+
+	// UpdatedAt is when the vulnerability was last inserted or modified. It
+	// is only set by ListVulnerabilitiesSince.
+	UpdatedAt time.Time
+
+	// DeletedAt is when the vulnerability was deleted, zero while it is not.
+	// It is only set by FindVulnerabilityWithDeleted.
+	DeletedAt time.Time
+
 	FixedIn                        []FeatureVersion
 	LayersIntroducingVulnerability []Layer
 
+	// Affected are the stored feature versions affected by the vulnerability.
+	// It is only set by FindVulnerabilityWithAffected.
+	Affected []AffectedFeatureVersion
+
 	// For output purposes. Only make sense when the vulnerability
 	// is already about a specific Feature/FeatureVersion.
 	FixedBy string `json:",omitempty"`
 }
 
+// AffectedFeatureVersion is a stored feature version affected by a
+// vulnerability.
+type AffectedFeatureVersion struct {
+	FeatureVersion
+
+	// FixedBy is the version of the feature fixing the vulnerability, or
+	// versionfmt.MaxVersion if none does.
+	FixedBy string
+}
+
 type MetadataMap map[string]interface{}
 
 func (mm *MetadataMap) Scan(value interface{}) error {
@@ -0,0 +1,128 @@
+package pgsql
+
+import (
+	"time"
+
+	"github.com/lib/pq"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/MXi4oyu/DockerXScan/database"
+)
+
+// consistencyChecks associates each kind of inconsistency with the query that
+// finds it. Each query returns a description and the IDs of the rows involved.
+var consistencyChecks = []struct {
+	kind  database.InconsistencyKind
+	name  string
+	query string
+}{
+	{database.DuplicateNamespace, "searchDuplicateNamespace", searchDuplicateNamespace},
+	{database.DuplicateFeatureVersion, "searchDuplicateFeatureVersion", searchDuplicateFeatureVersion},
+	{database.DuplicateVulnerability, "searchDuplicateVulnerability", searchDuplicateVulnerability},
+	{database.OrphanedFeatureVersion, "searchOrphanedFeatureVersion", searchOrphanedFeatureVersion},
+	{database.ForeignFeatureFix, "searchForeignFeatureFix", searchForeignFeatureFix},
+	{database.DanglingFix, "searchDanglingFix", searchDanglingFix},
+}
+
+func (pgSQL *pgSQL) CheckConsistency() ([]database.Inconsistency, error) {
+	defer observeQueryTime("CheckConsistency", "all", time.Now())
+
+	var inconsistencies []database.Inconsistency
+	for _, check := range consistencyChecks {
+		t := time.Now()
+		rows, err := pgSQL.Query(check.query)
+		observeQueryTime("CheckConsistency", check.name, t)
+
+		if err != nil {
+			return nil, handleError(check.name, err)
+		}
+
+		for rows.Next() {
+			var description string
+			var ids []int64
+			if err := rows.Scan(&description, pq.Array(&ids)); err != nil {
+				rows.Close()
+				return nil, handleError(check.name+".Scan()", err)
+			}
+
+			inconsistency := database.Inconsistency{Kind: check.kind, Description: description}
+			for _, id := range ids {
+				inconsistency.IDs = append(inconsistency.IDs, int(id))
+			}
+			inconsistencies = append(inconsistencies, inconsistency)
+		}
+		if err := rows.Err(); err != nil {
+			rows.Close()
+			return nil, handleError(check.name+".Rows()", err)
+		}
+		rows.Close()
+	}
+
+	return inconsistencies, nil
+}
+
+// RepairConsistency removes the orphaned feature versions and the dangling
+// fixes. It should not run while layers are being analyzed, as their feature
+// versions are inserted before being attached to the layer.
+func (pgSQL *pgSQL) RepairConsistency() (int, error) {
+	defer observeQueryTime("RepairConsistency", "all", time.Now())
+
+	// Begin transaction.
+	tx, err := pgSQL.Begin()
+	if err != nil {
+		tx.Rollback()
+		return 0, handleError("RepairConsistency.Begin()", err)
+	}
+
+	// Batch operations may wait long for their locks.
+	if err = pgSQL.allowLongTransaction(tx); err != nil {
+		tx.Rollback()
+		return 0, handleError("RepairConsistency.allowLongTransaction", err)
+	}
+
+	// Lock Vulnerability_Affects_FeatureVersion exclusively.
+	// We want to prevent InsertFeatureVersion and InsertVulnerability to modify it.
+	promConcurrentLockVAFV.Inc()
+	defer promConcurrentLockVAFV.Dec()
+	_, err = tx.Exec(lockVulnerabilityAffects)
+	if err != nil {
+		tx.Rollback()
+		return 0, handleError("RepairConsistency.lockVulnerabilityAffects", err)
+	}
+
+	var removed int64
+	for _, q := range []struct{ name, query string }{
+		{"removeDanglingFix", removeDanglingFix},
+		{"removeOrphanedFeatureVersionAffects", removeOrphanedFeatureVersionAffects},
+		{"removeOrphanedFeatureVersion", removeOrphanedFeatureVersion},
+	} {
+		result, err := tx.Exec(q.query)
+		if err != nil {
+			tx.Rollback()
+			return 0, handleError(q.name, err)
+		}
+
+		affected, err := result.RowsAffected()
+		if err != nil {
+			tx.Rollback()
+			return 0, handleError(q.name+".RowsAffected()", err)
+		}
+		removed += affected
+	}
+
+	// Commit transaction.
+	err = tx.Commit()
+	if err != nil {
+		tx.Rollback()
+		return 0, handleError("RepairConsistency.Commit()", err)
+	}
+
+	// The cache may reference removed feature versions.
+	if pgSQL.cache != nil {
+		pgSQL.cache.Purge()
+	}
+
+	log.WithField("removed rows", removed).Info("repaired database consistency")
+
+	return int(removed), nil
+}
@@ -5,8 +5,13 @@ import (
 	"github.com/MXi4oyu/DockerXScan/common/commonerr"
 	"github.com/MXi4oyu/DockerXScan/versionfmt"
 	"database/sql"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
+
+	"github.com/lib/pq"
+	log "github.com/sirupsen/logrus"
 )
 
 func (pgSQL *pgSQL) InsertFeature(feature database.Feature) (int, error) {
@@ -35,7 +40,7 @@ func (pgSQL *pgSQL) InsertFeature(feature database.Feature) (int, error) {
 
 	// Find or create Feature.
 	var id int
-	err = pgSQL.QueryRow(soiFeature, feature.Name, namespaceID).Scan(&id)
+	err = pgSQL.QueryRow(soiFeature, feature.Name, namespaceID, string(feature.Kind)).Scan(&id)
 	if err != nil {
 		return 0, handleError("soiFeature", err)
 	}
@@ -64,6 +69,16 @@ func (pgSQL *pgSQL) InsertFeatureVersion(fv database.FeatureVersion) (id int, er
 		}
 	}
 
+	// Share the insertion with the concurrent calls inserting the same FeatureVersion.
+	if pgSQL.inserts != nil {
+		c, owner := pgSQL.inserts.join(cacheIndex)
+		if !owner {
+			<-c.done
+			return c.id, c.err
+		}
+		defer func() { pgSQL.inserts.finish(cacheIndex, c, id, err) }()
+	}
+
 	// We do `defer observeQueryTime` here because we don't want to observe cached featureversions.
 	defer observeQueryTime("insertFeatureVersion", "all", time.Now())
 
@@ -118,7 +133,7 @@ func (pgSQL *pgSQL) InsertFeatureVersion(fv database.FeatureVersion) (id int, er
 	var created bool
 
 	t = time.Now()
-	err = tx.QueryRow(soiFeatureVersion, featureID, fv.Version).Scan(&created, &fv.ID)
+	err = tx.QueryRow(soiFeatureVersion, featureID, fv.Version, fv.SourceName).Scan(&created, &fv.ID)
 	observeQueryTime("insertFeatureVersion", "soiFeatureVersion", t)
 
 	if err != nil {
@@ -162,25 +177,294 @@ func (pgSQL *pgSQL) InsertFeatureVersion(fv database.FeatureVersion) (id int, er
 	return fv.ID, nil
 }
 
-// TODO(Quentin-M): Batch me
 func (pgSQL *pgSQL) insertFeatureVersions(featureVersions []database.FeatureVersion) ([]int, error) {
-	IDs := make([]int, 0, len(featureVersions))
+	return pgSQL.InsertFeatureVersions(featureVersions)
+}
+
+// InsertFeatureVersions finds or creates every given FeatureVersion using one
+// statement for their Features and one for the FeatureVersions themselves.
+func (pgSQL *pgSQL) InsertFeatureVersions(featureVersions []database.FeatureVersion) ([]int, error) {
+	IDs := make([]int, len(featureVersions))
+	if len(featureVersions) == 0 {
+		return IDs, nil
+	}
+
+	// Validate the input and do cache lookups.
+	cacheIndexes := make([]string, len(featureVersions))
+	var missing []int
+	for i, fv := range featureVersions {
+		if fv.Feature.Name == "" {
+			return nil, commonerr.NewBadRequestError("could not find/insert invalid Feature")
+		}
+		if err := versionfmt.Valid(fv.Feature.Namespace.VersionFormat, fv.Version); err != nil {
+			return nil, commonerr.NewBadRequestError("could not find/insert invalid FeatureVersion")
+		}
+
+		cacheIndexes[i] = strings.Join([]string{"featureversion", fv.Feature.Namespace.Name, fv.Feature.Name, fv.Version}, ":")
+		if pgSQL.cache != nil {
+			promCacheQueriesTotal.WithLabelValues("featureversion").Inc()
+			if id, found := pgSQL.cache.Get(cacheIndexes[i]); found {
+				promCacheHitsTotal.WithLabelValues("featureversion").Inc()
+				IDs[i] = id.(int)
+				continue
+			}
+		}
+		missing = append(missing, i)
+	}
+
+	// Share the insertions with the concurrent calls inserting the same
+	// FeatureVersions.
+	var owned, shared map[int]*insertCall
+	if pgSQL.inserts != nil {
+		owned, shared = make(map[int]*insertCall), make(map[int]*insertCall)
+
+		var toInsert []int
+		for _, i := range missing {
+			c, owner := pgSQL.inserts.join(cacheIndexes[i])
+			if owner {
+				owned[i] = c
+				toInsert = append(toInsert, i)
+			} else {
+				shared[i] = c
+			}
+		}
+		missing = toInsert
+	}
+
+	err := pgSQL.insertMissingFeatureVersions(featureVersions, missing, cacheIndexes, IDs)
+	for i, c := range owned {
+		pgSQL.inserts.finish(cacheIndexes[i], c, IDs[i], err)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Wait for the FeatureVersions inserted by the other calls, only once
+	// ours are done so that two calls never wait for each other.
+	for i, c := range shared {
+		<-c.done
+		if c.err != nil {
+			return nil, c.err
+		}
+		IDs[i] = c.id
+	}
+
+	return IDs, nil
+}
+
+// insertMissingFeatureVersions finds or creates the FeatureVersions at the
+// given indexes, and sets their IDs.
+func (pgSQL *pgSQL) insertMissingFeatureVersions(featureVersions []database.FeatureVersion, missing []int, cacheIndexes []string, IDs []int) error {
+	if len(missing) == 0 {
+		return nil
+	}
 
-	for i := 0; i < len(featureVersions); i++ {
-		id, err := pgSQL.InsertFeatureVersion(featureVersions[i])
+	// We do `defer observeQueryTime` here because we don't want to observe cached featureversions.
+	defer observeQueryTime("insertFeatureVersions", "all", time.Now())
+
+	// Find or create the Namespaces, there are usually very few of them.
+	namespaceIDs := make(map[string]int)
+	for _, i := range missing {
+		namespace := featureVersions[i].Feature.Namespace
+		if _, ok := namespaceIDs[namespace.Name]; ok {
+			continue
+		}
+
+		id, err := pgSQL.InsertNamespace(namespace)
 		if err != nil {
-			return IDs, err
+			return err
+		}
+		namespaceIDs[namespace.Name] = id
+	}
+
+	// Find or create all the Features at once.
+	var featureNames, featureKinds []string
+	var featureNamespaceIDs []int64
+	for _, i := range missing {
+		feature := featureVersions[i].Feature
+		featureNames = append(featureNames, feature.Name)
+		featureNamespaceIDs = append(featureNamespaceIDs, int64(namespaceIDs[feature.Namespace.Name]))
+		featureKinds = append(featureKinds, string(feature.Kind))
+	}
+
+	t := time.Now()
+	featureIDs, err := pgSQL.soiFeatures(featureNames, featureNamespaceIDs, featureKinds)
+	observeQueryTime("insertFeatureVersions", "soiFeatures", t)
+
+	if err != nil {
+		return err
+	}
+
+	for _, i := range missing {
+		feature := &featureVersions[i].Feature
+		feature.ID = featureIDs[featureKey(feature.Name, namespaceIDs[feature.Namespace.Name])]
+		if feature.ID == 0 {
+			return database.ErrInconsistent
 		}
-		IDs = append(IDs, id)
+	}
+
+	// Begin transaction.
+	tx, err := pgSQL.Begin()
+	if err != nil {
+		tx.Rollback()
+		return handleError("insertFeatureVersions.Begin()", err)
+	}
+
+	// Lock Vulnerability_Affects_FeatureVersion exclusively.
+	// We want to prevent InsertVulnerability to modify it.
+	promConcurrentLockVAFV.Inc()
+	defer promConcurrentLockVAFV.Dec()
+	t = time.Now()
+	_, err = tx.Exec(lockVulnerabilityAffects)
+	observeQueryTime("insertFeatureVersions", "lock", t)
+
+	if err != nil {
+		tx.Rollback()
+		return handleError("insertFeatureVersions.lockVulnerabilityAffects", err)
+	}
+
+	// Find or create all the FeatureVersions at once.
+	var fvFeatureIDs []int64
+	var fvVersions []string
+	var fvSourceNames []string
+	for _, i := range missing {
+		fvFeatureIDs = append(fvFeatureIDs, int64(featureVersions[i].Feature.ID))
+		fvVersions = append(fvVersions, featureVersions[i].Version)
+		fvSourceNames = append(fvSourceNames, featureVersions[i].SourceName)
+	}
+
+	t = time.Now()
+	rows, err := tx.Query(soiFeatureVersions, pq.Array(fvFeatureIDs), pq.Array(fvVersions), pq.Array(fvSourceNames))
+	observeQueryTime("insertFeatureVersions", "soiFeatureVersions", t)
+
+	if err != nil {
+		tx.Rollback()
+		return handleError("soiFeatureVersions", err)
+	}
+
+	type soiResult struct {
+		id      int
+		created bool
+	}
+	results := make(map[string]soiResult)
+	for rows.Next() {
+		var (
+			r         soiResult
+			featureID int
+			version   string
+		)
+		if err := rows.Scan(&r.created, &r.id, &featureID, &version); err != nil {
+			rows.Close()
+			tx.Rollback()
+			return handleError("soiFeatureVersions.Scan()", err)
+		}
+		results[featureVersionKey(featureID, version)] = r
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		tx.Rollback()
+		return handleError("soiFeatureVersions.Rows()", err)
+	}
+	rows.Close()
+
+	// Link the new FeatureVersions with every vulnerabilities that affect them, by inserting in
+	// Vulnerability_Affects_FeatureVersion.
+	linked := make(map[int]struct{})
+	for _, i := range missing {
+		fv := &featureVersions[i]
+
+		r, ok := results[featureVersionKey(fv.Feature.ID, fv.Version)]
+		if !ok {
+			tx.Rollback()
+			return database.ErrInconsistent
+		}
+		fv.ID = r.id
+		IDs[i] = r.id
+
+		if _, done := linked[r.id]; !r.created || done {
+			continue
+		}
+		linked[r.id] = struct{}{}
+
+		t = time.Now()
+		err = linkFeatureVersionToVulnerabilities(tx, *fv)
+		observeQueryTime("insertFeatureVersions", "linkFeatureVersionToVulnerabilities", t)
+
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	// Commit transaction.
+	err = tx.Commit()
+	if err != nil {
+		return handleError("insertFeatureVersions.Commit()", err)
+	}
+
+	if pgSQL.cache != nil {
+		for _, i := range missing {
+			pgSQL.cache.Add(cacheIndexes[i], IDs[i])
+		}
+	}
+
+	return nil
+}
+
+// soiFeatures finds or creates the Features described by the given names,
+// namespace IDs and kinds, and returns their IDs indexed by featureKey.
+func (pgSQL *pgSQL) soiFeatures(names []string, namespaceIDs []int64, kinds []string) (map[string]int, error) {
+	rows, err := pgSQL.Query(soiFeatures, pq.Array(names), pq.Array(namespaceIDs), pq.Array(kinds))
+	if err != nil {
+		return nil, handleError("soiFeatures", err)
+	}
+	defer rows.Close()
+
+	IDs := make(map[string]int)
+	for rows.Next() {
+		var (
+			id          int
+			name        string
+			namespaceID int
+		)
+		if err := rows.Scan(&id, &name, &namespaceID); err != nil {
+			return nil, handleError("soiFeatures.Scan()", err)
+		}
+		IDs[featureKey(name, namespaceID)] = id
+	}
+	if err := rows.Err(); err != nil {
+		return nil, handleError("soiFeatures.Rows()", err)
 	}
 
 	return IDs, nil
 }
 
+func featureKey(name string, namespaceID int) string {
+	return strconv.Itoa(namespaceID) + ":" + name
+}
+
+func featureVersionKey(featureID int, version string) string {
+	return strconv.Itoa(featureID) + ":" + version
+}
+
 type vulnerabilityAffectsFeatureVersion struct {
 	vulnerabilityID int
 	fixedInID       int
 	fixedInVersion  string
+	confidence      database.Confidence
+}
+
+// affectedBy returns whether a version of a feature of a namespace is lower
+// than the version fixing a vulnerability, and how confident that is. A version
+// that can't be compared to the fixed one is deemed affected, with a low
+// confidence, so that the match is reviewed rather than silently left out.
+func affectedBy(namespace database.Namespace, version, fixedInVersion string) (bool, database.Confidence) {
+	cmp, err := versionfmt.CompareInNamespace(namespace.Name, namespace.VersionFormat, version, fixedInVersion)
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{"namespace": namespace.Name, "version": version, "fixed in": fixedInVersion}).Debug("could not compare a version to the fixed version, deeming it affected")
+		return true, database.LowConfidence
+	}
+	return cmp < 0, database.HighConfidence
 }
 
 func linkFeatureVersionToVulnerabilities(tx *sql.Tx, featureVersion database.FeatureVersion) error {
@@ -190,41 +474,319 @@ func linkFeatureVersionToVulnerabilities(tx *sql.Tx, featureVersion database.Fea
 	if err != nil {
 		return handleError("searchVulnerabilityFixedInFeature", err)
 	}
-	defer rows.Close()
 
-	var affects []vulnerabilityAffectsFeatureVersion
-	for rows.Next() {
-		var affect vulnerabilityAffectsFeatureVersion
+	affects, err := scanVulnerabilityAffects(rows, "searchVulnerabilityFixedInFeature", featureVersion)
+	if err != nil {
+		return err
+	}
 
-		err := rows.Scan(&affect.fixedInID, &affect.vulnerabilityID, &affect.fixedInVersion)
+	// Advisories of some distributions are keyed by source package, select
+	// those that affect the source of this FeatureVersion too.
+	if featureVersion.SourceName != "" && featureVersion.SourceName != featureVersion.Feature.Name {
+		rows, err := tx.Query(searchVulnerabilityFixedInSourceFeature, featureVersion.Feature.ID, featureVersion.SourceName)
 		if err != nil {
-			return handleError("searchVulnerabilityFixedInFeature.Scan()", err)
+			return handleError("searchVulnerabilityFixedInSourceFeature", err)
 		}
 
-		cmp, err := versionfmt.Compare(featureVersion.Feature.Namespace.VersionFormat, featureVersion.Version, affect.fixedInVersion)
+		sourceAffects, err := scanVulnerabilityAffects(rows, "searchVulnerabilityFixedInSourceFeature", featureVersion)
 		if err != nil {
 			return err
 		}
-		if cmp < 0 {
-			// The version of the FeatureVersion we are inserting is lower than the fixed version on this
-			// Vulnerability, thus, this FeatureVersion is affected by it.
-			affects = append(affects, affect)
-		}
+		affects = append(affects, sourceAffects...)
 	}
-	if err = rows.Err(); err != nil {
-		return handleError("searchVulnerabilityFixedInFeature.Rows()", err)
-	}
-	rows.Close()
 
 	// Insert into Vulnerability_Affects_FeatureVersion.
 	for _, affect := range affects {
 		// TODO(Quentin-M): Batch me.
 		_, err := tx.Exec(insertVulnerabilityAffectsFeatureVersion, affect.vulnerabilityID,
-			featureVersion.ID, affect.fixedInID)
+			featureVersion.ID, affect.fixedInID, affect.confidence)
 		if err != nil {
 			return handleError("insertVulnerabilityAffectsFeatureVersion", err)
 		}
 	}
 
+	// Resolve the new FeatureVersion, which no scan can have resolved before
+	// it is committed, so that finding its layers does not.
+	if _, err := tx.Exec(insertVulnerabilityResolution, buildInputArray([]int{featureVersion.ID})); err != nil {
+		return handleError("insertVulnerabilityResolution", err)
+	}
+
 	return nil
-}
\ No newline at end of file
+}
+
+// scanVulnerabilityAffects reads the fixed versions selected by query and
+// returns those that affect featureVersion. rows is closed.
+func scanVulnerabilityAffects(rows *sql.Rows, query string, featureVersion database.FeatureVersion) ([]vulnerabilityAffectsFeatureVersion, error) {
+	defer rows.Close()
+
+	var affects []vulnerabilityAffectsFeatureVersion
+	for rows.Next() {
+		var affect vulnerabilityAffectsFeatureVersion
+
+		err := rows.Scan(&affect.fixedInID, &affect.vulnerabilityID, &affect.fixedInVersion)
+		if err != nil {
+			return nil, handleError(query+".Scan()", err)
+		}
+
+		// The version of the FeatureVersion we are inserting is lower than the fixed version on this
+		// Vulnerability, thus, this FeatureVersion is affected by it.
+		var affected bool
+		if affected, affect.confidence = affectedBy(featureVersion.Feature.Namespace, featureVersion.Version, affect.fixedInVersion); affected {
+			affects = append(affects, affect)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, handleError(query+".Rows()", err)
+	}
+
+	return affects, nil
+}
+
+// insertGroup tracks the FeatureVersions being inserted, so that concurrent
+// calls inserting the same one wait for a single insertion.
+type insertGroup struct {
+	mu    sync.Mutex
+	calls map[string]*insertCall
+}
+
+// insertCall is an insertion in progress, whose result is available once done
+// is closed.
+type insertCall struct {
+	done chan struct{}
+	id   int
+	err  error
+}
+
+func newInsertGroup() *insertGroup {
+	return &insertGroup{calls: make(map[string]*insertCall)}
+}
+
+// join returns the insertion in progress of the given key, or starts one if
+// there is none, in which case the boolean is true and the caller must finish
+// it.
+func (g *insertGroup) join(key string) (*insertCall, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if c, ok := g.calls[key]; ok {
+		return c, false
+	}
+	c := &insertCall{done: make(chan struct{})}
+	g.calls[key] = c
+	return c, true
+}
+
+// finish publishes the result of an insertion started by join.
+func (g *insertGroup) finish(key string, c *insertCall, id int, err error) {
+	g.mu.Lock()
+	delete(g.calls, key)
+	g.mu.Unlock()
+
+	c.id, c.err = id, err
+	close(c.done)
+}
+
+func (pgSQL *pgSQL) ListFeatures(namespaceName string, limit int, startID int) ([]database.FeatureVersion, int, error) {
+	defer observeQueryTime("ListFeatures", "all", time.Now())
+
+	if namespaceName != "" {
+		var id int
+		err := pgSQL.QueryRow(searchNamespace, namespaceName).Scan(&id)
+		if err != nil {
+			return nil, -1, handleError("searchNamespace", err)
+		} else if id == 0 {
+			return nil, -1, commonerr.ErrNotFound
+		}
+	}
+
+	rows, err := pgSQL.Query(listFeatureVersions, namespaceName, startID, limit+1)
+	if err != nil {
+		return nil, -1, handleError("listFeatureVersions", err)
+	}
+	defer rows.Close()
+
+	var featureVersions []database.FeatureVersion
+	nextID := -1
+	size := 0
+	for rows.Next() {
+		var fv database.FeatureVersion
+
+		err := rows.Scan(
+			&fv.ID,
+			&fv.Version,
+			&fv.SourceName,
+			&fv.Feature.ID,
+			&fv.Feature.Name,
+			&fv.Feature.Kind,
+			&fv.Feature.Namespace.ID,
+			&fv.Feature.Namespace.Name,
+			&fv.Feature.Namespace.VersionFormat,
+		)
+		if err != nil {
+			return nil, -1, handleError("listFeatureVersions.Scan()", err)
+		}
+		size++
+		if size > limit {
+			nextID = fv.ID
+		} else {
+			featureVersions = append(featureVersions, fv)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, -1, handleError("listFeatureVersions.Rows()", err)
+	}
+
+	return featureVersions, nextID, nil
+}
+
+// FindAffectingVulnerabilities compares the FeatureVersions to the fixed
+// versions of the vulnerabilities, as linkFeatureVersionToVulnerabilities
+// does, but without inserting anything.
+func (pgSQL *pgSQL) FindAffectingVulnerabilities(featureVersions []database.FeatureVersion) ([]database.FeatureVersion, error) {
+	vulnerabilities, err := pgSQL.FindVulnerabilitiesForFeatures(featureVersions)
+	if err != nil {
+		return nil, err
+	}
+
+	affected := make([]database.FeatureVersion, 0, len(featureVersions))
+	for i, fv := range featureVersions {
+		fv.AffectedBy = vulnerabilities[i]
+		affected = append(affected, fv)
+	}
+
+	return affected, nil
+}
+
+// FindVulnerabilitiesForFeatures selects the fixes that may affect the
+// FeatureVersions in a single query. The links stored for the FeatureVersions
+// that are already known and the fixes in no version decide in SQL, only the
+// other fixed versions are compared here.
+func (pgSQL *pgSQL) FindVulnerabilitiesForFeatures(featureVersions []database.FeatureVersion) ([][]database.Vulnerability, error) {
+	defer observeQueryTime("FindVulnerabilitiesForFeatures", "all", time.Now())
+
+	vulnerabilities := make([][]database.Vulnerability, len(featureVersions))
+	if len(featureVersions) == 0 {
+		return vulnerabilities, nil
+	}
+
+	var (
+		indexes    = make([]int64, 0, len(featureVersions))
+		namespaces = make([]string, 0, len(featureVersions))
+		names      = make([]string, 0, len(featureVersions))
+		sources    = make([]string, 0, len(featureVersions))
+		versions   = make([]string, 0, len(featureVersions))
+	)
+	for i, fv := range featureVersions {
+		source := fv.SourceName
+		if source == fv.Feature.Name {
+			source = ""
+		}
+
+		indexes = append(indexes, int64(i))
+		namespaces = append(namespaces, fv.Feature.Namespace.Name)
+		names = append(names, fv.Feature.Name)
+		sources = append(sources, source)
+		versions = append(versions, fv.Version)
+	}
+
+	rows, err := pgSQL.Query(searchVulnerabilityForFeatureVersions, pq.Array(indexes), pq.Array(namespaces),
+		pq.Array(names), pq.Array(sources), pq.Array(versions), versionfmt.MaxVersion)
+	if err != nil {
+		return nil, handleError("searchVulnerabilityForFeatureVersions", err)
+	}
+	defer rows.Close()
+
+	linked := make([]map[int]struct{}, len(featureVersions))
+	for rows.Next() {
+		var (
+			i             int
+			versionFormat string
+			fixedIn       string
+			affects       bool
+			confidence    database.Confidence
+			vulnerability database.Vulnerability
+		)
+		err := rows.Scan(
+			&i,
+			&versionFormat,
+			&fixedIn,
+			&affects,
+			&confidence,
+			&vulnerability.ID,
+			&vulnerability.Name,
+			&vulnerability.Description,
+			&vulnerability.Link,
+			&vulnerability.Severity,
+			&vulnerability.Metadata,
+			&vulnerability.Withdrawn,
+			&vulnerability.Confidence,
+			&vulnerability.PublishedDate,
+			&vulnerability.DiscoveredDate,
+			&vulnerability.Namespace.Name,
+			&vulnerability.Namespace.VersionFormat,
+		)
+		if err != nil {
+			return nil, handleError("searchVulnerabilityForFeatureVersions.Scan()", err)
+		}
+		if i < 0 || i >= len(featureVersions) {
+			return nil, database.ErrInconsistent
+		}
+
+		if _, done := linked[i][vulnerability.ID]; done {
+			continue
+		}
+
+		fv := featureVersions[i]
+		if !affects {
+			if fv.Feature.Namespace.VersionFormat != "" {
+				versionFormat = fv.Feature.Namespace.VersionFormat
+			}
+			namespace := database.Namespace{Name: fv.Feature.Namespace.Name, VersionFormat: versionFormat}
+			affects, confidence = affectedBy(namespace, fv.Version, fixedIn)
+		}
+		if !affects {
+			continue
+		}
+		if confidence.Compare(vulnerability.Confidence) < 0 {
+			vulnerability.Confidence = confidence
+		}
+
+		if linked[i] == nil {
+			linked[i] = make(map[int]struct{})
+		}
+		linked[i][vulnerability.ID] = struct{}{}
+
+		vulnerability.FixedBy = fixedIn
+		vulnerabilities[i] = append(vulnerabilities[i], vulnerability)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, handleError("searchVulnerabilityForFeatureVersions.Rows()", err)
+	}
+
+	return vulnerabilities, nil
+}
+
+func (pgSQL *pgSQL) FindVulnerabilitiesForFeature(namespaceName, featureName, version string) ([]database.Vulnerability, error) {
+	if namespaceName == "" || featureName == "" || version == "" {
+		return nil, commonerr.NewBadRequestError("could not find the vulnerabilities of an invalid FeatureVersion")
+	}
+
+	namespace, err := pgSQL.FindNamespace(namespaceName)
+	if err != nil {
+		return nil, err
+	}
+	if err := versionfmt.Valid(namespace.VersionFormat, version); err != nil {
+		return nil, commonerr.NewBadRequestError("could not find the vulnerabilities of an invalid FeatureVersion: " + err.Error())
+	}
+
+	featureVersions, err := pgSQL.FindAffectingVulnerabilities([]database.FeatureVersion{{
+		Feature: database.Feature{Name: featureName, Namespace: namespace},
+		Version: version,
+	}})
+	if err != nil {
+		return nil, err
+	}
+
+	return featureVersions[0].AffectedBy, nil
+}
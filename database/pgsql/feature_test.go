@@ -0,0 +1,169 @@
+package pgsql
+
+import (
+	"testing"
+
+	"github.com/MXi4oyu/DockerXScan/database"
+)
+
+// vulnerabilityNames returns the names of vulnerabilities.
+func vulnerabilityNames(vulnerabilities []database.Vulnerability) []string {
+	names := make([]string, 0, len(vulnerabilities))
+	for _, v := range vulnerabilities {
+		names = append(names, v.Name)
+	}
+	return names
+}
+
+func TestSourceKeyedVulnerabilities(t *testing.T) {
+	datastore := openDatabaseForTest(t, "SourceKeyedVulnerabilities", true)
+	defer datastore.Close()
+
+	// The advisories of Debian are keyed by source package, such as openssl,
+	// whose binary packages are named otherwise.
+	mustInsertVulnerabilities(t, datastore, database.Vulnerability{
+		Name:      "CVE-2022-2097",
+		Namespace: debian,
+		Severity:  database.MediumSeverity,
+		FixedIn:   []database.FeatureVersion{debianFeature("openssl", "1.1.1n-0+deb11u4")},
+	})
+
+	libssl := debianFeature("libssl1.1", "1.1.1n-0+deb11u3")
+	libssl.SourceName = "openssl"
+	layer := database.Layer{
+		Name:          "TestSourceKeyedVulnerabilities",
+		EngineVersion: 1,
+		Namespace:     &debian,
+		Features:      []database.FeatureVersion{libssl, debianFeature("base-files", "11.1+deb11u5")},
+	}
+	if err := datastore.InsertLayer(layer); err != nil {
+		t.Fatalf("InsertLayer() failed: %s", err)
+	}
+
+	found, err := datastore.FindLayer(layer.Name, true, true)
+	if err != nil {
+		t.Fatalf("FindLayer() failed: %s", err)
+	}
+	if len(found.Features) != 2 {
+		t.Fatalf("FindLayer() found %d features, want 2", len(found.Features))
+	}
+	for _, fv := range found.Features {
+		names := vulnerabilityNames(fv.AffectedBy)
+		switch fv.Feature.Name {
+		case "libssl1.1":
+			if fv.SourceName != "openssl" {
+				t.Errorf("FindLayer() found libssl1.1 built from %q, want openssl", fv.SourceName)
+			}
+			if len(names) != 1 || names[0] != "CVE-2022-2097" {
+				t.Errorf("FindLayer() found libssl1.1 affected by %v, want [CVE-2022-2097] through its source package", names)
+			}
+			if len(fv.AffectedBy) == 1 && fv.AffectedBy[0].FixedBy != "1.1.1n-0+deb11u4" {
+				t.Errorf("FindLayer() found CVE-2022-2097 fixed by %q, want 1.1.1n-0+deb11u4", fv.AffectedBy[0].FixedBy)
+			}
+		case "base-files":
+			if len(names) != 0 {
+				t.Errorf("FindLayer() found base-files affected by %v, want none", names)
+			}
+		}
+	}
+
+	// The batch matcher finds them by the source package too, until the fixed
+	// version.
+	fixed := libssl
+	fixed.Version = "1.1.1n-0+deb11u4"
+	vulnerabilities, err := datastore.FindVulnerabilitiesForFeatures([]database.FeatureVersion{libssl, fixed})
+	if err != nil {
+		t.Fatalf("FindVulnerabilitiesForFeatures() failed: %s", err)
+	}
+	if names := vulnerabilityNames(vulnerabilities[0]); len(names) != 1 || names[0] != "CVE-2022-2097" {
+		t.Errorf("FindVulnerabilitiesForFeatures() found libssl1.1 %s affected by %v, want [CVE-2022-2097]", libssl.Version, names)
+	}
+	if names := vulnerabilityNames(vulnerabilities[1]); len(names) != 0 {
+		t.Errorf("FindVulnerabilitiesForFeatures() found libssl1.1 %s affected by %v, want none", fixed.Version, names)
+	}
+}
+
+// BenchmarkFindVulnerabilitiesForFeatures compares finding the
+// vulnerabilities of the features of a layer in one batch to finding those of
+// each feature in turn, as was done before.
+func BenchmarkFindVulnerabilitiesForFeatures(b *testing.B) {
+	datastore := openDatabaseForTest(b, "FindVulnerabilitiesForFeatures", true)
+	defer datastore.Close()
+
+	vulnerabilities, features := syntheticFeed(300)
+	mustInsertVulnerabilities(b, datastore, vulnerabilities...)
+
+	b.Run("batch", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			found, err := datastore.FindVulnerabilitiesForFeatures(features)
+			if err != nil {
+				b.Fatal(err)
+			}
+			if len(found) != len(features) || len(found[0]) != 1 || len(found[1]) != 0 {
+				b.Fatalf("FindVulnerabilitiesForFeatures() found %d vulnerabilities for the first features", len(found[0])+len(found[1]))
+			}
+		}
+	})
+
+	b.Run("per feature", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for _, fv := range features {
+				if _, err := datastore.FindVulnerabilitiesForFeature(fv.Feature.Namespace.Name, fv.Feature.Name, fv.Version); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+}
+
+func TestUncomparableVersionConfidence(t *testing.T) {
+	datastore := openDatabaseForTest(t, "UncomparableVersionConfidence", false)
+	defer datastore.Close()
+
+	// The versions of Alpine are compared by the rules of apk, which reject
+	// some of the versions valid in the dpkg format of its namespace.
+	alpine := database.Namespace{Name: "alpine:v3.18", VersionFormat: "dpkg"}
+	musl := database.FeatureVersion{Feature: database.Feature{Name: "musl", Namespace: alpine}, Version: "1.2.4~rc1"}
+	mustInsertVulnerabilities(t, datastore, database.Vulnerability{
+		Name:      "CVE-2023-0001",
+		Namespace: alpine,
+		Severity:  database.HighSeverity,
+		FixedIn:   []database.FeatureVersion{{Feature: musl.Feature, Version: "1.2.4-r1"}},
+	})
+	layer := database.Layer{Name: "TestUncomparableVersionConfidence", EngineVersion: 1, Namespace: &alpine, Features: []database.FeatureVersion{musl}}
+	if err := datastore.InsertLayer(layer); err != nil {
+		t.Fatalf("InsertLayer() failed: %s", err)
+	}
+
+	// The version that can't be compared to the fixed one is affected with a
+	// low confidence, which the filter on the confidence leaves out.
+	for _, minConfidence := range []database.Confidence{database.LowConfidence, database.HighConfidence} {
+		found, err := datastore.FindLayerWithOpts(layer.Name, database.FindLayerOpts{WithFeatures: true, WithVulnerabilities: true, ConfidenceAtLeast: minConfidence})
+		if err != nil {
+			t.Fatalf("FindLayer() failed: %s", err)
+		}
+		if len(found.Features) != 1 {
+			t.Fatalf("FindLayer() found %d features, want 1", len(found.Features))
+		}
+		affectedBy := found.Features[0].AffectedBy
+		if minConfidence == database.HighConfidence {
+			if len(affectedBy) != 0 {
+				t.Errorf("FindLayer() at a high confidence found musl affected by %v, want none", vulnerabilityNames(affectedBy))
+			}
+			continue
+		}
+		if len(affectedBy) != 1 || affectedBy[0].Confidence != database.LowConfidence {
+			t.Errorf("FindLayer() found musl affected by %+v, want CVE-2023-0001 with a low confidence", affectedBy)
+		}
+	}
+
+	// So does the batch matcher, for a version that is not stored.
+	musl.Version = "1.2.3~rc1"
+	vulnerabilities, err := datastore.FindVulnerabilitiesForFeatures([]database.FeatureVersion{musl})
+	if err != nil {
+		t.Fatalf("FindVulnerabilitiesForFeatures() failed: %s", err)
+	}
+	if len(vulnerabilities[0]) != 1 || vulnerabilities[0][0].Confidence != database.LowConfidence {
+		t.Errorf("FindVulnerabilitiesForFeatures() found musl %s affected by %+v, want CVE-2023-0001 with a low confidence", musl.Version, vulnerabilities[0])
+	}
+}
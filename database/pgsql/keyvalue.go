@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	log "github.com/sirupsen/logrus"
 	"github.com/MXi4oyu/DockerXScan/common/commonerr"
+	"github.com/MXi4oyu/DockerXScan/database"
 	"time"
 )
 
@@ -66,4 +67,25 @@ func (pgSQL *pgSQL) GetKeyValue(key string) (string, error) {
 	}
 
 	return value, nil
-}
\ No newline at end of file
+}
+
+// SetKeyValueNS stores (or updates) a key / value tuple scoped to a component.
+func (pgSQL *pgSQL) SetKeyValueNS(component, key, value string) error {
+	nsKey, err := database.NamespacedKey(component, key)
+	if err != nil {
+		return err
+	}
+
+	return pgSQL.InsertKeyValue(nsKey, value)
+}
+
+// GetKeyValueNS reads a key / value tuple scoped to a component and returns an empty string if the
+// key doesn't exist.
+func (pgSQL *pgSQL) GetKeyValueNS(component, key string) (string, error) {
+	nsKey, err := database.NamespacedKey(component, key)
+	if err != nil {
+		return "", err
+	}
+
+	return pgSQL.GetKeyValue(nsKey)
+}
@@ -7,6 +7,7 @@ import (
 	"strings"
 	"time"
 	"github.com/guregu/null/zero"
+	"github.com/lib/pq"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -26,6 +27,10 @@ func (pgSQL *pgSQL)InsertLayer(layer database.Layer) error {
 	if err != nil && err != commonerr.ErrNotFound {
 		return err
 	} else if err == nil {
+		if parentName(existingLayer.Parent) != parentName(layer.Parent) {
+			log.WithFields(log.Fields{"layer": layer.Name, "stored parent": parentName(existingLayer.Parent), "parent": parentName(layer.Parent)}).Warning("could not insert a layer on top of another parent")
+			return database.ErrParentMismatch
+		}
 		if existingLayer.EngineVersion >= layer.EngineVersion {
 			// The layer exists and has an equal or higher engine version, do nothing.
 			return nil
@@ -72,7 +77,7 @@ func (pgSQL *pgSQL)InsertLayer(layer database.Layer) error {
 
 	if layer.ID == 0 {
 		// Insert a new layer.
-		err = tx.QueryRow(insertLayer, layer.Name, layer.EngineVersion, parentID, namespaceID).
+		err = tx.QueryRow(insertLayer, layer.Name, layer.EngineVersion, parentID, namespaceID, layer.Digest).
 			Scan(&layer.ID)
 		if err != nil {
 			tx.Rollback()
@@ -86,7 +91,7 @@ func (pgSQL *pgSQL)InsertLayer(layer database.Layer) error {
 		}
 	} else {
 		// Update an existing layer.
-		_, err = tx.Exec(updateLayer, layer.ID, layer.EngineVersion, namespaceID)
+		_, err = tx.Exec(updateLayer, layer.ID, layer.EngineVersion, namespaceID, layer.Digest)
 		if err != nil {
 			tx.Rollback()
 			return handleError("updateLayer", err)
@@ -119,7 +124,16 @@ func (pgSQL *pgSQL)InsertLayer(layer database.Layer) error {
 }
 
 
-func loadAffectedBy(tx *sql.Tx, featureVersions []database.FeatureVersion) error {
+// parentName returns the name of a parent layer, or an empty string if there
+// is none.
+func parentName(parent *database.Layer) string {
+	if parent == nil {
+		return ""
+	}
+	return parent.Name
+}
+
+func loadAffectedBy(tx *sql.Tx, featureVersions []database.FeatureVersion, withWithdrawn bool, minSeverity database.Severity, minConfidence database.Confidence) error {
 	if len(featureVersions) == 0 {
 		return nil
 	}
@@ -130,10 +144,23 @@ func loadAffectedBy(tx *sql.Tx, featureVersions []database.FeatureVersion) error
 		featureVersionIDs = append(featureVersionIDs, featureVersions[i].ID)
 	}
 
-	rows, err := tx.Query(searchFeatureVersionVulnerability,
-		buildInputArray(featureVersionIDs))
+	// The vulnerabilities are read from their resolutions, shared by all the
+	// layers of the feature versions, unless they could not be stored.
+	query, queryName := searchResolvedFeatureVersionVulnerability, "searchResolvedFeatureVersionVulnerability"
+	if err := resolveFeatureVersions(tx, featureVersionIDs); err != nil {
+		log.WithError(err).Warning("could not resolve the vulnerabilities of the feature versions, searching them directly")
+		query, queryName = searchFeatureVersionVulnerability, "searchFeatureVersionVulnerability"
+	}
+
+	// The vulnerabilities less severe than minSeverity, or of a lower
+	// confidence than minConfidence, are left out by the query, rather than
+	// loaded to be dropped.
+	if minConfidence == "" {
+		minConfidence = database.LowConfidence
+	}
+	rows, err := tx.Query(query, buildInputArray(featureVersionIDs), withWithdrawn, pq.Array(severitiesAtLeast(minSeverity)), &minConfidence)
 	if err != nil && err != sql.ErrNoRows {
-		return handleError("searchFeatureVersionVulnerability", err)
+		return handleError(queryName, err)
 	}
 	defer rows.Close()
 
@@ -149,17 +176,21 @@ func loadAffectedBy(tx *sql.Tx, featureVersions []database.FeatureVersion) error
 			&vulnerability.Link,
 			&vulnerability.Severity,
 			&vulnerability.Metadata,
+			&vulnerability.Withdrawn,
+			&vulnerability.Confidence,
+			&vulnerability.PublishedDate,
+			&vulnerability.DiscoveredDate,
 			&vulnerability.Namespace.Name,
 			&vulnerability.Namespace.VersionFormat,
 			&vulnerability.FixedBy,
 		)
 		if err != nil {
-			return handleError("searchFeatureVersionVulnerability.Scan()", err)
+			return handleError(queryName+".Scan()", err)
 		}
 		vulnerabilities[featureversionID] = append(vulnerabilities[featureversionID], vulnerability)
 	}
 	if err = rows.Err(); err != nil {
-		return handleError("searchFeatureVersionVulnerability.Rows()", err)
+		return handleError(queryName+".Rows()", err)
 	}
 
 	// Assign vulnerabilities to every FeatureVersions
@@ -170,9 +201,131 @@ func loadAffectedBy(tx *sql.Tx, featureVersions []database.FeatureVersion) error
 	return nil
 }
 
+// severitiesAtLeast returns the severities at least as high as minSeverity,
+// to be given to a query as an array, or nil when none is lower.
+func severitiesAtLeast(minSeverity database.Severity) []string {
+	if minSeverity == "" || minSeverity.Compare(database.UnknownSeverity) <= 0 {
+		return nil
+	}
+
+	var severities []string
+	for _, severity := range database.Severities {
+		if severity.Compare(minSeverity) >= 0 {
+			severities = append(severities, string(severity))
+		}
+	}
+	return severities
+}
+
+// resolveFeatureVersions stores the vulnerabilities affecting the feature
+// versions that have not been resolved at the current data version of their
+// namespace, which are usually none of them, as they are resolved when they
+// are inserted and when their namespace is updated. The resolutions are stored
+// under a savepoint, so that failing to store them, such as when another scan
+// stores them meanwhile, leaves the transaction usable.
+func resolveFeatureVersions(tx *sql.Tx, featureVersionIDs []int) error {
+	defer observeQueryTime("resolveFeatureVersions", "all", time.Now())
+
+	rows, err := tx.Query(searchUnresolvedFeatureVersion, buildInputArray(featureVersionIDs))
+	if err != nil {
+		return handleError("searchUnresolvedFeatureVersion", err)
+	}
+	var unresolved []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return handleError("searchUnresolvedFeatureVersion.Scan()", err)
+		}
+		unresolved = append(unresolved, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return handleError("searchUnresolvedFeatureVersion.Rows()", err)
+	}
+	if len(unresolved) == 0 {
+		return nil
+	}
+
+	if _, err := tx.Exec(savepointVulnerabilityResolution); err != nil {
+		return handleError("savepointVulnerabilityResolution", err)
+	}
+
+	ids := buildInputArray(unresolved)
+	_, err = tx.Exec(updateStaleVulnerabilityResolution, ids)
+	if err != nil {
+		err = handleError("updateStaleVulnerabilityResolution", err)
+	} else if _, err = tx.Exec(insertVulnerabilityResolution, ids); err != nil {
+		err = handleError("insertVulnerabilityResolution", err)
+	}
+	if err != nil {
+		if _, rerr := tx.Exec(rollbackToVulnerabilityResolution); rerr != nil {
+			log.WithError(rerr).Warning("could not roll back the resolution of the vulnerabilities")
+		}
+		return err
+	}
+
+	if _, err := tx.Exec(releaseVulnerabilityResolution); err != nil {
+		return handleError("releaseVulnerabilityResolution", err)
+	}
+	return nil
+}
+
+// refreshVulnerabilityResolutions resolves again the feature versions of the
+// namespaces whose data version has advanced, so that finding their layers
+// does not. Failing to is not an error, the feature versions being resolved
+// when their layers are found then.
+func (pgSQL *pgSQL) refreshVulnerabilityResolutions(namespaceNames []string) {
+	if len(namespaceNames) == 0 {
+		return
+	}
+	defer observeQueryTime("refreshVulnerabilityResolutions", "all", time.Now())
+
+	if _, err := pgSQL.Exec(refreshNamespaceVulnerabilityResolution, pq.Array(namespaceNames)); err != nil {
+		log.WithError(handleError("refreshNamespaceVulnerabilityResolution", err)).Warning("could not resolve the vulnerabilities of the updated namespaces again")
+	}
+}
+
+func (pgSQL *pgSQL) FindLayer(name string, withFeatures, withVulnerabilities bool) (database.Layer, error) {
+	return pgSQL.FindLayerWithOpts(name, database.FindLayerOpts{
+		WithFeatures:        withFeatures,
+		WithVulnerabilities: withVulnerabilities,
+	})
+}
+
+func (pgSQL *pgSQL) FindLayerWithWithdrawn(name string, withFeatures, withVulnerabilities bool) (database.Layer, error) {
+	return pgSQL.FindLayerWithOpts(name, database.FindLayerOpts{
+		WithFeatures:        withFeatures,
+		WithVulnerabilities: withVulnerabilities,
+		IncludeWithdrawn:    true,
+	})
+}
+
+func (pgSQL *pgSQL) FindLayerWithOpts(name string, opts database.FindLayerOpts) (database.Layer, error) {
+	layer, err := pgSQL.findLayer(name, opts.WithFeatures, opts.WithVulnerabilities, opts.IncludeWithdrawn, opts.SeverityAtLeast, opts.ConfidenceAtLeast)
+	if err != nil {
+		return layer, err
+	}
+
+	if len(opts.NamespaceFilter) > 0 {
+		namespaces := make(map[string]struct{}, len(opts.NamespaceFilter))
+		for _, namespace := range opts.NamespaceFilter {
+			namespaces[namespace] = struct{}{}
+		}
 
-func (pgSQL *pgSQL) FindLayer(name string, withFeatures, withVulnerabilities bool) (database.Layer, error){
+		var features []database.FeatureVersion
+		for _, fv := range layer.Features {
+			if _, ok := namespaces[fv.Feature.Namespace.Name]; ok {
+				features = append(features, fv)
+			}
+		}
+		layer.Features = features
+	}
+
+	return layer, nil
+}
 
+func (pgSQL *pgSQL) findLayer(name string, withFeatures, withVulnerabilities, withWithdrawn bool, minSeverity database.Severity, minConfidence database.Confidence) (database.Layer, error) {
 	subquery := "all"
 	if withFeatures {
 		subquery += "/features"
@@ -196,6 +349,7 @@ func (pgSQL *pgSQL) FindLayer(name string, withFeatures, withVulnerabilities boo
 		&layer.ID,
 		&layer.Name,
 		&layer.EngineVersion,
+		&layer.Digest,
 		&parentID,
 		&parentName,
 		&nsID,
@@ -259,7 +413,7 @@ func (pgSQL *pgSQL) FindLayer(name string, withFeatures, withVulnerabilities boo
 		if withVulnerabilities {
 			// Load the vulnerabilities that affect the FeatureVersions.
 			t = time.Now()
-			err := loadAffectedBy(tx, layer.Features)
+			err := loadAffectedBy(tx, layer.Features, withWithdrawn, minSeverity, minConfidence)
 			observeQueryTime("FindLayer", "loadAffectedBy", t)
 
 			if err != nil {
@@ -283,20 +437,30 @@ func getLayerFeatureVersions(tx *sql.Tx, layerID int) ([]database.FeatureVersion
 	defer rows.Close()
 
 	// Scan query.
+	// A FeatureVersion found in several roots of the image is added and
+	// deleted in each of them.
+	type rootedFeatureVersion struct {
+		id   int
+		root string
+	}
 	var modification string
-	mapFeatureVersions := make(map[int]database.FeatureVersion)
+	mapFeatureVersions := make(map[rootedFeatureVersion]database.FeatureVersion)
 	for rows.Next() {
 		var fv database.FeatureVersion
 		err = rows.Scan(
 			&fv.ID,
 			&modification,
+			&fv.Root,
+			&fv.Location,
 			&fv.Feature.Namespace.ID,
 			&fv.Feature.Namespace.Name,
 			&fv.Feature.Namespace.VersionFormat,
 			&fv.Feature.ID,
 			&fv.Feature.Name,
+			&fv.Feature.Kind,
 			&fv.ID,
 			&fv.Version,
+			&fv.SourceName,
 			&fv.AddedBy.ID,
 			&fv.AddedBy.Name,
 		)
@@ -307,9 +471,9 @@ func getLayerFeatureVersions(tx *sql.Tx, layerID int) ([]database.FeatureVersion
 		// Do transitive closure.
 		switch modification {
 		case "add":
-			mapFeatureVersions[fv.ID] = fv
+			mapFeatureVersions[rootedFeatureVersion{fv.ID, fv.Root}] = fv
 		case "del":
-			delete(mapFeatureVersions, fv.ID)
+			delete(mapFeatureVersions, rootedFeatureVersion{fv.ID, fv.Root})
 		default:
 			log.WithField("modification", modification).Warning("unknown Layer_diff_FeatureVersion's modification")
 			return featureVersions, database.ErrInconsistent
@@ -368,13 +532,13 @@ func (pgSQL *pgSQL) updateDiffFeatureVersions(tx *sql.Tx, layer, existingLayer *
 
 	// Insert diff in the database.
 	if len(addIDs) > 0 {
-		_, err = tx.Exec(insertLayerDiffFeatureVersion, layer.ID, "add", buildInputArray(addIDs))
+		_, err = tx.Exec(insertLayerDiffFeatureVersion, layer.ID, "add", buildInputArray(addIDs), pq.Array(featureVersionRoots(add)), pq.Array(featureVersionLocations(add)))
 		if err != nil {
 			return handleError("insertLayerDiffFeatureVersion.Add", err)
 		}
 	}
 	if len(delIDs) > 0 {
-		_, err = tx.Exec(insertLayerDiffFeatureVersion, layer.ID, "del", buildInputArray(delIDs))
+		_, err = tx.Exec(insertLayerDiffFeatureVersion, layer.ID, "del", buildInputArray(delIDs), pq.Array(featureVersionRoots(del)), pq.Array(featureVersionLocations(del)))
 		if err != nil {
 			return handleError("insertLayerDiffFeatureVersion.Del", err)
 		}
@@ -389,7 +553,7 @@ func createNV(features []database.FeatureVersion) (map[string]*database.FeatureV
 
 	for i := 0; i < len(features); i++ {
 		fv := &features[i]
-		nv := strings.Join([]string{fv.Feature.Namespace.Name, fv.Feature.Name, fv.Version}, ":")
+		nv := strings.Join([]string{fv.Feature.Namespace.Name, fv.Feature.Name, fv.Version, fv.Root}, ":")
 		mapNV[nv] = fv
 		sliceNV = append(sliceNV, nv)
 	}
@@ -397,6 +561,133 @@ func createNV(features []database.FeatureVersion) (map[string]*database.FeatureV
 	return mapNV, sliceNV
 }
 
+// featureVersionRoots returns the roots of the FeatureVersions, in order.
+func featureVersionRoots(featureVersions []database.FeatureVersion) []string {
+	roots := make([]string, 0, len(featureVersions))
+	for _, fv := range featureVersions {
+		roots = append(roots, fv.Root)
+	}
+	return roots
+}
+
+// featureVersionLocations returns the locations of the FeatureVersions, in
+// order.
+func featureVersionLocations(featureVersions []database.FeatureVersion) []string {
+	locations := make([]string, 0, len(featureVersions))
+	for _, fv := range featureVersions {
+		locations = append(locations, fv.Location)
+	}
+	return locations
+}
+
+
+// FindLayers returns the layers whose digest is one of the given digests,
+// along with the name of their parent, without their features.
+func (pgSQL *pgSQL) FindLayers(digests []string) ([]database.Layer, error) {
+	if len(digests) == 0 {
+		return nil, nil
+	}
+	defer observeQueryTime("FindLayers", "all", time.Now())
+
+	rows, err := pgSQL.Query(searchLayersByDigest, pq.Array(digests))
+	if err != nil {
+		return nil, handleError("searchLayersByDigest", err)
+	}
+	defer rows.Close()
+
+	var layers []database.Layer
+	for rows.Next() {
+		var (
+			layer      database.Layer
+			parentID   zero.Int
+			parentName zero.String
+		)
+		if err := rows.Scan(&layer.ID, &layer.Name, &layer.EngineVersion, &layer.Digest, &parentID, &parentName); err != nil {
+			return nil, handleError("searchLayersByDigest.Scan()", err)
+		}
+		if !parentID.IsZero() {
+			layer.Parent = &database.Layer{
+				Model: database.Model{ID: int(parentID.Int64)},
+				Name:  parentName.String,
+			}
+		}
+		layers = append(layers, layer)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, handleError("searchLayersByDigest.Rows()", err)
+	}
+
+	return layers, nil
+}
+
+func (pgSQL *pgSQL) ListLayersAffectedBy(namespaceName, name string) ([]string, error) {
+	vulnerability, err := pgSQL.FindVulnerability(namespaceName, name)
+	if err != nil {
+		return nil, err
+	}
+	defer observeQueryTime("ListLayersAffectedBy", "all", time.Now())
+
+	rows, err := pgSQL.Query(searchLayersAffectedByVulnerability, vulnerability.ID)
+	if err != nil {
+		return nil, handleError("searchLayersAffectedByVulnerability", err)
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, handleError("searchLayersAffectedByVulnerability.Scan()", err)
+		}
+		names = append(names, name)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, handleError("searchLayersAffectedByVulnerability.Rows()", err)
+	}
+
+	return names, nil
+}
+
+func (pgSQL *pgSQL) DiffLayerFeatures(child, parent string) (added, removed []database.FeatureVersion, err error) {
+	defer observeQueryTime("DiffLayerFeatures", "all", time.Now())
+
+	childLayer, err := pgSQL.FindLayer(child, true, false)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var parentFeatures []database.FeatureVersion
+	if parent != "" {
+		parentLayer, err := pgSQL.FindLayer(parent, true, false)
+		if err != nil {
+			return nil, nil, err
+		}
+		parentFeatures = parentLayer.Features
+	}
+
+	return subtractFeatureVersions(childLayer.Features, parentFeatures), subtractFeatureVersions(parentFeatures, childLayer.Features), nil
+}
+
+// subtractFeatureVersions returns the feature versions of a that b doesn't
+// have, in the same root.
+func subtractFeatureVersions(a, b []database.FeatureVersion) []database.FeatureVersion {
+	key := func(fv database.FeatureVersion) string {
+		return fv.Feature.Namespace.Name + ":" + fv.Feature.Name + ":" + fv.Version + ":" + fv.Root
+	}
+
+	inB := make(map[string]struct{}, len(b))
+	for _, fv := range b {
+		inB[key(fv)] = struct{}{}
+	}
+
+	var difference []database.FeatureVersion
+	for _, fv := range a {
+		if _, exists := inB[key(fv)]; !exists {
+			difference = append(difference, fv)
+		}
+	}
+	return difference
+}
 
 //删除一个layer
 func (pgSQL *pgSQL) DeleteLayer(name string) error {
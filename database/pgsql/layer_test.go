@@ -0,0 +1,296 @@
+package pgsql
+
+import (
+	"encoding/json"
+	"sort"
+	"testing"
+
+	"github.com/lib/pq"
+
+	"github.com/MXi4oyu/DockerXScan/database"
+)
+
+func TestFindLayerConfidence(t *testing.T) {
+	datastore := openDatabaseForTest(t, "FindLayerConfidence", true)
+	defer datastore.Close()
+
+	mustInsertVulnerabilities(t, datastore,
+		database.Vulnerability{
+			Name:      "CVE-2022-0001",
+			Namespace: debian,
+			Severity:  database.HighSeverity,
+			FixedIn:   []database.FeatureVersion{debianFeature("openssl", "1.1.1n-0+deb11u4")},
+		},
+		database.Vulnerability{
+			Name:       "CVE-2022-0002",
+			Namespace:  debian,
+			Severity:   database.HighSeverity,
+			Confidence: database.LowConfidence,
+			FixedIn:    []database.FeatureVersion{debianFeature("openssl", "1.1.1n-0+deb11u5")},
+		},
+	)
+	layer := database.Layer{
+		Name:          "TestFindLayerConfidence",
+		EngineVersion: 1,
+		Namespace:     &debian,
+		Features:      []database.FeatureVersion{debianFeature("openssl", "1.1.1n-0+deb11u3")},
+	}
+	if err := datastore.InsertLayer(layer); err != nil {
+		t.Fatalf("InsertLayer() failed: %s", err)
+	}
+
+	tests := []struct {
+		confidence database.Confidence
+		want       map[string]database.Confidence
+	}{
+		{"", map[string]database.Confidence{"CVE-2022-0001": database.HighConfidence, "CVE-2022-0002": database.LowConfidence}},
+		{database.LowConfidence, map[string]database.Confidence{"CVE-2022-0001": database.HighConfidence, "CVE-2022-0002": database.LowConfidence}},
+		{database.HighConfidence, map[string]database.Confidence{"CVE-2022-0001": database.HighConfidence}},
+	}
+
+	for _, test := range tests {
+		found, err := datastore.FindLayerWithOpts(layer.Name, database.FindLayerOpts{
+			WithFeatures:        true,
+			WithVulnerabilities: true,
+			ConfidenceAtLeast:   test.confidence,
+		})
+		if err != nil {
+			t.Fatalf("FindLayerWithOpts() failed: %s", err)
+		}
+		if len(found.Features) != 1 {
+			t.Fatalf("FindLayerWithOpts() found %d features, want 1", len(found.Features))
+		}
+
+		got := make(map[string]database.Confidence)
+		for _, v := range found.Features[0].AffectedBy {
+			got[v.Name] = v.Confidence
+		}
+		if len(got) != len(test.want) {
+			t.Errorf("ConfidenceAtLeast %q: found %v, want %v", test.confidence, got, test.want)
+			continue
+		}
+		for name, confidence := range test.want {
+			if got[name] != confidence {
+				t.Errorf("ConfidenceAtLeast %q: found %s of confidence %q, want %q", test.confidence, name, got[name], confidence)
+			}
+		}
+	}
+}
+
+// insertSyntheticLayers inserts the vulnerabilities and features of
+// syntheticFeed(n), half of the features in a parent layer and the others in a
+// child of it, returning the name of the child.
+func insertSyntheticLayers(tb testing.TB, datastore *pgSQL, n int) string {
+	vulnerabilities, features := syntheticFeed(n)
+	mustInsertVulnerabilities(tb, datastore, vulnerabilities...)
+
+	parent := database.Layer{Name: "synthetic-parent", EngineVersion: 1, Namespace: &debian, Features: features[:n/2]}
+	if err := datastore.InsertLayer(parent); err != nil {
+		tb.Fatalf("InsertLayer() failed: %s", err)
+	}
+	// The parent is inserted below its child as retrieved from the database.
+	parent, err := datastore.FindLayer(parent.Name, true, false)
+	if err != nil {
+		tb.Fatalf("FindLayer() failed: %s", err)
+	}
+	child := database.Layer{Name: "synthetic-child", EngineVersion: 1, Parent: &parent, Namespace: &debian, Features: features}
+	if err := datastore.InsertLayer(child); err != nil {
+		tb.Fatalf("InsertLayer() failed: %s", err)
+	}
+	return child.Name
+}
+
+// BenchmarkFindLayer finds a layer of hundreds of features, half of which are
+// affected by a vulnerability, with and without them.
+func BenchmarkFindLayer(b *testing.B) {
+	datastore := openDatabaseForTest(b, "FindLayer", true)
+	defer datastore.Close()
+
+	const features = 300
+	name := insertSyntheticLayers(b, datastore, features)
+
+	b.Run("features", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			layer, err := datastore.FindLayer(name, true, false)
+			if err != nil {
+				b.Fatal(err)
+			}
+			if len(layer.Features) != features {
+				b.Fatalf("FindLayer() found %d features, want %d", len(layer.Features), features)
+			}
+		}
+	})
+
+	b.Run("vulnerabilities", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			layer, err := datastore.FindLayer(name, true, true)
+			if err != nil {
+				b.Fatal(err)
+			}
+			affected := 0
+			for _, fv := range layer.Features {
+				affected += len(fv.AffectedBy)
+			}
+			if affected != features/2 {
+				b.Fatalf("FindLayer() found %d vulnerabilities, want %d", affected, features/2)
+			}
+		}
+	})
+}
+
+// planNode is a node of a plan explained in JSON.
+type planNode struct {
+	NodeType     string     `json:"Node Type"`
+	RelationName string     `json:"Relation Name"`
+	Plans        []planNode `json:"Plans"`
+}
+
+// seqScans returns the relations scanned sequentially by the plan.
+func (n planNode) seqScans() (relations []string) {
+	if n.NodeType == "Seq Scan" {
+		relations = append(relations, n.RelationName)
+	}
+	for _, p := range n.Plans {
+		relations = append(relations, p.seqScans()...)
+	}
+	return relations
+}
+
+// TestFindLayerUsesIndexes checks that the queries of FindLayer find the
+// features of the layer tree and their vulnerabilities through the existing
+// indexes, so that none is missing however many features a layer has: the
+// index on Layer_diff_FeatureVersion (layer_id), the one on
+// Vulnerability_Affects_FeatureVersion (featureversion_id, vulnerability_id)
+// and the primary keys of the other tables. Sequential scans are disabled, so that the
+// planner only picks one when no index serves the lookup, rather than because
+// the tables of the test are small.
+func TestFindLayerUsesIndexes(t *testing.T) {
+	datastore := openDatabaseForTest(t, "FindLayerUsesIndexes", true)
+	defer datastore.Close()
+
+	// Finding the layer with its vulnerabilities resolves them.
+	layer, err := datastore.FindLayer(insertSyntheticLayers(t, datastore, 20), true, true)
+	if err != nil {
+		t.Fatalf("FindLayer() failed: %s", err)
+	}
+	featureVersionIDs := make([]int, 0, len(layer.Features))
+	for _, fv := range layer.Features {
+		featureVersionIDs = append(featureVersionIDs, fv.ID)
+	}
+
+	tx, err := datastore.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("SET LOCAL enable_seqscan = off"); err != nil {
+		t.Fatal(err)
+	}
+
+	minConfidence := database.LowConfidence
+	for _, query := range []struct {
+		name  string
+		query string
+		args  []interface{}
+	}{
+		{"searchLayerFeatureVersion", searchLayerFeatureVersion, []interface{}{layer.ID}},
+		{"searchResolvedFeatureVersionVulnerability", searchResolvedFeatureVersionVulnerability, []interface{}{buildInputArray(featureVersionIDs), false, pq.Array([]string(nil)), &minConfidence}},
+		{"searchFeatureVersionVulnerability", searchFeatureVersionVulnerability, []interface{}{buildInputArray(featureVersionIDs), false, pq.Array([]string(nil)), &minConfidence}},
+	} {
+		var explained []byte
+		if err := tx.QueryRow("EXPLAIN (FORMAT JSON) "+query.query, query.args...).Scan(&explained); err != nil {
+			t.Fatalf("could not explain %s: %s", query.name, err)
+		}
+		var plans []struct{ Plan planNode }
+		if err := json.Unmarshal(explained, &plans); err != nil || len(plans) != 1 {
+			t.Fatalf("could not read the plan of %s: %v", query.name, err)
+		}
+		if relations := plans[0].Plan.seqScans(); len(relations) != 0 {
+			t.Errorf("%s scans %v sequentially, want it to use their indexes:\n%s", query.name, relations, explained)
+		}
+	}
+}
+
+// unresolvedFeatureVersions returns those of the feature versions that are not
+// resolved at the current data version of their namespace.
+func unresolvedFeatureVersions(t *testing.T, datastore *pgSQL, featureVersions []database.FeatureVersion) []int {
+	ids := make([]int, 0, len(featureVersions))
+	for _, fv := range featureVersions {
+		ids = append(ids, fv.ID)
+	}
+	rows, err := datastore.Query(searchUnresolvedFeatureVersion, buildInputArray(ids))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	var unresolved []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			t.Fatal(err)
+		}
+		unresolved = append(unresolved, id)
+	}
+	return unresolved
+}
+
+func TestResolvedSourceKeyedVulnerabilities(t *testing.T) {
+	datastore := openDatabaseForTest(t, "ResolvedSourceKeyedVulnerabilities", true)
+	defer datastore.Close()
+
+	mustInsertVulnerabilities(t, datastore, database.Vulnerability{
+		Name:      "CVE-2022-2097",
+		Namespace: debian,
+		Severity:  database.MediumSeverity,
+		FixedIn:   []database.FeatureVersion{debianFeature("openssl", "1.1.1n-0+deb11u4")},
+	})
+
+	libssl := debianFeature("libssl1.1", "1.1.1n-0+deb11u3")
+	libssl.SourceName = "openssl"
+	layer := database.Layer{Name: "TestResolvedSourceKeyedVulnerabilities", EngineVersion: 1, Namespace: &debian, Features: []database.FeatureVersion{libssl}}
+	if err := datastore.InsertLayer(layer); err != nil {
+		t.Fatalf("InsertLayer() failed: %s", err)
+	}
+
+	// findAffectedBy finds the names of the vulnerabilities of libssl1.1 after
+	// checking that they are read from their resolutions, which finding them
+	// does not write.
+	findAffectedBy := func(when string) []string {
+		stored, err := datastore.FindLayer(layer.Name, true, false)
+		if err != nil {
+			t.Fatalf("FindLayer() failed: %s", err)
+		}
+		if unresolved := unresolvedFeatureVersions(t, datastore, stored.Features); len(unresolved) != 0 {
+			t.Errorf("%s, the feature versions %v are not resolved", when, unresolved)
+		}
+
+		found, err := datastore.FindLayer(layer.Name, true, true)
+		if err != nil {
+			t.Fatalf("FindLayer() failed: %s", err)
+		}
+		if len(found.Features) != 1 {
+			t.Fatalf("FindLayer() found %d features, want 1", len(found.Features))
+		}
+		return vulnerabilityNames(found.Features[0].AffectedBy)
+	}
+
+	// The feature version is resolved when it is inserted, along with the fix
+	// of its source package, in another feature.
+	if names := findAffectedBy("once inserted"); len(names) != 1 || names[0] != "CVE-2022-2097" {
+		t.Errorf("FindLayer() found libssl1.1 affected by %v, want [CVE-2022-2097] through its source package", names)
+	}
+
+	// It is resolved again when its namespace is updated.
+	mustInsertVulnerabilities(t, datastore, database.Vulnerability{
+		Name:      "CVE-2023-0286",
+		Namespace: debian,
+		Severity:  database.HighSeverity,
+		FixedIn:   []database.FeatureVersion{debianFeature("openssl", "1.1.1n-0+deb11u5")},
+	})
+	names := findAffectedBy("once the namespace is updated")
+	sort.Strings(names)
+	if len(names) != 2 || names[0] != "CVE-2022-2097" || names[1] != "CVE-2023-0286" {
+		t.Errorf("FindLayer() found libssl1.1 affected by %v, want [CVE-2022-2097 CVE-2023-0286]", names)
+	}
+}
@@ -0,0 +1,92 @@
+package pgsql
+
+import (
+	"context"
+	"time"
+
+	"github.com/lib/pq"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/MXi4oyu/DockerXScan/database"
+)
+
+// maintainedTables are the tables holding the analyses and the
+// vulnerabilities, whose rows are deleted and updated the most, in the lower
+// case in which PostgreSQL stores their names.
+var maintainedTables = []string{
+	"feature",
+	"featureversion",
+	"layer",
+	"layer_diff_featureversion",
+	"namespace",
+	"suppression",
+	"vulnerability",
+	"vulnerability_affects_featureversion",
+	"vulnerability_fixedin_feature",
+	"vulnerability_notification",
+}
+
+func (pgSQL *pgSQL) TableStats() ([]database.TableStats, error) {
+	defer observeQueryTime("TableStats", "all", time.Now())
+
+	rows, err := pgSQL.Query(searchTableStats, pq.Array(maintainedTables))
+	if err != nil {
+		return nil, handleError("searchTableStats", err)
+	}
+	defer rows.Close()
+
+	var stats []database.TableStats
+	for rows.Next() {
+		var s database.TableStats
+		if err := rows.Scan(&s.Name, &s.Size, &s.LiveRows, &s.DeadRows); err != nil {
+			return nil, handleError("searchTableStats.Scan()", err)
+		}
+		stats = append(stats, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, handleError("searchTableStats.Rows()", err)
+	}
+
+	return stats, nil
+}
+
+// Vacuum runs VACUUM ANALYZE, or VACUUM FULL ANALYZE, on each maintained table.
+// As VACUUM can't run in a transaction, the statement timeout is disabled for
+// the session of a dedicated connection instead.
+func (pgSQL *pgSQL) Vacuum(full bool) error {
+	defer observeQueryTime("Vacuum", "all", time.Now())
+
+	ctx := context.Background()
+	conn, err := pgSQL.Conn(ctx)
+	if err != nil {
+		return handleError("Vacuum.Conn()", err)
+	}
+	defer conn.Close()
+
+	if pgSQL.config.StatementTimeout > 0 {
+		if _, err := conn.ExecContext(ctx, disableSessionStatementTimeout); err != nil {
+			return handleError("disableSessionStatementTimeout", err)
+		}
+		// The connection goes back to the pool afterwards.
+		defer conn.ExecContext(ctx, resetStatementTimeout)
+	}
+
+	query := vacuumTable
+	if full {
+		query = vacuumFullTable
+	}
+
+	for _, table := range maintainedTables {
+		t := time.Now()
+		// The names of the tables are constants, and can't be placeholders.
+		_, err := conn.ExecContext(ctx, query+table)
+		observeQueryTime("Vacuum", table, t)
+
+		if err != nil {
+			return handleError("Vacuum", err)
+		}
+		log.WithFields(log.Fields{"table": table, "full": full, "duration": time.Since(t)}).Debug("vacuumed table")
+	}
+
+	return nil
+}
@@ -0,0 +1,15 @@
+package migrations
+
+import "github.com/remind101/migrate"
+
+func init() {
+	RegisterMigration(migrate.Migration{
+		ID: 7,
+		Up: migrate.Queries([]string{
+			`ALTER TABLE Vulnerability ADD COLUMN withdrawn boolean NOT NULL DEFAULT false;`,
+		}),
+		Down: migrate.Queries([]string{
+			`ALTER TABLE Vulnerability DROP COLUMN withdrawn;`,
+		}),
+	})
+}
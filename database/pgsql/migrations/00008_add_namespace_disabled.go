@@ -0,0 +1,15 @@
+package migrations
+
+import "github.com/remind101/migrate"
+
+func init() {
+	RegisterMigration(migrate.Migration{
+		ID: 8,
+		Up: migrate.Queries([]string{
+			`ALTER TABLE Namespace ADD COLUMN disabled boolean NOT NULL DEFAULT false;`,
+		}),
+		Down: migrate.Queries([]string{
+			`ALTER TABLE Namespace DROP COLUMN disabled;`,
+		}),
+	})
+}
@@ -0,0 +1,16 @@
+package migrations
+
+import "github.com/remind101/migrate"
+
+func init() {
+	RegisterMigration(migrate.Migration{
+		ID: 9,
+		Up: migrate.Queries([]string{
+			`ALTER TABLE FeatureVersion ADD COLUMN source_name VARCHAR(128) NULL;`,
+			`CREATE INDEX ON FeatureVersion (source_name);`,
+		}),
+		Down: migrate.Queries([]string{
+			`ALTER TABLE FeatureVersion DROP COLUMN source_name;`,
+		}),
+	})
+}
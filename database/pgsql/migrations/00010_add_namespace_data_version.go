@@ -0,0 +1,15 @@
+package migrations
+
+import "github.com/remind101/migrate"
+
+func init() {
+	RegisterMigration(migrate.Migration{
+		ID: 10,
+		Up: migrate.Queries([]string{
+			`ALTER TABLE Namespace ADD COLUMN data_version INT NOT NULL DEFAULT 0;`,
+		}),
+		Down: migrate.Queries([]string{
+			`ALTER TABLE Namespace DROP COLUMN data_version;`,
+		}),
+	})
+}
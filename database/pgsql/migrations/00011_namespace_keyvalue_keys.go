@@ -0,0 +1,45 @@
+package migrations
+
+import (
+	"fmt"
+
+	"github.com/remind101/migrate"
+)
+
+// renamedKeys maps the flat keys used by the updaters to their keys scoped to
+// the updater's component.
+var renamedKeys = [][2]string{
+	{"updater/last", "updater:last"},
+	{"alpine-secdbUpdater", "alpine:commit"},
+	{"debianUpdater", "debian:hash"},
+	{"debianUpdater/etag", "debian:feed/etag"},
+	{"debianUpdater/last-modified", "debian:feed/last-modified"},
+	{"gentooUpdater", "gentoo:hash"},
+	{"oracleUpdater", "oracle:last-elsa"},
+	{"oracleUpdater/etag", "oracle:feed/etag"},
+	{"oracleUpdater/last-modified", "oracle:feed/last-modified"},
+	{"rhelUpdater", "rhel:last-rhsa"},
+	{"rhelUpdater/etag", "rhel:feed/etag"},
+	{"rhelUpdater/last-modified", "rhel:feed/last-modified"},
+	{"ubuntuUpdater", "ubuntu:revision"},
+}
+
+func renameKeys(reverse bool) []string {
+	var queries []string
+	for _, k := range renamedKeys {
+		from, to := k[0], k[1]
+		if reverse {
+			from, to = to, from
+		}
+		queries = append(queries, fmt.Sprintf(`UPDATE KeyValue SET key = '%s' WHERE key = '%s';`, to, from))
+	}
+	return queries
+}
+
+func init() {
+	RegisterMigration(migrate.Migration{
+		ID:   11,
+		Up:   migrate.Queries(renameKeys(false)),
+		Down: migrate.Queries(renameKeys(true)),
+	})
+}
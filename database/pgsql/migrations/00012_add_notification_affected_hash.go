@@ -0,0 +1,17 @@
+package migrations
+
+import "github.com/remind101/migrate"
+
+func init() {
+	RegisterMigration(migrate.Migration{
+		ID: 12,
+		Up: migrate.Queries([]string{
+			`ALTER TABLE Vulnerability_Notification ADD COLUMN affected_hash VARCHAR(64) NULL;`,
+			`CREATE INDEX vulnerability_notification_affected_hash_idx ON Vulnerability_Notification (affected_hash);`,
+		}),
+		Down: migrate.Queries([]string{
+			`DROP INDEX vulnerability_notification_affected_hash_idx;`,
+			`ALTER TABLE Vulnerability_Notification DROP COLUMN affected_hash;`,
+		}),
+	})
+}
@@ -0,0 +1,17 @@
+package migrations
+
+import "github.com/remind101/migrate"
+
+func init() {
+	RegisterMigration(migrate.Migration{
+		ID: 13,
+		Up: migrate.Queries([]string{
+			`ALTER TABLE Vulnerability ADD COLUMN updated_at TIMESTAMP WITH TIME ZONE NULL;`,
+			`UPDATE Vulnerability SET updated_at = created_at;`,
+			`CREATE INDEX ON Vulnerability (namespace_id, updated_at);`,
+		}),
+		Down: migrate.Queries([]string{
+			`ALTER TABLE Vulnerability DROP COLUMN updated_at;`,
+		}),
+	})
+}
@@ -0,0 +1,21 @@
+package migrations
+
+import "github.com/remind101/migrate"
+
+func init() {
+	RegisterMigration(migrate.Migration{
+		ID: 14,
+		Up: migrate.Queries([]string{
+			`ALTER TABLE Vulnerability ADD COLUMN published_at TIMESTAMP WITH TIME ZONE NULL;`,
+			`ALTER TABLE Vulnerability ADD COLUMN discovered_at TIMESTAMP WITH TIME ZONE NULL;`,
+			`UPDATE Vulnerability v SET discovered_at = (
+				SELECT MIN(o.created_at) FROM Vulnerability o
+				WHERE o.namespace_id = v.namespace_id AND o.name = v.name);`,
+			`UPDATE Vulnerability SET published_at = discovered_at;`,
+		}),
+		Down: migrate.Queries([]string{
+			`ALTER TABLE Vulnerability DROP COLUMN published_at;`,
+			`ALTER TABLE Vulnerability DROP COLUMN discovered_at;`,
+		}),
+	})
+}
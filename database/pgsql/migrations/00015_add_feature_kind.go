@@ -0,0 +1,18 @@
+package migrations
+
+import "github.com/remind101/migrate"
+
+func init() {
+	RegisterMigration(migrate.Migration{
+		ID: 15,
+		Up: migrate.Queries([]string{
+			`ALTER TABLE Feature ADD COLUMN kind VARCHAR(16) NULL;`,
+			// The conda namespace is the only one that is not a distribution.
+			`UPDATE Feature f SET kind = CASE WHEN n.name = 'conda' THEN 'application' ELSE 'os' END
+				FROM Namespace n WHERE f.namespace_id = n.id;`,
+		}),
+		Down: migrate.Queries([]string{
+			`ALTER TABLE Feature DROP COLUMN kind;`,
+		}),
+	})
+}
@@ -0,0 +1,21 @@
+package migrations
+
+import "github.com/remind101/migrate"
+
+func init() {
+	RegisterMigration(migrate.Migration{
+		ID: 16,
+		Up: migrate.Queries([]string{
+			// The features found in a nested root of an image are tagged with
+			// it, and a feature may be found in several roots of a layer.
+			`ALTER TABLE Layer_diff_FeatureVersion ADD COLUMN root VARCHAR(256) NOT NULL DEFAULT '';`,
+			`ALTER TABLE Layer_diff_FeatureVersion DROP CONSTRAINT layer_diff_featureversion_layer_id_featureversion_id_key;`,
+			`ALTER TABLE Layer_diff_FeatureVersion ADD UNIQUE (layer_id, featureversion_id, root);`,
+		}),
+		Down: migrate.Queries([]string{
+			`DELETE FROM Layer_diff_FeatureVersion WHERE root <> '';`,
+			`ALTER TABLE Layer_diff_FeatureVersion DROP COLUMN root;`,
+			`ALTER TABLE Layer_diff_FeatureVersion ADD UNIQUE (layer_id, featureversion_id);`,
+		}),
+	})
+}
@@ -0,0 +1,18 @@
+package migrations
+
+import "github.com/remind101/migrate"
+
+func init() {
+	RegisterMigration(migrate.Migration{
+		ID: 17,
+		Up: migrate.Queries([]string{
+			`ALTER TABLE Namespace ADD COLUMN kind VARCHAR(16) NULL;`,
+			// The cargo and conda namespaces are the only ones that are not
+			// distributions.
+			`UPDATE Namespace SET kind = CASE WHEN name IN ('cargo', 'conda') THEN 'language' ELSE 'distro' END;`,
+		}),
+		Down: migrate.Queries([]string{
+			`ALTER TABLE Namespace DROP COLUMN kind;`,
+		}),
+	})
+}
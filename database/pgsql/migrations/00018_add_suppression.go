@@ -0,0 +1,27 @@
+package migrations
+
+import "github.com/remind101/migrate"
+
+func init() {
+	RegisterMigration(migrate.Migration{
+		ID: 18,
+		Up: migrate.Queries([]string{
+			// The suppressions refer to their namespace by name, so that they
+			// can be set before a namespace is first updated and survive its
+			// vulnerabilities being replaced.
+			`CREATE TABLE IF NOT EXISTS Suppression (
+        id SERIAL PRIMARY KEY,
+        namespace_name VARCHAR(128) NOT NULL,
+        feature_name VARCHAR(128) NOT NULL,
+        vulnerability_name VARCHAR(128) NOT NULL,
+        justification TEXT NOT NULL,
+        author VARCHAR(128) NOT NULL,
+        created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+        expires_at TIMESTAMP WITH TIME ZONE NULL,
+        UNIQUE (namespace_name, feature_name, vulnerability_name));`,
+		}),
+		Down: migrate.Queries([]string{
+			`DROP TABLE IF EXISTS Suppression;`,
+		}),
+	})
+}
@@ -0,0 +1,17 @@
+package migrations
+
+import "github.com/remind101/migrate"
+
+func init() {
+	RegisterMigration(migrate.Migration{
+		ID: 19,
+		Up: migrate.Queries([]string{
+			// The file in which a feature has been found is stored by layer, as
+			// the same feature version is found at different paths by images.
+			`ALTER TABLE Layer_diff_FeatureVersion ADD COLUMN location TEXT NOT NULL DEFAULT '';`,
+		}),
+		Down: migrate.Queries([]string{
+			`ALTER TABLE Layer_diff_FeatureVersion DROP COLUMN location;`,
+		}),
+	})
+}
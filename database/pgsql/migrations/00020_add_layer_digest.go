@@ -0,0 +1,19 @@
+package migrations
+
+import "github.com/remind101/migrate"
+
+func init() {
+	RegisterMigration(migrate.Migration{
+		ID: 20,
+		Up: migrate.Queries([]string{
+			// The digest of the content of a layer finds it again for an image
+			// known by its manifest, without its name.
+			`ALTER TABLE Layer ADD COLUMN digest VARCHAR(128) NOT NULL DEFAULT '';`,
+			`CREATE INDEX layer_digest_idx ON Layer (digest) WHERE digest <> '';`,
+		}),
+		Down: migrate.Queries([]string{
+			`DROP INDEX layer_digest_idx;`,
+			`ALTER TABLE Layer DROP COLUMN digest;`,
+		}),
+	})
+}
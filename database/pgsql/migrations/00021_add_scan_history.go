@@ -0,0 +1,28 @@
+package migrations
+
+import "github.com/remind101/migrate"
+
+func init() {
+	RegisterMigration(migrate.Migration{
+		ID: 21,
+		Up: migrate.Queries([]string{
+			// A scan is recorded once per digest and tag, so that scanning an
+			// image again replaces its summary while a tag moved to another
+			// digest adds to the history of the repository.
+			`CREATE TABLE IF NOT EXISTS ScanHistory (
+        id SERIAL PRIMARY KEY,
+        digest VARCHAR(128) NOT NULL,
+        tag VARCHAR(256) NOT NULL,
+        repository VARCHAR(256) NOT NULL,
+        vulnerabilities INT NOT NULL,
+        fixable INT NOT NULL,
+        severities TEXT NOT NULL,
+        scanned_at TIMESTAMP WITH TIME ZONE NOT NULL,
+        UNIQUE (digest, tag));`,
+			`CREATE INDEX scanhistory_repository_scanned_at_idx ON ScanHistory (repository, scanned_at);`,
+		}),
+		Down: migrate.Queries([]string{
+			`DROP TABLE IF EXISTS ScanHistory;`,
+		}),
+	})
+}
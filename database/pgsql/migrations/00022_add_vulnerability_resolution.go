@@ -0,0 +1,21 @@
+package migrations
+
+import "github.com/remind101/migrate"
+
+func init() {
+	RegisterMigration(migrate.Migration{
+		ID: 22,
+		Up: migrate.Queries([]string{
+			// The vulnerabilities affecting a feature version, resolved at the
+			// data version of its namespace: the resolution is stale once the
+			// data version advances.
+			`CREATE TABLE IF NOT EXISTS VulnerabilityResolution (
+        featureversion_id INT PRIMARY KEY REFERENCES FeatureVersion ON DELETE CASCADE,
+        data_version INT NOT NULL,
+        vulnerability_ids INT[] NOT NULL);`,
+		}),
+		Down: migrate.Queries([]string{
+			`DROP TABLE IF EXISTS VulnerabilityResolution;`,
+		}),
+	})
+}
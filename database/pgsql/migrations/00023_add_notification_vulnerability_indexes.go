@@ -0,0 +1,19 @@
+package migrations
+
+import "github.com/remind101/migrate"
+
+func init() {
+	RegisterMigration(migrate.Migration{
+		ID: 23,
+		Up: migrate.Queries([]string{
+			// Purging the deleted vulnerabilities looks up and cascades to the
+			// notifications referencing them.
+			`CREATE INDEX vulnerability_notification_old_vulnerability_id_idx ON Vulnerability_Notification (old_vulnerability_id);`,
+			`CREATE INDEX vulnerability_notification_new_vulnerability_id_idx ON Vulnerability_Notification (new_vulnerability_id);`,
+		}),
+		Down: migrate.Queries([]string{
+			`DROP INDEX vulnerability_notification_old_vulnerability_id_idx;`,
+			`DROP INDEX vulnerability_notification_new_vulnerability_id_idx;`,
+		}),
+	})
+}
@@ -0,0 +1,19 @@
+package migrations
+
+import "github.com/remind101/migrate"
+
+func init() {
+	RegisterMigration(migrate.Migration{
+		ID: 24,
+		Up: migrate.Queries([]string{
+			// The confidence types are ordered from the lowest to the highest,
+			// so that they compare as database.Confidence does.
+			`CREATE TYPE confidence AS ENUM ('Low', 'High');`,
+			`ALTER TABLE Vulnerability ADD COLUMN confidence confidence NOT NULL DEFAULT 'High';`,
+		}),
+		Down: migrate.Queries([]string{
+			`ALTER TABLE Vulnerability DROP COLUMN confidence;`,
+			`DROP TYPE confidence;`,
+		}),
+	})
+}
@@ -0,0 +1,21 @@
+package migrations
+
+import "github.com/remind101/migrate"
+
+func init() {
+	RegisterMigration(migrate.Migration{
+		ID: 25,
+		Up: migrate.Queries([]string{
+			// The resolutions hold the fixes of the vulnerabilities rather than
+			// the vulnerabilities, so that those found through the source
+			// package of a feature version are read back. They are resolved
+			// again from Vulnerability_Affects_FeatureVersion.
+			`TRUNCATE VulnerabilityResolution;`,
+			`ALTER TABLE VulnerabilityResolution DROP COLUMN vulnerability_ids, ADD COLUMN fixedin_ids INT[] NOT NULL;`,
+		}),
+		Down: migrate.Queries([]string{
+			`TRUNCATE VulnerabilityResolution;`,
+			`ALTER TABLE VulnerabilityResolution DROP COLUMN fixedin_ids, ADD COLUMN vulnerability_ids INT[] NOT NULL;`,
+		}),
+	})
+}
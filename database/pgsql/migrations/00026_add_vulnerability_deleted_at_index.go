@@ -0,0 +1,17 @@
+package migrations
+
+import "github.com/remind101/migrate"
+
+func init() {
+	RegisterMigration(migrate.Migration{
+		ID: 26,
+		Up: migrate.Queries([]string{
+			// The vulnerabilities deleted since a time are listed along with
+			// those modified since then.
+			`CREATE INDEX vulnerability_namespace_id_deleted_at_idx ON Vulnerability (namespace_id, deleted_at);`,
+		}),
+		Down: migrate.Queries([]string{
+			`DROP INDEX vulnerability_namespace_id_deleted_at_idx;`,
+		}),
+	})
+}
@@ -0,0 +1,17 @@
+package migrations
+
+import "github.com/remind101/migrate"
+
+func init() {
+	RegisterMigration(migrate.Migration{
+		ID: 27,
+		Up: migrate.Queries([]string{
+			// The confidence of a link is low when the version of the feature
+			// could not be compared to the fixed version.
+			`ALTER TABLE Vulnerability_Affects_FeatureVersion ADD COLUMN confidence confidence NOT NULL DEFAULT 'High';`,
+		}),
+		Down: migrate.Queries([]string{
+			`ALTER TABLE Vulnerability_Affects_FeatureVersion DROP COLUMN confidence;`,
+		}),
+	})
+}
@@ -4,6 +4,8 @@ import (
 	"github.com/MXi4oyu/DockerXScan/common/commonerr"
 	"github.com/MXi4oyu/DockerXScan/database"
 	"time"
+
+	log "github.com/sirupsen/logrus"
 )
 
 //插入一条namespace数据
@@ -12,6 +14,11 @@ func (pgSQL *pgSQL)InsertNamespace(namespace database.Namespace) (int ,error)  {
 	if namespace.Name == "" {
 		return 0, commonerr.NewBadRequestError("could not find/insert invalid Namespace")
 	}
+	if namespace.Kind == "" {
+		namespace.Kind = database.DistroNamespace
+	} else if !namespace.Kind.Valid() {
+		return 0, commonerr.NewBadRequestError("could not find/insert Namespace of invalid kind " + string(namespace.Kind))
+	}
 
 	if pgSQL.cache != nil {
 		promCacheQueriesTotal.WithLabelValues("namespace").Inc()
@@ -25,7 +32,7 @@ func (pgSQL *pgSQL)InsertNamespace(namespace database.Namespace) (int ,error)  {
 	defer observeQueryTime("insertNamespace", "all", time.Now())
 
 	var id int
-	err := pgSQL.QueryRow(soiNamespace, namespace.Name, namespace.VersionFormat).Scan(&id)
+	err := pgSQL.QueryRow(soiNamespace, namespace.Name, namespace.VersionFormat, string(namespace.Kind)).Scan(&id)
 	if err != nil {
 		return 0, handleError("soiNamespace", err)
 	}
@@ -48,7 +55,7 @@ func (pgSQL *pgSQL) ListNamespaces()  (namespaces []database.Namespace, err erro
 	for rows.Next() {
 		var ns database.Namespace
 
-		err = rows.Scan(&ns.ID, &ns.Name, &ns.VersionFormat)
+		err = rows.Scan(&ns.ID, &ns.Name, &ns.VersionFormat, &ns.Disabled, &ns.DataVersion, &ns.Kind)
 		if err != nil {
 			return namespaces, handleError("listNamespace.Scan()", err)
 		}
@@ -61,3 +68,37 @@ func (pgSQL *pgSQL) ListNamespaces()  (namespaces []database.Namespace, err erro
 
 	return namespaces, err
 }
+
+func (pgSQL *pgSQL) FindNamespace(name string) (database.Namespace, error) {
+	defer observeQueryTime("FindNamespace", "all", time.Now())
+
+	var ns database.Namespace
+	err := pgSQL.QueryRow(findNamespace, name).Scan(&ns.ID, &ns.Name, &ns.VersionFormat, &ns.Disabled, &ns.DataVersion, &ns.Kind)
+	if err != nil {
+		return ns, handleError("findNamespace", err)
+	}
+
+	return ns, nil
+}
+
+func (pgSQL *pgSQL) SetNamespaceEnabled(name string, enabled bool) error {
+	defer observeQueryTime("SetNamespaceEnabled", "all", time.Now())
+
+	result, err := pgSQL.Exec(updateNamespaceDisabled, name, !enabled)
+	if err != nil {
+		return handleError("updateNamespaceDisabled", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return handleError("updateNamespaceDisabled.RowsAffected()", err)
+	}
+
+	if affected <= 0 {
+		return commonerr.ErrNotFound
+	}
+
+	log.WithFields(log.Fields{"namespace": name, "enabled": enabled}).Info("namespace state changed")
+
+	return nil
+}
@@ -1,25 +1,62 @@
 package pgsql
 
 import (
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
+	"strconv"
 	"time"
 
 	"github.com/guregu/null/zero"
+	"github.com/lib/pq"
 	"github.com/pborman/uuid"
 	log "github.com/sirupsen/logrus"
 	"github.com/MXi4oyu/DockerXScan/database"
 	"github.com/MXi4oyu/DockerXScan/common/commonerr"
 )
 
+// claimNotificationsSpread is how many times more of the oldest notifications
+// than it claims ClaimNotifications picks its batch from at random, so that the
+// owners claiming batches at once contend less for the same notifications.
+const claimNotificationsSpread = 4
+
 // do it in tx so we won't insert/update a vuln without notification and vice-versa.
 // name and created doesn't matter.
-func createNotification(tx *sql.Tx, oldVulnerabilityID, newVulnerabilityID int) error {
+//
+// With dedup, no notification is created if one that is not deleted yet has
+// been created for the same vulnerability affecting the same feature versions.
+func createNotification(tx *sql.Tx, oldVulnerabilityID, newVulnerabilityID int, dedup bool) error {
 	defer observeQueryTime("createNotification", "all", time.Now())
 
+	// Hash the feature versions affected by the new vulnerability. A deletion
+	// has no hash, so that it is never skipped.
+	var affectedHash sql.NullString
+	if newVulnerabilityID != 0 {
+		hash, err := hashAffectedFeatureVersions(tx, newVulnerabilityID)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		affectedHash = sql.NullString{String: hash, Valid: true}
+
+		if dedup {
+			var duplicate bool
+			err := tx.QueryRow(searchNotificationDuplicate, newVulnerabilityID, hash).Scan(&duplicate)
+			if err != nil {
+				tx.Rollback()
+				return handleError("searchNotificationDuplicate", err)
+			}
+			if duplicate {
+				log.WithField("vulnerability id", newVulnerabilityID).Debug("skipping duplicate notification")
+				return nil
+			}
+		}
+	}
+
 	// Insert Notification.
 	oldVulnerabilityNullableID := sql.NullInt64{Int64: int64(oldVulnerabilityID), Valid: oldVulnerabilityID != 0}
 	newVulnerabilityNullableID := sql.NullInt64{Int64: int64(newVulnerabilityID), Valid: newVulnerabilityID != 0}
-	_, err := tx.Exec(insertNotification, uuid.New(), oldVulnerabilityNullableID, newVulnerabilityNullableID)
+	_, err := tx.Exec(insertNotification, uuid.New(), oldVulnerabilityNullableID, newVulnerabilityNullableID, affectedHash)
 	if err != nil {
 		tx.Rollback()
 		return handleError("insertNotification", err)
@@ -28,16 +65,91 @@ func createNotification(tx *sql.Tx, oldVulnerabilityID, newVulnerabilityID int)
 	return nil
 }
 
+// hashAffectedFeatureVersions returns the SHA-256 of the sorted IDs of the
+// feature versions affected by a vulnerability.
+func hashAffectedFeatureVersions(tx *sql.Tx, vulnerabilityID int) (string, error) {
+	rows, err := tx.Query(searchVulnerabilityAffectedFeatureVersions, vulnerabilityID)
+	if err != nil {
+		return "", handleError("searchVulnerabilityAffectedFeatureVersions", err)
+	}
+	defer rows.Close()
+
+	h := sha256.New()
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return "", handleError("searchVulnerabilityAffectedFeatureVersions.Scan()", err)
+		}
+		h.Write([]byte(strconv.Itoa(id) + ","))
+	}
+	if err := rows.Err(); err != nil {
+		return "", handleError("searchVulnerabilityAffectedFeatureVersions.Rows()", err)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
 // Get one available notification name (!locked && !deleted && (!notified || notified_but_timed-out)).
 // Does not fill new/old vuln.
-func (pgSQL *pgSQL) GetAvailableNotification(renotifyInterval time.Duration) (database.VulnerabilityNotification, error) {
+func (pgSQL *pgSQL) GetAvailableNotification(renotifyInterval, gracePeriod time.Duration) (database.VulnerabilityNotification, error) {
+	return pgSQL.GetAvailableNotificationWithSeverity(renotifyInterval, gracePeriod, database.UnknownSeverity)
+}
+
+func (pgSQL *pgSQL) GetAvailableNotificationWithSeverity(renotifyInterval, gracePeriod time.Duration, minSeverity database.Severity) (database.VulnerabilityNotification, error) {
 	defer observeQueryTime("GetAvailableNotification", "all", time.Now())
 
-	before := time.Now().Add(-renotifyInterval)
-	row := pgSQL.QueryRow(searchNotificationAvailable, before)
+	now := time.Now()
+	if minSeverity.Compare(database.UnknownSeverity) <= 0 {
+		row := pgSQL.QueryRow(searchNotificationAvailable, now.Add(-renotifyInterval), now.Add(-gracePeriod))
+		notification, err := pgSQL.scanNotification(row, false)
+
+		return notification, handleError("searchNotificationAvailable", err)
+	}
+
+	row := pgSQL.QueryRow(searchNotificationAvailableWithSeverity, now.Add(-renotifyInterval), now.Add(-gracePeriod), pq.Array(severitiesAtLeast(minSeverity)))
 	notification, err := pgSQL.scanNotification(row, false)
 
-	return notification, handleError("searchNotificationAvailable", err)
+	return notification, handleError("searchNotificationAvailableWithSeverity", err)
+}
+
+func (pgSQL *pgSQL) ClaimNotifications(owner string, limit int, lease time.Duration) ([]database.VulnerabilityNotification, error) {
+	if owner == "" || limit <= 0 || lease <= 0 {
+		return nil, commonerr.NewBadRequestError("could not claim notifications with an invalid owner, limit or lease")
+	}
+
+	defer observeQueryTime("ClaimNotifications", "all", time.Now())
+
+	// The expired leases are released, for their notifications to be retried.
+	pgSQL.pruneLocks()
+
+	// The notifications claimed by another owner meanwhile are left out of the
+	// batch rather than failing it.
+	until := time.Now().Add(lease)
+	rows, err := pgSQL.Query(claimNotifications, owner, until, limit, limit*claimNotificationsSpread)
+	if err != nil {
+		return nil, handleError("claimNotifications", err)
+	}
+	defer rows.Close()
+
+	var notifications []database.VulnerabilityNotification
+	for rows.Next() {
+		var notification database.VulnerabilityNotification
+		var created, notified, deleted zero.Time
+
+		if err := rows.Scan(&notification.ID, &notification.Name, &created, &notified, &deleted); err != nil {
+			return nil, handleError("claimNotifications.Scan()", err)
+		}
+		notification.Created = created.Time
+		notification.Notified = notified.Time
+		notification.Deleted = deleted.Time
+
+		notifications = append(notifications, notification)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, handleError("claimNotifications.Rows()", err)
+	}
+
+	return notifications, nil
 }
 
 func (pgSQL *pgSQL) GetNotification(name string, limit int, page database.VulnerabilityNotificationPageNumber) (database.VulnerabilityNotification, database.VulnerabilityNotificationPageNumber, error) {
@@ -215,6 +327,19 @@ func (pgSQL *pgSQL) SetNotificationNotified(name string) error {
 	return nil
 }
 
+// SetNotificationsNotified marks several notifications as notified at once.
+func (pgSQL *pgSQL) SetNotificationsNotified(names []string) error {
+	if len(names) == 0 {
+		return nil
+	}
+	defer observeQueryTime("SetNotificationsNotified", "all", time.Now())
+
+	if _, err := pgSQL.Exec(updatedNotificationsNotified, pq.Array(names)); err != nil {
+		return handleError("updatedNotificationsNotified", err)
+	}
+	return nil
+}
+
 func (pgSQL *pgSQL) DeleteNotification(name string) error {
 	defer observeQueryTime("DeleteNotification", "all", time.Now())
 
@@ -233,4 +358,29 @@ func (pgSQL *pgSQL) DeleteNotification(name string) error {
 	}
 
 	return nil
-}
\ No newline at end of file
+}
+
+// DeleteNotifications deletes several notifications at once. It returns
+// commonerr.ErrNotFound only if none of them exists.
+func (pgSQL *pgSQL) DeleteNotifications(names []string) error {
+	if len(names) == 0 {
+		return nil
+	}
+	defer observeQueryTime("DeleteNotifications", "all", time.Now())
+
+	result, err := pgSQL.Exec(removeNotifications, pq.Array(names))
+	if err != nil {
+		return handleError("removeNotifications", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return handleError("removeNotifications.RowsAffected()", err)
+	}
+
+	if affected <= 0 {
+		return commonerr.ErrNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,76 @@
+package pgsql
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestClaimNotificationsConcurrently(t *testing.T) {
+	datastore := openDatabaseForTest(t, "ClaimNotificationsConcurrently", true)
+	defer datastore.Close()
+
+	// Each new vulnerability is notified.
+	vulnerabilities, _ := syntheticFeed(50)
+	if err := datastore.InsertVulnerabilities(vulnerabilities, true); err != nil {
+		t.Fatalf("InsertVulnerabilities() failed: %s", err)
+	}
+	var available int
+	if err := datastore.QueryRow("SELECT COUNT(*) FROM Vulnerability_Notification WHERE notified_at IS NULL AND deleted_at IS NULL").Scan(&available); err != nil {
+		t.Fatal(err)
+	}
+	if available < len(vulnerabilities) {
+		t.Fatalf("the database holds %d notifications, want at least %d", available, len(vulnerabilities))
+	}
+
+	// Two notifiers claim batches at once until all of them are claimed, none
+	// of those leased to one being claimed by the other.
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		claimed = make(map[string]string)
+		start   = make(chan struct{})
+	)
+	for _, owner := range []string{"notifier-a", "notifier-b"} {
+		wg.Add(1)
+		go func(owner string) {
+			defer wg.Done()
+			<-start
+			for attempt := 0; attempt < available; attempt++ {
+				notifications, err := datastore.ClaimNotifications(owner, 3, time.Minute)
+				if err != nil {
+					t.Errorf("ClaimNotifications(%s) failed: %s", owner, err)
+					return
+				}
+
+				mu.Lock()
+				for _, n := range notifications {
+					if other, ok := claimed[n.Name]; ok {
+						t.Errorf("ClaimNotifications(%s) claimed %s, already leased to %s", owner, n.Name, other)
+					}
+					claimed[n.Name] = owner
+				}
+				done := len(claimed) >= available
+				mu.Unlock()
+				if done {
+					return
+				}
+			}
+		}(owner)
+	}
+	close(start)
+	wg.Wait()
+
+	if len(claimed) != available {
+		t.Errorf("the notifiers claimed %d notifications, want %d", len(claimed), available)
+	}
+
+	// They stay leased until they expire.
+	notifications, err := datastore.ClaimNotifications("notifier-c", 3, time.Minute)
+	if err != nil {
+		t.Fatalf("ClaimNotifications() failed: %s", err)
+	}
+	if len(notifications) != 0 {
+		t.Errorf("ClaimNotifications() claimed %d notifications leased to other notifiers, want none", len(notifications))
+	}
+}
@@ -3,8 +3,11 @@ package pgsql
 import (
 	"database/sql"
 	"fmt"
+	"hash/crc32"
 	"io/ioutil"
 	"net/url"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -54,6 +57,7 @@ func init() {
 	prometheus.MustRegister(promConcurrentLockVAFV)
 
 	database.Register("pgsql", openDatabase)
+	database.RegisterValidator("pgsql", validateConfig)
 }
 type Queryer interface {
 	Query(query string, args ...interface{}) (*sql.Rows, error)
@@ -62,8 +66,9 @@ type Queryer interface {
 
 type pgSQL struct {
 	*sql.DB
-	cache  *lru.ARCCache
-	config Config
+	cache   *lru.ARCCache
+	inserts *insertGroup
+	config  Config
 }
 
 // Close closes the database and destroys if ManageDatabaseLifecycle has been specified in
@@ -89,6 +94,28 @@ type Config struct {
 	Source    string
 	CacheSize int
 
+	// DeduplicateNotifications skips the notifications of vulnerabilities
+	// that affect the same features as a notification not deleted yet.
+	DeduplicateNotifications bool
+
+	// DeduplicateInserts makes the concurrent insertions of the same
+	// FeatureVersion share a single query, rather than contend for the
+	// Vulnerability_Affects_FeatureVersion lock. It is enabled in default.
+	DeduplicateInserts bool
+
+	// StatementTimeout makes the server cancel the queries that run for
+	// longer, which then fail with database.ErrTimeout. Waiting for a lock
+	// counts against it, so the batch operations that lock
+	// Vulnerability_Affects_FeatureVersion for long (InsertVulnerabilities,
+	// RepairConsistency and PruneUnreferencedVulnerabilities) opt out of it.
+	// Zero, the default, disables it.
+	StatementTimeout time.Duration
+
+	// InsertBatchSize is the number of vulnerabilities InsertVulnerabilities
+	// inserts in a single transaction, 100 in default. One inserts each in
+	// its own transaction.
+	InsertBatchSize int
+
 	ManageDatabaseLifecycle bool
 	FixturePath             string
 }
@@ -104,16 +131,13 @@ func openDatabase(registrableComponentConfig database.RegistrableComponentConfig
 	var err error
 
 	// Parse configuration.
-	pg.config = Config{
-		CacheSize: 16384,
-	}
-	bytes, err := yaml.Marshal(registrableComponentConfig.Options)
+	pg.config, err = loadConfig(registrableComponentConfig, yaml.Unmarshal)
 	if err != nil {
-		return nil, fmt.Errorf("pgsql: could not load configuration: %v", err)
+		return nil, err
 	}
-	err = yaml.Unmarshal(bytes, &pg.config)
-	if err != nil {
-		return nil, fmt.Errorf("pgsql: could not load configuration: %v", err)
+
+	if pg.config.InsertBatchSize < 1 {
+		return nil, commonerr.NewBadRequestError("pgsql: the insert batch size must be at least one")
 	}
 
 	dbName, pgSourceURL, err := parseConnectionString(pg.config.Source)
@@ -130,7 +154,11 @@ func openDatabase(registrableComponentConfig database.RegistrableComponentConfig
 	}
 
 	// Open database.
-	pg.DB, err = sql.Open("postgres", pg.config.Source)
+	source := pg.config.Source
+	if pg.config.StatementTimeout > 0 {
+		source = withStatementTimeout(source, pg.config.StatementTimeout)
+	}
+	pg.DB, err = sql.Open("postgres", source)
 	if err != nil {
 		pg.Close()
 		return nil, fmt.Errorf("pgsql: could not open database: %v", err)
@@ -170,10 +198,55 @@ func openDatabase(registrableComponentConfig database.RegistrableComponentConfig
 	if pg.config.CacheSize > 0 {
 		pg.cache, _ = lru.NewARC(pg.config.CacheSize)
 	}
+	if pg.config.DeduplicateInserts {
+		pg.inserts = newInsertGroup()
+	}
 
 	return &pg, nil
 }
 
+// loadConfig parses the options of the configuration over the defaults.
+func loadConfig(registrableComponentConfig database.RegistrableComponentConfig, unmarshal func([]byte, interface{}) error) (Config, error) {
+	config := Config{
+		CacheSize:          16384,
+		DeduplicateInserts: true,
+		InsertBatchSize:    100,
+	}
+	bytes, err := yaml.Marshal(registrableComponentConfig.Options)
+	if err != nil {
+		return config, fmt.Errorf("pgsql: could not load configuration: %v", err)
+	}
+	if err = unmarshal(bytes, &config); err != nil {
+		return config, fmt.Errorf("pgsql: could not load configuration: %v", err)
+	}
+	return config, nil
+}
+
+// validateConfig returns the problems of a configuration that openDatabase
+// would report, along with the options it does not know of, such as a
+// misspelled one that it would silently ignore.
+func validateConfig(registrableComponentConfig database.RegistrableComponentConfig) []error {
+	var errs []error
+	if _, err := loadConfig(registrableComponentConfig, yaml.UnmarshalStrict); err != nil {
+		errs = append(errs, err)
+	}
+
+	// The options are loaded again leniently, so that the other problems are
+	// reported along with the unknown options.
+	config, err := loadConfig(registrableComponentConfig, yaml.Unmarshal)
+	if err != nil {
+		return errs
+	}
+	if _, _, err := parseConnectionString(config.Source); err != nil {
+		errs = append(errs, err)
+	}
+	if config.InsertBatchSize < 1 {
+		errs = append(errs, commonerr.NewBadRequestError("pgsql: the insert batch size must be at least one"))
+	}
+
+	return errs
+}
+
 func parseConnectionString(source string) (dbName string, pgSourceURL string, err error) {
 	if source == "" {
 		return "", "", commonerr.NewBadRequestError("pgsql: no database connection string specified")
@@ -193,19 +266,114 @@ func parseConnectionString(source string) (dbName string, pgSourceURL string, er
 	return
 }
 
-// migrate runs all available migrations on a pgSQL database.
+// withStatementTimeout adds the statement_timeout run-time parameter, in
+// milliseconds, to a connection string, so that it is set on every connection.
+func withStatementTimeout(source string, timeout time.Duration) string {
+	sourceURL, err := url.Parse(source)
+	if err != nil {
+		return source
+	}
+
+	query := sourceURL.Query()
+	query.Set("statement_timeout", strconv.FormatInt(int64(timeout/time.Millisecond), 10))
+	sourceURL.RawQuery = query.Encode()
+	return sourceURL.String()
+}
+
+// allowLongTransaction disables the statement timeout for the rest of a
+// transaction.
+func (pgSQL *pgSQL) allowLongTransaction(tx *sql.Tx) error {
+	if pgSQL.config.StatementTimeout <= 0 {
+		return nil
+	}
+
+	_, err := tx.Exec(disableStatementTimeout)
+	return err
+}
+
+// migrationsLockKey is the key of the advisory lock held while migrating, which
+// is the one used by migrate.NewPostgresMigrator so that older instances wait
+// as well.
+var migrationsLockKey = int64(crc32.ChecksumIEEE([]byte("migrations")))
+
+// migrateDatabase runs all available migrations on a pgSQL database.
+//
+// The migrations run in a single transaction holding an advisory lock, so
+// that when several instances are started at once against a fresh database,
+// only one of them migrates it while the others wait and then find it up to
+// date. The schema version found once migrated must be the one of the latest
+// migration, which fails the instances older than the database.
 func migrateDatabase(db *sql.DB) error {
 	log.Info("running database migrations")
 
-	err := migrate.NewPostgresMigrator(db).Exec(migrate.Up, migrations.Migrations...)
+	tx, err := db.Begin()
 	if err != nil {
-		return fmt.Errorf("pgsql: an error occured while running migrations: %v", err)
+		return fmt.Errorf("pgsql: could not begin the migrations: %v", err)
+	}
+
+	if err := runMigrations(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("pgsql: could not commit the migrations: %v", err)
 	}
 
 	log.Info("database migration ran successfully")
 	return nil
 }
 
+func runMigrations(tx *sql.Tx) error {
+	// The lock is released when the transaction ends, on the same connection.
+	if _, err := tx.Exec(lockMigrations, migrationsLockKey); err != nil {
+		return fmt.Errorf("pgsql: could not lock the migrations: %v", err)
+	}
+	if _, err := tx.Exec(disableStatementTimeout); err != nil {
+		return fmt.Errorf("pgsql: an error occured while running migrations: %v", err)
+	}
+	if _, err := tx.Exec(fmt.Sprintf(createMigrationsTable, migrate.DefaultTable)); err != nil {
+		return fmt.Errorf("pgsql: an error occured while running migrations: %v", err)
+	}
+
+	sorted := append([]migrate.Migration(nil), migrations.Migrations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].ID < sorted[j].ID })
+
+	for _, migration := range sorted {
+		var done bool
+		err := tx.QueryRow(fmt.Sprintf(searchMigration, migrate.DefaultTable), migration.ID).Scan(&done)
+		if err != nil && err != sql.ErrNoRows {
+			return fmt.Errorf("pgsql: an error occured while running migrations: %v", err)
+		}
+		if done {
+			continue
+		}
+
+		log.WithField("migration", migration.ID).Info("running database migration")
+		if err := migration.Up(tx); err != nil {
+			return fmt.Errorf("pgsql: an error occured while running migrations: %v", &migrate.MigrationError{Migration: migration, Err: err})
+		}
+		if _, err := tx.Exec(fmt.Sprintf(insertMigration, migrate.DefaultTable), migration.ID); err != nil {
+			return fmt.Errorf("pgsql: an error occured while running migrations: %v", err)
+		}
+	}
+
+	// Verify the schema version.
+	var expected int
+	if len(sorted) > 0 {
+		expected = sorted[len(sorted)-1].ID
+	}
+	var version sql.NullInt64
+	if err := tx.QueryRow(fmt.Sprintf(searchSchemaVersion, migrate.DefaultTable)).Scan(&version); err != nil {
+		return fmt.Errorf("pgsql: could not read the schema version: %v", err)
+	}
+	if int(version.Int64) != expected {
+		return fmt.Errorf("pgsql: the database schema is at version %d but version %d is expected; the database may have been migrated by a newer version", version.Int64, expected)
+	}
+
+	return nil
+}
+
 // createDatabase creates a new database.
 // The source parameter should not contain a dbname.
 func createDatabase(source, dbName string) error {
@@ -266,11 +434,18 @@ func handleError(desc string, err error) error {
 	log.WithError(err).WithField("Description", desc).Error("Handled Database Error")
 	promErrorsTotal.WithLabelValues(desc).Inc()
 
-	if _, o := err.(*pq.Error); o || err == sql.ErrTxDone || strings.HasPrefix(err.Error(), "sql:") {
-		return database.ErrBackendException
+	if isErrQueryCanceled(err) {
+		return &database.BackendError{Op: desc, Err: database.ErrTimeout}
 	}
 
-	return err
+	return &database.BackendError{Op: desc, Err: err}
+}
+
+// isErrQueryCanceled determines if the given error is a query cancelled by the
+// server, such as when it exceeds the statement timeout.
+func isErrQueryCanceled(err error) bool {
+	pqErr, ok := err.(*pq.Error)
+	return ok && pqErr.Code == "57014"
 }
 
 // isErrUniqueViolation determines is the given error is a unique contraint violation.
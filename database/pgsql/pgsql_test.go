@@ -0,0 +1,234 @@
+package pgsql
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/lib/pq"
+	"github.com/pborman/uuid"
+	"github.com/remind101/migrate"
+
+	"github.com/MXi4oyu/DockerXScan/common/commonerr"
+	"github.com/MXi4oyu/DockerXScan/database"
+	"github.com/MXi4oyu/DockerXScan/database/pgsql/migrations"
+	_ "github.com/MXi4oyu/DockerXScan/versionfmt/apk"
+	_ "github.com/MXi4oyu/DockerXScan/versionfmt/dpkg"
+)
+
+// openDatabaseForTest opens a database created for the test, and dropped when
+// it is closed, loading testdata/data.sql with loadFixture.
+//
+// The databases are created on the PostgreSQL server that CLAIR_TEST_PGSQL
+// points to, such as
+// "postgresql://postgres@127.0.0.1:5432/?sslmode=disable"; the test is
+// skipped when it is not set.
+func openDatabaseForTest(tb testing.TB, testName string, loadFixture bool) *pgSQL {
+	ds, err := openDatabase(generateTestConfig(tb, testName, loadFixture))
+	if err != nil {
+		tb.Fatalf("could not open the database: %s", err)
+	}
+	return ds.(*pgSQL)
+}
+
+func generateTestConfig(tb testing.TB, testName string, loadFixture bool) database.RegistrableComponentConfig {
+	source := os.Getenv("CLAIR_TEST_PGSQL")
+	if source == "" {
+		tb.Skip("CLAIR_TEST_PGSQL is not set")
+	}
+
+	sourceURL, err := url.Parse(source)
+	if err != nil {
+		tb.Fatalf("CLAIR_TEST_PGSQL is not a valid URL: %s", err)
+	}
+	sourceURL.Path = "/" + "test_" + strings.ToLower(testName) + "_" + strings.Replace(uuid.New(), "-", "_", -1)
+
+	var fixturePath string
+	if loadFixture {
+		_, filename, _, _ := runtime.Caller(0)
+		fixturePath = filepath.Join(filepath.Dir(filename), "testdata", "data.sql")
+	}
+
+	return database.RegistrableComponentConfig{
+		Options: map[string]interface{}{
+			"source":                  sourceURL.String(),
+			"cachesize":               0,
+			"deduplicateinserts":      true,
+			"insertbatchsize":         100,
+			"managedatabaselifecycle": true,
+			"fixturepath":             fixturePath,
+		},
+	}
+}
+
+// mustInsertVulnerabilities inserts vulnerabilities, failing the test if they
+// can't be.
+func mustInsertVulnerabilities(tb testing.TB, datastore *pgSQL, vulnerabilities ...database.Vulnerability) {
+	if err := datastore.InsertVulnerabilities(vulnerabilities, false); err != nil {
+		tb.Fatalf("could not insert the vulnerabilities: %s", err)
+	}
+}
+
+// debian is the namespace of testdata/data.sql in which most tests run.
+var debian = database.Namespace{Name: "debian:11", VersionFormat: "dpkg"}
+
+// debianFeature returns a dpkg feature version of the debian namespace.
+func debianFeature(name, version string) database.FeatureVersion {
+	return database.FeatureVersion{
+		Feature: database.Feature{Name: name, Namespace: debian},
+		Version: version,
+	}
+}
+
+// syntheticFeed returns n vulnerabilities of the debian namespace, fixed in
+// packages of their own at version 1.0-2 as in a feed of Debian, along with
+// the features of these packages, of which every other one is at the
+// vulnerable version 1.0-1.
+func syntheticFeed(n int) ([]database.Vulnerability, []database.FeatureVersion) {
+	vulnerabilities := make([]database.Vulnerability, n)
+	features := make([]database.FeatureVersion, n)
+	for i := range vulnerabilities {
+		name := fmt.Sprintf("package%d", i)
+		vulnerabilities[i] = database.Vulnerability{
+			Name:        fmt.Sprintf("CVE-2023-%05d", i),
+			Namespace:   debian,
+			Description: "A vulnerability of " + name + ".",
+			Link:        "https://security-tracker.debian.org/tracker/" + fmt.Sprintf("CVE-2023-%05d", i),
+			Severity:    database.Severities[i%len(database.Severities)],
+			FixedIn:     []database.FeatureVersion{debianFeature(name, "1.0-2")},
+		}
+		features[i] = debianFeature(name, "1.0-1")
+		if i%2 == 1 {
+			features[i].Version = "1.0-2"
+		}
+	}
+	return vulnerabilities, features
+}
+
+func TestHandleError(t *testing.T) {
+	if err := handleError("test", nil); err != nil {
+		t.Errorf("handleError(nil) = %v, want nil", err)
+	}
+
+	if err := handleError("test", sql.ErrNoRows); err != commonerr.ErrNotFound {
+		t.Errorf("handleError(sql.ErrNoRows) = %v, want commonerr.ErrNotFound", err)
+	}
+
+	canceled := handleError("test", &pq.Error{Code: "57014", Message: "canceling statement due to statement timeout"})
+	if !errors.Is(canceled, database.ErrTimeout) {
+		t.Errorf("handleError(57014) = %v, want an error matching database.ErrTimeout", canceled)
+	}
+	if !errors.Is(canceled, database.ErrBackendException) {
+		t.Errorf("handleError(57014) = %v, want an error matching database.ErrBackendException", canceled)
+	}
+
+	backendErr := &pq.Error{Code: "42P01", Message: "relation \"secret_table\" does not exist"}
+	failed := handleError("test", backendErr)
+	if !errors.Is(failed, database.ErrBackendException) {
+		t.Errorf("handleError(42P01) = %v, want an error matching database.ErrBackendException", failed)
+	}
+	if errors.Is(failed, database.ErrTimeout) {
+		t.Errorf("handleError(42P01) = %v, want an error not matching database.ErrTimeout", failed)
+	}
+	if !errors.Is(failed, backendErr) {
+		t.Errorf("handleError(42P01) = %v, want an error wrapping the backend error", failed)
+	}
+	if failed.Error() != database.ErrBackendException.Error() {
+		t.Errorf("handleError(42P01).Error() = %q, want %q so that no backend detail leaks", failed.Error(), database.ErrBackendException.Error())
+	}
+}
+
+// createDatabaseForTest creates an empty database for the test, returning the
+// configuration opening it without managing its lifecycle, so that several
+// datastores may be opened on it, and a function dropping it.
+func createDatabaseForTest(tb testing.TB, testName string) (database.RegistrableComponentConfig, func()) {
+	config := generateTestConfig(tb, testName, false)
+	config.Options["managedatabaselifecycle"] = false
+
+	dbName, pgSourceURL, err := parseConnectionString(config.Options["source"].(string))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	if err := createDatabase(pgSourceURL, dbName); err != nil {
+		tb.Fatal(err)
+	}
+	return config, func() { dropDatabase(pgSourceURL, dbName) }
+}
+
+func TestConcurrentMigrations(t *testing.T) {
+	config, drop := createDatabaseForTest(t, "ConcurrentMigrations")
+	defer drop()
+
+	// Instances started at once against the fresh database all open it, a
+	// single one of them migrating it.
+	const instances = 4
+	var (
+		wg        sync.WaitGroup
+		start     = make(chan struct{})
+		errs      = make([]error, instances)
+		datastore = make([]database.Datastore, instances)
+	)
+	for i := 0; i < instances; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			datastore[i], errs[i] = openDatabase(config)
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("openDatabase() of instance %d failed: %s", i, err)
+			continue
+		}
+		defer datastore[i].Close()
+	}
+	if t.Failed() {
+		return
+	}
+
+	var count, versions, latest int
+	err := datastore[0].(*pgSQL).QueryRow("SELECT COUNT(*), COUNT(DISTINCT version), MAX(version) FROM "+migrate.DefaultTable).Scan(&count, &versions, &latest)
+	if err != nil {
+		t.Fatalf("could not read the migrations: %s", err)
+	}
+	if count != len(migrations.Migrations) || versions != count {
+		t.Errorf("the database holds %d migrations of %d versions, want %d once each", count, versions, len(migrations.Migrations))
+	}
+	for _, m := range migrations.Migrations {
+		if m.ID > latest {
+			t.Errorf("the database is at version %d, want %d", latest, m.ID)
+		}
+	}
+}
+
+func TestOpenNewerSchema(t *testing.T) {
+	config, drop := createDatabaseForTest(t, "OpenNewerSchema")
+	defer drop()
+
+	datastore, err := openDatabase(config)
+	if err != nil {
+		t.Fatalf("openDatabase() failed: %s", err)
+	}
+	// The database is migrated by a newer version.
+	_, err = datastore.(*pgSQL).Exec("INSERT INTO "+migrate.DefaultTable+" (version) VALUES ($1)", 1000000)
+	datastore.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if datastore, err := openDatabase(config); err == nil {
+		datastore.Close()
+		t.Error("openDatabase() of a database of a newer schema succeeded, want it to fail")
+	}
+}
@@ -4,19 +4,62 @@ import "strconv"
 
 const (
 	lockVulnerabilityAffects = `LOCK Vulnerability_Affects_FeatureVersion IN SHARE ROW EXCLUSIVE MODE`
+	disableStatementTimeout  = `SET LOCAL statement_timeout = 0`
 	disableHashJoin          = `SET LOCAL enable_hashjoin = off`
 	disableMergeJoin         = `SET LOCAL enable_mergejoin = off`
 
+	// pgsql.go
+	lockMigrations        = `SELECT pg_advisory_xact_lock($1)`
+	createMigrationsTable = `CREATE TABLE IF NOT EXISTS %s (version integer primary key not null)`
+	searchMigration       = `SELECT true FROM %s WHERE version = $1`
+	insertMigration       = `INSERT INTO %s (version) VALUES ($1)`
+	searchSchemaVersion   = `SELECT MAX(version) FROM %s`
+
 	// keyvalue.go
 	updateKeyValue = `UPDATE KeyValue SET value = $1 WHERE key = $2`
 	insertKeyValue = `INSERT INTO KeyValue(key, value) VALUES($1, $2)`
 	searchKeyValue = `SELECT value FROM KeyValue WHERE key = $1`
 
+	// suppression.go
+	updateSuppression = `
+		UPDATE Suppression SET justification = $4, author = $5, created_at = CURRENT_TIMESTAMP, expires_at = $6
+		WHERE namespace_name = $1 AND feature_name = $2 AND vulnerability_name = $3`
+
+	insertSuppression = `
+		INSERT INTO Suppression(namespace_name, feature_name, vulnerability_name, justification, author, created_at, expires_at)
+		VALUES($1, $2, $3, $4, $5, CURRENT_TIMESTAMP, $6)`
+
+	listSuppressions = `
+		SELECT id, namespace_name, feature_name, vulnerability_name, justification, author, created_at, expires_at
+		FROM Suppression
+		WHERE $1 = '' OR namespace_name = $1
+		ORDER BY namespace_name, feature_name, vulnerability_name`
+
+	removeSuppression = `
+		DELETE FROM Suppression
+		WHERE namespace_name = $1 AND feature_name = $2 AND vulnerability_name = $3`
+
+	// scanhistory.go
+	updateScan = `
+		UPDATE ScanHistory SET vulnerabilities = $3, fixable = $4, severities = $5, scanned_at = CURRENT_TIMESTAMP
+		WHERE digest = $1 AND tag = $2`
+
+	insertScan = `
+		INSERT INTO ScanHistory(digest, tag, repository, vulnerabilities, fixable, severities, scanned_at)
+		VALUES($1, $2, $3, $4, $5, $6, CURRENT_TIMESTAMP)`
+
+	listScanHistory = `
+		SELECT id, digest, tag, repository, vulnerabilities, fixable, severities, scanned_at
+		FROM ScanHistory
+		WHERE repository = $1
+		ORDER BY scanned_at DESC, id DESC
+		LIMIT $2`
+
 	// namespace.go
 	soiNamespace = `
 		WITH new_namespace AS (
-			INSERT INTO Namespace(name, version_format)
-			SELECT CAST($1 AS VARCHAR), CAST($2 AS VARCHAR)
+			INSERT INTO Namespace(name, version_format, kind)
+			SELECT CAST($1 AS VARCHAR), CAST($2 AS VARCHAR), CAST($3 AS VARCHAR)
 			WHERE NOT EXISTS (SELECT name FROM Namespace WHERE name = $1)
 			RETURNING id
 		)
@@ -25,27 +68,58 @@ const (
 		SELECT id FROM new_namespace`
 
 	searchNamespace = `SELECT id FROM Namespace WHERE name = $1`
-	listNamespace   = `SELECT id, name, version_format FROM Namespace`
+	listNamespace   = `SELECT id, name, version_format, disabled, data_version, COALESCE(kind, 'distro') FROM Namespace`
+	findNamespace   = `SELECT id, name, version_format, disabled, data_version, COALESCE(kind, 'distro') FROM Namespace WHERE name = $1`
+
+	updateNamespaceDisabled = `UPDATE Namespace SET disabled = $2 WHERE name = $1`
+
+	incrementNamespaceDataVersion       = `UPDATE Namespace SET data_version = data_version + 1 WHERE id = $1`
+	incrementNamespaceDataVersionByName = `UPDATE Namespace SET data_version = data_version + 1 WHERE name = $1`
 
 	// feature.go
 	soiFeature = `
 		WITH new_feature AS (
-			INSERT INTO Feature(name, namespace_id)
-			SELECT CAST($1 AS VARCHAR), CAST($2 AS INTEGER)
+			INSERT INTO Feature(name, namespace_id, kind)
+			SELECT CAST($1 AS VARCHAR), CAST($2 AS INTEGER), NULLIF(CAST($3 AS VARCHAR), '')
 			WHERE NOT EXISTS (SELECT id FROM Feature WHERE name = $1 AND namespace_id = $2)
 			RETURNING id
+		),
+		kind_feature AS (
+			UPDATE Feature SET kind = $3
+			WHERE name = $1 AND namespace_id = $2 AND kind IS NULL AND $3 <> ''
 		)
 		SELECT id FROM Feature WHERE name = $1 AND namespace_id = $2
 		UNION
 		SELECT id FROM new_feature`
 
+	soiFeatures = `
+		WITH input(name, namespace_id, kind) AS (
+			SELECT * FROM unnest(CAST($1 AS VARCHAR[]), CAST($2 AS INTEGER[]), CAST($3 AS VARCHAR[]))
+		),
+		new_feature AS (
+			INSERT INTO Feature(name, namespace_id, kind)
+			SELECT DISTINCT ON (i.name, i.namespace_id) i.name, i.namespace_id, NULLIF(i.kind, '')
+			FROM input i
+			WHERE NOT EXISTS (SELECT id FROM Feature f WHERE f.name = i.name AND f.namespace_id = i.namespace_id)
+			RETURNING id, name, namespace_id
+		),
+		kind_feature AS (
+			UPDATE Feature f SET kind = i.kind
+			FROM input i
+			WHERE f.name = i.name AND f.namespace_id = i.namespace_id AND f.kind IS NULL AND i.kind <> ''
+		)
+		SELECT f.id, f.name, f.namespace_id
+		FROM Feature f JOIN input i ON f.name = i.name AND f.namespace_id = i.namespace_id
+		UNION
+		SELECT id, name, namespace_id FROM new_feature`
+
 	searchFeatureVersion = `
 		SELECT id FROM FeatureVersion WHERE feature_id = $1 AND version = $2`
 
 	soiFeatureVersion = `
 		WITH new_featureversion AS (
-			INSERT INTO FeatureVersion(feature_id, version)
-			SELECT CAST($1 AS INTEGER), CAST($2 AS VARCHAR)
+			INSERT INTO FeatureVersion(feature_id, version, source_name)
+			SELECT CAST($1 AS INTEGER), CAST($2 AS VARCHAR), NULLIF(CAST($3 AS VARCHAR), '')
 			WHERE NOT EXISTS (SELECT id FROM FeatureVersion WHERE feature_id = $1 AND version = $2)
 			RETURNING id
 		)
@@ -53,17 +127,96 @@ const (
 		UNION
 		SELECT true, id FROM new_featureversion`
 
+	soiFeatureVersions = `
+		WITH input(feature_id, version, source_name) AS (
+			SELECT * FROM unnest(CAST($1 AS INTEGER[]), CAST($2 AS VARCHAR[]), CAST($3 AS VARCHAR[]))
+		),
+		new_featureversion AS (
+			INSERT INTO FeatureVersion(feature_id, version, source_name)
+			SELECT DISTINCT ON (i.feature_id, i.version) i.feature_id, i.version, NULLIF(i.source_name, '')
+			FROM input i
+			WHERE NOT EXISTS (SELECT id FROM FeatureVersion fv WHERE fv.feature_id = i.feature_id AND fv.version = i.version)
+			RETURNING id, feature_id, version
+		)
+		SELECT false, fv.id, fv.feature_id, fv.version
+		FROM FeatureVersion fv JOIN input i ON fv.feature_id = i.feature_id AND fv.version = i.version
+		UNION
+		SELECT true, id, feature_id, version FROM new_featureversion`
+
 	searchVulnerabilityFixedInFeature = `
 		SELECT id, vulnerability_id, version FROM Vulnerability_FixedIn_Feature
     WHERE feature_id = $1`
 
+	searchVulnerabilityFixedInSourceFeature = `
+		SELECT vfif.id, vfif.vulnerability_id, vfif.version
+		FROM Vulnerability_FixedIn_Feature vfif, Feature sf, Feature f
+		WHERE vfif.feature_id = sf.id AND sf.name = $2
+			AND sf.namespace_id = f.namespace_id AND f.id = $1 AND sf.id <> $1`
+
+	// listFeatureVersions selects the FeatureVersions of a namespace, or of
+	// every namespace if $1 is empty, added by at least one layer.
+	listFeatureVersions = `
+		SELECT fv.id, fv.version, COALESCE(fv.source_name, ''), f.id, f.name, COALESCE(f.kind, ''),
+			n.id, n.name, n.version_format
+		FROM FeatureVersion fv
+			JOIN Feature f ON fv.feature_id = f.id
+			JOIN Namespace n ON f.namespace_id = n.id
+		WHERE (CAST($1 AS VARCHAR) = '' OR n.name = $1)
+			AND fv.id >= $2
+			AND EXISTS (SELECT 1 FROM Layer_diff_FeatureVersion ldfv
+				WHERE ldfv.featureversion_id = fv.id AND ldfv.modification = 'add')
+		ORDER BY fv.id
+		LIMIT $3`
+
+	// searchVulnerabilityForFeatureVersions selects the fixes of the features
+	// of every input FeatureVersion, keyed by their name or by the name of
+	// their source, that may affect it. A stored FeatureVersion has already
+	// been compared to the fixes, only those linked to it are selected, and
+	// linked is true, along with the confidence of the link. Otherwise, the fixes of the version itself are left out
+	// as they can't affect it, and linked is true for those fixed in no
+	// version ($6), leaving the other comparisons to the version format. The
+	// fixes keyed by the name of the feature come first.
+	searchVulnerabilityForFeatureVersions = `
+		WITH input(idx, namespace, name, source_name, version) AS (
+			SELECT * FROM unnest(CAST($1 AS INTEGER[]), CAST($2 AS VARCHAR[]), CAST($3 AS VARCHAR[]),
+				CAST($4 AS VARCHAR[]), CAST($5 AS VARCHAR[]))
+		),
+		stored AS (
+			SELECT i.idx, fv.id
+			FROM input i
+				JOIN Namespace n ON n.name = i.namespace
+				JOIN Feature f ON f.namespace_id = n.id AND f.name = i.name
+				JOIN FeatureVersion fv ON fv.feature_id = f.id AND fv.version = i.version
+			WHERE COALESCE(NULLIF(fv.source_name, f.name), '') = i.source_name
+		)
+		SELECT i.idx, fn.version_format, vfif.version, s.id IS NOT NULL OR vfif.version = $6,
+			COALESCE(vafv.confidence, 'High'), v.id, v.name, v.description, v.link, v.severity, v.metadata,
+			v.withdrawn, v.confidence, v.published_at, v.discovered_at, vn.name, vn.version_format
+		FROM input i
+			JOIN Namespace fn ON fn.name = i.namespace
+			JOIN Feature f ON f.namespace_id = fn.id AND (f.name = i.name OR f.name = i.source_name)
+			JOIN Vulnerability_FixedIn_Feature vfif ON vfif.feature_id = f.id
+			JOIN Vulnerability v ON vfif.vulnerability_id = v.id
+			JOIN Namespace vn ON v.namespace_id = vn.id
+			LEFT JOIN stored s ON s.idx = i.idx
+			LEFT JOIN Vulnerability_Affects_FeatureVersion vafv
+				ON vafv.featureversion_id = s.id AND vafv.fixedin_id = vfif.id
+		WHERE v.deleted_at IS NULL
+			AND NOT v.withdrawn
+			AND NOT vn.disabled
+			AND vfif.version <> i.version
+			AND (s.id IS NULL OR vafv.id IS NOT NULL)
+		ORDER BY i.idx, f.name <> i.name`
+
 	insertVulnerabilityAffectsFeatureVersion = `
-		INSERT INTO Vulnerability_Affects_FeatureVersion(vulnerability_id, featureversion_id, fixedin_id)
-		VALUES($1, $2, $3)`
+		INSERT INTO Vulnerability_Affects_FeatureVersion(vulnerability_id, featureversion_id, fixedin_id, confidence)
+		SELECT $1, $2, $3, $4::confidence
+		WHERE NOT EXISTS (SELECT id FROM Vulnerability_Affects_FeatureVersion
+			WHERE vulnerability_id = $1 AND featureversion_id = $2)`
 
 	// layer.go
 	searchLayer = `
-		SELECT l.id, l.name, l.engineversion, p.id, p.name, n.id, n.name, n.version_format
+		SELECT l.id, l.name, l.engineversion, l.digest, p.id, p.name, n.id, n.name, n.version_format
 		FROM Layer l
 			LEFT JOIN Layer p ON l.parent_id = p.id
 			LEFT JOIN Namespace n ON l.id = n.id
@@ -79,7 +232,7 @@ const (
 			FROM Layer l, layer_tree lt
 			WHERE l.id = lt.parent_id
 		)
-		SELECT ldf.featureversion_id, ldf.modification, fn.id, fn.name, fn.version_format, f.id, f.name, fv.id, fv.version, ltree.id, ltree.name
+		SELECT ldf.featureversion_id, ldf.modification, ldf.root, ldf.location, fn.id, fn.name, fn.version_format, f.id, f.name, COALESCE(f.kind, ''), fv.id, fv.version, COALESCE(fv.source_name, ''), ltree.id, ltree.name
 		FROM Layer_diff_FeatureVersion ldf
 		JOIN (
 			SELECT row_number() over (ORDER BY depth DESC), id, name FROM layer_tree
@@ -89,31 +242,137 @@ const (
 
 	searchFeatureVersionVulnerability = `
 			SELECT vafv.featureversion_id, v.id, v.name, v.description, v.link, v.severity, v.metadata,
-				vn.name, vn.version_format, vfif.version
+				v.withdrawn, LEAST(v.confidence, vafv.confidence), v.published_at, v.discovered_at, vn.name, vn.version_format, vfif.version
 			FROM Vulnerability_Affects_FeatureVersion vafv, Vulnerability v,
 					 Namespace vn, Vulnerability_FixedIn_Feature vfif
 			WHERE vafv.featureversion_id = ANY($1::integer[])
 						AND vfif.vulnerability_id = v.id
 						AND vafv.fixedin_id = vfif.id
 						AND v.namespace_id = vn.id
-						AND v.deleted_at IS NULL`
+						AND v.deleted_at IS NULL
+						AND ($2 OR NOT v.withdrawn)
+						AND ($3::severity[] IS NULL OR v.severity = ANY($3::severity[]))
+						AND LEAST(v.confidence, vafv.confidence) >= $4::confidence
+						AND NOT vn.disabled`
+
+	// The resolution of a feature version holds the fixes of the
+	// vulnerabilities affecting it, rather than the vulnerabilities, as those
+	// found through its source package are fixed in another feature.
+	searchUnresolvedFeatureVersion = `
+		SELECT fv.id
+		FROM FeatureVersion fv
+			JOIN Feature f ON fv.feature_id = f.id
+			JOIN Namespace n ON f.namespace_id = n.id
+			LEFT JOIN VulnerabilityResolution r ON r.featureversion_id = fv.id
+		WHERE fv.id = ANY($1::integer[])
+			AND (r.featureversion_id IS NULL OR r.data_version <> n.data_version)`
+
+	updateStaleVulnerabilityResolution = `
+		UPDATE VulnerabilityResolution r
+		SET data_version = n.data_version, fixedin_ids = ARRAY(
+				SELECT vafv.fixedin_id
+				FROM Vulnerability_Affects_FeatureVersion vafv
+				WHERE vafv.featureversion_id = r.featureversion_id)
+		FROM FeatureVersion fv, Feature f, Namespace n
+		WHERE r.featureversion_id = ANY($1::integer[])
+			AND r.featureversion_id = fv.id
+			AND fv.feature_id = f.id
+			AND f.namespace_id = n.id
+			AND r.data_version <> n.data_version`
+
+	refreshNamespaceVulnerabilityResolution = `
+		UPDATE VulnerabilityResolution r
+		SET data_version = n.data_version, fixedin_ids = ARRAY(
+				SELECT vafv.fixedin_id
+				FROM Vulnerability_Affects_FeatureVersion vafv
+				WHERE vafv.featureversion_id = r.featureversion_id)
+		FROM FeatureVersion fv, Feature f, Namespace n
+		WHERE n.name = ANY($1::text[])
+			AND r.featureversion_id = fv.id
+			AND fv.feature_id = f.id
+			AND f.namespace_id = n.id
+			AND r.data_version <> n.data_version`
+
+	insertVulnerabilityResolution = `
+		INSERT INTO VulnerabilityResolution(featureversion_id, data_version, fixedin_ids)
+		SELECT fv.id, n.data_version, ARRAY(
+				SELECT vafv.fixedin_id
+				FROM Vulnerability_Affects_FeatureVersion vafv
+				WHERE vafv.featureversion_id = fv.id)
+		FROM FeatureVersion fv, Feature f, Namespace n
+		WHERE fv.id = ANY($1::integer[])
+			AND fv.feature_id = f.id
+			AND f.namespace_id = n.id
+			AND NOT EXISTS (SELECT 1 FROM VulnerabilityResolution r WHERE r.featureversion_id = fv.id)`
+
+	searchResolvedFeatureVersionVulnerability = `
+			SELECT r.featureversion_id, v.id, v.name, v.description, v.link, v.severity, v.metadata,
+				v.withdrawn, LEAST(v.confidence, vafv.confidence), v.published_at, v.discovered_at, vn.name, vn.version_format, vfif.version
+			FROM VulnerabilityResolution r, Vulnerability_FixedIn_Feature vfif,
+					 Vulnerability v, Namespace vn, Vulnerability_Affects_FeatureVersion vafv
+			WHERE r.featureversion_id = ANY($1::integer[])
+						AND vfif.id = ANY(r.fixedin_ids)
+						AND v.id = vfif.vulnerability_id
+						AND vafv.featureversion_id = r.featureversion_id
+						AND vafv.vulnerability_id = v.id
+						AND vafv.fixedin_id = vfif.id
+						AND v.namespace_id = vn.id
+						AND v.deleted_at IS NULL
+						AND ($2 OR NOT v.withdrawn)
+						AND ($3::severity[] IS NULL OR v.severity = ANY($3::severity[]))
+						AND LEAST(v.confidence, vafv.confidence) >= $4::confidence
+						AND NOT vn.disabled`
+
+	savepointVulnerabilityResolution  = `SAVEPOINT vulnerability_resolution`
+	releaseVulnerabilityResolution    = `RELEASE SAVEPOINT vulnerability_resolution`
+	rollbackToVulnerabilityResolution = `ROLLBACK TO SAVEPOINT vulnerability_resolution`
 
 	insertLayer = `
-		INSERT INTO Layer(name, engineversion, parent_id, namespace_id, created_at)
-    VALUES($1, $2, $3, $4, CURRENT_TIMESTAMP)
+		INSERT INTO Layer(name, engineversion, parent_id, namespace_id, digest, created_at)
+    VALUES($1, $2, $3, $4, $5, CURRENT_TIMESTAMP)
     RETURNING id`
 
-	updateLayer = `UPDATE LAYER SET engineversion = $2, namespace_id = $3 WHERE id = $1`
+	updateLayer = `UPDATE LAYER SET engineversion = $2, namespace_id = $3, digest = COALESCE(NULLIF($4, ''), digest) WHERE id = $1`
+
+	searchLayersByDigest = `
+		SELECT l.id, l.name, l.engineversion, l.digest, p.id, p.name
+		FROM Layer l
+			LEFT JOIN Layer p ON l.parent_id = p.id
+		WHERE l.digest = ANY($1::varchar[])
+		ORDER BY l.id`
+
+	// The layers adding an affected feature version are affected, and so are
+	// their children, unless the feature version is deleted on the way.
+	searchLayersAffectedByVulnerability = `
+		WITH RECURSIVE affected(layer_id, featureversion_id) AS (
+			SELECT DISTINCT ldf.layer_id, ldf.featureversion_id
+			FROM Vulnerability_Affects_FeatureVersion vafv, Layer_diff_FeatureVersion ldf
+			WHERE vafv.vulnerability_id = $1
+				AND ldf.featureversion_id = vafv.featureversion_id
+				AND ldf.modification = 'add'
+		UNION
+			SELECT l.id, a.featureversion_id
+			FROM affected a JOIN Layer l ON l.parent_id = a.layer_id
+			WHERE NOT EXISTS (
+				SELECT 1 FROM Layer_diff_FeatureVersion ldf
+				WHERE ldf.layer_id = l.id
+					AND ldf.featureversion_id = a.featureversion_id
+					AND ldf.modification = 'del')
+		)
+		SELECT DISTINCT l.name
+		FROM affected a JOIN Layer l ON l.id = a.layer_id
+		ORDER BY l.name`
 
 	removeLayerDiffFeatureVersion = `
 		DELETE FROM Layer_diff_FeatureVersion
 		WHERE layer_id = $1`
 
 	insertLayerDiffFeatureVersion = `
-		INSERT INTO Layer_diff_FeatureVersion(layer_id, featureversion_id, modification)
-			SELECT $1, fv.id, $2
-			FROM FeatureVersion fv
-			WHERE fv.id = ANY($3::integer[])`
+		INSERT INTO Layer_diff_FeatureVersion(layer_id, featureversion_id, modification, root, location)
+			SELECT DISTINCT ON (fv.id, i.root) $1, fv.id, $2, i.root, i.location
+			FROM unnest($3::integer[], CAST($4 AS VARCHAR[]), CAST($5 AS TEXT[])) AS i(id, root, location)
+			JOIN FeatureVersion fv ON fv.id = i.id
+			ORDER BY fv.id, i.root, i.location`
 
 	removeLayer = `DELETE FROM Layer WHERE name = $1`
 
@@ -126,24 +385,55 @@ const (
 
 	// vulnerability.go
 	searchVulnerabilityBase = `
-	  SELECT v.id, v.name, n.id, n.name, n.version_format, v.description, v.link, v.severity, v.metadata
+	  SELECT v.id, v.name, n.id, n.name, n.version_format, v.description, v.link, v.severity, v.metadata,
+	    v.withdrawn, v.confidence, v.published_at, v.discovered_at
 	  FROM Vulnerability v JOIN Namespace n ON v.namespace_id = n.id`
 	searchVulnerabilityForUpdate          = ` FOR UPDATE OF v`
 	searchVulnerabilityByNamespaceAndName = ` WHERE n.name = $1 AND v.name = $2 AND v.deleted_at IS NULL`
 	searchVulnerabilityByID               = ` WHERE v.id = $1`
 	searchVulnerabilityByNamespace        = ` WHERE n.name = $1 AND v.deleted_at IS NULL
+						  AND NOT n.disabled
 		  				  AND v.id >= $2
 						  ORDER BY v.id
 						  LIMIT $3`
 
+	searchVulnerabilityLastByNamespaceAndName = `
+		WHERE n.name = $1 AND v.name = $2
+		ORDER BY v.deleted_at IS NOT NULL, v.deleted_at DESC, v.id DESC
+		LIMIT 1`
+	searchVulnerabilityDeletedAt = `SELECT deleted_at FROM Vulnerability WHERE id = $1`
+
+	searchVulnerabilityByNamespaceSince = `
+		SELECT v.id, v.name, n.id, n.name, n.version_format, v.description, v.link, v.severity, v.metadata,
+			v.withdrawn, v.confidence, v.published_at, v.discovered_at, v.updated_at, v.deleted_at
+		FROM Vulnerability v JOIN Namespace n ON v.namespace_id = n.id
+		WHERE n.name = $1
+			AND NOT n.disabled
+			AND (v.deleted_at IS NULL AND v.updated_at > $2 OR v.deleted_at > $2)
+			AND v.id >= $3
+		ORDER BY v.id
+		LIMIT $4`
+
 	searchVulnerabilityFixedIn = `
 		SELECT vfif.version, f.id, f.Name
 		FROM Vulnerability_FixedIn_Feature vfif JOIN Feature f ON vfif.feature_id = f.id
 		WHERE vfif.vulnerability_id = $1`
 
+	searchVulnerabilityAffected = `
+		SELECT fv.id, f.id, f.name, COALESCE(f.kind, ''), fv.version, COALESCE(fv.source_name, ''), vfif.version
+		FROM Vulnerability_Affects_FeatureVersion vafv
+			JOIN FeatureVersion fv ON vafv.featureversion_id = fv.id
+			JOIN Feature f ON fv.feature_id = f.id
+			JOIN Vulnerability_FixedIn_Feature vfif ON vafv.fixedin_id = vfif.id
+		WHERE vafv.vulnerability_id = $1
+		ORDER BY f.name, fv.id`
+
 	insertVulnerability = `
-		INSERT INTO Vulnerability(namespace_id, name, description, link, severity, metadata, created_at)
-		VALUES($1, $2, $3, $4, $5, $6, CURRENT_TIMESTAMP)
+		INSERT INTO Vulnerability(namespace_id, name, description, link, severity, metadata, withdrawn, created_at, updated_at,
+			published_at, discovered_at, confidence)
+		VALUES($1, $2, $3, $4, $5, $6, $7, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP,
+			COALESCE(CAST($8 AS TIMESTAMP WITH TIME ZONE), CAST($9 AS TIMESTAMP WITH TIME ZONE), CURRENT_TIMESTAMP),
+			COALESCE(CAST($9 AS TIMESTAMP WITH TIME ZONE), CURRENT_TIMESTAMP), $10)
 		RETURNING id`
 
 	soiVulnerabilityFixedInFeature = `
@@ -157,7 +447,13 @@ const (
 		UNION
 		SELECT true, id FROM new_fixedinfeature`
 
-	searchFeatureVersionByFeature = `SELECT id, version FROM FeatureVersion WHERE feature_id = $1`
+	searchFeatureVersionByFeature = `
+		SELECT id, version FROM FeatureVersion WHERE feature_id = $1
+		UNION
+		SELECT fv.id, fv.version
+		FROM FeatureVersion fv, Feature f, Feature sf
+		WHERE sf.id = $1 AND fv.source_name = sf.name
+			AND fv.feature_id = f.id AND f.namespace_id = sf.namespace_id AND f.id <> $1`
 
 	removeVulnerability = `
 		UPDATE Vulnerability
@@ -167,10 +463,60 @@ const (
           AND deleted_at IS NULL
     RETURNING id`
 
+	searchUnreferencedVulnerability = `
+		SELECT v.id, v.name, n.id, n.name, v.severity
+		FROM Vulnerability v JOIN Namespace n ON v.namespace_id = n.id
+		WHERE v.deleted_at IS NULL
+			AND ($1 = '' OR n.name = $1)
+			AND NOT EXISTS (
+				SELECT 1
+				FROM Vulnerability_Affects_FeatureVersion vafv
+					JOIN Layer_diff_FeatureVersion ldfv ON ldfv.featureversion_id = vafv.featureversion_id
+				WHERE vafv.vulnerability_id = v.id)
+		ORDER BY n.name, v.name`
+
+	removeUnreferencedVulnerability = `
+		UPDATE Vulnerability v
+		SET deleted_at = CURRENT_TIMESTAMP
+		FROM Namespace n
+		WHERE v.namespace_id = n.id
+			AND v.deleted_at IS NULL
+			AND ($1 = '' OR n.name = $1)
+			AND NOT EXISTS (
+				SELECT 1
+				FROM Vulnerability_Affects_FeatureVersion vafv
+					JOIN Layer_diff_FeatureVersion ldfv ON ldfv.featureversion_id = vafv.featureversion_id
+				WHERE vafv.vulnerability_id = v.id)`
+
+	removeDeletedVulnerability = `
+		DELETE FROM Vulnerability v
+		WHERE v.deleted_at < $1
+			AND NOT EXISTS (
+				SELECT 1
+				FROM Vulnerability_Notification vn
+				WHERE (vn.old_vulnerability_id = v.id OR vn.new_vulnerability_id = v.id)
+					AND vn.deleted_at IS NULL)`
+
 	// notification.go
 	insertNotification = `
-		INSERT INTO Vulnerability_Notification(name, created_at, old_vulnerability_id, new_vulnerability_id)
-    VALUES($1, CURRENT_TIMESTAMP, $2, $3)`
+		INSERT INTO Vulnerability_Notification(name, created_at, old_vulnerability_id, new_vulnerability_id, affected_hash)
+    VALUES($1, CURRENT_TIMESTAMP, $2, $3, $4)`
+
+	searchVulnerabilityAffectedFeatureVersions = `
+		SELECT featureversion_id
+		FROM Vulnerability_Affects_FeatureVersion
+		WHERE vulnerability_id = $1
+		ORDER BY featureversion_id`
+
+	searchNotificationDuplicate = `
+		SELECT EXISTS (
+			SELECT 1
+			FROM Vulnerability_Notification vn
+				JOIN Vulnerability v ON vn.new_vulnerability_id = v.id
+				JOIN Vulnerability nv ON nv.namespace_id = v.namespace_id AND nv.name = v.name
+			WHERE nv.id = $1
+				AND vn.affected_hash = $2
+				AND vn.deleted_at IS NULL)`
 
 	updatedNotificationNotified = `
 		UPDATE Vulnerability_Notification
@@ -182,15 +528,66 @@ const (
 	  SET deleted_at = CURRENT_TIMESTAMP
 	  WHERE name = $1`
 
+	updatedNotificationsNotified = `
+		UPDATE Vulnerability_Notification
+		SET notified_at = CURRENT_TIMESTAMP
+		WHERE name = ANY($1::text[])`
+
+	removeNotifications = `
+		UPDATE Vulnerability_Notification
+		SET deleted_at = CURRENT_TIMESTAMP
+		WHERE name = ANY($1::text[])`
+
 	searchNotificationAvailable = `
 		SELECT id, name, created_at, notified_at, deleted_at
 		FROM Vulnerability_Notification
 		WHERE (notified_at IS NULL OR notified_at < $1)
+					AND created_at < $2
 					AND deleted_at IS NULL
 					AND name NOT IN (SELECT name FROM Lock)
 		ORDER BY Random()
 		LIMIT 1`
 
+	// A notification is of the severity of the most severe of its old and new
+	// vulnerabilities.
+	searchNotificationAvailableWithSeverity = `
+		SELECT id, name, created_at, notified_at, deleted_at
+		FROM Vulnerability_Notification vn
+		WHERE (notified_at IS NULL OR notified_at < $1)
+					AND created_at < $2
+					AND deleted_at IS NULL
+					AND name NOT IN (SELECT name FROM Lock)
+					AND EXISTS (
+						SELECT 1 FROM Vulnerability v
+						WHERE v.id IN (vn.old_vulnerability_id, vn.new_vulnerability_id)
+							AND v.severity = ANY($3::text[]))
+		ORDER BY Random()
+		LIMIT 1`
+
+	// The notifications are claimed by locking their name, as the notifier
+	// does.
+	claimNotifications = `
+		WITH candidates AS (
+			SELECT name
+			FROM Vulnerability_Notification
+			WHERE notified_at IS NULL
+						AND deleted_at IS NULL
+						AND name NOT IN (SELECT name FROM Lock)
+			ORDER BY created_at, id
+			LIMIT $4
+		), claimed AS (
+			INSERT INTO Lock(name, owner, until)
+			SELECT name, $1, $2
+			FROM candidates
+			ORDER BY random()
+			LIMIT $3
+			ON CONFLICT (name) DO NOTHING
+			RETURNING name
+		)
+		SELECT vn.id, vn.name, vn.created_at, vn.notified_at, vn.deleted_at
+		FROM Vulnerability_Notification vn JOIN claimed c ON vn.name = c.name
+		ORDER BY vn.created_at, vn.id`
+
 	searchNotification = `
 		SELECT id, name, created_at, notified_at, deleted_at, old_vulnerability_id, new_vulnerability_id
 		FROM Vulnerability_Notification
@@ -212,6 +609,76 @@ const (
 		WHERE LDFV.layer_id = l.id
 		LIMIT $3`
 
+	// consistency.go
+	searchDuplicateNamespace = `
+		SELECT name, array_agg(id ORDER BY id)
+		FROM Namespace
+		GROUP BY name
+		HAVING COUNT(*) > 1`
+
+	searchDuplicateFeatureVersion = `
+		SELECT f.name || ':' || fv.version, array_agg(fv.id ORDER BY fv.id)
+		FROM FeatureVersion fv JOIN Feature f ON fv.feature_id = f.id
+		GROUP BY f.name, fv.feature_id, fv.version
+		HAVING COUNT(*) > 1`
+
+	searchDuplicateVulnerability = `
+		SELECT n.name || ':' || v.name, array_agg(v.id ORDER BY v.id)
+		FROM Vulnerability v JOIN Namespace n ON v.namespace_id = n.id
+		WHERE v.deleted_at IS NULL
+		GROUP BY n.name, v.namespace_id, v.name
+		HAVING COUNT(*) > 1`
+
+	searchOrphanedFeatureVersion = `
+		SELECT f.name || ':' || fv.version, ARRAY[fv.id]
+		FROM FeatureVersion fv JOIN Feature f ON fv.feature_id = f.id
+		WHERE NOT EXISTS (SELECT 1 FROM Layer_diff_FeatureVersion ldfv WHERE ldfv.featureversion_id = fv.id)
+		ORDER BY fv.id`
+
+	searchForeignFeatureFix = `
+		SELECT v.name || ':' || f.name, ARRAY[vfif.id]
+		FROM Vulnerability_FixedIn_Feature vfif
+			JOIN Vulnerability v ON vfif.vulnerability_id = v.id
+			JOIN Feature f ON vfif.feature_id = f.id
+		WHERE f.namespace_id <> v.namespace_id
+		ORDER BY vfif.id`
+
+	searchDanglingFix = `
+		SELECT 'vulnerability ' || vafv.vulnerability_id || ', featureversion ' || vafv.featureversion_id, ARRAY[vafv.id]
+		FROM Vulnerability_Affects_FeatureVersion vafv
+			JOIN Vulnerability_FixedIn_Feature vfif ON vafv.fixedin_id = vfif.id
+			JOIN FeatureVersion fv ON vafv.featureversion_id = fv.id
+		WHERE vfif.vulnerability_id <> vafv.vulnerability_id OR vfif.feature_id <> fv.feature_id
+		ORDER BY vafv.id`
+
+	removeDanglingFix = `
+		DELETE FROM Vulnerability_Affects_FeatureVersion vafv
+		USING Vulnerability_FixedIn_Feature vfif, FeatureVersion fv
+		WHERE vafv.fixedin_id = vfif.id
+			AND vafv.featureversion_id = fv.id
+			AND (vfif.vulnerability_id <> vafv.vulnerability_id OR vfif.feature_id <> fv.feature_id)`
+
+	removeOrphanedFeatureVersionAffects = `
+		DELETE FROM Vulnerability_Affects_FeatureVersion vafv
+		WHERE NOT EXISTS (SELECT 1 FROM Layer_diff_FeatureVersion ldfv WHERE ldfv.featureversion_id = vafv.featureversion_id)`
+
+	removeOrphanedFeatureVersion = `
+		DELETE FROM FeatureVersion fv
+		WHERE NOT EXISTS (SELECT 1 FROM Layer_diff_FeatureVersion ldfv WHERE ldfv.featureversion_id = fv.id)`
+
+	// maintenance.go
+	searchTableStats = `
+		SELECT c.relname, pg_total_relation_size(c.oid), COALESCE(s.n_live_tup, 0), COALESCE(s.n_dead_tup, 0)
+		FROM pg_class c
+			LEFT JOIN pg_stat_user_tables s ON s.relid = c.oid
+		WHERE c.relkind = 'r' AND c.relname = ANY($1) AND pg_table_is_visible(c.oid)
+		ORDER BY c.relname`
+
+	disableSessionStatementTimeout = `SET statement_timeout = 0`
+	resetStatementTimeout          = `RESET statement_timeout`
+	vacuumTable                    = `VACUUM ANALYZE `
+	vacuumFullTable                = `VACUUM FULL ANALYZE `
+
 	// complex_test.go
 	searchComplexTestFeatureVersionAffects = `
 		SELECT v.name
@@ -0,0 +1,77 @@
+package pgsql
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/MXi4oyu/DockerXScan/database"
+)
+
+// RecordScan records the summary of a scan of an image by one of its tags,
+// replacing that of a previous scan of the same digest by the same tag.
+func (pgSQL *pgSQL) RecordScan(digest, tag string, summary database.ScanSummary) error {
+	if digest == "" || tag == "" {
+		return database.ErrInvalidScan
+	}
+
+	defer observeQueryTime("RecordScan", "all", time.Now())
+
+	severities, err := json.Marshal(summary.BySeverity)
+	if err != nil {
+		return err
+	}
+
+	// Upsert, as InsertKeyValue does.
+	for {
+		r, err := pgSQL.Exec(updateScan, digest, tag, summary.Vulnerabilities, summary.Fixable, string(severities))
+		if err != nil {
+			return handleError("updateScan", err)
+		}
+		if n, _ := r.RowsAffected(); n > 0 {
+			return nil
+		}
+
+		_, err = pgSQL.Exec(insertScan, digest, tag, database.ScanRepository(tag), summary.Vulnerabilities, summary.Fixable, string(severities))
+		if err != nil {
+			if isErrUniqueViolation(err) {
+				// Inserted concurrently, retry.
+				continue
+			}
+			return handleError("insertScan", err)
+		}
+
+		return nil
+	}
+}
+
+// ListScanHistory lists the latest scans of the images of a repository, the
+// most recent first, at most limit of them unless limit is zero.
+func (pgSQL *pgSQL) ListScanHistory(repository string, limit int) ([]database.ScanRecord, error) {
+	defer observeQueryTime("ListScanHistory", "all", time.Now())
+
+	rows, err := pgSQL.Query(listScanHistory, repository, sql.NullInt64{Int64: int64(limit), Valid: limit > 0})
+	if err != nil {
+		return nil, handleError("listScanHistory", err)
+	}
+	defer rows.Close()
+
+	var records []database.ScanRecord
+	for rows.Next() {
+		var r database.ScanRecord
+		var severities string
+		err = rows.Scan(&r.ID, &r.Digest, &r.Tag, &r.Repository, &r.Summary.Vulnerabilities, &r.Summary.Fixable, &severities, &r.Scanned)
+		if err != nil {
+			return nil, handleError("listScanHistory.Scan()", err)
+		}
+		if err := json.Unmarshal([]byte(severities), &r.Summary.BySeverity); err != nil {
+			return nil, handleError("listScanHistory.Unmarshal()", err)
+		}
+		records = append(records, r)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, handleError("listScanHistory.Rows()", err)
+	}
+
+	return records, nil
+}
@@ -0,0 +1,97 @@
+package pgsql
+
+import (
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/MXi4oyu/DockerXScan/common/commonerr"
+	"github.com/MXi4oyu/DockerXScan/database"
+)
+
+// SetSuppression creates or replaces the suppression of a vulnerability
+// affecting a feature of a namespace.
+func (pgSQL *pgSQL) SetSuppression(suppression database.Suppression) error {
+	if !suppression.Valid() {
+		return database.ErrInvalidSuppression
+	}
+
+	defer observeQueryTime("SetSuppression", "all", time.Now())
+
+	expires := pq.NullTime{Time: suppression.Expires, Valid: !suppression.Expires.IsZero()}
+
+	// Upsert, as InsertKeyValue does.
+	for {
+		r, err := pgSQL.Exec(updateSuppression, suppression.NamespaceName, suppression.FeatureName, suppression.VulnerabilityName, suppression.Justification, suppression.Author, expires)
+		if err != nil {
+			return handleError("updateSuppression", err)
+		}
+		if n, _ := r.RowsAffected(); n > 0 {
+			return nil
+		}
+
+		_, err = pgSQL.Exec(insertSuppression, suppression.NamespaceName, suppression.FeatureName, suppression.VulnerabilityName, suppression.Justification, suppression.Author, expires)
+		if err != nil {
+			if isErrUniqueViolation(err) {
+				// Inserted concurrently, retry.
+				continue
+			}
+			return handleError("insertSuppression", err)
+		}
+
+		return nil
+	}
+}
+
+// ListSuppressions lists the suppressions of a namespace, or of every
+// namespace if namespaceName is empty.
+func (pgSQL *pgSQL) ListSuppressions(namespaceName string) ([]database.Suppression, error) {
+	defer observeQueryTime("ListSuppressions", "all", time.Now())
+
+	rows, err := pgSQL.Query(listSuppressions, namespaceName)
+	if err != nil {
+		return nil, handleError("listSuppressions", err)
+	}
+	defer rows.Close()
+
+	var suppressions []database.Suppression
+	for rows.Next() {
+		var s database.Suppression
+		var expires pq.NullTime
+		err = rows.Scan(&s.ID, &s.NamespaceName, &s.FeatureName, &s.VulnerabilityName, &s.Justification, &s.Author, &s.Created, &expires)
+		if err != nil {
+			return nil, handleError("listSuppressions.Scan()", err)
+		}
+		if expires.Valid {
+			s.Expires = expires.Time
+		}
+		suppressions = append(suppressions, s)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, handleError("listSuppressions.Rows()", err)
+	}
+
+	return suppressions, nil
+}
+
+// DeleteSuppression deletes the suppression of a vulnerability affecting a
+// feature of a namespace.
+func (pgSQL *pgSQL) DeleteSuppression(namespaceName, featureName, vulnerabilityName string) error {
+	defer observeQueryTime("DeleteSuppression", "all", time.Now())
+
+	result, err := pgSQL.Exec(removeSuppression, namespaceName, featureName, vulnerabilityName)
+	if err != nil {
+		return handleError("removeSuppression", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return handleError("removeSuppression.RowsAffected()", err)
+	}
+
+	if affected <= 0 {
+		return commonerr.ErrNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,7 @@
+-- The namespaces of the tests, whose vulnerabilities and layers are inserted
+-- by the tests themselves through the Datastore.
+INSERT INTO Namespace (id, name, version_format) VALUES
+  (1, 'debian:11', 'dpkg'),
+  (2, 'alpine:3.18', 'apk');
+
+SELECT pg_catalog.setval(pg_get_serial_sequence('Namespace', 'id'), (SELECT MAX(id) FROM Namespace) + 1);
@@ -2,10 +2,12 @@ package pgsql
 
 import (
 	log "github.com/sirupsen/logrus"
+	"context"
 	"database/sql"
 	"reflect"
 	"encoding/json"
 	"github.com/guregu/null/zero"
+	"github.com/lib/pq"
 	"github.com/MXi4oyu/DockerXScan/database"
 	"github.com/MXi4oyu/DockerXScan/common/commonerr"
 	"github.com/MXi4oyu/DockerXScan/versionfmt"
@@ -88,6 +90,10 @@ func (pgSQL *pgSQL) ListVulnerabilities(namespaceName string, limit int, startID
 			&vulnerability.Link,
 			&vulnerability.Severity,
 			&vulnerability.Metadata,
+			&vulnerability.Withdrawn,
+			&vulnerability.Confidence,
+			&vulnerability.PublishedDate,
+			&vulnerability.DiscoveredDate,
 		)
 		if err != nil {
 			return nil, -1, handleError("searchVulnerabilityByNamespace.Scan()", err)
@@ -107,6 +113,93 @@ func (pgSQL *pgSQL) ListVulnerabilities(namespaceName string, limit int, startID
 	return vulns, nextID, nil
 }
 
+// iteratePageSize is the number of vulnerabilities IterateVulnerabilities
+// reads at once.
+const iteratePageSize = 1000
+
+func (pgSQL *pgSQL) IterateVulnerabilities(namespaceName string, fn func(database.Vulnerability) error) error {
+	// Vulnerabilities are paged by ID, so that those inserted while iterating
+	// don't shift the pages.
+	for startID := 0; startID != -1; {
+		vulnerabilities, nextID, err := pgSQL.ListVulnerabilities(namespaceName, iteratePageSize, startID)
+		if err != nil {
+			return err
+		}
+		startID = nextID
+
+		for _, vulnerability := range vulnerabilities {
+			if err := fn(vulnerability); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (pgSQL *pgSQL) ListVulnerabilitiesSince(namespaceName string, since time.Time, limit int, startID int) ([]database.Vulnerability, int, error) {
+	defer observeQueryTime("listVulnerabilitiesSince", "all", time.Now())
+
+	// Query Namespace.
+	var id int
+	err := pgSQL.QueryRow(searchNamespace, namespaceName).Scan(&id)
+	if err != nil {
+		return nil, -1, handleError("searchNamespace", err)
+	} else if id == 0 {
+		return nil, -1, commonerr.ErrNotFound
+	}
+
+	// Query.
+	rows, err := pgSQL.Query(searchVulnerabilityByNamespaceSince, namespaceName, since, startID, limit+1)
+	if err != nil {
+		return nil, -1, handleError("searchVulnerabilityByNamespaceSince", err)
+	}
+	defer rows.Close()
+
+	var vulns []database.Vulnerability
+	nextID := -1
+	size := 0
+	// Scan query.
+	for rows.Next() {
+		var vulnerability database.Vulnerability
+		var deletedAt zero.Time
+
+		err := rows.Scan(
+			&vulnerability.ID,
+			&vulnerability.Name,
+			&vulnerability.Namespace.ID,
+			&vulnerability.Namespace.Name,
+			&vulnerability.Namespace.VersionFormat,
+			&vulnerability.Description,
+			&vulnerability.Link,
+			&vulnerability.Severity,
+			&vulnerability.Metadata,
+			&vulnerability.Withdrawn,
+			&vulnerability.Confidence,
+			&vulnerability.PublishedDate,
+			&vulnerability.DiscoveredDate,
+			&vulnerability.UpdatedAt,
+			&deletedAt,
+		)
+		if err != nil {
+			return nil, -1, handleError("searchVulnerabilityByNamespaceSince.Scan()", err)
+		}
+		vulnerability.DeletedAt = deletedAt.Time
+		size++
+		if size > limit {
+			nextID = vulnerability.ID
+		} else {
+			vulns = append(vulns, vulnerability)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, -1, handleError("searchVulnerabilityByNamespaceSince.Rows()", err)
+	}
+
+	return vulns, nextID, nil
+}
+
 func (pgSQL *pgSQL) FindVulnerability(namespaceName, name string) (database.Vulnerability, error) {
 	return findVulnerability(pgSQL, namespaceName, name, false)
 }
@@ -124,6 +217,75 @@ func findVulnerability(queryer Queryer, namespaceName, name string, forUpdate bo
 	return scanVulnerability(queryer, queryName, queryer.QueryRow(query, namespaceName, name))
 }
 
+func (pgSQL *pgSQL) FindVulnerabilityWithAffected(namespaceName, name string) (database.Vulnerability, error) {
+	defer observeQueryTime("FindVulnerabilityWithAffected", "all", time.Now())
+
+	// The vulnerability, its fixes and the feature versions they affect are
+	// read from the same snapshot, even if an update runs meanwhile.
+	tx, err := pgSQL.BeginTx(context.Background(), &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return database.Vulnerability{}, handleError("FindVulnerabilityWithAffected.Begin()", err)
+	}
+	// Nothing is written, the transaction is only ended.
+	defer tx.Rollback()
+
+	vulnerability, err := findVulnerability(tx, namespaceName, name, false)
+	if err != nil {
+		return vulnerability, err
+	}
+
+	rows, err := tx.Query(searchVulnerabilityAffected, vulnerability.ID)
+	if err != nil {
+		return vulnerability, handleError("searchVulnerabilityAffected", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		affected := database.AffectedFeatureVersion{
+			FeatureVersion: database.FeatureVersion{Feature: database.Feature{Namespace: vulnerability.Namespace}},
+		}
+		err := rows.Scan(
+			&affected.ID,
+			&affected.Feature.ID,
+			&affected.Feature.Name,
+			&affected.Feature.Kind,
+			&affected.Version,
+			&affected.SourceName,
+			&affected.FixedBy,
+		)
+		if err != nil {
+			return vulnerability, handleError("searchVulnerabilityAffected.Scan()", err)
+		}
+		vulnerability.Affected = append(vulnerability.Affected, affected)
+	}
+	if err := rows.Err(); err != nil {
+		return vulnerability, handleError("searchVulnerabilityAffected.Rows()", err)
+	}
+
+	return vulnerability, nil
+}
+
+func (pgSQL *pgSQL) FindVulnerabilityWithDeleted(namespaceName, name string) (database.Vulnerability, error) {
+	defer observeQueryTime("FindVulnerabilityWithDeleted", "all", time.Now())
+
+	// The live vulnerability comes first, then the most recently deleted one.
+	queryName := "searchVulnerabilityBase+searchVulnerabilityLastByNamespaceAndName"
+	query := searchVulnerabilityBase + searchVulnerabilityLastByNamespaceAndName
+
+	vulnerability, err := scanVulnerability(pgSQL, queryName, pgSQL.QueryRow(query, namespaceName, name))
+	if err != nil {
+		return vulnerability, err
+	}
+
+	var deletedAt zero.Time
+	if err := pgSQL.QueryRow(searchVulnerabilityDeletedAt, vulnerability.ID).Scan(&deletedAt); err != nil {
+		return vulnerability, handleError("searchVulnerabilityDeletedAt", err)
+	}
+	vulnerability.DeletedAt = deletedAt.Time
+
+	return vulnerability, nil
+}
+
 func (pgSQL *pgSQL) findVulnerabilityByIDWithDeleted(id int) (database.Vulnerability, error) {
 	defer observeQueryTime("findVulnerabilityByIDWithDeleted", "all", time.Now())
 
@@ -146,6 +308,10 @@ func scanVulnerability(queryer Queryer, queryName string, vulnerabilityRow *sql.
 		&vulnerability.Link,
 		&vulnerability.Severity,
 		&vulnerability.Metadata,
+		&vulnerability.Withdrawn,
+		&vulnerability.Confidence,
+		&vulnerability.PublishedDate,
+		&vulnerability.DiscoveredDate,
 	)
 
 	if err != nil {
@@ -201,19 +367,100 @@ func scanVulnerability(queryer Queryer, queryName string, vulnerabilityRow *sql.
 	return vulnerability, nil
 }
 
-// FixedIn.Namespace are not necessary, they are overwritten by the vuln.
-// By setting the fixed version to minVersion, we can say that the vuln does'nt affect anymore.
+// InsertVulnerabilities inserts the vulnerabilities by batches of
+// InsertBatchSize, each batch in a single transaction. A failing vulnerability
+// rolls its batch back, the previous batches staying inserted.
+//
+// The namespaces of the FixedIn feature versions are not necessary, as they
+// are overwritten by the one of their vulnerability. A FixedIn at
+// versionfmt.MinVersion tells that the vulnerability no longer affects the
+// feature.
 func (pgSQL *pgSQL) InsertVulnerabilities(vulnerabilities []database.Vulnerability, generateNotifications bool) error {
-	for _, vulnerability := range vulnerabilities {
-		err := pgSQL.insertVulnerability(vulnerability, false, generateNotifications)
-		if err != nil {
+	batchSize := pgSQL.config.InsertBatchSize
+	if batchSize < 1 {
+		batchSize = 1
+	}
+
+	for start := 0; start < len(vulnerabilities); start += batchSize {
+		end := start + batchSize
+		if end > len(vulnerabilities) {
+			end = len(vulnerabilities)
+		}
+
+		if err := pgSQL.insertVulnerabilities(vulnerabilities[start:end], false, generateNotifications); err != nil {
+			pgSQL.refreshVulnerabilityResolutions(vulnerabilityNamespaces(vulnerabilities[:start]))
 			return err
 		}
 	}
+
+	// The data versions of their namespaces have advanced once per batch,
+	// their feature versions are resolved again once for all.
+	pgSQL.refreshVulnerabilityResolutions(vulnerabilityNamespaces(vulnerabilities))
 	return nil
 }
 
+// vulnerabilityNamespaces returns the names of the namespaces of
+// vulnerabilities.
+func vulnerabilityNamespaces(vulnerabilities []database.Vulnerability) []string {
+	var names []string
+	seen := make(map[string]struct{})
+	for _, v := range vulnerabilities {
+		if _, ok := seen[v.Namespace.Name]; !ok {
+			seen[v.Namespace.Name] = struct{}{}
+			names = append(names, v.Namespace.Name)
+		}
+	}
+	return names
+}
+
 func (pgSQL *pgSQL) insertVulnerability(vulnerability database.Vulnerability, onlyFixedIn, generateNotification bool) error {
+	err := pgSQL.insertVulnerabilities([]database.Vulnerability{vulnerability}, onlyFixedIn, generateNotification)
+	if err == nil {
+		pgSQL.refreshVulnerabilityResolutions([]string{vulnerability.Namespace.Name})
+	}
+	return err
+}
+
+// insertVulnerabilities inserts vulnerabilities in a single transaction.
+//
+// Vulnerability_Affects_FeatureVersion stays locked from the first
+// vulnerability having fixes until the commit, as the transactions that lock
+// it are serialized anyway; a batch saves their commits.
+func (pgSQL *pgSQL) insertVulnerabilities(vulnerabilities []database.Vulnerability, onlyFixedIn, generateNotification bool) error {
+	defer observeQueryTime("insertVulnerabilities", "all", time.Now())
+
+	// Begin transaction.
+	tx, err := pgSQL.Begin()
+	if err != nil {
+		return handleError("insertVulnerability.Begin()", err)
+	}
+
+	// Batch operations may wait long for their locks.
+	if err = pgSQL.allowLongTransaction(tx); err != nil {
+		tx.Rollback()
+		return handleError("insertVulnerability.allowLongTransaction", err)
+	}
+
+	for _, vulnerability := range vulnerabilities {
+		if err := pgSQL.insertVulnerabilityTx(tx, vulnerability, onlyFixedIn, generateNotification); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	// Commit transaction.
+	err = tx.Commit()
+	if err != nil {
+		tx.Rollback()
+		return handleError("insertVulnerability.Commit()", err)
+	}
+
+	return nil
+}
+
+// insertVulnerabilityTx inserts a vulnerability, or updates the existing one,
+// within tx. The caller rolls tx back if it fails.
+func (pgSQL *pgSQL) insertVulnerabilityTx(tx *sql.Tx, vulnerability database.Vulnerability, onlyFixedIn, generateNotification bool) error {
 	tf := time.Now()
 
 	// Verify parameters
@@ -238,17 +485,9 @@ func (pgSQL *pgSQL) insertVulnerability(vulnerability database.Vulnerability, on
 	// We do `defer observeQueryTime` here because we don't want to observe invalid vulnerabilities.
 	defer observeQueryTime("insertVulnerability", "all", tf)
 
-	// Begin transaction.
-	tx, err := pgSQL.Begin()
-	if err != nil {
-		tx.Rollback()
-		return handleError("insertVulnerability.Begin()", err)
-	}
-
 	// Find existing vulnerability and its Vulnerability_FixedIn_Features (for update).
 	existingVulnerability, err := findVulnerability(tx, vulnerability.Namespace.Name, vulnerability.Name, true)
 	if err != nil && err != commonerr.ErrNotFound {
-		tx.Rollback()
 		return err
 	}
 
@@ -268,8 +507,18 @@ func (pgSQL *pgSQL) insertVulnerability(vulnerability database.Vulnerability, on
 		updateMetadata := vulnerability.Description != existingVulnerability.Description ||
 			vulnerability.Link != existingVulnerability.Link ||
 			vulnerability.Severity != existingVulnerability.Severity ||
+			vulnerability.Withdrawn != existingVulnerability.Withdrawn ||
+			vulnerability.Confidence.Compare(existingVulnerability.Confidence) != 0 ||
+			(!vulnerability.PublishedDate.IsZero() && !vulnerability.PublishedDate.Equal(existingVulnerability.PublishedDate)) ||
 			!reflect.DeepEqual(castMetadata(vulnerability.Metadata), existingVulnerability.Metadata)
 
+		// Keep the dates of the vulnerability across its versions, unless the
+		// feed now provides its publication date.
+		if vulnerability.PublishedDate.IsZero() {
+			vulnerability.PublishedDate = existingVulnerability.PublishedDate
+		}
+		vulnerability.DiscoveredDate = existingVulnerability.DiscoveredDate
+
 		// Construct the entire list of FixedIn FeatureVersion, by using the
 		// the FixedIn list of the old vulnerability.
 		//
@@ -279,15 +528,13 @@ func (pgSQL *pgSQL) insertVulnerability(vulnerability database.Vulnerability, on
 		vulnerability.FixedIn, updateFixedIn = applyFixedInDiff(existingVulnerability.FixedIn, vulnerability.FixedIn)
 
 		if !updateMetadata && !updateFixedIn {
-			tx.Commit()
 			return nil
 		}
 
 		// Mark the old vulnerability as non latest.
 		_, err = tx.Exec(removeVulnerability, vulnerability.Namespace.Name, vulnerability.Name)
 		if err != nil {
-			tx.Rollback()
-			return handleError("removeVulnerability", err)
+				return handleError("removeVulnerability", err)
 		}
 	} else {
 		// The vulnerability is new, we don't want to have any
@@ -317,35 +564,36 @@ func (pgSQL *pgSQL) insertVulnerability(vulnerability database.Vulnerability, on
 		vulnerability.Link,
 		&vulnerability.Severity,
 		&vulnerability.Metadata,
+		vulnerability.Withdrawn,
+		pq.NullTime{Time: vulnerability.PublishedDate, Valid: !vulnerability.PublishedDate.IsZero()},
+		pq.NullTime{Time: vulnerability.DiscoveredDate, Valid: !vulnerability.DiscoveredDate.IsZero()},
+		&vulnerability.Confidence,
 	).Scan(&vulnerability.ID)
 
 	if err != nil {
-		tx.Rollback()
 		return handleError("insertVulnerability", err)
 	}
 
 	// Update Vulnerability_FixedIn_Feature and Vulnerability_Affects_FeatureVersion now.
 	err = pgSQL.insertVulnerabilityFixedInFeatureVersions(tx, vulnerability.ID, vulnerability.FixedIn)
 	if err != nil {
-		tx.Rollback()
 		return err
 	}
 
+	// Invalidate the results depending on this namespace.
+	_, err = tx.Exec(incrementNamespaceDataVersion, namespaceID)
+	if err != nil {
+		return handleError("incrementNamespaceDataVersion", err)
+	}
+
 	// Create a notification.
 	if generateNotification {
-		err = createNotification(tx, existingVulnerability.ID, vulnerability.ID)
+		err = createNotification(tx, existingVulnerability.ID, vulnerability.ID, pgSQL.config.DeduplicateNotifications)
 		if err != nil {
 			return err
 		}
 	}
 
-	// Commit transaction.
-	err = tx.Commit()
-	if err != nil {
-		tx.Rollback()
-		return handleError("insertVulnerability.Commit()", err)
-	}
-
 	return nil
 }
 
@@ -474,7 +722,7 @@ func (pgSQL *pgSQL) insertVulnerabilityFixedInFeatureVersions(tx *sql.Tx, vulner
 		}
 
 		// Insert Vulnerability_Affects_FeatureVersion.
-		err = linkVulnerabilityToFeatureVersions(tx, fixedInID, vulnerabilityID, fv.Feature.ID, fv.Feature.Namespace.VersionFormat, fv.Version)
+		err = linkVulnerabilityToFeatureVersions(tx, fixedInID, vulnerabilityID, fv.Feature.ID, fv.Feature.Namespace, fv.Version)
 		if err != nil {
 			return err
 		}
@@ -483,7 +731,7 @@ func (pgSQL *pgSQL) insertVulnerabilityFixedInFeatureVersions(tx *sql.Tx, vulner
 	return nil
 }
 
-func linkVulnerabilityToFeatureVersions(tx *sql.Tx, fixedInID, vulnerabilityID, featureID int, versionFormat, fixedInVersion string) error {
+func linkVulnerabilityToFeatureVersions(tx *sql.Tx, fixedInID, vulnerabilityID, featureID int, namespace database.Namespace, fixedInVersion string) error {
 	// Find every FeatureVersions of the Feature that the vulnerability affects.
 	// TODO(Quentin-M): LIMIT
 	rows, err := tx.Query(searchFeatureVersionByFeature, featureID)
@@ -493,6 +741,7 @@ func linkVulnerabilityToFeatureVersions(tx *sql.Tx, fixedInID, vulnerabilityID,
 	defer rows.Close()
 
 	var affecteds []database.FeatureVersion
+	var confidences []database.Confidence
 	for rows.Next() {
 		var affected database.FeatureVersion
 
@@ -501,14 +750,11 @@ func linkVulnerabilityToFeatureVersions(tx *sql.Tx, fixedInID, vulnerabilityID,
 			return handleError("searchFeatureVersionByFeature.Scan()", err)
 		}
 
-		cmp, err := versionfmt.Compare(versionFormat, affected.Version, fixedInVersion)
-		if err != nil {
-			return err
-		}
-		if cmp < 0 {
-			// The version of the FeatureVersion is lower than the fixed version of this vulnerability,
-			// thus, this FeatureVersion is affected by it.
+		// The version of the FeatureVersion is lower than the fixed version of this vulnerability,
+		// thus, this FeatureVersion is affected by it.
+		if ok, confidence := affectedBy(namespace, affected.Version, fixedInVersion); ok {
 			affecteds = append(affecteds, affected)
+			confidences = append(confidences, confidence)
 		}
 	}
 	if err = rows.Err(); err != nil {
@@ -517,9 +763,9 @@ func linkVulnerabilityToFeatureVersions(tx *sql.Tx, fixedInID, vulnerabilityID,
 	rows.Close()
 
 	// Insert into Vulnerability_Affects_FeatureVersion.
-	for _, affected := range affecteds {
+	for i, affected := range affecteds {
 		// TODO(Quentin-M): Batch me.
-		_, err := tx.Exec(insertVulnerabilityAffectsFeatureVersion, vulnerabilityID, affected.ID, fixedInID)
+		_, err := tx.Exec(insertVulnerabilityAffectsFeatureVersion, vulnerabilityID, affected.ID, fixedInID, confidences[i])
 		if err != nil {
 			return handleError("insertVulnerabilityAffectsFeatureVersion", err)
 		}
@@ -583,8 +829,15 @@ func (pgSQL *pgSQL) DeleteVulnerability(namespaceName, name string) error {
 		return handleError("removeVulnerability", err)
 	}
 
+	// Invalidate the results depending on this namespace.
+	_, err = tx.Exec(incrementNamespaceDataVersionByName, namespaceName)
+	if err != nil {
+		tx.Rollback()
+		return handleError("incrementNamespaceDataVersionByName", err)
+	}
+
 	// Create a notification.
-	err = createNotification(tx, vulnerabilityID, 0)
+	err = createNotification(tx, vulnerabilityID, 0, false)
 	if err != nil {
 		return err
 	}
@@ -596,5 +849,120 @@ func (pgSQL *pgSQL) DeleteVulnerability(namespaceName, name string) error {
 		return handleError("DeleteVulnerability.Commit()", err)
 	}
 
+	pgSQL.refreshVulnerabilityResolutions([]string{namespaceName})
 	return nil
-}
\ No newline at end of file
+}
+
+// FindUnreferencedVulnerabilities lists the vulnerabilities that no
+// Vulnerability_Affects_FeatureVersion row references, which are those
+// affecting no feature of the stored layers.
+func (pgSQL *pgSQL) FindUnreferencedVulnerabilities(namespaceName string) ([]database.Vulnerability, error) {
+	defer observeQueryTime("FindUnreferencedVulnerabilities", "all", time.Now())
+
+	rows, err := pgSQL.Query(searchUnreferencedVulnerability, namespaceName)
+	if err != nil {
+		return nil, handleError("searchUnreferencedVulnerability", err)
+	}
+	defer rows.Close()
+
+	var vulnerabilities []database.Vulnerability
+	for rows.Next() {
+		var vulnerability database.Vulnerability
+
+		err := rows.Scan(
+			&vulnerability.ID,
+			&vulnerability.Name,
+			&vulnerability.Namespace.ID,
+			&vulnerability.Namespace.Name,
+			&vulnerability.Severity,
+		)
+		if err != nil {
+			return nil, handleError("searchUnreferencedVulnerability.Scan()", err)
+		}
+		vulnerabilities = append(vulnerabilities, vulnerability)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, handleError("searchUnreferencedVulnerability.Rows()", err)
+	}
+
+	return vulnerabilities, nil
+}
+
+// PruneUnreferencedVulnerabilities deletes the vulnerabilities that
+// FindUnreferencedVulnerabilities lists, holding the lock of
+// Vulnerability_Affects_FeatureVersion so that no layer starts referencing
+// them meanwhile.
+func (pgSQL *pgSQL) PruneUnreferencedVulnerabilities(namespaceName string) (int, error) {
+	defer observeQueryTime("PruneUnreferencedVulnerabilities", "all", time.Now())
+
+	// Begin transaction.
+	tx, err := pgSQL.Begin()
+	if err != nil {
+		tx.Rollback()
+		return 0, handleError("PruneUnreferencedVulnerabilities.Begin()", err)
+	}
+
+	// Batch operations may wait long for their locks.
+	if err = pgSQL.allowLongTransaction(tx); err != nil {
+		tx.Rollback()
+		return 0, handleError("PruneUnreferencedVulnerabilities.allowLongTransaction", err)
+	}
+
+	// Lock Vulnerability_Affects_FeatureVersion exclusively.
+	// We don't want a layer being inserted to start referencing a vulnerability
+	// that is about to be deleted.
+	promConcurrentLockVAFV.Inc()
+	defer promConcurrentLockVAFV.Dec()
+	_, err = tx.Exec(lockVulnerabilityAffects)
+	if err != nil {
+		tx.Rollback()
+		return 0, handleError("PruneUnreferencedVulnerabilities.lockVulnerabilityAffects", err)
+	}
+
+	// No notification is created and the data version of the namespaces is
+	// left untouched, as no layer is affected by the deleted vulnerabilities.
+	result, err := tx.Exec(removeUnreferencedVulnerability, namespaceName)
+	if err != nil {
+		tx.Rollback()
+		return 0, handleError("removeUnreferencedVulnerability", err)
+	}
+
+	removed, err := result.RowsAffected()
+	if err != nil {
+		tx.Rollback()
+		return 0, handleError("removeUnreferencedVulnerability.RowsAffected()", err)
+	}
+
+	// Commit transaction.
+	err = tx.Commit()
+	if err != nil {
+		tx.Rollback()
+		return 0, handleError("PruneUnreferencedVulnerabilities.Commit()", err)
+	}
+
+	log.WithFields(log.Fields{"namespace": namespaceName, "removed vulnerabilities": removed}).Info("pruned unreferenced vulnerabilities")
+
+	return int(removed), nil
+}
+
+func (pgSQL *pgSQL) PurgeDeletedVulnerabilities(before time.Time) (int, error) {
+	defer observeQueryTime("PurgeDeletedVulnerabilities", "all", time.Now())
+
+	// Their fixes and the feature versions they affected are removed along
+	// with them. Nothing else reads the deleted vulnerabilities, so neither
+	// the data version of the namespaces nor the notifications change.
+	result, err := pgSQL.Exec(removeDeletedVulnerability, before)
+	if err != nil {
+		return 0, handleError("removeDeletedVulnerability", err)
+	}
+
+	removed, err := result.RowsAffected()
+	if err != nil {
+		return 0, handleError("removeDeletedVulnerability.RowsAffected()", err)
+	}
+
+	log.WithFields(log.Fields{"before": before, "removed vulnerabilities": removed}).Info("purged deleted vulnerabilities")
+
+	return int(removed), nil
+}
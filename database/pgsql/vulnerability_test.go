@@ -0,0 +1,66 @@
+package pgsql
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/MXi4oyu/DockerXScan/database"
+)
+
+// BenchmarkInsertVulnerabilities inserts a feed of Debian of 500
+// vulnerabilities, affecting the features of a stored layer, by batches of
+// several sizes, a batch of one being how they were inserted before.
+func BenchmarkInsertVulnerabilities(b *testing.B) {
+	datastore := openDatabaseForTest(b, "InsertVulnerabilities", true)
+	defer datastore.Close()
+
+	vulnerabilities, features := syntheticFeed(500)
+	if err := datastore.InsertLayer(database.Layer{Name: "BenchmarkInsertVulnerabilities", EngineVersion: 1, Namespace: &debian, Features: features}); err != nil {
+		b.Fatalf("InsertLayer() failed: %s", err)
+	}
+
+	for _, batchSize := range []int{1, 10, 100, 500} {
+		b.Run(fmt.Sprintf("batch size %d", batchSize), func(b *testing.B) {
+			datastore.config.InsertBatchSize = batchSize
+			for i := 0; i < b.N; i++ {
+				// Each run inserts new vulnerabilities, rather than finding
+				// those of the previous one unchanged.
+				feed := make([]database.Vulnerability, len(vulnerabilities))
+				for j, v := range vulnerabilities {
+					v.Name = fmt.Sprintf("%s-%d-%d", v.Name, batchSize, i)
+					feed[j] = v
+				}
+				if err := datastore.InsertVulnerabilities(feed, false); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestListVulnerabilitiesSinceDeleted(t *testing.T) {
+	datastore := openDatabaseForTest(t, "ListVulnerabilitiesSinceDeleted", false)
+	defer datastore.Close()
+
+	vulnerabilities, _ := syntheticFeed(2)
+	mustInsertVulnerabilities(t, datastore, vulnerabilities...)
+	listed, _, err := datastore.ListVulnerabilitiesSince(debian.Name, time.Time{}, 10, 0)
+	if err != nil || len(listed) != 2 {
+		t.Fatalf("ListVulnerabilitiesSince() listed %d vulnerabilities and %v, want 2", len(listed), err)
+	}
+	since := listed[0].UpdatedAt
+
+	// The deleted vulnerability is listed with its DeletedAt time, while the
+	// other one is not modified since.
+	if err := datastore.DeleteVulnerability(debian.Name, vulnerabilities[0].Name); err != nil {
+		t.Fatal(err)
+	}
+	listed, _, err = datastore.ListVulnerabilitiesSince(debian.Name, since, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(listed) != 1 || listed[0].Name != vulnerabilities[0].Name || listed[0].DeletedAt.IsZero() {
+		t.Errorf("ListVulnerabilitiesSince() after a deletion listed %+v, want the deleted %s only", listed, vulnerabilities[0].Name)
+	}
+}
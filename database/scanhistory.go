@@ -0,0 +1,50 @@
+package database
+
+import (
+	"strings"
+	"time"
+
+	"github.com/MXi4oyu/DockerXScan/common/commonerr"
+)
+
+// ErrInvalidScan is returned when a scan is recorded without the digest of
+// the image or the tag it was scanned by.
+var ErrInvalidScan = commonerr.NewBadRequestError("database: a scan must have the digest of an image and its tag")
+
+// ScanSummary is the number of vulnerabilities found by a scan of an image.
+type ScanSummary struct {
+	Vulnerabilities int
+	Fixable         int
+
+	// BySeverity is the number of vulnerabilities of each severity.
+	BySeverity map[Severity]int
+}
+
+// ScanRecord is the summary of the latest scan of an image by one of its
+// tags, as recorded by RecordScan.
+type ScanRecord struct {
+	Model
+
+	// Digest is the digest of the manifest of the image, and Tag the full
+	// reference it was scanned by, such as "quay.io/coreos/clair:v2.0.0".
+	// Repository is the reference without its tag or digest.
+	Digest     string
+	Tag        string
+	Repository string
+
+	Summary ScanSummary
+	Scanned time.Time
+}
+
+// ScanRepository returns the repository of an image reference, without its
+// tag or digest, such as "quay.io/coreos/clair" for
+// "quay.io/coreos/clair:v2.0.0".
+func ScanRepository(reference string) string {
+	if i := strings.Index(reference, "@"); i >= 0 {
+		reference = reference[:i]
+	}
+	if i := strings.LastIndex(reference, ":"); i > strings.LastIndex(reference, "/") {
+		reference = reference[:i]
+	}
+	return reference
+}
@@ -0,0 +1,42 @@
+package database
+
+import (
+	"time"
+
+	"github.com/MXi4oyu/DockerXScan/common/commonerr"
+)
+
+// ErrInvalidSuppression is returned when a Suppression does not name its
+// namespace, feature and vulnerability, or does not tell why and by whom the
+// risk is accepted.
+var ErrInvalidSuppression = commonerr.NewBadRequestError("database: a suppression must have a namespace, a feature, a vulnerability, a justification and an author")
+
+// Suppression accepts the risk of a vulnerability affecting a feature of a
+// namespace, such as one that can't be exploited in the way the images use
+// the feature. Unlike a whitelist, it records why and by whom it was decided.
+type Suppression struct {
+	Model
+
+	NamespaceName     string
+	FeatureName       string
+	VulnerabilityName string
+
+	Justification string
+	Author        string
+
+	// Created is when the suppression was last set, and Expires when it stops
+	// applying, or the zero time if it never does.
+	Created time.Time
+	Expires time.Time
+}
+
+// Valid returns whether the suppression identifies a vulnerability of a
+// feature and records why and by whom the risk is accepted.
+func (s Suppression) Valid() bool {
+	return s.NamespaceName != "" && s.FeatureName != "" && s.VulnerabilityName != "" && s.Justification != "" && s.Author != ""
+}
+
+// Active returns whether the suppression applies at the given time.
+func (s Suppression) Active(now time.Time) bool {
+	return s.Expires.IsZero() || now.Before(s.Expires)
+}
@@ -6,7 +6,7 @@ import (
 	"log"
 	"github.com/MXi4oyu/DockerXScan/tarutil"
 	"github.com/MXi4oyu/DockerXScan/versionfmt"
-	"github.com/MXi4oyu/DockerXScan/versionfmt/dpkg"
+	"github.com/MXi4oyu/DockerXScan/versionfmt/apk"
 	"github.com/MXi4oyu/DockerXScan/featurefmt"
 	"github.com/MXi4oyu/DockerXScan/database"
 )
@@ -29,6 +29,8 @@ func (l lister) ListFeatures(files tarutil.FilesMap) (features []database.Featur
 	ipkg:= database.FeatureVersion{}
 
 	scanner:=bufio.NewScanner(bytes.NewBuffer(file))
+	// Allow lines as long as the whole file, instead of silently stopping.
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), len(file)+1)
 
 	for scanner.Scan() {
 		line := scanner.Text()
@@ -42,7 +44,7 @@ func (l lister) ListFeatures(files tarutil.FilesMap) (features []database.Featur
 			ipkg.Feature.Name = line[2:]
 		case line[:2] == "V:":
 			version := string(line[2:])
-			err := versionfmt.Valid(dpkg.ParserName, version)
+			err := versionfmt.Valid(apk.ParserName, version)
 			if err != nil {
 				log.Println("could not parse package version. skipping")
 			} else {
@@ -62,9 +64,16 @@ func (l lister) ListFeatures(files tarutil.FilesMap) (features []database.Featur
 		}
 	}
 
+	if err := scanner.Err(); err != nil {
+		log.Println("could not read apk installed file. skipping")
+		return []database.FeatureVersion{}, err
+	}
+
 	// Convert the map into a slice.
 	pkgs := make([]database.FeatureVersion, 0, len(pkgSet))
 	for _, pkg := range pkgSet {
+		pkg.Feature.Kind = database.OSFeature
+		pkg.Location = "lib/apk/db/installed"
 		pkgs = append(pkgs, pkg)
 	}
 
@@ -0,0 +1,15 @@
+//go:build gofuzz
+// +build gofuzz
+
+package apk
+
+import "github.com/MXi4oyu/DockerXScan/tarutil"
+
+// Fuzz is the go-fuzz entry point for the apk installed file parser.
+func Fuzz(data []byte) int {
+	features, err := lister{}.ListFeatures(tarutil.FilesMap{"lib/apk/db/installed": data})
+	if err != nil || len(features) == 0 {
+		return 0
+	}
+	return 1
+}
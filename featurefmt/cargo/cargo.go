@@ -0,0 +1,162 @@
+// Package cargo implements a featurefmt.Lister for the crates built into Rust
+// binaries with cargo-auditable, which embeds their dependency tree.
+package cargo
+
+import (
+	"bytes"
+	"compress/zlib"
+	"debug/elf"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"log"
+	"strings"
+
+	"github.com/MXi4oyu/DockerXScan/database"
+	"github.com/MXi4oyu/DockerXScan/featurefmt"
+	"github.com/MXi4oyu/DockerXScan/tarutil"
+	"github.com/MXi4oyu/DockerXScan/versionfmt"
+	"github.com/MXi4oyu/DockerXScan/versionfmt/semver"
+)
+
+const (
+	// NamespaceName is the namespace of the crates, which do not depend on the
+	// distribution of the image.
+	NamespaceName = "cargo"
+
+	// depSection is the ELF section in which cargo-auditable stores the
+	// zlib-compressed JSON of the dependency tree.
+	depSection = ".dep-v0"
+
+	// maxDepInfoSize bounds the size of the decompressed dependency tree.
+	maxDepInfoSize = 8 << 20
+)
+
+// binaryPaths are the directories in which the binaries of Rust services are
+// usually installed.
+var binaryPaths = []string{
+	"usr/local/bin/",
+	"app/",
+}
+
+type depInfo struct {
+	Packages []struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+		Source  string `json:"source"`
+		Kind    string `json:"kind"`
+		Root    bool   `json:"root"`
+	} `json:"packages"`
+}
+
+type lister struct{}
+
+func init() {
+	featurefmt.RegisterLister("cargo", &lister{})
+}
+
+// ListFeatures lists the crates embedded in the binaries. The crate of a
+// binary itself and its build dependencies, which are not part of it, are
+// left out.
+func (l lister) ListFeatures(files tarutil.FilesMap) ([]database.FeatureVersion, error) {
+	packagesMap := make(map[string]database.FeatureVersion)
+	for filename, content := range files {
+		if !isBinaryPath(filename) || !bytes.HasPrefix(content, []byte(elf.ELFMAG)) {
+			continue
+		}
+
+		info, err := readDepInfo(content)
+		if err != nil {
+			log.Printf("could not read the crates of %s. skipping", filename)
+			continue
+		}
+		if info == nil {
+			continue
+		}
+
+		for _, p := range info.Packages {
+			if p.Root || p.Kind == "build" || p.Name == "" {
+				continue
+			}
+			if err := versionfmt.Valid(semver.ParserName, p.Version); err != nil {
+				log.Println("could not parse package version. skipping")
+				continue
+			}
+
+			pkg := database.FeatureVersion{
+				Feature: database.Feature{
+					Name: p.Name,
+					Namespace: database.Namespace{
+						Name:          NamespaceName,
+						VersionFormat: semver.ParserName,
+						Kind:          database.LanguageNamespace,
+					},
+					Kind: database.ApplicationFeature,
+				},
+				Version:  p.Version,
+				Location: filename,
+			}
+			// A crate embedded in several binaries is located by the first,
+			// so that its location doesn't depend on the order of the files.
+			if existing, ok := packagesMap[pkg.Feature.Name+"#"+pkg.Version]; ok && existing.Location < filename {
+				continue
+			}
+			packagesMap[pkg.Feature.Name+"#"+pkg.Version] = pkg
+		}
+	}
+
+	packages := make([]database.FeatureVersion, 0, len(packagesMap))
+	for _, pkg := range packagesMap {
+		packages = append(packages, pkg)
+	}
+
+	return packages, nil
+}
+
+func (l lister) RequiredFilenames() []string {
+	return binaryPaths
+}
+
+// readDepInfo returns the dependency tree embedded in an ELF binary, or nil
+// if it was not built with cargo-auditable.
+func readDepInfo(content []byte) (*depInfo, error) {
+	f, err := elf.NewFile(bytes.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	section := f.Section(depSection)
+	if section == nil {
+		return nil, nil
+	}
+
+	zr, err := zlib.NewReader(section.Open())
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	data, err := ioutil.ReadAll(io.LimitReader(zr, maxDepInfoSize))
+	if err != nil {
+		return nil, err
+	}
+
+	var info depInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		return nil, err
+	}
+
+	return &info, nil
+}
+
+// isBinaryPath returns whether a file is directly in one of the directories
+// of the binaries.
+func isBinaryPath(filename string) bool {
+	for _, prefix := range binaryPaths {
+		if strings.HasPrefix(filename, prefix) {
+			return !strings.Contains(strings.TrimPrefix(filename, prefix), "/")
+		}
+	}
+	return false
+}
@@ -0,0 +1,101 @@
+// Package conda implements a featurefmt.Lister for the packages installed in
+// conda environments.
+package conda
+
+import (
+	"encoding/json"
+	"log"
+	"strings"
+
+	"github.com/MXi4oyu/DockerXScan/database"
+	"github.com/MXi4oyu/DockerXScan/featurefmt"
+	"github.com/MXi4oyu/DockerXScan/tarutil"
+	"github.com/MXi4oyu/DockerXScan/versionfmt"
+	"github.com/MXi4oyu/DockerXScan/versionfmt/conda"
+)
+
+// NamespaceName is the namespace of the conda packages, which do not depend
+// on the distribution of the image.
+const NamespaceName = "conda"
+
+// condaMetaPaths are the conda-meta directories of the usual installation
+// prefixes, in which conda writes a JSON file per installed package.
+var condaMetaPaths = []string{
+	"opt/conda/conda-meta/",
+	"opt/miniconda3/conda-meta/",
+	"opt/anaconda3/conda-meta/",
+}
+
+type lister struct{}
+
+func init() {
+	featurefmt.RegisterLister("conda", &lister{})
+}
+
+// ListFeatures lists the packages described by the conda-meta files. The
+// build string of a package is not kept, as vulnerabilities only depend on
+// its version.
+func (l lister) ListFeatures(files tarutil.FilesMap) ([]database.FeatureVersion, error) {
+	packagesMap := make(map[string]database.FeatureVersion)
+	for filename, content := range files {
+		if !isCondaMeta(filename) {
+			continue
+		}
+
+		var meta struct {
+			Name    string `json:"name"`
+			Version string `json:"version"`
+		}
+		if err := json.Unmarshal(content, &meta); err != nil || meta.Name == "" {
+			log.Printf("could not parse conda package %s. skipping", filename)
+			continue
+		}
+		if err := versionfmt.Valid(conda.ParserName, meta.Version); err != nil {
+			log.Println("could not parse package version. skipping")
+			continue
+		}
+
+		pkg := database.FeatureVersion{
+			Feature: database.Feature{
+				Name: meta.Name,
+				Namespace: database.Namespace{
+					Name:          NamespaceName,
+					VersionFormat: conda.ParserName,
+					Kind:          database.LanguageNamespace,
+				},
+				Kind: database.ApplicationFeature,
+			},
+			Version:  meta.Version,
+			Location: filename,
+		}
+		// A package described twice is located by the first file, so that its
+		// location doesn't depend on the order of the files.
+		if existing, ok := packagesMap[pkg.Feature.Name+"#"+pkg.Version]; ok && existing.Location < filename {
+			continue
+		}
+		packagesMap[pkg.Feature.Name+"#"+pkg.Version] = pkg
+	}
+
+	packages := make([]database.FeatureVersion, 0, len(packagesMap))
+	for _, pkg := range packagesMap {
+		packages = append(packages, pkg)
+	}
+
+	return packages, nil
+}
+
+func (l lister) RequiredFilenames() []string {
+	return condaMetaPaths
+}
+
+// isCondaMeta returns whether a file is the description of a package, directly
+// in a conda-meta directory.
+func isCondaMeta(filename string) bool {
+	for _, prefix := range condaMetaPaths {
+		if strings.HasPrefix(filename, prefix) {
+			name := strings.TrimPrefix(filename, prefix)
+			return strings.HasSuffix(name, ".json") && !strings.Contains(name, "/")
+		}
+	}
+	return false
+}
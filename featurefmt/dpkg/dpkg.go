@@ -2,6 +2,7 @@ package dpkg
 
 import (
 	"bufio"
+	"sort"
 	"strings"
 	"regexp"
 	"log"
@@ -15,33 +16,109 @@ import (
 var (
 	dpkgSrcCaptureRegexp      = regexp.MustCompile(`Source: (?P<name>[^\s]*)( \((?P<version>.*)\))?`)
 	dpkgSrcCaptureRegexpNames = dpkgSrcCaptureRegexp.SubexpNames()
+
+	// notInstalledStates are the states of the packages whose files are not,
+	// or not entirely, installed, as left by an interrupted apt or dpkg run.
+	notInstalledStates = map[string]struct{}{
+		"not-installed":   {},
+		"config-files":    {},
+		"half-installed":  {},
+		"unpacked":        {},
+		"half-configured": {},
+	}
+)
+
+const (
+	statusFile = "var/lib/dpkg/status"
+
+	// statusDir holds one status file per package instead, as written by the
+	// distroless images, along with the .md5sums of their files.
+	statusDir = "var/lib/dpkg/status.d/"
 )
+
 type lister struct{}
 
 func init()  {
 	featurefmt.RegisterLister("dpkg",&lister{})
 }
 
+// ListFeatures lists the packages of the status file of dpkg, or of the
+// status files of each package in the status.d directory of the distroless
+// images.
 func (l lister) ListFeatures(files tarutil.FilesMap) (features []database.FeatureVersion,errs error) {
-	f, hasFile := files["var/lib/dpkg/status"]
+	var statusFiles []string
+	if _, hasFile := files[statusFile]; hasFile {
+		statusFiles = append(statusFiles, statusFile)
+	}
+	var split []string
+	for filename := range files {
+		if strings.HasPrefix(filename, statusDir) && !strings.HasSuffix(filename, ".md5sums") && !strings.Contains(strings.TrimPrefix(filename, statusDir), "/") {
+			split = append(split, filename)
+		}
+	}
+	sort.Strings(split)
+	statusFiles = append(statusFiles, split...)
 
-	if !hasFile{
+	if len(statusFiles) == 0 {
 		return []database.FeatureVersion{},nil
 	}
+
 	// Create a map to store packages and ensure their uniqueness
 	packagesMap:=make(map[string]database.FeatureVersion)
+	excluded := 0
+	for _, filename := range statusFiles {
+		if err := parseStatus(files[filename], filename, packagesMap, &excluded); err != nil {
+			log.Printf("could not read dpkg status file %s. skipping", filename)
+			return []database.FeatureVersion{}, err
+		}
+	}
 
+	if excluded > 0 {
+		log.Printf("dpkg: excluded %d packages that are not fully installed", excluded)
+	}
+
+	// Convert the map to a slice
+	packages := make([]database.FeatureVersion, 0, len(packagesMap))
+	for _, pkg := range packagesMap {
+		pkg.Feature.Kind = database.OSFeature
+		packages = append(packages, pkg)
+	}
+	return packages, nil
+}
+
+// parseStatus adds the installed packages of the paragraphs of a status file
+// to packagesMap, counting those not fully installed in excluded.
+func parseStatus(f []byte, location string, packagesMap map[string]database.FeatureVersion, excluded *int) error {
 	var pkg database.FeatureVersion
 	var err error
 
 	scanner := bufio.NewScanner(strings.NewReader(string(f)))
+	// Allow lines as long as the whole file, instead of silently stopping.
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), len(f)+1)
+
+	// add records the current package once its paragraph has been read, as
+	// the Source field may come before or after the Version field.
+	var status string
+	add := func() {
+		if _, notInstalled := notInstalledStates[status]; notInstalled && pkg.Feature.Name != "" {
+			(*excluded)++
+		} else if pkg.Feature.Name != "" && pkg.Version != "" {
+			if pkg.SourceName == pkg.Feature.Name {
+				pkg.SourceName = ""
+			}
+			pkg.Location = location
+			packagesMap[pkg.Feature.Name+"#"+pkg.Version] = pkg
+		}
+		pkg = database.FeatureVersion{}
+		status = ""
+	}
 
+	var sourceVersion string
 	for scanner.Scan(){
 		line:=scanner.Text()
 
 		if strings.HasPrefix(line,"Package: "){
 			pkg.Feature.Name=strings.TrimSpace(strings.TrimPrefix(line, "Package: "))
-			pkg.Version=""
 		}else if strings.HasPrefix(line,"Source: "){
 
 			srcCapture := dpkgSrcCaptureRegexp.FindAllStringSubmatch(line, -1)[0]
@@ -50,7 +127,9 @@ func (l lister) ListFeatures(files tarutil.FilesMap) (features []database.Featur
 				md[dpkgSrcCaptureRegexpNames[i]] = strings.TrimSpace(n)
 			}
 
-			pkg.Feature.Name=md["name"]
+			// Advisories are keyed by source package, so keep its name along
+			// with the binary package's.
+			pkg.SourceName=md["name"]
 
 			if md["version"] != ""{
 				version := md["version"]
@@ -58,10 +137,17 @@ func (l lister) ListFeatures(files tarutil.FilesMap) (features []database.Featur
 				if err !=nil{
 					log.Println("could not parse package version. skipping")
 				}else{
-					pkg.Version=version
+					// The source version is the one advisories refer to.
+					sourceVersion=version
 				}
 			}
-		}else if strings.HasPrefix(line, "Version: ") && pkg.Version == ""{
+		}else if strings.HasPrefix(line, "Status: "){
+			// The status is made of the wanted action, the error flag and the
+			// state of the package, such as "install ok installed".
+			if fields := strings.Fields(strings.TrimPrefix(line, "Status: ")); len(fields) == 3 {
+				status = fields[2]
+			}
+		}else if strings.HasPrefix(line, "Version: "){
 			version := strings.TrimPrefix(line, "Version: ")
 			err = versionfmt.Valid(dpkg.ParserName, version)
 			if err != nil {
@@ -70,25 +156,23 @@ func (l lister) ListFeatures(files tarutil.FilesMap) (features []database.Featur
 				pkg.Version = version
 			}
 		}else if line == "" {
-			pkg.Feature.Name = ""
-			pkg.Version = ""
-		}
-
-		if pkg.Feature.Name != "" && pkg.Version != "" {
-			packagesMap[pkg.Feature.Name+"#"+pkg.Version] = pkg
-			pkg.Feature.Name = ""
-			pkg.Version = ""
+			if sourceVersion != "" {
+				pkg.Version = sourceVersion
+			}
+			add()
+			sourceVersion = ""
 		}
 	}
-
-	// Convert the map to a slice
-	packages := make([]database.FeatureVersion, 0, len(packagesMap))
-	for _, pkg := range packagesMap {
-		packages = append(packages, pkg)
+	if sourceVersion != "" {
+		pkg.Version = sourceVersion
 	}
-	return packages, nil
+	add()
+
+	return scanner.Err()
 }
 
+// RequiredFilenames returns the status file, whose name is also the prefix of
+// the status.d directory.
 func (l lister) RequiredFilenames() []string {
-	return []string{"var/lib/dpkg/status"}
+	return []string{statusFile}
 }
\ No newline at end of file
@@ -0,0 +1,151 @@
+package dpkg
+
+import (
+	"archive/tar"
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/MXi4oyu/DockerXScan/database"
+	"github.com/MXi4oyu/DockerXScan/tarutil"
+)
+
+// expectedFeature is what a feature version listed from a status file is
+// expected to be.
+type expectedFeature struct {
+	name, version, sourceName, location string
+}
+
+func loadFile(t *testing.T, name string) []byte {
+	d, err := ioutil.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+// testListFeatures lists the features of files and compares them, by name, to
+// the expected ones.
+func testListFeatures(t *testing.T, files tarutil.FilesMap, expected []expectedFeature) {
+	features, err := lister{}.ListFeatures(files)
+	if err != nil {
+		t.Fatalf("ListFeatures() failed: %s", err)
+	}
+
+	sort.Slice(features, func(i, j int) bool { return features[i].Feature.Name < features[j].Feature.Name })
+	sort.Slice(expected, func(i, j int) bool { return expected[i].name < expected[j].name })
+	if len(features) != len(expected) {
+		var names []string
+		for _, f := range features {
+			names = append(names, f.Feature.Name)
+		}
+		t.Fatalf("ListFeatures() listed %d features %v, want %d", len(features), names, len(expected))
+	}
+
+	for i, f := range features {
+		e := expected[i]
+		got := expectedFeature{f.Feature.Name, f.Version, f.SourceName, f.Location}
+		if got != e {
+			t.Errorf("ListFeatures() listed %+v, want %+v", got, e)
+		}
+		if f.Feature.Kind != database.OSFeature {
+			t.Errorf("ListFeatures() listed %s of kind %q, want %q", f.Feature.Name, f.Feature.Kind, database.OSFeature)
+		}
+	}
+}
+
+func TestListFeaturesSourcePackages(t *testing.T) {
+	testListFeatures(t, tarutil.FilesMap{statusFile: loadFile(t, "status")}, []expectedFeature{
+		{"base-files", "11.1+deb11u5", "", statusFile},
+		// The advisories of a binary package are those of its source package.
+		{"libssl1.1", "1.1.1n-0+deb11u3", "openssl", statusFile},
+		// The version of the source package is the one they refer to.
+		{"libc6", "2.31-13", "glibc", statusFile},
+		{"zlib1g", "1:1.2.11.dfsg-2+deb11u2", "zlib", statusFile},
+	})
+}
+
+func TestListFeaturesNoStatus(t *testing.T) {
+	testListFeatures(t, tarutil.FilesMap{"etc/os-release": []byte("ID=debian\n")}, nil)
+}
+
+func TestListFeaturesSymlinkedDatabase(t *testing.T) {
+	tarutil.SetFollowSymlinks(true)
+	defer tarutil.SetFollowSymlinks(false)
+
+	// The database of dpkg is moved out of var/lib, which links to it.
+	status := loadFile(t, "status")
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, hdr := range []*tar.Header{
+		{Name: "var/lib/dpkg", Linkname: "../../usr/share/dpkg", Typeflag: tar.TypeSymlink},
+		{Name: "usr/share/dpkg/status", Size: int64(len(status)), Mode: 0644, Typeflag: tar.TypeReg},
+	} {
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			tw.Write(status)
+		}
+	}
+	tw.Close()
+
+	files, err := tarutil.ExtractFiles(bytes.NewReader(buf.Bytes()), lister{}.RequiredFilenames())
+	if err != nil {
+		t.Fatalf("ExtractFiles() failed: %s", err)
+	}
+	testListFeatures(t, files, []expectedFeature{
+		{"base-files", "11.1+deb11u5", "", statusFile},
+		{"libssl1.1", "1.1.1n-0+deb11u3", "openssl", statusFile},
+		{"libc6", "2.31-13", "glibc", statusFile},
+		{"zlib1g", "1:1.2.11.dfsg-2+deb11u2", "zlib", statusFile},
+	})
+}
+
+func TestListFeaturesNotInstalled(t *testing.T) {
+	// Only the packages whose state is installed are, whatever the wanted
+	// action, as those left by an interrupted apt or dpkg run or removed with
+	// their configuration files kept are not, or not entirely.
+	testListFeatures(t, tarutil.FilesMap{statusFile: loadFile(t, "status-interrupted")}, []expectedFeature{
+		{"base-files", "11.1+deb11u5", "", statusFile},
+		{"zlib1g", "1:1.2.11.dfsg-2+deb11u2", "zlib", statusFile},
+	})
+}
+
+func TestListFeaturesDistroless(t *testing.T) {
+	// The distroless images have no status file but one per package in
+	// status.d, along with the .md5sums of their files, which are not status
+	// files, no more than those of the directories below it.
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	tw.WriteHeader(&tar.Header{Name: statusDir, Mode: 0755, Typeflag: tar.TypeDir})
+	for name, fixture := range map[string]string{
+		"base":            "status.d/base",
+		"libssl3":         "status.d/libssl3",
+		"libssl3.md5sums": "status.d/libssl3.md5sums",
+		"tzdata":          "status.d/tzdata",
+		"nested/libssl3":  "status.d/libssl3",
+	} {
+		content := loadFile(t, fixture)
+		if name == "nested/libssl3" {
+			content = bytes.Replace(content, []byte("Package: libssl3"), []byte("Package: libssl-nested"), 1)
+		}
+		if err := tw.WriteHeader(&tar.Header{Name: statusDir + name, Size: int64(len(content)), Mode: 0644, Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write(content)
+	}
+	tw.Close()
+
+	files, err := tarutil.ExtractFiles(bytes.NewReader(buf.Bytes()), lister{}.RequiredFilenames())
+	if err != nil {
+		t.Fatalf("ExtractFiles() failed: %s", err)
+	}
+	testListFeatures(t, files, []expectedFeature{
+		{"base-files", "12.4+deb12u5", "", statusDir + "base"},
+		{"libssl3", "3.0.11-1~deb12u2", "openssl", statusDir + "libssl3"},
+		{"tzdata", "2024a-0+deb12u1", "", statusDir + "tzdata"},
+	})
+}
@@ -0,0 +1,15 @@
+//go:build gofuzz
+// +build gofuzz
+
+package dpkg
+
+import "github.com/MXi4oyu/DockerXScan/tarutil"
+
+// Fuzz is the go-fuzz entry point for the dpkg status file parser.
+func Fuzz(data []byte) int {
+	features, err := lister{}.ListFeatures(tarutil.FilesMap{"var/lib/dpkg/status": data})
+	if err != nil || len(features) == 0 {
+		return 0
+	}
+	return 1
+}
@@ -1,14 +1,37 @@
 package featurefmt
 
 import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
 	"sync"
 	"github.com/MXi4oyu/DockerXScan/tarutil"
 	"github.com/MXi4oyu/DockerXScan/database"
+	"github.com/MXi4oyu/DockerXScan/featurens"
+	log "github.com/sirupsen/logrus"
 )
 
 var (
 	listersM sync.RWMutex
 	listers  = make(map[string]Lister)
+
+	// disabledListers are the names of the registered Listers skipped by
+	// ListFeatures and RequiredFilenames.
+	disabledListers = make(map[string]struct{})
+
+	// alternateLocations are the directories in which the package databases
+	// of some distributions are moved from the usual ones, by prefix of the
+	// files required by the Listers: rpm keeps its database in /usr on Fedora
+	// and openSUSE, as does apk on the usrmerged Alpine images.
+	alternateLocations = map[string][]string{
+		"var/lib/rpm/": {"usr/lib/sysimage/rpm/"},
+		"lib/apk/db/":  {"usr/lib/apk/db/"},
+	}
+
+	// searchRoots are the directories, besides the root of the layers, in which
+	// the package databases are looked for, none in default.
+	searchRoots []string
 )
 
 type Lister interface{
@@ -19,29 +42,221 @@ type Lister interface{
 func ListFeatures(files tarutil.FilesMap)(features []database.FeatureVersion,errs error){
 	listersM.RLock()
 	defer listersM.RUnlock()
-	var totalFeatures []database.FeatureVersion
-	for _, lister := range listers {
-		features, err := lister.ListFeatures(files)
-		if err != nil {
-			return []database.FeatureVersion{}, err
+
+	totalFeatures := listRoot(files)
+	if nestedRoots {
+		totalFeatures = append(totalFeatures, listNestedRoots(files)...)
+	}
+
+	return totalFeatures, nil
+}
+
+// listRoot runs the enabled Listers over the files of a root. They run
+// concurrently, as they read different package databases, and their features
+// are sorted so that the result doesn't depend on which finishes first.
+func listRoot(files tarutil.FilesMap) []database.FeatureVersion {
+	var names []string
+	for name := range listers {
+		if _, disabled := disabledListers[name]; !disabled {
+			names = append(names, name)
 		}
+	}
+	sort.Strings(names)
+
+	results := make([][]database.FeatureVersion, len(names))
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func(i int, name string, lister Lister) {
+			defer wg.Done()
+
+			// The package databases come from untrusted images: a file that
+			// can't be parsed is skipped rather than failing the whole layer,
+			// or the features found by the other Listers.
+			located, moved := locateFiles(name, lister, filterFiles(name, files))
+			features, err := listFeatures(lister, located)
+			if err != nil {
+				log.Printf("featurefmt: %s could not list features, skipping: %s", name, err)
+				return
+			}
+			relocate(features, moved)
+			results[i] = features
+		}(i, name, listers[name])
+	}
+	wg.Wait()
+
+	var totalFeatures []database.FeatureVersion
+	for _, features := range results {
 		totalFeatures = append(totalFeatures, features...)
 	}
+	sort.SliceStable(totalFeatures, func(i, j int) bool {
+		a, b := totalFeatures[i], totalFeatures[j]
+		if a.Feature.Namespace.Name != b.Feature.Namespace.Name {
+			return a.Feature.Namespace.Name < b.Feature.Namespace.Name
+		}
+		if a.Feature.Name != b.Feature.Name {
+			return a.Feature.Name < b.Feature.Name
+		}
+		return a.Version < b.Version
+	})
 
-	return totalFeatures, nil
+	return totalFeatures
+}
+
+// listFeatures calls a Lister, turning any panic into an error.
+func listFeatures(lister Lister, files tarutil.FilesMap) (features []database.FeatureVersion, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			features, err = nil, fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	return lister.ListFeatures(files)
 }
 
 func RequiredFilenames() (files []string) {
 	listersM.RLock()
 	defer listersM.RUnlock()
 
-	for _, lister := range listers {
-		files = append(files, lister.RequiredFilenames()...)
+	for name, lister := range listers {
+		if _, disabled := disabledListers[name]; disabled {
+			continue
+		}
+		for _, filename := range lister.RequiredFilenames() {
+			files = append(files, locations(filename)...)
+			if nestedRoots {
+				for _, location := range baseLocations(filename) {
+					files = append(files, tarutil.NestedPrefix+location)
+				}
+			}
+		}
+	}
+
+	// The system of a nested root is detected to associate its features with
+	// their namespace.
+	if nestedRoots {
+		for _, filename := range featurens.RequiredFilenames() {
+			files = append(files, tarutil.NestedPrefix+filename)
+		}
 	}
 
 	return
 }
 
+// SetSearchRoots sets the directories (e.g. "sysroot") besides the root of the
+// layers in which the package databases are looked for, such as the root of a
+// system installed in a subdirectory of the image.
+func SetSearchRoots(roots []string) {
+	listersM.Lock()
+	defer listersM.Unlock()
+
+	searchRoots = nil
+	for _, root := range roots {
+		root = strings.Trim(path.Clean("/"+root), "/")
+		if root != "" {
+			searchRoots = append(searchRoots, root+"/")
+		}
+	}
+}
+
+// locations returns the paths at which a file required by a Lister is looked
+// for, in order: the path itself, its alternate locations, and then those in
+// each of the search roots.
+func locations(filename string) []string {
+	paths := baseLocations(filename)
+
+	locations := paths
+	for _, root := range searchRoots {
+		for _, p := range paths {
+			locations = append(locations, root+p)
+		}
+	}
+
+	return locations
+}
+
+// baseLocations returns the paths at which a file required by a Lister is
+// looked for in a root: the path itself and its alternate locations.
+func baseLocations(filename string) []string {
+	paths := []string{filename}
+	for prefix, alternates := range alternateLocations {
+		if strings.HasPrefix(filename, prefix) {
+			for _, alternate := range alternates {
+				paths = append(paths, alternate+strings.TrimPrefix(filename, prefix))
+			}
+		}
+	}
+
+	return paths
+}
+
+// locateFiles returns the files of a layer as a Lister expects them: the files
+// it requires that are found at another of their locations are moved at the
+// path it requires. The locations at which they were found are returned by
+// required path.
+func locateFiles(name string, lister Lister, files tarutil.FilesMap) (tarutil.FilesMap, map[string]string) {
+	located, copied := files, false
+	moved := make(map[string]string)
+	for _, filename := range lister.RequiredFilenames() {
+		found := ""
+		for _, location := range locations(filename) {
+			if hasPrefix(files, location) {
+				found = location
+				break
+			}
+		}
+
+		if found == "" {
+			log.WithFields(log.Fields{"lister": name, "database": filename}).Debug("package database not found")
+			continue
+		}
+		log.WithFields(log.Fields{"lister": name, "database": filename, "location": found}).Debug("package database found")
+		if found == filename {
+			continue
+		}
+
+		moved[filename] = found
+
+		// Copy the map before adding the files, as it is shared by the Listers.
+		if !copied {
+			located, copied = make(tarutil.FilesMap, len(files)), true
+			for k, v := range files {
+				located[k] = v
+			}
+		}
+		for k, v := range files {
+			if strings.HasPrefix(k, found) {
+				located[filename+strings.TrimPrefix(k, found)] = v
+			}
+		}
+	}
+
+	return located, moved
+}
+
+// relocate sets the Location of the features found in files moved by
+// locateFiles to where the files actually are in the layer.
+func relocate(features []database.FeatureVersion, moved map[string]string) {
+	for i := range features {
+		for filename, found := range moved {
+			if strings.HasPrefix(features[i].Location, filename) {
+				features[i].Location = found + strings.TrimPrefix(features[i].Location, filename)
+				break
+			}
+		}
+	}
+}
+
+// hasPrefix returns whether one of the files is at a path starting with prefix.
+func hasPrefix(files tarutil.FilesMap, prefix string) bool {
+	for filename := range files {
+		if strings.HasPrefix(filename, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
 func RegisterLister(name string, l Lister) {
 	if name == "" {
 		panic("featurefmt: could not register a Lister with an empty name")
@@ -58,4 +273,65 @@ func RegisterLister(name string, l Lister) {
 	}
 
 	listers[name] = l
-}
\ No newline at end of file
+}
+
+// ListListers returns the sorted names of the registered Listers.
+func ListListers() []string {
+	listersM.RLock()
+	defer listersM.RUnlock()
+
+	names := make([]string, 0, len(listers))
+	for name := range listers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// ListerEnabled returns whether a Lister is registered and not excluded by
+// SetEnabledListers.
+func ListerEnabled(name string) bool {
+	listersM.RLock()
+	defer listersM.RUnlock()
+
+	if _, exists := listers[name]; !exists {
+		return false
+	}
+	_, disabled := disabledListers[name]
+	return !disabled
+}
+
+// SetEnabledListers restricts ListFeatures to the Listers named in enabled, or
+// to every registered Lister if enabled is empty, minus those named in
+// disabled. It fails without changing anything if a name is not registered.
+func SetEnabledListers(enabled, disabled []string) error {
+	listersM.Lock()
+	defer listersM.Unlock()
+
+	for _, name := range append(append([]string{}, enabled...), disabled...) {
+		if _, exists := listers[name]; !exists {
+			return fmt.Errorf("featurefmt: unknown Lister %q", name)
+		}
+	}
+
+	isEnabled := make(map[string]bool, len(listers))
+	for name := range listers {
+		isEnabled[name] = len(enabled) == 0
+	}
+	for _, name := range enabled {
+		isEnabled[name] = true
+	}
+	for _, name := range disabled {
+		isEnabled[name] = false
+	}
+
+	disabledListers = make(map[string]struct{})
+	for name, ok := range isEnabled {
+		if !ok {
+			disabledListers[name] = struct{}{}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,143 @@
+package featurefmt
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/MXi4oyu/DockerXScan/tarutil"
+)
+
+// PathFilter restricts the files read by a Lister among those it requires,
+// with glob patterns in the syntax of path.Match, such as "node_modules/*/test"
+// or "*.json".
+//
+// A pattern matches a file when it matches the path of the file or of one of
+// its parent directories, starting at any directory of the layer: "test"
+// matches every file under a test directory, and "*.md5sums" every file of
+// that extension.
+type PathFilter struct {
+	// Include are the patterns of the files read, every required file when
+	// empty.
+	Include []string
+
+	// Exclude are the patterns of the files never read, even when included.
+	Exclude []string
+}
+
+// pathFilters are the PathFilters of the Listers, by name, none in default.
+var pathFilters = make(map[string]PathFilter)
+
+func init() {
+	tarutil.SetSkip(skipped)
+}
+
+// SetPathFilters sets the PathFilters of the registered Listers, by name,
+// replacing the previous ones. The files excluded by the filters of every
+// Lister requiring them are skipped when the layers are extracted, and are
+// thus never read.
+func SetPathFilters(filters map[string]PathFilter) error {
+	listersM.Lock()
+	defer listersM.Unlock()
+
+	for name, filter := range filters {
+		if _, exists := listers[name]; !exists {
+			return fmt.Errorf("featurefmt: unknown Lister %q", name)
+		}
+		for _, pattern := range append(append([]string{}, filter.Include...), filter.Exclude...) {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("featurefmt: invalid path pattern %q of Lister %q", pattern, name)
+			}
+		}
+	}
+
+	pathFilters = make(map[string]PathFilter, len(filters))
+	for name, filter := range filters {
+		pathFilters[name] = filter
+	}
+
+	return nil
+}
+
+// allows returns whether a file is read according to the filter.
+func (f PathFilter) allows(filename string) bool {
+	if len(f.Include) > 0 && !matchAny(f.Include, filename) {
+		return false
+	}
+	return !matchAny(f.Exclude, filename)
+}
+
+// matchAny returns whether one of the patterns matches a file or one of its
+// parent directories, starting at any directory.
+func matchAny(patterns []string, filename string) bool {
+	segments := strings.Split(strings.Trim(filename, "/"), "/")
+	for _, pattern := range patterns {
+		for i := range segments {
+			for j := i + 1; j <= len(segments); j++ {
+				if ok, _ := path.Match(pattern, strings.Join(segments[i:j], "/")); ok {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// filterFiles returns the files of a layer that the PathFilter of a Lister
+// allows it to read.
+func filterFiles(name string, files tarutil.FilesMap) tarutil.FilesMap {
+	filter, exists := pathFilters[name]
+	if !exists {
+		return files
+	}
+
+	filtered := make(tarutil.FilesMap, len(files))
+	for k, v := range files {
+		if filter.allows(k) {
+			filtered[k] = v
+		}
+	}
+	return filtered
+}
+
+// skipped returns whether a file of an archive that is to be extracted is
+// excluded by the PathFilters of every enabled Lister requiring it. The files
+// not required by any Lister, such as those detecting the namespaces, are
+// never skipped.
+func skipped(filename string) bool {
+	listersM.RLock()
+	defer listersM.RUnlock()
+
+	if len(pathFilters) == 0 {
+		return false
+	}
+
+	required := false
+	for name, lister := range listers {
+		if _, disabled := disabledListers[name]; disabled {
+			continue
+		}
+		if !requires(lister, filename) {
+			continue
+		}
+		if filter, exists := pathFilters[name]; !exists || filter.allows(filename) {
+			return false
+		}
+		required = true
+	}
+
+	return required
+}
+
+// requires returns whether a file of an archive is at one of the locations of
+// the files required by a Lister, possibly in a nested root.
+func requires(lister Lister, filename string) bool {
+	for _, required := range lister.RequiredFilenames() {
+		for _, location := range locations(required) {
+			if strings.HasPrefix(filename, location) || (nestedRoots && strings.Contains(filename, "/"+location)) {
+				return true
+			}
+		}
+	}
+	return false
+}
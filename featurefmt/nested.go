@@ -0,0 +1,127 @@
+package featurefmt
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/MXi4oyu/DockerXScan/database"
+	"github.com/MXi4oyu/DockerXScan/featurens"
+	"github.com/MXi4oyu/DockerXScan/tarutil"
+	log "github.com/sirupsen/logrus"
+)
+
+// maxNestedRoots is the number of nested roots whose packages are listed in a
+// layer, as a protection against layers made to hold many package databases.
+const maxNestedRoots = 16
+
+// nestedRoots controls whether the package databases are also looked for in
+// the subdirectories of the layers, disabled in default.
+var nestedRoots = false
+
+// SetNestedRoots sets whether the package databases are also discovered in the
+// subdirectories of the layers, such as the system built by debootstrap or
+// copied by a multi-stage build in opt/rootfs. The features found in such a
+// nested root are tagged with its path.
+//
+// The nested roots are at most tarutil.MaxNestedDepth directories deep, and
+// only their regular files are read, as a link could point outside of them.
+func SetNestedRoots(enabled bool) {
+	listersM.Lock()
+	defer listersM.Unlock()
+
+	nestedRoots = enabled
+}
+
+// listNestedRoots runs the enabled Listers over each nested root of the files,
+// and associates the features found with the namespace of the nested root.
+// Those of a nested root whose namespace can't be detected are skipped, as the
+// namespace of the layer is most likely another distribution.
+func listNestedRoots(files tarutil.FilesMap) []database.FeatureVersion {
+	var totalFeatures []database.FeatureVersion
+	for _, root := range findNestedRoots(files) {
+		rootFiles := subdirectoryFiles(files, root)
+
+		features := listRoot(rootFiles)
+		if len(features) == 0 {
+			continue
+		}
+
+		namespace, err := featurens.Detect(rootFiles)
+		if err != nil || namespace == nil {
+			log.WithFields(log.Fields{"root": root, "count": len(features)}).Warning("featurefmt: could not detect the namespace of a nested root, skipping its features")
+			continue
+		}
+
+		for i := range features {
+			features[i].Root = strings.TrimSuffix(root, "/")
+			if features[i].Location != "" {
+				features[i].Location = root + features[i].Location
+			}
+			if features[i].Feature.Namespace.Name == "" {
+				features[i].Feature.Namespace = *namespace
+			}
+		}
+		totalFeatures = append(totalFeatures, features...)
+	}
+
+	return totalFeatures
+}
+
+// findNestedRoots returns the sorted subdirectories, such as "opt/rootfs/", in
+// which a package database of an enabled Lister is found. The search roots are
+// not nested roots, their databases being found by locateFiles.
+func findNestedRoots(files tarutil.FilesMap) []string {
+	isSearchRoot := make(map[string]bool, len(searchRoots))
+	for _, root := range searchRoots {
+		isSearchRoot[root] = true
+	}
+
+	found := make(map[string]bool)
+	for name, lister := range listers {
+		if _, disabled := disabledListers[name]; disabled {
+			continue
+		}
+		for _, filename := range lister.RequiredFilenames() {
+			for _, location := range baseLocations(filename) {
+				for k := range files {
+					i := strings.Index(k, "/"+location)
+					if i < 0 || strings.HasPrefix(k, location) {
+						continue
+					}
+					if root := k[:i+1]; !isSearchRoot[root] && strings.Count(root, "/") <= tarutil.MaxNestedDepth {
+						found[root] = true
+					}
+				}
+			}
+		}
+	}
+
+	roots := make([]string, 0, len(found))
+	for root := range found {
+		roots = append(roots, root)
+	}
+	sort.Strings(roots)
+
+	if len(roots) > maxNestedRoots {
+		log.WithFields(log.Fields{"count": len(roots), "max": maxNestedRoots}).Warning("featurefmt: too many nested roots, skipping the deepest ones")
+		sort.SliceStable(roots, func(i, j int) bool {
+			return strings.Count(roots[i], "/") < strings.Count(roots[j], "/")
+		})
+		roots = roots[:maxNestedRoots]
+		sort.Strings(roots)
+	}
+
+	return roots
+}
+
+// subdirectoryFiles returns the files under a directory, at their path
+// relative to it.
+func subdirectoryFiles(files tarutil.FilesMap, dir string) tarutil.FilesMap {
+	subdirectory := make(tarutil.FilesMap)
+	for k, v := range files {
+		if strings.HasPrefix(k, dir) {
+			subdirectory[strings.TrimPrefix(k, dir)] = v
+		}
+	}
+	return subdirectory
+}
@@ -0,0 +1,72 @@
+// Package portage implements a featurefmt.Lister for the packages installed
+// by Portage, the package manager of Gentoo.
+package portage
+
+import (
+	"log"
+	"regexp"
+	"strings"
+
+	"github.com/MXi4oyu/DockerXScan/database"
+	"github.com/MXi4oyu/DockerXScan/featurefmt"
+	"github.com/MXi4oyu/DockerXScan/tarutil"
+	"github.com/MXi4oyu/DockerXScan/versionfmt"
+	"github.com/MXi4oyu/DockerXScan/versionfmt/portage"
+)
+
+// vdbPath is the directory holding a subdirectory per installed package,
+// named category/name-version.
+const vdbPath = "var/db/pkg/"
+
+// pfRegexp splits the directory name of an installed package into its name
+// and version.
+var pfRegexp = regexp.MustCompile(`^(.+?)-([0-9][^-]*(?:-r[0-9]+)?)$`)
+
+type lister struct{}
+
+func init() {
+	featurefmt.RegisterLister("portage", &lister{})
+}
+
+func (l lister) ListFeatures(files tarutil.FilesMap) ([]database.FeatureVersion, error) {
+	packagesMap := make(map[string]database.FeatureVersion)
+	for filename := range files {
+		if !strings.HasPrefix(filename, vdbPath) {
+			continue
+		}
+
+		// Only the files of a package's directory tell it is installed.
+		parts := strings.Split(strings.TrimPrefix(filename, vdbPath), "/")
+		if len(parts) < 3 {
+			continue
+		}
+		category, pf := parts[0], parts[1]
+
+		m := pfRegexp.FindStringSubmatch(pf)
+		if m == nil {
+			continue
+		}
+		if err := versionfmt.Valid(portage.ParserName, m[2]); err != nil {
+			log.Println("could not parse package version. skipping")
+			continue
+		}
+
+		pkg := database.FeatureVersion{
+			Feature:  database.Feature{Name: category + "/" + m[1], Kind: database.OSFeature},
+			Version:  m[2],
+			Location: vdbPath + category + "/" + pf,
+		}
+		packagesMap[pkg.Feature.Name+"#"+pkg.Version] = pkg
+	}
+
+	packages := make([]database.FeatureVersion, 0, len(packagesMap))
+	for _, pkg := range packagesMap {
+		packages = append(packages, pkg)
+	}
+
+	return packages, nil
+}
+
+func (l lister) RequiredFilenames() []string {
+	return []string{vdbPath}
+}
@@ -56,6 +56,7 @@ func (l lister) ListFeatures(files tarutil.FilesMap) (features []database.Featur
 	}
 
 	scanner := bufio.NewScanner(strings.NewReader(string(out)))
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), len(out)+1)
 
 	for scanner.Scan() {
 		line := strings.Split(scanner.Text(), " ")
@@ -81,8 +82,10 @@ func (l lister) ListFeatures(files tarutil.FilesMap) (features []database.Featur
 		pkg= database.FeatureVersion{
 			Feature: database.Feature{
 				Name:line[0],
+				Kind: database.OSFeature,
 			},
 			Version:version,
+			Location: "var/lib/rpm/Packages",
 		}
 
 		packagesMap[pkg.Feature.Name+"#"+pkg.Version] = pkg
@@ -1,6 +1,7 @@
 package featurens
 
 import (
+	"sort"
 	"sync"
 	"github.com/MXi4oyu/DockerXScan/database"
 	"github.com/MXi4oyu/DockerXScan/tarutil"
@@ -43,12 +44,24 @@ func RegisterDetector(name string, d Detector) {
 	detectors[name] = d
 }
 
+// Detect runs the registered Detectors over the files of a layer, in the
+// order of their names, and returns the namespace they found.
+//
+// When they disagree, such as on an image holding the release files of both
+// Alpine and Debian, the namespace matching the libc of the files is chosen.
 func Detect(files tarutil.FilesMap) (*database.Namespace, error) {
 	detectorsM.RLock()
 	defer detectorsM.RUnlock()
 
-	for name, detector := range detectors {
-		namespace, err := detector.Detect(files)
+	names := make([]string, 0, len(detectors))
+	for name := range detectors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var candidates []*database.Namespace
+	for _, name := range names {
+		namespace, err := detectors[name].Detect(files)
 		if err != nil {
 			log.Println("failed while attempting to detect namespace")
 			return nil, err
@@ -56,15 +69,34 @@ func Detect(files tarutil.FilesMap) (*database.Namespace, error) {
 
 		if namespace != nil {
 			log.Println("name:"+name)
-			return namespace, nil
+			candidates = append(candidates, namespace)
+		}
+	}
+
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+	for _, namespace := range candidates[1:] {
+		if namespace.Name == candidates[0].Name {
+			continue
+		}
+
+		if libc := DetectLibc(files); libc != "" {
+			for _, candidate := range candidates {
+				if matchesLibc(candidate.Name, libc) {
+					log.Printf("ambiguous namespace, chose %s with %s", candidate.Name, libc)
+					return candidate, nil
+				}
+			}
 		}
+		break
 	}
 
-	return nil, nil
+	return candidates[0], nil
 }
 
 // RequiredFilenames returns the total list of files required for all
-// registered Detectors.
+// registered Detectors, and for DetectLibc.
 func RequiredFilenames() (files []string) {
 	detectorsM.RLock()
 	defer detectorsM.RUnlock()
@@ -73,5 +105,21 @@ func RequiredFilenames() (files []string) {
 		files = append(files, detector.RequiredFilenames()...)
 	}
 
+	// The libc tells the namespace apart when the Detectors disagree.
+	files = append(files, LibcFilenames()...)
+
 	return
-}
\ No newline at end of file
+}
+// ListDetectors returns the sorted names of the registered Detectors.
+func ListDetectors() []string {
+	detectorsM.RLock()
+	defer detectorsM.RUnlock()
+
+	names := make([]string, 0, len(detectors))
+	for name := range detectors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
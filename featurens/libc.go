@@ -0,0 +1,76 @@
+package featurens
+
+import (
+	"strings"
+
+	"github.com/MXi4oyu/DockerXScan/tarutil"
+)
+
+// Libc is the flavor of the C library of an image, which tells the ABI of its
+// binaries and the advisories that apply to them.
+type Libc string
+
+const (
+	// Glibc is the GNU C library, used by Debian, Ubuntu or RHEL.
+	Glibc Libc = "glibc"
+
+	// Musl is the musl C library, used by Alpine.
+	Musl Libc = "musl"
+)
+
+// glibcConfig is the configuration of the dynamic linker of glibc, which
+// musl does not read, and thus tells glibc apart when both are installed.
+const glibcConfig = "etc/ld.so.conf"
+
+// libcFilenames are the prefixes of the dynamic linkers of each libc.
+var libcFilenames = map[Libc][]string{
+	Glibc: {"lib/ld-linux", "lib64/ld-linux", "usr/lib/ld-linux", "usr/lib64/ld-linux"},
+	Musl:  {"lib/ld-musl-", "lib/libc.musl-", "usr/lib/ld-musl-"},
+}
+
+// LibcFilenames returns the list of files required to be in the FilesMap
+// provided to DetectLibc.
+func LibcFilenames() []string {
+	files := []string{glibcConfig}
+	for _, prefixes := range libcFilenames {
+		files = append(files, prefixes...)
+	}
+	return files
+}
+
+// DetectLibc returns the libc of the files of an image, or an empty Libc if
+// none is found.
+//
+// An image may hold both, such as an Alpine image with the glibc
+// compatibility layer, or a Debian one with the musl package. The libc of the
+// system is then glibc if its linker is configured, and musl otherwise.
+func DetectLibc(files tarutil.FilesMap) Libc {
+	found := make(map[Libc]bool)
+	for filename := range files {
+		for libc, prefixes := range libcFilenames {
+			for _, prefix := range prefixes {
+				if strings.HasPrefix(filename, prefix) {
+					found[libc] = true
+				}
+			}
+		}
+	}
+
+	_, configured := files[glibcConfig]
+	switch {
+	case found[Musl] && !configured:
+		return Musl
+	case found[Glibc] || configured:
+		// The linker of glibc may be in the layers below, or in a directory
+		// of the target triplet such as usr/lib/x86_64-linux-gnu.
+		return Glibc
+	}
+	return ""
+}
+
+// matchesLibc returns whether a namespace is that of a distribution built on
+// a libc, Alpine being the only one built on musl.
+func matchesLibc(namespaceName string, libc Libc) bool {
+	isAlpine := strings.HasPrefix(namespaceName, "alpine:")
+	return isAlpine == (libc == Musl)
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/MXi4oyu/DockerXScan/tarutil"
 	"github.com/MXi4oyu/DockerXScan/versionfmt/rpm"
 	"github.com/MXi4oyu/DockerXScan/versionfmt/dpkg"
+	"github.com/MXi4oyu/DockerXScan/versionfmt/portage"
 	"github.com/MXi4oyu/DockerXScan/featurens"
 	"github.com/MXi4oyu/DockerXScan/database"
 	"regexp"
@@ -67,6 +68,12 @@ func (d detector) Detect(files tarutil.FilesMap) (*database.Namespace, error) {
 		versionFormat = dpkg.ParserName
 	case "centos", "rhel", "fedora", "amzn", "ol", "oracle":
 		versionFormat = rpm.ParserName
+	case "gentoo":
+		// Gentoo is a rolling release, its advisories apply to every version.
+		return &database.Namespace{
+			Name:          OS,
+			VersionFormat: portage.ParserName,
+		}, nil
 	default:
 		return nil, nil
 	}
@@ -0,0 +1,210 @@
+package imagefmt
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// ErrDigestMismatch is returned when a downloaded layer does not match
+	// the digest it was requested by.
+	ErrDigestMismatch = errors.New("imagefmt: layer does not match its digest")
+
+	// ErrMissingDigest is returned when a layer to download over HTTP has no
+	// digest to be verified against.
+	ErrMissingDigest = errors.New("imagefmt: layer has no digest to verify")
+
+	blobDigestRegexp = regexp.MustCompile(`sha256:([a-f0-9]{64})`)
+
+	// layerCache stores the downloaded layers on disk, disabled in default.
+	layerCache *blobCache
+)
+
+// blobCache is an on-disk cache of layers, keyed by their SHA-256 digest and
+// bounded in size by evicting the least recently used ones.
+type blobCache struct {
+	dir     string
+	maxSize int64
+
+	mu      sync.Mutex
+	size    int64
+	lru     *list.List
+	entries map[string]*list.Element
+}
+
+type blobCacheEntry struct {
+	digest string
+	size   int64
+}
+
+// SetLayerCache makes the layers downloaded by their digest (e.g. from a
+// registry's blob URL) be kept in dir, until they take more than maxSize
+// bytes. An empty dir disables the cache.
+//
+// The layers already in dir are kept, the most recently modified first.
+func SetLayerCache(dir string, maxSize int64) error {
+	if dir == "" {
+		layerCache = nil
+		return nil
+	}
+	if maxSize <= 0 {
+		return errors.New("imagefmt: the layer cache requires a positive maximum size")
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ModTime().Before(infos[j].ModTime()) })
+
+	c := &blobCache{
+		dir:     dir,
+		maxSize: maxSize,
+		lru:     list.New(),
+		entries: make(map[string]*list.Element),
+	}
+	for _, info := range infos {
+		if info.Mode().IsRegular() && blobDigestRegexp.MatchString("sha256:"+info.Name()) {
+			c.entries[info.Name()] = c.lru.PushFront(&blobCacheEntry{digest: info.Name(), size: info.Size()})
+			c.size += info.Size()
+		}
+	}
+	c.mu.Lock()
+	c.evict()
+	c.mu.Unlock()
+
+	layerCache = c
+	return nil
+}
+
+// blobDigest returns the hex SHA-256 digest contained in a layer's path, or
+// an empty string if it has none.
+func blobDigest(path string) string {
+	m := blobDigestRegexp.FindStringSubmatch(path)
+	if m == nil {
+		return ""
+	}
+	return m[1]
+}
+
+// open returns the cached layer with the given digest, after verifying that
+// its content still matches it.
+func (c *blobCache) open(digest string) (*os.File, bool) {
+	c.mu.Lock()
+	e, exists := c.entries[digest]
+	if exists {
+		c.lru.MoveToFront(e)
+	}
+	c.mu.Unlock()
+	if !exists {
+		return nil, false
+	}
+
+	f, err := os.Open(filepath.Join(c.dir, digest))
+	if err == nil {
+		h := sha256.New()
+		if _, err = io.Copy(h, f); err == nil && hex.EncodeToString(h.Sum(nil)) == digest {
+			if _, err = f.Seek(0, io.SeekStart); err == nil {
+				return f, true
+			}
+		}
+		f.Close()
+	}
+
+	log.WithField("digest", digest).Warning("removing corrupted layer from cache")
+	c.remove(digest)
+	return nil, false
+}
+
+// store writes a layer to the cache, verifying that it matches its digest,
+// and returns the cached file.
+//
+// A layer not matching its digest fails with ErrDigestMismatch when verify is
+// set. Otherwise it is returned without being cached, as it would be found by
+// a digest it doesn't have.
+func (c *blobCache) store(digest string, r io.Reader, verify bool) (*os.File, error) {
+	tmp, err := ioutil.TempFile(c.dir, ".download-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, h), r)
+	if err == nil {
+		err = tmp.Close()
+	}
+	if err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	if hex.EncodeToString(h.Sum(nil)) != digest {
+		if verify {
+			return nil, ErrDigestMismatch
+		}
+		// The file stays readable once removed.
+		log.WithField("digest", digest).Warning("layer does not match its digest, not caching it")
+		return os.Open(tmp.Name())
+	}
+
+	path := filepath.Join(c.dir, digest)
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return nil, err
+	}
+
+	// Open the file before adding it, so that it can be read even if it is
+	// evicted right away.
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, exists := c.entries[digest]; exists {
+		c.size -= e.Value.(*blobCacheEntry).size
+		c.lru.Remove(e)
+	}
+	c.entries[digest] = c.lru.PushFront(&blobCacheEntry{digest: digest, size: size})
+	c.size += size
+	c.evict()
+
+	return f, nil
+}
+
+func (c *blobCache) remove(digest string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, exists := c.entries[digest]; exists {
+		c.size -= e.Value.(*blobCacheEntry).size
+		c.lru.Remove(e)
+		delete(c.entries, digest)
+	}
+	os.Remove(filepath.Join(c.dir, digest))
+}
+
+// evict removes the least recently used layers until the cache fits in its
+// maximum size. The caller must hold c.mu.
+func (c *blobCache) evict() {
+	for c.size > c.maxSize && c.lru.Len() > 0 {
+		entry := c.lru.Remove(c.lru.Back()).(*blobCacheEntry)
+		delete(c.entries, entry.digest)
+		c.size -= entry.size
+		os.Remove(filepath.Join(c.dir, entry.digest))
+	}
+}
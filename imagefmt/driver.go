@@ -1,9 +1,13 @@
 package imagefmt
 
 import (
+	"crypto/sha256"
 	"crypto/tls"
+	"encoding/hex"
 	"fmt"
+	"hash"
 	"io"
+	"io/ioutil"
 	"math"
 	"net/http"
 	"os"
@@ -14,6 +18,7 @@ import (
 
 	"github.com/MXi4oyu/DockerXScan/tarutil"
 	"github.com/MXi4oyu/DockerXScan/common/commonerr"
+	"github.com/MXi4oyu/DockerXScan/registry"
 )
 
 var (
@@ -24,6 +29,10 @@ var (
 	// when pulling layers, verified in default.
 	insecureTLS = false
 
+	// verifyDigests controls whether the layers are verified against their
+	// digest, verified in default.
+	verifyDigests = true
+
 	extractorsM sync.RWMutex
 	extractors  = make(map[string]Extractor)
 )
@@ -83,9 +92,53 @@ func UnregisterExtractor(name string) {
 
 // Extract streams an image layer from disk or over HTTP, determines the
 // image format, then extracts the files specified.
-func Extract(format, path string, headers map[string]string, toExtract []string) (tarutil.FilesMap, error) {
+//
+// The layer is verified against its digest, "sha256:<hex>" as declared by the
+// manifest of its image, or else the digest its URL contains.
+// ErrDigestMismatch is returned if it does not match, and ErrMissingDigest if
+// a layer downloaded over HTTP has no digest, unless the verification has been
+// disabled with SetVerifyDigests. A layer that ends unexpectedly is then
+// deemed corrupted too; without verification, its files read until then are
+// returned along with tarutil.ErrTruncatedArchive.
+//
+// The layer is decompressed as declared by its media type, such as
+// "application/vnd.oci.image.layer.v1.tar+zstd", or as its magic numbers tell
+// when the media type is empty or wrong. tarutil.ErrUnknownFormat is returned
+// if it is neither compressed in a known format nor a tar archive. Of a
+// seekable layer on disk, in the eStargz or zstd:chunked format, only the
+// files to extract are decompressed.
+func Extract(format, mediaType, path, digest string, headers map[string]string, toExtract []string) (tarutil.FilesMap, error) {
 	var layerReader io.ReadCloser
-	if strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://") {
+
+	// file is the layer when it is on disk, as it is once cached.
+	var file *os.File
+
+	remote := strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://")
+	if digest != "" {
+		m := blobDigestRegexp.FindStringSubmatch(digest)
+		if m == nil || m[0] != digest {
+			return nil, commonerr.NewBadRequestError(fmt.Sprintf("unsupported layer digest '%s'", digest))
+		}
+		digest = m[1]
+	} else if remote {
+		digest = blobDigest(path)
+	}
+	if verifyDigests && remote && digest == "" {
+		log.WithField("path", path).Warning("layer has no digest to verify")
+		return nil, ErrMissingDigest
+	}
+
+	// Layers requested by their digest may be in the cache.
+	if remote && digest != "" && layerCache != nil {
+		if f, ok := layerCache.open(digest); ok {
+			layerReader, file = f, f
+		}
+	}
+	var verifier *digestReader
+
+	if layerReader != nil {
+		log.WithField("digest", digest).Debug("using cached layer")
+	} else if remote {
 		// Create a new HTTP request object.
 		request, err := http.NewRequest("GET", path, nil)
 		if err != nil {
@@ -99,12 +152,30 @@ func Extract(format, path string, headers map[string]string, toExtract []string)
 			}
 		}
 
+		// Authenticate to the registry when the caller did not.
+		if request.Header.Get("Authorization") == "" {
+			authorization, ok, err := registry.Authorization(request.URL.Host)
+			if err != nil {
+				log.WithError(err).WithField("host", request.URL.Host).Warning("could not authenticate to registry")
+				return nil, ErrCouldNotFindLayer
+			}
+			if ok {
+				request.Header.Set("Authorization", authorization)
+			}
+		}
+
 		// Send the request and handle the response.
+		tlsConfig := registry.ClientTLSConfig(request.URL.Host)
+		if tlsConfig == nil {
+			tlsConfig = &tls.Config{}
+		}
+		tlsConfig.InsecureSkipVerify = insecureTLS
+
 		tr := &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: insecureTLS},
+			TLSClientConfig: tlsConfig,
 		}
 		client := &http.Client{Transport: tr}
-		r, err := client.Do(request)
+		r, err := registry.GetWithMirrors(client, request)
 		if err != nil {
 			log.WithError(err).Warning("could not download layer")
 			return nil, ErrCouldNotFindLayer
@@ -117,28 +188,142 @@ func Extract(format, path string, headers map[string]string, toExtract []string)
 		}
 
 		layerReader = r.Body
+
+		if digest != "" && layerCache == nil {
+			// Verify the layer while it is extracted.
+			if verifyDigests {
+				verifier = newDigestReader(r.Body, digest)
+				layerReader = verifier
+			}
+		} else if digest != "" {
+			f, err := layerCache.store(digest, r.Body, verifyDigests)
+			r.Body.Close()
+			if err == ErrDigestMismatch {
+				log.WithField("digest", digest).Warning("downloaded layer does not match its digest")
+				return nil, ErrDigestMismatch
+			}
+			if err != nil {
+				log.WithError(err).WithField("digest", digest).Warning("could not download layer")
+				return nil, ErrCouldNotFindLayer
+			}
+			layerReader, file = f, f
+		}
 	} else {
 		var err error
-		layerReader, err = os.Open(path)
+		f, err := os.Open(path)
 		if err != nil {
 			return nil, ErrCouldNotFindLayer
 		}
+		layerReader, file = f, f
+		if verifyDigests && digest != "" {
+			verifier = newDigestReader(f, digest)
+			layerReader = verifier
+		}
 	}
 	defer layerReader.Close()
 
+	// A seekable layer on disk, in the eStargz or zstd:chunked format, is only
+	// decompressed where the files to extract are, which tarutil.ExtractFiles
+	// finds from its table of contents. It is thus verified beforehand.
+	seekable := false
+	if file != nil {
+		if info, err := file.Stat(); err == nil {
+			_, seekable = tarutil.SeekableFormat(file, info.Size())
+		}
+	}
+	if seekable {
+		if verifier != nil && !verifier.verify() {
+			log.WithField("digest", digest).Warning("layer does not match its digest")
+			return nil, ErrDigestMismatch
+		}
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return nil, ErrCouldNotFindLayer
+		}
+		layerReader, verifier = file, nil
+	}
+
 	if extractor, exists := Extractors()[strings.ToLower(format)]; exists {
-		files, err := extractor.ExtractFiles(layerReader, toExtract)
+		archive := layerReader
+		if mediaType != "" && !seekable {
+			r, err := tarutil.DecompressReader(mediaType, layerReader)
+			if err != nil {
+				log.WithFields(log.Fields{"path": path, "media type": mediaType}).Warning("could not decompress layer")
+				return nil, err
+			}
+			if rc, ok := r.(io.ReadCloser); ok {
+				archive = rc
+			} else {
+				archive = ioutil.NopCloser(r)
+			}
+		}
+
+		files, err := extractor.ExtractFiles(archive, toExtract)
+		if archive != layerReader {
+			// The decompressor is done with the layer before what remains of
+			// it is verified.
+			archive.Close()
+		}
+		if err == tarutil.ErrTruncatedArchive {
+			if verifier != nil {
+				// A truncated layer can't match its digest.
+				log.WithField("digest", digest).Warning("layer is truncated and does not match its digest")
+				return nil, ErrDigestMismatch
+			}
+			// The digest of a truncated layer can't be verified, the files read
+			// before its end are returned along with the error.
+			return files, err
+		}
 		if err != nil {
 			return nil, err
 		}
+		if verifier != nil && !verifier.verify() {
+			log.WithField("digest", digest).Warning("layer does not match its digest")
+			return nil, ErrDigestMismatch
+		}
 		return files, nil
 	}
 
 	return nil, commonerr.NewBadRequestError(fmt.Sprintf("unsupported image format '%s'", format))
 }
 
+// SetVerifyDigests sets whether the layers are verified against their digest,
+// which they are in default. Disabling it is only meant for debugging, as a
+// layer modified in transit would then be analyzed.
+func SetVerifyDigests(verify bool) {
+	verifyDigests = verify
+}
+
+// VerifiesDigests returns whether the layers are verified against their
+// digest.
+func VerifiesDigests() bool {
+	return verifyDigests
+}
+
 // SetInsecureTLS sets the insecureTLS to control whether TLS server's certificate chain
 // and hostname are verified when pulling layers.
 func SetInsecureTLS(insecure bool) {
 	insecureTLS = insecure
-}
\ No newline at end of file
+}
+
+// digestReader computes the SHA-256 digest of a layer as it is read.
+type digestReader struct {
+	io.Reader
+	io.Closer
+	hash   hash.Hash
+	digest string
+}
+
+func newDigestReader(rc io.ReadCloser, digest string) *digestReader {
+	h := sha256.New()
+	return &digestReader{io.TeeReader(rc, h), rc, h, digest}
+}
+
+// verify reads what remains of the layer, which the extraction may have left
+// (e.g. the padding after the end of the archive), and returns whether the
+// whole layer matches its digest.
+func (r *digestReader) verify() bool {
+	if _, err := io.Copy(ioutil.Discard, r.Reader); err != nil {
+		return false
+	}
+	return hex.EncodeToString(r.hash.Sum(nil)) == r.digest
+}
@@ -0,0 +1,162 @@
+package imagefmt
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/MXi4oyu/DockerXScan/tarutil"
+)
+
+// tarExtractor extracts the files of plain tar archives, as the Docker format
+// does.
+type tarExtractor struct{}
+
+func (tarExtractor) ExtractFiles(layer io.ReadCloser, filenames []string) (tarutil.FilesMap, error) {
+	return tarutil.ExtractFiles(layer, filenames)
+}
+
+func init() {
+	RegisterExtractor("tartest", tarExtractor{})
+}
+
+// writeLayer writes a tar archive of the files to a file of dir, cut after
+// size bytes when size is positive, and returns its path along with the
+// digest of the whole archive, as declared by a manifest.
+func writeLayer(t *testing.T, dir string, size int, files ...[2]string) (string, string) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, f := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: f[0], Mode: 0644, Size: int64(len(f[1])), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(f[1])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	sum := sha256.Sum256(buf.Bytes())
+	data := buf.Bytes()
+	if size > 0 {
+		data = data[:size]
+	}
+	path := filepath.Join(dir, "layer.tar")
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path, "sha256:" + hex.EncodeToString(sum[:])
+}
+
+func TestExtractTruncatedLayer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "imagefmt-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer SetVerifyDigests(true)
+
+	osRelease := "ID=debian\n"
+	status := strings.Repeat("Package: libc6\nVersion: 2.31-13\n\n", 200)
+	// The layer ends within the status file, after etc/os-release.
+	path, digest := writeLayer(t, dir, 3*512+len(status)/2, [2]string{"etc/os-release", osRelease}, [2]string{"var/lib/dpkg/status", status})
+	filenames := []string{"etc/os-release", "var/lib/dpkg/status"}
+
+	// A truncated layer can't match its digest.
+	SetVerifyDigests(true)
+	if files, err := Extract("tartest", "", path, digest, nil, filenames); err != ErrDigestMismatch || files != nil {
+		t.Errorf("Extract() of a truncated layer returned %d files and %v, want ErrDigestMismatch", len(files), err)
+	}
+
+	// Without verification, the files read before its end are returned.
+	SetVerifyDigests(false)
+	files, err := Extract("tartest", "", path, digest, nil, filenames)
+	if err != tarutil.ErrTruncatedArchive {
+		t.Errorf("Extract() of a truncated layer without verification returned %v, want tarutil.ErrTruncatedArchive", err)
+	}
+	if string(files["etc/os-release"]) != osRelease {
+		t.Errorf("Extract() read etc/os-release as %q, want %q", files["etc/os-release"], osRelease)
+	}
+	if _, ok := files["var/lib/dpkg/status"]; ok {
+		t.Error("Extract() returned the partially read var/lib/dpkg/status")
+	}
+}
+
+func TestExtractVerifiedLayer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "imagefmt-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path, digest := writeLayer(t, dir, 0, [2]string{"etc/os-release", "ID=debian\n"})
+
+	SetVerifyDigests(true)
+	files, err := Extract("tartest", "", path, digest, nil, []string{"etc/os-release"})
+	if err != nil || string(files["etc/os-release"]) != "ID=debian\n" {
+		t.Errorf("Extract() of a layer matching its digest returned %q and %v", files["etc/os-release"], err)
+	}
+
+	other := "sha256:" + strings.Repeat("0", 64)
+	if _, err := Extract("tartest", "", path, other, nil, []string{"etc/os-release"}); err != ErrDigestMismatch {
+		t.Errorf("Extract() of a layer not matching its digest returned %v, want ErrDigestMismatch", err)
+	}
+}
+
+func TestExtractCachedLayer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "imagefmt-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer SetVerifyDigests(true)
+
+	path, digest := writeLayer(t, dir, 0, [2]string{"etc/os-release", "ID=debian\n"})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, path)
+	}))
+	defer server.Close()
+
+	cacheDir := filepath.Join(dir, "cache")
+	if err := SetLayerCache(cacheDir, 1<<20); err != nil {
+		t.Fatal(err)
+	}
+	defer SetLayerCache("", 0)
+
+	// The downloaded layer doesn't match the digest it is requested by.
+	other := "sha256:" + strings.Repeat("0", 64)
+	SetVerifyDigests(true)
+	if _, err := Extract("tartest", "", server.URL+"/layer", other, nil, []string{"etc/os-release"}); err != ErrDigestMismatch {
+		t.Errorf("Extract() of a layer not matching its digest returned %v, want ErrDigestMismatch", err)
+	}
+
+	// Without verification it is extracted, but not cached under that digest.
+	SetVerifyDigests(false)
+	files, err := Extract("tartest", "", server.URL+"/layer", other, nil, []string{"etc/os-release"})
+	if err != nil || string(files["etc/os-release"]) != "ID=debian\n" {
+		t.Errorf("Extract() of a layer not matching its digest without verification returned %q and %v", files["etc/os-release"], err)
+	}
+	if _, err := os.Stat(filepath.Join(cacheDir, strings.TrimPrefix(other, "sha256:"))); !os.IsNotExist(err) {
+		t.Errorf("the layer not matching its digest has been cached (%v)", err)
+	}
+
+	// The layer matching its digest is cached.
+	SetVerifyDigests(true)
+	if _, err := Extract("tartest", "", server.URL+"/layer", digest, nil, []string{"etc/os-release"}); err != nil {
+		t.Errorf("Extract() of a layer matching its digest failed: %s", err)
+	}
+	if _, err := os.Stat(filepath.Join(cacheDir, strings.TrimPrefix(digest, "sha256:"))); err != nil {
+		t.Errorf("the layer matching its digest has not been cached: %s", err)
+	}
+}
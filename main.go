@@ -8,18 +8,27 @@ import(
 	_ "github.com/MXi4oyu/DockerXScan/featurefmt/apk"
 	_ "github.com/MXi4oyu/DockerXScan/featurefmt/rpm"
 	_ "github.com/MXi4oyu/DockerXScan/featurefmt/dpkg"
+	_ "github.com/MXi4oyu/DockerXScan/featurefmt/portage"
+	_ "github.com/MXi4oyu/DockerXScan/featurefmt/conda"
+	_ "github.com/MXi4oyu/DockerXScan/featurefmt/cargo"
 	_ "github.com/MXi4oyu/DockerXScan/featurens/alpinerelease"
 	_ "github.com/MXi4oyu/DockerXScan/featurens/aptsources"
 	_ "github.com/MXi4oyu/DockerXScan/featurens/lsbrelease"
 	_ "github.com/MXi4oyu/DockerXScan/featurens/osrelease"
 	_ "github.com/MXi4oyu/DockerXScan/featurens/redhatrelease"
+	_ "github.com/MXi4oyu/DockerXScan/result/nvdlink"
 	"fmt"
 	"os"
+	"sort"
 	"github.com/MXi4oyu/DockerXScan/database"
 	"os/signal"
 	"github.com/fatih/color"
 
 	"github.com/MXi4oyu/DockerXScan/analyzeimages"
+	"github.com/MXi4oyu/DockerXScan/featurefmt"
+	"github.com/MXi4oyu/DockerXScan/result"
+	"github.com/MXi4oyu/DockerXScan/sink"
+	"github.com/MXi4oyu/DockerXScan/tarutil"
 )
 
 
@@ -28,6 +37,33 @@ var (
 	flagMyAddress       = flag.String("my-address", "127.0.0.1", "Address from the point of view of DockerXScan")
 	flagMinimumSeverity = flag.String("minimum-severity", "Negligible", "Minimum severity of vulnerabilities to show (Unknown, Negligible, Low, Medium, High, Critical, Defcon1)")
 	flagColorMode       = flag.String("color", "auto", "Colorize the output (always, auto, never)")
+	flagOnlyFixed       = flag.Bool("only-fixed", false, "Only show vulnerabilities that have a fixed version")
+	flagMinConfidence   = flag.String("minimum-confidence", "Low", "Minimum confidence of vulnerabilities to show (Low, High); High leaves out those whose affected versions are only approximated")
+	flagUnknownSeverity = flag.String("unknown-severity", "Unknown", "Severity with which the vulnerabilities of unknown severity are compared to the minimum severity (e.g. Medium)")
+	flagKind            = flag.String("kind", "", "Only show the vulnerabilities of the features of a kind (os, application, binary)")
+	flagMergeDuplicates = flag.Bool("merge-duplicates", false, "Show the vulnerabilities found in several namespaces once, with the fix data of the distribution and the highest severity")
+	flagMinimumAge      = flag.Duration("minimum-age", 0, "Only show vulnerabilities published at least this long ago (e.g. 168h)")
+	flagProgress        = flag.Bool("progress", false, "Print the progress of the analysis on the standard error")
+	flagAllPlatforms    = flag.Bool("all-platforms", false, "Analyze the image of every platform of a manifest list")
+	flagRootfs          = flag.Bool("rootfs", false, "Analyze the filesystem of a running container, given its ID or the path to its rootfs")
+	flagVEX             = flag.Bool("vex", false, "Suppress the vulnerabilities that the VEX documents attached to the image declare not affected")
+	flagDetectOnly      = flag.Bool("detect-only", false, "Only print the namespace and the packages detected in each layer, without submitting the image")
+	flagPolicy          = flag.String("policy", "", "Decide whether the image passes, warns or fails with the rules of a YAML policy file instead of failing on any vulnerability shown")
+	flagSink            = flag.String("sink", "", "Also send every finding as a structured record to syslog (syslog+udp://host:514, syslog+tcp://host:514, syslog+unix:///dev/log) or fluentd (fluentd://host:24224?tag=dockerxscan.finding)")
+	flagMaxLayers       = flag.Int("max-layers", 0, "Refuse to analyze images made of more layers than this (0 for no limit)")
+	flagScanTimeout     = flag.Duration("scan-timeout", 0, "Stop analyzing the layers of the image after this long and print a partial report of those analyzed (e.g. 10m, 0 for no limit)")
+	flagFollowSymlinks  = flag.Bool("follow-symlinks", false, "Follow the symbolic links of the layers to find the package databases when detecting locally")
+	flagNestedRoots     = flag.Bool("nested-roots", false, "Also look for the package databases of the systems nested in the layers (e.g. opt/rootfs) when detecting locally")
+	flagOCI             = flag.Bool("oci", false, "Analyze an image of an OCI image layout, given as the path to the layout followed by the tag (:latest) or digest (@sha256:...) of the image when it holds several")
+	flagEphemeral       = flag.Bool("ephemeral", false, "Scan the image without persisting its layers in the database of DockerXScan")
+	flagKnown           = flag.Bool("known", false, "Report the image from the layers analyzed before, found by the digests of its manifest and configuration in its registry, without pulling it; analyze it in full if they are not all known")
+	flagSummary         = flag.Int("summary", 0, "Print a table of this many of the most affected packages after the report, ranked by severity and fixable vulnerabilities (0 to disable)")
+	flagSecrets         = flag.Bool("secrets", false, "Also scan the files of the layers for credentials, such as AWS keys and private keys")
+	flagTrustedBases    = flag.String("trusted-bases", "", "Tag the vulnerabilities of the features added by the layers of the approved base images of a YAML trusted bases file as inherited from them")
+	flagSkipInherited   = flag.Bool("exclude-inherited", false, "With -trusted-bases, neither show the vulnerabilities inherited from the approved base images nor decide them by the policy")
+	flagRedactions      = flag.String("redactions", "", "Redact the image references and the file paths of the reports and findings with the regular expressions of a YAML redactions file")
+	flagOutput          = flag.String("output", "", "Also write the report to this file, replacing it only once the report is complete and creating its directories as needed; not with -detect-only or -all-platforms")
+	flagFormat          = flag.String("format", "json", "Format of the report written to the output file (json, html)")
 )
 
 func initMain() int {
@@ -51,12 +87,110 @@ func initMain() int {
 		return 1
 	}
 
+	unknownSeverity, err := database.NewSeverity(*flagUnknownSeverity)
+	if err != nil {
+		flag.Usage()
+		return 1
+	}
+
+	minConfidence, err := database.NewConfidence(*flagMinConfidence)
+	if err != nil {
+		flag.Usage()
+		return 1
+	}
+
+	switch database.FeatureKind(*flagKind) {
+	case "", database.OSFeature, database.ApplicationFeature, database.BinaryFeature:
+	default:
+		flag.Usage()
+		return 1
+	}
+
+	// The file holds the report of a single image, which neither the
+	// detection of its features nor the reports of its platforms are.
+	if *flagOutput != "" && (*flagDetectOnly || *flagAllPlatforms) {
+		log.Print("-output can't be used with -detect-only or -all-platforms")
+		flag.Usage()
+		return 1
+	}
+	if err := analyzeimages.SetOutput(*flagOutput, *flagFormat); err != nil {
+		log.Print(err)
+		flag.Usage()
+		return 1
+	}
+
 	if *flagColorMode == "never" {
 		color.NoColor = true
 	} else if *flagColorMode == "always" {
 		color.NoColor = false
 	}
 
+	analyzeimages.SetOnlyFixed(*flagOnlyFixed)
+	analyzeimages.SetMinimumAge(*flagMinimumAge)
+	analyzeimages.SetMinimumConfidence(minConfidence)
+	analyzeimages.SetUseVEX(*flagVEX)
+	analyzeimages.SetMaxLayers(*flagMaxLayers)
+	analyzeimages.SetScanTimeout(*flagScanTimeout)
+	analyzeimages.SetUnknownSeverity(unknownSeverity)
+	analyzeimages.SetFeatureKind(database.FeatureKind(*flagKind))
+	analyzeimages.SetMergeDuplicates(*flagMergeDuplicates)
+	analyzeimages.SetScanSecrets(*flagSecrets)
+	analyzeimages.SetSummarySize(*flagSummary)
+	tarutil.SetFollowSymlinks(*flagFollowSymlinks)
+	featurefmt.SetNestedRoots(*flagNestedRoots)
+	var progress analyzeimages.ProgressFunc
+	if *flagProgress {
+		progress = printProgress
+	}
+	if *flagPolicy != "" {
+		data, err := ioutil.ReadFile(*flagPolicy)
+		if err != nil {
+			log.Printf("Could not read the policy: %s", err)
+			return 1
+		}
+		policy, err := result.ParsePolicy(data)
+		if err != nil {
+			log.Printf("Could not load the policy: %s", err)
+			return 1
+		}
+		analyzeimages.SetPolicy(&policy)
+	}
+	if *flagTrustedBases != "" {
+		data, err := ioutil.ReadFile(*flagTrustedBases)
+		if err != nil {
+			log.Printf("Could not read the trusted base images: %s", err)
+			return 1
+		}
+		bases, err := result.ParseTrustedBases(data)
+		if err != nil {
+			log.Printf("Could not load the trusted base images: %s", err)
+			return 1
+		}
+		analyzeimages.SetTrustedBases(bases, *flagSkipInherited)
+	}
+	if *flagRedactions != "" {
+		data, err := ioutil.ReadFile(*flagRedactions)
+		if err != nil {
+			log.Printf("Could not read the redactions: %s", err)
+			return 1
+		}
+		redactions, err := result.ParseRedactions(data)
+		if err != nil {
+			log.Printf("Could not load the redactions: %s", err)
+			return 1
+		}
+		analyzeimages.SetRedactions(redactions)
+	}
+	if *flagSink != "" {
+		s, err := sink.Open(*flagSink)
+		if err != nil {
+			log.Printf("Could not open the sink: %s", err)
+			return 1
+		}
+		defer s.Close()
+		analyzeimages.SetSink(s)
+	}
+
 	// Create a temporary folder.
 	tmpPath, err := ioutil.TempDir("", "analyze-local-image-")
 	if err != nil {
@@ -71,7 +205,35 @@ func initMain() int {
 	// Analyze the image.
 	analyzeCh := make(chan error, 1)
 	go func() {
-		analyzeCh <- analyzeimages.AnalyzeLocalImage(imageName, minSeverity, *flagEndpoint, *flagMyAddress, tmpPath)
+		if *flagDetectOnly {
+			analyzeCh <- detectOnly(imageName, tmpPath, progress)
+			return
+		}
+		if *flagAllPlatforms {
+			analyzeCh <- analyzePlatforms(imageName, minSeverity, tmpPath, progress)
+			return
+		}
+		if *flagRootfs {
+			analyzeCh <- analyzeimages.AnalyzeRootfs(imageName, minSeverity, *flagEndpoint, *flagMyAddress, tmpPath, progress)
+			return
+		}
+		if *flagOCI {
+			analyzeCh <- analyzeimages.AnalyzeOCILayout(imageName, minSeverity, *flagEndpoint, *flagMyAddress, progress)
+			return
+		}
+		if *flagEphemeral {
+			analyzeCh <- analyzeimages.AnalyzeEphemeral(imageName, minSeverity, *flagEndpoint, tmpPath, progress)
+			return
+		}
+		if *flagKnown {
+			err := analyzeimages.AnalyzeKnownImage(imageName, minSeverity, *flagEndpoint, progress)
+			if err == nil {
+				analyzeCh <- nil
+				return
+			}
+			log.Printf("Could not report the image from its known layers, analyzing it: %s", err)
+		}
+		analyzeCh <- analyzeimages.AnalyzeLocalImage(imageName, minSeverity, *flagEndpoint, *flagMyAddress, tmpPath, progress)
 	}()
 
 	select {
@@ -86,6 +248,79 @@ func initMain() int {
 	return 0
 }
 
+// analyzePlatforms analyzes every platform of an image, printing the report
+// of each, and fails if any of them has vulnerabilities or fails the policy.
+func analyzePlatforms(imageName string, minSeverity database.Severity, tmpPath string, progress analyzeimages.ProgressFunc) error {
+	reports, err := analyzeimages.AnalyzeAllPlatforms(imageName, minSeverity, *flagEndpoint, *flagMyAddress, tmpPath, progress)
+	if err != nil {
+		return err
+	}
+
+	var platforms []string
+	for platform := range reports {
+		platforms = append(platforms, platform)
+	}
+	sort.Strings(platforms)
+
+	failed := 0
+	for _, platform := range platforms {
+		if err := reports[platform]; err != nil {
+			fmt.Printf("%s: %s\n", platform, err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d platforms have vulnerabilities or fail the policy", failed, len(platforms))
+	}
+	return nil
+}
+
+// detectOnly prints the namespace and the features detected in each layer of
+// an image.
+func detectOnly(imageName, tmpPath string, progress analyzeimages.ProgressFunc) error {
+	detections, err := analyzeimages.DetectLocalImage(imageName, tmpPath, progress)
+	if err != nil {
+		return err
+	}
+
+	if len(detections) == 0 {
+		fmt.Println("The image has no layers, as it is built FROM scratch")
+	}
+	for _, detection := range detections {
+		namespace := "unknown namespace"
+		if detection.Namespace != nil {
+			namespace = detection.Namespace.Name
+		}
+		fmt.Printf("%s (%s): %d features\n", detection.Layer, namespace, len(detection.Features))
+		if detection.CreatedBy != "" {
+			fmt.Printf("\tcreated by: %s\n", detection.CreatedBy)
+		}
+
+		for _, fv := range detection.Features {
+			if fv.Location != "" {
+				fmt.Printf("\t%s %s (%s) from /%s\n", fv.Feature.Name, fv.Version, fv.Feature.Namespace.Name, fv.Location)
+				continue
+			}
+			if fv.Root != "" {
+				fmt.Printf("\t%s %s (%s) in /%s\n", fv.Feature.Name, fv.Version, fv.Feature.Namespace.Name, fv.Root)
+				continue
+			}
+			fmt.Printf("\t%s %s (%s)\n", fv.Feature.Name, fv.Version, fv.Feature.Namespace.Name)
+		}
+	}
+
+	return nil
+}
+
+// printProgress prints a ScanEvent on the standard error.
+func printProgress(event analyzeimages.ScanEvent) {
+	if event.Index > 0 {
+		fmt.Fprintf(os.Stderr, "[%d/%d] %s: %s\n", event.Index, event.Total, event.Kind, event.Layer)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "%s: %s\n", event.Kind, event.Image)
+}
+
 func main()  {
 
 	os.Exit(initMain())
@@ -18,23 +18,33 @@ import (
 	"github.com/MXi4oyu/DockerXScan/common/stopper"
 	"github.com/MXi4oyu/DockerXScan/api"
 	"github.com/MXi4oyu/DockerXScan/updater"
+	"github.com/MXi4oyu/DockerXScan/maintenance"
 	"github.com/MXi4oyu/DockerXScan/notifier"
 	"github.com/MXi4oyu/DockerXScan/notification"
+	"github.com/MXi4oyu/DockerXScan/registry"
+	"github.com/MXi4oyu/DockerXScan/worker"
 	//注册拓展
 	_ "github.com/MXi4oyu/DockerXScan/featurefmt/dpkg"
 	_ "github.com/MXi4oyu/DockerXScan/featurefmt/apk"
 	_ "github.com/MXi4oyu/DockerXScan/featurefmt/rpm"
+	_ "github.com/MXi4oyu/DockerXScan/featurefmt/portage"
+	_ "github.com/MXi4oyu/DockerXScan/featurefmt/conda"
+	_ "github.com/MXi4oyu/DockerXScan/featurefmt/cargo"
 	_ "github.com/MXi4oyu/DockerXScan/featurens/alpinerelease"
 	_ "github.com/MXi4oyu/DockerXScan/featurens/aptsources"
 	_ "github.com/MXi4oyu/DockerXScan/featurens/lsbrelease"
 	_ "github.com/MXi4oyu/DockerXScan/featurens/osrelease"
 	_ "github.com/MXi4oyu/DockerXScan/featurens/redhatrelease"
 	_ "github.com/MXi4oyu/DockerXScan/notification/webhook"
+	_ "github.com/MXi4oyu/DockerXScan/vulnmdsrc/exploit"
 	_ "github.com/MXi4oyu/DockerXScan/vulnmdsrc/nvd"
 	_ "github.com/MXi4oyu/DockerXScan/vulnsrc/alpine"
+	_ "github.com/MXi4oyu/DockerXScan/vulnsrc/csaf"
 	_ "github.com/MXi4oyu/DockerXScan/vulnsrc/debian"
+	_ "github.com/MXi4oyu/DockerXScan/vulnsrc/gentoo"
 	_ "github.com/MXi4oyu/DockerXScan/vulnsrc/oracle"
 	_ "github.com/MXi4oyu/DockerXScan/vulnsrc/rhel"
+	_ "github.com/MXi4oyu/DockerXScan/vulnsrc/rustsec"
 	_ "github.com/MXi4oyu/DockerXScan/vulnsrc/ubuntu"
 	_ "github.com/MXi4oyu/DockerXScan/imagefmt/docker"
 	_ "github.com/MXi4oyu/DockerXScan/imagefmt/aci"
@@ -53,6 +63,10 @@ type Config struct {
 	Updater  *updater.UpdaterConfig
 	Notifier *notification.Config
 	API      *api.Config
+	Registry *registry.Config
+	Worker   *worker.Config
+
+	Maintenance *maintenance.Config
 }
 
 func DefaultConfig() Config  {
@@ -110,6 +124,19 @@ func Boot(config *Config)  {
 	}
 	defer db.Close()
 
+	// Register the registry credentials used to pull layers.
+	if err := registry.Configure(config.Registry); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := worker.Configure(config.Worker); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := updater.Configure(config.Updater); err != nil {
+		log.Fatal(err)
+	}
+
 	// Start notifier
 	st.Begin()
 	go notifier.RunNotifier(config.Notifier, db, st)
@@ -123,6 +150,10 @@ func Boot(config *Config)  {
 	//漏洞更新
 	st.Begin()
 	go updater.RunUpdater(config.Updater,db,st)
+
+	// Reclaim the space of the deleted rows.
+	st.Begin()
+	go maintenance.RunMaintenance(config.Maintenance, db, st)
 	waitForSignals(syscall.SIGINT, syscall.SIGTERM)
 	st.Stop()
 }
@@ -132,6 +163,22 @@ func main()  {
 	//解析命令行参数
 	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
 	flagConfigPath := flag.String("config", "/etc/clair/config.yaml", "Load configuration from the specified file.")
+	flagCheckConsistency := flag.Bool("check-consistency", false, "Report the inconsistencies of the database and exit.")
+	flagRepairConsistency := flag.Bool("repair-consistency", false, "With -check-consistency, also remove orphaned feature versions and dangling fixes.")
+	flagPruneVulnerabilities := flag.Bool("prune-vulnerabilities", false, "Report the vulnerabilities that affect no stored layer and exit.")
+	flagPruneNamespace := flag.String("prune-namespace", "", "With -prune-vulnerabilities, only consider the vulnerabilities of this namespace.")
+	flagForcePrune := flag.Bool("force-prune", false, "With -prune-vulnerabilities, also delete them, even though they may affect images analyzed later.")
+	flagMaintain := flag.Bool("maintain", false, "Vacuum and analyze the tables of the database, report their size before and after, and exit.")
+	flagMaintainFull := flag.Bool("maintain-full", false, "With -maintain, compact the tables with VACUUM FULL, which locks each of them while it is rewritten.")
+
+	// "validate" checks the configuration, e.g. "server validate -config
+	// config.yaml", rather than running the server.
+	args := os.Args[1:]
+	validate := len(args) > 0 && args[0] == "validate"
+	if validate {
+		args = args[1:]
+	}
+	flag.CommandLine.Parse(args)
 
 	//加载配置文件
 	config,err:= LoadConfig(*flagConfigPath)
@@ -139,6 +186,128 @@ func main()  {
 		fmt.Println(err.Error())
 	}
 
+	if validate {
+		os.Exit(validateConfig(config, err))
+	}
+
+	if *flagCheckConsistency {
+		os.Exit(checkConsistency(config, *flagRepairConsistency))
+	}
+
+	if *flagPruneVulnerabilities {
+		os.Exit(pruneVulnerabilities(config, *flagPruneNamespace, *flagForcePrune))
+	}
+
+	if *flagMaintain {
+		os.Exit(maintain(config, *flagMaintainFull))
+	}
+
 	Boot(config)
 
 }
+
+// checkConsistency prints the inconsistencies of the database, optionally
+// repairing those that can be, and returns the exit code of the command.
+func checkConsistency(config *Config, repair bool) int {
+	db, err := database.Open(config.Database)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	inconsistencies, err := db.CheckConsistency()
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+
+	for _, inconsistency := range inconsistencies {
+		fmt.Printf("%s: %s %v\n", inconsistency.Kind, inconsistency.Description, inconsistency.IDs)
+	}
+	fmt.Printf("%d inconsistencies found\n", len(inconsistencies))
+
+	if repair {
+		removed, err := db.RepairConsistency()
+		if err != nil {
+			log.Print(err)
+			return 1
+		}
+		fmt.Printf("%d rows removed\n", removed)
+		return 0
+	}
+
+	if len(inconsistencies) > 0 {
+		return 2
+	}
+	return 0
+}
+
+// pruneVulnerabilities prints the vulnerabilities that affect no stored layer,
+// deleting them if forced to, and returns the exit code of the command.
+func pruneVulnerabilities(config *Config, namespace string, force bool) int {
+	db, err := database.Open(config.Database)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	vulnerabilities, err := db.FindUnreferencedVulnerabilities(namespace)
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+
+	for _, vulnerability := range vulnerabilities {
+		fmt.Printf("%s %s (%s)\n", vulnerability.Namespace.Name, vulnerability.Name, vulnerability.Severity)
+	}
+	fmt.Printf("%d unreferenced vulnerabilities found\n", len(vulnerabilities))
+
+	if !force {
+		return 0
+	}
+
+	removed, err := db.PruneUnreferencedVulnerabilities(namespace)
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	fmt.Printf("%d vulnerabilities removed\n", removed)
+
+	return 0
+}
+
+// maintain purges the vulnerabilities deleted for longer than the configured
+// retention, vacuums the tables of the database and prints their size and
+// bloat before and after, and returns the exit code of the command.
+func maintain(config *Config, full bool) int {
+	db, err := database.Open(config.Database)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	var retention time.Duration
+	if config.Maintenance != nil {
+		retention = config.Maintenance.VulnerabilityRetention
+	}
+
+	report, err := maintenance.Maintain(db, full, retention)
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+
+	before := make(map[string]database.TableStats, len(report.Before))
+	for _, s := range report.Before {
+		before[s.Name] = s
+	}
+	fmt.Printf("%-40s %14s %14s %8s %8s\n", "TABLE", "SIZE BEFORE", "SIZE AFTER", "BLOAT", "AFTER")
+	for _, s := range report.After {
+		b := before[s.Name]
+		fmt.Printf("%-40s %14d %14d %7.1f%% %7.1f%%\n", s.Name, b.Size, s.Size, 100*b.Bloat(), 100*s.Bloat())
+	}
+	fmt.Printf("%d deleted vulnerabilities purged\n", report.Purged)
+	fmt.Printf("%d bytes reclaimed in %s\n", report.Reclaimed(), report.Duration)
+
+	return 0
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/MXi4oyu/DockerXScan/database"
+	"github.com/MXi4oyu/DockerXScan/maintenance"
+	"github.com/MXi4oyu/DockerXScan/updater"
+	"github.com/MXi4oyu/DockerXScan/worker"
+)
+
+// ValidateConfig returns the problems of a configuration that would only be
+// reported once the server starts, without connecting to anything: an unknown
+// database driver or missing options, unknown updaters and listers, a fallback
+// namespace of an unknown version format and a negative maintenance interval.
+func ValidateConfig(config *Config) []error {
+	var errs []error
+	errs = append(errs, database.ValidateConfig(config.Database)...)
+	errs = append(errs, updater.ValidateConfig(config.Updater)...)
+	errs = append(errs, worker.ValidateConfig(config.Worker)...)
+	errs = append(errs, maintenance.ValidateConfig(config.Maintenance)...)
+	return errs
+}
+
+// validateConfig prints the problems of the configuration, or the error of its
+// loading, and returns the exit code of the validate command.
+func validateConfig(config *Config, loadErr error) int {
+	if loadErr != nil || config == nil {
+		// LoadConfig has already printed the error.
+		return 1
+	}
+
+	errs := ValidateConfig(config)
+	for _, err := range errs {
+		fmt.Println(err)
+	}
+	if len(errs) > 0 {
+		fmt.Printf("%d problems found\n", len(errs))
+		return 2
+	}
+
+	fmt.Println("configuration is valid")
+	return 0
+}
@@ -0,0 +1,271 @@
+// Package maintenance reclaims the space of the rows deleted from the
+// datastore, such as by the updates of the vulnerabilities and the deletions
+// of layers, at regular intervals.
+package maintenance
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"time"
+
+	"github.com/pborman/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/MXi4oyu/DockerXScan/common/stopper"
+	"github.com/MXi4oyu/DockerXScan/database"
+)
+
+const (
+	maintenanceComponent           = "maintenance"
+	maintenanceLastFlagName        = "last"
+	maintenanceLockName            = "maintenance"
+	maintenanceLockDuration        = maintenanceLockRefreshDuration + time.Minute*2
+	maintenanceLockRefreshDuration = time.Minute * 8
+)
+
+var (
+	promMaintenanceErrorsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "clair_maintenance_errors_total",
+		Help: "Number of errors that the maintenance generated.",
+	})
+
+	promMaintenanceDurationSeconds = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "clair_maintenance_duration_seconds",
+		Help: "Time it takes to vacuum the tables of the database.",
+	})
+
+	promTableSizeBytes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "clair_maintenance_table_size_bytes",
+		Help: "Size of the tables of the database after the last maintenance.",
+	}, []string{"table"})
+
+	promTableBloatRatio = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "clair_maintenance_table_bloat_ratio",
+		Help: "Estimated fraction of dead rows in the tables of the database after the last maintenance.",
+	}, []string{"table"})
+)
+
+func init() {
+	prometheus.MustRegister(promMaintenanceErrorsTotal)
+	prometheus.MustRegister(promMaintenanceDurationSeconds)
+	prometheus.MustRegister(promTableSizeBytes)
+	prometheus.MustRegister(promTableBloatRatio)
+}
+
+// Config is the configuration of the maintenance service.
+type Config struct {
+	// Interval is the time between two maintenances, zero disabling them.
+	Interval time.Duration
+
+	// Full makes the maintenances compact the tables with VACUUM FULL, which
+	// returns their space to the system but blocks the analyses and the
+	// updates while each table is rewritten.
+	Full bool
+
+	// VulnerabilityRetention is how long the deleted vulnerabilities are kept
+	// for their history to be looked up before the maintenances purge them,
+	// zero keeping them forever.
+	VulnerabilityRetention time.Duration
+}
+
+// ValidateConfig returns the problems of the configuration of the maintenance
+// service.
+func ValidateConfig(config *Config) []error {
+	if config == nil {
+		return nil
+	}
+
+	var errs []error
+	if config.Interval < 0 {
+		errs = append(errs, fmt.Errorf("maintenance: invalid interval %s", config.Interval))
+	}
+	if config.VulnerabilityRetention < 0 {
+		errs = append(errs, fmt.Errorf("maintenance: invalid vulnerability retention %s", config.VulnerabilityRetention))
+	}
+	return errs
+}
+
+// Report is the result of a maintenance: the size of the tables before and
+// after it, and the number of deleted vulnerabilities it purged.
+type Report struct {
+	Before   []database.TableStats
+	After    []database.TableStats
+	Purged   int
+	Duration time.Duration
+}
+
+// Reclaimed returns the number of bytes freed by the maintenance, which is
+// usually zero unless it is full, as dead rows are only made reusable.
+func (r Report) Reclaimed() int64 {
+	var before, after int64
+	for _, s := range r.Before {
+		before += s.Size
+	}
+	for _, s := range r.After {
+		after += s.Size
+	}
+	return before - after
+}
+
+// Maintain purges the vulnerabilities deleted for longer than the retention,
+// if it isn't zero, then vacuums and analyzes the tables of the datastore, and
+// reports their size before and after.
+func Maintain(datastore database.Datastore, full bool, retention time.Duration) (Report, error) {
+	var report Report
+	start := time.Now()
+
+	before, err := datastore.TableStats()
+	if err != nil {
+		return report, err
+	}
+	report.Before = before
+
+	// The purged rows are dead rows the vacuum then reclaims.
+	if retention > 0 {
+		if report.Purged, err = datastore.PurgeDeletedVulnerabilities(time.Now().Add(-retention)); err != nil {
+			return report, err
+		}
+	}
+
+	if err := datastore.Vacuum(full); err != nil {
+		return report, err
+	}
+
+	after, err := datastore.TableStats()
+	if err != nil {
+		return report, err
+	}
+	report.After = after
+	report.Duration = time.Since(start)
+
+	return report, nil
+}
+
+// RunMaintenance begins a process that maintains the datastore at regular
+// intervals. Only one instance sharing the datastore maintains it at a time.
+func RunMaintenance(config *Config, datastore database.Datastore, st *stopper.Stopper) {
+	defer st.End()
+
+	if config == nil || config.Interval == 0 {
+		log.Info("maintenance service is disabled.")
+		return
+	}
+
+	whoAmI := uuid.New()
+	log.WithField("lock identifier", whoAmI).Info("maintenance service started")
+
+	for {
+		var stop bool
+
+		nextMaintenance := time.Now().UTC()
+		if lastMaintenance, err := getLastMaintenance(datastore); err != nil {
+			log.WithError(err).Error("an error occured while getting the last maintenance time")
+			nextMaintenance = nextMaintenance.Add(config.Interval)
+		} else if !lastMaintenance.IsZero() {
+			nextMaintenance = lastMaintenance.Add(config.Interval)
+		}
+
+		if nextMaintenance.Before(time.Now().UTC()) {
+			log.Debug("attempting to obtain maintenance lock")
+			hasLock, hasLockUntil := datastore.Lock(maintenanceLockName, whoAmI, maintenanceLockDuration, false)
+			if hasLock {
+				doneC := make(chan bool, 1)
+				go func() {
+					maintain(datastore, config.Full, config.VulnerabilityRetention)
+					doneC <- true
+				}()
+
+				for done := false; !done && !stop; {
+					select {
+					case <-doneC:
+						done = true
+					case <-time.After(maintenanceLockRefreshDuration):
+						datastore.Lock(maintenanceLockName, whoAmI, maintenanceLockDuration, true)
+					case <-st.Chan():
+						stop = true
+					}
+				}
+
+				datastore.Unlock(maintenanceLockName, whoAmI)
+
+				if stop {
+					break
+				}
+				continue
+			}
+
+			lockOwner, lockExpiration, err := datastore.FindLock(maintenanceLockName)
+			if err != nil {
+				log.Debug("maintenance lock is already taken")
+				nextMaintenance = hasLockUntil
+			} else {
+				log.WithFields(log.Fields{"lock owner": lockOwner, "lock expiration": lockExpiration}).Debug("maintenance lock is already taken")
+				nextMaintenance = lockExpiration
+			}
+		}
+
+		now := time.Now().UTC()
+		waitUntil := nextMaintenance.Add(time.Duration(rand.ExpFloat64()/0.5) * time.Second)
+		log.WithField("scheduled time", waitUntil).Debug("next maintenance attempt scheduled")
+		if !waitUntil.Before(now) {
+			if !st.Sleep(waitUntil.Sub(time.Now())) {
+				break
+			}
+		}
+	}
+
+	log.Info("maintenance service stopped")
+}
+
+// maintain runs a maintenance, logs its report and records its time.
+func maintain(datastore database.Datastore, full bool, retention time.Duration) {
+	log.WithFields(log.Fields{"full": full, "vulnerability retention": retention}).Info("maintaining the database")
+
+	report, err := Maintain(datastore, full, retention)
+	if err != nil {
+		promMaintenanceErrorsTotal.Inc()
+		log.WithError(err).Error("an error occured when maintaining the database")
+		return
+	}
+	promMaintenanceDurationSeconds.Set(report.Duration.Seconds())
+
+	before := make(map[string]database.TableStats, len(report.Before))
+	for _, s := range report.Before {
+		before[s.Name] = s
+	}
+	for _, s := range report.After {
+		log.WithFields(log.Fields{
+			"table":        s.Name,
+			"size before":  before[s.Name].Size,
+			"size after":   s.Size,
+			"bloat before": before[s.Name].Bloat(),
+			"bloat after":  s.Bloat(),
+		}).Info("maintained table")
+
+		promTableSizeBytes.WithLabelValues(s.Name).Set(float64(s.Size))
+		promTableBloatRatio.WithLabelValues(s.Name).Set(s.Bloat())
+	}
+
+	if err := datastore.SetKeyValueNS(maintenanceComponent, maintenanceLastFlagName, strconv.FormatInt(time.Now().UTC().Unix(), 10)); err != nil {
+		log.WithError(err).Error("could not record the time of the maintenance")
+	}
+
+	log.WithFields(log.Fields{"duration": report.Duration, "reclaimed bytes": report.Reclaimed(), "purged vulnerabilities": report.Purged}).Info("database maintenance finished")
+}
+
+// getLastMaintenance returns the time of the last maintenance, or the zero
+// time if there has been none.
+func getLastMaintenance(datastore database.Datastore) (time.Time, error) {
+	value, err := datastore.GetKeyValueNS(maintenanceComponent, maintenanceLastFlagName)
+	if err != nil || value == "" {
+		return time.Time{}, err
+	}
+
+	lastMaintenance, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(lastMaintenance, 0).UTC(), nil
+}
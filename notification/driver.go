@@ -16,7 +16,16 @@ var (
 type Config struct {
 	Attempts         int
 	RenotifyInterval time.Duration
-	Params           map[string]interface{} `yaml:",inline"`
+
+	// GracePeriod is how old a notification must be before it is sent, so
+	// that the notifications of a large update are spread out.
+	GracePeriod time.Duration
+
+	// MinimumSeverity, when set, makes only the notifications whose old or
+	// new vulnerability is at least this severe be sent, such as "High".
+	MinimumSeverity string
+
+	Params map[string]interface{} `yaml:",inline"`
 }
 
 // Sender represents anything that can transmit notifications.
@@ -2,8 +2,11 @@ package webhook
 
 import (
 	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -19,8 +22,13 @@ import (
 
 const timeout = 5 * time.Second
 
+// SignatureHeader is the header in which the signature of a notification is
+// sent, when a secret is configured.
+const SignatureHeader = "X-Signature"
+
 type sender struct {
 	endpoint string
+	secret   []byte
 	client   *http.Client
 }
 
@@ -32,6 +40,10 @@ type Config struct {
 	KeyFile    string
 	CAFile     string
 	Proxy      string
+
+	// Secret is shared with the receivers of the notifications, which may
+	// authenticate them by their signature.
+	Secret string
 }
 
 func init() {
@@ -64,6 +76,10 @@ func (s *sender) Configure(config *notification.Config) (bool, error) {
 		return false, fmt.Errorf("could not parse endpoint URL: %s\n", err)
 	}
 	s.endpoint = httpConfig.Endpoint
+	s.secret = nil
+	if httpConfig.Secret != "" {
+		s.secret = []byte(httpConfig.Secret)
+	}
 
 	// Setup HTTP client.
 	transport := &http.Transport{}
@@ -104,7 +120,16 @@ func (s *sender) Send(notification database.VulnerabilityNotification) error {
 	}
 
 	// Send notification via HTTP POST.
-	resp, err := s.client.Post(s.endpoint, "application/json", bytes.NewBuffer(jsonNotification))
+	req, err := http.NewRequest("POST", s.endpoint, bytes.NewBuffer(jsonNotification))
+	if err != nil {
+		return fmt.Errorf("could not create request: %s", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.secret != nil {
+		req.Header.Set(SignatureHeader, Sign(s.secret, jsonNotification))
+	}
+
+	resp, err := s.client.Do(req)
 	if err != nil || resp == nil || (resp.StatusCode != 200 && resp.StatusCode != 201) {
 		if resp != nil {
 			return fmt.Errorf("got status %d, expected 200/201", resp.StatusCode)
@@ -116,6 +141,25 @@ func (s *sender) Send(notification database.VulnerabilityNotification) error {
 	return nil
 }
 
+// Sign returns the signature of the body of a notification, as sent in the
+// SignatureHeader: "sha256=" followed by the hex-encoded HMAC-SHA256 of the
+// body, keyed with the shared secret.
+//
+// A receiver authenticates a notification by computing the signature of the
+// raw body it received, and comparing it in constant time:
+//
+//	mac := hmac.New(sha256.New, secret)
+//	mac.Write(body)
+//	expected := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+//	if !hmac.Equal([]byte(expected), []byte(r.Header.Get("X-Signature"))) {
+//		// Reject the notification.
+//	}
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
 // loadTLSClientConfig initializes a *tls.Config using the given Config.
 //
 // If no certificates are given, (nil, nil) is returned.
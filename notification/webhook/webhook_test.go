@@ -0,0 +1,67 @@
+package webhook
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/MXi4oyu/DockerXScan/database"
+	"github.com/MXi4oyu/DockerXScan/notification"
+)
+
+const (
+	testSecret = "webhook-secret"
+	testBody   = `{"Notification":{"Name":"test"}}`
+	// testSignature is the HMAC-SHA256 of testBody keyed by testSecret, as
+	// computed independently by the receivers.
+	testSignature = "sha256=e10f1be3ba517b7f4c33a05530e005970bfd196149b34e660ba8a3b6730a1dd6"
+)
+
+func TestSign(t *testing.T) {
+	if got := Sign([]byte(testSecret), []byte(testBody)); got != testSignature {
+		t.Errorf("Sign() = %q, want %q", got, testSignature)
+	}
+	if got := Sign([]byte("other-secret"), []byte(testBody)); got == testSignature {
+		t.Errorf("Sign() with another secret = %q, want another signature", got)
+	}
+}
+
+func TestSendSigned(t *testing.T) {
+	tests := []struct {
+		name      string
+		secret    string
+		signature string
+	}{
+		{"with a secret", testSecret, testSignature},
+		{"without a secret", "", ""},
+	}
+
+	for _, test := range tests {
+		var body []byte
+		var signature string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ = ioutil.ReadAll(r.Body)
+			signature = r.Header.Get(SignatureHeader)
+		}))
+
+		var s sender
+		ok, err := s.Configure(&notification.Config{Params: map[string]interface{}{
+			"http": map[string]interface{}{"endpoint": server.URL, "secret": test.secret},
+		}})
+		if !ok || err != nil {
+			t.Fatalf("%s: Configure() = %t, %v", test.name, ok, err)
+		}
+		if err := s.Send(database.VulnerabilityNotification{Name: "test"}); err != nil {
+			t.Errorf("%s: Send() failed: %s", test.name, err)
+		}
+		server.Close()
+
+		if string(body) != testBody {
+			t.Errorf("%s: Send() sent %s, want %s", test.name, body, testBody)
+		}
+		if signature != test.signature {
+			t.Errorf("%s: Send() signed the notification %q, want %q", test.name, signature, test.signature)
+		}
+	}
+}
@@ -64,12 +64,20 @@ func RunNotifier(config *notification.Config, datastore database.Datastore, stop
 		return
 	}
 
+	minSeverity := database.UnknownSeverity
+	if config.MinimumSeverity != "" {
+		var err error
+		if minSeverity, err = database.NewSeverity(config.MinimumSeverity); err != nil {
+			log.WithField("severity", config.MinimumSeverity).Error("could not parse the minimum severity of the notifications, sending them all")
+		}
+	}
+
 	whoAmI := uuid.New()
 	log.WithField("lock identifier", whoAmI).Info("notifier service started")
 
 	for running := true; running; {
 		// Find task.
-		notification := findTask(datastore, config.RenotifyInterval, whoAmI, stopper)
+		notification := findTask(datastore, config.RenotifyInterval, config.GracePeriod, minSeverity, whoAmI, stopper)
 		if notification == nil {
 			// Interrupted while finding a task, Clair is stopping.
 			break
@@ -106,10 +114,10 @@ func RunNotifier(config *notification.Config, datastore database.Datastore, stop
 	log.Info("notifier service stopped")
 }
 
-func findTask(datastore database.Datastore, renotifyInterval time.Duration, whoAmI string, stopper *stopper.Stopper) *database.VulnerabilityNotification {
+func findTask(datastore database.Datastore, renotifyInterval, gracePeriod time.Duration, minSeverity database.Severity, whoAmI string, stopper *stopper.Stopper) *database.VulnerabilityNotification {
 	for {
 		// Find a notification to send.
-		notification, err := datastore.GetAvailableNotification(renotifyInterval)
+		notification, err := datastore.GetAvailableNotificationWithSeverity(renotifyInterval, gracePeriod, minSeverity)
 		if err != nil {
 			// There is no notification or an error occurred.
 			if err != commonerr.ErrNotFound {
@@ -0,0 +1,216 @@
+package registry
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	awsMetadataURL      = "http://169.254.169.254/latest"
+	awsMetadataTokenTTL = "21600"
+	awsSigningAlgorithm = "AWS4-HMAC-SHA256"
+	awsTimeFormat       = "20060102T150405Z"
+	awsDateFormat       = "20060102"
+
+	// awsCredentialsRefreshWindow is how long before their expiration
+	// instance role credentials are renewed.
+	awsCredentialsRefreshWindow = 5 * time.Minute
+)
+
+// ErrNoAWSCredentials is returned when neither the environment nor the
+// instance metadata service provide AWS credentials.
+var ErrNoAWSCredentials = errors.New("registry: could not find AWS credentials")
+
+var awsClient = &http.Client{Timeout: 10 * time.Second}
+
+// awsCredentials are the credentials used to sign requests to AWS APIs.
+type awsCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	Expiration      time.Time
+}
+
+// awsCredentialsProvider resolves AWS credentials from the environment
+// first, then from the role of the instance it runs on.
+type awsCredentialsProvider struct {
+	mu    sync.Mutex
+	creds *awsCredentials
+}
+
+func (p *awsCredentialsProvider) get() (*awsCredentials, error) {
+	if id, secret := os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY"); id != "" && secret != "" {
+		return &awsCredentials{
+			AccessKeyID:     id,
+			SecretAccessKey: secret,
+			SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		}, nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.creds != nil && time.Now().Add(awsCredentialsRefreshWindow).Before(p.creds.Expiration) {
+		return p.creds, nil
+	}
+
+	creds, err := instanceRoleCredentials()
+	if err != nil {
+		return nil, err
+	}
+	p.creds = creds
+
+	return creds, nil
+}
+
+// instanceRoleCredentials fetches the credentials of the instance role from
+// the EC2 instance metadata service.
+func instanceRoleCredentials() (*awsCredentials, error) {
+	// Request a session token, as required by IMDSv2.
+	req, err := http.NewRequest("PUT", awsMetadataURL+"/api/token", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", awsMetadataTokenTTL)
+
+	token, err := awsMetadataGet(req)
+	if err != nil {
+		return nil, ErrNoAWSCredentials
+	}
+
+	roles, err := awsMetadata("/meta-data/iam/security-credentials/", token)
+	if err != nil {
+		return nil, ErrNoAWSCredentials
+	}
+
+	role := strings.TrimSpace(strings.SplitN(string(roles), "\n", 2)[0])
+	if role == "" {
+		return nil, ErrNoAWSCredentials
+	}
+
+	body, err := awsMetadata("/meta-data/iam/security-credentials/"+role, token)
+	if err != nil {
+		return nil, err
+	}
+
+	var creds struct {
+		AccessKeyID     string `json:"AccessKeyId"`
+		SecretAccessKey string
+		Token           string
+		Expiration      time.Time
+	}
+	if err := json.Unmarshal(body, &creds); err != nil {
+		return nil, fmt.Errorf("registry: could not parse instance role credentials: %s", err)
+	}
+
+	return &awsCredentials{
+		AccessKeyID:     creds.AccessKeyID,
+		SecretAccessKey: creds.SecretAccessKey,
+		SessionToken:    creds.Token,
+		Expiration:      creds.Expiration,
+	}, nil
+}
+
+func awsMetadata(path string, token []byte) ([]byte, error) {
+	req, err := http.NewRequest("GET", awsMetadataURL+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-aws-ec2-metadata-token", string(token))
+
+	return awsMetadataGet(req)
+}
+
+func awsMetadataGet(req *http.Request) ([]byte, error) {
+	resp, err := awsClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("registry: instance metadata service returned %d", resp.StatusCode)
+	}
+
+	return ioutil.ReadAll(resp.Body)
+}
+
+// signAWSRequest signs a request using AWS Signature Version 4.
+func signAWSRequest(req *http.Request, body []byte, creds *awsCredentials, region, service string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format(awsTimeFormat)
+	scope := strings.Join([]string{now.Format(awsDateFormat), region, service, "aws4_request"}, "/")
+
+	req.Header.Set("Host", req.URL.Host)
+	req.Header.Set("X-Amz-Date", amzDate)
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+
+	// Build the canonical headers from every header set on the request.
+	var names []string
+	for name := range req.Header {
+		names = append(names, strings.ToLower(name))
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders string
+	for _, name := range names {
+		canonicalHeaders += name + ":" + strings.TrimSpace(req.Header.Get(name)) + "\n"
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		req.URL.RawQuery,
+		canonicalHeaders,
+		signedHeaders,
+		hexSHA256(body),
+	}, "\n")
+
+	stringToSign := strings.Join([]string{
+		awsSigningAlgorithm,
+		amzDate,
+		scope,
+		hexSHA256([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+creds.SecretAccessKey), now.Format(awsDateFormat))
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		awsSigningAlgorithm, creds.AccessKeyID, scope, signedHeaders, signature,
+	))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func hexSHA256(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
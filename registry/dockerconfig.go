@@ -0,0 +1,266 @@
+package registry
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// credentialHelperPrefix is the prefix of the name of the credential
+	// helper binaries, such as docker-credential-pass.
+	credentialHelperPrefix = "docker-credential-"
+
+	// credentialHelperTTL is how long the credentials given by a credential
+	// helper are used before it is invoked again.
+	credentialHelperTTL = 5 * time.Minute
+
+	// credentialHelperTimeout is how long a credential helper may run, as
+	// some of them prompt for a passphrase when they can't unlock a keychain.
+	credentialHelperTimeout = 30 * time.Second
+)
+
+// dockerHubHosts are the hosts of Docker Hub, whose credentials are stored
+// by docker login under https://index.docker.io/v1/.
+var dockerHubHosts = []string{"index.docker.io", "registry-1.docker.io", "docker.io"}
+
+// dockerConfigFile is the part of the configuration of the Docker client
+// holding the credentials stored by docker login.
+type dockerConfigFile struct {
+	Auths map[string]struct {
+		Auth          string `json:"auth"`
+		Username      string `json:"username"`
+		Password      string `json:"password"`
+		IdentityToken string `json:"identitytoken"`
+	} `json:"auths"`
+	CredsStore  string            `json:"credsStore"`
+	CredHelpers map[string]string `json:"credHelpers"`
+}
+
+// helperAuthenticator is an Authenticator that obtains its credentials from
+// a Docker credential helper, such as docker-credential-pass.
+type helperAuthenticator struct {
+	helper    string
+	serverURL string
+
+	mu            sync.Mutex
+	authorization string
+	expiresAt     time.Time
+}
+
+// defaultDockerConfigPath returns the path of the configuration of the Docker
+// client, in $DOCKER_CONFIG or else in ~/.docker.
+func defaultDockerConfigPath() string {
+	if dir := os.Getenv("DOCKER_CONFIG"); dir != "" {
+		return filepath.Join(dir, "config.json")
+	}
+	if home := os.Getenv("HOME"); home != "" {
+		return filepath.Join(home, ".docker", "config.json")
+	}
+	return ""
+}
+
+// configureDockerConfig registers the credentials of a Docker configuration
+// for the hosts that have no other Authenticator. The configuration at the
+// default path is optional, one given explicitly is not.
+func configureDockerConfig(path string) error {
+	explicit := path != ""
+	if !explicit {
+		if path = defaultDockerConfigPath(); path == "" {
+			return nil
+		}
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) && !explicit {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("registry: could not read the Docker configuration: %s", err)
+	}
+
+	var cfg dockerConfigFile
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return fmt.Errorf("registry: could not parse the Docker configuration %s: %s", path, err)
+	}
+
+	// As the Docker client does, the credential helper of a host comes
+	// before the credential store, which comes before the credentials stored
+	// in the configuration itself.
+	found := make(map[string]Authenticator)
+	for server, entry := range cfg.Auths {
+		host := serverHost(server)
+		switch {
+		case entry.Auth != "":
+			decoded, err := base64.StdEncoding.DecodeString(entry.Auth)
+			if err != nil || !strings.Contains(string(decoded), ":") {
+				return fmt.Errorf("registry: invalid credentials for %s in the Docker configuration", server)
+			}
+			found[host] = basicAuthenticator{authorization: "Basic " + base64.StdEncoding.EncodeToString(decoded)}
+		case entry.Username != "":
+			credentials := base64.StdEncoding.EncodeToString([]byte(entry.Username + ":" + entry.Password))
+			found[host] = basicAuthenticator{authorization: "Basic " + credentials}
+		case entry.IdentityToken != "":
+			log.WithField("host", host).Warning("identity tokens of the Docker configuration are not supported. skipping")
+		}
+	}
+
+	if cfg.CredsStore != "" {
+		servers, err := listCredentials(cfg.CredsStore)
+		if err != nil {
+			log.WithError(err).WithField("helper", cfg.CredsStore).Warning("could not list the credentials of the Docker credential store")
+		}
+		// The hosts logged in with the store are also listed in auths.
+		for server := range cfg.Auths {
+			servers = append(servers, server)
+		}
+		for _, server := range servers {
+			found[serverHost(server)] = &helperAuthenticator{helper: cfg.CredsStore, serverURL: server}
+		}
+	}
+
+	for server, helper := range cfg.CredHelpers {
+		found[serverHost(server)] = &helperAuthenticator{helper: helper, serverURL: server}
+	}
+
+	for host, a := range found {
+		hosts := []string{host}
+		for _, hub := range dockerHubHosts {
+			if host == hub {
+				hosts = dockerHubHosts
+			}
+		}
+		for _, h := range hosts {
+			registerDefaultAuthenticator(h, a)
+		}
+	}
+
+	log.WithFields(log.Fields{"path": path, "hosts": len(found)}).Info("loaded the credentials of the Docker configuration")
+
+	return nil
+}
+
+// registerDefaultAuthenticator registers an Authenticator for a host unless
+// another one has already been registered for it.
+func registerDefaultAuthenticator(host string, a Authenticator) {
+	authenticatorsM.Lock()
+	defer authenticatorsM.Unlock()
+
+	host = strings.ToLower(host)
+	if _, exists := authenticators[host]; exists {
+		log.WithField("host", host).Debug("the registry is already configured, ignoring its Docker credentials")
+		return
+	}
+	authenticators[host] = a
+}
+
+// serverHost returns the host of a server of the Docker configuration, which
+// may be a URL such as https://index.docker.io/v1/.
+func serverHost(server string) string {
+	if i := strings.Index(server, "://"); i >= 0 {
+		server = server[i+len("://"):]
+	}
+	if i := strings.Index(server, "/"); i >= 0 {
+		server = server[:i]
+	}
+	return strings.ToLower(server)
+}
+
+// Authorization implements Authenticator.
+func (a *helperAuthenticator) Authorization() (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.authorization != "" && time.Now().Before(a.expiresAt) {
+		return a.authorization, nil
+	}
+
+	out, err := runCredentialHelper(a.helper, "get", a.serverURL)
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{"helper": a.helper, "server": a.serverURL}).Error("could not get the credentials of the Docker credential helper")
+		return "", err
+	}
+
+	var creds struct {
+		Username string
+		Secret   string
+	}
+	if err := json.Unmarshal(out, &creds); err != nil {
+		return "", fmt.Errorf("registry: could not parse the credentials of %s%s: %s", credentialHelperPrefix, a.helper, err)
+	}
+	if creds.Username == "<token>" {
+		return "", errors.New("registry: identity tokens of the Docker credential helpers are not supported")
+	}
+
+	a.authorization = "Basic " + base64.StdEncoding.EncodeToString([]byte(creds.Username+":"+creds.Secret))
+	a.expiresAt = time.Now().Add(credentialHelperTTL)
+
+	return a.authorization, nil
+}
+
+// listCredentials returns the servers for which a credential helper holds
+// credentials.
+func listCredentials(helper string) ([]string, error) {
+	out, err := runCredentialHelper(helper, "list", "")
+	if err != nil {
+		return nil, err
+	}
+
+	var list map[string]string
+	if err := json.Unmarshal(out, &list); err != nil {
+		return nil, fmt.Errorf("registry: could not parse the list of %s%s: %s", credentialHelperPrefix, helper, err)
+	}
+
+	servers := make([]string, 0, len(list))
+	for server := range list {
+		servers = append(servers, server)
+	}
+	return servers, nil
+}
+
+// runCredentialHelper runs an action of a credential helper, writing input to
+// its standard input, and returns its standard output.
+func runCredentialHelper(helper, action, input string) ([]byte, error) {
+	if helper == "" || strings.ContainsAny(helper, `/\`) {
+		return nil, fmt.Errorf("registry: invalid Docker credential helper %q", helper)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(credentialHelperPrefix+helper, action)
+	cmd.Stdin = strings.NewReader(input)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			// Helpers report their errors, such as credentials not being found,
+			// on the standard output.
+			message := strings.TrimSpace(stdout.String() + " " + stderr.String())
+			return nil, fmt.Errorf("registry: %s%s %s failed: %s", credentialHelperPrefix, helper, action, message)
+		}
+	case <-time.After(credentialHelperTimeout):
+		cmd.Process.Kill()
+		return nil, fmt.Errorf("registry: %s%s %s timed out", credentialHelperPrefix, helper, action)
+	}
+
+	return stdout.Bytes(), nil
+}
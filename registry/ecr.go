@@ -0,0 +1,172 @@
+package registry
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	ecrService = "ecr"
+	ecrTarget  = "AmazonEC2ContainerRegistry_V20150921.GetAuthorizationToken"
+
+	// ecrRefreshWindow is how long before their expiration authorization
+	// tokens are renewed. ECR tokens are valid for twelve hours.
+	ecrRefreshWindow = 30 * time.Minute
+)
+
+// ErrECRNoRegion is returned when an ECR configuration lacks a region.
+var ErrECRNoRegion = errors.New("registry: ECR configuration requires a region")
+
+// ECRConfig is the configuration for the ECR registries of one AWS region.
+//
+// Credentials are read from the AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and
+// AWS_SESSION_TOKEN environment variables, or from the instance role.
+type ECRConfig struct {
+	Region string
+
+	// RegistryIDs are the AWS account IDs of the registries to authenticate
+	// to. When empty, the default registry of the credentials is used.
+	RegistryIDs []string
+}
+
+// ecrAuthenticator is an Authenticator that obtains its credentials from the
+// ECR GetAuthorizationToken API, renewing them before they expire.
+type ecrAuthenticator struct {
+	region     string
+	registryID string
+	creds      *awsCredentialsProvider
+
+	mu        sync.Mutex
+	token     string
+	expiresAt time.Time
+}
+
+type ecrAuthorizationData struct {
+	AuthorizationToken string  `json:"authorizationToken"`
+	ExpiresAt          float64 `json:"expiresAt"`
+	ProxyEndpoint      string  `json:"proxyEndpoint"`
+}
+
+func configureECR(cfg ECRConfig) error {
+	if cfg.Region == "" {
+		return ErrECRNoRegion
+	}
+
+	creds := &awsCredentialsProvider{}
+
+	if len(cfg.RegistryIDs) == 0 {
+		// The host of the default registry is only known once a token has
+		// been issued for it.
+		a := &ecrAuthenticator{region: cfg.Region, creds: creds}
+		data, err := a.refresh()
+		if err != nil {
+			return err
+		}
+
+		u, err := url.Parse(data.ProxyEndpoint)
+		if err != nil {
+			return fmt.Errorf("registry: invalid ECR proxy endpoint %q: %s", data.ProxyEndpoint, err)
+		}
+		RegisterAuthenticator(u.Host, a)
+		return nil
+	}
+
+	for _, id := range cfg.RegistryIDs {
+		host := fmt.Sprintf("%s.dkr.ecr.%s.amazonaws.com", id, cfg.Region)
+		RegisterAuthenticator(host, &ecrAuthenticator{
+			region:     cfg.Region,
+			registryID: id,
+			creds:      creds,
+		})
+	}
+
+	return nil
+}
+
+// Authorization implements Authenticator.
+func (a *ecrAuthenticator) Authorization() (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.token == "" || time.Now().Add(ecrRefreshWindow).After(a.expiresAt) {
+		if _, err := a.refresh(); err != nil {
+			return "", err
+		}
+	}
+
+	// The token is already the base64 encoding of "AWS:<password>".
+	return "Basic " + a.token, nil
+}
+
+// refresh requests a new authorization token. The caller must hold a.mu or
+// be the sole owner of a.
+func (a *ecrAuthenticator) refresh() (*ecrAuthorizationData, error) {
+	creds, err := a.creds.get()
+	if err != nil {
+		return nil, err
+	}
+
+	payload := struct {
+		RegistryIDs []string `json:"registryIds,omitempty"`
+	}{}
+	if a.registryID != "" {
+		payload.RegistryIDs = []string{a.registryID}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint := fmt.Sprintf("https://api.ecr.%s.amazonaws.com/", a.region)
+	req, err := http.NewRequest("POST", endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", ecrTarget)
+	signAWSRequest(req, body, creds, a.region, ecrService, time.Now())
+
+	resp, err := awsClient.Do(req)
+	if err != nil {
+		log.WithError(err).WithField("region", a.region).Error("could not request ECR authorization token")
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		log.WithFields(log.Fields{"region": a.region, "status code": resp.StatusCode}).Error("could not request ECR authorization token")
+		return nil, fmt.Errorf("registry: ECR returned %d: %s", resp.StatusCode, respBody)
+	}
+
+	var tokenResp struct {
+		AuthorizationData []ecrAuthorizationData `json:"authorizationData"`
+	}
+	if err := json.Unmarshal(respBody, &tokenResp); err != nil {
+		return nil, fmt.Errorf("registry: could not parse ECR authorization token: %s", err)
+	}
+	if len(tokenResp.AuthorizationData) == 0 {
+		return nil, errors.New("registry: ECR returned no authorization data")
+	}
+
+	data := tokenResp.AuthorizationData[0]
+	a.token = data.AuthorizationToken
+	a.expiresAt = time.Unix(int64(data.ExpiresAt), 0)
+
+	log.WithFields(log.Fields{"region": a.region, "expires at": a.expiresAt}).Debug("refreshed ECR authorization token")
+
+	return &data, nil
+}
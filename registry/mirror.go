@@ -0,0 +1,159 @@
+package registry
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	mirrorsM sync.RWMutex
+	mirrors  = make(map[string][]string)
+)
+
+// MirrorConfig is the ordered list of the mirrors of a registry host, which
+// are tried in turn when the registry is unreachable or fails.
+type MirrorConfig struct {
+	Host    string
+	Mirrors []MirrorHost
+}
+
+// MirrorHost is a mirror of a registry, along with the credentials used to
+// authenticate to it, if any.
+type MirrorHost struct {
+	Host     string
+	Username string
+	Password string
+}
+
+// basicAuthenticator is an Authenticator that sends static credentials.
+type basicAuthenticator struct {
+	authorization string
+}
+
+// Authorization implements Authenticator.
+func (a basicAuthenticator) Authorization() (string, error) {
+	return a.authorization, nil
+}
+
+func configureMirror(cfg MirrorConfig) error {
+	if cfg.Host == "" {
+		return errors.New("registry: mirror configuration requires a host")
+	}
+
+	var hosts []string
+	for _, m := range cfg.Mirrors {
+		if m.Host == "" {
+			return fmt.Errorf("registry: mirror of %s requires a host", cfg.Host)
+		}
+		if m.Username != "" {
+			credentials := base64.StdEncoding.EncodeToString([]byte(m.Username + ":" + m.Password))
+			RegisterAuthenticator(m.Host, basicAuthenticator{authorization: "Basic " + credentials})
+		}
+		hosts = append(hosts, strings.ToLower(m.Host))
+	}
+
+	mirrorsM.Lock()
+	defer mirrorsM.Unlock()
+
+	host := strings.ToLower(cfg.Host)
+	if _, dup := mirrors[host]; dup {
+		return fmt.Errorf("registry: mirrors of %s specified twice", cfg.Host)
+	}
+	mirrors[host] = hosts
+
+	log.WithFields(log.Fields{"host": cfg.Host, "mirrors": hosts}).Info("configured registry mirrors")
+
+	return nil
+}
+
+// Mirrors returns the mirrors of the specified registry host, in the order in
+// which they are tried.
+func Mirrors(host string) []string {
+	mirrorsM.RLock()
+	defer mirrorsM.RUnlock()
+
+	return append([]string(nil), mirrors[strings.ToLower(host)]...)
+}
+
+// GetWithMirrors sends a GET request like Get and, when the registry can't be
+// reached or responds with a 5xx status, sends it to each of the mirrors of
+// its host in turn until one of them responds.
+//
+// The request sent to a mirror is authenticated with the Authenticator
+// registered for the mirror, if any, rather than with the Authorization
+// header of the original request.
+func GetWithMirrors(client *http.Client, req *http.Request) (*http.Response, error) {
+	resp, err := Get(client, req)
+	if !unavailable(resp, err) {
+		return resp, err
+	}
+
+	for _, mirror := range Mirrors(req.URL.Host) {
+		if req.Context().Err() != nil {
+			break
+		}
+		if err != nil {
+			log.WithError(err).WithFields(log.Fields{"host": req.URL.Host, "mirror": mirror}).Warning("registry unavailable, falling back to mirror")
+		} else {
+			log.WithFields(log.Fields{"host": req.URL.Host, "mirror": mirror, "status code": resp.StatusCode}).Warning("registry unavailable, falling back to mirror")
+			resp.Body.Close()
+		}
+
+		mirrorReq := req.WithContext(req.Context())
+		u := *req.URL
+		u.Host = mirror
+		mirrorReq.URL = &u
+		mirrorReq.Host = ""
+		mirrorReq.Header = make(http.Header, len(req.Header))
+		for k, v := range req.Header {
+			mirrorReq.Header[k] = v
+		}
+		mirrorReq.Header.Del("Authorization")
+
+		authorization, ok, aerr := Authorization(mirror)
+		if aerr != nil {
+			log.WithError(aerr).WithField("mirror", mirror).Warning("could not authenticate to registry mirror")
+			resp, err = nil, aerr
+			continue
+		}
+		if ok {
+			mirrorReq.Header.Set("Authorization", authorization)
+		}
+
+		resp, err = Get(mirrorClient(client, mirror), mirrorReq)
+		if !unavailable(resp, err) {
+			return resp, err
+		}
+	}
+
+	return resp, err
+}
+
+// mirrorClient returns a client like the provided one, using the TLS
+// configuration of a mirror.
+func mirrorClient(client *http.Client, mirror string) *http.Client {
+	tlsConfig := ClientTLSConfig(mirror)
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{}
+	}
+	if tr, ok := client.Transport.(*http.Transport); ok && tr.TLSClientConfig != nil {
+		tlsConfig.InsecureSkipVerify = tr.TLSClientConfig.InsecureSkipVerify
+	}
+
+	return &http.Client{
+		Timeout:   client.Timeout,
+		Transport: &http.Transport{TLSClientConfig: tlsConfig},
+	}
+}
+
+// unavailable returns whether a request failed in a way a mirror may not.
+func unavailable(resp *http.Response, err error) bool {
+	return err != nil || resp.StatusCode >= 500
+}
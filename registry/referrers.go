@@ -0,0 +1,360 @@
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// dockerHubHost is the host of the registry of the images whose name has
+	// no host.
+	dockerHubHost = "registry-1.docker.io"
+
+	mediaTypeOCIIndex    = "application/vnd.oci.image.index.v1+json"
+	mediaTypeOCIManifest = "application/vnd.oci.image.manifest.v1+json"
+
+	mediaTypeDockerManifestList = "application/vnd.docker.distribution.manifest.list.v2+json"
+	mediaTypeDockerManifest     = "application/vnd.docker.distribution.manifest.v2+json"
+
+	// maxManifestSize and maxBlobSize bound what is read from a registry.
+	maxManifestSize = 4 << 20
+	maxBlobSize     = 16 << 20
+)
+
+// Descriptor describes a manifest or a blob stored in a registry.
+type Descriptor struct {
+	MediaType    string            `json:"mediaType"`
+	ArtifactType string            `json:"artifactType,omitempty"`
+	Digest       string            `json:"digest"`
+	Size         int64             `json:"size"`
+	Annotations  map[string]string `json:"annotations,omitempty"`
+}
+
+// Manifest is an OCI image manifest, which is also the form of the artifacts
+// attached to an image, such as attestations.
+type Manifest struct {
+	MediaType    string       `json:"mediaType"`
+	ArtifactType string       `json:"artifactType,omitempty"`
+	Config       Descriptor   `json:"config"`
+	Layers       []Descriptor `json:"layers"`
+}
+
+// Client reads the manifests and the blobs of a repository. It authenticates
+// with the Authenticator registered for the host, or else with an anonymous
+// token if the registry asks for one. The mirrors of the host are used when
+// it is unavailable.
+type Client struct {
+	host       string
+	repository string
+	client     *http.Client
+
+	mu     sync.Mutex
+	tokens map[string]string
+}
+
+// SplitReference returns the registry host and the repository of an image
+// reference (e.g. "registry-1.docker.io" and "library/debian" for
+// "debian:9"), ignoring its tag or digest.
+func SplitReference(image string) (host, repository string) {
+	if i := strings.Index(image, "@"); i >= 0 {
+		image = image[:i]
+	}
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		image = image[:i]
+	}
+
+	parts := strings.SplitN(image, "/", 2)
+	if len(parts) == 2 && (strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		host, repository = parts[0], parts[1]
+	} else {
+		host, repository = dockerHubHost, image
+	}
+
+	if host == "docker.io" || host == "index.docker.io" {
+		host = dockerHubHost
+	}
+	if host == dockerHubHost && !strings.Contains(repository, "/") {
+		repository = "library/" + repository
+	}
+
+	return host, repository
+}
+
+// Reference returns the tag or the digest of an image reference, which is
+// "latest" if it has neither (e.g. "9" for "debian:9").
+func Reference(image string) string {
+	if i := strings.Index(image, "@"); i >= 0 {
+		return image[i+1:]
+	}
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		return image[i+1:]
+	}
+	return "latest"
+}
+
+// NewClient returns a Client of a repository of a registry host.
+func NewClient(host, repository string) *Client {
+	return &Client{
+		host:       host,
+		repository: repository,
+		client: &http.Client{
+			Timeout:   30 * time.Second,
+			Transport: &http.Transport{TLSClientConfig: ClientTLSConfig(host)},
+		},
+		tokens: make(map[string]string),
+	}
+}
+
+// Referrers returns the descriptors of the manifests that refer to the
+// manifest with the given digest and have the given artifact type, or any
+// type if artifactType is empty.
+//
+// Registries that don't implement the referrers API are queried with the
+// referrers tag schema.
+func (c *Client) Referrers(digest, artifactType string) ([]Descriptor, error) {
+	path := "/referrers/" + digest
+	if artifactType != "" {
+		path += "?artifactType=" + url.QueryEscape(artifactType)
+	}
+
+	body, status, err := c.get(path, mediaTypeOCIIndex, maxManifestSize)
+	if err != nil {
+		return nil, err
+	}
+	if status == http.StatusNotFound {
+		// Fall back to the tag schema, e.g. sha256-<hex>.
+		body, status, err = c.get("/manifests/"+strings.Replace(digest, ":", "-", 1), mediaTypeOCIIndex, maxManifestSize)
+		if err != nil {
+			return nil, err
+		}
+		if status == http.StatusNotFound {
+			return nil, nil
+		}
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("registry: %s returned %d for the referrers of %s", c.host, status, digest)
+	}
+
+	var index struct {
+		Manifests []Descriptor `json:"manifests"`
+	}
+	if err := json.Unmarshal(body, &index); err != nil {
+		return nil, fmt.Errorf("registry: could not parse the referrers of %s: %s", digest, err)
+	}
+
+	// The tag schema can't be filtered by the registry.
+	var referrers []Descriptor
+	for _, d := range index.Manifests {
+		if artifactType == "" || d.ArtifactType == artifactType {
+			referrers = append(referrers, d)
+		}
+	}
+
+	return referrers, nil
+}
+
+// Manifest returns the manifest with the given digest.
+func (c *Client) Manifest(digest string) (Manifest, error) {
+	var m Manifest
+
+	body, status, err := c.get("/manifests/"+digest, mediaTypeOCIManifest, maxManifestSize)
+	if err != nil {
+		return m, err
+	}
+	if status != http.StatusOK {
+		return m, fmt.Errorf("registry: %s returned %d for manifest %s", c.host, status, digest)
+	}
+
+	if err := json.Unmarshal(body, &m); err != nil {
+		return m, fmt.Errorf("registry: could not parse manifest %s: %s", digest, err)
+	}
+
+	return m, nil
+}
+
+// ImageManifest returns the manifest of the image with the given tag or
+// digest, in the OCI or the Docker form, which share their fields. It fails
+// for a manifest list, whose platform would have to be chosen.
+func (c *Client) ImageManifest(reference string) (Manifest, error) {
+	var m Manifest
+
+	accept := strings.Join([]string{mediaTypeOCIManifest, mediaTypeDockerManifest, mediaTypeOCIIndex, mediaTypeDockerManifestList}, ", ")
+	body, status, err := c.get("/manifests/"+reference, accept, maxManifestSize)
+	if err != nil {
+		return m, err
+	}
+	if status != http.StatusOK {
+		return m, fmt.Errorf("registry: %s returned %d for manifest %s", c.host, status, reference)
+	}
+
+	if err := json.Unmarshal(body, &m); err != nil {
+		return m, fmt.Errorf("registry: could not parse manifest %s: %s", reference, err)
+	}
+	if m.MediaType == mediaTypeOCIIndex || m.MediaType == mediaTypeDockerManifestList {
+		return m, fmt.Errorf("registry: manifest %s is a manifest list", reference)
+	}
+
+	return m, nil
+}
+
+// Blob returns the content of the blob with the given digest.
+func (c *Client) Blob(digest string) ([]byte, error) {
+	body, status, err := c.get("/blobs/"+digest, "", maxBlobSize)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("registry: %s returned %d for blob %s", c.host, status, digest)
+	}
+
+	return body, nil
+}
+
+// get requests a path relative to the repository, authenticating if asked
+// to, and returns the body and the status code of the response. When the
+// registry can't be reached or responds with a 5xx status, its mirrors are
+// tried in turn.
+func (c *Client) get(path, accept string, maxSize int64) ([]byte, int, error) {
+	body, status, err := c.getFrom(c.host, c.client, path, accept, maxSize)
+	for _, mirror := range Mirrors(c.host) {
+		if err == nil && status < 500 {
+			break
+		}
+		log.WithFields(log.Fields{"host": c.host, "mirror": mirror}).Warning("registry unavailable, falling back to mirror")
+		body, status, err = c.getFrom(mirror, mirrorClient(c.client, mirror), path, accept, maxSize)
+	}
+
+	return body, status, err
+}
+
+func (c *Client) getFrom(host string, client *http.Client, path, accept string, maxSize int64) ([]byte, int, error) {
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequest("GET", "https://"+host+"/v2/"+c.repository+path, nil)
+		if err != nil {
+			return nil, 0, err
+		}
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		if err := c.authorize(host, req); err != nil {
+			return nil, 0, err
+		}
+
+		resp, err := Get(client, req)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		if resp.StatusCode == http.StatusUnauthorized && attempt == 0 {
+			challenge := resp.Header.Get("WWW-Authenticate")
+			resp.Body.Close()
+			if err := c.fetchToken(host, client, challenge); err != nil {
+				return nil, 0, err
+			}
+			continue
+		}
+
+		body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxSize))
+		resp.Body.Close()
+		if err != nil {
+			return nil, 0, err
+		}
+
+		return body, resp.StatusCode, nil
+	}
+}
+
+func (c *Client) authorize(host string, req *http.Request) error {
+	c.mu.Lock()
+	token := c.tokens[host]
+	c.mu.Unlock()
+
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+		return nil
+	}
+
+	authorization, ok, err := Authorization(host)
+	if err != nil {
+		return err
+	}
+	if ok {
+		req.Header.Set("Authorization", authorization)
+	}
+
+	return nil
+}
+
+// fetchToken obtains a pull token for a host from the token service that a
+// Bearer challenge points to, authenticated with the Basic credentials of the
+// host if it has some, or else anonymous.
+func (c *Client) fetchToken(host string, client *http.Client, challenge string) error {
+	if !strings.HasPrefix(challenge, "Bearer ") {
+		return fmt.Errorf("registry: %s requires an unsupported authentication", host)
+	}
+
+	params := make(map[string]string)
+	for _, param := range strings.Split(strings.TrimPrefix(challenge, "Bearer "), ",") {
+		kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+		if len(kv) == 2 {
+			params[kv[0]] = strings.Trim(kv[1], `"`)
+		}
+	}
+	if params["realm"] == "" {
+		return fmt.Errorf("registry: %s sent a challenge without realm", host)
+	}
+
+	query := url.Values{}
+	if params["service"] != "" {
+		query.Set("service", params["service"])
+	}
+	query.Set("scope", "repository:"+c.repository+":pull")
+
+	req, err := http.NewRequest("GET", params["realm"]+"?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	authorization, ok, err := Authorization(host)
+	if err != nil {
+		return err
+	}
+	if ok && strings.HasPrefix(authorization, "Basic ") {
+		req.Header.Set("Authorization", authorization)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("registry: token service of %s returned %d", host, resp.StatusCode)
+	}
+
+	var tokenResp struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxManifestSize)).Decode(&tokenResp); err != nil {
+		return fmt.Errorf("registry: could not parse the token of %s: %s", host, err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.tokens[host] = tokenResp.Token
+	if c.tokens[host] == "" {
+		c.tokens[host] = tokenResp.AccessToken
+	}
+
+	return nil
+}
@@ -0,0 +1,132 @@
+// Package registry holds the credentials and TLS configurations used to pull
+// image layers from container registries.
+package registry
+
+import (
+	"strings"
+	"sync"
+)
+
+var (
+	authenticatorsM sync.RWMutex
+	authenticators  = make(map[string]Authenticator)
+)
+
+// Config is the configuration for registry authentication.
+type Config struct {
+	ECR     []ECRConfig
+	TLS     []TLSConfig
+	Mirrors []MirrorConfig
+
+	// DockerConfig is the path of the configuration of the Docker client
+	// whose credentials, stored by docker login, are used for the registries
+	// that are not otherwise configured. It defaults to config.json in
+	// $DOCKER_CONFIG or in ~/.docker, which may not exist.
+	// DisableDockerConfig leaves those credentials unused.
+	DockerConfig        string
+	DisableDockerConfig bool
+}
+
+// Authenticator represents an ability to produce the value of the
+// Authorization header expected by a particular registry.
+//
+// Implementations must be safe for concurrent use, as layers are pulled by
+// several requests at once.
+type Authenticator interface {
+	// Authorization returns the value of the Authorization header.
+	Authorization() (string, error)
+}
+
+// RegisterAuthenticator makes an Authenticator available for the provided
+// registry host.
+//
+// If called twice with the same host, the host is blank, or if the provided
+// Authenticator is nil, this function panics.
+func RegisterAuthenticator(host string, a Authenticator) {
+	authenticatorsM.Lock()
+	defer authenticatorsM.Unlock()
+
+	if host == "" {
+		panic("registry: could not register an Authenticator with an empty host")
+	}
+
+	if a == nil {
+		panic("registry: could not register a nil Authenticator")
+	}
+
+	// Enforce lowercase hosts, so that they can be reliably be found in a map.
+	host = strings.ToLower(host)
+
+	if _, dup := authenticators[host]; dup {
+		panic("registry: RegisterAuthenticator called twice for " + host)
+	}
+
+	authenticators[host] = a
+}
+
+// UnregisterAuthenticator removes the Authenticator of a particular host.
+func UnregisterAuthenticator(host string) {
+	authenticatorsM.Lock()
+	defer authenticatorsM.Unlock()
+	delete(authenticators, strings.ToLower(host))
+}
+
+// Authorization returns the value of the Authorization header to send to the
+// specified registry host. The boolean is false when no Authenticator is
+// registered for that host.
+func Authorization(host string) (string, bool, error) {
+	authenticatorsM.RLock()
+	a, exists := authenticators[strings.ToLower(host)]
+	authenticatorsM.RUnlock()
+
+	if !exists {
+		return "", false, nil
+	}
+
+	value, err := a.Authorization()
+	if err != nil {
+		return "", true, err
+	}
+
+	return value, true, nil
+}
+
+// Configure registers the Authenticators, the mirrors and loads the TLS
+// configurations described by the configuration, failing if any certificate
+// can't be loaded.
+//
+// A nil configuration only uses the credentials of the default configuration
+// of the Docker client.
+func Configure(cfg *Config) error {
+	if cfg == nil {
+		cfg = &Config{}
+	}
+
+	for _, tlsCfg := range cfg.TLS {
+		if err := configureTLS(tlsCfg); err != nil {
+			return err
+		}
+	}
+
+	for _, ecrCfg := range cfg.ECR {
+		if err := configureECR(ecrCfg); err != nil {
+			return err
+		}
+	}
+
+	for _, mirrorCfg := range cfg.Mirrors {
+		if err := configureMirror(mirrorCfg); err != nil {
+			return err
+		}
+	}
+
+	// The credentials stored by docker login come last, the hosts configured
+	// above keeping their Authenticator.
+	if !cfg.DisableDockerConfig {
+		if err := configureDockerConfig(cfg.DockerConfig); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,97 @@
+package registry
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// maxRetries is the number of times a GET to a registry is retried after
+	// a transient failure.
+	maxRetries = 3
+
+	// retryDelay is the delay before the first retry, doubled on each of the
+	// following ones. maxRetryDelay bounds the delays, including those asked
+	// by a Retry-After header.
+	retryDelay    = 500 * time.Millisecond
+	maxRetryDelay = 30 * time.Second
+)
+
+// Get sends a GET request with a client, retrying with an exponential backoff
+// when the connection fails or the registry responds with a transient error:
+// 429 or a 5xx status other than 501. The Retry-After header of the response
+// is honored. Any other response, such as 401, 403 or 404, is returned at
+// once.
+//
+// As a GET has no body, the request can be sent again as is.
+func Get(client *http.Client, req *http.Request) (*http.Response, error) {
+	delay := retryDelay
+	for attempt := 0; ; attempt++ {
+		resp, err := client.Do(req)
+		if attempt >= maxRetries || !retryable(resp, err) {
+			return resp, err
+		}
+
+		wait := delay
+		if resp != nil {
+			if after, ok := retryAfter(resp.Header.Get("Retry-After")); ok {
+				wait = after
+			}
+			resp.Body.Close()
+		}
+		if wait > maxRetryDelay {
+			wait = maxRetryDelay
+		}
+
+		fields := log.Fields{"host": req.URL.Host, "attempt": attempt + 1, "delay": wait}
+		if err != nil {
+			log.WithError(err).WithFields(fields).Warning("registry request failed, retrying")
+		} else {
+			log.WithField("status code", resp.StatusCode).WithFields(fields).Warning("registry request failed, retrying")
+		}
+
+		select {
+		case <-time.After(wait):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+		delay *= 2
+	}
+}
+
+// retryable returns whether a request may succeed if sent again.
+func retryable(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return true
+	case resp.StatusCode == http.StatusNotImplemented:
+		return false
+	default:
+		return resp.StatusCode >= 500
+	}
+}
+
+// retryAfter parses the value of a Retry-After header, which is either a
+// number of seconds or an HTTP date.
+func retryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if wait := time.Until(date); wait > 0 {
+			return wait, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
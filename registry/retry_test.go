@@ -0,0 +1,155 @@
+package registry
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fastRetries makes the retries of the test immediate, restoring the delays
+// once it is done.
+func fastRetries(t *testing.T) {
+	delay, max := retryDelay, maxRetryDelay
+	retryDelay = time.Millisecond
+	t.Cleanup(func() { retryDelay, maxRetryDelay = delay, max })
+}
+
+// failingServer responds with the statuses in turn, then with 200, counting
+// the requests it receives.
+func failingServer(header http.Header, statuses ...int) (*httptest.Server, *int32) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(atomic.AddInt32(&requests, 1))
+		if n > len(statuses) {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		for key, values := range header {
+			w.Header()[key] = values
+		}
+		w.WriteHeader(statuses[n-1])
+	}))
+	return server, &requests
+}
+
+func get(t *testing.T, url string) *http.Response {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := Get(http.DefaultClient, req)
+	if err != nil {
+		t.Fatalf("Get() failed: %s", err)
+	}
+	resp.Body.Close()
+	return resp
+}
+
+func TestGetRetries(t *testing.T) {
+	fastRetries(t)
+
+	tests := []struct {
+		name     string
+		statuses []int
+		status   int
+		requests int32
+	}{
+		{"transient failures", []int{http.StatusServiceUnavailable, http.StatusServiceUnavailable}, http.StatusOK, 3},
+		{"rate limited", []int{http.StatusTooManyRequests}, http.StatusOK, 2},
+		{"too many failures", []int{502, 502, 502, 502, 502}, 502, int32(maxRetries + 1)},
+		{"unauthorized", []int{http.StatusUnauthorized}, http.StatusUnauthorized, 1},
+		{"forbidden", []int{http.StatusForbidden}, http.StatusForbidden, 1},
+		{"not found", []int{http.StatusNotFound}, http.StatusNotFound, 1},
+		{"not implemented", []int{http.StatusNotImplemented}, http.StatusNotImplemented, 1},
+	}
+
+	for _, test := range tests {
+		server, requests := failingServer(nil, test.statuses...)
+		resp := get(t, server.URL)
+		server.Close()
+
+		if resp.StatusCode != test.status {
+			t.Errorf("%s: Get() returned %d, want %d", test.name, resp.StatusCode, test.status)
+		}
+		if *requests != test.requests {
+			t.Errorf("%s: Get() sent %d requests, want %d", test.name, *requests, test.requests)
+		}
+	}
+}
+
+func TestGetRetryAfter(t *testing.T) {
+	fastRetries(t)
+
+	server, requests := failingServer(http.Header{"Retry-After": {"1"}}, http.StatusServiceUnavailable)
+	defer server.Close()
+
+	start := time.Now()
+	if resp := get(t, server.URL); resp.StatusCode != http.StatusOK || *requests != 2 {
+		t.Errorf("Get() returned %d after %d requests, want 200 after 2", resp.StatusCode, *requests)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("Get() retried after %s, want the second of the Retry-After header", elapsed)
+	}
+
+	// The delays asked by the registry are bounded.
+	maxRetryDelay = 10 * time.Millisecond
+	server, requests = failingServer(http.Header{"Retry-After": {"3600"}}, http.StatusServiceUnavailable)
+	defer server.Close()
+
+	start = time.Now()
+	if resp := get(t, server.URL); resp.StatusCode != http.StatusOK || *requests != 2 {
+		t.Errorf("Get() returned %d after %d requests, want 200 after 2", resp.StatusCode, *requests)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Get() retried after %s, want at most maxRetryDelay", elapsed)
+	}
+}
+
+func TestGetCanceled(t *testing.T) {
+	server, requests := failingServer(nil, 503, 503, 503, 503)
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	req, err := http.NewRequest("GET", server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The retry delay of 500ms is interrupted by the cancellation.
+	if _, err := Get(http.DefaultClient, req.WithContext(ctx)); err != context.DeadlineExceeded {
+		t.Errorf("Get() returned %v, want context.DeadlineExceeded", err)
+	}
+	if *requests != 1 {
+		t.Errorf("Get() sent %d requests, want 1", *requests)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		value string
+		wait  time.Duration
+		ok    bool
+	}{
+		{"", 0, false},
+		{"120", 2 * time.Minute, true},
+		{"-1", 0, false},
+		{"soon", 0, false},
+		{"Wed, 21 Oct 2015 07:28:00 GMT", 0, true},
+	}
+
+	for _, test := range tests {
+		if wait, ok := retryAfter(test.value); wait != test.wait || ok != test.ok {
+			t.Errorf("retryAfter(%q) = %s, %t, want %s, %t", test.value, wait, ok, test.wait, test.ok)
+		}
+	}
+
+	// A date in the future is the time left until it.
+	date := time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+	if wait, ok := retryAfter(date); !ok || wait < 59*time.Minute || wait > time.Hour {
+		t.Errorf("retryAfter(%q) = %s, %t, want about an hour", date, wait, ok)
+	}
+}
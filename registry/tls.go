@@ -0,0 +1,99 @@
+package registry
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+)
+
+var (
+	tlsConfigsM sync.RWMutex
+	tlsConfigs  = make(map[string]*tls.Config)
+)
+
+// TLSConfig is the TLS configuration used to connect to a registry host
+// served with a certificate signed by a private CA, or requiring clients to
+// authenticate with a certificate.
+type TLSConfig struct {
+	Host string
+
+	// CAFile is the path to a PEM bundle of the CAs trusted in addition to
+	// the system ones.
+	CAFile string
+
+	// CertFile and KeyFile are the paths to the PEM encoded client
+	// certificate and its private key.
+	CertFile string
+	KeyFile  string
+}
+
+// ClientTLSConfig returns a copy of the TLS configuration to use when
+// connecting to the specified registry host, or nil if there is none.
+func ClientTLSConfig(host string) *tls.Config {
+	tlsConfigsM.RLock()
+	defer tlsConfigsM.RUnlock()
+
+	// Registries are configured by host, regardless of their port.
+	host = strings.ToLower(host)
+	cfg, exists := tlsConfigs[host]
+	if !exists {
+		if i := strings.LastIndex(host, ":"); i >= 0 {
+			cfg, exists = tlsConfigs[host[:i]]
+		}
+	}
+	if !exists {
+		return nil
+	}
+
+	return cfg.Clone()
+}
+
+func configureTLS(cfg TLSConfig) error {
+	if cfg.Host == "" {
+		return errors.New("registry: TLS configuration requires a host")
+	}
+	if (cfg.CertFile == "") != (cfg.KeyFile == "") {
+		return fmt.Errorf("registry: TLS configuration of %s requires both a certificate and a key", cfg.Host)
+	}
+
+	tlsConfig := &tls.Config{}
+
+	if cfg.CAFile != "" {
+		pem, err := ioutil.ReadFile(cfg.CAFile)
+		if err != nil {
+			return fmt.Errorf("registry: could not read CA bundle of %s: %s", cfg.Host, err)
+		}
+
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("registry: no certificate found in CA bundle of %s", cfg.Host)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return fmt.Errorf("registry: could not load client certificate of %s: %s", cfg.Host, err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	tlsConfigsM.Lock()
+	defer tlsConfigsM.Unlock()
+
+	host := strings.ToLower(cfg.Host)
+	if _, dup := tlsConfigs[host]; dup {
+		return fmt.Errorf("registry: TLS configuration of %s specified twice", cfg.Host)
+	}
+	tlsConfigs[host] = tlsConfig
+
+	return nil
+}
@@ -0,0 +1,73 @@
+package result
+
+import (
+	"time"
+
+	"github.com/MXi4oyu/DockerXScan/api/v1"
+)
+
+// AcceptedRisk is a vulnerability whose risk has been accepted by a
+// suppression, along with why and by whom it was, so that it is reported
+// apart from the vulnerabilities to fix.
+type AcceptedRisk struct {
+	Vulnerability
+
+	Justification string `json:"Justification"`
+	Author        string `json:"Author"`
+
+	// Expires is when the suppression stops applying, formatted as RFC 3339,
+	// or empty if it never does.
+	Expires string `json:"Expires,omitempty"`
+}
+
+// Suppressions are the suppressions that apply to the results, by namespace,
+// feature and vulnerability.
+type Suppressions map[suppressionKey]v1.Suppression
+
+type suppressionKey struct {
+	namespace, feature, vulnerability string
+}
+
+// NewSuppressions indexes the suppressions active at a given time, as listed
+// by the API.
+func NewSuppressions(suppressions []v1.Suppression, now time.Time) Suppressions {
+	active := make(Suppressions, len(suppressions))
+	for _, s := range suppressions {
+		if s.Expired {
+			continue
+		}
+		if expires, err := time.Parse(time.RFC3339, s.Expires); err == nil && !now.Before(expires) {
+			continue
+		}
+		active[suppressionKey{s.NamespaceName, s.FeatureName, s.VulnerabilityName}] = s
+	}
+	return active
+}
+
+// Find returns the suppression of a vulnerability affecting a feature of a
+// namespace, if there is one.
+func (s Suppressions) Find(namespace, feature, vulnerability string) (v1.Suppression, bool) {
+	suppression, ok := s[suppressionKey{namespace, feature, vulnerability}]
+	return suppression, ok
+}
+
+// AcceptRisks returns a copy of the result in which the vulnerabilities that
+// are suppressed are moved to the AcceptedRisks, along with their number.
+func (r ImageResult) AcceptRisks(suppressions Suppressions) (ImageResult, int) {
+	accepted := ImageResult{Image: r.Image, DetectedNamespace: r.DetectedNamespace, Libc: r.Libc, Misconfigurations: r.Misconfigurations, Secrets: r.Secrets, AcceptedRisks: r.AcceptedRisks, Partial: r.Partial, SkippedLayers: r.SkippedLayers}
+	for _, v := range r.Vulnerabilities {
+		s, ok := suppressions.Find(v.NamespaceName, v.FeatureName, v.Name)
+		if !ok {
+			accepted.Vulnerabilities = append(accepted.Vulnerabilities, v)
+			continue
+		}
+		accepted.AcceptedRisks = append(accepted.AcceptedRisks, AcceptedRisk{
+			Vulnerability: v,
+			Justification: s.Justification,
+			Author:        s.Author,
+			Expires:       s.Expires,
+		})
+	}
+
+	return accepted, len(accepted.AcceptedRisks) - len(r.AcceptedRisks)
+}
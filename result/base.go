@@ -0,0 +1,139 @@
+package result
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+
+	"gopkg.in/yaml.v2"
+)
+
+// layerDigestRegexp matches the digests identifying the trusted base images.
+var layerDigestRegexp = regexp.MustCompile(`^sha256:[a-f0-9]{64}$`)
+
+// TrustedBase is a base image approved by the platform team, whose
+// vulnerabilities are tracked separately from those of the images built on
+// it.
+type TrustedBase struct {
+	Name string `yaml:"name"`
+
+	// Digest is the chain ID of the top layer of the base image,
+	// "sha256:<hex>", which identifies it along with the layers below it. The
+	// chain ID of the first layer is its diff ID, as listed in RootFS.Layers
+	// by docker inspect, and those of the layers above are computed by
+	// ChainIDs.
+	Digest string `yaml:"digest"`
+}
+
+// TrustedBases are the trusted base images of an organization.
+type TrustedBases []TrustedBase
+
+// BaseLayers associates the layers of an image, by name, with the name of the
+// trusted base image they belong to.
+type BaseLayers map[string]string
+
+// ParseTrustedBases parses a YAML file of trusted base images, failing on
+// invalid digests. It looks like:
+//
+//	trusted_bases:
+//	- name: debian:bookworm-slim
+//	  digest: sha256:1f5e...
+func ParseTrustedBases(data []byte) (TrustedBases, error) {
+	var file struct {
+		TrustedBases TrustedBases `yaml:"trusted_bases"`
+	}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("result: could not parse trusted base images: %s", err)
+	}
+
+	for i, base := range file.TrustedBases {
+		if !layerDigestRegexp.MatchString(base.Digest) {
+			return nil, fmt.Errorf("result: trusted base image #%d has an invalid digest %q", i+1, base.Digest)
+		}
+		if base.Name == "" {
+			file.TrustedBases[i].Name = base.Digest
+		}
+	}
+
+	return file.TrustedBases, nil
+}
+
+// ChainIDs returns the chain IDs of the layers of an image from their diff
+// IDs, in order.
+func ChainIDs(diffIDs []string) []string {
+	chainIDs := make([]string, len(diffIDs))
+	for i, diffID := range diffIDs {
+		if i == 0 {
+			chainIDs[i] = diffID
+			continue
+		}
+		sum := sha256.Sum256([]byte(chainIDs[i-1] + " " + diffID))
+		chainIDs[i] = "sha256:" + hex.EncodeToString(sum[:])
+	}
+	return chainIDs
+}
+
+// BaseLayers returns the layers of an image that belong to the highest of the
+// trusted base images it is built on, if any. The layers are given by name,
+// along with their diff IDs, in order.
+func (bs TrustedBases) BaseLayers(layerIDs, diffIDs []string) BaseLayers {
+	if len(bs) == 0 || len(layerIDs) != len(diffIDs) {
+		return nil
+	}
+
+	names := make(map[string]string, len(bs))
+	for _, base := range bs {
+		names[base.Digest] = base.Name
+	}
+
+	chainIDs := ChainIDs(diffIDs)
+	for top := len(chainIDs) - 1; top >= 0; top-- {
+		name, trusted := names[chainIDs[top]]
+		if !trusted {
+			continue
+		}
+
+		layers := make(BaseLayers, top+1)
+		for _, layerID := range layerIDs[:top+1] {
+			layers[layerID] = name
+		}
+		return layers
+	}
+
+	return nil
+}
+
+// WithBaseLayers returns a copy of the result in which each vulnerability
+// whose feature was added by a layer of a trusted base image is tagged as
+// inherited from it.
+func (r ImageResult) WithBaseLayers(b BaseLayers) ImageResult {
+	if len(b) == 0 {
+		return r
+	}
+
+	tagged := r
+	tagged.Vulnerabilities = make([]Vulnerability, len(r.Vulnerabilities))
+	for i, v := range r.Vulnerabilities {
+		if base, ok := b[v.AddedBy]; ok {
+			v.InheritedFrom = base
+		}
+		tagged.Vulnerabilities[i] = v
+	}
+
+	return tagged
+}
+
+// NotInherited returns a copy of the result holding only the vulnerabilities
+// that are not inherited from a trusted base image, along with the number of
+// those left out.
+func (r ImageResult) NotInherited() (ImageResult, int) {
+	kept := ImageResult{Image: r.Image, DetectedNamespace: r.DetectedNamespace, Libc: r.Libc, Misconfigurations: r.Misconfigurations, Secrets: r.Secrets, AcceptedRisks: r.AcceptedRisks, Partial: r.Partial, SkippedLayers: r.SkippedLayers}
+	for _, v := range r.Vulnerabilities {
+		if v.InheritedFrom == "" {
+			kept.Vulnerabilities = append(kept.Vulnerabilities, v)
+		}
+	}
+
+	return kept, len(r.Vulnerabilities) - len(kept.Vulnerabilities)
+}
@@ -0,0 +1,93 @@
+package result
+
+import (
+	"sort"
+	"strings"
+)
+
+// Canonical returns a copy of the result in the canonical order, in which
+// the same findings are always listed the same way whatever order they were
+// found in: the vulnerabilities by namespace, feature name, feature version,
+// then name, and the other findings likewise by what identifies them. The
+// SkippedLayers are kept in the order of the image.
+func (r ImageResult) Canonical() ImageResult {
+	sorted := r
+
+	sorted.Vulnerabilities = make([]Vulnerability, len(r.Vulnerabilities))
+	for i, v := range r.Vulnerabilities {
+		sorted.Vulnerabilities[i] = v.canonical()
+	}
+	sort.SliceStable(sorted.Vulnerabilities, func(i, j int) bool {
+		return CompareVulnerabilities(sorted.Vulnerabilities[i], sorted.Vulnerabilities[j]) < 0
+	})
+
+	sorted.AcceptedRisks = make([]AcceptedRisk, len(r.AcceptedRisks))
+	for i, a := range r.AcceptedRisks {
+		a.Vulnerability = a.Vulnerability.canonical()
+		sorted.AcceptedRisks[i] = a
+	}
+	sort.SliceStable(sorted.AcceptedRisks, func(i, j int) bool {
+		return CompareVulnerabilities(sorted.AcceptedRisks[i].Vulnerability, sorted.AcceptedRisks[j].Vulnerability) < 0
+	})
+
+	sorted.Misconfigurations = append([]Misconfiguration(nil), r.Misconfigurations...)
+	sort.SliceStable(sorted.Misconfigurations, func(i, j int) bool {
+		return sorted.Misconfigurations[i].ID < sorted.Misconfigurations[j].ID
+	})
+
+	sorted.Secrets = append([]Secret(nil), r.Secrets...)
+	sort.SliceStable(sorted.Secrets, func(i, j int) bool {
+		si, sj := sorted.Secrets[i], sorted.Secrets[j]
+		if c := compareFields(si.Layer, sj.Layer, si.Path, sj.Path); c != 0 {
+			return c < 0
+		}
+		if si.Line != sj.Line {
+			return si.Line < sj.Line
+		}
+		return si.RuleID < sj.RuleID
+	})
+
+	return sorted
+}
+
+// CompareVulnerabilities compares two vulnerabilities in the canonical order,
+// returning -1, 0 or 1 as a is listed before, alongside or after b: by
+// namespace, feature name, feature version and name, then by where the
+// feature was found.
+func CompareVulnerabilities(a, b Vulnerability) int {
+	return compareFields(
+		a.NamespaceName, b.NamespaceName,
+		a.FeatureName, b.FeatureName,
+		a.FeatureVersion, b.FeatureVersion,
+		a.Name, b.Name,
+		a.FeatureRoot, b.FeatureRoot,
+		a.FeatureLocation, b.FeatureLocation,
+		a.AddedBy, b.AddedBy,
+	)
+}
+
+// canonical returns a copy of the vulnerability whose Sources are in the
+// canonical order.
+func (v Vulnerability) canonical() Vulnerability {
+	if len(v.Sources) < 2 {
+		return v
+	}
+
+	v.Sources = append([]Source(nil), v.Sources...)
+	sort.SliceStable(v.Sources, func(i, j int) bool {
+		si, sj := v.Sources[i], v.Sources[j]
+		return compareFields(si.NamespaceName, sj.NamespaceName, si.FeatureName, sj.FeatureName, si.FeatureVersion, sj.FeatureVersion) < 0
+	})
+	return v
+}
+
+// compareFields compares pairs of fields in turn, the first one differing
+// deciding.
+func compareFields(pairs ...string) int {
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if c := strings.Compare(pairs[i], pairs[i+1]); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
@@ -0,0 +1,75 @@
+package result
+
+import "sort"
+
+// ResultDiff is the difference between the vulnerabilities of two images.
+type ResultDiff struct {
+	// Added are the vulnerabilities only found in the candidate image.
+	Added []Vulnerability
+	// Removed are the vulnerabilities only found in the base image.
+	Removed []Vulnerability
+	// Unchanged are the vulnerabilities found in both images, as reported for
+	// the candidate image.
+	Unchanged []Vulnerability
+}
+
+// HasAdded returns whether the candidate image introduces new
+// vulnerabilities.
+func (d ResultDiff) HasAdded() bool {
+	return len(d.Added) > 0
+}
+
+// DiffResults compares the vulnerabilities of a candidate image to those of a
+// base image, matching them by vulnerability and feature name so that a
+// feature upgraded without fixing a vulnerability is still unchanged.
+//
+// Every list of the returned ResultDiff is sorted by key.
+func DiffResults(base, candidate ImageResult) ResultDiff {
+	baseKeys := make(map[Key]struct{}, len(base.Vulnerabilities))
+	for _, v := range base.Vulnerabilities {
+		baseKeys[v.Key()] = struct{}{}
+	}
+
+	var diff ResultDiff
+	candidateKeys := make(map[Key]struct{}, len(candidate.Vulnerabilities))
+	for _, v := range candidate.Vulnerabilities {
+		if _, dup := candidateKeys[v.Key()]; dup {
+			continue
+		}
+		candidateKeys[v.Key()] = struct{}{}
+
+		if _, ok := baseKeys[v.Key()]; ok {
+			diff.Unchanged = append(diff.Unchanged, v)
+		} else {
+			diff.Added = append(diff.Added, v)
+		}
+	}
+
+	removedKeys := make(map[Key]struct{})
+	for _, v := range base.Vulnerabilities {
+		if _, ok := candidateKeys[v.Key()]; ok {
+			continue
+		}
+		if _, dup := removedKeys[v.Key()]; dup {
+			continue
+		}
+		removedKeys[v.Key()] = struct{}{}
+		diff.Removed = append(diff.Removed, v)
+	}
+
+	sortByKey(diff.Added)
+	sortByKey(diff.Removed)
+	sortByKey(diff.Unchanged)
+
+	return diff
+}
+
+func sortByKey(vulnerabilities []Vulnerability) {
+	sort.Slice(vulnerabilities, func(i, j int) bool {
+		ki, kj := vulnerabilities[i].Key(), vulnerabilities[j].Key()
+		if ki.Vulnerability != kj.Vulnerability {
+			return ki.Vulnerability < kj.Vulnerability
+		}
+		return ki.Feature < kj.Feature
+	})
+}
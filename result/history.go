@@ -0,0 +1,24 @@
+package result
+
+// History associates the layers of an image, by name, with the build
+// instructions that created them, such as "RUN apt-get install -y libssl1.1".
+type History map[string]string
+
+// WithHistory returns a copy of the result in which each vulnerability is
+// attributed to the instruction of the layer that added its feature.
+func (r ImageResult) WithHistory(h History) ImageResult {
+	if len(h) == 0 {
+		return r
+	}
+
+	attributed := r
+	attributed.Vulnerabilities = make([]Vulnerability, len(r.Vulnerabilities))
+	for i, v := range r.Vulnerabilities {
+		if instruction, ok := h[v.AddedBy]; ok {
+			v.IntroducedBy = instruction
+		}
+		attributed.Vulnerabilities[i] = v
+	}
+
+	return attributed
+}
@@ -0,0 +1,96 @@
+package result
+
+import (
+	"strings"
+
+	"github.com/MXi4oyu/DockerXScan/database"
+)
+
+// Source is one of the findings of a vulnerability that have been merged
+// into a single one by MergeDuplicates.
+type Source struct {
+	NamespaceName  string            `json:"NamespaceName,omitempty"`
+	FeatureName    string            `json:"FeatureName"`
+	FeatureVersion string            `json:"FeatureVersion,omitempty"`
+	VersionFormat  string            `json:"VersionFormat,omitempty"`
+	FixedBy        string            `json:"FixedBy,omitempty"`
+	Severity       database.Severity `json:"Severity,omitempty"`
+}
+
+// Source returns the finding of the vulnerability, to be listed among the
+// sources of the vulnerability it is merged into.
+func (v Vulnerability) Source() Source {
+	return Source{
+		NamespaceName:  v.NamespaceName,
+		FeatureName:    v.FeatureName,
+		FeatureVersion: v.FeatureVersion,
+		VersionFormat:  v.VersionFormat,
+		FixedBy:        v.FixedBy,
+		Severity:       v.Severity,
+	}
+}
+
+// Findings returns the findings merged into the vulnerability, or the
+// vulnerability itself if it is not the result of a merge.
+func (v Vulnerability) Findings() []Source {
+	if len(v.Sources) == 0 {
+		return []Source{v.Source()}
+	}
+	return v.Sources
+}
+
+// MergeDuplicates returns a copy of the result in which the vulnerabilities
+// sharing a name, such as a CVE found in the packages of two distributions,
+// are merged into one, along with the number of those merged away.
+//
+// The merged vulnerability keeps the fix data of the finding of a
+// distribution, preferably one having a fixed version, and the highest
+// severity of the findings. It lists every finding in its Sources. It keeps
+// the position of the first finding.
+func (r ImageResult) MergeDuplicates() (ImageResult, int) {
+	merged := ImageResult{Image: r.Image, DetectedNamespace: r.DetectedNamespace, Libc: r.Libc, Misconfigurations: r.Misconfigurations, Secrets: r.Secrets, AcceptedRisks: r.AcceptedRisks, Partial: r.Partial, SkippedLayers: r.SkippedLayers}
+
+	positions := make(map[string]int)
+	for _, v := range r.Vulnerabilities {
+		i, ok := positions[v.Name]
+		if !ok {
+			positions[v.Name] = len(merged.Vulnerabilities)
+			merged.Vulnerabilities = append(merged.Vulnerabilities, v)
+			continue
+		}
+
+		m := &merged.Vulnerabilities[i]
+		sources := append(m.Findings(), v.Findings()...)
+		severity := m.Severity
+		if severity.Compare(v.Severity) < 0 {
+			severity = v.Severity
+		}
+		if Preferred(v, *m) {
+			*m = v
+		}
+		m.Sources = sources
+		m.Severity = severity
+	}
+
+	return merged, len(r.Vulnerabilities) - len(merged.Vulnerabilities)
+}
+
+// Preferred returns whether the fix data of a is preferred to the one of b
+// when they are findings of the same vulnerability: those of the packages of
+// a distribution first, then those having a fixed version.
+func Preferred(a, b Vulnerability) bool {
+	if aDistribution, bDistribution := fromDistribution(a), fromDistribution(b); aDistribution != bDistribution {
+		return aDistribution
+	}
+	return a.FixedBy != "" && b.FixedBy == ""
+}
+
+// fromDistribution returns whether a vulnerability affects a package of a
+// distribution. The features analyzed before their kind was stored are
+// recognized by their namespace, such as "debian:9".
+func fromDistribution(v Vulnerability) bool {
+	if v.FeatureKind != "" {
+		return v.FeatureKind == string(database.OSFeature)
+	}
+	return strings.Contains(v.NamespaceName, ":")
+}
@@ -0,0 +1,109 @@
+package result
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/MXi4oyu/DockerXScan/database"
+)
+
+// ErrInvalidImageConfig is returned when a document is not an image
+// configuration.
+var ErrInvalidImageConfig = errors.New("result: not an image configuration")
+
+// secretEnvMarkers are the parts of an environment variable's name that hint
+// that its value is a secret.
+var secretEnvMarkers = []string{"PASSWORD", "PASSWD", "SECRET", "TOKEN", "API_KEY", "APIKEY", "PRIVATE_KEY", "ACCESS_KEY", "CREDENTIAL"}
+
+// Misconfiguration is a risky setting of an image, which is not a
+// vulnerability of its features.
+type Misconfiguration struct {
+	ID          string            `json:"ID"`
+	Title       string            `json:"Title"`
+	Description string            `json:"Description,omitempty"`
+	Severity    database.Severity `json:"Severity,omitempty"`
+}
+
+// ImageConfig is the part of an image configuration, as stored in its config
+// blob, describing how its containers are run.
+type ImageConfig struct {
+	User         string
+	Env          []string
+	ExposedPorts []string
+}
+
+// ParseImageConfig parses the config blob of an image.
+func ParseImageConfig(data []byte) (ImageConfig, error) {
+	var blob struct {
+		Config *struct {
+			User         string              `json:"User"`
+			Env          []string            `json:"Env"`
+			ExposedPorts map[string]struct{} `json:"ExposedPorts"`
+		} `json:"config"`
+	}
+	if err := json.Unmarshal(data, &blob); err != nil {
+		return ImageConfig{}, ErrInvalidImageConfig
+	}
+
+	// An image built from scratch without any instruction has no config.
+	if blob.Config == nil {
+		return ImageConfig{}, nil
+	}
+
+	config := ImageConfig{User: blob.Config.User, Env: blob.Config.Env}
+	for port := range blob.Config.ExposedPorts {
+		config.ExposedPorts = append(config.ExposedPorts, port)
+	}
+
+	return config, nil
+}
+
+// Misconfigurations returns the risky settings of an image configuration.
+func (c ImageConfig) Misconfigurations() []Misconfiguration {
+	var misconfigurations []Misconfiguration
+
+	if c.runsAsRoot() {
+		misconfigurations = append(misconfigurations, Misconfiguration{
+			ID:          "runs-as-root",
+			Title:       "Image runs as root",
+			Description: "No USER other than root is set, so the processes of the containers run as root unless overridden.",
+			Severity:    database.MediumSeverity,
+		})
+	}
+
+	for _, env := range c.Env {
+		kv := strings.SplitN(env, "=", 2)
+		if len(kv) != 2 || kv[1] == "" || !isSecretEnvName(kv[0]) {
+			continue
+		}
+
+		// The value itself is never reported.
+		misconfigurations = append(misconfigurations, Misconfiguration{
+			ID:          "secret-in-env",
+			Title:       "Potential secret in ENV " + kv[0],
+			Description: "The environment variable " + kv[0] + " is set in the image, which makes its value readable by anyone able to pull it.",
+			Severity:    database.HighSeverity,
+		})
+	}
+
+	return misconfigurations
+}
+
+func (c ImageConfig) runsAsRoot() bool {
+	user := c.User
+	if i := strings.Index(user, ":"); i >= 0 {
+		user = user[:i]
+	}
+	return user == "" || user == "root" || user == "0"
+}
+
+func isSecretEnvName(name string) bool {
+	name = strings.ToUpper(name)
+	for _, marker := range secretEnvMarkers {
+		if strings.Contains(name, marker) {
+			return true
+		}
+	}
+	return false
+}
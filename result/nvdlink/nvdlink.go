@@ -0,0 +1,27 @@
+// Package nvdlink implements a result.Processor linking the CVEs that have no
+// link to their page in the National Vulnerability Database.
+package nvdlink
+
+import (
+	"context"
+	"strings"
+
+	"github.com/MXi4oyu/DockerXScan/result"
+)
+
+const nvdURL = "https://nvd.nist.gov/vuln/detail/"
+
+type processor struct{}
+
+func init() {
+	result.RegisterProcessor("nvd-link", processor{})
+}
+
+func (p processor) Process(ctx context.Context, r *result.ImageResult) error {
+	for i, v := range r.Vulnerabilities {
+		if v.Link == "" && strings.HasPrefix(v.Name, "CVE-") {
+			r.Vulnerabilities[i].Link = nvdURL + v.Name
+		}
+	}
+	return nil
+}
@@ -0,0 +1,16 @@
+package result
+
+// WithSkippedLayers returns a copy of the result marked as partial, as the
+// layers given were not analyzed. The result is unchanged if none were
+// skipped.
+func (r ImageResult) WithSkippedLayers(layers []string) ImageResult {
+	if len(layers) == 0 {
+		return r
+	}
+
+	partial := r
+	partial.Partial = true
+	partial.SkippedLayers = append([]string(nil), layers...)
+
+	return partial
+}
@@ -0,0 +1,344 @@
+package result
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/MXi4oyu/DockerXScan/database"
+)
+
+// The actions of the rules of a policy, which are also its verdicts, from the
+// least to the most severe. A vulnerability matched by no rule passes.
+const (
+	PolicyPass   = "pass"
+	PolicyIgnore = "ignore"
+	PolicyWarn   = "warn"
+	PolicyFail   = "fail"
+)
+
+// Policy decides whether an image is accepted from its vulnerabilities. Each
+// vulnerability is decided by the first of the rules that matches it, so that
+// an ignore rule placed first exempts a package from the ones below it.
+//
+// A policy file looks like:
+//
+//	rules:
+//	- name: actively exploited vulnerabilities
+//	  known_exploited: true
+//	  action: fail
+//	- name: tracked in the approved base images
+//	  inherited: true
+//	  action: ignore
+//	- name: ignore the kernel headers
+//	  packages: ["linux-headers-*"]
+//	  action: ignore
+//	- name: fixable high vulnerabilities
+//	  severity: High
+//	  fixable: true
+//	  action: fail
+//	- name: medium vulnerabilities older than a month
+//	  severity: Medium
+//	  age: 720h
+//	  action: warn
+//	staleness:
+//	- name: debian feed older than two days
+//	  namespaces: ["debian"]
+//	  age: 48h
+//	  action: fail
+//	- name: feeds older than a week
+//	  age: 168h
+//	  action: warn
+type Policy struct {
+	Rules []PolicyRule `yaml:"rules"`
+
+	// Staleness decides the images whose namespaces have not been updated
+	// recently, as a clean result could be due to outdated vulnerabilities.
+	Staleness []StalenessRule `yaml:"staleness"`
+}
+
+// PolicyRule matches the vulnerabilities meeting all of its conditions, the
+// empty ones matching any vulnerability.
+type PolicyRule struct {
+	Name string `yaml:"name"`
+
+	// Severity is the lowest severity matched.
+	Severity database.Severity `yaml:"severity"`
+
+	// Fixable, when set, matches the vulnerabilities that have a fixed version
+	// or the ones that don't.
+	Fixable *bool `yaml:"fixable"`
+
+	// Namespaces are the namespaces of the vulnerabilities matched.
+	Namespaces []string `yaml:"namespaces"`
+
+	// Packages are globs, in the syntax of path.Match, of the names of the
+	// features matched.
+	Packages []string `yaml:"packages"`
+
+	// Age matches the vulnerabilities published at least that long ago, or
+	// whose publication date is unknown.
+	Age time.Duration `yaml:"age"`
+
+	// KnownExploited, when set, matches the vulnerabilities known to be
+	// exploited in the wild or the ones that aren't.
+	KnownExploited *bool `yaml:"known_exploited"`
+
+	// EPSS is the lowest EPSS score matched, between 0 and 1. The
+	// vulnerabilities without a score don't match a positive one.
+	EPSS float64 `yaml:"epss"`
+
+	// Inherited, when set, matches the vulnerabilities inherited from a
+	// trusted base image or the ones that aren't.
+	Inherited *bool `yaml:"inherited"`
+
+	Action string `yaml:"action"`
+}
+
+// StalenessRule matches the namespaces of an image whose feed has not been
+// updated for at least Age. Each namespace is decided by the first of the
+// staleness rules that matches it.
+type StalenessRule struct {
+	Name string `yaml:"name"`
+
+	// Namespaces are the namespaces matched, either by their full name such
+	// as "debian:10" or by the name of their feed such as "debian".
+	Namespaces []string `yaml:"namespaces"`
+
+	// Age is how long ago the feed must have been updated for the rule to
+	// match. A feed never updated, or whose last update is unknown, matches.
+	Age time.Duration `yaml:"age"`
+
+	Action string `yaml:"action"`
+}
+
+// FeedUpdates are the times of the last successful updates of the feeds, by
+// their name such as "debian", as given by the supported namespaces of the
+// API. A zero time is a feed that has never been updated.
+type FeedUpdates map[string]time.Time
+
+// Verdict is the decision of a policy on an image, with the reasons of any
+// decision other than PolicyPass.
+type Verdict struct {
+	Action  string
+	Reasons []string
+}
+
+// ParsePolicy parses a YAML policy file, failing on invalid severities,
+// globs or actions.
+func ParsePolicy(data []byte) (Policy, error) {
+	var p Policy
+	if err := yaml.Unmarshal(data, &p); err != nil {
+		return Policy{}, fmt.Errorf("result: could not parse policy: %s", err)
+	}
+
+	for i, rule := range p.Rules {
+		name := rule.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+			p.Rules[i].Name = name
+		}
+
+		if rule.Severity != "" {
+			severity, err := database.NewSeverity(string(rule.Severity))
+			if err != nil {
+				return Policy{}, fmt.Errorf("result: rule %s of policy has an invalid severity %q", name, rule.Severity)
+			}
+			p.Rules[i].Severity = severity
+		}
+		for _, glob := range rule.Packages {
+			if _, err := path.Match(glob, ""); err != nil {
+				return Policy{}, fmt.Errorf("result: rule %s of policy has an invalid package glob %q", name, glob)
+			}
+		}
+
+		if rule.EPSS < 0 || rule.EPSS > 1 {
+			return Policy{}, fmt.Errorf("result: rule %s of policy has an EPSS score %v out of [0, 1]", name, rule.EPSS)
+		}
+
+		switch rule.Action {
+		case PolicyIgnore, PolicyWarn, PolicyFail:
+		default:
+			return Policy{}, fmt.Errorf("result: rule %s of policy has an invalid action %q", name, rule.Action)
+		}
+	}
+
+	for i, rule := range p.Staleness {
+		name := rule.Name
+		if name == "" {
+			name = fmt.Sprintf("staleness #%d", i+1)
+			p.Staleness[i].Name = name
+		}
+
+		if rule.Age <= 0 {
+			return Policy{}, fmt.Errorf("result: staleness rule %s of policy must have a positive age", name)
+		}
+		switch rule.Action {
+		case PolicyIgnore, PolicyWarn, PolicyFail:
+		default:
+			return Policy{}, fmt.Errorf("result: staleness rule %s of policy has an invalid action %q", name, rule.Action)
+		}
+	}
+
+	return p, nil
+}
+
+// Evaluate returns the verdict of the policy on an image result: the most
+// severe action of the rules deciding its vulnerabilities and of the staleness
+// rules deciding its namespaces. The vulnerabilities suppressed by VEX are not
+// evaluated.
+//
+// The namespaces are the detected one and those of the vulnerabilities. Those
+// whose feed is not in feeds are not evaluated, unless feeds is nil because
+// the updates couldn't be known, in which case every namespace is as stale as
+// can be.
+func (p Policy) Evaluate(r ImageResult, feeds FeedUpdates, now time.Time) Verdict {
+	verdict := Verdict{Action: PolicyPass}
+	for _, namespace := range r.namespaces() {
+		feed := strings.SplitN(namespace, ":", 2)[0]
+		lastUpdate, known := feeds[feed]
+		if !known && feeds != nil {
+			continue
+		}
+
+		for _, rule := range p.Staleness {
+			if !rule.matches(namespace, feed, lastUpdate, now) {
+				continue
+			}
+
+			if rule.Action != PolicyIgnore {
+				age := "has never been updated"
+				if !known {
+					age = "has an unknown last update"
+				} else if !lastUpdate.IsZero() {
+					age = fmt.Sprintf("was last updated %s ago", now.Sub(lastUpdate).Truncate(time.Minute))
+				}
+				verdict.Reasons = append(verdict.Reasons, fmt.Sprintf("the feed of %s %s: %s by staleness rule %s", namespace, age, rule.Action, rule.Name))
+			}
+			if actionRank(rule.Action) > actionRank(verdict.Action) {
+				verdict.Action = rule.Action
+			}
+			break
+		}
+	}
+
+	for _, v := range r.Vulnerabilities {
+		if v.Suppressed != nil {
+			continue
+		}
+
+		for _, rule := range p.Rules {
+			if !rule.matches(v, now) {
+				continue
+			}
+
+			if rule.Action != PolicyIgnore {
+				verdict.Reasons = append(verdict.Reasons, fmt.Sprintf("%s in %s (%s): %s by rule %s", v.Name, v.FeatureName, v.Severity, rule.Action, rule.Name))
+			}
+			if actionRank(rule.Action) > actionRank(verdict.Action) {
+				verdict.Action = rule.Action
+			}
+			break
+		}
+	}
+
+	// Ignoring a vulnerability is not a verdict.
+	if verdict.Action == PolicyIgnore {
+		verdict.Action = PolicyPass
+	}
+
+	return verdict
+}
+
+func (rule PolicyRule) matches(v Vulnerability, now time.Time) bool {
+	if rule.Severity != "" && rule.Severity.Compare(v.Severity) > 0 {
+		return false
+	}
+	if rule.Fixable != nil && *rule.Fixable != (v.FixedBy != "") {
+		return false
+	}
+	if len(rule.Namespaces) > 0 && !containsString(rule.Namespaces, v.NamespaceName) {
+		return false
+	}
+	if len(rule.Packages) > 0 && !matchesGlob(rule.Packages, v.FeatureName) {
+		return false
+	}
+	if rule.KnownExploited != nil && *rule.KnownExploited != v.KnownExploited {
+		return false
+	}
+	if rule.EPSS > 0 && v.EPSSScore < rule.EPSS {
+		return false
+	}
+	if rule.Inherited != nil && *rule.Inherited != (v.InheritedFrom != "") {
+		return false
+	}
+	if rule.Age > 0 {
+		if published, err := time.Parse(time.RFC3339, v.PublishedDate); err == nil && now.Sub(published) < rule.Age {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (rule StalenessRule) matches(namespace, feed string, lastUpdate, now time.Time) bool {
+	if len(rule.Namespaces) > 0 && !containsString(rule.Namespaces, namespace) && !containsString(rule.Namespaces, feed) {
+		return false
+	}
+	return lastUpdate.IsZero() || now.Sub(lastUpdate) >= rule.Age
+}
+
+// namespaces returns the namespaces of the image, decided by the staleness
+// rules: the detected one, unless it is not a real namespace, and those of the
+// vulnerabilities.
+func (r ImageResult) namespaces() []string {
+	var namespaces []string
+	seen := make(map[string]bool)
+	add := func(namespace string) {
+		if namespace != "" && namespace != ScratchNamespace && namespace != UnknownNamespace && !seen[namespace] {
+			seen[namespace] = true
+			namespaces = append(namespaces, namespace)
+		}
+	}
+
+	add(r.DetectedNamespace)
+	for _, v := range r.Vulnerabilities {
+		add(v.NamespaceName)
+	}
+
+	return namespaces
+}
+
+func actionRank(action string) int {
+	switch action {
+	case PolicyIgnore:
+		return 1
+	case PolicyWarn:
+		return 2
+	case PolicyFail:
+		return 3
+	default:
+		return 0
+	}
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesGlob(globs []string, name string) bool {
+	for _, glob := range globs {
+		if ok, _ := path.Match(glob, name); ok {
+			return true
+		}
+	}
+	return false
+}
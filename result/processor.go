@@ -0,0 +1,71 @@
+package result
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+var (
+	processorsM    sync.RWMutex
+	processors     = make(map[string]Processor)
+	processorNames []string
+)
+
+// Processor changes the result of an image once its vulnerabilities are
+// resolved and before it is reported, such as to link them to the tickets of
+// an organization or to tag them with the team owning the image, without
+// changing the scanner itself.
+type Processor interface {
+	// Process changes the result in place.
+	Process(ctx context.Context, r *ImageResult) error
+}
+
+// RegisterProcessor makes a Processor run on every result, after those
+// registered before it.
+//
+// If called twice with the same name, the name is blank, or if the provided
+// Processor is nil, this function panics.
+func RegisterProcessor(name string, p Processor) {
+	if name == "" {
+		panic("result: could not register a Processor with an empty name")
+	}
+
+	if p == nil {
+		panic("result: could not register a nil Processor")
+	}
+
+	processorsM.Lock()
+	defer processorsM.Unlock()
+
+	if _, dup := processors[name]; dup {
+		panic("result: RegisterProcessor called twice for " + name)
+	}
+
+	processors[name] = p
+	processorNames = append(processorNames, name)
+}
+
+// ListProcessors returns the names of the registered Processors, in the order
+// they run.
+func ListProcessors() []string {
+	processorsM.RLock()
+	defer processorsM.RUnlock()
+
+	return append([]string(nil), processorNames...)
+}
+
+// Process runs the registered Processors on a result, in the order they were
+// registered, stopping at the first that fails.
+func Process(ctx context.Context, r *ImageResult) error {
+	processorsM.RLock()
+	defer processorsM.RUnlock()
+
+	for _, name := range processorNames {
+		if err := processors[name].Process(ctx, r); err != nil {
+			return fmt.Errorf("result: processor %s failed: %s", name, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,104 @@
+package result
+
+import (
+	"fmt"
+	"regexp"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Redaction replaces the matches of a regular expression, such as the
+// hostname of an internal registry, with a replacement that may refer to the
+// groups of the match as $1.
+type Redaction struct {
+	Pattern     *regexp.Regexp
+	Replacement string
+}
+
+// Redactions are applied in order to the image references and the file paths
+// of the results, so that a report can be shared without revealing the names
+// of the infrastructure.
+//
+// A redactions file looks like:
+//
+//	redactions:
+//	- pattern: 'registry\.corp\.example\.com(:\d+)?'
+//	  replacement: registry.example
+//	- pattern: '^opt/acme/'
+//	  replacement: opt/app/
+type Redactions []Redaction
+
+// ParseRedactions parses a redactions file.
+func ParseRedactions(data []byte) (Redactions, error) {
+	var file struct {
+		Redactions []struct {
+			Pattern     string `yaml:"pattern"`
+			Replacement string `yaml:"replacement"`
+		} `yaml:"redactions"`
+	}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("result: could not parse redactions: %s", err)
+	}
+
+	redactions := make(Redactions, 0, len(file.Redactions))
+	for i, r := range file.Redactions {
+		if r.Pattern == "" {
+			return nil, fmt.Errorf("result: redaction #%d has no pattern", i+1)
+		}
+		pattern, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("result: redaction #%d has an invalid pattern: %s", i+1, err)
+		}
+		redactions = append(redactions, Redaction{Pattern: pattern, Replacement: r.Replacement})
+	}
+
+	return redactions, nil
+}
+
+// Apply returns s with every redaction applied.
+func (rs Redactions) Apply(s string) string {
+	for _, r := range rs {
+		s = r.Pattern.ReplaceAllString(s, r.Replacement)
+	}
+	return s
+}
+
+// Redact returns a copy of the result whose image reference, the roots,
+// locations and build instructions of the features, and the paths of the
+// secrets, are redacted.
+func (r ImageResult) Redact(rs Redactions) ImageResult {
+	if len(rs) == 0 {
+		return r
+	}
+
+	redacted := r
+	redacted.Image = rs.Apply(r.Image)
+	redacted.Vulnerabilities = make([]Vulnerability, len(r.Vulnerabilities))
+	for i, v := range r.Vulnerabilities {
+		redacted.Vulnerabilities[i] = v.redact(rs)
+	}
+	if r.Secrets != nil {
+		redacted.Secrets = make([]Secret, len(r.Secrets))
+		for i, s := range r.Secrets {
+			s.Path = rs.Apply(s.Path)
+			redacted.Secrets[i] = s
+		}
+	}
+	if r.AcceptedRisks != nil {
+		redacted.AcceptedRisks = make([]AcceptedRisk, len(r.AcceptedRisks))
+		for i, a := range r.AcceptedRisks {
+			a.Vulnerability = a.Vulnerability.redact(rs)
+			redacted.AcceptedRisks[i] = a
+		}
+	}
+
+	return redacted
+}
+
+func (v Vulnerability) redact(rs Redactions) Vulnerability {
+	v.FeatureRoot = rs.Apply(v.FeatureRoot)
+	v.FeatureLocation = rs.Apply(v.FeatureLocation)
+	v.IntroducedBy = rs.Apply(v.IntroducedBy)
+	v.InheritedFrom = rs.Apply(v.InheritedFrom)
+	return v
+}
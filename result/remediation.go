@@ -0,0 +1,84 @@
+package result
+
+import (
+	"sort"
+
+	"github.com/MXi4oyu/DockerXScan/versionfmt"
+)
+
+// Upgrade is the upgrade of a feature of an image that fixes some of its
+// vulnerabilities.
+type Upgrade struct {
+	FeatureName     string   `json:"FeatureName"`
+	NamespaceName   string   `json:"NamespaceName,omitempty"`
+	CurrentVersion  string   `json:"CurrentVersion,omitempty"`
+	FixedVersion    string   `json:"FixedVersion"`
+	Vulnerabilities []string `json:"Vulnerabilities"`
+}
+
+// Upgrades returns the upgrades that fix every vulnerability of the result
+// having a fixed version, the vulnerabilities suppressed by VEX being left
+// out. Each feature is upgraded once, to the highest of the versions fixing
+// its vulnerabilities. The features of every finding of the merged
+// vulnerabilities are upgraded.
+//
+// The upgrades fixing the most vulnerabilities come first.
+func (r ImageResult) Upgrades() []Upgrade {
+	type key struct {
+		namespace, feature string
+	}
+
+	var keys []key
+	upgrades := make(map[key]*Upgrade)
+	formats := make(map[key]string)
+	for _, v := range r.Vulnerabilities {
+		if v.Suppressed != nil {
+			continue
+		}
+
+		for _, f := range v.Findings() {
+			if f.FixedBy == "" {
+				continue
+			}
+
+			k := key{f.NamespaceName, f.FeatureName}
+			u, ok := upgrades[k]
+			if !ok {
+				u = &Upgrade{FeatureName: f.FeatureName, NamespaceName: f.NamespaceName, CurrentVersion: f.FeatureVersion, FixedVersion: f.FixedBy}
+				upgrades[k] = u
+				formats[k] = f.VersionFormat
+				keys = append(keys, k)
+			} else if higher(f.NamespaceName, formats[k], f.FixedBy, u.FixedVersion) {
+				u.FixedVersion = f.FixedBy
+			}
+			u.Vulnerabilities = append(u.Vulnerabilities, v.Name)
+		}
+	}
+
+	remediation := make([]Upgrade, 0, len(keys))
+	for _, k := range keys {
+		u := upgrades[k]
+		sort.Strings(u.Vulnerabilities)
+		remediation = append(remediation, *u)
+	}
+	sort.SliceStable(remediation, func(i, j int) bool {
+		if len(remediation[i].Vulnerabilities) != len(remediation[j].Vulnerabilities) {
+			return len(remediation[i].Vulnerabilities) > len(remediation[j].Vulnerabilities)
+		}
+		return remediation[i].FeatureName < remediation[j].FeatureName
+	})
+
+	return remediation
+}
+
+// higher returns whether version a is higher than version b, compared as the
+// namespace does. The versions that can't be compared, such as those of results
+// without a version format, are compared as strings.
+func higher(namespaceName, format, a, b string) bool {
+	if format != "" {
+		if cmp, err := versionfmt.CompareInNamespace(namespaceName, format, a, b); err == nil {
+			return cmp > 0
+		}
+	}
+	return a > b
+}
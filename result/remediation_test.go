@@ -0,0 +1,26 @@
+package result
+
+import (
+	"testing"
+
+	_ "github.com/MXi4oyu/DockerXScan/versionfmt/apk"
+	_ "github.com/MXi4oyu/DockerXScan/versionfmt/dpkg"
+)
+
+func TestUpgradesComparedInNamespace(t *testing.T) {
+	// As dpkg versions, 1.2.4_rc1 is higher than 1.2.4, while it is a release
+	// candidate of it on Alpine.
+	r := ImageResult{Image: "app", Vulnerabilities: []Vulnerability{
+		{Name: "CVE-2023-0001", FeatureName: "musl", NamespaceName: "alpine:v3.18", VersionFormat: "dpkg", FeatureVersion: "1.2.3", FixedBy: "1.2.4"},
+		{Name: "CVE-2023-0002", FeatureName: "musl", NamespaceName: "alpine:v3.18", VersionFormat: "dpkg", FeatureVersion: "1.2.3", FixedBy: "1.2.4_rc1"},
+	}}
+
+	upgrades := r.Upgrades()
+	if len(upgrades) != 1 || upgrades[0].FixedVersion != "1.2.4" {
+		t.Errorf("Upgrades() = %+v, want musl upgraded to 1.2.4", upgrades)
+	}
+	packages := r.Summarize(1).TopPackages
+	if len(packages) != 1 || packages[0].FixedVersion != "1.2.4" {
+		t.Errorf("Summarize() = %+v, want musl fixed in 1.2.4", packages)
+	}
+}
@@ -0,0 +1,223 @@
+// Package result holds the vulnerabilities found in an image, in a form that
+// can be stored and compared independently of the API they came from.
+package result
+
+import (
+	"time"
+
+	"github.com/MXi4oyu/DockerXScan/api/v1"
+	"github.com/MXi4oyu/DockerXScan/database"
+)
+
+// The namespaces reported for images in which no operating system has been
+// detected.
+const (
+	// ScratchNamespace is reported for images without any detected operating
+	// system nor feature, such as the images built FROM scratch.
+	ScratchNamespace = "scratch"
+
+	// UnknownNamespace is reported for images without any detected operating
+	// system, but with features that do not depend on it.
+	UnknownNamespace = "unknown"
+)
+
+// ImageResult is the set of vulnerabilities affecting the features of an
+// image, along with the misconfigurations of the image itself and the secrets
+// left in its layers.
+//
+// Its JSON form is versioned by SchemaVersion.
+type ImageResult struct {
+	SchemaVersion     int                `json:"schemaVersion"`
+	Image             string             `json:"Image,omitempty"`
+	DetectedNamespace string             `json:"DetectedNamespace,omitempty"`
+	Vulnerabilities   []Vulnerability    `json:"Vulnerabilities,omitempty"`
+	Misconfigurations []Misconfiguration `json:"Misconfigurations,omitempty"`
+
+	// Libc is the C library of the image, "glibc" or "musl", when it is
+	// known. The binaries of the image are built for its ABI.
+	Libc string `json:"Libc,omitempty"`
+
+	// Secrets are the credentials found in the files of the layers.
+	Secrets []Secret `json:"Secrets,omitempty"`
+
+	// AcceptedRisks are the vulnerabilities left out of Vulnerabilities
+	// because a suppression accepts their risk.
+	AcceptedRisks []AcceptedRisk `json:"AcceptedRisks,omitempty"`
+
+	// Partial is set when the scan stopped before analyzing every layer, such
+	// as on a timeout, in which case the vulnerabilities are those of the
+	// layers below SkippedLayers.
+	Partial       bool     `json:"Partial,omitempty"`
+	SkippedLayers []string `json:"SkippedLayers,omitempty"`
+
+	// Remediation is filled with the Upgrades when the result is encoded.
+	Remediation []Upgrade `json:"Remediation,omitempty"`
+
+	// Summary is filled with the Summary of the DefaultSummarySize most
+	// affected packages when the result is encoded.
+	Summary *Summary `json:"Summary,omitempty"`
+}
+
+// Vulnerability is a vulnerability affecting one feature of an image.
+type Vulnerability struct {
+	Name           string            `json:"Name"`
+	NamespaceName  string            `json:"NamespaceName,omitempty"`
+	Description    string            `json:"Description,omitempty"`
+	Link           string            `json:"Link,omitempty"`
+	Severity       database.Severity `json:"Severity,omitempty"`
+	FixedBy        string            `json:"FixedBy,omitempty"`
+	FeatureName    string            `json:"FeatureName"`
+	FeatureVersion string            `json:"FeatureVersion,omitempty"`
+	VersionFormat  string            `json:"VersionFormat,omitempty"`
+	FeatureKind    string            `json:"FeatureKind,omitempty"`
+	AddedBy        string            `json:"AddedBy,omitempty"`
+	FeatureRoot    string            `json:"FeatureRoot,omitempty"`
+
+	// FeatureLocation is the path of the file in which the feature was
+	// found, such as "var/lib/dpkg/status" or the path of a binary.
+	FeatureLocation string `json:"FeatureLocation,omitempty"`
+
+	// IntroducedBy is the build instruction of the layer that added the
+	// feature, such as "RUN apt-get install -y libssl1.1", when the history
+	// of the image is known.
+	IntroducedBy string `json:"IntroducedBy,omitempty"`
+
+	// InheritedFrom is the name of the trusted base image whose layers added
+	// the feature, whose vulnerabilities are tracked separately.
+	InheritedFrom string `json:"InheritedFrom,omitempty"`
+
+	// PublishedDate is when the vulnerability was disclosed, formatted as
+	// RFC 3339.
+	PublishedDate string `json:"PublishedDate,omitempty"`
+
+	// KnownExploited is set when the vulnerability is known to be exploited
+	// in the wild, and EPSSScore is the probability that it is exploited in
+	// the next 30 days.
+	KnownExploited bool    `json:"KnownExploited,omitempty"`
+	EPSSScore      float64 `json:"EPSSScore,omitempty"`
+
+	// Confidence is LowConfidence when the affected versions of the
+	// vulnerability are only approximated, so that the match is to be
+	// reviewed rather than trusted.
+	Confidence database.Confidence `json:"Confidence,omitempty"`
+
+	// Suppressed is set when a VEX statement declares the feature not
+	// affected by the vulnerability.
+	Suppressed *Suppression `json:"Suppressed,omitempty"`
+
+	// Sources lists the findings of the vulnerability when several have
+	// been merged into it by MergeDuplicates.
+	Sources []Source `json:"Sources,omitempty"`
+}
+
+// Key identifies a Vulnerability within an ImageResult.
+type Key struct {
+	Vulnerability string
+	Feature       string
+}
+
+// Key returns the key of the vulnerability, made of its name and the name of
+// the feature it affects.
+func (v Vulnerability) Key() Key {
+	return Key{Vulnerability: v.Name, Feature: v.FeatureName}
+}
+
+// OnlyFixed returns a copy of the result holding only the vulnerabilities
+// that have a fixed version, along with the number of those left out.
+func (r ImageResult) OnlyFixed() (ImageResult, int) {
+	fixed := ImageResult{Image: r.Image, DetectedNamespace: r.DetectedNamespace, Libc: r.Libc, Misconfigurations: r.Misconfigurations, Secrets: r.Secrets, AcceptedRisks: r.AcceptedRisks, Partial: r.Partial, SkippedLayers: r.SkippedLayers}
+	for _, v := range r.Vulnerabilities {
+		if v.FixedBy != "" {
+			fixed.Vulnerabilities = append(fixed.Vulnerabilities, v)
+		}
+	}
+
+	return fixed, len(r.Vulnerabilities) - len(fixed.Vulnerabilities)
+}
+
+// OfKind returns a copy of the result holding only the vulnerabilities of
+// the features of a kind, such as database.OSFeature, along with the number
+// of those left out.
+func (r ImageResult) OfKind(kind database.FeatureKind) (ImageResult, int) {
+	kept := ImageResult{Image: r.Image, DetectedNamespace: r.DetectedNamespace, Libc: r.Libc, Misconfigurations: r.Misconfigurations, Secrets: r.Secrets, AcceptedRisks: r.AcceptedRisks, Partial: r.Partial, SkippedLayers: r.SkippedLayers}
+	for _, v := range r.Vulnerabilities {
+		if v.FeatureKind == string(kind) {
+			kept.Vulnerabilities = append(kept.Vulnerabilities, v)
+		}
+	}
+
+	return kept, len(r.Vulnerabilities) - len(kept.Vulnerabilities)
+}
+
+// ConfidentAtLeast returns a copy of the result holding only the
+// vulnerabilities of at least a confidence, along with the number of those
+// left out. Vulnerabilities without a confidence have a high one.
+func (r ImageResult) ConfidentAtLeast(min database.Confidence) (ImageResult, int) {
+	kept := ImageResult{Image: r.Image, DetectedNamespace: r.DetectedNamespace, Libc: r.Libc, Misconfigurations: r.Misconfigurations, Secrets: r.Secrets, AcceptedRisks: r.AcceptedRisks, Partial: r.Partial, SkippedLayers: r.SkippedLayers}
+	for _, v := range r.Vulnerabilities {
+		if v.Confidence.Compare(min) >= 0 {
+			kept.Vulnerabilities = append(kept.Vulnerabilities, v)
+		}
+	}
+
+	return kept, len(r.Vulnerabilities) - len(kept.Vulnerabilities)
+}
+
+// PublishedBefore returns a copy of the result holding only the
+// vulnerabilities published before a given time, along with the number of
+// those left out. Vulnerabilities whose publication date is unknown are kept.
+func (r ImageResult) PublishedBefore(t time.Time) (ImageResult, int) {
+	published := ImageResult{Image: r.Image, DetectedNamespace: r.DetectedNamespace, Libc: r.Libc, Misconfigurations: r.Misconfigurations, Secrets: r.Secrets, AcceptedRisks: r.AcceptedRisks, Partial: r.Partial, SkippedLayers: r.SkippedLayers}
+	for _, v := range r.Vulnerabilities {
+		if date, err := time.Parse(time.RFC3339, v.PublishedDate); err == nil && !date.Before(t) {
+			continue
+		}
+		published.Vulnerabilities = append(published.Vulnerabilities, v)
+	}
+
+	return published, len(r.Vulnerabilities) - len(published.Vulnerabilities)
+}
+
+// FromLayer builds the ImageResult of an image from its top layer, as
+// returned by the API with its features and vulnerabilities.
+func FromLayer(image string, layer v1.Layer) ImageResult {
+	r := ImageResult{Image: image, DetectedNamespace: DetectedNamespace(layer)}
+	for _, feature := range layer.Features {
+		for _, vulnerability := range feature.Vulnerabilities {
+			r.Vulnerabilities = append(r.Vulnerabilities, Vulnerability{
+				Name:            vulnerability.Name,
+				NamespaceName:   vulnerability.NamespaceName,
+				Description:     vulnerability.Description,
+				Link:            vulnerability.Link,
+				Severity:        database.Severity(vulnerability.Severity),
+				FixedBy:         vulnerability.FixedBy,
+				FeatureName:     feature.Name,
+				FeatureVersion:  feature.Version,
+				VersionFormat:   feature.VersionFormat,
+				FeatureKind:     feature.Kind,
+				AddedBy:         feature.AddedBy,
+				FeatureRoot:     feature.Root,
+				FeatureLocation: feature.Location,
+				PublishedDate:   vulnerability.PublishedDate,
+				KnownExploited:  vulnerability.KnownExploited,
+				EPSSScore:       vulnerability.EPSSScore,
+				Confidence:      database.Confidence(vulnerability.Confidence),
+			})
+		}
+	}
+
+	return r
+}
+
+// DetectedNamespace returns the namespace detected in the top layer of an
+// image, or ScratchNamespace or UnknownNamespace when none has been.
+func DetectedNamespace(layer v1.Layer) string {
+	switch {
+	case layer.NamespaceName != "":
+		return layer.NamespaceName
+	case len(layer.Features) == 0:
+		return ScratchNamespace
+	default:
+		return UnknownNamespace
+	}
+}
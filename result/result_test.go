@@ -0,0 +1,37 @@
+package result
+
+import (
+	"testing"
+
+	"github.com/MXi4oyu/DockerXScan/database"
+)
+
+func TestConfidentAtLeast(t *testing.T) {
+	r := ImageResult{Image: "app", Vulnerabilities: []Vulnerability{
+		{Name: "CVE-2022-0001", FeatureName: "openssl"},
+		{Name: "RUSTSEC-2021-0001", FeatureName: "crate", Confidence: database.LowConfidence},
+		{Name: "RUSTSEC-2021-0002", FeatureName: "crate", Confidence: database.HighConfidence},
+	}}
+
+	tests := []struct {
+		confidence database.Confidence
+		kept       []string
+	}{
+		{database.LowConfidence, []string{"CVE-2022-0001", "RUSTSEC-2021-0001", "RUSTSEC-2021-0002"}},
+		// Vulnerabilities without a confidence have a high one.
+		{database.HighConfidence, []string{"CVE-2022-0001", "RUSTSEC-2021-0002"}},
+	}
+
+	for _, test := range tests {
+		kept, left := r.ConfidentAtLeast(test.confidence)
+		if kept.Image != r.Image || left != len(r.Vulnerabilities)-len(test.kept) || len(kept.Vulnerabilities) != len(test.kept) {
+			t.Errorf("ConfidentAtLeast(%s) = %+v, %d, want %v", test.confidence, kept, left, test.kept)
+			continue
+		}
+		for i, v := range kept.Vulnerabilities {
+			if v.Name != test.kept[i] {
+				t.Errorf("ConfidentAtLeast(%s) kept %s, want %s", test.confidence, v.Name, test.kept[i])
+			}
+		}
+	}
+}
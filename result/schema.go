@@ -0,0 +1,49 @@
+package result
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// SchemaVersion is the version of the JSON form of an ImageResult, which is
+// described by the JSON Schema in schema.json. It is bumped on every change
+// that may break the consumers of the results, such as a field being removed,
+// renamed or having its meaning changed; a new optional field does not.
+const SchemaVersion = 1
+
+// ErrUnsupportedSchemaVersion is returned when decoding a result written with
+// a newer schema than the one known.
+var ErrUnsupportedSchemaVersion = errors.New("result: unsupported schema version")
+
+// MarshalJSON encodes the result in the canonical order, along with the
+// current SchemaVersion, its Upgrades as the Remediation and its Summary, so
+// that the same result is always encoded to the same bytes.
+func (r ImageResult) MarshalJSON() ([]byte, error) {
+	type imageResult ImageResult
+	r = r.Canonical()
+	r.SchemaVersion = SchemaVersion
+	r.Remediation = r.Upgrades()
+	summary := r.Summarize(DefaultSummarySize)
+	r.Summary = &summary
+	return json.Marshal(imageResult(r))
+}
+
+// UnmarshalJSON decodes a result, failing with ErrUnsupportedSchemaVersion if
+// it was written with a newer schema. The results written before the schema
+// was versioned have no version, and are decoded as the first one.
+func (r *ImageResult) UnmarshalJSON(data []byte) error {
+	type imageResult ImageResult
+	var decoded imageResult
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	if decoded.SchemaVersion > SchemaVersion {
+		return ErrUnsupportedSchemaVersion
+	}
+	if decoded.SchemaVersion == 0 {
+		decoded.SchemaVersion = 1
+	}
+
+	*r = ImageResult(decoded)
+	return nil
+}
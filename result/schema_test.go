@@ -0,0 +1,276 @@
+package result
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/MXi4oyu/DockerXScan/database"
+)
+
+// schemaValidator checks JSON values against the subset of JSON Schema that
+// schema.json is written in. It is stricter than JSON Schema in that the
+// properties of an object that its schema doesn't declare are errors, so that
+// a field added to the results without being documented is caught.
+type schemaValidator struct {
+	definitions map[string]interface{}
+}
+
+func (s schemaValidator) resolve(schema map[string]interface{}) map[string]interface{} {
+	for {
+		ref, ok := schema["$ref"].(string)
+		if !ok {
+			return schema
+		}
+		schema = s.definitions[strings.TrimPrefix(ref, "#/definitions/")].(map[string]interface{})
+	}
+}
+
+// declared returns the properties declared by a schema and those it is made
+// of with allOf.
+func (s schemaValidator) declared(schema map[string]interface{}) map[string]interface{} {
+	schema = s.resolve(schema)
+	properties := make(map[string]interface{})
+	for name, property := range asObject(schema["properties"]) {
+		properties[name] = property
+	}
+	for _, sub := range asArray(schema["allOf"]) {
+		for name, property := range s.declared(sub.(map[string]interface{})) {
+			properties[name] = property
+		}
+	}
+	return properties
+}
+
+// validate returns the errors of value against schema, in which the parts of
+// an allOf don't check the undeclared properties, as the properties of the
+// other parts are declared too.
+func (s schemaValidator) validate(schema map[string]interface{}, value interface{}, at string) []string {
+	return s.validatePart(schema, value, at, false)
+}
+
+func (s schemaValidator) validatePart(schema map[string]interface{}, value interface{}, at string, part bool) []string {
+	schema = s.resolve(schema)
+	var errs []string
+	fail := func(format string, args ...interface{}) {
+		errs = append(errs, at+": "+fmt.Sprintf(format, args...))
+	}
+
+	for _, sub := range asArray(schema["allOf"]) {
+		errs = append(errs, s.validatePart(sub.(map[string]interface{}), value, at, true)...)
+	}
+	if object, ok := value.(map[string]interface{}); ok && !part && (schema["type"] == "object" || schema["allOf"] != nil) {
+		declared := s.declared(schema)
+		_, additional := schema["additionalProperties"]
+		for name := range object {
+			if _, ok := declared[name]; !ok && !additional {
+				fail("%s is not declared by the schema", name)
+			}
+		}
+	}
+	if c, ok := schema["const"]; ok && !reflect.DeepEqual(c, value) {
+		fail("%v is not %v", value, c)
+	}
+	if enum, ok := schema["enum"]; ok {
+		found := false
+		for _, e := range asArray(enum) {
+			found = found || reflect.DeepEqual(e, value)
+		}
+		if !found {
+			fail("%v is not one of %v", value, enum)
+		}
+	}
+	if min, ok := schema["minimum"].(float64); ok && value.(float64) < min {
+		fail("%v is less than %v", value, min)
+	}
+	if max, ok := schema["maximum"].(float64); ok && value.(float64) > max {
+		fail("%v is more than %v", value, max)
+	}
+
+	switch schema["type"] {
+	case "string":
+		if _, ok := value.(string); !ok {
+			fail("%v is not a string", value)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			fail("%v is not a boolean", value)
+		}
+	case "number", "integer":
+		if n, ok := value.(float64); !ok || (schema["type"] == "integer" && n != float64(int64(n))) {
+			fail("%v is not a %s", value, schema["type"])
+		}
+	case "array":
+		items, ok := value.([]interface{})
+		if !ok {
+			fail("%v is not an array", value)
+		}
+		for i, item := range items {
+			errs = append(errs, s.validate(schema["items"].(map[string]interface{}), item, fmt.Sprintf("%s[%d]", at, i))...)
+		}
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			fail("%v is not an object", value)
+			break
+		}
+		for _, name := range asArray(schema["required"]) {
+			if _, ok := object[name.(string)]; !ok {
+				fail("the required %s is missing", name)
+			}
+		}
+		properties := asObject(schema["properties"])
+		for name, v := range object {
+			if property, ok := properties[name]; ok {
+				errs = append(errs, s.validate(property.(map[string]interface{}), v, at+"."+name)...)
+			} else if additional, ok := schema["additionalProperties"].(map[string]interface{}); ok {
+				errs = append(errs, s.validate(additional, v, at+"."+name)...)
+			}
+		}
+	}
+
+	return errs
+}
+
+func asObject(v interface{}) map[string]interface{} {
+	object, _ := v.(map[string]interface{})
+	return object
+}
+
+func asArray(v interface{}) []interface{} {
+	array, _ := v.([]interface{})
+	return array
+}
+
+func loadSchema(t *testing.T) (map[string]interface{}, schemaValidator) {
+	data, err := ioutil.ReadFile("schema.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var schema map[string]interface{}
+	if err := json.Unmarshal(data, &schema); err != nil {
+		t.Fatalf("schema.json is not valid JSON: %s", err)
+	}
+	return schema, schemaValidator{definitions: asObject(schema["definitions"])}
+}
+
+// testResult is a result in which every field of the schema is set.
+var testResult = ImageResult{
+	Image:             "registry.example.com/app:1.0",
+	DetectedNamespace: "debian:11",
+	Libc:              "glibc",
+	Vulnerabilities: []Vulnerability{
+		{
+			Name:            "CVE-2022-2097",
+			NamespaceName:   "debian:11",
+			Description:     "AES OCB fails to encrypt some bytes.",
+			Link:            "https://security-tracker.debian.org/tracker/CVE-2022-2097",
+			Severity:        database.MediumSeverity,
+			FixedBy:         "1.1.1n-0+deb11u4",
+			FeatureName:     "libssl1.1",
+			FeatureVersion:  "1.1.1n-0+deb11u3",
+			VersionFormat:   "dpkg",
+			FeatureKind:     string(database.OSFeature),
+			AddedBy:         "sha256:0123",
+			FeatureRoot:     "opt/rootfs",
+			FeatureLocation: "var/lib/dpkg/status",
+			IntroducedBy:    "RUN apt-get install -y libssl1.1",
+			InheritedFrom:   "debian:11",
+			PublishedDate:   "2022-07-05T11:15:00Z",
+			KnownExploited:  true,
+			EPSSScore:       0.25,
+			Confidence:      database.LowConfidence,
+			Suppressed:      &Suppression{Document: "vex.json", Justification: "vulnerable_code_not_in_execute_path", ImpactStatement: "OCB is not used."},
+			Sources: []Source{
+				{NamespaceName: "debian:11", FeatureName: "libssl1.1", FeatureVersion: "1.1.1n-0+deb11u3", VersionFormat: "dpkg", FixedBy: "1.1.1n-0+deb11u4", Severity: database.MediumSeverity},
+				{NamespaceName: "debian:11", FeatureName: "openssl", FeatureVersion: "1.1.1n-0+deb11u3", VersionFormat: "dpkg", FixedBy: "1.1.1n-0+deb11u4", Severity: database.HighSeverity},
+			},
+		},
+		{Name: "CVE-2023-0001", FeatureName: "zlib1g", Severity: database.LowSeverity},
+	},
+	Misconfigurations: []Misconfiguration{{ID: "DS002", Title: "Image user is root", Description: "The image runs as root.", Severity: database.HighSeverity}},
+	Secrets:           []Secret{{RuleID: "aws-access-key-id", Title: "AWS Access Key ID", Severity: database.CriticalSeverity, Layer: "sha256:0123", Path: "root/.aws/credentials", Line: 2, Match: "AKIA****************"}},
+	AcceptedRisks: []AcceptedRisk{{
+		Vulnerability: Vulnerability{Name: "CVE-2021-3999", FeatureName: "libc6", Severity: database.HighSeverity},
+		Justification: "Not reachable.",
+		Author:        "security@example.com",
+		Expires:       "2027-01-01T00:00:00Z",
+	}},
+	Partial:       true,
+	SkippedLayers: []string{"sha256:4567"},
+}
+
+func TestMarshalMatchesSchema(t *testing.T) {
+	schema, validator := loadSchema(t)
+
+	for _, r := range []ImageResult{testResult, {}} {
+		data, err := json.Marshal(r)
+		if err != nil {
+			t.Fatalf("Marshal() failed: %s", err)
+		}
+		var value interface{}
+		if err := json.Unmarshal(data, &value); err != nil {
+			t.Fatal(err)
+		}
+
+		errs := validator.validate(schema, value, "$")
+		sort.Strings(errs)
+		for _, err := range errs {
+			t.Errorf("the result doesn't match schema.json: %s", err)
+		}
+	}
+
+	// The validator does reject what the schema doesn't describe.
+	for _, invalid := range []string{
+		`{}`,
+		`{"schemaVersion": 2}`,
+		`{"schemaVersion": 1, "Undocumented": true}`,
+		`{"schemaVersion": 1, "Vulnerabilities": [{"Name": "CVE-2022-2097"}]}`,
+		`{"schemaVersion": 1, "Vulnerabilities": [{"Name": "CVE-2022-2097", "FeatureName": "libssl1.1", "Severity": "Severe"}]}`,
+		`{"schemaVersion": 1, "AcceptedRisks": [{"Name": "CVE-2022-2097", "FeatureName": "libssl1.1", "Author": "security@example.com"}]}`,
+	} {
+		var value interface{}
+		if err := json.Unmarshal([]byte(invalid), &value); err != nil {
+			t.Fatal(err)
+		}
+		if errs := validator.validate(schema, value, "$"); len(errs) == 0 {
+			t.Errorf("%s matches schema.json, want it not to", invalid)
+		}
+	}
+}
+
+func TestMarshalRoundTrip(t *testing.T) {
+	schema, _ := loadSchema(t)
+	if version := asObject(asObject(schema["properties"])["schemaVersion"])["const"]; version != float64(SchemaVersion) {
+		t.Errorf("schema.json describes version %v, want SchemaVersion %d", version, SchemaVersion)
+	}
+
+	data, err := json.Marshal(testResult)
+	if err != nil {
+		t.Fatalf("Marshal() failed: %s", err)
+	}
+	var decoded ImageResult
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Unmarshal() failed: %s", err)
+	}
+	if decoded.SchemaVersion != SchemaVersion {
+		t.Errorf("Unmarshal() decoded the version %d, want %d", decoded.SchemaVersion, SchemaVersion)
+	}
+
+	// What was decoded encodes to the same bytes.
+	again, err := json.Marshal(decoded)
+	if err != nil {
+		t.Fatalf("Marshal() failed: %s", err)
+	}
+	if string(again) != string(data) {
+		t.Errorf("Marshal() of the decoded result = %s, want %s", again, data)
+	}
+
+	if err := json.Unmarshal([]byte(fmt.Sprintf(`{"schemaVersion": %d}`, SchemaVersion+1)), &decoded); err != ErrUnsupportedSchemaVersion {
+		t.Errorf("Unmarshal() of a newer version returned %v, want ErrUnsupportedSchemaVersion", err)
+	}
+}
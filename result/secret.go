@@ -0,0 +1,26 @@
+package result
+
+import (
+	"github.com/MXi4oyu/DockerXScan/database"
+)
+
+// Secret is a credential found in a file of a layer of an image, such as an
+// AWS access key or a private key, which is not a vulnerability of its
+// features. A secret deleted by a later layer is still reported, as it can be
+// read from the layer that added it.
+type Secret struct {
+	// RuleID and Title identify the rule that matched, such as
+	// "aws-access-key-id".
+	RuleID   string            `json:"RuleID"`
+	Title    string            `json:"Title"`
+	Severity database.Severity `json:"Severity,omitempty"`
+
+	// Layer is the layer holding the file, and Path the path of the file
+	// from the root of the image, without a leading slash.
+	Layer string `json:"Layer,omitempty"`
+	Path  string `json:"Path"`
+	Line  int    `json:"Line,omitempty"`
+
+	// Match is the text matched, in which the secret itself is masked.
+	Match string `json:"Match,omitempty"`
+}
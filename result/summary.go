@@ -0,0 +1,118 @@
+package result
+
+import (
+	"sort"
+
+	"github.com/MXi4oyu/DockerXScan/database"
+)
+
+// DefaultSummarySize is the number of packages ranked by the Summary encoded
+// along with a result.
+const DefaultSummarySize = 10
+
+// Summary is an overview of the vulnerabilities of a result, telling which
+// packages to upgrade first.
+type Summary struct {
+	// Vulnerabilities and Fixable are the numbers of findings, and of those
+	// having a fixed version, the vulnerabilities suppressed by VEX being
+	// left out.
+	Vulnerabilities int `json:"Vulnerabilities"`
+	Fixable         int `json:"Fixable"`
+
+	// Severities is the number of findings of each severity.
+	Severities map[database.Severity]int `json:"Severities,omitempty"`
+
+	// TopPackages are the most affected packages, the first to upgrade.
+	TopPackages []PackageSummary `json:"TopPackages,omitempty"`
+}
+
+// PackageSummary is the overview of the vulnerabilities of a package.
+type PackageSummary struct {
+	FeatureName    string `json:"FeatureName"`
+	NamespaceName  string `json:"NamespaceName,omitempty"`
+	FeatureVersion string `json:"FeatureVersion,omitempty"`
+
+	Vulnerabilities int               `json:"Vulnerabilities"`
+	Fixable         int               `json:"Fixable"`
+	MaxSeverity     database.Severity `json:"MaxSeverity,omitempty"`
+
+	// FixedVersion is the highest of the versions fixing the vulnerabilities
+	// of the package, if any does.
+	FixedVersion string `json:"FixedVersion,omitempty"`
+}
+
+// Summarize returns the Summary of the result, ranking at most n packages, or
+// all of them if n is not positive. The findings of the merged vulnerabilities
+// count for the package of each.
+//
+// The packages are ranked by the highest severity of their vulnerabilities,
+// then by the number of those having a fixed version, as only these are fixed
+// by an upgrade, and then by the number of their vulnerabilities.
+func (r ImageResult) Summarize(n int) Summary {
+	type key struct {
+		namespace, feature string
+	}
+
+	summary := Summary{Severities: make(map[database.Severity]int)}
+	var keys []key
+	packages := make(map[key]*PackageSummary)
+	formats := make(map[key]string)
+	for _, v := range r.Vulnerabilities {
+		if v.Suppressed != nil {
+			continue
+		}
+
+		for _, f := range v.Findings() {
+			if f.Severity == "" {
+				f.Severity = database.UnknownSeverity
+			}
+
+			k := key{f.NamespaceName, f.FeatureName}
+			p, ok := packages[k]
+			if !ok {
+				p = &PackageSummary{FeatureName: f.FeatureName, NamespaceName: f.NamespaceName, FeatureVersion: f.FeatureVersion, MaxSeverity: f.Severity}
+				packages[k] = p
+				formats[k] = f.VersionFormat
+				keys = append(keys, k)
+			}
+
+			summary.Vulnerabilities++
+			summary.Severities[f.Severity]++
+			p.Vulnerabilities++
+			if p.MaxSeverity.Compare(f.Severity) < 0 {
+				p.MaxSeverity = f.Severity
+			}
+			if f.FixedBy != "" {
+				summary.Fixable++
+				p.Fixable++
+				if p.FixedVersion == "" || higher(f.NamespaceName, formats[k], f.FixedBy, p.FixedVersion) {
+					p.FixedVersion = f.FixedBy
+				}
+			}
+		}
+	}
+
+	ranked := make([]PackageSummary, 0, len(keys))
+	for _, k := range keys {
+		ranked = append(ranked, *packages[k])
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		a, b := ranked[i], ranked[j]
+		if cmp := a.MaxSeverity.Compare(b.MaxSeverity); cmp != 0 {
+			return cmp > 0
+		}
+		if a.Fixable != b.Fixable {
+			return a.Fixable > b.Fixable
+		}
+		if a.Vulnerabilities != b.Vulnerabilities {
+			return a.Vulnerabilities > b.Vulnerabilities
+		}
+		return a.FeatureName < b.FeatureName
+	})
+	if n > 0 && len(ranked) > n {
+		ranked = ranked[:n]
+	}
+	summary.TopPackages = ranked
+
+	return summary
+}
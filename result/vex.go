@@ -0,0 +1,208 @@
+package result
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strings"
+)
+
+// VEXNotAffected is the status of the VEX statements declaring that a
+// vulnerability is not exploitable in a product.
+const VEXNotAffected = "not_affected"
+
+// ErrInvalidVEX is returned when a document is not an OpenVEX document.
+var ErrInvalidVEX = errors.New("result: not an OpenVEX document")
+
+// VEXDocument is an OpenVEX document, stating whether vulnerabilities affect
+// a product.
+type VEXDocument struct {
+	ID         string
+	Statements []VEXStatement
+}
+
+// VEXStatement is the status of a vulnerability in a product. When
+// Subcomponents is not empty, the statement only applies to the features they
+// name.
+type VEXStatement struct {
+	Vulnerability   string
+	Subcomponents   []string
+	Status          string
+	Justification   string
+	ImpactStatement string
+}
+
+// Suppression cites the VEX statement according to which a vulnerability is
+// not exploitable.
+type Suppression struct {
+	Document        string `json:"Document,omitempty"`
+	Justification   string `json:"Justification,omitempty"`
+	ImpactStatement string `json:"ImpactStatement,omitempty"`
+}
+
+// VEXDocuments are the VEX documents that apply to an image, the statements
+// of the latter documents prevailing.
+type VEXDocuments []VEXDocument
+
+type openVEXDocument struct {
+	ID         string `json:"@id"`
+	Statements []struct {
+		Vulnerability   json.RawMessage   `json:"vulnerability"`
+		Products        []json.RawMessage `json:"products"`
+		Subcomponents   []json.RawMessage `json:"subcomponents"`
+		Status          string            `json:"status"`
+		Justification   string            `json:"justification"`
+		ImpactStatement string            `json:"impact_statement"`
+	} `json:"statements"`
+}
+
+// ParseVEX parses an OpenVEX document, which may also be the predicate of an
+// in-toto statement, possibly wrapped in a DSSE envelope.
+func ParseVEX(data []byte) (VEXDocument, error) {
+	var envelope struct {
+		Payload   string          `json:"payload"`
+		Predicate json.RawMessage `json:"predicate"`
+	}
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return VEXDocument{}, ErrInvalidVEX
+	}
+
+	if envelope.Payload != "" {
+		payload, err := base64.StdEncoding.DecodeString(envelope.Payload)
+		if err != nil {
+			return VEXDocument{}, ErrInvalidVEX
+		}
+		return ParseVEX(payload)
+	}
+	if len(envelope.Predicate) > 0 {
+		data = envelope.Predicate
+	}
+
+	var doc openVEXDocument
+	if err := json.Unmarshal(data, &doc); err != nil || doc.Statements == nil {
+		return VEXDocument{}, ErrInvalidVEX
+	}
+
+	vex := VEXDocument{ID: doc.ID}
+	for _, s := range doc.Statements {
+		statement := VEXStatement{
+			Vulnerability:   vexIdentifier(s.Vulnerability, "name"),
+			Status:          s.Status,
+			Justification:   s.Justification,
+			ImpactStatement: s.ImpactStatement,
+		}
+
+		// Subcomponents are listed by products since OpenVEX 0.2.0, and by
+		// the statement before.
+		subcomponents := s.Subcomponents
+		for _, product := range s.Products {
+			var p struct {
+				Subcomponents []json.RawMessage `json:"subcomponents"`
+			}
+			if json.Unmarshal(product, &p) == nil {
+				subcomponents = append(subcomponents, p.Subcomponents...)
+			}
+		}
+		for _, subcomponent := range subcomponents {
+			if id := vexIdentifier(subcomponent, "@id"); id != "" {
+				statement.Subcomponents = append(statement.Subcomponents, id)
+			}
+		}
+
+		if statement.Vulnerability != "" {
+			vex.Statements = append(vex.Statements, statement)
+		}
+	}
+
+	return vex, nil
+}
+
+// vexIdentifier returns an identifier which is either a string, or the field
+// of an object.
+func vexIdentifier(raw json.RawMessage, field string) string {
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return s
+	}
+
+	var object map[string]interface{}
+	if json.Unmarshal(raw, &object) == nil {
+		s, _ = object[field].(string)
+	}
+	return s
+}
+
+// Suppression returns the Suppression of a vulnerability affecting a feature,
+// or nil if the last statement about it doesn't say it is not affected.
+func (docs VEXDocuments) Suppression(vulnerability, feature string) *Suppression {
+	var suppression *Suppression
+	for _, doc := range docs {
+		for _, s := range doc.Statements {
+			if s.Vulnerability != vulnerability || !s.appliesTo(feature) {
+				continue
+			}
+
+			suppression = nil
+			if s.Status == VEXNotAffected {
+				suppression = &Suppression{
+					Document:        doc.ID,
+					Justification:   s.Justification,
+					ImpactStatement: s.ImpactStatement,
+				}
+			}
+		}
+	}
+
+	return suppression
+}
+
+func (s VEXStatement) appliesTo(feature string) bool {
+	if len(s.Subcomponents) == 0 {
+		return true
+	}
+
+	for _, subcomponent := range s.Subcomponents {
+		if purlName(subcomponent) == feature || subcomponent == feature {
+			return true
+		}
+	}
+	return false
+}
+
+// purlName returns the name of the package identified by a package URL, such
+// as "openssl" for "pkg:deb/debian/openssl@1.1.1n-0?arch=amd64".
+func purlName(purl string) string {
+	if !strings.HasPrefix(purl, "pkg:") {
+		return ""
+	}
+
+	for _, sep := range []string{"#", "?", "@"} {
+		if i := strings.Index(purl, sep); i >= 0 {
+			purl = purl[:i]
+		}
+	}
+	name := purl[strings.LastIndex(purl, "/")+1:]
+
+	if unescaped, err := url.PathUnescape(name); err == nil {
+		name = unescaped
+	}
+	return name
+}
+
+// ApplyVEX returns a copy of the result in which the vulnerabilities that the
+// documents declare not affected are marked as suppressed, along with their
+// number.
+func (r ImageResult) ApplyVEX(docs VEXDocuments) (ImageResult, int) {
+	applied := ImageResult{Image: r.Image, DetectedNamespace: r.DetectedNamespace, Libc: r.Libc, Misconfigurations: r.Misconfigurations, Secrets: r.Secrets, AcceptedRisks: r.AcceptedRisks, Partial: r.Partial, SkippedLayers: r.SkippedLayers}
+	suppressed := 0
+	for _, v := range r.Vulnerabilities {
+		v.Suppressed = docs.Suppression(v.Name, v.FeatureName)
+		if v.Suppressed != nil {
+			suppressed++
+		}
+		applied.Vulnerabilities = append(applied.Vulnerabilities, v)
+	}
+
+	return applied, suppressed
+}
@@ -0,0 +1,156 @@
+package secretscan
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"sync"
+
+	"github.com/MXi4oyu/DockerXScan/database"
+)
+
+// secretGroup is the name of the group of the pattern of a Rule matching the
+// secret itself, which is masked in the findings. The whole match is the
+// secret when a pattern has no such group.
+const secretGroup = "secret"
+
+// Rule finds a kind of credential in the content of the files.
+type Rule struct {
+	ID       string
+	Title    string
+	Severity database.Severity
+
+	// Pattern matches the credential, its "secret" group being the part to
+	// mask, such as the value of an assignment.
+	Pattern *regexp.Regexp
+
+	// MinEntropy is the Shannon entropy, in bits per character, below which
+	// a secret is ignored, so that generic patterns skip placeholders such as
+	// "changeme". Zero disables the check.
+	MinEntropy float64
+
+	// ShowMatch makes the findings report the match as is rather than with
+	// the secret masked, for the Rules whose match is not itself a secret,
+	// such as the header of a PEM private key.
+	ShowMatch bool
+}
+
+var (
+	rulesM sync.RWMutex
+	rules  = make(map[string]Rule)
+)
+
+func init() {
+	for _, r := range []Rule{
+		{
+			ID:       "aws-access-key-id",
+			Title:    "AWS access key ID",
+			Severity: database.HighSeverity,
+			Pattern:  regexp.MustCompile(`\b(?P<secret>(?:AKIA|ASIA)[0-9A-Z]{16})\b`),
+		},
+		{
+			ID:       "aws-secret-access-key",
+			Title:    "AWS secret access key",
+			Severity: database.CriticalSeverity,
+			Pattern:  regexp.MustCompile(`(?i)aws_?secret_?access_?key["']?\s*[:=]\s*["']?(?P<secret>[A-Za-z0-9/+]{40})\b`),
+		},
+		{
+			ID:        "private-key",
+			Title:     "Private key",
+			Severity:  database.HighSeverity,
+			Pattern:   regexp.MustCompile(`-----BEGIN (?:RSA |DSA |EC |OPENSSH |PGP |ENCRYPTED )?PRIVATE KEY(?: BLOCK)?-----`),
+			ShowMatch: true,
+		},
+		{
+			ID:       "github-token",
+			Title:    "GitHub token",
+			Severity: database.HighSeverity,
+			Pattern:  regexp.MustCompile(`\b(?P<secret>gh[pousr]_[A-Za-z0-9]{36,255})\b`),
+		},
+		{
+			ID:       "slack-token",
+			Title:    "Slack token",
+			Severity: database.HighSeverity,
+			Pattern:  regexp.MustCompile(`\b(?P<secret>xox[abprs]-[A-Za-z0-9-]{10,250})`),
+		},
+		{
+			ID:         "generic-secret",
+			Title:      "High-entropy secret",
+			Severity:   database.MediumSeverity,
+			Pattern:    regexp.MustCompile(`(?i)(?:api_?key|secret|token|passw(?:or)?d)["']?\s*[:=]\s*["']?(?P<secret>[A-Za-z0-9+/_\-]{20,})`),
+			MinEntropy: 4,
+		},
+	} {
+		RegisterRule(r)
+	}
+}
+
+// RegisterRule makes a Rule available, such as one matching the tokens of an
+// internal service.
+//
+// If called twice with the same ID, or if the Rule has no pattern,
+// RegisterRule panics.
+func RegisterRule(r Rule) {
+	if r.ID == "" {
+		panic("secretscan: could not register a Rule with an empty ID")
+	}
+	if r.Pattern == nil {
+		panic(fmt.Sprintf("secretscan: could not register the Rule %s without a pattern", r.ID))
+	}
+
+	rulesM.Lock()
+	defer rulesM.Unlock()
+
+	if _, dup := rules[r.ID]; dup {
+		panic("secretscan: RegisterRule called twice for " + r.ID)
+	}
+	rules[r.ID] = r
+}
+
+// ListRules returns the IDs of the registered Rules, sorted.
+func ListRules() []string {
+	rulesM.RLock()
+	defer rulesM.RUnlock()
+
+	ids := make([]string, 0, len(rules))
+	for id := range rules {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// sortedRules returns the registered Rules, sorted by ID.
+func sortedRules() []Rule {
+	rulesM.RLock()
+	defer rulesM.RUnlock()
+
+	sorted := make([]Rule, 0, len(rules))
+	for _, r := range rules {
+		sorted = append(sorted, r)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].ID < sorted[j].ID })
+	return sorted
+}
+
+// entropy returns the Shannon entropy of s, in bits per character.
+func entropy(s string) float64 {
+	if s == "" {
+		return 0
+	}
+
+	counts := make(map[rune]int)
+	n := 0
+	for _, c := range s {
+		counts[c]++
+		n++
+	}
+
+	var h float64
+	for _, count := range counts {
+		p := float64(count) / float64(n)
+		h -= p * math.Log2(p)
+	}
+	return h
+}
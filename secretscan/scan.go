@@ -0,0 +1,166 @@
+// Package secretscan finds the credentials left in the files of the layers of
+// images, such as AWS access keys and private keys. Its findings are a
+// category of their own, distinct from the vulnerabilities of the features.
+package secretscan
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/MXi4oyu/DockerXScan/result"
+	"github.com/MXi4oyu/DockerXScan/tarutil"
+)
+
+const (
+	// maxMatchesPerRule is the number of matches of a Rule reported for a
+	// file, as a file of test fixtures may hold many.
+	maxMatchesPerRule = 16
+
+	// maxMatchLength is the length at which the matches reported are cut.
+	maxMatchLength = 120
+
+	// sniffLength is the number of bytes in which a NUL byte makes a file be
+	// skipped as binary.
+	sniffLength = 512
+)
+
+// MaxScannedBytes is the number of bytes of each file that are scanned, the
+// rest of a file being skipped so that big files don't slow the scans down.
+var MaxScannedBytes int64 = 1024 * 1024 // 1 MiB
+
+// ScanLayer returns the secrets found in the regular files of a layer, which
+// may be compressed in any format known by tarutil. The binary files are
+// skipped.
+//
+// If the archive ends unexpectedly, the secrets found until then are returned
+// along with tarutil.ErrTruncatedArchive.
+func ScanLayer(r io.Reader, layer string) ([]result.Secret, error) {
+	tr, err := tarutil.NewTarReadCloser(r)
+	if err != nil {
+		return nil, err
+	}
+	defer tr.Close()
+
+	var secrets []result.Secret
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err == io.ErrUnexpectedEOF {
+			return secrets, tarutil.ErrTruncatedArchive
+		}
+		if err != nil {
+			return secrets, tarutil.ErrCouldNotExtract
+		}
+		if hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeRegA {
+			continue
+		}
+
+		content, err := ioutil.ReadAll(io.LimitReader(tr, MaxScannedBytes))
+		if err == io.ErrUnexpectedEOF {
+			return secrets, tarutil.ErrTruncatedArchive
+		}
+		if err != nil {
+			return secrets, tarutil.ErrCouldNotExtract
+		}
+
+		found := ScanFile(strings.TrimPrefix(path.Clean("/"+hdr.Name), "/"), content)
+		for i := range found {
+			found[i].Layer = layer
+		}
+		secrets = append(secrets, found...)
+	}
+
+	return secrets, nil
+}
+
+// ScanFile returns the secrets found in the content of a file by the
+// registered Rules, unless it is binary. When the matches of several Rules
+// overlap, only the one of the most severe is reported.
+func ScanFile(filename string, content []byte) []result.Secret {
+	sniff := content
+	if len(sniff) > sniffLength {
+		sniff = sniff[:sniffLength]
+	}
+	if bytes.IndexByte(sniff, 0) >= 0 {
+		return nil
+	}
+
+	rules := sortedRules()
+	sort.SliceStable(rules, func(i, j int) bool {
+		return rules[i].Severity.Compare(rules[j].Severity) > 0
+	})
+
+	var secrets []result.Secret
+	var spans [][2]int
+	for _, rule := range rules {
+		group := rule.Pattern.SubexpIndex(secretGroup)
+		for _, m := range rule.Pattern.FindAllSubmatchIndex(content, maxMatchesPerRule) {
+			start, end := m[0], m[1]
+			if group > 0 && m[2*group] >= 0 {
+				start, end = m[2*group], m[2*group+1]
+			}
+			if rule.MinEntropy > 0 && entropy(string(content[start:end])) < rule.MinEntropy {
+				continue
+			}
+			if overlaps(spans, start, end) {
+				continue
+			}
+			spans = append(spans, [2]int{start, end})
+
+			secrets = append(secrets, result.Secret{
+				RuleID:   rule.ID,
+				Title:    rule.Title,
+				Severity: rule.Severity,
+				Path:     filename,
+				Line:     bytes.Count(content[:m[0]], []byte("\n")) + 1,
+				Match:    match(content, m[0], m[1], start, end, !rule.ShowMatch),
+			})
+		}
+	}
+
+	sort.SliceStable(secrets, func(i, j int) bool {
+		return secrets[i].Line < secrets[j].Line
+	})
+	return secrets
+}
+
+// match returns the text matched between from and to, in which the secret
+// between start and end is masked if mask is set.
+func match(content []byte, from, to, start, end int, mask bool) string {
+	text := string(content[from:to])
+	if mask {
+		text = string(content[from:start]) + maskSecret(string(content[start:end])) + string(content[end:to])
+	}
+
+	text = strings.TrimSpace(strings.Replace(text, "\n", " ", -1))
+	if len(text) > maxMatchLength {
+		text = text[:maxMatchLength] + "..."
+	}
+	return text
+}
+
+// maskSecret keeps the first characters of a secret, which usually tell its
+// kind (e.g. AKIA), and replaces the others with asterisks.
+func maskSecret(secret string) string {
+	keep := 4
+	if len(secret) <= 2*keep {
+		keep = 0
+	}
+	return secret[:keep] + strings.Repeat("*", len(secret)-keep)
+}
+
+func overlaps(spans [][2]int, start, end int) bool {
+	for _, s := range spans {
+		if start < s[1] && s[0] < end {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,107 @@
+package sink
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"time"
+)
+
+// defaultFluentdTag is the tag of the records when none is configured.
+const defaultFluentdTag = "dockerxscan.finding"
+
+type fluentdSink struct {
+	conn net.Conn
+	tag  string
+}
+
+func dialFluentd(address, tag string) (*fluentdSink, error) {
+	conn, err := net.DialTimeout("tcp", address, 5*time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	if tag == "" {
+		tag = defaultFluentdTag
+	}
+
+	return &fluentdSink{conn: conn, tag: tag}, nil
+}
+
+// Write sends the records as the entries of a single message of the forward
+// protocol, in its forward mode: [tag, [[time, record], ...]].
+func (s *fluentdSink) Write(records []Record) error {
+	if len(records) == 0 {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	now := time.Now().Unix()
+	writeArrayHeader(&buf, 2)
+	writeString(&buf, s.tag)
+	writeArrayHeader(&buf, len(records))
+	for _, r := range records {
+		writeArrayHeader(&buf, 2)
+		writeInt(&buf, now)
+
+		fields := r.fields()
+		writeMapHeader(&buf, len(fields))
+		for _, f := range fields {
+			writeString(&buf, f[0])
+			writeString(&buf, f[1])
+		}
+	}
+
+	_, err := s.conn.Write(buf.Bytes())
+	return err
+}
+
+func (s *fluentdSink) Close() error {
+	return s.conn.Close()
+}
+
+// The forward protocol is encoded with MessagePack, of which only the types
+// used by the records are implemented.
+
+func writeString(buf *bytes.Buffer, s string) {
+	switch n := len(s); {
+	case n < 32:
+		buf.WriteByte(0xa0 | byte(n))
+	case n < 1<<8:
+		buf.WriteByte(0xd9)
+		buf.WriteByte(byte(n))
+	case n < 1<<16:
+		buf.WriteByte(0xda)
+		binary.Write(buf, binary.BigEndian, uint16(n))
+	default:
+		buf.WriteByte(0xdb)
+		binary.Write(buf, binary.BigEndian, uint32(n))
+	}
+	buf.WriteString(s)
+}
+
+func writeArrayHeader(buf *bytes.Buffer, n int) {
+	writeHeader(buf, n, 0x90, 0xdc, 0xdd)
+}
+
+func writeMapHeader(buf *bytes.Buffer, n int) {
+	writeHeader(buf, n, 0x80, 0xde, 0xdf)
+}
+
+func writeHeader(buf *bytes.Buffer, n int, fix, n16, n32 byte) {
+	switch {
+	case n < 16:
+		buf.WriteByte(fix | byte(n))
+	case n < 1<<16:
+		buf.WriteByte(n16)
+		binary.Write(buf, binary.BigEndian, uint16(n))
+	default:
+		buf.WriteByte(n32)
+		binary.Write(buf, binary.BigEndian, uint32(n))
+	}
+}
+
+func writeInt(buf *bytes.Buffer, i int64) {
+	buf.WriteByte(0xd3)
+	binary.Write(buf, binary.BigEndian, i)
+}
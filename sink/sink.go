@@ -0,0 +1,104 @@
+// Package sink ships the findings of the scans to centralized logging
+// systems, as one structured record per vulnerability found.
+package sink
+
+import (
+	"errors"
+	"net/url"
+
+	"github.com/MXi4oyu/DockerXScan/result"
+)
+
+// ErrUnknownScheme is returned when the URL of a sink has a scheme which is
+// not supported.
+var ErrUnknownScheme = errors.New("sink: unknown scheme, expected syslog+udp, syslog+tcp, syslog+unix or fluentd")
+
+// Record is a finding, as shipped to a sink.
+type Record struct {
+	Image          string
+	ImageDigest    string
+	Vulnerability  string
+	Severity       string
+	Package        string
+	PackageVersion string
+	FixedBy        string
+}
+
+// Records returns the records of the findings of an image, leaving out those
+// suppressed by a VEX statement.
+func Records(r result.ImageResult, digest string) []Record {
+	var records []Record
+	for _, v := range r.Vulnerabilities {
+		if v.Suppressed != nil {
+			continue
+		}
+
+		records = append(records, Record{
+			Image:          r.Image,
+			ImageDigest:    digest,
+			Vulnerability:  v.Name,
+			Severity:       string(v.Severity),
+			Package:        v.FeatureName,
+			PackageVersion: v.FeatureVersion,
+			FixedBy:        v.FixedBy,
+		})
+	}
+
+	return records
+}
+
+// fields returns the fields of a record that are set, in a stable order.
+func (r Record) fields() [][2]string {
+	all := [][2]string{
+		{"image", r.Image},
+		{"digest", r.ImageDigest},
+		{"vulnerability", r.Vulnerability},
+		{"severity", r.Severity},
+		{"package", r.Package},
+		{"version", r.PackageVersion},
+		{"fixedBy", r.FixedBy},
+	}
+
+	var fields [][2]string
+	for _, f := range all {
+		if f[1] != "" {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// Sink is a destination of the records.
+type Sink interface {
+	// Write ships records, in order.
+	Write(records []Record) error
+
+	// Close releases the connection of the sink.
+	Close() error
+}
+
+// Open connects to the sink described by an URL:
+//
+//	syslog+udp://host:514        RFC 5424 messages over UDP
+//	syslog+tcp://host:514        RFC 5424 messages over TCP, octet-counted
+//	syslog+unix:///dev/log       RFC 5424 messages over a datagram socket
+//	fluentd://host:24224?tag=t   the forward protocol of fluentd, tagged t
+func Open(rawurl string) (Sink, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+
+	switch u.Scheme {
+	case "syslog+udp":
+		return dialSyslog("udp", u.Host)
+	case "syslog+tcp":
+		return dialSyslog("tcp", u.Host)
+	case "syslog+unix":
+		return dialSyslog("unixgram", u.Path)
+	case "fluentd":
+		return dialFluentd(u.Host, u.Query().Get("tag"))
+	default:
+		return nil, ErrUnknownScheme
+	}
+}
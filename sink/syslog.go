@@ -0,0 +1,99 @@
+package sink
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/MXi4oyu/DockerXScan/database"
+)
+
+const (
+	syslogAppName = "dockerxscan"
+	syslogMsgID   = "finding"
+
+	// syslogSDID is the ID of the structured data of the records, under the
+	// enterprise number reserved for examples as DockerXScan has none.
+	syslogSDID = "finding@32473"
+
+	// syslogFacility is the "user-level messages" facility.
+	syslogFacility = 1
+)
+
+var sdValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`)
+
+type syslogSink struct {
+	network  string
+	conn     net.Conn
+	hostname string
+}
+
+func dialSyslog(network, address string) (*syslogSink, error) {
+	conn, err := net.DialTimeout(network, address, 5*time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "-"
+	}
+
+	return &syslogSink{network: network, conn: conn, hostname: hostname}, nil
+}
+
+// Write sends a RFC 5424 message per record, whose structured data holds its
+// fields.
+func (s *syslogSink) Write(records []Record) error {
+	for _, r := range records {
+		msg := s.format(r, time.Now())
+
+		// Messages are delimited by their length on streams (RFC 6587), and by
+		// the datagrams otherwise.
+		if s.network == "tcp" {
+			msg = fmt.Sprintf("%d %s", len(msg), msg)
+		}
+		if _, err := s.conn.Write([]byte(msg)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *syslogSink) format(r Record, t time.Time) string {
+	var sd []string
+	for _, f := range r.fields() {
+		sd = append(sd, fmt.Sprintf(`%s="%s"`, f[0], sdValueReplacer.Replace(f[1])))
+	}
+
+	return fmt.Sprintf("<%d>1 %s %s %s %d %s [%s %s] %s in %s %s",
+		syslogFacility*8+syslogSeverity(database.Severity(r.Severity)),
+		t.UTC().Format("2006-01-02T15:04:05.000000Z07:00"),
+		s.hostname, syslogAppName, os.Getpid(), syslogMsgID,
+		syslogSDID, strings.Join(sd, " "),
+		r.Vulnerability, r.Package, r.PackageVersion)
+}
+
+func (s *syslogSink) Close() error {
+	return s.conn.Close()
+}
+
+// syslogSeverity returns the syslog severity of the records of a
+// vulnerability.
+func syslogSeverity(severity database.Severity) int {
+	switch severity {
+	case database.Defcon1Severity, database.CriticalSeverity:
+		return 2
+	case database.HighSeverity:
+		return 3
+	case database.MediumSeverity:
+		return 4
+	case database.LowSeverity:
+		return 5
+	default:
+		return 6
+	}
+}
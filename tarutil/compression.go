@@ -0,0 +1,185 @@
+package tarutil
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"errors"
+	"io"
+	"mime"
+	"strings"
+	"sync"
+)
+
+// blockSize is the size of the blocks of a tar archive, which is enough to
+// sniff any format.
+const blockSize = 512
+
+var (
+	// ErrUnknownFormat occurs when a layer is neither a tar archive nor
+	// compressed in the format of a registered Decompressor.
+	ErrUnknownFormat = errors.New("tarutil: the layer is neither a tar archive nor compressed in a known format")
+
+	decompressorsM sync.RWMutex
+	decompressors  = make(map[string]Decompressor)
+
+	// tarMediaTypes are the media types of the uncompressed layers.
+	tarMediaTypes = []string{
+		"application/x-tar",
+		"application/vnd.oci.image.layer.v1.tar",
+		"application/vnd.oci.image.layer.nondistributable.v1.tar",
+		"application/vnd.docker.image.rootfs.diff.tar",
+	}
+)
+
+// Decompressor is a compression format of the layers.
+type Decompressor struct {
+	// Magic is the prefix of the compressed data.
+	Magic []byte
+
+	// MediaTypes are the media types declaring layers compressed in this
+	// format, such as "application/vnd.oci.image.layer.v1.tar+gzip".
+	MediaTypes []string
+
+	// NewReader returns a reader of the decompressed data. It must be closed
+	// once read when it is an io.Closer.
+	NewReader func(io.Reader) (io.Reader, error)
+}
+
+func init() {
+	RegisterDecompressor("gzip", Decompressor{
+		Magic: []byte{0x1f, 0x8b},
+		MediaTypes: []string{
+			"application/gzip",
+			"application/x-gzip",
+			"application/vnd.docker.image.rootfs.diff.tar.gzip",
+			"application/vnd.docker.image.rootfs.foreign.diff.tar.gzip",
+			"application/vnd.oci.image.layer.v1.tar+gzip",
+			"application/vnd.oci.image.layer.nondistributable.v1.tar+gzip",
+		},
+		NewReader: func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) },
+	})
+	RegisterDecompressor("bzip2", Decompressor{
+		Magic:      []byte{0x42, 0x5a, 0x68},
+		MediaTypes: []string{"application/x-bzip2"},
+		NewReader:  func(r io.Reader) (io.Reader, error) { return bzip2.NewReader(r), nil },
+	})
+	RegisterDecompressor("xz", Decompressor{
+		Magic:      []byte{0xfd, 0x37, 0x7a, 0x58, 0x5a, 0x00},
+		MediaTypes: []string{"application/x-xz"},
+		NewReader:  func(r io.Reader) (io.Reader, error) { return NewXzReader(r) },
+	})
+	RegisterDecompressor("zstd", Decompressor{
+		Magic: []byte{0x28, 0xb5, 0x2f, 0xfd},
+		MediaTypes: []string{
+			"application/zstd",
+			"application/vnd.oci.image.layer.v1.tar+zstd",
+			"application/vnd.oci.image.layer.nondistributable.v1.tar+zstd",
+		},
+		NewReader: func(r io.Reader) (io.Reader, error) { return NewZstdReader(r) },
+	})
+}
+
+// RegisterDecompressor makes a compression format of the layers available by
+// the provided name.
+//
+// If called twice with the same name, the name is blank, or if the provided
+// Decompressor has no magic or reader, this function panics.
+func RegisterDecompressor(name string, d Decompressor) {
+	if name == "" {
+		panic("tarutil: could not register a Decompressor with an empty name")
+	}
+	if len(d.Magic) == 0 || len(d.Magic) > blockSize || d.NewReader == nil {
+		panic("tarutil: could not register an invalid Decompressor " + name)
+	}
+
+	decompressorsM.Lock()
+	defer decompressorsM.Unlock()
+
+	if _, dup := decompressors[name]; dup {
+		panic("tarutil: RegisterDecompressor called twice for " + name)
+	}
+
+	decompressors[name] = d
+}
+
+// DecompressReader returns a reader of the tar archive of a layer, which is
+// decompressed with the Decompressor of its declared media type. When the
+// media type is empty, unknown or does not match the magic numbers of the
+// data, as happens with registries that mislabel their layers, the
+// compression is detected from the magic numbers alone.
+//
+// ErrUnknownFormat is returned when the data is neither compressed in a known
+// format nor a tar archive, rather than feeding it to a tar reader. The
+// returned reader must be closed once read when it is an io.Closer.
+func DecompressReader(mediaType string, r io.Reader) (io.Reader, error) {
+	br := bufio.NewReaderSize(r, blockSize)
+	header, _ := br.Peek(blockSize)
+
+	decompressorsM.RLock()
+	declared, sniffed := "", ""
+	mediaType = normalizeMediaType(mediaType)
+	for name, d := range decompressors {
+		for _, m := range d.MediaTypes {
+			if m == mediaType {
+				declared = name
+			}
+		}
+		if bytes.HasPrefix(header, d.Magic) {
+			sniffed = name
+		}
+	}
+	var d Decompressor
+	switch {
+	case declared != "" && declared == sniffed:
+		d = decompressors[declared]
+	case sniffed != "" && !(isTarMediaType(mediaType) && isTar(header)):
+		d = decompressors[sniffed]
+	}
+	decompressorsM.RUnlock()
+
+	if d.NewReader != nil {
+		return d.NewReader(br)
+	}
+	if len(header) == 0 || isTar(header) {
+		return br, nil
+	}
+	return nil, ErrUnknownFormat
+}
+
+// normalizeMediaType returns a media type without its parameters, in lower
+// case.
+func normalizeMediaType(mediaType string) string {
+	if parsed, _, err := mime.ParseMediaType(mediaType); err == nil {
+		return parsed
+	}
+	return strings.ToLower(strings.TrimSpace(mediaType))
+}
+
+func isTarMediaType(mediaType string) bool {
+	for _, m := range tarMediaTypes {
+		if m == mediaType {
+			return true
+		}
+	}
+	return false
+}
+
+// isTar returns whether the first block of some data is the header of a tar
+// archive, in the ustar format that the POSIX, GNU and PAX formats share, or
+// the end of an empty archive.
+func isTar(header []byte) bool {
+	if len(header) < blockSize {
+		return false
+	}
+	if string(header[257:262]) == "ustar" {
+		return true
+	}
+	for _, b := range header {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -2,14 +2,12 @@ package tarutil
 
 import (
 	"archive/tar"
-	"bufio"
-	"bytes"
-	"compress/bzip2"
-	"compress/gzip"
 	"errors"
 	"io"
 	"io/ioutil"
+	"os"
 	"os/exec"
+	"path"
 	"strings"
 )
 
@@ -17,6 +15,10 @@ var (
 	// ErrCouldNotExtract occurs when an extraction fails.
 	ErrCouldNotExtract = errors.New("tarutil: could not extract the archive")
 
+	// ErrTruncatedArchive occurs when an archive ends unexpectedly. The files
+	// that were entirely read before are still returned.
+	ErrTruncatedArchive = errors.New("tarutil: the archive is truncated")
+
 	// ErrExtractedFileTooBig occurs when a file to extract is too big.
 	ErrExtractedFileTooBig = errors.New("tarutil: could not extract one or more files from the archive: file too big")
 
@@ -25,22 +27,168 @@ var (
 	// may used in an attempt to perform a Denial of Service attack.
 	MaxExtractableFileSize int64 = 200 * 1024 * 1024 // 200 MiB
 
-	readLen     = 6 // max bytes to sniff
-	gzipHeader  = []byte{0x1f, 0x8b}
-	bzip2Header = []byte{0x42, 0x5a, 0x68}
-	xzHeader    = []byte{0xfd, 0x37, 0x7a, 0x58, 0x5a, 0x00}
+	// followSymlinks controls whether the symbolic links of an archive are
+	// followed to find the files to extract, disabled in default.
+	followSymlinks = false
+
+	// maxSymlinkHops is the number of symbolic links that may be followed to
+	// resolve a path, as a protection against loops.
+	maxSymlinkHops = 16
+
+	// MaxNestedDepth is the number of directories under which a file
+	// requested with NestedPrefix may be found, as a protection against
+	// archives made of deeply nested directories.
+	MaxNestedDepth = 8
+
+	// skip tells whether a file to extract is skipped, never in default.
+	skip func(filename string) bool
 )
 
+// NestedPrefix, in front of a filename given to ExtractFiles, requests the
+// file under any directory of the archive as well, such as
+// "opt/rootfs/var/lib/dpkg/status" for "**/var/lib/dpkg/status", at most
+// MaxNestedDepth directories deep.
+//
+// Only the regular files of the archive are extracted that way: a link would
+// otherwise make a file from outside of the nested directory appear in it.
+const NestedPrefix = "**/"
+
 // FilesMap is a map of files' paths to their contents.
 type FilesMap map[string][]byte
 
+// SetFollowSymlinks sets whether ExtractFiles follows the symbolic links of an
+// archive, such as a var/lib/dpkg linked to another directory, to find the
+// files to extract. Following them requires the archive to be read twice, and
+// thus to be copied to a temporary file.
+func SetFollowSymlinks(follow bool) {
+	followSymlinks = follow
+}
+
+// SetSkip sets the function telling whether a file of an archive that is to be
+// extracted is skipped instead, without being read. A nil function skips no
+// file.
+func SetSkip(fn func(filename string) bool) {
+	skip = fn
+}
+
 // ExtractFiles decompresses and extracts only the specified files from an
 // io.Reader representing an archive.
+//
+// If the archive ends unexpectedly, the files read until then are returned
+// along with ErrTruncatedArchive.
+//
+// When symbolic links are followed, a file found through a link is returned
+// under the path it was requested with. Only the links of the archive itself
+// are known, and those pointing outside of it are ignored.
+//
+// When r is a seekable layer, in the eStargz or zstd:chunked format, read
+// from its start, only the files to extract are decompressed.
 func ExtractFiles(r io.Reader, filenames []string) (FilesMap, error) {
+	if ra, size, ok := seekableReader(r); ok {
+		data, extracted, err := extractSeekable(ra, size, filenames)
+		if extracted {
+			return data, err
+		}
+		if _, err := r.(io.Seeker).Seek(0, io.SeekStart); err != nil {
+			return make(map[string][]byte), ErrCouldNotExtract
+		}
+	}
+
+	if !followSymlinks {
+		return extractFiles(r, filenames, nil)
+	}
+
+	// Keep a copy of the archive, in which the targets of the links are looked
+	// for once they are all known.
+	spool, err := ioutil.TempFile("", "tarutil-")
+	if err != nil {
+		return make(map[string][]byte), ErrCouldNotExtract
+	}
+	defer os.Remove(spool.Name())
+	defer spool.Close()
+
+	links := make(map[string]string)
+	tee := io.TeeReader(r, spool)
+	data, err := extractFiles(tee, filenames, links)
+	if err != nil {
+		return data, err
+	}
+	if _, err := io.Copy(ioutil.Discard, tee); err != nil {
+		return data, ErrCouldNotExtract
+	}
+
+	// Map the paths the requested files resolve to, to the requested ones.
+	resolved := make(map[string]string)
+	var targets []string
+	for _, s := range filenames {
+		if strings.HasPrefix(s, NestedPrefix) {
+			continue
+		}
+		if target, ok := resolveSymlinks(s, links); ok && target != s {
+			resolved[target] = s
+			targets = append(targets, target)
+		}
+	}
+	if len(targets) == 0 {
+		return data, nil
+	}
+
+	if _, err := spool.Seek(0, io.SeekStart); err != nil {
+		return data, ErrCouldNotExtract
+	}
+	linked, err := extractFiles(spool, targets, nil)
+	if err != nil {
+		return data, err
+	}
+	for filename, content := range linked {
+		for target, s := range resolved {
+			if !strings.HasPrefix(filename, target) {
+				continue
+			}
+			name := s + strings.TrimPrefix(filename, target)
+			if _, exists := data[name]; !exists {
+				data[name] = content
+			}
+		}
+	}
+
+	return data, nil
+}
+
+// seekableReader returns r as an io.ReaderAt along with its size, if r can be
+// read at any offset and is at its start.
+func seekableReader(r io.Reader) (io.ReaderAt, int64, bool) {
+	ra, ok := r.(io.ReaderAt)
+	if !ok {
+		return nil, 0, false
+	}
+	rs, ok := r.(io.Seeker)
+	if !ok {
+		return nil, 0, false
+	}
+	if offset, err := rs.Seek(0, io.SeekCurrent); err != nil || offset != 0 {
+		return nil, 0, false
+	}
+	size, err := rs.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, 0, false
+	}
+	if _, err := rs.Seek(0, io.SeekStart); err != nil {
+		return nil, 0, false
+	}
+	return ra, size, true
+}
+
+// extractFiles extracts the specified files from an archive, and records its
+// symbolic links into links when it is not nil.
+func extractFiles(r io.Reader, filenames []string, links map[string]string) (FilesMap, error) {
 	data := make(map[string][]byte)
 
 	// Decompress the archive.
 	tr, err := NewTarReadCloser(r)
+	if err == ErrUnknownFormat {
+		return data, err
+	}
 	if err != nil {
 		return data, ErrCouldNotExtract
 	}
@@ -52,6 +200,9 @@ func ExtractFiles(r io.Reader, filenames []string) (FilesMap, error) {
 		if err == io.EOF {
 			break
 		}
+		if err == io.ErrUnexpectedEOF {
+			return data, ErrTruncatedArchive
+		}
 		if err != nil {
 			return data, ErrCouldNotExtract
 		}
@@ -60,16 +211,11 @@ func ExtractFiles(r io.Reader, filenames []string) (FilesMap, error) {
 		filename := hdr.Name
 		filename = strings.TrimPrefix(filename, "./")
 
-		// Determine if we should extract the element
-		toBeExtracted := false
-		for _, s := range filenames {
-			if strings.HasPrefix(filename, s) {
-				toBeExtracted = true
-				break
-			}
+		if links != nil && hdr.Typeflag == tar.TypeSymlink {
+			links[strings.TrimSuffix(filename, "/")] = hdr.Linkname
 		}
 
-		if toBeExtracted {
+		if toBeExtracted(filename, hdr.Typeflag, filenames) {
 			// File size limit
 			if hdr.Size > MaxExtractableFileSize {
 				return data, ErrExtractedFileTooBig
@@ -77,7 +223,14 @@ func ExtractFiles(r io.Reader, filenames []string) (FilesMap, error) {
 
 			// Extract the element
 			if hdr.Typeflag == tar.TypeSymlink || hdr.Typeflag == tar.TypeLink || hdr.Typeflag == tar.TypeReg {
-				d, _ := ioutil.ReadAll(tr)
+				d, err := ioutil.ReadAll(tr)
+				if err == io.ErrUnexpectedEOF {
+					// Drop the partially read file.
+					return data, ErrTruncatedArchive
+				}
+				if err != nil {
+					return data, ErrCouldNotExtract
+				}
 				data[filename] = d
 			}
 		}
@@ -86,6 +239,98 @@ func ExtractFiles(r io.Reader, filenames []string) (FilesMap, error) {
 	return data, nil
 }
 
+// toBeExtracted returns whether an element of an archive is one of the files
+// to extract, and isn't skipped.
+func toBeExtracted(filename string, typeflag byte, filenames []string) bool {
+	extracted := false
+	for _, s := range filenames {
+		if strings.HasPrefix(s, NestedPrefix) {
+			if typeflag == tar.TypeReg && isNested(filename, strings.TrimPrefix(s, NestedPrefix)) {
+				extracted = true
+				break
+			}
+			continue
+		}
+		if strings.HasPrefix(filename, s) {
+			extracted = true
+			break
+		}
+	}
+
+	return extracted && (skip == nil || !skip(filename))
+}
+
+// isNested returns whether a path of an archive is at a path starting with
+// prefix, either at its root or under at most MaxNestedDepth directories. The
+// paths that aren't clean, such as those containing "..", are never nested.
+func isNested(filename, prefix string) bool {
+	if strings.HasPrefix(filename, prefix) {
+		return true
+	}
+	if path.Clean(filename) != strings.TrimSuffix(filename, "/") || strings.HasPrefix(filename, "../") {
+		return false
+	}
+
+	for i, depth := 0, 1; depth <= MaxNestedDepth; depth++ {
+		j := strings.Index(filename[i:], "/")
+		if j < 0 {
+			return false
+		}
+		i += j + 1
+		if strings.HasPrefix(filename[i:], prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// resolveSymlinks returns the path to which a path of an archive resolves,
+// following the given symbolic links. It fails when a link points outside of
+// the archive, as a "../../etc/passwd" or a loop would.
+//
+// Absolute targets are relative to the root of the archive, in which ".." is
+// the root itself as in a chroot.
+func resolveSymlinks(p string, links map[string]string) (string, bool) {
+	// Keep the trailing slash of the paths requesting a directory.
+	var suffix string
+	if strings.HasSuffix(p, "/") {
+		p, suffix = strings.TrimSuffix(p, "/"), "/"
+	}
+
+	for hops := 0; hops <= maxSymlinkHops; {
+		components := strings.Split(p, "/")
+		followed := false
+		for i := range components {
+			current := strings.Join(components[:i+1], "/")
+			target, ok := links[current]
+			if !ok {
+				continue
+			}
+
+			if path.IsAbs(target) {
+				target = strings.TrimPrefix(path.Clean(target), "/")
+			} else {
+				target = path.Join(path.Dir(current), target)
+				if target == ".." || strings.HasPrefix(target, "../") {
+					return "", false
+				}
+			}
+
+			p = path.Join(append([]string{target}, components[i+1:]...)...)
+			hops++
+			followed = true
+			break
+		}
+
+		if !followed {
+			return p + suffix, true
+		}
+	}
+
+	return "", false
+}
+
 // XzReader implements io.ReadCloser for data compressed via `xz`.
 type XzReader struct {
 	io.ReadCloser
@@ -98,12 +343,56 @@ type XzReader struct {
 //
 // It is the caller's responsibility to call Close on the XzReader when done.
 func NewXzReader(r io.Reader) (*XzReader, error) {
-	rpipe, wpipe := io.Pipe()
-	ex, err := exec.LookPath("xz")
+	rc, cmd, closech, err := runDecompressor(r, "xz", "--decompress", "--stdout")
+	if err != nil {
+		return nil, err
+	}
+	return &XzReader{rc, cmd, closech}, nil
+}
+
+// Close cleans up the resources used by an XzReader.
+func (r *XzReader) Close() error {
+	r.ReadCloser.Close()
+	r.cmd.Process.Kill()
+	return <-r.closech
+}
+
+// ZstdReader implements io.ReadCloser for data compressed via `zstd`.
+type ZstdReader struct {
+	io.ReadCloser
+	cmd     *exec.Cmd
+	closech chan error
+}
+
+// NewZstdReader returns an io.ReadCloser by executing a command line `zstd`
+// executable to decompress the provided io.Reader.
+//
+// It is the caller's responsibility to call Close on the ZstdReader when done.
+func NewZstdReader(r io.Reader) (*ZstdReader, error) {
+	rc, cmd, closech, err := runDecompressor(r, "zstd", "--decompress", "--stdout")
 	if err != nil {
 		return nil, err
 	}
-	cmd := exec.Command(ex, "--decompress", "--stdout")
+	return &ZstdReader{rc, cmd, closech}, nil
+}
+
+// Close cleans up the resources used by a ZstdReader.
+func (r *ZstdReader) Close() error {
+	r.ReadCloser.Close()
+	r.cmd.Process.Kill()
+	return <-r.closech
+}
+
+// runDecompressor runs a decompression command with r as its standard input,
+// and returns a reader of its standard output along with the channel its
+// result is sent on once it exits.
+func runDecompressor(r io.Reader, name string, args ...string) (io.ReadCloser, *exec.Cmd, chan error, error) {
+	rpipe, wpipe := io.Pipe()
+	ex, err := exec.LookPath(name)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	cmd := exec.Command(ex, args...)
 
 	closech := make(chan error)
 
@@ -116,14 +405,7 @@ func NewXzReader(r io.Reader) (*XzReader, error) {
 		closech <- err
 	}()
 
-	return &XzReader{rpipe, cmd, closech}, nil
-}
-
-// Close cleans up the resources used by an XzReader.
-func (r *XzReader) Close() error {
-	r.ReadCloser.Close()
-	r.cmd.Process.Kill()
-	return <-r.closech
+	return rpipe, cmd, closech, nil
 }
 
 // TarReadCloser embeds a *tar.Reader and the related io.Closer
@@ -143,33 +425,17 @@ func (r *TarReadCloser) Close() error {
 // io.Reader and returns a TarReadCloser wrapping the Reader to transparently
 // decompress the contents.
 //
-// Gzip/Bzip2/XZ detection is done by using the magic numbers:
-// Gzip: the first two bytes should be 0x1f and 0x8b. Defined in the RFC1952.
-// Bzip2: the first three bytes should be 0x42, 0x5a and 0x68. No RFC.
-// XZ: the first three bytes should be 0xfd, 0x37, 0x7a, 0x58, 0x5a, 0x00. No RFC.
+// The compression is detected by DecompressReader from the magic numbers of
+// the registered Decompressors, and ErrUnknownFormat is returned when the
+// Reader is neither compressed in one of their formats nor a tar archive.
 func NewTarReadCloser(r io.Reader) (*TarReadCloser, error) {
-	br := bufio.NewReader(r)
-	header, err := br.Peek(readLen)
-	if err == nil {
-		switch {
-		case bytes.HasPrefix(header, gzipHeader):
-			gr, err := gzip.NewReader(br)
-			if err != nil {
-				return nil, err
-			}
-			return &TarReadCloser{tar.NewReader(gr), gr}, nil
-		case bytes.HasPrefix(header, bzip2Header):
-			bzip2r := ioutil.NopCloser(bzip2.NewReader(br))
-			return &TarReadCloser{tar.NewReader(bzip2r), bzip2r}, nil
-		case bytes.HasPrefix(header, xzHeader):
-			xzr, err := NewXzReader(br)
-			if err != nil {
-				return nil, err
-			}
-			return &TarReadCloser{tar.NewReader(xzr), xzr}, nil
-		}
+	dr, err := DecompressReader("", r)
+	if err != nil {
+		return nil, err
 	}
 
-	dr := ioutil.NopCloser(br)
-	return &TarReadCloser{tar.NewReader(dr), dr}, nil
-}
\ No newline at end of file
+	if closer, ok := dr.(io.ReadCloser); ok {
+		return &TarReadCloser{tar.NewReader(closer), closer}, nil
+	}
+	return &TarReadCloser{tar.NewReader(dr), ioutil.NopCloser(dr)}, nil
+}
@@ -0,0 +1,171 @@
+package tarutil
+
+import (
+	"archive/tar"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// buildTar returns a tar archive of the given files, in order, along with the
+// offset at which the content of each of them starts.
+func buildTar(t *testing.T, files ...[2]string) ([]byte, []int) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	var offsets []int
+	for _, f := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: f[0], Mode: 0644, Size: int64(len(f[1])), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		tw.Flush()
+		offsets = append(offsets, buf.Len())
+		if _, err := tw.Write([]byte(f[1])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes(), offsets
+}
+
+func TestExtractFilesTruncated(t *testing.T) {
+	osRelease := "ID=debian\nVERSION_ID=11\n"
+	status := strings.Repeat("Package: libc6\nVersion: 2.31-13\n\n", 200)
+	archive, offsets := buildTar(t, [2]string{"etc/os-release", osRelease}, [2]string{"var/lib/dpkg/status", status})
+	filenames := []string{"etc/os-release", "var/lib/dpkg/status"}
+
+	tests := []struct {
+		name string
+		size int
+	}{
+		// The archive ends within the content of the status file.
+		{"within a file", offsets[1] + len(status)/2},
+		// The archive ends within the header of the status file.
+		{"within a header", offsets[1] - 256},
+	}
+
+	for _, test := range tests {
+		files, err := ExtractFiles(bytes.NewReader(archive[:test.size]), filenames)
+		if err != ErrTruncatedArchive {
+			t.Errorf("%s: ExtractFiles() returned %v, want ErrTruncatedArchive", test.name, err)
+		}
+		if string(files["etc/os-release"]) != osRelease {
+			t.Errorf("%s: ExtractFiles() read etc/os-release as %q, want %q", test.name, files["etc/os-release"], osRelease)
+		}
+		if _, ok := files["var/lib/dpkg/status"]; ok {
+			t.Errorf("%s: ExtractFiles() returned the partially read var/lib/dpkg/status", test.name)
+		}
+	}
+
+	// The whole archive is extracted as usual.
+	files, err := ExtractFiles(bytes.NewReader(archive), filenames)
+	if err != nil {
+		t.Fatalf("ExtractFiles() failed: %s", err)
+	}
+	if string(files["var/lib/dpkg/status"]) != status {
+		t.Errorf("ExtractFiles() did not read var/lib/dpkg/status entirely")
+	}
+}
+
+// entry is an element of an archive built by buildLayer: a symbolic link to
+// link if it is set, or a regular file of content otherwise.
+type entry struct {
+	name, content, link string
+}
+
+func buildLayer(t *testing.T, entries ...entry) []byte {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Mode: 0644, Size: int64(len(e.content)), Typeflag: tar.TypeReg}
+		if e.link != "" {
+			hdr = &tar.Header{Name: e.name, Mode: 0777, Linkname: e.link, Typeflag: tar.TypeSymlink}
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(e.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestExtractFilesFollowSymlinks(t *testing.T) {
+	defer SetFollowSymlinks(false)
+
+	status := "Package: libc6\nStatus: install ok installed\nVersion: 2.31-13\n"
+	tests := []struct {
+		name    string
+		entries []entry
+		follow  bool
+		want    bool
+	}{
+		{
+			name:    "relative link",
+			entries: []entry{{name: "var/lib/dpkg", link: "../../usr/share/dpkg"}, {name: "usr/share/dpkg/status", content: status}},
+			follow:  true,
+			want:    true,
+		},
+		{
+			name:    "absolute link",
+			entries: []entry{{name: "var/lib/dpkg", link: "/usr/share/dpkg"}, {name: "usr/share/dpkg/status", content: status}},
+			follow:  true,
+			want:    true,
+		},
+		{
+			// The link is only known once the whole archive has been read.
+			name:    "link after its target",
+			entries: []entry{{name: "usr/share/dpkg/status", content: status}, {name: "var/lib/dpkg", link: "../../usr/share/dpkg"}},
+			follow:  true,
+			want:    true,
+		},
+		{
+			name:    "chained links",
+			entries: []entry{{name: "var/lib", link: "/usr/lib"}, {name: "usr/lib/dpkg", link: "../share/dpkg"}, {name: "usr/share/dpkg/status", content: status}},
+			follow:  true,
+			want:    true,
+		},
+		{
+			// Resolved from the root of the archive, ../dpkg escapes it and
+			// must not be read as the dpkg directory at its root.
+			name:    "escape attempt",
+			entries: []entry{{name: "var/lib/dpkg", link: "../../../dpkg"}, {name: "dpkg/status", content: status}},
+			follow:  true,
+			want:    false,
+		},
+		{
+			name:    "loop",
+			entries: []entry{{name: "var/lib/dpkg", link: "dpkg2"}, {name: "var/lib/dpkg2", link: "dpkg"}},
+			follow:  true,
+			want:    false,
+		},
+		{
+			name:    "links not followed",
+			entries: []entry{{name: "var/lib/dpkg", link: "../../usr/share/dpkg"}, {name: "usr/share/dpkg/status", content: status}},
+			follow:  false,
+			want:    false,
+		},
+	}
+
+	for _, test := range tests {
+		SetFollowSymlinks(test.follow)
+		files, err := ExtractFiles(bytes.NewReader(buildLayer(t, test.entries...)), []string{"var/lib/dpkg/status"})
+		if err != nil {
+			t.Errorf("%s: ExtractFiles() failed: %s", test.name, err)
+			continue
+		}
+
+		content, ok := files["var/lib/dpkg/status"]
+		if ok != test.want || (ok && string(content) != status) {
+			t.Errorf("%s: ExtractFiles() returned var/lib/dpkg/status %q (%t), want it found: %t", test.name, content, ok, test.want)
+		}
+		if len(files) > 1 || (len(files) == 1 && !ok) {
+			t.Errorf("%s: ExtractFiles() returned other files than var/lib/dpkg/status: %d files", test.name, len(files))
+		}
+	}
+}
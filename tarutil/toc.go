@@ -0,0 +1,351 @@
+package tarutil
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// The seekable formats of the layers, whose table of contents locates the
+// compressed data of each of their files.
+const (
+	// FormatEstargz is an eStargz or a legacy stargz layer, a gzipped tar
+	// archive in which each file is compressed in its own gzip member.
+	FormatEstargz = "estargz"
+
+	// FormatZstdChunked is a zstd:chunked layer, a zstd compressed tar archive
+	// in which each file is compressed in its own zstd frame.
+	FormatZstdChunked = "zstd:chunked"
+)
+
+const (
+	// The footers of eStargz and of the legacy stargz: a gzip member holding
+	// the offset of the table of contents in an extra field.
+	estargzFooterSize       = 51
+	legacyStargzFooterSize  = 47
+	estargzTOCName          = "stargz.index.json"
+	stargzFooterSubfieldLen = 16 + len("STARGZ")
+
+	// The footer of zstd:chunked: a skippable frame holding the offset of the
+	// table of contents.
+	zstdChunkedFooterSize     = 8 + 64
+	zstdChunkedManifestTypeV1 = 1
+
+	// maxTOCSize is the size up to which a table of contents is read, as a
+	// protection against layers declaring huge ones.
+	maxTOCSize = 64 * 1024 * 1024
+)
+
+var (
+	zstdSkippableFrameMagic = []byte{0x50, 0x2a, 0x4d, 0x18}
+	zstdChunkedFrameMagic   = []byte("GNUlInUx")
+
+	errInvalidTOC = errors.New("tarutil: invalid table of contents")
+)
+
+// toc is the table of contents of a seekable layer, whose entries eStargz and
+// zstd:chunked describe alike.
+type toc struct {
+	format  string
+	Entries []tocEntry `json:"entries"`
+}
+
+// tocEntry is an entry of a table of contents: a file of the archive, or a
+// chunk of the regular file preceding it. Offset is where the compressed data
+// of a regular file or a chunk starts in the layer, and EndOffset where it
+// ends for zstd:chunked.
+type tocEntry struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Size        int64  `json:"size"`
+	LinkName    string `json:"linkName"`
+	Offset      int64  `json:"offset"`
+	EndOffset   int64  `json:"endOffset"`
+	ChunkOffset int64  `json:"chunkOffset"`
+	ChunkSize   int64  `json:"chunkSize"`
+}
+
+// SeekableFormat returns the seekable format of a layer of the given size,
+// FormatEstargz or FormatZstdChunked, as its footer tells. A layer in any
+// other format has to be decompressed as a whole.
+func SeekableFormat(r io.ReaderAt, size int64) (string, bool) {
+	if _, _, ok := zstdChunkedFooter(r, size); ok {
+		return FormatZstdChunked, true
+	}
+	if _, _, ok := estargzFooter(r, size); ok {
+		return FormatEstargz, true
+	}
+	return "", false
+}
+
+// extractSeekable extracts the files of a seekable layer as ExtractFiles
+// does, only decompressing the regular files to extract, which its table of
+// contents locates. It returns false when the layer is not seekable, or when
+// its table of contents is unusable, in which case the layer is to be
+// extracted as a whole.
+func extractSeekable(r io.ReaderAt, size int64, filenames []string) (FilesMap, bool, error) {
+	t, err := readTOC(r, size)
+	if err != nil {
+		log.WithError(err).Warning("could not read the table of contents of the layer, decompressing it as a whole")
+		return nil, false, nil
+	}
+	if t == nil {
+		return nil, false, nil
+	}
+
+	// The files are fetched where the links followed to the requested ones
+	// lead too.
+	fetched := filenames
+	if followSymlinks {
+		links := make(map[string]string)
+		for _, e := range t.Entries {
+			if e.Type == "symlink" {
+				links[strings.TrimSuffix(tocName(e.Name), "/")] = e.LinkName
+			}
+		}
+		for _, s := range filenames {
+			if strings.HasPrefix(s, NestedPrefix) {
+				continue
+			}
+			if target, ok := resolveSymlinks(s, links); ok && target != s {
+				fetched = append(fetched, target)
+			}
+		}
+	}
+
+	// The tar archive of the links and of the fetched files is extracted as
+	// any other.
+	pr, pw := io.Pipe()
+	writeErr := make(chan error, 1)
+	go func() {
+		err := t.writeTar(pw, r, size, fetched)
+		pw.CloseWithError(err)
+		writeErr <- err
+	}()
+	files, err := ExtractFiles(pr, filenames)
+	pr.Close()
+	if werr := <-writeErr; werr != nil && werr != io.ErrClosedPipe {
+		log.WithError(werr).WithField("format", t.format).Warning("could not read the files of the layer from its table of contents, decompressing it as a whole")
+		return nil, false, nil
+	}
+
+	return files, true, err
+}
+
+// writeTar writes a tar archive of the links of the layer and of the regular
+// files to fetch among filenames.
+func (t *toc) writeTar(w io.Writer, r io.ReaderAt, size int64, filenames []string) error {
+	tw := tar.NewWriter(w)
+	for i, e := range t.Entries {
+		hdr := &tar.Header{Name: tocName(e.Name), Linkname: e.LinkName, Mode: 0644, ModTime: time.Unix(0, 0)}
+		switch e.Type {
+		case "symlink":
+			hdr.Typeflag = tar.TypeSymlink
+		case "hardlink":
+			hdr.Typeflag = tar.TypeLink
+		case "reg":
+			if !toBeExtracted(hdr.Name, tar.TypeReg, filenames) {
+				continue
+			}
+			hdr.Typeflag, hdr.Size = tar.TypeReg, e.Size
+		default:
+			continue
+		}
+
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg || e.Size == 0 {
+			continue
+		}
+
+		// The regular file is followed by the chunks of its content.
+		for j := i; j < len(t.Entries); j++ {
+			c := t.Entries[j]
+			if j > i && (c.Type != "chunk" || c.Name != e.Name) {
+				break
+			}
+			if err := t.copyChunk(tw, r, size, e, c); err != nil {
+				return err
+			}
+		}
+	}
+	return tw.Close()
+}
+
+// copyChunk decompresses a chunk of a regular file into w.
+func (t *toc) copyChunk(w io.Writer, r io.ReaderAt, size int64, file, c tocEntry) error {
+	n := c.ChunkSize
+	if n == 0 {
+		n = file.Size - c.ChunkOffset
+	}
+	if c.Offset <= 0 || c.Offset >= size || c.ChunkOffset < 0 || n <= 0 || c.ChunkOffset+n > file.Size {
+		return errInvalidTOC
+	}
+
+	var dr io.Reader
+	switch t.format {
+	case FormatZstdChunked:
+		if c.EndOffset <= c.Offset || c.EndOffset > size {
+			return errInvalidTOC
+		}
+		zr, err := NewZstdReader(io.NewSectionReader(r, c.Offset, c.EndOffset-c.Offset))
+		if err != nil {
+			return err
+		}
+		// The decompressor is stopped once the chunk is read.
+		defer zr.Close()
+		dr = zr
+	default:
+		gr, err := gzip.NewReader(io.NewSectionReader(r, c.Offset, size-c.Offset))
+		if err != nil {
+			return err
+		}
+		defer gr.Close()
+		dr = gr
+	}
+
+	if _, err := io.CopyN(w, dr, n); err != nil {
+		if err == io.EOF {
+			return errInvalidTOC
+		}
+		return err
+	}
+	return nil
+}
+
+// readTOC reads the table of contents of a seekable layer, or returns nil if
+// the layer isn't seekable.
+func readTOC(r io.ReaderAt, size int64) (*toc, error) {
+	if footer, offset, ok := zstdChunkedFooter(r, size); ok {
+		return readZstdChunkedTOC(r, size, footer, offset)
+	}
+	if offset, footerSize, ok := estargzFooter(r, size); ok {
+		return readEstargzTOC(r, size-int64(footerSize), offset)
+	}
+	return nil, nil
+}
+
+// zstdChunkedFooter returns the data of the footer of a zstd:chunked layer
+// and the offset of its table of contents.
+func zstdChunkedFooter(r io.ReaderAt, size int64) ([]byte, int64, bool) {
+	if size < zstdChunkedFooterSize {
+		return nil, 0, false
+	}
+	footer := make([]byte, zstdChunkedFooterSize)
+	if _, err := r.ReadAt(footer, size-zstdChunkedFooterSize); err != nil {
+		return nil, 0, false
+	}
+	if !bytes.Equal(footer[:4], zstdSkippableFrameMagic) || binary.LittleEndian.Uint32(footer[4:8]) != 64 || !bytes.Equal(footer[64:], zstdChunkedFrameMagic) {
+		return nil, 0, false
+	}
+	return footer[8:], int64(binary.LittleEndian.Uint64(footer[8:])), true
+}
+
+// readZstdChunkedTOC reads the table of contents of a zstd:chunked layer: a
+// zstd frame at offset, whose compressed and uncompressed lengths are in the
+// footer along with its type.
+func readZstdChunkedTOC(r io.ReaderAt, size int64, footer []byte, offset int64) (*toc, error) {
+	length := int64(binary.LittleEndian.Uint64(footer[8:]))
+	uncompressedLength := int64(binary.LittleEndian.Uint64(footer[16:]))
+	if manifestType := binary.LittleEndian.Uint64(footer[24:]); manifestType != zstdChunkedManifestTypeV1 {
+		return nil, fmt.Errorf("tarutil: unsupported zstd:chunked manifest type %d", manifestType)
+	}
+	if offset <= 0 || length <= 0 || offset+length > size-zstdChunkedFooterSize || uncompressedLength <= 0 || uncompressedLength > maxTOCSize {
+		return nil, errInvalidTOC
+	}
+
+	zr, err := NewZstdReader(io.NewSectionReader(r, offset, length))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	return decodeTOC(io.LimitReader(zr, uncompressedLength), FormatZstdChunked)
+}
+
+// estargzFooter returns the offset of the table of contents of an eStargz or
+// legacy stargz layer, and the size of its footer.
+func estargzFooter(r io.ReaderAt, size int64) (int64, int, bool) {
+	for _, footerSize := range []int{estargzFooterSize, legacyStargzFooterSize} {
+		if size < int64(footerSize) {
+			continue
+		}
+		footer := make([]byte, footerSize)
+		if _, err := r.ReadAt(footer, size-int64(footerSize)); err != nil {
+			continue
+		}
+		gr, err := gzip.NewReader(bytes.NewReader(footer))
+		if err != nil {
+			continue
+		}
+
+		// eStargz wraps the subfield in an "SG" extra field, which the legacy
+		// stargz did not.
+		extra := gr.Header.Extra
+		if footerSize == estargzFooterSize {
+			if len(extra) != 4+stargzFooterSubfieldLen || extra[0] != 'S' || extra[1] != 'G' || int(binary.LittleEndian.Uint16(extra[2:4])) != stargzFooterSubfieldLen {
+				continue
+			}
+			extra = extra[4:]
+		}
+		if len(extra) != stargzFooterSubfieldLen || !bytes.HasSuffix(extra, []byte("STARGZ")) {
+			continue
+		}
+		offset, err := strconv.ParseInt(string(extra[:16]), 16, 64)
+		if err != nil {
+			continue
+		}
+		return offset, footerSize, true
+	}
+	return 0, 0, false
+}
+
+// readEstargzTOC reads the table of contents of an eStargz layer: the only
+// file of a gzipped tar archive starting at offset and ending at end.
+func readEstargzTOC(r io.ReaderAt, end, offset int64) (*toc, error) {
+	if offset <= 0 || offset >= end {
+		return nil, errInvalidTOC
+	}
+
+	gr, err := gzip.NewReader(io.NewSectionReader(r, offset, end-offset))
+	if err != nil {
+		return nil, err
+	}
+	defer gr.Close()
+
+	tr := tar.NewReader(gr)
+	hdr, err := tr.Next()
+	if err != nil {
+		return nil, err
+	}
+	if hdr.Name != estargzTOCName || hdr.Size > maxTOCSize {
+		return nil, errInvalidTOC
+	}
+
+	return decodeTOC(tr, FormatEstargz)
+}
+
+func decodeTOC(r io.Reader, format string) (*toc, error) {
+	t := toc{format: format}
+	if err := json.NewDecoder(io.LimitReader(r, maxTOCSize)).Decode(&t); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// tocName returns the path of an entry of a table of contents, as a tar
+// archive names it.
+func tocName(name string) string {
+	return strings.TrimPrefix(strings.TrimPrefix(name, "./"), "/")
+}
@@ -0,0 +1,62 @@
+package updater
+
+import (
+	"errors"
+	"sync"
+)
+
+// errNegativeConcurrency is returned by Configure when the maximum number of
+// updaters fetching at once is negative.
+var errNegativeConcurrency = errors.New("updater: the maximum concurrency must not be negative")
+
+// FetchConcurrency is the number of updaters fetching and parsing their feeds
+// at the moment, of those waiting for a slot to do so, and the maximum number
+// allowed to run at once, zero meaning no limit.
+type FetchConcurrency struct {
+	Running int
+	Queued  int
+	Limit   int
+}
+
+var (
+	fetchM sync.Mutex
+	// fetchCond is signaled whenever a slot is freed or the limit changes.
+	fetchCond        = sync.NewCond(&fetchM)
+	fetchConcurrency FetchConcurrency
+)
+
+// setMaxConcurrency sets how many updaters may fetch at once, the others
+// waiting for a slot to be freed. Zero means no limit.
+func setMaxConcurrency(max int) {
+	fetchM.Lock()
+	fetchConcurrency.Limit = max
+	fetchM.Unlock()
+	fetchCond.Broadcast()
+}
+
+// CurrentConcurrency returns how many updaters are fetching and waiting to.
+func CurrentConcurrency() FetchConcurrency {
+	fetchM.Lock()
+	defer fetchM.Unlock()
+	return fetchConcurrency
+}
+
+// acquireFetchSlot waits until an updater may fetch, and returns the function
+// releasing its slot once it is done.
+func acquireFetchSlot() (release func()) {
+	fetchM.Lock()
+	fetchConcurrency.Queued++
+	for fetchConcurrency.Limit > 0 && fetchConcurrency.Running >= fetchConcurrency.Limit {
+		fetchCond.Wait()
+	}
+	fetchConcurrency.Queued--
+	fetchConcurrency.Running++
+	fetchM.Unlock()
+
+	return func() {
+		fetchM.Lock()
+		fetchConcurrency.Running--
+		fetchM.Unlock()
+		fetchCond.Signal()
+	}
+}
@@ -0,0 +1,106 @@
+package updater
+
+import (
+	log "github.com/sirupsen/logrus"
+
+	"github.com/MXi4oyu/DockerXScan/database"
+	"github.com/MXi4oyu/DockerXScan/vulnmdsrc"
+)
+
+// enrichPageSize is the number of stored vulnerabilities read at once while
+// enriching them.
+const enrichPageSize = 1000
+
+// enrich fills the metadata and the severity missing from the stored
+// vulnerabilities using the registered Appenders, which only works on the
+// vulnerabilities fetched during an update otherwise.
+//
+// A known severity, such as the one provided by a distribution, is never
+// overwritten, and metadata is only added under the keys that are absent.
+func enrich(datastore database.Datastore) {
+	appenders := make(map[string]vulnmdsrc.Appender)
+	for name, appender := range vulnmdsrc.Appenders() {
+		if err := appender.BuildCache(datastore); err != nil {
+			promUpdaterErrorsTotal.Inc()
+			log.WithError(err).WithField("appender name", name).Error("an error occured when loading metadata fetcher")
+			continue
+		}
+		appenders[name] = appender
+	}
+	if len(appenders) == 0 {
+		return
+	}
+	defer func() {
+		for _, appender := range appenders {
+			appender.PurgeCache()
+		}
+	}()
+
+	log.Info("enriching stored vulnerabilities")
+
+	namespaces, err := datastore.ListNamespaces()
+	if err != nil {
+		promUpdaterErrorsTotal.Inc()
+		log.WithError(err).Error("an error occured when listing namespaces for enrichment")
+		return
+	}
+
+	var enriched int
+	for _, namespace := range namespaces {
+		for startID := 0; startID != -1; {
+			vulnerabilities, nextID, err := datastore.ListVulnerabilities(namespace.Name, enrichPageSize, startID)
+			if err != nil {
+				promUpdaterErrorsTotal.Inc()
+				log.WithError(err).WithField("namespace", namespace.Name).Error("an error occured when listing vulnerabilities for enrichment")
+				break
+			}
+			startID = nextID
+
+			var updated []database.Vulnerability
+			for _, vulnerability := range vulnerabilities {
+				if enrichVulnerability(&vulnerability, appenders) {
+					updated = append(updated, vulnerability)
+				}
+			}
+			if len(updated) == 0 {
+				continue
+			}
+
+			// The FixedIn of the updated vulnerabilities are left empty, so that
+			// the stored ones are kept. Filling a gap doesn't deserve a
+			// notification.
+			if err := datastore.InsertVulnerabilities(updated, false); err != nil {
+				promUpdaterErrorsTotal.Inc()
+				log.WithError(err).WithField("namespace", namespace.Name).Error("an error occured when inserting enriched vulnerabilities")
+				break
+			}
+			enriched += len(updated)
+		}
+	}
+
+	log.WithField("count", enriched).Info("enriched stored vulnerabilities")
+}
+
+// enrichVulnerability adds the metadata that the Appenders have and the
+// vulnerability lacks, and returns whether it changed.
+func enrichVulnerability(vulnerability *database.Vulnerability, appenders map[string]vulnmdsrc.Appender) bool {
+	var changed bool
+	for _, appender := range appenders {
+		appender.Append(vulnerability.Name, func(metadataKey string, metadata interface{}, severity database.Severity) {
+			if _, exists := vulnerability.Metadata[metadataKey]; !exists {
+				if vulnerability.Metadata == nil {
+					vulnerability.Metadata = make(map[string]interface{})
+				}
+				vulnerability.Metadata[metadataKey] = metadata
+				changed = true
+			}
+
+			if vulnerability.Severity == database.UnknownSeverity && severity != database.UnknownSeverity {
+				vulnerability.Severity = severity
+				changed = true
+			}
+		})
+	}
+
+	return changed
+}
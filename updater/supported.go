@@ -0,0 +1,92 @@
+package updater
+
+import (
+	"time"
+
+	"github.com/MXi4oyu/DockerXScan/database"
+	"github.com/MXi4oyu/DockerXScan/featurefmt"
+	"github.com/MXi4oyu/DockerXScan/featurens"
+	"github.com/MXi4oyu/DockerXScan/vulnsrc"
+)
+
+// NamespaceSupport describes how an OS flavor is supported by this build.
+type NamespaceSupport struct {
+	// Name is the prefix of the names of the namespaces of the flavor, such
+	// as "debian" for "debian:9".
+	Name string
+
+	// Detectors are the names of the Detectors that recognize the flavor,
+	// and DetectorEnabled whether one of them is compiled in.
+	Detectors       []string
+	DetectorEnabled bool
+
+	// Lister is the name of the Lister of the packages of the flavor, and
+	// ListerEnabled whether it is compiled in and allowed by the enabled and
+	// disabled listers of the worker configuration.
+	Lister        string
+	ListerEnabled bool
+
+	// Updater is the name of the Updater fetching the vulnerabilities of the
+	// flavor, and UpdaterEnabled whether it is compiled in.
+	Updater        string
+	UpdaterEnabled bool
+
+	// LastUpdate is the time of the last successful fetch of the Updater, or
+	// the zero time if it has never succeeded.
+	LastUpdate time.Time
+}
+
+// Supported returns whether the layers of the flavor can be scanned: their
+// namespace is detected, their packages listed and their vulnerabilities
+// fetched.
+func (s NamespaceSupport) Supported() bool {
+	return s.DetectorEnabled && s.ListerEnabled && s.UpdaterEnabled
+}
+
+// osFlavors are the OS flavors known by the Detectors, Listers and Updaters of
+// the tree, which a build may not all compile in.
+var osFlavors = []NamespaceSupport{
+	{Name: "alpine", Detectors: []string{"alpine-release"}, Lister: "apk", Updater: "alpine"},
+	{Name: "centos", Detectors: []string{"redhat-release", "os-release"}, Lister: "rpm", Updater: "rhel"},
+	{Name: "debian", Detectors: []string{"os-release", "lsb-release", "apt-sources"}, Lister: "dpkg", Updater: "debian"},
+	{Name: "gentoo", Detectors: []string{"os-release"}, Lister: "portage", Updater: "gentoo"},
+	{Name: "oracle", Detectors: []string{"redhat-release", "os-release"}, Lister: "rpm", Updater: "oracle"},
+	{Name: "ubuntu", Detectors: []string{"os-release", "lsb-release", "apt-sources"}, Lister: "dpkg", Updater: "ubuntu"},
+}
+
+// SupportedNamespaces returns the support of each OS flavor by this build,
+// sorted by name, so that a client learns before scanning an image whether its
+// distribution is supported.
+func SupportedNamespaces(datastore database.Datastore) ([]NamespaceSupport, error) {
+	detectors := make(map[string]bool)
+	for _, name := range featurens.ListDetectors() {
+		detectors[name] = true
+	}
+	updaters := vulnsrc.Updaters()
+
+	supports := make([]NamespaceSupport, 0, len(osFlavors))
+	for _, flavor := range osFlavors {
+		s := flavor
+		s.Detectors = append([]string(nil), flavor.Detectors...)
+		for _, name := range s.Detectors {
+			if detectors[name] {
+				s.DetectorEnabled = true
+			}
+		}
+		s.ListerEnabled = featurefmt.ListerEnabled(s.Lister)
+
+		if _, ok := updaters[s.Updater]; ok {
+			s.UpdaterEnabled = true
+
+			lastUpdate, _, err := getLastUpdateNS(datastore, s.Updater)
+			if err != nil {
+				return nil, err
+			}
+			s.LastUpdate = lastUpdate
+		}
+
+		supports = append(supports, s)
+	}
+
+	return supports, nil
+}
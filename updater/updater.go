@@ -1,6 +1,7 @@
 package updater
 
 import (
+	"fmt"
 	"math/rand"
 	"strconv"
 	"sync"
@@ -12,12 +13,14 @@ import (
 	"github.com/MXi4oyu/DockerXScan/database"
 	"github.com/MXi4oyu/DockerXScan/vulnmdsrc"
 	"github.com/MXi4oyu/DockerXScan/vulnsrc"
+	"github.com/MXi4oyu/DockerXScan/common/httputil"
 	"github.com/MXi4oyu/DockerXScan/common/stopper"
 )
 
 
 const (
-	updaterLastFlagName        = "updater/last"
+	updaterComponent           = "updater"
+	updaterLastFlagName        = "last"
 	updaterLockName            = "updater"
 	updaterLockDuration        = updaterLockRefreshDuration + time.Minute*2
 	updaterLockRefreshDuration = time.Minute * 8
@@ -49,6 +52,56 @@ func init() {
 // UpdaterConfig is the configuration for the Updater service.
 type UpdaterConfig struct {
 	Interval time.Duration
+
+	// FeedTimeout bounds the duration of a single feed download and
+	// FeedMaxSize its size in bytes. Zero values use the httputil defaults.
+	FeedTimeout time.Duration
+	FeedMaxSize int64
+
+	// EnrichStored makes every update also fill the severities and metadata
+	// missing from the vulnerabilities already stored, using the metadata
+	// fetchers (e.g. NVD).
+	EnrichStored bool
+
+	// FeedURLs override, by name of updater (e.g. "debian"), the URLs from
+	// which the vulnerabilities are fetched, such as internal mirrors. For
+	// rhel and oracle, it is the directory of the OVAL definitions.
+	FeedURLs map[string]string
+
+	// MaxConcurrency bounds how many updaters fetch and parse their feeds at
+	// once, the others waiting for a slot to be freed, so that an update
+	// does not saturate the network and the CPU. Zero means no limit.
+	MaxConcurrency int
+}
+
+// Configure validates and applies the configuration of the updaters, so that a
+// malformed one fails at startup rather than on the first update.
+func Configure(config *UpdaterConfig) error {
+	if config == nil {
+		setMaxConcurrency(0)
+		return vulnsrc.SetFeedURLs(nil)
+	}
+	if config.MaxConcurrency < 0 {
+		return errNegativeConcurrency
+	}
+	if err := vulnsrc.SetFeedURLs(config.FeedURLs); err != nil {
+		return err
+	}
+	setMaxConcurrency(config.MaxConcurrency)
+	return nil
+}
+
+// ValidateConfig returns the problems of the configuration of the updaters
+// that Configure would reject, without applying it.
+func ValidateConfig(config *UpdaterConfig) []error {
+	if config == nil {
+		return nil
+	}
+	errs := vulnsrc.ValidateFeedURLs(config.FeedURLs)
+	if config.MaxConcurrency < 0 {
+		errs = append(errs, errNegativeConcurrency)
+	}
+	return errs
 }
 
 // RunUpdater begins a process that updates the vulnerability database at
@@ -62,6 +115,8 @@ func RunUpdater(config *UpdaterConfig, datastore database.Datastore, st *stopper
 		return
 	}
 
+	httputil.SetFeedLimits(config.FeedTimeout, config.FeedMaxSize)
+
 	whoAmI := uuid.New()
 	log.WithField("lock identifier", whoAmI).Info("updater service started")
 
@@ -88,7 +143,7 @@ func RunUpdater(config *UpdaterConfig, datastore database.Datastore, st *stopper
 				// Launch update in a new go routine.
 				doneC := make(chan bool, 1)
 				go func() {
-					update(datastore, firstUpdate)
+					update(datastore, firstUpdate, config.EnrichStored)
 					doneC <- true
 				}()
 
@@ -146,8 +201,9 @@ func RunUpdater(config *UpdaterConfig, datastore database.Datastore, st *stopper
 }
 
 // update fetches all the vulnerabilities from the registered fetchers, upserts
-// them into the database and then sends notifications.
-func update(datastore database.Datastore, firstUpdate bool) {
+// them into the database and then sends notifications. With enrichStored, it
+// then enriches the stored vulnerabilities.
+func update(datastore database.Datastore, firstUpdate, enrichStored bool) {
 	defer setUpdaterDuration(time.Now())
 
 	log.Info("updating vulnerabilities")
@@ -166,8 +222,10 @@ func update(datastore database.Datastore, firstUpdate bool) {
 	vulnerabilities = nil
 
 	// Update flags.
-	for flagName, flagValue := range flags {
-		datastore.InsertKeyValue(flagName, flagValue)
+	for updaterName, updaterFlags := range flags {
+		for flagName, flagValue := range updaterFlags {
+			datastore.SetKeyValueNS(updaterName, flagName, flagValue)
+		}
 	}
 
 	// Log notes.
@@ -176,9 +234,13 @@ func update(datastore database.Datastore, firstUpdate bool) {
 	}
 	promUpdaterNotesTotal.Set(float64(len(notes)))
 
+	if enrichStored {
+		enrich(datastore)
+	}
+
 	// Update last successful update if every fetchers worked properly.
 	if status {
-		datastore.InsertKeyValue(updaterLastFlagName, strconv.FormatInt(time.Now().UTC().Unix(), 10))
+		datastore.SetKeyValueNS(updaterComponent, updaterLastFlagName, strconv.FormatInt(time.Now().UTC().Unix(), 10))
 	}
 
 	log.Info("update finished")
@@ -189,39 +251,69 @@ func setUpdaterDuration(start time.Time) {
 }
 
 // fetch get data from the registered fetchers, in parallel.
-func fetch(datastore database.Datastore) (bool, []database.Vulnerability, map[string]string, []string) {
+//
+// The returned flags are indexed by the name of the updater they belong to.
+func fetch(datastore database.Datastore) (bool, []database.Vulnerability, map[string]map[string]string, []string) {
 	var vulnerabilities []database.Vulnerability
 	var notes []string
 	status := true
-	flags := make(map[string]string)
+	flags := make(map[string]map[string]string)
+
+	type namedResponse struct {
+		name   string
+		failed bool
+		*vulnsrc.UpdateResponse
+	}
 
 	// Fetch updates in parallel.
 	log.Info("fetching vulnerability updates")
-	var responseC = make(chan *vulnsrc.UpdateResponse, 0)
+	var responseC = make(chan namedResponse, 0)
 	for n, u := range vulnsrc.Updaters() {
 		go func(name string, u vulnsrc.Updater) {
+			release := acquireFetchSlot()
 			response, err := u.Update(datastore)
+			release()
 			if err != nil {
 				promUpdaterErrorsTotal.Inc()
 				log.WithError(err).WithField("updater name", name).Error("an error occured when fetching update")
 				status = false
-				responseC <- nil
+
+				// Record the failure so that it shows up in the update's notes.
+				responseC <- namedResponse{name, true, &vulnsrc.UpdateResponse{
+					Notes: []string{fmt.Sprintf("updater %s failed: %s", name, err)},
+				}}
 				return
 			}
 
-			responseC <- &response
+			responseC <- namedResponse{name, false, &response}
 			log.WithField("updater name", name).Info("finished fetching")
 		}(n, u)
 	}
 
 	// Collect results of updates.
+	now := strconv.FormatInt(time.Now().UTC().Unix(), 10)
 	for i := 0; i < len(vulnsrc.Updaters()); i++ {
 		resp := <-responseC
-		if resp != nil {
+		if resp.UpdateResponse != nil {
 			vulnerabilities = append(vulnerabilities, doVulnerabilitiesNamespacing(resp.Vulnerabilities)...)
 			notes = append(notes, resp.Notes...)
+
+			updaterFlags := make(map[string]string)
 			if resp.FlagName != "" && resp.FlagValue != "" {
-				flags[resp.FlagName] = resp.FlagValue
+				updaterFlags[resp.FlagName] = resp.FlagValue
+			}
+			for flagName, flagValue := range resp.Flags {
+				if flagName != "" && flagValue != "" {
+					updaterFlags[flagName] = flagValue
+				}
+			}
+			// The time of the last successful fetch of each updater is
+			// reported by SupportedNamespaces.
+			if !resp.failed {
+				updaterFlags[updaterLastFlagName] = now
+			}
+			if len(updaterFlags) > 0 {
+				flags[resp.name] = updaterFlags
 			}
 		}
 	}
@@ -277,7 +369,13 @@ func addMetadata(datastore database.Datastore, vulnerabilities []database.Vulner
 }
 
 func getLastUpdate(datastore database.Datastore) (time.Time, bool, error) {
-	lastUpdateTSS, err := datastore.GetKeyValue(updaterLastFlagName)
+	return getLastUpdateNS(datastore, updaterComponent)
+}
+
+// getLastUpdateNS returns the time of the last successful update recorded in
+// a namespace of the key/values, "updater" or the name of an updater.
+func getLastUpdateNS(datastore database.Datastore, ns string) (time.Time, bool, error) {
+	lastUpdateTSS, err := datastore.GetKeyValueNS(ns, updaterLastFlagName)
 	if err != nil {
 		return time.Time{}, false, err
 	}
@@ -0,0 +1,213 @@
+// Package apk implements a versionfmt.Parser for the versions of the Alpine
+// packages, such as 1.2.3_rc1-r0.
+package apk
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/MXi4oyu/DockerXScan/versionfmt"
+)
+
+// ParserName is the name by which the apk parser is registered.
+const ParserName = "apk"
+
+var versionRegexp = regexp.MustCompile(`^([0-9]+(?:\.[0-9]+)*)([a-z]?)((?:_[a-z]+[0-9]*)*)(?:~([0-9a-f]+))?(?:-r([0-9]+))?$`)
+
+var suffixRegexp = regexp.MustCompile(`_([a-z]+)([0-9]*)`)
+
+// suffixes are the suffixes in the order of apk-tools, those before the empty
+// one being pre-releases, lower than the release itself.
+var suffixes = map[string]int{
+	"alpha": -4,
+	"beta":  -3,
+	"pre":   -2,
+	"rc":    -1,
+	"cvs":   1,
+	"svn":   2,
+	"git":   3,
+	"hg":    4,
+	"p":     5,
+}
+
+type suffix struct {
+	order  int
+	number string
+}
+
+type version struct {
+	raw      string
+	numbers  []string
+	letter   string
+	suffixes []suffix
+	hash     string
+	revision string
+}
+
+var (
+	minVersion = version{raw: versionfmt.MinVersion}
+	maxVersion = version{raw: versionfmt.MaxVersion}
+)
+
+// newVersion parses a string into a version type which can be compared.
+//
+// The implementation follows the algorithm of apk-tools (src/version.c).
+func newVersion(str string) (version, error) {
+	str = strings.TrimSpace(str)
+	if len(str) == 0 {
+		return version{}, errors.New("Version string is empty")
+	}
+
+	// Max/Min versions
+	if str == versionfmt.MaxVersion {
+		return maxVersion, nil
+	}
+	if str == versionfmt.MinVersion {
+		return minVersion, nil
+	}
+
+	m := versionRegexp.FindStringSubmatch(str)
+	if m == nil {
+		return version{}, errors.New("invalid apk version")
+	}
+
+	v := version{raw: str, numbers: strings.Split(m[1], "."), letter: m[2], hash: m[4], revision: m[5]}
+	for _, s := range suffixRegexp.FindAllStringSubmatch(m[3], -1) {
+		order, ok := suffixes[s[1]]
+		if !ok {
+			return version{}, errors.New("invalid apk version suffix")
+		}
+		v.suffixes = append(v.suffixes, suffix{order: order, number: s[2]})
+	}
+
+	return v, nil
+}
+
+// compare returns 0 when a == b, -1 when a < b, 1 when b < a.
+func compare(a, b version) int {
+	for i := 0; i < len(a.numbers) && i < len(b.numbers); i++ {
+		var cmp int
+		if i > 0 && (strings.HasPrefix(a.numbers[i], "0") || strings.HasPrefix(b.numbers[i], "0")) {
+			// As in apk-tools, a number with a leading zero other than the
+			// first one compares as a decimal fraction.
+			cmp = strings.Compare(strings.TrimRight(a.numbers[i], "0"), strings.TrimRight(b.numbers[i], "0"))
+		} else {
+			cmp = compareNumbers(a.numbers[i], b.numbers[i])
+		}
+		if cmp != 0 {
+			return cmp
+		}
+	}
+
+	// Each part of a version comes before the following ones, so the version
+	// having a part the other lacks is the greatest, unless it is a
+	// pre-release suffix.
+	switch {
+	case len(a.numbers) > len(b.numbers):
+		return 1
+	case len(a.numbers) < len(b.numbers):
+		return -1
+	}
+
+	if cmp := compareOptional(a.letter, b.letter, strings.Compare); cmp != 0 {
+		return cmp
+	}
+
+	for i := 0; i < len(a.suffixes) || i < len(b.suffixes); i++ {
+		switch {
+		case i >= len(b.suffixes):
+			return sign(a.suffixes[i].order)
+		case i >= len(a.suffixes):
+			return -sign(b.suffixes[i].order)
+		case a.suffixes[i].order != b.suffixes[i].order:
+			return sign(a.suffixes[i].order - b.suffixes[i].order)
+		}
+		if cmp := compareNumbers(a.suffixes[i].number, b.suffixes[i].number); cmp != 0 {
+			return cmp
+		}
+	}
+
+	if cmp := compareOptional(a.hash, b.hash, strings.Compare); cmp != 0 {
+		return cmp
+	}
+
+	return compareOptional(a.revision, b.revision, compareNumbers)
+}
+
+// compareOptional compares two parts of the versions with cmp, a part being
+// greater than a missing one.
+func compareOptional(a, b string, cmp func(a, b string) int) int {
+	switch {
+	case a == "" && b == "":
+		return 0
+	case b == "":
+		return 1
+	case a == "":
+		return -1
+	}
+	return cmp(a, b)
+}
+
+// compareNumbers compares two unsigned decimal numbers of any length, an
+// empty one being zero.
+func compareNumbers(a, b string) int {
+	a, b = strings.TrimLeft(a, "0"), strings.TrimLeft(b, "0")
+	if len(a) != len(b) {
+		if len(a) < len(b) {
+			return -1
+		}
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+func sign(i int) int {
+	switch {
+	case i < 0:
+		return -1
+	case i > 0:
+		return 1
+	}
+	return 0
+}
+
+type parser struct{}
+
+func (p parser) Valid(str string) bool {
+	_, err := newVersion(str)
+	return err == nil
+}
+
+func (p parser) Compare(a, b string) (int, error) {
+	v1, err := newVersion(a)
+	if err != nil {
+		return 0, err
+	}
+
+	v2, err := newVersion(b)
+	if err != nil {
+		return 0, err
+	}
+
+	// Max/Min comparison
+	if v1.raw == v2.raw {
+		return 0, nil
+	}
+	if v1.raw == minVersion.raw || v2.raw == maxVersion.raw {
+		return -1, nil
+	}
+	if v2.raw == minVersion.raw || v1.raw == maxVersion.raw {
+		return 1, nil
+	}
+
+	return compare(v1, v2), nil
+}
+
+func init() {
+	versionfmt.RegisterParser(ParserName, parser{})
+
+	// The namespaces of Alpine keep the dpkg version format they were stored
+	// with, their features being compared with the apk rules instead.
+	versionfmt.RegisterComparator("alpine", parser{})
+}
@@ -0,0 +1,110 @@
+package apk
+
+import (
+	"testing"
+
+	"github.com/MXi4oyu/DockerXScan/versionfmt"
+)
+
+const (
+	LESS    = -1
+	EQUAL   = 0
+	GREATER = 1
+)
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		a        string
+		expected int
+		b        string
+	}{
+		{"1.0", EQUAL, "1.0"},
+		{"1.0", LESS, "1.1"},
+		{"1.2", LESS, "1.10"},
+		{"1.0", LESS, "1.0.1"},
+		{"2.0", GREATER, "1.99.99"},
+
+		// The pre-release suffixes come before the release, in order.
+		{"1.0_alpha", LESS, "1.0"},
+		{"1.0_alpha1", LESS, "1.0_beta1"},
+		{"1.0_beta1", LESS, "1.0_pre1"},
+		{"1.0_pre1", LESS, "1.0_rc1"},
+		{"1.0_rc1", LESS, "1.0"},
+		{"1.0_rc", LESS, "1.0_rc1"},
+		{"1.0_rc9", LESS, "1.0_rc10"},
+		{"1.0_rc1-r5", LESS, "1.0-r0"},
+		{"0.9", LESS, "1.0_alpha"},
+
+		// The other suffixes come after it, _p last.
+		{"1.0_cvs", GREATER, "1.0"},
+		{"1.0_git20230101", LESS, "1.0_p1"},
+		{"1.0_p1", GREATER, "1.0"},
+		{"1.0_p1", LESS, "1.0_p2"},
+		{"1.0_p9", LESS, "1.0_p10"},
+		{"1.0_p1", LESS, "1.0.1"},
+
+		// A letter comes after the number it follows, before a following
+		// number.
+		{"1.0a", GREATER, "1.0"},
+		{"1.0a", LESS, "1.0b"},
+		{"1.0z", LESS, "1.0.1"},
+		{"1.0a", GREATER, "1.0_p1"},
+		{"1.0a_rc1", LESS, "1.0a"},
+
+		// The numbers after the first one starting with a zero compare as
+		// decimal fractions.
+		{"1.01", LESS, "1.1"},
+		{"1.001", LESS, "1.01"},
+		{"1.09", LESS, "1.1"},
+		{"1.10", GREATER, "1.09"},
+		{"1.05", LESS, "1.5"},
+		{"01.1", EQUAL, "1.1"},
+
+		// The commit hash comes after the release, before a revision.
+		{"1.0~abc123", GREATER, "1.0"},
+		{"1.0~abc123", EQUAL, "1.0~abc123"},
+		{"1.0~abc123-r1", GREATER, "1.0~abc123-r0"},
+		{"1.0_git20230101~abc123-r0", GREATER, "1.0_git20230101-r0"},
+
+		// The revisions come last.
+		{"1.0", LESS, "1.0-r0"},
+		{"1.0-r0", LESS, "1.0-r1"},
+		{"1.0-r9", LESS, "1.0-r10"},
+		{"1.0-r10", LESS, "1.0.1-r0"},
+		{"1.2.3_rc1-r0", LESS, "1.2.3-r0"},
+
+		{versionfmt.MinVersion, LESS, "0"},
+		{"999.999-r999", LESS, versionfmt.MaxVersion},
+		{versionfmt.MinVersion, LESS, versionfmt.MaxVersion},
+	}
+
+	for _, test := range tests {
+		cmp, err := parser{}.Compare(test.a, test.b)
+		if err != nil {
+			t.Errorf("Compare(%q, %q) failed: %s", test.a, test.b, err)
+			continue
+		}
+		if cmp != test.expected {
+			t.Errorf("Compare(%q, %q) = %d, want %d", test.a, test.b, cmp, test.expected)
+		}
+
+		// The comparison is antisymmetric.
+		cmp, err = parser{}.Compare(test.b, test.a)
+		if err != nil || cmp != -test.expected {
+			t.Errorf("Compare(%q, %q) = %d, %v, want %d", test.b, test.a, cmp, err, -test.expected)
+		}
+	}
+}
+
+func TestValid(t *testing.T) {
+	for _, v := range []string{"1", "1.2.3", "1.2.3a", "1.2.3_rc1", "1.2.3_p1_p2", "1.2.3~0a1b", "1.2.3-r10", "1.0_git20230101~abc123-r0", versionfmt.MinVersion, versionfmt.MaxVersion} {
+		if !(parser{}).Valid(v) {
+			t.Errorf("Valid(%q) = false, want true", v)
+		}
+	}
+	for _, v := range []string{"", "a1.0", "1.0-1", "1.0_foo1", "1.0ab", "1.0~xyz", "1.0-r", "1..0", "1.0 beta"} {
+		if (parser{}).Valid(v) {
+			t.Errorf("Valid(%q) = true, want false", v)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+// Package conda implements a versionfmt.Parser for the versions of conda
+// packages, following the ordering of conda's VersionOrder.
+package conda
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/MXi4oyu/DockerXScan/versionfmt"
+)
+
+// ParserName is the name by which the conda parser is registered.
+const ParserName = "conda"
+
+var (
+	versionRegexp = regexp.MustCompile(`^(?:([0-9]+)!)?([0-9a-z._]+)(?:\+([0-9a-z._]+))?$`)
+	partRegexp    = regexp.MustCompile(`[0-9]+|[a-z]+`)
+)
+
+// The kinds of the parts of a component, in their order: "dev" is lower than
+// anything, and "post" is higher than anything.
+const (
+	kindDev = iota
+	kindString
+	kindNumber
+	kindPost
+)
+
+type part struct {
+	kind  int
+	value string
+}
+
+// zero is the value by which missing parts and components are filled.
+var zero = part{kind: kindNumber, value: "0"}
+
+type version struct {
+	raw   string
+	epoch string
+	main  [][]part
+	local [][]part
+}
+
+var (
+	minVersion = version{raw: versionfmt.MinVersion}
+	maxVersion = version{raw: versionfmt.MaxVersion}
+)
+
+// newVersion parses a string into a version type which can be compared.
+func newVersion(str string) (version, error) {
+	str = strings.TrimSpace(str)
+	if len(str) == 0 {
+		return version{}, errors.New("Version string is empty")
+	}
+
+	// Max/Min versions
+	if str == versionfmt.MaxVersion {
+		return maxVersion, nil
+	}
+	if str == versionfmt.MinVersion {
+		return minVersion, nil
+	}
+
+	m := versionRegexp.FindStringSubmatch(strings.ToLower(str))
+	if m == nil {
+		return version{}, errors.New("invalid conda version")
+	}
+
+	v := version{raw: str, epoch: m[1]}
+	var err error
+	if v.main, err = parseComponents(m[2]); err != nil {
+		return version{}, err
+	}
+	if m[3] != "" {
+		if v.local, err = parseComponents(m[3]); err != nil {
+			return version{}, err
+		}
+	}
+
+	return v, nil
+}
+
+// parseComponents splits a version into its components, separated by dots or
+// underscores, and each component into its numeric and alphabetic parts.
+func parseComponents(str string) ([][]part, error) {
+	var components [][]part
+	for _, c := range strings.FieldsFunc(str, func(r rune) bool { return r == '.' || r == '_' }) {
+		var parts []part
+		for _, p := range partRegexp.FindAllString(c, -1) {
+			switch {
+			case p[0] >= '0' && p[0] <= '9':
+				parts = append(parts, part{kind: kindNumber, value: p})
+			case p == "dev":
+				parts = append(parts, part{kind: kindDev, value: p})
+			case p == "post":
+				parts = append(parts, part{kind: kindPost, value: p})
+			default:
+				// A component starting with letters is implicitly preceded by 0,
+				// so that "1.a" is lower than "1.0".
+				if len(parts) == 0 {
+					parts = append(parts, zero)
+				}
+				parts = append(parts, part{kind: kindString, value: p})
+			}
+		}
+		components = append(components, parts)
+	}
+
+	if len(components) == 0 {
+		return nil, errors.New("invalid conda version")
+	}
+	return components, nil
+}
+
+// compare returns 0 when a == b, -1 when a < b, 1 when b < a.
+func compare(a, b version) int {
+	if cmp := compareNumbers(a.epoch, b.epoch); cmp != 0 {
+		return cmp
+	}
+	if cmp := compareComponents(a.main, b.main); cmp != 0 {
+		return cmp
+	}
+	return compareComponents(a.local, b.local)
+}
+
+// compareComponents compares two lists of components, the shorter one being
+// filled with zeros.
+func compareComponents(a, b [][]part) int {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		var ca, cb []part
+		if i < len(a) {
+			ca = a[i]
+		}
+		if i < len(b) {
+			cb = b[i]
+		}
+
+		for j := 0; j < len(ca) || j < len(cb); j++ {
+			pa, pb := zero, zero
+			if j < len(ca) {
+				pa = ca[j]
+			}
+			if j < len(cb) {
+				pb = cb[j]
+			}
+			if cmp := compareParts(pa, pb); cmp != 0 {
+				return cmp
+			}
+		}
+	}
+
+	return 0
+}
+
+func compareParts(a, b part) int {
+	if a.kind != b.kind {
+		if a.kind < b.kind {
+			return -1
+		}
+		return 1
+	}
+
+	switch a.kind {
+	case kindNumber:
+		return compareNumbers(a.value, b.value)
+	case kindString:
+		return strings.Compare(a.value, b.value)
+	}
+	return 0
+}
+
+// compareNumbers compares two unsigned decimal numbers of any length, an
+// empty string being zero.
+func compareNumbers(a, b string) int {
+	a, b = strings.TrimLeft(a, "0"), strings.TrimLeft(b, "0")
+	if len(a) != len(b) {
+		if len(a) < len(b) {
+			return -1
+		}
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+type parser struct{}
+
+func (p parser) Valid(str string) bool {
+	_, err := newVersion(str)
+	return err == nil
+}
+
+func (p parser) Compare(a, b string) (int, error) {
+	v1, err := newVersion(a)
+	if err != nil {
+		return 0, err
+	}
+
+	v2, err := newVersion(b)
+	if err != nil {
+		return 0, err
+	}
+
+	// Max/Min comparison
+	if v1.raw == v2.raw {
+		return 0, nil
+	}
+	if v1.raw == minVersion.raw || v2.raw == maxVersion.raw {
+		return -1, nil
+	}
+	if v2.raw == minVersion.raw || v1.raw == maxVersion.raw {
+		return 1, nil
+	}
+
+	return compare(v1, v2), nil
+}
+
+func init() {
+	versionfmt.RegisterParser(ParserName, parser{})
+}
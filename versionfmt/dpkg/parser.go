@@ -52,6 +52,10 @@ func newVersion(str string) (version, error) {
 	// Find epoch
 	sepepoch := strings.Index(str, ":")
 	if sepepoch > -1 {
+		// The epoch must be an unsigned number, as Atoi would accept a sign.
+		if sepepoch == 0 || strings.IndexFunc(str[:sepepoch], func(r rune) bool { return r < '0' || r > '9' }) > -1 {
+			return version{}, errors.New("epoch in version is not a number")
+		}
 		intepoch, err := strconv.Atoi(str[:sepepoch])
 		if err == nil {
 			v.epoch = intepoch
@@ -67,6 +71,9 @@ func newVersion(str string) (version, error) {
 
 	// Find version / revision
 	seprevision := strings.LastIndex(str, "-")
+	if seprevision > -1 && seprevision < sepepoch {
+		return version{}, errors.New("revision found before the epoch")
+	}
 	if seprevision > -1 {
 		v.version = str[sepepoch+1 : seprevision]
 		v.revision = str[seprevision+1:]
@@ -0,0 +1,86 @@
+package dpkg
+
+import (
+	"testing"
+
+	"github.com/MXi4oyu/DockerXScan/versionfmt"
+)
+
+const (
+	LESS    = -1
+	EQUAL   = 0
+	GREATER = 1
+)
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		a        string
+		expected int
+		b        string
+	}{
+		{"1.0", EQUAL, "1.0"},
+		{"1.0", LESS, "1.1"},
+		{"1.2", LESS, "1.10"},
+		{"1.0", LESS, "1.0.1"},
+		{"1.0a", GREATER, "1.0"},
+		{"1.0+dfsg", GREATER, "1.0"},
+
+		// The epoch decides first, a missing one being 0.
+		{"1:1.0", GREATER, "2.0"},
+		{"0:1.0", EQUAL, "1.0"},
+		{"2:0.1", GREATER, "1:9.9"},
+		{"1:1.2.11.dfsg-2+deb11u2", GREATER, "1.2.13.dfsg-1"},
+		{"10:1.0", GREATER, "9:1.0"},
+
+		// A tilde sorts before anything, even the end of the version.
+		{"1.0~rc1", LESS, "1.0"},
+		{"1.0~rc1", LESS, "1.0~rc2"},
+		{"1.0~~", LESS, "1.0~"},
+		{"1.0~", LESS, "1.0"},
+		{"1.0~rc1-1", LESS, "1.0-1"},
+		{"1.1.1n-0+deb11u3", LESS, "1.1.1n-0+deb11u4"},
+		{"1.1.1n-0+deb11u4", LESS, "1.1.1w-0+deb11u1"},
+
+		// The revisions come last, a missing one being 0.
+		{"1.0-1", LESS, "1.0-2"},
+		{"1.0-1", LESS, "1.0-1.1"},
+		{"1.0-9", LESS, "1.0-10"},
+		{"1.0", EQUAL, "1.0-0"},
+		{"1.0-1", LESS, "1.0.1-0"},
+		{"1.0-1-1", GREATER, "1.0-1"},
+
+		{versionfmt.MinVersion, LESS, "0"},
+		{"9:999", LESS, versionfmt.MaxVersion},
+		{versionfmt.MinVersion, LESS, versionfmt.MaxVersion},
+	}
+
+	for _, test := range tests {
+		cmp, err := parser{}.Compare(test.a, test.b)
+		if err != nil {
+			t.Errorf("Compare(%q, %q) failed: %s", test.a, test.b, err)
+			continue
+		}
+		if cmp != test.expected {
+			t.Errorf("Compare(%q, %q) = %d, want %d", test.a, test.b, cmp, test.expected)
+		}
+
+		// The comparison is antisymmetric.
+		cmp, err = parser{}.Compare(test.b, test.a)
+		if err != nil || cmp != -test.expected {
+			t.Errorf("Compare(%q, %q) = %d, %v, want %d", test.b, test.a, cmp, err, -test.expected)
+		}
+	}
+}
+
+func TestValid(t *testing.T) {
+	for _, v := range []string{"1", "1.0-1", "1:1.0", "0:1.0~rc1-1+deb11u1", "1.0+dfsg-1.1", versionfmt.MinVersion, versionfmt.MaxVersion} {
+		if !(parser{}).Valid(v) {
+			t.Errorf("Valid(%q) = false, want true", v)
+		}
+	}
+	for _, v := range []string{"", ":1.0", "a:1.0", "-1:1.0", "+1:1.0", "1:", "1.0 1"} {
+		if (parser{}).Valid(v) {
+			t.Errorf("Valid(%q) = true, want false", v)
+		}
+	}
+}
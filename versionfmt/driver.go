@@ -2,6 +2,7 @@ package versionfmt
 
 import (
 	"errors"
+	"strings"
 	"sync"
 )
 
@@ -22,18 +23,30 @@ var (
 	// but should return an error in the case where the version is invalid.
 	ErrInvalidVersion = errors.New("invalid version")
 
+	// ErrIncompatibleFormats is returned when two versions of different
+	// formats are compared.
+	ErrIncompatibleFormats = errors.New("incompatible version formats")
+
 	parsersM sync.Mutex
 	parsers  = make(map[string]Parser)
+
+	comparatorsM sync.RWMutex
+	comparators  = make(map[string]Comparator)
 )
 
+// Comparator represents anything that can compare two version strings.
+type Comparator interface {
+	// Compare parses two different version strings.
+	// Returns 0 when equal, -1 when a < b, 1 when b < a.
+	Compare(a, b string) (int, error)
+}
+
 // Parser represents any format that can compare two version strings.
 type Parser interface {
 	// Valid attempts to parse a version string and returns its success.
 	Valid(string) bool
 
-	// Compare parses two different version strings.
-	// Returns 0 when equal, -1 when a < b, 1 when b < a.
-	Compare(a, b string) (int, error)
+	Comparator
 }
 
 // RegisterParser provides a way to dynamically register an implementation of a
@@ -84,6 +97,32 @@ func Valid(format, version string) error {
 	return nil
 }
 
+// Version is a version validated with its format, as returned by Parse.
+type Version struct {
+	Format string
+	Value  string
+}
+
+// Parse is a helper function that validates a version with a given format,
+// so that it can be compared later on without knowing its format.
+func Parse(format, version string) (Version, error) {
+	if err := Valid(format, version); err != nil {
+		return Version{}, err
+	}
+
+	return Version{Format: format, Value: version}, nil
+}
+
+// Compare compares the version with another one of the same format.
+// Returns 0 when equal, -1 when v < other, 1 when other < v.
+func (v Version) Compare(other Version) (int, error) {
+	if v.Format != other.Format {
+		return 0, ErrIncompatibleFormats
+	}
+
+	return Compare(v.Format, v.Value, other.Value)
+}
+
 // Compare is a helper function that will compare two versions with a given
 // format and return an error if there are any failures.
 func Compare(format, versionA, versionB string) (int, error) {
@@ -94,3 +133,59 @@ func Compare(format, versionA, versionB string) (int, error) {
 
 	return versionParser.Compare(versionA, versionB)
 }
+
+// RegisterComparator makes a Comparator compare the versions of the features
+// of the namespaces of a flavor (e.g. "alpine" for "alpine:v3.7"), instead of
+// the Parser of their version format.
+//
+// If RegisterComparator is called twice with the same flavor, the flavor is
+// blank, or if the provided Comparator is nil, this function panics.
+func RegisterComparator(flavor string, c Comparator) {
+	if flavor == "" {
+		panic("versionfmt: could not register a Comparator with an empty flavor")
+	}
+
+	if c == nil {
+		panic("versionfmt: could not register a nil Comparator")
+	}
+
+	comparatorsM.Lock()
+	defer comparatorsM.Unlock()
+
+	if _, dup := comparators[flavor]; dup {
+		panic("versionfmt: RegisterComparator called twice for " + flavor)
+	}
+
+	comparators[flavor] = c
+}
+
+// NamespaceFlavor returns the flavor of a namespace name, which is the part
+// before the version of the distribution (e.g. "debian" for "debian:9").
+func NamespaceFlavor(namespaceName string) string {
+	return strings.SplitN(namespaceName, ":", 2)[0]
+}
+
+// GetComparator returns the Comparator of the features of a namespace: the one
+// registered for its flavor, or else the Parser of its version format.
+func GetComparator(namespaceName, format string) (Comparator, bool) {
+	comparatorsM.RLock()
+	c, exists := comparators[NamespaceFlavor(namespaceName)]
+	comparatorsM.RUnlock()
+
+	if exists {
+		return c, true
+	}
+
+	return GetParser(format)
+}
+
+// CompareInNamespace is like Compare, but uses the Comparator of the namespace
+// of the versions.
+func CompareInNamespace(namespaceName, format, versionA, versionB string) (int, error) {
+	c, exists := GetComparator(namespaceName, format)
+	if !exists {
+		return 0, ErrUnknownVersionFormat
+	}
+
+	return c.Compare(versionA, versionB)
+}
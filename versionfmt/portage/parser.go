@@ -0,0 +1,186 @@
+// Package portage implements a versionfmt.Parser for the versions of Gentoo
+// packages, as specified by the Package Manager Specification.
+package portage
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/MXi4oyu/DockerXScan/versionfmt"
+)
+
+// ParserName is the name by which the portage parser is registered.
+const ParserName = "portage"
+
+var versionRegexp = regexp.MustCompile(`^([0-9]+(?:\.[0-9]+)*)([a-z]?)((?:_(?:alpha|beta|pre|rc|p)[0-9]*)*)(?:-r([0-9]+))?$`)
+
+// suffixOrder ranks the suffixes of a version, the absence of suffix being
+// ranked between rc and p.
+var suffixOrder = map[string]int{
+	"alpha": 0,
+	"beta":  1,
+	"pre":   2,
+	"rc":    3,
+	"p":     5,
+}
+
+const noSuffix = 4
+
+type suffix struct {
+	kind   int
+	number string
+}
+
+type version struct {
+	raw        string
+	components []string
+	letter     string
+	suffixes   []suffix
+	revision   string
+}
+
+var (
+	minVersion = version{raw: versionfmt.MinVersion}
+	maxVersion = version{raw: versionfmt.MaxVersion}
+)
+
+// newVersion parses a string into a version type which can be compared.
+func newVersion(str string) (version, error) {
+	str = strings.TrimSpace(str)
+	if len(str) == 0 {
+		return version{}, errors.New("Version string is empty")
+	}
+
+	// Max/Min versions
+	if str == versionfmt.MaxVersion {
+		return maxVersion, nil
+	}
+	if str == versionfmt.MinVersion {
+		return minVersion, nil
+	}
+
+	m := versionRegexp.FindStringSubmatch(str)
+	if m == nil {
+		return version{}, errors.New("invalid portage version")
+	}
+
+	v := version{
+		raw:        str,
+		components: strings.Split(m[1], "."),
+		letter:     m[2],
+		revision:   m[4],
+	}
+
+	if m[3] != "" {
+		for _, s := range strings.Split(m[3], "_")[1:] {
+			name := strings.TrimRight(s, "0123456789")
+			v.suffixes = append(v.suffixes, suffix{kind: suffixOrder[name], number: s[len(name):]})
+		}
+	}
+
+	return v, nil
+}
+
+// compare returns 0 when a == b, -1 when a < b, 1 when b < a, following the
+// algorithm of the Package Manager Specification.
+func compare(a, b version) int {
+	// Compare the numeric components, the first one as an integer and the
+	// following ones as strings when they have a leading zero.
+	for i := 0; i < len(a.components) && i < len(b.components); i++ {
+		ca, cb := a.components[i], b.components[i]
+		var cmp int
+		if i > 0 && (strings.HasPrefix(ca, "0") || strings.HasPrefix(cb, "0")) {
+			cmp = strings.Compare(strings.TrimRight(ca, "0"), strings.TrimRight(cb, "0"))
+		} else {
+			cmp = compareNumbers(ca, cb)
+		}
+		if cmp != 0 {
+			return cmp
+		}
+	}
+	if len(a.components) != len(b.components) {
+		if len(a.components) < len(b.components) {
+			return -1
+		}
+		return 1
+	}
+
+	// Compare letters, no letter being lower than any letter.
+	if cmp := strings.Compare(a.letter, b.letter); cmp != 0 {
+		return cmp
+	}
+
+	// Compare suffixes.
+	for i := 0; i < len(a.suffixes) || i < len(b.suffixes); i++ {
+		sa, sb := suffix{kind: noSuffix}, suffix{kind: noSuffix}
+		if i < len(a.suffixes) {
+			sa = a.suffixes[i]
+		}
+		if i < len(b.suffixes) {
+			sb = b.suffixes[i]
+		}
+
+		if sa.kind != sb.kind {
+			if sa.kind < sb.kind {
+				return -1
+			}
+			return 1
+		}
+		if cmp := compareNumbers(sa.number, sb.number); cmp != 0 {
+			return cmp
+		}
+	}
+
+	// Compare revisions.
+	return compareNumbers(a.revision, b.revision)
+}
+
+// compareNumbers compares two unsigned decimal numbers of any length, an
+// empty string being zero.
+func compareNumbers(a, b string) int {
+	a, b = strings.TrimLeft(a, "0"), strings.TrimLeft(b, "0")
+	if len(a) != len(b) {
+		if len(a) < len(b) {
+			return -1
+		}
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+type parser struct{}
+
+func (p parser) Valid(str string) bool {
+	_, err := newVersion(str)
+	return err == nil
+}
+
+func (p parser) Compare(a, b string) (int, error) {
+	v1, err := newVersion(a)
+	if err != nil {
+		return 0, err
+	}
+
+	v2, err := newVersion(b)
+	if err != nil {
+		return 0, err
+	}
+
+	// Max/Min comparison
+	if v1.raw == v2.raw {
+		return 0, nil
+	}
+	if v1.raw == minVersion.raw || v2.raw == maxVersion.raw {
+		return -1, nil
+	}
+	if v2.raw == minVersion.raw || v1.raw == maxVersion.raw {
+		return 1, nil
+	}
+
+	return compare(v1, v2), nil
+}
+
+func init() {
+	versionfmt.RegisterParser(ParserName, parser{})
+}
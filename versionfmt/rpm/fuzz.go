@@ -0,0 +1,19 @@
+//go:build gofuzz
+// +build gofuzz
+
+package rpm
+
+// Fuzz is the go-fuzz entry point for the rpm version parser. Each input is
+// parsed and compared against itself, which must be equal.
+func Fuzz(data []byte) int {
+	str := string(data)
+	if !(parser{}).Valid(str) {
+		return 0
+	}
+
+	cmp, err := parser{}.Compare(str, str)
+	if err != nil || cmp != 0 {
+		panic("rpm: a valid version is not equal to itself: " + str)
+	}
+	return 1
+}
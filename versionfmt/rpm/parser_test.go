@@ -0,0 +1,85 @@
+package rpm
+
+import (
+	"testing"
+
+	"github.com/MXi4oyu/DockerXScan/versionfmt"
+)
+
+const (
+	LESS    = -1
+	EQUAL   = 0
+	GREATER = 1
+)
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		a        string
+		expected int
+		b        string
+	}{
+		{"1.0", EQUAL, "1.0"},
+		{"1.0", LESS, "1.1"},
+		{"1.2", LESS, "1.10"},
+		{"1.0", LESS, "1.0.1"},
+		{"1.01", EQUAL, "1.1"},
+		{"1.0a", GREATER, "1.0"},
+		// A number is newer than letters.
+		{"1.0.1", GREATER, "1.0.a"},
+		{"1.0", EQUAL, "1_0"},
+
+		// The epoch decides first, a missing one being 0.
+		{"1:1.0", GREATER, "2.0"},
+		{"0:1.0", EQUAL, "1.0"},
+		{"2:0.1", GREATER, "1:9.9"},
+		{"1:1.0-1.el8", GREATER, "1.1-1.el8"},
+		{"10:1.0", GREATER, "9:1.0"},
+
+		// A tilde sorts before anything, even the end of the version.
+		{"1.0~rc1", LESS, "1.0"},
+		{"1.0~rc1", LESS, "1.0~rc2"},
+		{"1.0~~", LESS, "1.0~"},
+		{"1.0~rc1-1", LESS, "1.0-1"},
+
+		// The releases come last.
+		{"1.0-1", LESS, "1.0-2"},
+		{"1.0-9", LESS, "1.0-10"},
+		{"1.0-1.el8", LESS, "1.0-1.el8_1"},
+		{"1.0-1.el8_1", LESS, "1.0-2.el8"},
+		{"1.0-2.el8", LESS, "1.0.1-1.el8"},
+
+		{versionfmt.MinVersion, LESS, "0"},
+		{"9:999", LESS, versionfmt.MaxVersion},
+		{versionfmt.MinVersion, LESS, versionfmt.MaxVersion},
+	}
+
+	for _, test := range tests {
+		cmp, err := parser{}.Compare(test.a, test.b)
+		if err != nil {
+			t.Errorf("Compare(%q, %q) failed: %s", test.a, test.b, err)
+			continue
+		}
+		if cmp != test.expected {
+			t.Errorf("Compare(%q, %q) = %d, want %d", test.a, test.b, cmp, test.expected)
+		}
+
+		// The comparison is antisymmetric.
+		cmp, err = parser{}.Compare(test.b, test.a)
+		if err != nil || cmp != -test.expected {
+			t.Errorf("Compare(%q, %q) = %d, %v, want %d", test.b, test.a, cmp, err, -test.expected)
+		}
+	}
+}
+
+func TestValid(t *testing.T) {
+	for _, v := range []string{"1", "1.0-1", "1:1.0-1.el8", "0:1.0~rc1-1.el8_1", versionfmt.MinVersion, versionfmt.MaxVersion} {
+		if !(parser{}).Valid(v) {
+			t.Errorf("Valid(%q) = false, want true", v)
+		}
+	}
+	for _, v := range []string{"", ":1.0", "a:1.0", "-1:1.0", "+1:1.0"} {
+		if (parser{}).Valid(v) {
+			t.Errorf("Valid(%q) = true, want false", v)
+		}
+	}
+}
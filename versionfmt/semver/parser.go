@@ -0,0 +1,168 @@
+// Package semver implements a versionfmt.Parser for Semantic Versioning 2.0.0
+// versions, such as the ones of Rust crates.
+package semver
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/MXi4oyu/DockerXScan/versionfmt"
+)
+
+// ParserName is the name by which the semver parser is registered.
+const ParserName = "semver"
+
+var versionRegexp = regexp.MustCompile(`^v?(0|[1-9][0-9]*)\.(0|[1-9][0-9]*)\.(0|[1-9][0-9]*)(?:-([0-9A-Za-z.-]+))?(?:\+[0-9A-Za-z.-]+)?$`)
+
+type version struct {
+	raw        string
+	core       [3]string
+	prerelease []string
+}
+
+var (
+	minVersion = version{raw: versionfmt.MinVersion}
+	maxVersion = version{raw: versionfmt.MaxVersion}
+)
+
+// newVersion parses a string into a version type which can be compared. The
+// build metadata is ignored, as it doesn't take part in the precedence.
+func newVersion(str string) (version, error) {
+	str = strings.TrimSpace(str)
+	if len(str) == 0 {
+		return version{}, errors.New("Version string is empty")
+	}
+
+	// Max/Min versions
+	if str == versionfmt.MaxVersion {
+		return maxVersion, nil
+	}
+	if str == versionfmt.MinVersion {
+		return minVersion, nil
+	}
+
+	m := versionRegexp.FindStringSubmatch(str)
+	if m == nil {
+		return version{}, errors.New("invalid semver version")
+	}
+
+	v := version{raw: str, core: [3]string{m[1], m[2], m[3]}}
+	if m[4] != "" {
+		v.prerelease = strings.Split(m[4], ".")
+		for _, identifier := range v.prerelease {
+			if identifier == "" {
+				return version{}, errors.New("invalid semver pre-release")
+			}
+		}
+	}
+
+	return v, nil
+}
+
+// compare returns 0 when a == b, -1 when a < b, 1 when b < a.
+func compare(a, b version) int {
+	for i := range a.core {
+		if cmp := compareNumbers(a.core[i], b.core[i]); cmp != 0 {
+			return cmp
+		}
+	}
+
+	// A pre-release is lower than the release itself.
+	switch {
+	case len(a.prerelease) == 0 && len(b.prerelease) == 0:
+		return 0
+	case len(a.prerelease) == 0:
+		return 1
+	case len(b.prerelease) == 0:
+		return -1
+	}
+
+	for i := 0; i < len(a.prerelease) && i < len(b.prerelease); i++ {
+		if cmp := compareIdentifiers(a.prerelease[i], b.prerelease[i]); cmp != 0 {
+			return cmp
+		}
+	}
+
+	// A shorter pre-release is lower when the common identifiers are equal.
+	switch {
+	case len(a.prerelease) < len(b.prerelease):
+		return -1
+	case len(a.prerelease) > len(b.prerelease):
+		return 1
+	}
+	return 0
+}
+
+// compareIdentifiers compares two pre-release identifiers: numeric ones
+// numerically, lower than the alphanumeric ones which compare in ASCII order.
+func compareIdentifiers(a, b string) int {
+	aNumeric, bNumeric := isNumeric(a), isNumeric(b)
+	switch {
+	case aNumeric && bNumeric:
+		return compareNumbers(a, b)
+	case aNumeric:
+		return -1
+	case bNumeric:
+		return 1
+	default:
+		return strings.Compare(a, b)
+	}
+}
+
+// compareNumbers compares two unsigned decimal numbers of any length.
+func compareNumbers(a, b string) int {
+	a, b = strings.TrimLeft(a, "0"), strings.TrimLeft(b, "0")
+	if len(a) != len(b) {
+		if len(a) < len(b) {
+			return -1
+		}
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+func isNumeric(str string) bool {
+	for _, r := range str {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return str != ""
+}
+
+type parser struct{}
+
+func (p parser) Valid(str string) bool {
+	_, err := newVersion(str)
+	return err == nil
+}
+
+func (p parser) Compare(a, b string) (int, error) {
+	v1, err := newVersion(a)
+	if err != nil {
+		return 0, err
+	}
+
+	v2, err := newVersion(b)
+	if err != nil {
+		return 0, err
+	}
+
+	// Max/Min comparison
+	if v1.raw == v2.raw {
+		return 0, nil
+	}
+	if v1.raw == minVersion.raw || v2.raw == maxVersion.raw {
+		return -1, nil
+	}
+	if v2.raw == minVersion.raw || v1.raw == maxVersion.raw {
+		return 1, nil
+	}
+
+	return compare(v1, v2), nil
+}
+
+func init() {
+	versionfmt.RegisterParser(ParserName, parser{})
+}
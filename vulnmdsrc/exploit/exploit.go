@@ -0,0 +1,157 @@
+// Package exploit implements a vulnerability metadata appender telling which
+// CVEs are exploited, using the CISA catalog of the Known Exploited
+// Vulnerabilities and the scores of the Exploit Prediction Scoring System of
+// FIRST.
+package exploit
+
+import (
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/MXi4oyu/DockerXScan/common/httputil"
+	"github.com/MXi4oyu/DockerXScan/database"
+	"github.com/MXi4oyu/DockerXScan/vulnmdsrc"
+)
+
+const (
+	appenderName = "Exploit"
+
+	kevURL  = "https://www.cisa.gov/sites/default/files/feeds/known_exploited_vulnerabilities.json"
+	epssURL = "https://epss.cyentia.com/epss_scores-current.csv.gz"
+)
+
+type appender struct {
+	metadata map[string]database.Exploitation
+}
+
+// kevCatalog is the part of the catalog of the Known Exploited
+// Vulnerabilities that lists them.
+type kevCatalog struct {
+	Vulnerabilities []struct {
+		CVEID string `json:"cveID"`
+	} `json:"vulnerabilities"`
+}
+
+func init() {
+	vulnmdsrc.RegisterAppender(appenderName, &appender{})
+}
+
+// BuildCache fetches the catalog and the scores. The metadata of either is
+// still added when the other can't be fetched.
+func (a *appender) BuildCache(datastore database.Datastore) error {
+	a.metadata = make(map[string]database.Exploitation)
+
+	kevErr := a.loadKEV(kevURL)
+	if kevErr != nil {
+		log.WithError(kevErr).Warning("could not load the Known Exploited Vulnerabilities")
+	}
+	epssErr := a.loadEPSS(epssURL)
+	if epssErr != nil {
+		log.WithError(epssErr).Warning("could not load the EPSS scores")
+	}
+	if kevErr != nil && epssErr != nil {
+		return errors.New("exploit: could not load the Known Exploited Vulnerabilities nor the EPSS scores")
+	}
+
+	return nil
+}
+
+func (a *appender) Append(vulnName string, appendFunc vulnmdsrc.AppendFunc) error {
+	if exploitation, ok := a.metadata[vulnName]; ok {
+		appendFunc(database.ExploitMetadataKey, exploitation, database.UnknownSeverity)
+	}
+
+	return nil
+}
+
+func (a *appender) PurgeCache() {
+	a.metadata = nil
+}
+
+func (a *appender) Clean() {}
+
+// loadKEV marks the vulnerabilities of the catalog as known to be exploited.
+func (a *appender) loadKEV(url string) error {
+	r, err := httputil.GetFeed(url)
+	if err != nil {
+		return err
+	}
+	defer r.Body.Close()
+
+	var catalog kevCatalog
+	if err := json.NewDecoder(r.Body).Decode(&catalog); err != nil {
+		return err
+	}
+
+	for _, v := range catalog.Vulnerabilities {
+		if v.CVEID == "" {
+			continue
+		}
+		e := a.metadata[v.CVEID]
+		e.KnownExploited = true
+		a.metadata[v.CVEID] = e
+	}
+
+	log.WithField("count", len(catalog.Vulnerabilities)).Debug("loaded the Known Exploited Vulnerabilities")
+	return nil
+}
+
+// loadEPSS sets the EPSS scores of the vulnerabilities, read from the CSV of
+// the scores, gzipped or not, whose first line may be a comment telling the
+// version of the model.
+func (a *appender) loadEPSS(url string) error {
+	r, err := httputil.GetFeed(url)
+	if err != nil {
+		return err
+	}
+	defer r.Body.Close()
+
+	var body io.Reader = r.Body
+	if strings.HasSuffix(url, ".gz") {
+		gr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			return err
+		}
+		defer gr.Close()
+		body = gr
+	}
+
+	reader := csv.NewReader(body)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+
+	count := 0
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if len(record) < 2 || !strings.HasPrefix(record[0], "CVE-") {
+			// The header.
+			continue
+		}
+
+		score, err := strconv.ParseFloat(record[1], 64)
+		if err != nil || score < 0 || score > 1 {
+			log.WithField("cve", record[0]).Debug("could not parse EPSS score. skipping")
+			continue
+		}
+		e := a.metadata[record[0]]
+		e.EPSSScore = score
+		a.metadata[record[0]] = e
+		count++
+	}
+
+	log.WithField("count", count).Debug("loaded the EPSS scores")
+	return nil
+}
@@ -11,6 +11,7 @@ import (
 	"gopkg.in/yaml.v2"
 	"github.com/MXi4oyu/DockerXScan/database"
 	"github.com/MXi4oyu/DockerXScan/versionfmt"
+	"github.com/MXi4oyu/DockerXScan/versionfmt/apk"
 	"github.com/MXi4oyu/DockerXScan/versionfmt/dpkg"
 	"github.com/MXi4oyu/DockerXScan/vulnsrc"
 	"github.com/MXi4oyu/DockerXScan/common/commonerr"
@@ -19,12 +20,13 @@ import (
 
 const (
 	secdbGitURL  = "https://git.alpinelinux.org/cgit/alpine-secdb"
-	updaterFlag  = "alpine-secdbUpdater"
+	updaterName  = "alpine"
+	updaterFlag  = "commit"
 	nvdURLPrefix = "https://cve.mitre.org/cgi-bin/cvename.cgi?name="
 )
 
 func init() {
-	vulnsrc.RegisterUpdater("alpine", &updater{})
+	vulnsrc.RegisterUpdater(updaterName, &updater{})
 }
 
 type updater struct {
@@ -43,7 +45,7 @@ func (u *updater) Update(db database.Datastore) (resp vulnsrc.UpdateResponse, er
 
 	// Ask the database for the latest commit we successfully applied.
 	var dbCommit string
-	dbCommit, err = db.GetKeyValue(updaterFlag)
+	dbCommit, err = db.GetKeyValueNS(updaterName, updaterFlag)
 	if err != nil {
 		return
 	}
@@ -162,7 +164,7 @@ func (u *updater) pullRepository() (commit string, err error) {
 			return "", vulnsrc.ErrFilesystem
 		}
 
-		cmd := exec.Command("git", "clone", secdbGitURL, ".")
+		cmd := exec.Command("git", "clone", vulnsrc.FeedURL(updaterName, secdbGitURL), ".")
 		cmd.Dir = u.repositoryLocalPath
 		if out, err := cmd.CombinedOutput(); err != nil {
 			u.Clean()
@@ -215,7 +217,7 @@ func parseYAML(r io.Reader) (vulns []database.Vulnerability, err error) {
 	for _, pack := range file.Packages {
 		pkg := pack.Pkg
 		for version, vulnStrs := range pkg.Fixes {
-			err := versionfmt.Valid(dpkg.ParserName, version)
+			err := versionfmt.Valid(apk.ParserName, version)
 			if err != nil {
 				log.WithError(err).WithField("version", version).Warning("could not parse package version. skipping")
 				continue
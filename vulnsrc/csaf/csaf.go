@@ -0,0 +1,276 @@
+// Package csaf implements a vulnerability source updater using the CSAF 2.0
+// advisories of any vendor publishing them, such as Red Hat or SUSE.
+//
+// The updater is pointed at the provider-metadata.json of a CSAF provider
+// with the "csaf" feed URL of the updater configuration, and does nothing
+// otherwise. The documents of the provider are listed by the changes.csv of
+// its directory distributions, or else by its ROLIE feeds, and only those
+// changed since the last update are fetched. The signatures and hashes of the
+// documents are not checked.
+package csaf
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/MXi4oyu/DockerXScan/common/httputil"
+	"github.com/MXi4oyu/DockerXScan/database"
+	"github.com/MXi4oyu/DockerXScan/vulnsrc"
+)
+
+const (
+	updaterName = "csaf"
+
+	// updaterFlag is the time of the most recent change of the documents of
+	// the provider when it was last fetched.
+	updaterFlag = "revision"
+
+	changesFilename = "changes.csv"
+)
+
+// providerMetadata is the part of a provider-metadata.json that lists the
+// documents of the provider.
+type providerMetadata struct {
+	Distributions []struct {
+		DirectoryURL string `json:"directory_url"`
+		ROLIE        struct {
+			Feeds []struct {
+				URL string `json:"url"`
+			} `json:"feeds"`
+		} `json:"rolie"`
+	} `json:"distributions"`
+}
+
+// rolieFeed is the part of a ROLIE feed that lists the documents it holds.
+type rolieFeed struct {
+	Feed struct {
+		Entry []struct {
+			Updated string `json:"updated"`
+			Content struct {
+				Src string `json:"src"`
+			} `json:"content"`
+		} `json:"entry"`
+	} `json:"feed"`
+}
+
+// entry is a document of a provider, with the time it was last changed.
+type entry struct {
+	url     string
+	updated time.Time
+}
+
+type updater struct{}
+
+func init() {
+	vulnsrc.RegisterUpdater(updaterName, &updater{})
+}
+
+func (u *updater) Update(datastore database.Datastore) (resp vulnsrc.UpdateResponse, err error) {
+	metadataURL := vulnsrc.FeedURL(updaterName, "")
+	if metadataURL == "" {
+		log.WithField("package", "CSAF").Debug("no provider metadata configured")
+		return resp, nil
+	}
+	log.WithFields(log.Fields{"package": "CSAF", "provider": metadataURL}).Info("Start fetching vulnerabilities")
+
+	entries, err := listEntries(metadataURL)
+	if err != nil {
+		log.WithError(err).Error("could not list the CSAF documents of the provider")
+		return resp, err
+	}
+
+	// Only fetch the documents changed since the last update.
+	var revision time.Time
+	dbRevision, err := datastore.GetKeyValueNS(updaterName, updaterFlag)
+	if err != nil {
+		return resp, err
+	}
+	if dbRevision != "" {
+		if revision, err = time.Parse(time.RFC3339, dbRevision); err != nil {
+			log.WithError(err).WithField("revision", dbRevision).Warning("could not parse the CSAF revision. fetching every document")
+		}
+	}
+
+	latest := revision
+	for _, e := range entries {
+		if !e.updated.After(revision) {
+			continue
+		}
+		if e.updated.After(latest) {
+			latest = e.updated
+		}
+
+		r, err := httputil.GetFeed(e.url)
+		if err != nil {
+			log.WithError(err).WithField("url", e.url).Error("could not download CSAF document")
+			return resp, err
+		}
+		content, err := ioutil.ReadAll(r.Body)
+		r.Body.Close()
+		if err != nil {
+			return resp, err
+		}
+
+		d, err := parseDocument(content)
+		if err != nil {
+			log.WithError(err).WithField("url", e.url).Warning("could not parse CSAF document. skipping")
+			continue
+		}
+		resp.Vulnerabilities = append(resp.Vulnerabilities, d.vulnerabilities()...)
+	}
+
+	if latest.Equal(revision) {
+		log.WithField("package", "CSAF").Debug("no update")
+		return resp, nil
+	}
+
+	resp.FlagName = updaterFlag
+	resp.FlagValue = latest.UTC().Format(time.RFC3339)
+
+	return resp, nil
+}
+
+func (u *updater) Clean() {}
+
+// listEntries returns the documents of the provider of a provider metadata,
+// each with the time of its latest change, sorted by URL.
+func listEntries(metadataURL string) ([]entry, error) {
+	r, err := httputil.GetFeed(metadataURL)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+
+	var metadata providerMetadata
+	if err := json.NewDecoder(r.Body).Decode(&metadata); err != nil {
+		return nil, err
+	}
+
+	latest := make(map[string]time.Time)
+	for _, distribution := range metadata.Distributions {
+		var entries []entry
+		if distribution.DirectoryURL != "" {
+			entries, err = listChanges(distribution.DirectoryURL)
+		} else {
+			for _, feed := range distribution.ROLIE.Feeds {
+				var feedEntries []entry
+				if feedEntries, err = listFeed(feed.URL); err != nil {
+					break
+				}
+				entries = append(entries, feedEntries...)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		for _, e := range entries {
+			if e.updated.After(latest[e.url]) {
+				latest[e.url] = e.updated
+			}
+		}
+	}
+	if len(latest) == 0 {
+		return nil, errors.New("csaf: provider lists no document")
+	}
+
+	entries := make([]entry, 0, len(latest))
+	for documentURL, updated := range latest {
+		entries = append(entries, entry{url: documentURL, updated: updated})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].url < entries[j].url })
+
+	return entries, nil
+}
+
+// listChanges returns the documents of a directory distribution, listed in
+// its changes.csv as their path relative to the directory and their time of
+// change.
+func listChanges(directoryURL string) ([]entry, error) {
+	base, err := url.Parse(strings.TrimSuffix(directoryURL, "/") + "/")
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := httputil.GetFeed(base.String() + changesFilename)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+
+	var entries []entry
+	reader := csv.NewReader(r.Body)
+	reader.FieldsPerRecord = 2
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		e, ok := newEntry(base, record[0], record[1])
+		if !ok {
+			log.WithField("line", strings.Join(record, ",")).Warning("could not parse CSAF change. skipping")
+			continue
+		}
+		entries = append(entries, e)
+	}
+
+	return entries, nil
+}
+
+// listFeed returns the documents of a ROLIE feed.
+func listFeed(feedURL string) ([]entry, error) {
+	base, err := url.Parse(feedURL)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := httputil.GetFeed(feedURL)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+
+	var feed rolieFeed
+	if err := json.NewDecoder(r.Body).Decode(&feed); err != nil {
+		return nil, err
+	}
+
+	var entries []entry
+	for _, fe := range feed.Feed.Entry {
+		e, ok := newEntry(base, fe.Content.Src, fe.Updated)
+		if !ok {
+			log.WithField("src", fe.Content.Src).Warning("could not parse CSAF feed entry. skipping")
+			continue
+		}
+		entries = append(entries, e)
+	}
+
+	return entries, nil
+}
+
+// newEntry returns the entry of a document, given its URL relative to base
+// and its time of change.
+func newEntry(base *url.URL, ref, updated string) (entry, bool) {
+	u, err := url.Parse(strings.TrimSpace(ref))
+	if err != nil || ref == "" {
+		return entry{}, false
+	}
+	t, err := time.Parse(time.RFC3339, strings.TrimSpace(updated))
+	if err != nil {
+		return entry{}, false
+	}
+	return entry{url: base.ResolveReference(u).String(), updated: t}, true
+}
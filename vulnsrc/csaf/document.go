@@ -0,0 +1,342 @@
+package csaf
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/MXi4oyu/DockerXScan/database"
+	"github.com/MXi4oyu/DockerXScan/versionfmt"
+	"github.com/MXi4oyu/DockerXScan/vulnmdsrc/nvd"
+)
+
+// document is the part of a CSAF 2.0 document that describes which versions
+// of the packages fix its vulnerabilities.
+type document struct {
+	Document struct {
+		Title    string `json:"title"`
+		Tracking struct {
+			ID                 string `json:"id"`
+			InitialReleaseDate string `json:"initial_release_date"`
+		} `json:"tracking"`
+		AggregateSeverity struct {
+			Text string `json:"text"`
+		} `json:"aggregate_severity"`
+		References []reference `json:"references"`
+	} `json:"document"`
+	ProductTree struct {
+		Branches         []branch       `json:"branches"`
+		FullProductNames []product      `json:"full_product_names"`
+		Relationships    []relationship `json:"relationships"`
+	} `json:"product_tree"`
+	Vulnerabilities []vulnerability `json:"vulnerabilities"`
+}
+
+type reference struct {
+	Category string `json:"category"`
+	URL      string `json:"url"`
+}
+
+type branch struct {
+	Product  *product `json:"product"`
+	Branches []branch `json:"branches"`
+}
+
+type product struct {
+	ProductID string `json:"product_id"`
+	Helper    struct {
+		CPE  string `json:"cpe"`
+		Purl string `json:"purl"`
+	} `json:"product_identification_helper"`
+}
+
+// relationship defines a product as a component installed on a platform,
+// such as a package of a release of a distribution.
+type relationship struct {
+	ProductReference          string  `json:"product_reference"`
+	RelatesToProductReference string  `json:"relates_to_product_reference"`
+	FullProductName           product `json:"full_product_name"`
+}
+
+type vulnerability struct {
+	CVE string `json:"cve"`
+	IDs []struct {
+		Text string `json:"text"`
+	} `json:"ids"`
+	Notes []struct {
+		Category string `json:"category"`
+		Text     string `json:"text"`
+	} `json:"notes"`
+	References    []reference `json:"references"`
+	ReleaseDate   string      `json:"release_date"`
+	ProductStatus struct {
+		FirstFixed    []string `json:"first_fixed"`
+		Fixed         []string `json:"fixed"`
+		KnownAffected []string `json:"known_affected"`
+	} `json:"product_status"`
+	Scores []struct {
+		CVSSV3 struct {
+			BaseScore float64 `json:"baseScore"`
+		} `json:"cvss_v3"`
+	} `json:"scores"`
+	Threats []struct {
+		Category string `json:"category"`
+		Details  string `json:"details"`
+	} `json:"threats"`
+}
+
+// parseDocument parses a CSAF document.
+func parseDocument(content []byte) (document, error) {
+	var d document
+	if err := json.Unmarshal(content, &d); err != nil {
+		return d, err
+	}
+	if len(d.Vulnerabilities) == 0 {
+		return d, errors.New("csaf: document has no vulnerability")
+	}
+	return d, nil
+}
+
+// component is the package of a product, given as its package URL, and the
+// CPE of the operating system it is installed on, if any.
+type component struct {
+	purl  string
+	osCPE string
+}
+
+// components returns the package of every product of the product tree,
+// indexed by product ID.
+func (d document) components() map[string]component {
+	products := make(map[string]product)
+	var walk func(branches []branch)
+	walk = func(branches []branch) {
+		for _, b := range branches {
+			if b.Product != nil {
+				products[b.Product.ProductID] = *b.Product
+			}
+			walk(b.Branches)
+		}
+	}
+	walk(d.ProductTree.Branches)
+	for _, p := range d.ProductTree.FullProductNames {
+		products[p.ProductID] = p
+	}
+
+	components := make(map[string]component)
+	for id, p := range products {
+		components[id] = component{purl: p.Helper.Purl}
+	}
+	for _, r := range d.ProductTree.Relationships {
+		purl := r.FullProductName.Helper.Purl
+		if purl == "" {
+			purl = products[r.ProductReference].Helper.Purl
+		}
+		components[r.FullProductName.ProductID] = component{purl: purl, osCPE: products[r.RelatesToProductReference].Helper.CPE}
+	}
+
+	return components
+}
+
+// vulnerabilities converts the vulnerabilities of a document to
+// Vulnerabilities fixed in the packages of its fixed products. The packages
+// of its products known to be affected but not fixed are never fixed. The
+// products that are not packages of a known namespace are ignored.
+func (d document) vulnerabilities() []database.Vulnerability {
+	components := d.components()
+
+	var vulnerabilities []database.Vulnerability
+	for _, cv := range d.Vulnerabilities {
+		v := database.Vulnerability{
+			Name:        cv.name(),
+			Description: cv.description(),
+			Link:        cv.link(),
+			Severity:    cv.severity(),
+		}
+		if v.Name == "" {
+			log.WithField("document", d.Document.Tracking.ID).Warning("CSAF vulnerability has no identifier. skipping")
+			continue
+		}
+		if v.Description == "" {
+			v.Description = d.Document.Title
+		}
+		if v.Link == "" {
+			v.Link = selfLink(d.Document.References)
+		}
+		if v.Severity == database.UnknownSeverity {
+			v.Severity = severityFromText(d.Document.AggregateSeverity.Text)
+		}
+		if t, ok := parseDate(cv.ReleaseDate, d.Document.Tracking.InitialReleaseDate); ok {
+			v.PublishedDate = t
+		}
+
+		fixedIn := make(map[string]database.FeatureVersion)
+		for _, id := range append(cv.ProductStatus.Fixed, cv.ProductStatus.FirstFixed...) {
+			if fv, ok := featureVersion(components[id], true); ok {
+				addFixedIn(fixedIn, fv)
+			}
+		}
+		for _, id := range cv.ProductStatus.KnownAffected {
+			if fv, ok := featureVersion(components[id], false); ok {
+				addFixedIn(fixedIn, fv)
+			}
+		}
+		if len(fixedIn) == 0 {
+			continue
+		}
+
+		keys := make([]string, 0, len(fixedIn))
+		for key := range fixedIn {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			v.FixedIn = append(v.FixedIn, fixedIn[key])
+		}
+
+		vulnerabilities = append(vulnerabilities, v)
+	}
+
+	return vulnerabilities
+}
+
+// featureVersion returns the FeatureVersion of the package of a product. A
+// fixed product is fixed in the version of its package, an affected one is
+// never fixed.
+func featureVersion(c component, fixed bool) (database.FeatureVersion, bool) {
+	var fv database.FeatureVersion
+	if c.purl == "" {
+		return fv, false
+	}
+
+	p, err := parsePurl(c.purl)
+	if err != nil {
+		log.WithError(err).WithField("purl", c.purl).Debug("could not parse CSAF product package URL. skipping")
+		return fv, false
+	}
+	namespace, version, ok := p.namespace(c.osCPE)
+	if !ok {
+		return fv, false
+	}
+
+	fv.Feature = database.Feature{Name: p.Name, Namespace: namespace}
+	fv.Version = versionfmt.MaxVersion
+	if fixed {
+		if err := versionfmt.Valid(namespace.VersionFormat, version); err != nil {
+			log.WithField("purl", c.purl).Warning("could not parse CSAF fixed version. skipping")
+			return fv, false
+		}
+		fv.Version = version
+	}
+
+	return fv, true
+}
+
+// addFixedIn adds a FeatureVersion to those of a vulnerability, indexed by
+// namespace and name of feature. A package fixed in several products, such as
+// its builds for each architecture or the streams of a release, keeps its
+// highest fixed version, and is only never fixed if it is not fixed in any.
+func addFixedIn(fixedIn map[string]database.FeatureVersion, fv database.FeatureVersion) {
+	key := fv.Feature.Namespace.Name + ":" + fv.Feature.Name
+	previous, exists := fixedIn[key]
+	if exists && previous.Version != versionfmt.MaxVersion {
+		if fv.Version == versionfmt.MaxVersion {
+			return
+		}
+		if cmp, err := versionfmt.CompareInNamespace(fv.Feature.Namespace.Name, fv.Feature.Namespace.VersionFormat, fv.Version, previous.Version); err != nil || cmp <= 0 {
+			return
+		}
+	}
+	fixedIn[key] = fv
+}
+
+func (cv vulnerability) name() string {
+	if cv.CVE != "" {
+		return cv.CVE
+	}
+	for _, id := range cv.IDs {
+		if id.Text != "" {
+			return id.Text
+		}
+	}
+	return ""
+}
+
+func (cv vulnerability) description() string {
+	for _, category := range []string{"description", "summary", "general"} {
+		for _, note := range cv.Notes {
+			if note.Category == category && strings.TrimSpace(note.Text) != "" {
+				return strings.TrimSpace(note.Text)
+			}
+		}
+	}
+	return ""
+}
+
+func (cv vulnerability) link() string {
+	return selfLink(cv.References)
+}
+
+// severity returns the severity of the highest CVSS v3 base score of a
+// vulnerability, or else of the impact given by its vendor.
+func (cv vulnerability) severity() database.Severity {
+	var score float64
+	for _, s := range cv.Scores {
+		if s.CVSSV3.BaseScore > score {
+			score = s.CVSSV3.BaseScore
+		}
+	}
+	if score > 0 {
+		return nvd.SeverityFromCVSS(score)
+	}
+
+	for _, threat := range cv.Threats {
+		if threat.Category == "impact" {
+			if severity := severityFromText(threat.Details); severity != database.UnknownSeverity {
+				return severity
+			}
+		}
+	}
+	return database.UnknownSeverity
+}
+
+// severityFromText returns the severity of a textual rating, such as those of
+// Red Hat or of the CVSS qualitative scale.
+func severityFromText(text string) database.Severity {
+	switch strings.ToLower(strings.TrimSpace(text)) {
+	case "none":
+		return database.NegligibleSeverity
+	case "low":
+		return database.LowSeverity
+	case "moderate", "medium":
+		return database.MediumSeverity
+	case "important", "high":
+		return database.HighSeverity
+	case "critical":
+		return database.CriticalSeverity
+	default:
+		return database.UnknownSeverity
+	}
+}
+
+func selfLink(references []reference) string {
+	for _, r := range references {
+		if r.Category == "self" {
+			return r.URL
+		}
+	}
+	return ""
+}
+
+// parseDate returns the first of the dates given that is a valid CSAF date.
+func parseDate(dates ...string) (time.Time, bool) {
+	for _, date := range dates {
+		if t, err := time.Parse(time.RFC3339, date); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
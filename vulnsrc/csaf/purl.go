@@ -0,0 +1,181 @@
+package csaf
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+
+	"github.com/MXi4oyu/DockerXScan/database"
+	"github.com/MXi4oyu/DockerXScan/featurefmt/cargo"
+	"github.com/MXi4oyu/DockerXScan/featurefmt/conda"
+	condaversion "github.com/MXi4oyu/DockerXScan/versionfmt/conda"
+	"github.com/MXi4oyu/DockerXScan/versionfmt/dpkg"
+	"github.com/MXi4oyu/DockerXScan/versionfmt/rpm"
+	"github.com/MXi4oyu/DockerXScan/versionfmt/semver"
+)
+
+// distros are the namespaces of the distributions, indexed by the names given
+// to them in the distro qualifier of the package URLs.
+var distros = map[string]string{
+	"alpine":      "alpine",
+	"centos":      "centos",
+	"debian":      "debian",
+	"ol":          "oracle",
+	"oracle":      "oracle",
+	"oraclelinux": "oracle",
+	"redhat":      "centos",
+	"rhel":        "centos",
+	"ubuntu":      "ubuntu",
+}
+
+// cpeDistros are the distro qualifiers of the operating systems named by the
+// CPEs of the products, as "vendor:product", for the vendors whose package
+// URLs do not tell the distribution.
+var cpeDistros = map[string]string{
+	"alpinelinux:alpine_linux": "alpine",
+	"canonical:ubuntu_linux":   "ubuntu",
+	"debian:debian_linux":      "debian",
+	"oracle:linux":             "ol",
+	"redhat:enterprise_linux":  "redhat",
+}
+
+// purl is a package URL, such as pkg:deb/debian/curl@7.64.0-4?distro=debian-10.
+type purl struct {
+	Type       string
+	Name       string
+	Version    string
+	Qualifiers url.Values
+}
+
+// parsePurl parses a package URL, ignoring its namespace and subpath.
+func parsePurl(s string) (purl, error) {
+	var p purl
+	if !strings.HasPrefix(s, "pkg:") {
+		return p, errors.New("csaf: package URL does not start with pkg:")
+	}
+	s = strings.TrimPrefix(s, "pkg:")
+
+	if i := strings.Index(s, "#"); i >= 0 {
+		s = s[:i]
+	}
+	if i := strings.Index(s, "?"); i >= 0 {
+		qualifiers, err := url.ParseQuery(s[i+1:])
+		if err != nil {
+			return p, err
+		}
+		p.Qualifiers, s = qualifiers, s[:i]
+	}
+	if i := strings.LastIndex(s, "@"); i >= 0 {
+		version, err := url.PathUnescape(s[i+1:])
+		if err != nil {
+			return p, err
+		}
+		p.Version, s = version, s[:i]
+	}
+
+	parts := strings.Split(strings.Trim(s, "/"), "/")
+	if len(parts) < 2 {
+		return p, errors.New("csaf: package URL has no type or name")
+	}
+	name, err := url.PathUnescape(parts[len(parts)-1])
+	if err != nil {
+		return p, err
+	}
+	p.Type, p.Name = strings.ToLower(parts[0]), name
+
+	return p, nil
+}
+
+// namespace returns the namespace of the package of a package URL and the
+// version of the package in its format. osCPE is the CPE of the operating
+// system the package belongs to, if any, used when the package URL has no
+// distro qualifier. ok is false when the package can't be matched against the
+// features of the images.
+func (p purl) namespace(osCPE string) (namespace database.Namespace, version string, ok bool) {
+	version = p.Version
+
+	switch p.Type {
+	case "cargo":
+		return database.Namespace{Name: cargo.NamespaceName, VersionFormat: semver.ParserName, Kind: database.LanguageNamespace}, version, true
+	case "conda":
+		return database.Namespace{Name: conda.NamespaceName, VersionFormat: condaversion.ParserName, Kind: database.LanguageNamespace}, version, true
+	case "deb", "apk":
+		// The Alpine namespaces are stored with the dpkg version format.
+		namespace.VersionFormat = dpkg.ParserName
+	case "rpm":
+		namespace.VersionFormat = rpm.ParserName
+		if epoch := p.Qualifiers.Get("epoch"); epoch != "" && epoch != "0" && !strings.Contains(version, ":") {
+			version = epoch + ":" + version
+		}
+	default:
+		return namespace, "", false
+	}
+
+	distro := p.Qualifiers.Get("distro")
+	if distro == "" {
+		distro = cpeDistro(osCPE)
+	}
+	name, release := splitDistro(distro)
+	flavor, known := distros[name]
+	if !known || release == "" {
+		return namespace, "", false
+	}
+
+	switch flavor {
+	case "alpine":
+		// Alpine namespaces are named after their branch, such as v3.15.
+		release = "v" + strings.Join(firstFields(strings.TrimPrefix(release, "v"), ".", 2), ".")
+	case "centos", "oracle":
+		// Red Hat and Oracle namespaces are named after their major release.
+		release = firstFields(release, ".", 1)[0]
+	case "debian":
+		release = firstFields(release, ".", 1)[0]
+	}
+
+	namespace.Name = flavor + ":" + release
+	namespace.Kind = database.DistroNamespace
+	return namespace, version, true
+}
+
+// splitDistro splits a distro qualifier such as "debian-10" or "alpine-3.15.4"
+// into the name of the distribution and its release.
+func splitDistro(distro string) (name, release string) {
+	i := strings.LastIndex(distro, "-")
+	if i < 0 {
+		return strings.ToLower(distro), ""
+	}
+	return strings.ToLower(distro[:i]), distro[i+1:]
+}
+
+// cpeDistro returns the distro qualifier of the operating system of a CPE,
+// such as "redhat-8" for cpe:/o:redhat:enterprise_linux:8::baseos, or an
+// empty string if it is not a known operating system.
+func cpeDistro(cpe string) string {
+	var fields []string
+	switch {
+	case strings.HasPrefix(cpe, "cpe:2.3:"):
+		fields = strings.Split(strings.TrimPrefix(cpe, "cpe:2.3:"), ":")
+	case strings.HasPrefix(cpe, "cpe:/"):
+		fields = strings.Split(strings.TrimPrefix(cpe, "cpe:/"), ":")
+	default:
+		return ""
+	}
+	if len(fields) < 4 || fields[0] != "o" {
+		return ""
+	}
+
+	name, known := cpeDistros[fields[1]+":"+fields[2]]
+	if !known || fields[3] == "" || fields[3] == "*" || fields[3] == "-" {
+		return ""
+	}
+	return name + "-" + fields[3]
+}
+
+// firstFields returns at most the n first fields of s separated by sep.
+func firstFields(s, sep string, n int) []string {
+	fields := strings.SplitN(s, sep, n+1)
+	if len(fields) > n {
+		fields = fields[:n]
+	}
+	return fields
+}
@@ -7,7 +7,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"net/http"
 	"strings"
 	log "github.com/sirupsen/logrus"
 	"github.com/MXi4oyu/DockerXScan/database"
@@ -15,12 +14,14 @@ import (
 	"github.com/MXi4oyu/DockerXScan/versionfmt/dpkg"
 	"github.com/MXi4oyu/DockerXScan/vulnsrc"
 	"github.com/MXi4oyu/DockerXScan/common/commonerr"
+	"github.com/MXi4oyu/DockerXScan/common/httputil"
 )
 
 const (
 	url          = "https://security-tracker.debian.org/tracker/data/json"
 	cveURLPrefix = "https://security-tracker.debian.org/tracker"
-	updaterFlag  = "debianUpdater"
+	updaterName  = "debian"
+	updaterFlag  = "hash"
 )
 
 type jsonData map[string]map[string]jsonVuln
@@ -39,21 +40,26 @@ type jsonRel struct {
 type updater struct{}
 
 func init() {
-	vulnsrc.RegisterUpdater("debian", &updater{})
+	vulnsrc.RegisterUpdater(updaterName, &updater{})
 }
 
 func (u *updater) Update(datastore database.Datastore) (resp vulnsrc.UpdateResponse, err error) {
 	log.WithField("package", "Debian").Info("Start fetching vulnerabilities")
 
-	// Download JSON.
-	r, err := http.Get(url)
+	// Download JSON, unless it did not change since the last update.
+	var feedResp vulnsrc.UpdateResponse
+	r, err := vulnsrc.GetFeed(datastore, updaterName, vulnsrc.FeedURL(updaterName, url), &feedResp)
+	if err == httputil.ErrNotModified {
+		log.WithField("package", "Debian").Debug("no update")
+		return resp, nil
+	}
 	if err != nil {
 		log.WithError(err).Error("could not download Debian's update")
-		return resp, commonerr.ErrCouldNotDownload
+		return resp, err
 	}
 
 	// Get the SHA-1 of the latest update's JSON data
-	latestHash, err := datastore.GetKeyValue(updaterFlag)
+	latestHash, err := datastore.GetKeyValueNS(updaterName, updaterFlag)
 	if err != nil {
 		return resp, err
 	}
@@ -63,6 +69,7 @@ func (u *updater) Update(datastore database.Datastore) (resp vulnsrc.UpdateRespo
 	if err != nil {
 		return resp, err
 	}
+	resp.Flags = feedResp.Flags
 
 	return resp, nil
 }
@@ -140,6 +147,7 @@ func parseDebianJSON(data *jsonData) (vulnerabilities []database.Vulnerability,
 						Link:        strings.Join([]string{cveURLPrefix, "/", vulnName}, ""),
 						Severity:    database.UnknownSeverity,
 						Description: vulnNode.Description,
+						Withdrawn:   vulnsrc.IsWithdrawn(vulnNode.Description),
 					}
 				}
 
@@ -1,6 +1,7 @@
 package vulnsrc
 
 import (
+	"strings"
 	"sync"
 	"errors"
 	"github.com/MXi4oyu/DockerXScan/database"
@@ -18,11 +19,18 @@ var (
 )
 
 // UpdateResponse represents the sum of results of an update.
+//
+// Flag names are scoped to the name the Updater is registered with, and are
+// read back with database.Datastore.GetKeyValueNS.
 type UpdateResponse struct {
 	FlagName        string
 	FlagValue       string
 	Notes           []string
 	Vulnerabilities []database.Vulnerability
+
+	// Flags are additional key/values stored with the flag once the
+	// vulnerabilities have been inserted.
+	Flags map[string]string
 }
 
 // Updater represents anything that can fetch vulnerabilities and insert them
@@ -70,4 +78,11 @@ func Updaters() map[string]Updater {
 	}
 
 	return ret
-}
\ No newline at end of file
+}
+
+// IsWithdrawn returns whether a vulnerability description marks the
+// vulnerability as rejected or disputed, as done by the CVE list.
+func IsWithdrawn(description string) bool {
+	description = strings.TrimSpace(description)
+	return strings.HasPrefix(description, "** REJECT **") || strings.HasPrefix(description, "** DISPUTED **")
+}
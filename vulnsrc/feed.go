@@ -0,0 +1,43 @@
+package vulnsrc
+
+import (
+	"net/http"
+
+	"github.com/MXi4oyu/DockerXScan/common/httputil"
+	"github.com/MXi4oyu/DockerXScan/database"
+)
+
+const (
+	etagKey         = "feed/etag"
+	lastModifiedKey = "feed/last-modified"
+)
+
+// GetFeed downloads a feed unless it did not change since the previous
+// download, in which case httputil.ErrNotModified is returned.
+//
+// The ETag and Last-Modified validators of the feed are stored under keys of
+// the component of the updater. They are added to resp.Flags, so that they are
+// only persisted once the vulnerabilities of the response have been inserted.
+func GetFeed(datastore database.Datastore, component, feedURL string, resp *UpdateResponse) (*http.Response, error) {
+	var previous httputil.FeedValidators
+	var err error
+	if previous.ETag, err = datastore.GetKeyValueNS(component, etagKey); err != nil {
+		return nil, err
+	}
+	if previous.LastModified, err = datastore.GetKeyValueNS(component, lastModifiedKey); err != nil {
+		return nil, err
+	}
+
+	r, validators, err := httputil.GetConditionalFeed(feedURL, previous)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.Flags == nil {
+		resp.Flags = make(map[string]string)
+	}
+	resp.Flags[etagKey] = validators.ETag
+	resp.Flags[lastModifiedKey] = validators.LastModified
+
+	return r, nil
+}
@@ -0,0 +1,259 @@
+// Package gentoo implements a vulnerability source updater using the Gentoo
+// Linux Security Advisories.
+package gentoo
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/MXi4oyu/DockerXScan/common/httputil"
+	"github.com/MXi4oyu/DockerXScan/database"
+	"github.com/MXi4oyu/DockerXScan/versionfmt"
+	"github.com/MXi4oyu/DockerXScan/versionfmt/portage"
+	"github.com/MXi4oyu/DockerXScan/vulnsrc"
+)
+
+const (
+	// glsaSnapshotURL is an archive of the repository holding every GLSA.
+	glsaSnapshotURL = "https://gitweb.gentoo.org/data/glsa.git/snapshot/glsa-master.tar.gz"
+	glsaURLPrefix   = "https://security.gentoo.org/glsa/"
+	updaterName     = "gentoo"
+	updaterFlag     = "hash"
+
+	// Namespace is the namespace of Gentoo, a rolling release distribution
+	// with no version.
+	Namespace = "gentoo"
+)
+
+type glsa struct {
+	ID       string    `xml:"id,attr"`
+	Title    string    `xml:"title"`
+	Synopsis string    `xml:"synopsis"`
+	Impact   impact    `xml:"impact"`
+	Packages []pkg     `xml:"affected>package"`
+	URIs     []glsaURI `xml:"references>uri"`
+}
+
+type impact struct {
+	Type string `xml:"type,attr"`
+}
+
+type pkg struct {
+	Name       string         `xml:"name,attr"`
+	Unaffected []versionRange `xml:"unaffected"`
+	Vulnerable []versionRange `xml:"vulnerable"`
+}
+
+type versionRange struct {
+	Range   string `xml:"range,attr"`
+	Version string `xml:",chardata"`
+}
+
+type glsaURI struct {
+	Link string `xml:"link,attr"`
+	Name string `xml:",chardata"`
+}
+
+type updater struct{}
+
+func init() {
+	vulnsrc.RegisterUpdater(updaterName, &updater{})
+}
+
+func (u *updater) Update(datastore database.Datastore) (resp vulnsrc.UpdateResponse, err error) {
+	log.WithField("package", "Gentoo").Info("Start fetching vulnerabilities")
+
+	r, err := httputil.GetFeed(vulnsrc.FeedURL(updaterName, glsaSnapshotURL))
+	if err != nil {
+		log.WithError(err).Error("could not download Gentoo's GLSA")
+		return resp, err
+	}
+
+	files, err := readSnapshot(r.Body)
+	if err != nil {
+		log.WithError(err).Error("could not read Gentoo's GLSA")
+		return resp, err
+	}
+
+	// Short-circuit if no advisory changed since the last update.
+	hash := hashFiles(files)
+	dbHash, err := datastore.GetKeyValueNS(updaterName, updaterFlag)
+	if err != nil {
+		return resp, err
+	}
+	if hash == dbHash {
+		log.WithField("package", "Gentoo").Debug("no update")
+		return resp, nil
+	}
+
+	for name, content := range files {
+		v, err := parseGLSA(content)
+		if err != nil {
+			log.WithError(err).WithField("file", name).Warning("could not parse GLSA. skipping")
+			continue
+		}
+		if v != nil {
+			resp.Vulnerabilities = append(resp.Vulnerabilities, *v)
+		}
+	}
+
+	resp.FlagName = updaterFlag
+	resp.FlagValue = hash
+
+	return resp, nil
+}
+
+func (u *updater) Clean() {}
+
+// readSnapshot returns the content of every GLSA of a gzipped tarball,
+// indexed by file name.
+func readSnapshot(r io.Reader) (map[string][]byte, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	files := make(map[string][]byte)
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		name := path.Base(hdr.Name)
+		if hdr.Typeflag != tar.TypeReg || !strings.HasPrefix(name, "glsa-") || !strings.HasSuffix(name, ".xml") {
+			continue
+		}
+
+		content, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		files[name] = content
+	}
+
+	return files, nil
+}
+
+// hashFiles returns a digest of the names and contents of files, independent
+// of the archive they came from.
+func hashFiles(files map[string][]byte) string {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	h := sha256.New()
+	for _, name := range names {
+		io.WriteString(h, name)
+		h.Write([]byte{0})
+		h.Write(files[name])
+		h.Write([]byte{0})
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// parseGLSA converts an advisory to a Vulnerability, or returns nil if it
+// does not affect any package.
+func parseGLSA(content []byte) (*database.Vulnerability, error) {
+	var advisory glsa
+	if err := xml.Unmarshal(content, &advisory); err != nil {
+		return nil, err
+	}
+
+	v := database.Vulnerability{
+		Name:        "GLSA-" + advisory.ID,
+		Link:        glsaURLPrefix + advisory.ID,
+		Severity:    severity(advisory.Impact.Type),
+		Description: strings.TrimSpace(advisory.Synopsis),
+		Namespace: database.Namespace{
+			Name:          Namespace,
+			VersionFormat: portage.ParserName,
+		},
+	}
+	if v.Description == "" {
+		v.Description = strings.TrimSpace(advisory.Title)
+	}
+
+	for _, p := range advisory.Packages {
+		if p.Name == "" {
+			continue
+		}
+
+		v.FixedIn = append(v.FixedIn, database.FeatureVersion{
+			Feature: database.Feature{
+				Name:      p.Name,
+				Namespace: v.Namespace,
+			},
+			Version: fixedVersion(p),
+		})
+	}
+	if len(v.FixedIn) == 0 {
+		return nil, nil
+	}
+
+	return &v, nil
+}
+
+// fixedVersion returns the version from which a package is no longer
+// vulnerable. When several slots are fixed, the highest version is used, at
+// the cost of reporting the older slots as vulnerable until upgraded.
+func fixedVersion(p pkg) string {
+	fixed := ""
+	for _, r := range p.Unaffected {
+		if r.Range != "ge" && r.Range != "rge" {
+			continue
+		}
+
+		version := strings.TrimSpace(r.Version)
+		if err := versionfmt.Valid(portage.ParserName, version); err != nil {
+			log.WithError(err).WithField("version", version).Warning("could not parse package version. skipping")
+			continue
+		}
+
+		if fixed == "" {
+			fixed = version
+			continue
+		}
+		if cmp, err := versionfmt.Compare(portage.ParserName, version, fixed); err == nil && cmp > 0 {
+			fixed = version
+		}
+	}
+
+	if fixed == "" {
+		// There is no fix, every version is vulnerable.
+		return versionfmt.MaxVersion
+	}
+
+	return fixed
+}
+
+func severity(impactType string) database.Severity {
+	switch strings.ToLower(impactType) {
+	case "high":
+		return database.HighSeverity
+	case "normal":
+		return database.MediumSeverity
+	case "low":
+		return database.LowSeverity
+	default:
+		return database.UnknownSeverity
+	}
+}
@@ -0,0 +1,76 @@
+package vulnsrc
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	feedURLsM sync.RWMutex
+	feedURLs  = make(map[string]string)
+)
+
+// SetFeedURLs overrides, by name of Updater, the URLs from which the Updaters
+// fetch their vulnerabilities, such as to point them at internal mirrors. It
+// fails without changing anything if a name is not registered or a URL is
+// malformed.
+func SetFeedURLs(urls map[string]string) error {
+	if errs := ValidateFeedURLs(urls); len(errs) > 0 {
+		return errs[0]
+	}
+
+	feedURLsM.Lock()
+	defer feedURLsM.Unlock()
+
+	feedURLs = make(map[string]string, len(urls))
+	for name, rawurl := range urls {
+		feedURLs[name] = rawurl
+		log.WithFields(log.Fields{"updater": name, "url": rawurl}).Info("updater uses a mirror")
+	}
+
+	return nil
+}
+
+// ValidateFeedURLs returns the problems of the feed URLs that SetFeedURLs
+// would reject, sorted by name of Updater: the unknown Updaters and the
+// invalid URLs.
+func ValidateFeedURLs(urls map[string]string) []error {
+	names := make([]string, 0, len(urls))
+	for name := range urls {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var errs []error
+	registered := Updaters()
+	for _, name := range names {
+		if _, exists := registered[name]; !exists {
+			errs = append(errs, fmt.Errorf("vulnsrc: unknown Updater %q", name))
+			continue
+		}
+		u, err := url.Parse(urls[name])
+		if err != nil || u.Scheme == "" || (u.Host == "" && u.Scheme != "file") {
+			errs = append(errs, fmt.Errorf("vulnsrc: invalid feed URL for %s: %q", name, urls[name]))
+		}
+	}
+	return errs
+}
+
+// FeedURL returns the URL from which an Updater fetches its vulnerabilities:
+// the one configured for it, or else defaultURL.
+func FeedURL(name, defaultURL string) string {
+	feedURLsM.RLock()
+	feedURL, overridden := feedURLs[name]
+	feedURLsM.RUnlock()
+
+	if !overridden {
+		feedURL = defaultURL
+	}
+	log.WithFields(log.Fields{"updater": name, "url": feedURL, "mirror": overridden}).Debug("fetching vulnerabilities")
+
+	return feedURL
+}
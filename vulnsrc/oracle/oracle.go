@@ -4,10 +4,10 @@ import (
 	"bufio"
 	"encoding/xml"
 	"io"
-	"net/http"
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 	log "github.com/sirupsen/logrus"
 	"fmt"
 	"github.com/MXi4oyu/DockerXScan/database"
@@ -15,6 +15,7 @@ import (
 	"github.com/MXi4oyu/DockerXScan/versionfmt/rpm"
 	"github.com/MXi4oyu/DockerXScan/vulnsrc"
 	"github.com/MXi4oyu/DockerXScan/common/commonerr"
+	"github.com/MXi4oyu/DockerXScan/common/httputil"
 )
 
 
@@ -22,7 +23,8 @@ const (
 	firstOracle5ELSA = 20070057
 	ovalURI          = "https://linux.oracle.com/oval/"
 	elsaFilePrefix   = "com.oracle.elsa-"
-	updaterFlag      = "oracleUpdater"
+	updaterName      = "oracle"
+	updaterFlag      = "last-elsa"
 )
 
 var (
@@ -43,9 +45,14 @@ type definition struct {
 	Description string      `xml:"metadata>description"`
 	References  []reference `xml:"metadata>reference"`
 	Criteria    criteria    `xml:"criteria"`
+	Issued      issued      `xml:"metadata>advisory>issued"`
 	Severity    string      `xml:"metadata>advisory>severity"`
 }
 
+type issued struct {
+	Date string `xml:"date,attr"`
+}
+
 type reference struct {
 	Source string `xml:"source,attr"`
 	URI    string `xml:"ref_url,attr"`
@@ -64,7 +71,7 @@ type criterion struct {
 type updater struct{}
 
 func init() {
-	vulnsrc.RegisterUpdater("oracle", &updater{})
+	vulnsrc.RegisterUpdater(updaterName, &updater{})
 }
 
 func compareELSA(left, right int) int {
@@ -100,7 +107,7 @@ func compareELSA(left, right int) int {
 func (u *updater) Update(datastore database.Datastore) (resp vulnsrc.UpdateResponse, err error) {
 	log.WithField("package", "Oracle Linux").Info("Start fetching vulnerabilities")
 	// Get the first ELSA we have to manage.
-	flagValue, err := datastore.GetKeyValue(updaterFlag)
+	flagValue, err := datastore.GetKeyValueNS(updaterName, updaterFlag)
 	if err != nil {
 		return resp, err
 	}
@@ -110,11 +117,22 @@ func (u *updater) Update(datastore database.Datastore) (resp vulnsrc.UpdateRespo
 		firstELSA = firstOracle5ELSA
 	}
 
-	// Fetch the update list.
-	r, err := http.Get(ovalURI)
+	// The files of the advisories are listed in, and relative to, the
+	// directory of the OVAL definitions.
+	baseURI := vulnsrc.FeedURL(updaterName, ovalURI)
+	if !strings.HasSuffix(baseURI, "/") {
+		baseURI += "/"
+	}
+
+	// Fetch the update list, unless it did not change since the last update.
+	r, err := vulnsrc.GetFeed(datastore, updaterName, baseURI, &resp)
+	if err == httputil.ErrNotModified {
+		log.WithField("package", "Oracle Linux").Debug("no update")
+		return resp, nil
+	}
 	if err != nil {
 		log.WithError(err).Error("could not download Oracle's update list")
-		return resp, commonerr.ErrCouldNotDownload
+		return resp, err
 	}
 	defer r.Body.Close()
 
@@ -134,10 +152,10 @@ func (u *updater) Update(datastore database.Datastore) (resp vulnsrc.UpdateRespo
 
 	for _, elsa := range elsaList {
 		// Download the ELSA's XML file.
-		r, err := http.Get(ovalURI + elsaFilePrefix + strconv.Itoa(elsa) + ".xml")
+		r, err := httputil.GetFeed(baseURI + elsaFilePrefix + strconv.Itoa(elsa) + ".xml")
 		if err != nil {
 			log.WithError(err).Error("could not download Oracle's update list")
-			return resp, commonerr.ErrCouldNotDownload
+			return resp, err
 		}
 
 		// Parse the XML.
@@ -190,10 +208,11 @@ func parseELSA(ovalReader io.Reader) (vulnerabilities []database.Vulnerability,
 		pkgs := toFeatureVersions(definition.Criteria)
 		if len(pkgs) > 0 {
 			vulnerability := database.Vulnerability{
-				Name:        name(definition),
-				Link:        link(definition),
-				Severity:    severity(definition),
-				Description: description(definition),
+				Name:          name(definition),
+				Link:          link(definition),
+				Severity:      severity(definition),
+				Description:   description(definition),
+				PublishedDate: publishedDate(definition),
 			}
 			for _, p := range pkgs {
 				vulnerability.FixedIn = append(vulnerability.FixedIn, p)
@@ -341,6 +360,13 @@ func description(def definition) (desc string) {
 	return
 }
 
+// publishedDate returns the date the advisory was issued, or the zero time if
+// it is missing.
+func publishedDate(def definition) time.Time {
+	t, _ := time.Parse("2006-01-02", def.Issued.Date)
+	return t
+}
+
 func name(def definition) string {
 	return strings.TrimSpace(def.Title[:strings.Index(def.Title, ": ")])
 }
@@ -5,10 +5,10 @@ import (
 	"encoding/xml"
 	"fmt"
 	"io"
-	"net/http"
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 	log "github.com/sirupsen/logrus"
 	"github.com/MXi4oyu/DockerXScan/database"
 	"github.com/MXi4oyu/DockerXScan/versionfmt"
@@ -16,6 +16,7 @@ import (
 	"github.com/MXi4oyu/DockerXScan/vulnsrc"
 
 	"github.com/MXi4oyu/DockerXScan/common/commonerr"
+	"github.com/MXi4oyu/DockerXScan/common/httputil"
 )
 
 const (
@@ -25,7 +26,8 @@ const (
 
 	ovalURI        = "https://www.redhat.com/security/data/oval/"
 	rhsaFilePrefix = "com.redhat.rhsa-"
-	updaterFlag    = "rhelUpdater"
+	updaterName    = "rhel"
+	updaterFlag    = "last-rhsa"
 )
 
 var (
@@ -48,6 +50,11 @@ type definition struct {
 	Description string      `xml:"metadata>description"`
 	References  []reference `xml:"metadata>reference"`
 	Criteria    criteria    `xml:"criteria"`
+	Issued      issued      `xml:"metadata>advisory>issued"`
+}
+
+type issued struct {
+	Date string `xml:"date,attr"`
 }
 
 type reference struct {
@@ -68,13 +75,13 @@ type criterion struct {
 type updater struct{}
 
 func init() {
-	vulnsrc.RegisterUpdater("rhel", &updater{})
+	vulnsrc.RegisterUpdater(updaterName, &updater{})
 }
 
 func (u *updater) Update(datastore database.Datastore) (resp vulnsrc.UpdateResponse, err error) {
 	log.WithField("package", "RHEL").Info("Start fetching vulnerabilities")
 	// Get the first RHSA we have to manage.
-	flagValue, err := datastore.GetKeyValue(updaterFlag)
+	flagValue, err := datastore.GetKeyValueNS(updaterName, updaterFlag)
 	if err != nil {
 		return resp, err
 	}
@@ -83,11 +90,22 @@ func (u *updater) Update(datastore database.Datastore) (resp vulnsrc.UpdateRespo
 		firstRHSA = firstRHEL5RHSA
 	}
 
-	// Fetch the update list.
-	r, err := http.Get(ovalURI)
+	// The files of the advisories are listed in, and relative to, the
+	// directory of the OVAL definitions.
+	baseURI := vulnsrc.FeedURL(updaterName, ovalURI)
+	if !strings.HasSuffix(baseURI, "/") {
+		baseURI += "/"
+	}
+
+	// Fetch the update list, unless it did not change since the last update.
+	r, err := vulnsrc.GetFeed(datastore, updaterName, baseURI, &resp)
+	if err == httputil.ErrNotModified {
+		log.WithField("package", "Red Hat").Debug("no update")
+		return resp, nil
+	}
 	if err != nil {
 		log.WithError(err).Error("could not download RHEL's update list")
-		return resp, commonerr.ErrCouldNotDownload
+		return resp, err
 	}
 
 	// Get the list of RHSAs that we have to process.
@@ -106,10 +124,10 @@ func (u *updater) Update(datastore database.Datastore) (resp vulnsrc.UpdateRespo
 
 	for _, rhsa := range rhsaList {
 		// Download the RHSA's XML file.
-		r, err := http.Get(ovalURI + rhsaFilePrefix + strconv.Itoa(rhsa) + ".xml")
+		r, err := httputil.GetFeed(baseURI + rhsaFilePrefix + strconv.Itoa(rhsa) + ".xml")
 		if err != nil {
 			log.WithError(err).Error("could not download RHEL's update list")
-			return resp, commonerr.ErrCouldNotDownload
+			return resp, err
 		}
 
 		// Parse the XML.
@@ -153,10 +171,11 @@ func parseRHSA(ovalReader io.Reader) (vulnerabilities []database.Vulnerability,
 		pkgs := toFeatureVersions(definition.Criteria)
 		if len(pkgs) > 0 {
 			vulnerability := database.Vulnerability{
-				Name:        name(definition),
-				Link:        link(definition),
-				Severity:    severity(definition),
-				Description: description(definition),
+				Name:          name(definition),
+				Link:          link(definition),
+				Severity:      severity(definition),
+				Description:   description(definition),
+				PublishedDate: publishedDate(definition),
 			}
 			for _, p := range pkgs {
 				vulnerability.FixedIn = append(vulnerability.FixedIn, p)
@@ -309,6 +328,13 @@ func description(def definition) (desc string) {
 	return
 }
 
+// publishedDate returns the date the advisory was issued, or the zero time if
+// it is missing.
+func publishedDate(def definition) time.Time {
+	t, _ := time.Parse("2006-01-02", def.Issued.Date)
+	return t
+}
+
 func name(def definition) string {
 	return strings.TrimSpace(def.Title[:strings.Index(def.Title, ": ")])
 }
@@ -0,0 +1,83 @@
+package rustsec
+
+import (
+	"math"
+	"strings"
+)
+
+// The weights of the metrics of the CVSS v3 base score.
+var (
+	cvssAttackVector      = map[string]float64{"N": 0.85, "A": 0.62, "L": 0.55, "P": 0.2}
+	cvssAttackComplexity  = map[string]float64{"L": 0.77, "H": 0.44}
+	cvssUserInteraction   = map[string]float64{"N": 0.85, "R": 0.62}
+	cvssImpact            = map[string]float64{"H": 0.56, "L": 0.22, "N": 0}
+	cvssPrivileges        = map[string]float64{"N": 0.85, "L": 0.62, "H": 0.27}
+	cvssPrivilegesChanged = map[string]float64{"N": 0.85, "L": 0.68, "H": 0.5}
+)
+
+// cvss3BaseScore computes the base score of a CVSS v3.0 or v3.1 vector, such
+// as "CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:H", which advisories give
+// instead of a score.
+func cvss3BaseScore(vector string) (float64, bool) {
+	parts := strings.Split(vector, "/")
+	if len(parts) < 9 || (parts[0] != "CVSS:3.0" && parts[0] != "CVSS:3.1") {
+		return 0, false
+	}
+
+	metrics := make(map[string]string)
+	for _, part := range parts[1:] {
+		kv := strings.SplitN(part, ":", 2)
+		if len(kv) != 2 {
+			return 0, false
+		}
+		metrics[kv[0]] = kv[1]
+	}
+
+	changed := metrics["S"] == "C"
+	if !changed && metrics["S"] != "U" {
+		return 0, false
+	}
+	privileges := cvssPrivileges
+	if changed {
+		privileges = cvssPrivilegesChanged
+	}
+
+	av, ok1 := cvssAttackVector[metrics["AV"]]
+	ac, ok2 := cvssAttackComplexity[metrics["AC"]]
+	pr, ok3 := privileges[metrics["PR"]]
+	ui, ok4 := cvssUserInteraction[metrics["UI"]]
+	c, ok5 := cvssImpact[metrics["C"]]
+	i, ok6 := cvssImpact[metrics["I"]]
+	a, ok7 := cvssImpact[metrics["A"]]
+	if !(ok1 && ok2 && ok3 && ok4 && ok5 && ok6 && ok7) {
+		return 0, false
+	}
+
+	iss := 1 - (1-c)*(1-i)*(1-a)
+	var impact float64
+	if changed {
+		impact = 7.52*(iss-0.029) - 3.25*math.Pow(iss-0.02, 15)
+	} else {
+		impact = 6.42 * iss
+	}
+	if impact <= 0 {
+		return 0, true
+	}
+
+	score := impact + 8.22*av*ac*pr*ui
+	if changed {
+		score *= 1.08
+	}
+
+	return roundUp(math.Min(score, 10)), true
+}
+
+// roundUp returns the smallest number with one decimal that is greater than
+// or equal to x, as specified by CVSS v3.1 to avoid floating point errors.
+func roundUp(x float64) float64 {
+	n := int64(math.Round(x * 100000))
+	if n%10000 == 0 {
+		return float64(n) / 100000
+	}
+	return float64(n/10000+1) / 10
+}
@@ -0,0 +1,324 @@
+// Package rustsec implements a vulnerability source updater using the RustSec
+// advisory database of the Rust crates.
+package rustsec
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/MXi4oyu/DockerXScan/common/httputil"
+	"github.com/MXi4oyu/DockerXScan/database"
+	"github.com/MXi4oyu/DockerXScan/featurefmt/cargo"
+	"github.com/MXi4oyu/DockerXScan/versionfmt"
+	"github.com/MXi4oyu/DockerXScan/versionfmt/semver"
+	"github.com/MXi4oyu/DockerXScan/vulnmdsrc/nvd"
+	"github.com/MXi4oyu/DockerXScan/vulnsrc"
+)
+
+const (
+	// advisoryDBURL is an archive of the repository holding every advisory.
+	advisoryDBURL = "https://github.com/rustsec/advisory-db/archive/refs/heads/main.tar.gz"
+	advisoryURL   = "https://rustsec.org/advisories/"
+	updaterName   = "rustsec"
+	updaterFlag   = "hash"
+)
+
+// advisory is the metadata of a RustSec advisory, held in the TOML front
+// matter of its Markdown file.
+type advisory struct {
+	ID            string
+	Package       string
+	Date          string
+	URL           string
+	CVSS          string
+	Informational string
+	Withdrawn     string
+	Patched       []string
+	Unaffected    []string
+	Title         string
+	Description   string
+}
+
+type updater struct{}
+
+func init() {
+	vulnsrc.RegisterUpdater(updaterName, &updater{})
+}
+
+func (u *updater) Update(datastore database.Datastore) (resp vulnsrc.UpdateResponse, err error) {
+	log.WithField("package", "RustSec").Info("Start fetching vulnerabilities")
+
+	r, err := httputil.GetFeed(vulnsrc.FeedURL(updaterName, advisoryDBURL))
+	if err != nil {
+		log.WithError(err).Error("could not download the RustSec advisory database")
+		return resp, err
+	}
+	defer r.Body.Close()
+
+	files, err := readSnapshot(r.Body)
+	if err != nil {
+		log.WithError(err).Error("could not read the RustSec advisory database")
+		return resp, err
+	}
+
+	// Short-circuit if no advisory changed since the last update.
+	hash := hashFiles(files)
+	dbHash, err := datastore.GetKeyValueNS(updaterName, updaterFlag)
+	if err != nil {
+		return resp, err
+	}
+	if hash == dbHash {
+		log.WithField("package", "RustSec").Debug("no update")
+		return resp, nil
+	}
+
+	for name, content := range files {
+		a, err := parseAdvisory(content)
+		if err != nil {
+			log.WithError(err).WithField("file", name).Warning("could not parse RustSec advisory. skipping")
+			continue
+		}
+		if v := a.vulnerability(); v != nil {
+			resp.Vulnerabilities = append(resp.Vulnerabilities, *v)
+		}
+	}
+
+	resp.FlagName = updaterFlag
+	resp.FlagValue = hash
+
+	return resp, nil
+}
+
+func (u *updater) Clean() {}
+
+// readSnapshot returns the content of every advisory of a gzipped tarball of
+// the database, indexed by file name.
+func readSnapshot(r io.Reader) (map[string][]byte, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	files := make(map[string][]byte)
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// Advisories are stored as crates/<crate>/RUSTSEC-YYYY-NNNN.md.
+		name := path.Base(hdr.Name)
+		if hdr.Typeflag != tar.TypeReg || !strings.Contains(hdr.Name, "/crates/") || !strings.HasPrefix(name, "RUSTSEC-") || !strings.HasSuffix(name, ".md") {
+			continue
+		}
+
+		content, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		files[name] = content
+	}
+
+	return files, nil
+}
+
+// hashFiles returns a digest of the names and contents of files, independent
+// of the archive they came from.
+func hashFiles(files map[string][]byte) string {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	h := sha256.New()
+	for _, name := range names {
+		io.WriteString(h, name)
+		h.Write([]byte{0})
+		h.Write(files[name])
+		h.Write([]byte{0})
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// parseAdvisory parses the Markdown file of an advisory, which starts with a
+// ```toml block holding its metadata, followed by its title and description.
+func parseAdvisory(content []byte) (advisory, error) {
+	var a advisory
+
+	text := strings.Replace(string(content), "\r\n", "\n", -1)
+	if !strings.HasPrefix(text, "```toml\n") {
+		return a, errors.New("rustsec: advisory has no TOML front matter")
+	}
+	text = strings.TrimPrefix(text, "```toml\n")
+	end := strings.Index(text, "\n```")
+	if end < 0 {
+		return a, errors.New("rustsec: advisory has an unterminated TOML front matter")
+	}
+
+	tables, err := parseTOML(text[:end])
+	if err != nil {
+		return a, err
+	}
+
+	a.ID = tables["advisory"]["id"].str
+	a.Package = tables["advisory"]["package"].str
+	a.Date = tables["advisory"]["date"].str
+	a.URL = tables["advisory"]["url"].str
+	a.CVSS = tables["advisory"]["cvss"].str
+	a.Informational = tables["advisory"]["informational"].str
+	a.Withdrawn = tables["advisory"]["withdrawn"].str
+	a.Patched = tables["versions"]["patched"].list
+	a.Unaffected = tables["versions"]["unaffected"].list
+	if a.ID == "" || a.Package == "" {
+		return a, errors.New("rustsec: advisory has no id or package")
+	}
+
+	// The Markdown body is "# Title" followed by the description.
+	body := strings.TrimSpace(text[end+len("\n```"):])
+	if strings.HasPrefix(body, "# ") {
+		lines := strings.SplitN(body, "\n", 2)
+		a.Title = strings.TrimSpace(strings.TrimPrefix(lines[0], "# "))
+		if len(lines) == 2 {
+			body = lines[1]
+		} else {
+			body = ""
+		}
+	}
+	a.Description = strings.TrimSpace(body)
+
+	return a, nil
+}
+
+// vulnerability converts an advisory to a Vulnerability of the cargo
+// namespace, or returns nil when it can't be matched against crate versions.
+func (a advisory) vulnerability() *database.Vulnerability {
+	v := database.Vulnerability{
+		Name:        a.ID,
+		Link:        advisoryURL + a.ID,
+		Description: a.Description,
+		Severity:    a.severity(),
+		Withdrawn:   a.Withdrawn != "",
+		Namespace: database.Namespace{
+			Name:          cargo.NamespaceName,
+			VersionFormat: semver.ParserName,
+			Kind:          database.LanguageNamespace,
+		},
+	}
+	if v.Description == "" {
+		v.Description = a.Title
+	}
+	if t, err := time.Parse("2006-01-02", a.Date); err == nil {
+		v.PublishedDate = t
+	}
+
+	fixed, exact := fixedVersion(a.Patched)
+	v.FixedIn = []database.FeatureVersion{{
+		Feature: database.Feature{
+			Name:      a.Package,
+			Namespace: v.Namespace,
+		},
+		Version: fixed,
+	}}
+
+	// The versions before the fixed version are all reported as vulnerable,
+	// including those that the unaffected requirements leave out.
+	if !exact || len(a.Unaffected) > 0 {
+		v.Confidence = database.LowConfidence
+	}
+
+	return &v
+}
+
+// severity returns the severity of the CVSS v3 base score of an advisory.
+// Informational advisories, such as unmaintained crates, are negligible.
+func (a advisory) severity() database.Severity {
+	if a.Informational != "" {
+		return database.NegligibleSeverity
+	}
+	if score, ok := cvss3BaseScore(a.CVSS); ok {
+		return nvd.SeverityFromCVSS(score)
+	}
+	return database.UnknownSeverity
+}
+
+// fixedVersion returns the version from which a crate is no longer
+// vulnerable, the lower bound of its patched requirements, and whether the
+// patched versions are exactly those from it. When several releases are
+// patched, the highest version is used, at the cost of reporting the older
+// maintained releases as vulnerable until upgraded; the upper bound of a
+// requirement, such as that of "^1.2.3", and the requirements that can't be
+// parsed are ignored. All of these only approximate the patched versions.
+func fixedVersion(patched []string) (string, bool) {
+	fixed := ""
+	exact := len(patched) <= 1
+	for _, requirement := range patched {
+		version := lowerBound(requirement)
+		if err := versionfmt.Valid(semver.ParserName, version); err != nil {
+			log.WithField("requirement", requirement).Warning("could not parse patched version. skipping")
+			exact = false
+			continue
+		}
+		if comparators := strings.Split(requirement, ","); len(comparators) != 1 || !strings.HasPrefix(strings.TrimSpace(comparators[0]), ">=") {
+			exact = false
+		}
+
+		if fixed == "" {
+			fixed = version
+			continue
+		}
+		if cmp, err := versionfmt.Compare(semver.ParserName, version, fixed); err == nil && cmp > 0 {
+			fixed = version
+		}
+	}
+
+	if fixed == "" {
+		// There is no fix, every version is vulnerable.
+		return versionfmt.MaxVersion, exact
+	}
+
+	return fixed, exact
+}
+
+// lowerBound returns the minimum version of a Cargo version requirement, such
+// as "1.2.3" for ">= 1.2.3, < 2" or "^1.2.3", completing the partial versions
+// with zeros.
+func lowerBound(requirement string) string {
+	for _, comparator := range strings.Split(requirement, ",") {
+		comparator = strings.TrimSpace(comparator)
+		switch {
+		case strings.HasPrefix(comparator, ">="):
+			return completeVersion(strings.TrimPrefix(comparator, ">="))
+		case strings.HasPrefix(comparator, "^"), strings.HasPrefix(comparator, "~"), strings.HasPrefix(comparator, "="):
+			return completeVersion(strings.TrimLeft(comparator, "^~="))
+		case comparator != "" && comparator[0] >= '0' && comparator[0] <= '9':
+			return completeVersion(comparator)
+		}
+	}
+	return ""
+}
+
+func completeVersion(version string) string {
+	version = strings.TrimSpace(version)
+	for i := strings.Count(version, "."); i < 2 && !strings.Contains(version, "-"); i++ {
+		version += ".0"
+	}
+	return version
+}
@@ -0,0 +1,62 @@
+package rustsec
+
+import (
+	"testing"
+
+	"github.com/MXi4oyu/DockerXScan/database"
+	"github.com/MXi4oyu/DockerXScan/versionfmt"
+)
+
+func TestFixedVersion(t *testing.T) {
+	tests := []struct {
+		patched []string
+		fixed   string
+		exact   bool
+	}{
+		{nil, versionfmt.MaxVersion, true},
+		{[]string{">= 1.2.3"}, "1.2.3", true},
+		{[]string{">= 1.2"}, "1.2.0", true},
+		// Versions from 2.0.0 aren't patched, but don't match.
+		{[]string{"^1.2.3"}, "1.2.3", false},
+		{[]string{">= 1.2.3, < 2"}, "1.2.3", false},
+		// The 1.x releases patched by 1.8.4 are reported as vulnerable.
+		{[]string{">= 1.8.4, < 2.0.0", ">= 2.1.0"}, "2.1.0", false},
+		{[]string{">= 2.1.0", "1.8.4"}, "2.1.0", false},
+		// A requirement that can't be parsed is skipped.
+		{[]string{">= 1.2.3", "< abc"}, "1.2.3", false},
+		{[]string{"< abc"}, versionfmt.MaxVersion, false},
+	}
+
+	for _, test := range tests {
+		fixed, exact := fixedVersion(test.patched)
+		if fixed != test.fixed || exact != test.exact {
+			t.Errorf("fixedVersion(%q) = %q, %t, want %q, %t", test.patched, fixed, exact, test.fixed, test.exact)
+		}
+	}
+}
+
+func TestVulnerabilityConfidence(t *testing.T) {
+	const front = "```toml\n[advisory]\nid = \"RUSTSEC-2021-0001\"\npackage = \"crate\"\ndate = \"2021-01-01\"\n\n[versions]\n"
+	tests := []struct {
+		name       string
+		versions   string
+		confidence database.Confidence
+	}{
+		{"one lower bound", "patched = [\">= 1.2.3\"]\n", ""},
+		{"no fix", "patched = []\n", ""},
+		{"several releases", "patched = [\">= 1.8.4, < 2.0.0\", \">= 2.1.0\"]\n", database.LowConfidence},
+		// The versions before 0.5.0 are reported as vulnerable too.
+		{"unaffected versions", "patched = [\">= 1.2.3\"]\nunaffected = [\"< 0.5.0\"]\n", database.LowConfidence},
+	}
+
+	for _, test := range tests {
+		a, err := parseAdvisory([]byte(front + test.versions + "```\n\n# Title\n\nDescription.\n"))
+		if err != nil {
+			t.Fatalf("%s: parseAdvisory() failed: %s", test.name, err)
+		}
+		v := a.vulnerability()
+		if v.Confidence != test.confidence {
+			t.Errorf("%s: vulnerability() has the confidence %q, want %q", test.name, v.Confidence, test.confidence)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package rustsec
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// tomlValue is a string or an array of strings, the only values of the front
+// matter of the advisories that are read. Other values are kept as strings.
+type tomlValue struct {
+	str  string
+	list []string
+}
+
+// parseTOML parses the subset of TOML used by the front matter of the
+// advisories: tables of keys set to strings, dates or arrays of strings,
+// which may span several lines. It returns the values by table and key, the
+// keys set before any table being in the "" table.
+func parseTOML(text string) (map[string]map[string]tomlValue, error) {
+	tables := map[string]map[string]tomlValue{"": {}}
+	table := ""
+
+	lines := strings.Split(text, "\n")
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") {
+			table = strings.TrimSpace(strings.Trim(line, "[]"))
+			if _, ok := tables[table]; !ok {
+				tables[table] = make(map[string]tomlValue)
+			}
+			continue
+		}
+
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 {
+			return nil, errors.New("rustsec: invalid TOML line " + strconv.Quote(line))
+		}
+		key, raw := strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])
+
+		// Join the lines of an array until it is closed.
+		if strings.HasPrefix(raw, "[") {
+			raw = stripComment(raw)
+			for !arrayClosed(raw) {
+				i++
+				if i >= len(lines) {
+					return nil, errors.New("rustsec: unterminated TOML array " + key)
+				}
+				raw += " " + stripComment(strings.TrimSpace(lines[i]))
+			}
+
+			list, err := parseStringArray(raw)
+			if err != nil {
+				return nil, err
+			}
+			tables[table][key] = tomlValue{list: list}
+			continue
+		}
+
+		str, err := parseString(raw)
+		if err != nil {
+			return nil, err
+		}
+		tables[table][key] = tomlValue{str: str}
+	}
+
+	return tables, nil
+}
+
+// arrayClosed returns whether an array has as many closing brackets as
+// opening ones, outside of its strings.
+func arrayClosed(raw string) bool {
+	depth, inString := 0, false
+	for i := 0; i < len(raw); i++ {
+		switch c := raw[i]; {
+		case inString && c == '\\':
+			i++
+		case c == '"':
+			inString = !inString
+		case !inString && c == '[':
+			depth++
+		case !inString && c == ']':
+			depth--
+		}
+	}
+	return depth == 0
+}
+
+func parseStringArray(raw string) ([]string, error) {
+	inner := strings.TrimSpace(raw[1 : len(raw)-1])
+
+	var list []string
+	for inner != "" {
+		if inner[0] == ',' {
+			inner = strings.TrimSpace(inner[1:])
+			continue
+		}
+		if inner[0] != '"' {
+			return nil, errors.New("rustsec: unsupported TOML array " + strconv.Quote(raw))
+		}
+
+		end := closingQuote(inner)
+		if end < 0 {
+			return nil, errors.New("rustsec: unterminated TOML string " + strconv.Quote(inner))
+		}
+		str, err := strconv.Unquote(inner[:end+1])
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, str)
+		inner = strings.TrimSpace(inner[end+1:])
+	}
+
+	return list, nil
+}
+
+// parseString parses a basic or literal string, or returns a bare value, such
+// as a date or a number, as is.
+func parseString(raw string) (string, error) {
+	switch {
+	case strings.HasPrefix(raw, `"`):
+		end := closingQuote(raw)
+		if end < 0 {
+			return "", errors.New("rustsec: unterminated TOML string " + strconv.Quote(raw))
+		}
+		return strconv.Unquote(raw[:end+1])
+	case strings.HasPrefix(raw, "'"):
+		end := strings.Index(raw[1:], "'")
+		if end < 0 {
+			return "", errors.New("rustsec: unterminated TOML string " + strconv.Quote(raw))
+		}
+		return raw[1 : end+1], nil
+	default:
+		if i := strings.Index(raw, "#"); i >= 0 {
+			raw = raw[:i]
+		}
+		return strings.TrimSpace(raw), nil
+	}
+}
+
+// stripComment removes the comment ending a line, outside of its strings.
+func stripComment(line string) string {
+	inString := false
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case inString && c == '\\':
+			i++
+		case c == '"':
+			inString = !inString
+		case !inString && c == '#':
+			return strings.TrimSpace(line[:i])
+		}
+	}
+	return line
+}
+
+// closingQuote returns the index of the quote closing the basic string that
+// s starts with, or -1.
+func closingQuote(s string) int {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+	return -1
+}
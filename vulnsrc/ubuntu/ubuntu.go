@@ -11,6 +11,7 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 	log "github.com/sirupsen/logrus"
 	"github.com/MXi4oyu/DockerXScan/database"
 	"github.com/MXi4oyu/DockerXScan/versionfmt"
@@ -22,7 +23,8 @@ import (
 const (
 	trackerURI        = "https://launchpad.net/ubuntu-cve-tracker"
 	trackerRepository = "https://launchpad.net/ubuntu-cve-tracker"
-	updaterFlag       = "ubuntuUpdater"
+	updaterName       = "ubuntu"
+	updaterFlag       = "revision"
 	cveURL            = "http://people.ubuntu.com/~ubuntu-security/cve/%s"
 )
 
@@ -63,7 +65,7 @@ type updater struct {
 }
 
 func init() {
-	vulnsrc.RegisterUpdater("ubuntu", &updater{})
+	vulnsrc.RegisterUpdater(updaterName, &updater{})
 }
 
 func (u *updater) Update(datastore database.Datastore) (resp vulnsrc.UpdateResponse, err error) {
@@ -81,7 +83,7 @@ func (u *updater) Update(datastore database.Datastore) (resp vulnsrc.UpdateRespo
 	}
 
 	// Get the latest revision number we successfully applied in the database.
-	dbRevisionNumber, err := datastore.GetKeyValue("ubuntuUpdater")
+	dbRevisionNumber, err := datastore.GetKeyValueNS(updaterName, updaterFlag)
 	if err != nil {
 		return resp, err
 	}
@@ -153,7 +155,7 @@ func (u *updater) pullRepository() (err error) {
 		}
 
 		// Branch repository.
-		cmd := exec.Command("bzr", "branch", "--use-existing-dir", trackerRepository, ".")
+		cmd := exec.Command("bzr", "branch", "--use-existing-dir", vulnsrc.FeedURL(updaterName, trackerRepository), ".")
 		cmd.Dir = u.repositoryLocalPath
 		if out, err := cmd.CombinedOutput(); err != nil {
 			log.WithError(err).WithField("output", string(out)).Error("could not branch Ubuntu repository")
@@ -280,6 +282,18 @@ func parseUbuntuCVE(fileContent io.Reader) (vulnerability database.Vulnerability
 			continue
 		}
 
+		// Parse the publication date, e.g. "2017-01-10 16:59:00 UTC".
+		if strings.HasPrefix(line, "PublicDate:") {
+			date := strings.TrimSpace(strings.TrimPrefix(line, "PublicDate:"))
+			for _, layout := range []string{"2006-01-02 15:04:05 MST", "2006-01-02"} {
+				if t, err := time.Parse(layout, date); err == nil {
+					vulnerability.PublishedDate = t
+					break
+				}
+			}
+			continue
+		}
+
 		// Parse the priority.
 		if strings.HasPrefix(line, "Priority:") {
 			priority := strings.TrimSpace(strings.TrimPrefix(line, "Priority:"))
@@ -371,6 +385,7 @@ func parseUbuntuCVE(fileContent io.Reader) (vulnerability database.Vulnerability
 
 	// Trim extra spaces in the description
 	vulnerability.Description = strings.TrimSpace(vulnerability.Description)
+	vulnerability.Withdrawn = vulnsrc.IsWithdrawn(vulnerability.Description)
 
 	// If no link has been provided (CVE-2006-NNN0 for instance), add the link to the tracker
 	if vulnerability.Link == "" {
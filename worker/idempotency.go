@@ -0,0 +1,144 @@
+package worker
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/MXi4oyu/DockerXScan/imagefmt"
+	"github.com/MXi4oyu/DockerXScan/tarutil"
+)
+
+// DefaultIdempotencyTTL is how long the result of a layer is remembered when
+// the configuration does not tell.
+const DefaultIdempotencyTTL = 5 * time.Minute
+
+var (
+	// errInterrupted is the result of the submissions that waited for one
+	// that did not complete.
+	errInterrupted = errors.New("worker: the processing of the layer was interrupted, retry later")
+
+	promCoalescedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "clair_worker_coalesced_total",
+		Help: "Number of layer submissions answered by another one, in flight or completed.",
+	}, []string{"state"})
+
+	submissions = newSubmissions(DefaultIdempotencyTTL)
+
+	// coalesceLayers is whether the concurrent submissions of the same layer
+	// wait for the one processing it, which they do in default.
+	coalesceLayers = true
+)
+
+func init() {
+	prometheus.MustRegister(promCoalescedTotal)
+}
+
+// submission is a processing of a layer, whose err is set once done is
+// closed.
+type submission struct {
+	done chan struct{}
+	err  error
+
+	completedAt time.Time
+}
+
+// submissionSet coalesces the submissions sharing a key: those made while one
+// is in flight wait for its result, and those made within ttl of its
+// completion get its result, unless it is an error worth retrying.
+type submissionSet struct {
+	ttl time.Duration
+
+	mu        sync.Mutex
+	inFlight  map[string]*submission
+	completed map[string]*submission
+}
+
+func newSubmissions(ttl time.Duration) *submissionSet {
+	return &submissionSet{
+		ttl:       ttl,
+		inFlight:  make(map[string]*submission),
+		completed: make(map[string]*submission),
+	}
+}
+
+// do runs f, unless a submission with the same key is in flight or has just
+// completed, in which case its result is returned instead. A success is only
+// remembered with rememberSuccess, as a layer deleted since could not be
+// submitted again otherwise.
+func (s *submissionSet) do(key string, rememberSuccess bool, f func() error) error {
+	now := time.Now()
+
+	s.mu.Lock()
+	for k, c := range s.completed {
+		if now.Sub(c.completedAt) >= s.ttl {
+			delete(s.completed, k)
+		}
+	}
+	if c, ok := s.completed[key]; ok {
+		s.mu.Unlock()
+		promCoalescedTotal.WithLabelValues("completed").Inc()
+		return c.err
+	}
+	if c, ok := s.inFlight[key]; ok {
+		s.mu.Unlock()
+		promCoalescedTotal.WithLabelValues("in flight").Inc()
+		<-c.done
+		return c.err
+	}
+	// The waiters are released even if f panics, with errInterrupted.
+	c := &submission{done: make(chan struct{}), err: errInterrupted}
+	s.inFlight[key] = c
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.inFlight, key)
+		if s.ttl > 0 && isFinal(c.err) && (c.err != nil || rememberSuccess) {
+			c.completedAt = time.Now()
+			s.completed[key] = c
+		}
+		s.mu.Unlock()
+		close(c.done)
+	}()
+
+	c.err = f()
+	return c.err
+}
+
+// isFinal returns whether the result of a layer would be the same if it were
+// processed again right away, as opposed to a busy worker, a parent not yet
+// processed or a failure of the datastore.
+func isFinal(err error) bool {
+	switch err {
+	case nil, ErrUnsupported, imagefmt.ErrDigestMismatch, imagefmt.ErrMissingDigest, tarutil.ErrCouldNotExtract, tarutil.ErrExtractedFileTooBig, tarutil.ErrUnknownFormat:
+		return true
+	}
+	return false
+}
+
+// idempotencySubmissionKey returns the key of the submissions made with an
+// idempotency key.
+func idempotencySubmissionKey(idempotencyKey string) string {
+	return "key:" + idempotencyKey
+}
+
+// layerSubmissionKey returns the key of the submissions of a layer: its name
+// along with its digest and the name of its parent, as the same name with
+// another content is another layer, and the same layer on top of another
+// parent is not processed the same.
+func layerSubmissionKey(name, digest, parentName string) string {
+	return "layer:" + name + "@" + digest + "^" + parentName
+}
+
+// setIdempotencyTTL sets how long the results of the layers are remembered,
+// forgetting those remembered so far.
+func setIdempotencyTTL(ttl time.Duration) {
+	submissions.mu.Lock()
+	defer submissions.mu.Unlock()
+
+	submissions.ttl = ttl
+	submissions.completed = make(map[string]*submission)
+}
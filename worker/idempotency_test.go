@@ -0,0 +1,224 @@
+package worker
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/MXi4oyu/DockerXScan/database"
+)
+
+// waitInFlight waits until n more submissions than before are waiting for
+// one in flight.
+func waitInFlight(t *testing.T, before float64, n int) {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if coalesced("in flight")-before >= float64(n) {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%v submissions are waiting for the one in flight, want %d", coalesced("in flight")-before, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// coalesced returns how many submissions were answered by another one in the
+// state.
+func coalesced(state string) float64 {
+	var m dto.Metric
+	promCoalescedTotal.WithLabelValues(state).Write(&m)
+	return m.GetCounter().GetValue()
+}
+
+func TestSubmissionsConcurrent(t *testing.T) {
+	const submitters = 10
+	s := newSubmissions(time.Minute)
+	failed := errors.New("failed")
+
+	var runs int32
+	release := make(chan struct{})
+	f := func() error {
+		atomic.AddInt32(&runs, 1)
+		<-release
+		return failed
+	}
+
+	before := coalesced("in flight")
+	var wg sync.WaitGroup
+	errs := make([]error, submitters)
+	for i := 0; i < submitters; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = s.do(layerSubmissionKey("layer", "sha256:0123", "parent"), false, f)
+		}(i)
+	}
+	// The others wait for the one running f.
+	waitInFlight(t, before, submitters-1)
+	close(release)
+	wg.Wait()
+
+	if runs != 1 {
+		t.Errorf("%d concurrent submissions ran f %d times, want once", submitters, runs)
+	}
+	for i, err := range errs {
+		if err != failed {
+			t.Errorf("submission %d returned %v, want the result of the one in flight", i, err)
+		}
+	}
+}
+
+func TestSubmissionsCompleted(t *testing.T) {
+	tests := []struct {
+		name            string
+		ttl             time.Duration
+		err             error
+		rememberSuccess bool
+		runs            int32
+	}{
+		{"success forgotten", time.Minute, nil, false, 2},
+		{"success remembered", time.Minute, nil, true, 1},
+		{"final error", time.Minute, ErrUnsupported, false, 1},
+		// Retrying may succeed.
+		{"busy", time.Minute, ErrTooBusy, true, 2},
+		{"parent unknown", time.Minute, ErrParentUnknown, true, 2},
+		{"nothing remembered", 0, ErrUnsupported, true, 2},
+	}
+
+	for _, test := range tests {
+		s := newSubmissions(test.ttl)
+		var runs int32
+		f := func() error {
+			atomic.AddInt32(&runs, 1)
+			return test.err
+		}
+
+		for i := 0; i < 2; i++ {
+			if err := s.do("key", test.rememberSuccess, f); err != test.err {
+				t.Errorf("%s: submission %d returned %v, want %v", test.name, i, err, test.err)
+			}
+		}
+		if runs != test.runs {
+			t.Errorf("%s: 2 submissions in turn ran f %d times, want %d", test.name, runs, test.runs)
+		}
+	}
+}
+
+func TestSubmissionsPanic(t *testing.T) {
+	s := newSubmissions(time.Minute)
+	started, release := make(chan struct{}), make(chan struct{})
+
+	before := coalesced("in flight")
+	go func() {
+		defer func() { recover() }()
+		s.do("key", true, func() error {
+			close(started)
+			<-release
+			panic("processing failed")
+		})
+	}()
+	<-started
+
+	// The waiters are released, and the next submission processes it again.
+	done := make(chan error)
+	go func() { done <- s.do("key", true, func() error { return nil }) }()
+	waitInFlight(t, before, 1)
+	close(release)
+	if err := <-done; err != errInterrupted {
+		t.Errorf("the submission waiting for one panicking returned %v, want %v", err, errInterrupted)
+	}
+	ran := false
+	s.do("key", true, func() error { ran = true; return nil })
+	if !ran {
+		t.Error("the submission following one interrupted was not processed")
+	}
+}
+
+func TestProcessLayerCoalesced(t *testing.T) {
+	const scans = 10
+
+	// The layer is found stored already, once its processing is released.
+	var lookups int32
+	release := make(chan struct{})
+	datastore := &database.MockDatastore{
+		FctFindLayer: func(name string, withFeatures, withVulnerabilities bool) (database.Layer, error) {
+			atomic.AddInt32(&lookups, 1)
+			<-release
+			return database.Layer{Name: name, EngineVersion: Version}, nil
+		},
+	}
+
+	// The concurrent scans of an image submit its layers under keys of their
+	// own, none remembered from a previous run.
+	setIdempotencyTTL(DefaultIdempotencyTTL)
+	before := coalesced("in flight")
+	var wg sync.WaitGroup
+	errs := make([]error, scans)
+	for i := 0; i < scans; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = ProcessLayerWithKey(datastore, fmt.Sprintf("TestProcessLayerCoalesced-%d", i), "Docker", "", "TestProcessLayerCoalesced", "", "http://127.0.0.1:0/layer", "sha256:0123", nil)
+		}(i)
+	}
+	waitInFlight(t, before, scans-1)
+	close(release)
+	wg.Wait()
+
+	if lookups != 1 {
+		t.Errorf("%d concurrent scans processed the layer %d times, want once", scans, lookups)
+	}
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("scan %d failed: %s", i, err)
+		}
+	}
+}
+
+func TestProcessLayerCoalescedByParent(t *testing.T) {
+	const scans = 5
+
+	// The layer is stored on top of parent-a, and on top of parent-b under its
+	// chain name.
+	var lookups int32
+	release := make(chan struct{})
+	datastore := &database.MockDatastore{
+		FctFindLayer: func(name string, withFeatures, withVulnerabilities bool) (database.Layer, error) {
+			if name != "TestProcessLayerCoalescedByParent" {
+				return database.Layer{Name: name, EngineVersion: Version, Parent: &database.Layer{Name: "parent-b"}}, nil
+			}
+			atomic.AddInt32(&lookups, 1)
+			<-release
+			return database.Layer{Name: name, EngineVersion: Version, Parent: &database.Layer{Name: "parent-a"}}, nil
+		},
+	}
+
+	// The submissions on top of another parent do not wait for those on top
+	// of parent-a, whose result is not theirs.
+	before := coalesced("in flight")
+	var wg sync.WaitGroup
+	for _, parent := range []string{"parent-a", "parent-b"} {
+		for i := 0; i < scans; i++ {
+			wg.Add(1)
+			go func(parent string) {
+				defer wg.Done()
+				if err := ProcessLayer(datastore, "Docker", "TestProcessLayerCoalescedByParent", parent, "http://127.0.0.1:0/layer", "sha256:0123", nil); err != nil {
+					t.Errorf("a scan on top of %s failed: %s", parent, err)
+				}
+			}(parent)
+		}
+	}
+	waitInFlight(t, before, 2*(scans-1))
+	close(release)
+	wg.Wait()
+
+	if lookups != 2 {
+		t.Errorf("the concurrent scans on top of 2 parents processed the layer %d times, want once per parent", lookups)
+	}
+}
@@ -0,0 +1,83 @@
+package worker
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// ErrTooBusy is the error that should be raised when a layer can't be
+	// queued because the worker queue is full.
+	ErrTooBusy = errors.New("worker: too many layers are being processed, retry later")
+
+	promQueueDepth = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "clair_worker_queue_depth",
+		Help: "Number of layers waiting for a worker.",
+	})
+
+	promActiveWorkers = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "clair_worker_active_total",
+		Help: "Number of layers being processed.",
+	})
+
+	// layerQueue bounds the processing of layers, unbounded in default.
+	layerQueue *queue
+)
+
+func init() {
+	prometheus.MustRegister(promQueueDepth)
+	prometheus.MustRegister(promActiveWorkers)
+}
+
+// queue runs at most concurrency functions at once, and rejects new ones with
+// ErrTooBusy once maxDepth functions are already waiting.
+type queue struct {
+	slots    chan struct{}
+	maxDepth int
+
+	mu    sync.Mutex
+	depth int
+}
+
+func newQueue(concurrency, maxDepth int) *queue {
+	return &queue{
+		slots:    make(chan struct{}, concurrency),
+		maxDepth: maxDepth,
+	}
+}
+
+// do runs f once a slot is available. A nil queue runs f immediately.
+func (q *queue) do(f func() error) error {
+	if q == nil {
+		return f()
+	}
+
+	select {
+	case q.slots <- struct{}{}:
+	default:
+		// Every worker is busy, wait in the queue if there is room left.
+		q.mu.Lock()
+		if q.depth >= q.maxDepth {
+			q.mu.Unlock()
+			return ErrTooBusy
+		}
+		q.depth++
+		q.mu.Unlock()
+		promQueueDepth.Inc()
+
+		q.slots <- struct{}{}
+
+		q.mu.Lock()
+		q.depth--
+		q.mu.Unlock()
+		promQueueDepth.Dec()
+	}
+	defer func() { <-q.slots }()
+
+	promActiveWorkers.Inc()
+	defer promActiveWorkers.Dec()
+
+	return f()
+}
@@ -1,7 +1,12 @@
 package worker
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path"
 	"regexp"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 
@@ -11,6 +16,7 @@ import (
 	"github.com/MXi4oyu/DockerXScan/common/commonerr"
 	"github.com/MXi4oyu/DockerXScan/tarutil"
 	"github.com/MXi4oyu/DockerXScan/imagefmt"
+	"github.com/MXi4oyu/DockerXScan/versionfmt"
 )
 
 const (
@@ -30,8 +36,186 @@ var (
 	ErrParentUnknown = commonerr.NewBadRequestError("worker: parent layer is unknown, it must be processed first")
 
 	urlParametersRegexp = regexp.MustCompile(`(\?|\&)([^=]+)\=([^ &]+)`)
+
+	// fallbackNamespace is assigned to layers whose namespace could neither
+	// be detected nor inherited from their parent, disabled in default.
+	fallbackNamespace *database.Namespace
 )
 
+// Config is the configuration for the worker.
+type Config struct {
+	// FallbackNamespace is the namespace (e.g. "debian:9") of the layers in
+	// which no namespace could be detected. FallbackVersionFormat is its
+	// version format (e.g. "dpkg").
+	FallbackNamespace     string
+	FallbackVersionFormat string
+
+	// Concurrency is the maximum number of layers processed at once, zero
+	// meaning unbounded. MaxQueueDepth is the number of layers that may wait
+	// for a worker before ErrTooBusy is returned.
+	Concurrency   int
+	MaxQueueDepth int
+
+	// EnabledListers are the names of the feature listers (e.g. "dpkg",
+	// "rpm") run on the layers, every registered one when empty.
+	// DisabledListers are never run.
+	EnabledListers  []string
+	DisabledListers []string
+
+	// PathFilters restrict the files read by the feature listers, by name,
+	// with glob patterns of the files to include and exclude (e.g.
+	// "node_modules/*/test"). The files excluded for every lister requiring
+	// them are not even read from the layers.
+	PathFilters map[string]featurefmt.PathFilter
+
+	// LayerCacheDir is the directory in which the layers downloaded by their
+	// digest are kept, so that the layers shared by images are downloaded
+	// once. LayerCacheMaxSize is its size in bytes.
+	LayerCacheDir     string
+	LayerCacheMaxSize int64
+
+	// FollowSymlinks makes the symbolic links of the layers be followed to
+	// find the package databases, such as a var/lib/dpkg linked to another
+	// directory of the layer.
+	FollowSymlinks bool
+
+	// SearchRoots are the directories of the layers (e.g. "sysroot") in which
+	// the package databases are also looked for, when an image holds a system
+	// elsewhere than at its root.
+	SearchRoots []string
+
+	// NestedRoots enables the discovery of the package databases in any
+	// subdirectory of the layers, such as a system built by debootstrap in
+	// opt/rootfs. Their features are tagged with the path of their root.
+	NestedRoots bool
+
+	// IdempotencyTTL is how long the result of a layer is returned to the
+	// submissions of the same layer or idempotency key, instead of
+	// processing it again. DefaultIdempotencyTTL is used when it is zero, and
+	// a negative one disables it. The submissions made while a layer is being
+	// processed always wait for its result.
+	IdempotencyTTL time.Duration
+
+	// DisableCoalescing makes each submission without an idempotency key be
+	// processed on its own, even while the same layer is being processed,
+	// instead of waiting for its result. It is only meant for debugging, as
+	// concurrent submissions then download and analyze the layer each.
+	DisableCoalescing bool
+
+	// SkipDigestVerification disables the verification of the layers against
+	// their digest. It is only meant for debugging.
+	SkipDigestVerification bool
+}
+
+// Configure applies the worker configuration. A nil configuration keeps the
+// defaults.
+func Configure(cfg *Config) error {
+	fallbackNamespace = nil
+	layerQueue = nil
+	if cfg == nil {
+		tarutil.SetFollowSymlinks(false)
+		featurefmt.SetSearchRoots(nil)
+		featurefmt.SetNestedRoots(false)
+		imagefmt.SetLayerCache("", 0)
+		imagefmt.SetVerifyDigests(true)
+		setIdempotencyTTL(DefaultIdempotencyTTL)
+		coalesceLayers = true
+		featurefmt.SetPathFilters(nil)
+		return featurefmt.SetEnabledListers(nil, nil)
+	}
+
+	if errs := ValidateConfig(cfg); len(errs) > 0 {
+		return errs[0]
+	}
+
+	if cfg.Concurrency > 0 {
+		layerQueue = newQueue(cfg.Concurrency, cfg.MaxQueueDepth)
+	}
+
+	switch {
+	case cfg.IdempotencyTTL == 0:
+		setIdempotencyTTL(DefaultIdempotencyTTL)
+	case cfg.IdempotencyTTL < 0:
+		setIdempotencyTTL(0)
+	default:
+		setIdempotencyTTL(cfg.IdempotencyTTL)
+	}
+	coalesceLayers = !cfg.DisableCoalescing
+
+	tarutil.SetFollowSymlinks(cfg.FollowSymlinks)
+	featurefmt.SetSearchRoots(cfg.SearchRoots)
+	featurefmt.SetNestedRoots(cfg.NestedRoots)
+	imagefmt.SetVerifyDigests(!cfg.SkipDigestVerification)
+	if cfg.SkipDigestVerification {
+		log.Warning("worker: the digests of the layers are not verified")
+	}
+
+	if err := featurefmt.SetEnabledListers(cfg.EnabledListers, cfg.DisabledListers); err != nil {
+		return commonerr.NewBadRequestError("worker: " + err.Error())
+	}
+	if err := featurefmt.SetPathFilters(cfg.PathFilters); err != nil {
+		return commonerr.NewBadRequestError("worker: " + err.Error())
+	}
+
+	if err := imagefmt.SetLayerCache(cfg.LayerCacheDir, cfg.LayerCacheMaxSize); err != nil {
+		return err
+	}
+
+	if cfg.FallbackNamespace == "" {
+		return nil
+	}
+
+	fallbackNamespace = &database.Namespace{
+		Name:          cfg.FallbackNamespace,
+		VersionFormat: cfg.FallbackVersionFormat,
+	}
+
+	return nil
+}
+
+// ValidateConfig returns the problems of a worker configuration that Configure
+// would reject, without applying it: negative concurrency or queue depth,
+// unknown listers, and a fallback namespace of an unknown version format.
+func ValidateConfig(cfg *Config) []error {
+	if cfg == nil {
+		return nil
+	}
+
+	var errs []error
+	if cfg.Concurrency < 0 || cfg.MaxQueueDepth < 0 {
+		errs = append(errs, commonerr.NewBadRequestError("worker: concurrency and queue depth must not be negative"))
+	}
+
+	registered := make(map[string]bool)
+	for _, name := range featurefmt.ListListers() {
+		registered[name] = true
+	}
+	for _, name := range append(append([]string{}, cfg.EnabledListers...), cfg.DisabledListers...) {
+		if !registered[name] {
+			errs = append(errs, commonerr.NewBadRequestError(fmt.Sprintf("worker: featurefmt: unknown Lister %q", name)))
+		}
+	}
+	for name, filter := range cfg.PathFilters {
+		if !registered[name] {
+			errs = append(errs, commonerr.NewBadRequestError(fmt.Sprintf("worker: featurefmt: unknown Lister %q", name)))
+			continue
+		}
+		for _, pattern := range append(append([]string{}, filter.Include...), filter.Exclude...) {
+			if _, err := path.Match(pattern, ""); err != nil {
+				errs = append(errs, commonerr.NewBadRequestError(fmt.Sprintf("worker: featurefmt: invalid path pattern %q of Lister %q", pattern, name)))
+			}
+		}
+	}
+
+	if cfg.FallbackNamespace != "" {
+		if _, exists := versionfmt.GetParser(cfg.FallbackVersionFormat); !exists {
+			errs = append(errs, commonerr.NewBadRequestError("worker: unknown version format for the fallback namespace: "+cfg.FallbackVersionFormat))
+		}
+	}
+
+	return errs
+}
+
 // cleanURL removes all parameters from an URL.
 func cleanURL(str string) string {
 	return urlParametersRegexp.ReplaceAllString(str, "")
@@ -40,9 +224,52 @@ func cleanURL(str string) string {
 // ProcessLayer detects the Namespace of a layer, the features it adds/removes,
 // and then stores everything in the database.
 //
+// The layer must match digest, "sha256:<hex>", when it is not empty. A layer
+// that does not is rejected with imagefmt.ErrDigestMismatch before anything is
+// stored.
+//
+// When the worker queue is configured, ProcessLayer waits for a free worker
+// and returns ErrTooBusy if the queue is full.
+//
 // TODO(Quentin-M): We could have a goroutine that looks for layers that have
 // been analyzed with an older engine version and that processes them.
-func ProcessLayer(datastore database.Datastore, imageFormat, name, parentName, path string, headers map[string]string) error {
+func ProcessLayer(datastore database.Datastore, imageFormat, name, parentName, path, digest string, headers map[string]string) error {
+	return ProcessLayerWithKey(datastore, "", imageFormat, "", name, parentName, path, digest, headers)
+}
+
+// ProcessLayerWithKey is ProcessLayer for a submission identified by an
+// idempotency key, such as one retried by a client after a timeout. The
+// submissions made with the same key, or without a key for the same layer,
+// digest and parent, while one is being processed get its result rather than
+// processing the layer again, as do those made shortly after it is done.
+// Whatever their keys, the concurrent submissions of the same layer, digest
+// and parent wait for the one processing it, so that a layer is downloaded,
+// analyzed and inserted once when several images sharing it are submitted at
+// once.
+//
+// The mediaType of the layer, as declared by the manifest of its image, tells
+// how it is compressed. When it is empty, the compression is detected from the
+// content of the layer.
+func ProcessLayerWithKey(datastore database.Datastore, idempotencyKey, imageFormat, mediaType, name, parentName, path, digest string, headers map[string]string) error {
+	process := func() error {
+		return layerQueue.do(func() error {
+			return processLayer(datastore, imageFormat, mediaType, name, parentName, path, digest, headers)
+		})
+	}
+	if coalesceLayers {
+		processOnce := process
+		process = func() error {
+			return submissions.do(layerSubmissionKey(name, digest, parentName), false, processOnce)
+		}
+	}
+
+	if idempotencyKey == "" {
+		return process()
+	}
+	return submissions.do(idempotencySubmissionKey(idempotencyKey), true, process)
+}
+
+func processLayer(datastore database.Datastore, imageFormat, mediaType, name, parentName, path, digest string, headers map[string]string) error {
 	// Verify parameters.
 	if name == "" {
 		return commonerr.NewBadRequestError("could not process a layer which does not have a name")
@@ -58,8 +285,9 @@ func ProcessLayer(datastore database.Datastore, imageFormat, name, parentName, p
 
 	log.WithFields(log.Fields{logLayerName: name, "path": cleanURL(path), "engine version": Version, "parent layer": parentName, "format": imageFormat}).Debug("processing layer")
 
-	// Check to see if the layer is already in the database.
-	layer, err := datastore.FindLayer(name, false, false)
+	// Check to see if the layer is already in the database, under its name or
+	// else its chain name when its name is taken on top of another parent.
+	name, layer, err := findStoredLayer(datastore, name, parentName)
 	if err != nil && err != commonerr.ErrNotFound {
 		return err
 	}
@@ -82,6 +310,12 @@ func ProcessLayer(datastore database.Datastore, imageFormat, name, parentName, p
 			layer.Parent = &parent
 		}
 	} else {
+		// Even the chain name is taken on top of another parent.
+		if storedParentName(layer) != parentName {
+			log.WithFields(log.Fields{logLayerName: name, "stored parent layer": storedParentName(layer), "parent layer": parentName}).Warning("the layer is already stored on top of another parent")
+			return database.ErrParentMismatch
+		}
+
 		// The layer is already in the database, check if we need to update it.
 		if layer.EngineVersion >= Version {
 			log.WithFields(log.Fields{logLayerName: name, "past engine version": layer.EngineVersion, "current engine version": Version}).Debug("layer content has already been processed in the past with older engine. skipping analysis")
@@ -91,19 +325,79 @@ func ProcessLayer(datastore database.Datastore, imageFormat, name, parentName, p
 	}
 
 	// Analyze the content.
-	layer.Namespace, layer.Features, err = detectContent(imageFormat, name, path, headers, layer.Parent)
+	layer.Namespace, layer.Features, err = detectContent(imageFormat, mediaType, name, path, digest, headers, layer.Parent)
 	if err != nil {
 		return err
 	}
 
+	// The layers are found again by their digest, which is only trusted once
+	// the content has been verified against it.
+	if imagefmt.VerifiesDigests() {
+		layer.Digest = digest
+	}
+
 	return datastore.InsertLayer(layer)
 }
 
+// StoredLayerName returns the name under which a layer submitted on top of a
+// parent is stored, which is the one it is found by and the name of the parent
+// of the layers submitted on top of it.
+//
+// As the features of a layer include those of its parents, the same content on
+// top of different parents makes different layers. A layer is stored under its
+// name, unless a layer of that name is stored on top of another parent, such
+// as when images built differently share a layer named by its digest: it is
+// then stored under its chain name, derived from its name and that of its
+// parent as a chain ID is.
+func StoredLayerName(datastore database.Datastore, name, parentName string) (string, error) {
+	name, _, err := findStoredLayer(datastore, name, parentName)
+	if err != nil && err != commonerr.ErrNotFound {
+		return "", err
+	}
+	return name, nil
+}
+
+// findStoredLayer returns the name under which a layer submitted on top of a
+// parent is stored, along with the layer if it is already stored, or
+// commonerr.ErrNotFound.
+func findStoredLayer(datastore database.Datastore, name, parentName string) (string, database.Layer, error) {
+	layer, err := datastore.FindLayer(name, false, false)
+	if err != nil || storedParentName(layer) == parentName {
+		return name, layer, err
+	}
+
+	chainName := chainLayerName(name, parentName)
+	log.WithFields(log.Fields{logLayerName: name, "stored parent layer": storedParentName(layer), "parent layer": parentName, "chain name": chainName}).Debug("the layer is stored on top of another parent, using its chain name")
+	layer, err = datastore.FindLayer(chainName, false, false)
+	return chainName, layer, err
+}
+
+// chainLayerName returns the chain name of a layer on top of a parent, which
+// is "sha256:<hex>" of the name of the parent and that of the layer, separated
+// by a space.
+func chainLayerName(name, parentName string) string {
+	sum := sha256.Sum256([]byte(parentName + " " + name))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// storedParentName returns the name of the parent of a stored layer, or an
+// empty string if it has none.
+func storedParentName(layer database.Layer) string {
+	if layer.Parent == nil {
+		return ""
+	}
+	return layer.Parent.Name
+}
+
 // detectContent downloads a layer's archive and extracts its Namespace and
 // Features.
-func detectContent(imageFormat, name, path string, headers map[string]string, parent *database.Layer) (namespace *database.Namespace, featureVersions []database.FeatureVersion, err error) {
+func detectContent(imageFormat, mediaType, name, path, digest string, headers map[string]string, parent *database.Layer) (namespace *database.Namespace, featureVersions []database.FeatureVersion, err error) {
 	totalRequiredFiles := append(featurefmt.RequiredFilenames(), featurens.RequiredFilenames()...)
-	files, err := imagefmt.Extract(imageFormat, path, headers, totalRequiredFiles)
+	files, err := imagefmt.Extract(imageFormat, mediaType, path, digest, headers, totalRequiredFiles)
+	if err == tarutil.ErrTruncatedArchive {
+		log.WithFields(log.Fields{logLayerName: name, "path": cleanURL(path)}).Warning("layer is truncated, analyzing the files read before its end")
+		err = nil
+	}
 	if err != nil {
 		log.WithError(err).WithFields(log.Fields{logLayerName: name, "path": cleanURL(path)}).Error("failed to extract data from path")
 		return
@@ -145,6 +439,12 @@ func detectNamespace(name string, files tarutil.FilesMap, parent *database.Layer
 		}
 	}
 
+	// Fallback to the configured namespace.
+	if fallbackNamespace != nil {
+		namespace = fallbackNamespace
+		log.WithFields(log.Fields{logLayerName: name, "fallback namespace": namespace.Name}).Info("could not detect namespace, using the fallback namespace")
+	}
+
 	return
 }
 
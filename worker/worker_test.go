@@ -0,0 +1,141 @@
+package worker
+
+import (
+	"archive/tar"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/MXi4oyu/DockerXScan/common/commonerr"
+	"github.com/MXi4oyu/DockerXScan/database"
+	_ "github.com/MXi4oyu/DockerXScan/imagefmt/docker"
+)
+
+func TestProcessLayerParentMismatch(t *testing.T) {
+	chainName := chainLayerName("layer", "parent-b")
+	tests := []struct {
+		name               string
+		stored             map[string]string
+		parent, wantLookup string
+		want               error
+	}{
+		// The same layer on top of the same parent is already processed.
+		{"same parent", map[string]string{"layer": "parent-a"}, "parent-a", "layer", nil},
+		{"no parent", map[string]string{"layer": ""}, "", "layer", nil},
+		// On top of another parent, it is processed under its chain name.
+		{"other parent", map[string]string{"layer": "parent-a", chainName: "parent-b"}, "parent-b", chainName, nil},
+		{"parent added", map[string]string{"layer": "", chainName: "parent-b"}, "parent-b", chainName, nil},
+		// The chain name is taken on top of another parent too.
+		{"chain name taken", map[string]string{"layer": "parent-a", chainName: "parent-c"}, "parent-b", chainName, database.ErrParentMismatch},
+	}
+
+	for _, test := range tests {
+		var lookup string
+		datastore := &database.MockDatastore{
+			FctFindLayer: func(name string, withFeatures, withVulnerabilities bool) (database.Layer, error) {
+				lookup = name
+				parent, ok := test.stored[name]
+				if !ok {
+					return database.Layer{}, commonerr.ErrNotFound
+				}
+				layer := database.Layer{Name: name, EngineVersion: Version}
+				if parent != "" {
+					layer.Parent = &database.Layer{Name: parent}
+				}
+				return layer, nil
+			},
+			FctInsertLayer: func(layer database.Layer) error {
+				t.Errorf("%s: ProcessLayer() inserted the layer on top of %v", test.name, layer.Parent)
+				return nil
+			},
+		}
+
+		// Nothing is downloaded, the layer being stored already.
+		err := ProcessLayer(datastore, "Docker", "layer", test.parent, "http://127.0.0.1:0/layer", "", nil)
+		if err != test.want {
+			t.Errorf("%s: ProcessLayer() on top of %q = %v, want %v", test.name, test.parent, err, test.want)
+		}
+		if lookup != test.wantLookup {
+			t.Errorf("%s: ProcessLayer() on top of %q found the layer %q, want %q", test.name, test.parent, lookup, test.wantLookup)
+		}
+	}
+}
+
+func TestProcessLayerOnTwoParents(t *testing.T) {
+	dir, err := ioutil.TempDir("", "worker-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Every layer is the same empty archive.
+	path := filepath.Join(dir, "layer.tar")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tar.NewWriter(f).Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	layers := make(map[string]database.Layer)
+	datastore := &database.MockDatastore{
+		FctFindLayer: func(name string, withFeatures, withVulnerabilities bool) (database.Layer, error) {
+			layer, ok := layers[name]
+			if !ok {
+				return database.Layer{}, commonerr.ErrNotFound
+			}
+			return layer, nil
+		},
+		FctInsertLayer: func(layer database.Layer) error {
+			layer.ID = len(layers) + 1
+			layers[layer.Name] = layer
+			return nil
+		},
+	}
+
+	// Two images built differently share a layer named by its digest.
+	images := map[string][]string{
+		"image-a": {"base-a", "layer", "top-a"},
+		"image-b": {"base-b", "layer", "top-b"},
+	}
+	tops := make(map[string]string)
+	for image, names := range images {
+		parentName := ""
+		for _, name := range names {
+			if err := ProcessLayer(datastore, "Docker", name, parentName, path, "", nil); err != nil {
+				t.Fatalf("%s: ProcessLayer(%q) on top of %q failed: %s", image, name, parentName, err)
+			}
+			if parentName, err = StoredLayerName(datastore, name, parentName); err != nil {
+				t.Fatalf("%s: StoredLayerName(%q) failed: %s", image, name, err)
+			}
+		}
+		tops[image] = parentName
+	}
+
+	// Each image resolves its own ancestry.
+	for image, names := range images {
+		layer, ok := layers[tops[image]]
+		for i := len(names) - 1; i >= 0; i-- {
+			if !ok {
+				t.Errorf("%s: the layer %q is not stored", image, names[i])
+				break
+			}
+			if names[i] != "layer" && layer.Name != names[i] {
+				t.Errorf("%s: the layer %q is stored as %q", image, names[i], layer.Name)
+			}
+			if layer.Parent == nil {
+				if i > 0 {
+					t.Errorf("%s: the layer %q is stored without its parent", image, layer.Name)
+				}
+				break
+			}
+			layer, ok = layers[layer.Parent.Name]
+		}
+	}
+	if len(layers) != 6 {
+		t.Errorf("ProcessLayer() stored %d layers of the 2 images, want 6", len(layers))
+	}
+}